@@ -0,0 +1,84 @@
+package api
+
+import (
+	"encoding/xml"
+	"errors"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// Amount is a number of minor units. It is written to JSON as a string so
+// clients that read numbers as float64 don't lose precision, and read from
+// a string or an integer; fractions and exponents are rejected.
+type Amount int64
+
+var amountPattern = regexp.MustCompile(`^-?[0-9]+$`)
+
+var ErrInvalidAmount = errors.New("amount must be a whole number of minor units")
+
+func (a Amount) String() string {
+	return strconv.FormatInt(int64(a), 10)
+}
+
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return strconv.AppendQuote(nil, a.String()), nil
+}
+
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	var text string = string(data)
+	if text == "null" {
+		return nil
+	}
+	if len(text) >= 2 && text[0] == '"' && text[len(text)-1] == '"' {
+		text = text[1 : len(text)-1]
+	}
+
+	if !amountPattern.MatchString(text) {
+		return ErrInvalidAmount
+	}
+	value, err := strconv.ParseInt(text, 10, 64)
+	if err != nil {
+		return ErrInvalidAmount
+	}
+
+	*a = Amount(value)
+	return nil
+}
+
+// AmountMap is a set of balances by currency. In XML it is a list of
+// elements like <Balance Currency="coins">100</Balance>, sorted by currency.
+type AmountMap map[string]Amount
+
+func (m AmountMap) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	var keys = make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	err := e.EncodeToken(start)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		var entry = xml.StartElement{
+			Name: xml.Name{Local: "Balance"},
+			Attr: []xml.Attr{{Name: xml.Name{Local: "Currency"}, Value: key}},
+		}
+		err = e.EncodeElement(m[key], entry)
+		if err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
+
+// Amounts converts a map of balances for a response.
+func Amounts(balances map[string]int64) AmountMap {
+	var amounts = make(AmountMap, len(balances))
+	for key, value := range balances {
+		amounts[key] = Amount(value)
+	}
+	return amounts
+}
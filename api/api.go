@@ -1,40 +1,715 @@
 package api
 
 import (
-	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
+	"time"
 )
 
+// Currency defaults to "coins" wherever it is optional.
+type CoinAmountParams struct {
+	Amount   Amount `validate:"required,min=1"`
+	Currency string
+}
+
+// ToCurrency may only repeat Currency, exchanges are not supported.
+type TransferParams struct {
+	To         string `validate:"required,username"`
+	Amount     Amount `validate:"required,min=1"`
+	Currency   string
+	ToCurrency string
+}
+
+// StatusCode is only set with api.status_code_in_body, as in
+// CoinBalanceResponse.
+type TransferResponse struct {
+	StatusCode int `json:",omitempty" xml:",omitempty"`
+	TransferID string
+	Currency   string
+	Balance    Amount
+}
+
 type CoinBalanceParams struct {
+	// Username is ignored, see TransactionListParams. The balance of a
+	// user by name is that of /v1/users/{username}/coins.
+	Username string `validate:"username"`
+	Currency string
+	// AsOf, an RFC 3339 time, asks for the balances at that time.
+	AsOf string `schema:"as_of"`
+}
+
+type UserCoinBalanceParams struct {
+	Currency string
+	AsOf     string `schema:"as_of"`
+}
+
+type TransactionListParams struct {
+	// Username is ignored, the user comes from the token. It is kept so
+	// clients that still send it are not rejected.
+	Username string `validate:"username"`
+	PageRequest
+}
+
+type Transaction struct {
+	ID           string
+	Type         string
+	Currency     string
+	Amount       Amount
+	Counterparty string `json:",omitempty" xml:",omitempty"`
+	Balance      Amount
+	Timestamp    time.Time
+	Actor        string `json:",omitempty" xml:",omitempty"`
+	Reason       string `json:",omitempty" xml:",omitempty"`
+}
+
+// TransactionListResponse lists the transactions newest first, in the
+// order they were recorded, so pages neither skip nor repeat any as new
+// ones come in.
+type TransactionListResponse struct {
+	StatusCode int
+	PageResponse[Transaction]
+}
+
+type LeaderboardParams struct {
+	PageRequest
+}
+
+type LeaderboardEntry struct {
+	Rank     int
+	Username string
+	Balance  Amount
+}
+
+// LeaderboardResponse ranks the users by descending balance, ties by
+// username. Pages go by rank, so balances changing between them may move a
+// user from one page to another.
+type LeaderboardResponse struct {
+	StatusCode int
+	PageResponse[LeaderboardEntry]
+}
+
+// LeaderboardRefreshResponse describes the ranking the leaderboard serves:
+// Modified is when it last changed, Refreshed when it was computed.
+type LeaderboardRefreshResponse struct {
+	StatusCode int
+	Users      int
+	Modified   time.Time
+	Refreshed  time.Time
+}
+
+type CreateUserParams struct {
+	Username string `validate:"required,username"`
+	Password string `validate:"required,min=8,max=72"`
+}
+
+type CreateUserResponse struct {
+	StatusCode int
+	Username   string
+	AuthToken  string
+	ExpiresAt  time.Time
+}
+
+// LoginParams log in for a token granting Scopes, all when empty.
+type LoginParams struct {
+	Username string `validate:"required"`
+	Password string `validate:"required"`
+	Scopes   []string
+}
+
+type LoginResponse struct {
+	StatusCode int
+	AuthToken  string
+	ExpiresAt  time.Time
+	Scopes     []string `xml:"Scopes>Scope"`
+}
+
+// RefreshParams ask the new token for Scopes, those of the old one when
+// empty, which must grant them.
+type RefreshParams struct {
+	Scopes []string `schema:"scope"`
+}
+
+type ChangePasswordParams struct {
+	CurrentPassword string `validate:"required"`
+	NewPassword     string `validate:"required,min=8,max=72"`
+}
+
+type ProfileResponse struct {
+	StatusCode  int
+	Username    string
+	DisplayName string `json:",omitempty" xml:",omitempty"`
+	Email       string `json:",omitempty" xml:",omitempty"`
+	Balance     Amount
+	Role        string
+	CreatedAt   time.Time
+}
+
+// Version, if set, must match the Version of the balance or the request
+// fails with 409.
+type SetBalanceParams struct {
+	Balance *Amount `validate:"required"`
+	Reason  string
+	Force   bool
+	Version int64
+}
+
+type AdjustBalanceParams struct {
+	Delta   Amount `validate:"required"`
+	Reason  string
+	Force   bool
+	Version int64
+}
+
+type AdminBalanceResponse struct {
+	StatusCode int
+	Username   string
+	Balance    Amount
+	Version    int64
+}
+
+type BatchBalanceParams struct {
+	Usernames []string `validate:"required,max=100"`
+}
+
+// BatchBalanceResult is the outcome for one requested username, Error is
+// set instead of Balance when the lookup failed.
+type BatchBalanceResult struct {
+	Username string
+	Balance  *Amount `json:",omitempty" xml:",omitempty"`
+	Error    string  `json:",omitempty" xml:",omitempty"`
+
+	// AsOf is set on balances served stale, when they were read.
+	AsOf *time.Time `json:",omitempty" xml:",omitempty"`
+}
+
+type BatchBalanceResponse struct {
+	StatusCode int
+	Results    []BatchBalanceResult `xml:"Results>Result"`
+	Balances   AmountMap
+	NotFound   []string `xml:"NotFound>Username"`
+}
+
+type UserSearchParams struct {
+	// Username is ignored, see TransactionListParams.
+	Username string `validate:"username"`
+	Prefix   string
+	MinCoins *int64 `schema:"min_coins"`
+	MaxCoins *int64 `schema:"max_coins"`
+	Role     string
+	Sort     string `validate:"oneof=username coins created"`
+	Order    string `validate:"oneof=asc desc"`
+	PageRequest
+}
+
+// Since is an RFC 3339 time.
+type AuditListParams struct {
+	User   string
+	Action string `validate:"oneof=login set_balance adjust_balance freeze unfreeze delete_user restore_user transfer"`
+	Since  string
+	PageRequest
+}
+
+// AuditEntry is an entry of the audit log. Hash is the SHA-256 of the
+// entry and of PrevHash, the Hash of the entry before.
+type AuditEntry struct {
+	Seq       int64
+	Actor     string
+	Action    string
+	Target    string
+	Currency  string `json:",omitempty" xml:",omitempty"`
+	Amount    Amount
+	RequestID string `json:",omitempty" xml:",omitempty"`
+	Outcome   string
+	Timestamp time.Time
+	PrevHash  string
+	Hash      string
+}
+
+// AuditListResponse lists the entries newest first, by Seq, so pages
+// neither skip nor repeat any as new ones are appended.
+type AuditListResponse struct {
+	StatusCode int
+	PageResponse[AuditEntry]
+}
+
+type UserSummary struct {
+	Username  string
+	Balance   Amount
+	Role      string
+	CreatedAt time.Time
+}
+
+// UserSearchResponse lists the users in the order of the search, ties by
+// username. Pages go by position, so users changing between them may move
+// from one page to another.
+type UserSearchResponse struct {
+	StatusCode int
+	PageResponse[UserSummary]
+}
+
+// HistogramBucket counts the balances from From (inclusive) to To
+// (exclusive), a missing bound leaves that side open.
+type HistogramBucket struct {
+	From  *int64 `json:",omitempty" xml:",omitempty"`
+	To    *int64 `json:",omitempty" xml:",omitempty"`
+	Count int64
+}
+
+type StatsResponse struct {
+	StatusCode     int
+	Users          int64
+	TotalCoins     Amount
+	AverageBalance float64
+	Histogram      []HistogramBucket `xml:"Histogram>Bucket"`
+	GeneratedAt    time.Time
+}
+
+type ExportParams struct {
+	// Username is ignored, see TransactionListParams.
+	Username string `validate:"username"`
+	Format   string `validate:"required,oneof=csv json"`
+}
+
+// Mode is strict, the default, or partial.
+type ImportParams struct {
+	Mode string
+}
+
+type ImportUserRow struct {
+	Username string
+	Password string
+	Coins    Amount
+}
+
+const (
+	ImportCreated    = "created"
+	ImportDuplicate  = "skipped_duplicate"
+	ImportInvalid    = "invalid"
+	ImportNotApplied = "not_applied"
+)
+
+type ImportRowResult struct {
+	Row      int
 	Username string
+	Status   string
+	Reason   string `json:",omitempty" xml:",omitempty"`
 }
 
+type ImportResponse struct {
+	StatusCode int
+	Mode       string
+	Created    int
+	Skipped    int
+	Invalid    int
+	Results    []ImportRowResult `xml:"Results>Result"`
+}
+
+// Balance is in Currency, "coins" unless the request named another.
+// Balances lists every currency, or only the requested one.
+// StatusCode is only set with api.status_code_in_body, it repeats the HTTP
+// status.
 type CoinBalanceResponse struct {
+	StatusCode int `json:",omitempty" xml:",omitempty"`
+	Balance    Amount
+	Currency   string
+	Balances   AmountMap
+	Frozen     bool `json:",omitempty" xml:",omitempty"`
+
+	// AsOf is the time of balances asked for with as_of, or, with the
+	// X-Stale header, when the balances served as the database failed were
+	// read.
+	AsOf *time.Time `json:",omitempty" xml:",omitempty"`
+}
+
+type LedgerEntry struct {
+	Account   string
+	Direction string
+	Currency  string
+	Amount    Amount
+	Timestamp time.Time
+}
+
+type LedgerResponse struct {
+	StatusCode    int
+	TransactionID string
+	Entries       []LedgerEntry `xml:"Entries>Entry"`
+}
+
+type LedgerDrift struct {
+	Account  string
+	Currency string
+	Cached   Amount
+	Ledger   Amount
+}
+
+type LedgerVerifyResponse struct {
+	StatusCode int
+	Consistent bool
+	Drift      []LedgerDrift `xml:"Drift>Entry"`
+}
+
+// An empty Secret is generated.
+type WebhookParams struct {
+	URL    string `validate:"required"`
+	Secret string
+}
+
+type Webhook struct {
+	ID        string
+	URL       string
+	Secret    string `json:",omitempty" xml:",omitempty"`
+	CreatedAt time.Time
+}
+
+type WebhookResponse struct {
+	StatusCode int
+	Webhook    Webhook
+}
+
+type WebhookListResponse struct {
+	StatusCode int
+	Webhooks   []Webhook `xml:"Webhooks>Webhook"`
+}
+
+type WebhookDeliveryListParams struct {
+	Status string `validate:"oneof=pending delivered failed"`
+}
+
+// ReplayOf is the ID of the delivery a replay repeats.
+type WebhookDelivery struct {
+	ID          string
+	EventID     string
+	EventType   string
+	URL         string
+	Status      string
+	Attempts    int
+	StatusCode  int    `json:",omitempty" xml:",omitempty"`
+	Error       string `json:",omitempty" xml:",omitempty"`
+	Delivered   bool
+	ReplayOf    string           `json:",omitempty" xml:",omitempty"`
+	History     []WebhookAttempt `xml:"History>Attempt"`
+	CreatedAt   time.Time
+	CompletedAt *time.Time `json:",omitempty" xml:",omitempty"`
+}
+
+// Response is the start of the response body.
+type WebhookAttempt struct {
+	Attempt             int
+	StatusCode          int `json:",omitempty" xml:",omitempty"`
+	LatencyMilliseconds int64
+	Error               string `json:",omitempty" xml:",omitempty"`
+	Response            string `json:",omitempty" xml:",omitempty"`
+	At                  time.Time
+}
+
+type WebhookDeliveriesResponse struct {
+	StatusCode int
+	Deliveries []WebhookDelivery `xml:"Deliveries>Delivery"`
+}
+
+type WebhookDeliveryResponse struct {
+	StatusCode int
+	Delivery   WebhookDelivery
+}
+
+// APIKeyParams creates a key for the service Name, with the role Role,
+// user unless set. Without ExpiresAt the key never expires.
+type APIKeyParams struct {
+	Name      string `validate:"required,username"`
+	Role      string `validate:"oneof=user admin"`
+	ExpiresAt *time.Time
+}
+
+// APIKey is a key of a service. Key, the key itself, is only sent by the
+// response creating it.
+type APIKey struct {
+	ID         string
+	Name       string
+	Role       string
+	Key        string `json:",omitempty" xml:",omitempty"`
+	CreatedAt  time.Time
+	ExpiresAt  *time.Time `json:",omitempty" xml:",omitempty"`
+	LastUsedAt *time.Time `json:",omitempty" xml:",omitempty"`
+}
+
+type APIKeyResponse struct {
+	StatusCode int
+	APIKey     APIKey
+}
+
+type APIKeyListResponse struct {
+	StatusCode int
+	APIKeys    []APIKey `xml:"APIKeys>APIKey"`
+}
+
+// SocketCommand is sent by a client over /ws. The only Op is
+// "get_balance", with an optional Currency.
+type SocketCommand struct {
+	Op       string
+	Currency string
+}
+
+// SocketMessage is sent to a client over /ws. Op is "balance_changed" with
+// Event set, "balance" in reply to get_balance, or "error".
+type SocketMessage struct {
+	Op       string
+	Event    *BalanceEvent `json:",omitempty"`
+	Balance  *Amount       `json:",omitempty"`
+	Currency string        `json:",omitempty"`
+	Balances AmountMap     `json:",omitempty"`
+	Code     string        `json:",omitempty"`
+	Message  string        `json:",omitempty"`
+}
+
+type BalanceEvent struct {
+	ID        string
+	Type      string
+	Currency  string
+	Amount    Amount
+	Balance   Amount
+	Timestamp time.Time
+}
+
+type OverdraftParams struct {
+	Allow bool
+}
+
+type OverdraftResponse struct {
+	StatusCode     int
+	Username       string
+	AllowOverdraft bool
+	Floor          Amount
+}
+
+// MaintenanceParams turns maintenance mode on or off. An empty Message
+// answers with the default one, a RetryAfterSeconds of 0 with the
+// configured Retry-After.
+type MaintenanceParams struct {
+	Enabled           *bool
+	Message           string
+	RetryAfterSeconds int `validate:"min=0,max=86400"`
+}
+
+type MaintenanceResponse struct {
+	StatusCode        int
+	Enabled           bool
+	Message           string `json:",omitempty" xml:",omitempty"`
+	RetryAfterSeconds int
+	Since             time.Time
+	By                string `json:",omitempty" xml:",omitempty"`
+}
+
+// DrainResponse acknowledges a drain: the server keeps serving for
+// PreStopDelaySeconds, with /readyz failing, then shuts down.
+type DrainResponse struct {
+	StatusCode          int
+	Status              string
+	PreStopDelaySeconds int
+}
+
+type FreezeParams struct {
+	Reason string
+}
+
+type FreezeResponse struct {
 	StatusCode int
-	Balance    int64
+	Username   string
+	Frozen     bool
+}
+
+type HealthResponse struct {
+	Status string
+	Uptime string
+}
+
+type ReadinessResponse struct {
+	Status string
+	Checks map[string]string
 }
 
+type VersionResponse struct {
+	Version   string
+	Commit    string
+	BuildDate string
+	GoVersion string
+}
+
+const (
+	// RequestIDHeader carries the ID the server assigned to a request.
+	RequestIDHeader = "X-Request-ID"
+	// TraceIDHeader carries the distributed trace ID of a request.
+	TraceIDHeader = "X-Trace-ID"
+)
+
 type Error struct {
 	StatusCode int
+	Code       string `json:",omitempty" xml:",omitempty"`
 	Message    string
+	RequestID  string      `json:",omitempty" xml:",omitempty"`
+	TraceID    string      `json:",omitempty" xml:",omitempty"`
+	Violations []Violation `json:",omitempty" xml:"Violation,omitempty"`
+
+	// Scope is the scope missing of an insufficient_scope error.
+	Scope string `json:",omitempty" xml:",omitempty"`
 }
 
-func writeError(w http.ResponseWriter, message string, statusCode int) {
-	resp := Error{
-		StatusCode: statusCode,
-		Message:    message,
+// Violation is one way a request breaks the OpenAPI document or a rule of
+// its validate tags. Field names the query parameter or the path into the
+// body, empty for the request as a whole; Rule is the broken rule, such as
+// required or min.
+type Violation struct {
+	Field   string `json:",omitempty" xml:",omitempty"`
+	Rule    string `json:",omitempty" xml:",omitempty"`
+	Message string
+}
+
+func writeError(w http.ResponseWriter, code string, message string, statusCode int) {
+	writeErrorResponse(w, Error{StatusCode: statusCode, Code: code, Message: message}, true)
+}
+
+// writeErrorResponse writes resp, with its Message in the language of the
+// request when translate is set.
+func writeErrorResponse(w http.ResponseWriter, resp Error, translate bool) {
+	resp.RequestID = w.Header().Get(RequestIDHeader)
+	resp.TraceID = w.Header().Get(TraceIDHeader)
+
+	var writer, r = errorWriterOf(w)
+
+	var language string = SettingsOf(r).Language
+	if r != nil {
+		language = Messages.Language(r.Header.Values("Accept-Language"), language)
+	}
+	if translate {
+		resp.Message = Messages.Message(language, resp.Code, resp.Message)
+		w.Header().Set("Content-Language", language)
+		w.Header().Add("Vary", "Accept-Language")
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(statusCode)
 
-	json.NewEncoder(w).Encode(resp)
+	writer.WriteError(w, r, resp)
 }
 
 var (
+	// RequestErrorHandler reports a request that can't be served as sent.
+	// Errors of ReadJSON keep their status and code, and a body past
+	// LimitBody gets a 413.
 	RequestErrorHandler = func(w http.ResponseWriter, err error) {
-		writeError(w, err.Error(), http.StatusBadRequest)
+		var bodyErr *BodyError
+		var sizeErr *http.MaxBytesError
+		switch {
+		case errors.As(err, &bodyErr):
+			BodyErrorHandler(w, err)
+			return
+		case errors.As(err, &sizeErr):
+			BodyErrorHandler(w, bodyError(sizeErr))
+			return
+		}
+		writeError(w, CodeInvalidRequest, err.Error(), http.StatusBadRequest)
+	}
+	// ValidationErrorHandler reports a request that does not match the
+	// OpenAPI document or the validate tags, listing every violation found.
+	ValidationErrorHandler = func(w http.ResponseWriter, violations []Violation) {
+		writeErrorResponse(w, Error{
+			StatusCode: http.StatusBadRequest,
+			Code:       CodeValidationFailed,
+			Message:    ValidationFailedError.Error(),
+			Violations: violations,
+		}, true)
+	}
+	// BodyErrorHandler reports an error of ReadJSON with its status.
+	BodyErrorHandler = func(w http.ResponseWriter, err error) {
+		var bodyErr *BodyError
+		if !errors.As(err, &bodyErr) {
+			writeError(w, CodeInvalidRequest, err.Error(), http.StatusBadRequest)
+			return
+		}
+		switch {
+		case len(bodyErr.Violations) > 0:
+			ValidationErrorHandler(w, bodyErr.Violations)
+		case bodyErr.StatusCode == http.StatusNotAcceptable:
+			writeError(w, CodeNotAcceptable, err.Error(), bodyErr.StatusCode)
+		case bodyErr.StatusCode == http.StatusUnsupportedMediaType:
+			writeError(w, CodeUnsupportedMediaType, err.Error(), bodyErr.StatusCode)
+		case bodyErr.StatusCode == http.StatusRequestEntityTooLarge:
+			writeError(w, CodeBodyTooLarge, err.Error(), bodyErr.StatusCode)
+		default:
+			writeError(w, CodeInvalidRequest, err.Error(), bodyErr.StatusCode)
+		}
+	}
+	UnauthorizedErrorHandler = func(w http.ResponseWriter, code string, err error) {
+		writeError(w, code, err.Error(), http.StatusUnauthorized)
+	}
+	// TokenExpiredHandler tells clients to refresh their token.
+	TokenExpiredHandler = func(w http.ResponseWriter) {
+		writeError(w, CodeTokenExpired, "Token expired.", http.StatusUnauthorized)
+	}
+	ForbiddenErrorHandler = func(w http.ResponseWriter, code string, err error) {
+		writeError(w, code, err.Error(), http.StatusForbidden)
+	}
+	// InsufficientScopeHandler reports a token not granting scope, named in
+	// the body and, as RFC 6750 has it, in WWW-Authenticate.
+	InsufficientScopeHandler = func(w http.ResponseWriter, scope string) {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope=%q`, scope))
+		writeErrorResponse(w, Error{
+			StatusCode: http.StatusForbidden,
+			Code:       CodeInsufficientScope,
+			Message:    fmt.Sprintf("This requires the %s scope.", scope),
+			Scope:      scope,
+		}, true)
+	}
+	NotFoundErrorHandler = func(w http.ResponseWriter, code string, err error) {
+		writeError(w, code, err.Error(), http.StatusNotFound)
+	}
+	// MethodNotAllowedHandler reports a method the path has no route for,
+	// allowed lists the methods it has.
+	MethodNotAllowedHandler = func(w http.ResponseWriter, allowed []string) {
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		writeError(w, CodeMethodNotAllowed, "Method not allowed.", http.StatusMethodNotAllowed)
+	}
+	// ConflictErrorHandler reports a request that is valid but conflicts with
+	// the current state, code lets clients tell the cases apart.
+	ConflictErrorHandler = func(w http.ResponseWriter, code string, err error) {
+		writeError(w, code, err.Error(), http.StatusConflict)
+	}
+	// UnprocessableErrorHandler reports a well-formed request that can't be
+	// processed as sent.
+	UnprocessableErrorHandler = func(w http.ResponseWriter, code string, err error) {
+		writeError(w, code, err.Error(), http.StatusUnprocessableEntity)
+	}
+	// LockedErrorHandler reports a resource that exists but may not be
+	// changed right now.
+	LockedErrorHandler = func(w http.ResponseWriter, code string, err error) {
+		writeError(w, code, err.Error(), http.StatusLocked)
+	}
+	TooManyRequestsHandler = func(w http.ResponseWriter) {
+		writeError(w, CodeRateLimited, "Too many requests, slow down.", http.StatusTooManyRequests)
+	}
+	// TimeoutErrorHandler reports a request that ran out of time, or whose
+	// client went away, before it was done.
+	TimeoutErrorHandler = func(w http.ResponseWriter) {
+		writeError(w, CodeTimeout, "The request took too long.", http.StatusServiceUnavailable)
+	}
+	// OverloadedErrorHandler reports a request refused as the server is
+	// serving as many as it may.
+	OverloadedErrorHandler = func(w http.ResponseWriter) {
+		writeError(w, CodeOverloaded, "The server is busy, try again later.", http.StatusServiceUnavailable)
+	}
+	// MaintenanceErrorHandler reports the API being down for maintenance,
+	// with message as an admin wrote it unless it is empty.
+	MaintenanceErrorHandler = func(w http.ResponseWriter, message string) {
+		if message == "" {
+			writeError(w, CodeMaintenance, "The service is down for maintenance, try again later.", http.StatusServiceUnavailable)
+			return
+		}
+		writeErrorResponse(w, Error{StatusCode: http.StatusServiceUnavailable, Code: CodeMaintenance, Message: message}, false)
+	}
+	// GatewayTimeoutHandler reports a request that ran past the timeout of
+	// its route.
+	GatewayTimeoutHandler = func(w http.ResponseWriter) {
+		writeError(w, CodeTimeout, "The request took too long.", http.StatusGatewayTimeout)
 	}
 	InternalErrorHandler = func(w http.ResponseWriter) {
-		writeError(w, "An Unexpected Error Occured.", http.StatusInternalServerError)
+		writeError(w, CodeInternalError, "An Unexpected Error Occured.", http.StatusInternalServerError)
 	}
 )
@@ -0,0 +1,91 @@
+package api
+
+// Codes of Error. They are part of the API: clients match on them rather
+// than on Message, so a code is never renamed or reused for another case.
+const (
+	CodeInvalidRequest       = "invalid_request"
+	CodeValidationFailed     = "validation_failed"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodeNotAcceptable        = "not_acceptable"
+	CodeBodyTooLarge         = "body_too_large"
+	CodeRouteNotFound        = "route_not_found"
+	CodeMethodNotAllowed     = "method_not_allowed"
+
+	CodeInvalidToken       = "invalid_token"
+	CodeTokenExpired       = "token_expired"
+	CodeMissingToken       = "missing_token"
+	CodeMalformedAuth      = "malformed_authorization"
+	CodeConflictingTokens  = "conflicting_tokens"
+	CodeInvalidAPIKey      = "invalid_api_key"
+	CodeInvalidCredentials = "invalid_credentials"
+	CodeLockedOut          = "locked_out"
+	CodeInsufficientRole   = "insufficient_role"
+	CodeInsufficientScope  = "insufficient_scope"
+	CodeUsernameMismatch   = "username_mismatch"
+
+	CodeUserNotFound        = "user_not_found"
+	CodeTransactionNotFound = "transaction_not_found"
+	CodeWebhookNotFound     = "webhook_not_found"
+	CodeDeliveryNotFound    = "delivery_not_found"
+	CodeAPIKeyNotFound      = "api_key_not_found"
+	CodeBalanceNotFound     = "balance_not_found"
+	CodeUserExists          = "user_exists"
+
+	CodeInsufficientFunds = "insufficient_funds"
+	CodeNegativeBalance   = "negative_balance"
+	CodeAccountFrozen     = "account_frozen"
+	CodeVersionConflict   = "version_conflict"
+	CodeNotReplayable     = "not_replayable"
+
+	CodeIdempotencyKeyReused  = "idempotency_key_reused"
+	CodeIdempotencyInProgress = "idempotency_in_progress"
+
+	CodeRateLimited   = "rate_limited"
+	CodeTimeout       = "timeout"
+	CodeUnavailable   = "unavailable"
+	CodeOverloaded    = "overloaded"
+	CodeMaintenance   = "maintenance"
+	CodeInternalError = "internal_error"
+)
+
+// Codes lists every code an Error may carry, for the OpenAPI document.
+var Codes = []string{
+	CodeInvalidRequest,
+	CodeValidationFailed,
+	CodeUnsupportedMediaType,
+	CodeNotAcceptable,
+	CodeBodyTooLarge,
+	CodeRouteNotFound,
+	CodeMethodNotAllowed,
+	CodeInvalidToken,
+	CodeTokenExpired,
+	CodeMissingToken,
+	CodeMalformedAuth,
+	CodeConflictingTokens,
+	CodeInvalidAPIKey,
+	CodeInvalidCredentials,
+	CodeLockedOut,
+	CodeInsufficientRole,
+	CodeInsufficientScope,
+	CodeUsernameMismatch,
+	CodeUserNotFound,
+	CodeTransactionNotFound,
+	CodeWebhookNotFound,
+	CodeDeliveryNotFound,
+	CodeAPIKeyNotFound,
+	CodeBalanceNotFound,
+	CodeUserExists,
+	CodeInsufficientFunds,
+	CodeNegativeBalance,
+	CodeAccountFrozen,
+	CodeVersionConflict,
+	CodeNotReplayable,
+	CodeIdempotencyKeyReused,
+	CodeIdempotencyInProgress,
+	CodeRateLimited,
+	CodeTimeout,
+	CodeUnavailable,
+	CodeOverloaded,
+	CodeMaintenance,
+	CodeInternalError,
+}
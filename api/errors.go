@@ -0,0 +1,160 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+)
+
+const problemType = "application/problem+json"
+
+// ErrorWriter writes error responses in one format. r is the request
+// being answered, nil when the writer was not set up by WithErrorWriter.
+type ErrorWriter interface {
+	WriteError(w http.ResponseWriter, r *http.Request, resp Error)
+}
+
+// JSONErrorWriter writes the Error type.
+type JSONErrorWriter struct{}
+
+func (JSONErrorWriter) WriteError(w http.ResponseWriter, r *http.Request, resp Error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(resp.StatusCode)
+
+	json.NewEncoder(w).Encode(resp)
+}
+
+// XMLErrorWriter writes the Error type as XML.
+type XMLErrorWriter struct{}
+
+func (XMLErrorWriter) WriteError(w http.ResponseWriter, r *http.Request, resp Error) {
+	w.Header().Set("Content-Type", xmlType)
+	w.WriteHeader(resp.StatusCode)
+
+	writeXML(w, resp)
+}
+
+// Problem is an RFC 7807 problem details object. Code, RequestID, TraceID,
+// Violations and Scope are extension members carrying the fields of Error.
+type Problem struct {
+	Type       string      `json:"type"`
+	Title      string      `json:"title"`
+	Status     int         `json:"status"`
+	Detail     string      `json:"detail,omitempty"`
+	Instance   string      `json:"instance,omitempty"`
+	Code       string      `json:"code,omitempty"`
+	RequestID  string      `json:"request_id,omitempty"`
+	TraceID    string      `json:"trace_id,omitempty"`
+	Violations []Violation `json:"violations,omitempty"`
+	Scope      string      `json:"scope,omitempty"`
+}
+
+// ProblemErrorWriter writes problem details whose type is TypeBase
+// followed by the code, so each code has one stable type URI.
+type ProblemErrorWriter struct {
+	TypeBase string
+}
+
+func (p ProblemErrorWriter) WriteError(w http.ResponseWriter, r *http.Request, resp Error) {
+	var problem = Problem{
+		Type:       p.TypeBase + resp.Code,
+		Title:      http.StatusText(resp.StatusCode),
+		Status:     resp.StatusCode,
+		Detail:     resp.Message,
+		Code:       resp.Code,
+		RequestID:  resp.RequestID,
+		TraceID:    resp.TraceID,
+		Violations: resp.Violations,
+		Scope:      resp.Scope,
+	}
+	if resp.Code == "" {
+		problem.Type = "about:blank"
+	}
+	if r != nil {
+		problem.Instance = r.URL.Path
+	}
+
+	w.Header().Set("Content-Type", problemType)
+	w.WriteHeader(resp.StatusCode)
+
+	json.NewEncoder(w).Encode(problem)
+}
+
+// NegotiatedErrorWriter writes problem details to requests that list
+// application/problem+json in their Accept header, XML to those preferring
+// application/xml, and uses Default, or JSONErrorWriter when it is nil, for
+// all others.
+type NegotiatedErrorWriter struct {
+	Problem ProblemErrorWriter
+	Default ErrorWriter
+}
+
+func (n NegotiatedErrorWriter) WriteError(w http.ResponseWriter, r *http.Request, resp Error) {
+	var writer ErrorWriter = n.Default
+	if writer == nil {
+		writer = JSONErrorWriter{}
+	}
+	if r != nil {
+		switch accept := r.Header.Values("Accept"); {
+		case acceptsProblem(accept):
+			writer = n.Problem
+		case negotiate(accept) == xmlType:
+			writer = XMLErrorWriter{}
+		}
+	}
+	writer.WriteError(w, r, resp)
+}
+
+func acceptsProblem(accept []string) bool {
+	for _, header := range accept {
+		for _, part := range strings.Split(header, ",") {
+			mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err == nil && mediaType == problemType && params["q"] != "0" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// WithErrorWriter returns a ResponseWriter for the handlers of r whose
+// error responses are written by errors.
+func WithErrorWriter(w http.ResponseWriter, r *http.Request, errors ErrorWriter) http.ResponseWriter {
+	return &errorResponseWriter{ResponseWriter: w, request: r, errors: errors}
+}
+
+type errorResponseWriter struct {
+	http.ResponseWriter
+	request *http.Request
+	errors  ErrorWriter
+}
+
+func (e *errorResponseWriter) Unwrap() http.ResponseWriter { return e.ResponseWriter }
+
+// Flush and Hijack are passed on, so streams and WebSockets keep working
+// behind the wrapper.
+func (e *errorResponseWriter) Flush() {
+	http.NewResponseController(e.ResponseWriter).Flush()
+}
+
+func (e *errorResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(e.ResponseWriter).Hijack()
+}
+
+// errorWriterOf finds the writer set by WithErrorWriter behind the
+// wrappers of other middleware.
+func errorWriterOf(w http.ResponseWriter) (ErrorWriter, *http.Request) {
+	for {
+		if e, ok := w.(*errorResponseWriter); ok {
+			return e.errors, e.request
+		}
+		unwrapper, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return JSONErrorWriter{}, nil
+		}
+		w = unwrapper.Unwrap()
+	}
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ETag returns a strong entity tag for the representation identified by
+// parts, such as a record, its version and the media type it is written
+// as.
+func ETag(parts ...string) string {
+	var hash = sha256.New()
+	for _, part := range parts {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+	return `"` + hex.EncodeToString(hash.Sum(nil)[:16]) + `"`
+}
+
+// NotModified reports whether the If-None-Match headers of r match etag,
+// in which case a GET is answered with a 304. The comparison is weak, as
+// Compress turns the tags of the bodies it compresses into weak ones.
+func NotModified(r *http.Request, etag string) bool {
+	for _, header := range r.Header.Values("If-None-Match") {
+		for _, candidate := range strings.Split(header, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// NotModifiedSince reports whether the If-Modified-Since header of r is no
+// earlier than modified, to the second. It is ignored when r has
+// If-None-Match, which NotModified answers instead.
+func NotModifiedSince(r *http.Request, modified time.Time) bool {
+	if r.Header.Get("If-None-Match") != "" {
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	return !modified.Truncate(time.Second).After(since)
+}
+
+// MediaType returns the type WriteJSON writes the response to r as, "" when
+// none is acceptable.
+func MediaType(r *http.Request) string {
+	return negotiate(r.Header.Values("Accept"))
+}
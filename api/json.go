@@ -0,0 +1,197 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/RashedMaaitah/goapi/internal/logging"
+)
+
+type bodyLimitKey struct{}
+
+// WithBodyLimit returns r with bodies of up to limit bytes, in place of
+// the MaxBodyBytes of its Settings.
+func WithBodyLimit(r *http.Request, limit int64) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), bodyLimitKey{}, limit))
+}
+
+// BodyLimit returns the most bytes the body of r may have.
+func BodyLimit(r *http.Request) int64 {
+	if limit, ok := r.Context().Value(bodyLimitKey{}).(int64); ok {
+		return limit
+	}
+	return SettingsOf(r).MaxBodyBytes
+}
+
+// LimitBody caps the body of r at BodyLimit, for handlers reading it
+// themselves. Reading past it fails with an error RequestErrorHandler
+// answers with a 413, and the rest of the body is never read.
+func LimitBody(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, BodyLimit(r))
+}
+
+var UnsupportedMediaTypeError = errors.New("Content-Type must be application/json.")
+
+var ValidationFailedError = errors.New("The request does not match the API schema.")
+
+// BodyError is a request body ReadJSON refused, StatusCode is 400, 406,
+// 413 or 415. Violations lists the broken validate rules of a body that decoded.
+type BodyError struct {
+	StatusCode int
+	Err        error
+	Violations []Violation
+}
+
+func (e *BodyError) Error() string { return e.Err.Error() }
+
+func (e *BodyError) Unwrap() error { return e.Err }
+
+// ReadJSON decodes the body of r into dst, normalizes its usernames and
+// validates it. The body must be a single JSON value of at most BodyLimit
+// bytes, sent as application/json, with no fields dst does not have, and the
+// response must be acceptable to the client. Errors are *BodyError, for
+// BodyErrorHandler.
+func ReadJSON(w http.ResponseWriter, r *http.Request, dst any) error {
+	// Refused before the handler acts on the request rather than after.
+	if negotiate(r.Header.Values("Accept")) == "" {
+		return &BodyError{StatusCode: http.StatusNotAcceptable, Err: NotAcceptableError}
+	}
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		return &BodyError{StatusCode: http.StatusUnsupportedMediaType, Err: UnsupportedMediaTypeError}
+	}
+
+	var decoder = json.NewDecoder(http.MaxBytesReader(w, r.Body, BodyLimit(r)))
+	decoder.DisallowUnknownFields()
+
+	err = decoder.Decode(dst)
+	if err == nil {
+		// Trailing whitespace past the limit makes the body too large, not
+		// one of two values.
+		var sizeErr *http.MaxBytesError
+		if extra := decoder.Decode(&json.RawMessage{}); errors.As(extra, &sizeErr) {
+			err = extra
+		} else if extra != io.EOF {
+			err = errors.New("Invalid request body: must contain a single JSON value.")
+			return &BodyError{StatusCode: http.StatusBadRequest, Err: err}
+		}
+	}
+	if err != nil {
+		return bodyError(err)
+	}
+
+	NormalizeUsernames(dst)
+	if violations := Validate(dst); len(violations) > 0 {
+		return &BodyError{StatusCode: http.StatusBadRequest, Err: ValidationFailedError, Violations: violations}
+	}
+	return nil
+}
+
+func bodyError(err error) *BodyError {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var sizeErr *http.MaxBytesError
+
+	switch {
+	case errors.As(err, &sizeErr):
+		return &BodyError{StatusCode: http.StatusRequestEntityTooLarge, Err: fmt.Errorf("Request body must not be larger than %d bytes.", sizeErr.Limit)}
+	case errors.As(err, &syntaxErr):
+		err = fmt.Errorf("Invalid request body: malformed JSON at byte %d: %w", syntaxErr.Offset, err)
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		err = fmt.Errorf("Invalid request body: %s must be %s, got %s at byte %d.", typeErr.Field, kindOf(typeErr.Type), typeErr.Value, typeErr.Offset)
+	case errors.As(err, &typeErr):
+		err = fmt.Errorf("Invalid request body: must be %s, got %s at byte %d.", kindOf(typeErr.Type), typeErr.Value, typeErr.Offset)
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		err = fmt.Errorf("Invalid request body: unknown field %s.", strings.TrimPrefix(err.Error(), "json: unknown field "))
+	case errors.Is(err, io.EOF):
+		err = errors.New("Invalid request body: body is empty.")
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		err = errors.New("Invalid request body: JSON ends unexpectedly.")
+	default:
+		err = fmt.Errorf("Invalid request body: %w", err)
+	}
+	return &BodyError{StatusCode: http.StatusBadRequest, Err: err}
+}
+
+// kindOf names the JSON value a Go type is decoded from.
+func kindOf(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Struct, reflect.Map:
+		return "an object"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Pointer:
+		return kindOf(t.Elem())
+	}
+	return "an integer"
+}
+
+// Envelope is the body WriteJSON writes when the Envelope of the Settings
+// of the request is set.
+type Envelope struct {
+	Data      any    `json:"data" xml:"Data"`
+	RequestID string `json:"request_id,omitempty" xml:"RequestID,omitempty"`
+}
+
+// WriteJSON writes v with status and headers, as JSON or, when the Accept
+// header of the request prefers it, as XML. Requests accepting neither get
+// a 406 instead. Once the status is sent a failure to encode v can't be
+// reported to the client any more, so it is only logged.
+func WriteJSON(w http.ResponseWriter, status int, v any, headers http.Header) {
+	var mediaType string = jsonType
+	var _, r = errorWriterOf(w)
+	if r != nil {
+		mediaType = negotiate(r.Header.Values("Accept"))
+	}
+	w.Header().Add("Vary", "Accept")
+
+	if mediaType == "" {
+		writeError(w, CodeNotAcceptable, NotAcceptableError.Error(), http.StatusNotAcceptable)
+		return
+	}
+
+	for name, values := range headers {
+		w.Header()[name] = values
+	}
+	if SettingsOf(r).Envelope {
+		v = Envelope{Data: v, RequestID: w.Header().Get(RequestIDHeader)}
+	}
+
+	w.Header().Set("Content-Type", mediaType)
+	w.WriteHeader(status)
+
+	var err error
+	if mediaType == xmlType {
+		err = writeXML(w, v)
+	} else {
+		err = json.NewEncoder(w).Encode(v)
+	}
+
+	// Dropped once the request timed out, as it was answered already.
+	if err != nil && !errors.Is(err, http.ErrHandlerTimeout) {
+		logging.FromContext(requestContext(w)).Error(err)
+	}
+}
+
+func writeXML(w io.Writer, v any) error {
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+	return xml.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,105 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func jsonRequest(contentType string, body string) *http.Request {
+	var r = httptest.NewRequest(http.MethodPost, "/v1/account/coins/deposit", strings.NewReader(body))
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+	return r
+}
+
+func TestReadJSON(t *testing.T) {
+	var params CoinAmountParams
+	var r = jsonRequest("application/json; charset=utf-8", `{"amount": "250", "currency": "EUR"}`)
+
+	if err := ReadJSON(httptest.NewRecorder(), r, &params); err != nil {
+		t.Fatal(err)
+	}
+	if params.Amount != 250 || params.Currency != "EUR" {
+		t.Errorf("params = %+v", params)
+	}
+}
+
+func TestReadJSONFailures(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		contentType string
+		accept      string
+		body        string
+		limit       int64
+		status      int
+		message     string
+	}{
+		{"no content type", "", "", `{"amount": 1}`, 0, http.StatusUnsupportedMediaType, "Content-Type must be application/json."},
+		{"wrong content type", "text/plain", "", `{"amount": 1}`, 0, http.StatusUnsupportedMediaType, "Content-Type must be application/json."},
+		{"unacceptable response", "application/json", "image/png", `{"amount": 1}`, 0, http.StatusNotAcceptable, ""},
+		{"too large", "application/json", "", `{"amount": "` + strings.Repeat("1", 64) + `"}`, 16, http.StatusRequestEntityTooLarge, "must not be larger than 16 bytes"},
+		{"empty", "application/json", "", ``, 0, http.StatusBadRequest, "body is empty"},
+		{"syntax error", "application/json", "", `{"amount": 1,}`, 0, http.StatusBadRequest, "malformed JSON at byte 14"},
+		{"truncated", "application/json", "", `{"amount": 1`, 0, http.StatusBadRequest, "JSON ends unexpectedly"},
+		{"wrong type of field", "application/json", "", `{"amount": 1, "currency": 5}`, 0, http.StatusBadRequest, "currency must be a string, got number at byte"},
+		{"wrong type of body", "application/json", "", `[1, 2]`, 0, http.StatusBadRequest, "must be an object, got array at byte"},
+		{"unknown field", "application/json", "", `{"amount": 1, "memo": "x"}`, 0, http.StatusBadRequest, `unknown field "memo"`},
+		{"too large after the value", "application/json", "", `{"amount": 1}` + strings.Repeat(" ", 64), 16, http.StatusRequestEntityTooLarge, "must not be larger than 16 bytes"},
+		{"two documents", "application/json", "", `{"amount": 1} {"amount": 2}`, 0, http.StatusBadRequest, "must contain a single JSON value"},
+		{"broken rule", "application/json", "", `{"amount": 0}`, 0, http.StatusBadRequest, ValidationFailedError.Error()},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var r = jsonRequest(tt.contentType, tt.body)
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+			if tt.limit > 0 {
+				r = WithBodyLimit(r, tt.limit)
+			}
+
+			var err = ReadJSON(httptest.NewRecorder(), r, &CoinAmountParams{})
+
+			var bodyErr *BodyError
+			if !errors.As(err, &bodyErr) {
+				t.Fatalf("ReadJSON = %v, want a *BodyError", err)
+			}
+			if bodyErr.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d", bodyErr.StatusCode, tt.status)
+			}
+			if !strings.Contains(err.Error(), tt.message) {
+				t.Errorf("message %q doesn't say %q", err, tt.message)
+			}
+		})
+	}
+}
+
+func TestReadJSONViolations(t *testing.T) {
+	var err = ReadJSON(httptest.NewRecorder(), jsonRequest("application/json", `{"amount": -3}`), &CoinAmountParams{})
+
+	var bodyErr *BodyError
+	if !errors.As(err, &bodyErr) || len(bodyErr.Violations) != 1 || bodyErr.Violations[0].Rule != "min" {
+		t.Fatalf("ReadJSON = %v, want a violation of min", err)
+	}
+}
+
+func TestBodyErrorHandlerCodes(t *testing.T) {
+	for _, tt := range []struct {
+		status int
+		code   string
+	}{
+		{http.StatusBadRequest, CodeInvalidRequest},
+		{http.StatusNotAcceptable, CodeNotAcceptable},
+		{http.StatusRequestEntityTooLarge, CodeBodyTooLarge},
+		{http.StatusUnsupportedMediaType, CodeUnsupportedMediaType},
+	} {
+		var w = httptest.NewRecorder()
+		BodyErrorHandler(w, &BodyError{StatusCode: tt.status, Err: errors.New("Refused.")})
+		if w.Code != tt.status || !strings.Contains(w.Body.String(), `"Code":"`+tt.code+`"`) {
+			t.Errorf("BodyErrorHandler of a %d answered %d %s, want %s", tt.status, w.Code, w.Body, tt.code)
+		}
+	}
+}
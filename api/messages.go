@@ -0,0 +1,136 @@
+package api
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// English is the language the messages are written in, and the one
+// requests in a language without a catalog get.
+const English = "en"
+
+//go:embed messages/*.json
+var messageFiles embed.FS
+
+// Catalog translates the messages of errors by their code. Each language
+// is a file named after it, such as es.json, mapping codes to messages.
+type Catalog struct {
+	messages map[string]map[string]string
+}
+
+// Messages is the catalog of the files in api/messages.
+var Messages *Catalog = mustLoadCatalog(messageFiles, "messages")
+
+// LoadCatalog reads the JSON files of dir in fsys.
+func LoadCatalog(fsys fs.FS, dir string) (*Catalog, error) {
+	names, err := fs.Glob(fsys, path.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var catalog = &Catalog{messages: map[string]map[string]string{}}
+	for _, name := range names {
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		var messages map[string]string
+		err = json.Unmarshal(data, &messages)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		catalog.messages[strings.ToLower(strings.TrimSuffix(path.Base(name), ".json"))] = messages
+	}
+	return catalog, nil
+}
+
+func mustLoadCatalog(fsys fs.FS, dir string) *Catalog {
+	catalog, err := LoadCatalog(fsys, dir)
+	if err != nil {
+		panic("api: " + err.Error())
+	}
+	return catalog
+}
+
+// Languages lists the languages of c, English included.
+func (c *Catalog) Languages() []string {
+	var languages = []string{English}
+	for language := range c.messages {
+		if language != English {
+			languages = append(languages, language)
+		}
+	}
+	sort.Strings(languages[1:])
+	return languages
+}
+
+// Has reports whether c has messages in language.
+func (c *Catalog) Has(language string) bool {
+	_, ok := c.messages[strings.ToLower(language)]
+	return ok || strings.EqualFold(language, English)
+}
+
+// Language picks the language for the Accept-Language headers of a
+// request: the one with the highest quality that c has, a region falling
+// back to its language. Languages c doesn't have get English, requests
+// without the header, or accepting any language, def.
+func (c *Catalog) Language(acceptLanguage []string, def string) string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+
+	var tags []weighted
+	for _, header := range acceptLanguage {
+		for _, part := range strings.Split(header, ",") {
+			tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+			if tag == "" {
+				continue
+			}
+			var q float64 = 1
+			if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+				var err error
+				q, err = strconv.ParseFloat(value, 64)
+				if err != nil {
+					continue
+				}
+			}
+			tags = append(tags, weighted{tag: strings.ToLower(tag), q: q})
+		}
+	}
+	if len(tags) == 0 {
+		return def
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+
+	for _, tag := range tags {
+		if tag.q <= 0 {
+			break
+		}
+		if tag.tag == "*" {
+			return def
+		}
+		base, _, _ := strings.Cut(tag.tag, "-")
+		for _, language := range []string{tag.tag, base} {
+			if c.Has(language) {
+				return language
+			}
+		}
+	}
+	return English
+}
+
+// Message returns the message for code in language, or message, the
+// English one, when c has none.
+func (c *Catalog) Message(language string, code string, message string) string {
+	if translated, ok := c.messages[strings.ToLower(language)][code]; ok && code != "" {
+		return translated
+	}
+	return message
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"fmt"
+	"mime"
+	"strconv"
+	"strings"
+)
+
+const (
+	jsonType = "application/json"
+	xmlType  = "application/xml"
+)
+
+// responseTypes are the media types WriteJSON writes, the first unless a
+// request prefers another.
+var responseTypes = []string{jsonType, xmlType}
+
+var NotAcceptableError = fmt.Errorf("Acceptable types are %s.", strings.Join(responseTypes, ", "))
+
+type acceptRange struct {
+	mediaType string
+	q         float64
+}
+
+// negotiate picks the response type for the Accept headers of a request,
+// "" when none of responseTypes is acceptable. Without a header any type
+// is.
+func negotiate(accept []string) string {
+	var ranges []acceptRange
+	for _, header := range accept {
+		for _, part := range strings.Split(header, ",") {
+			mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err != nil {
+				continue
+			}
+			var q float64 = 1
+			if value, ok := params["q"]; ok {
+				q, err = strconv.ParseFloat(value, 64)
+				if err != nil {
+					continue
+				}
+			}
+			ranges = append(ranges, acceptRange{mediaType: mediaType, q: q})
+		}
+	}
+	if len(ranges) == 0 {
+		return responseTypes[0]
+	}
+
+	var best string
+	var bestQ float64
+	for _, candidate := range responseTypes {
+		if q := quality(ranges, candidate); q > bestQ {
+			best, bestQ = candidate, q
+		}
+	}
+	return best
+}
+
+// quality is the q of the most specific range that matches mediaType, 0
+// when none does.
+func quality(ranges []acceptRange, mediaType string) float64 {
+	var kind, _, _ = strings.Cut(mediaType, "/")
+	var q float64
+	var specificity int = -1
+	for _, r := range ranges {
+		var s int
+		switch r.mediaType {
+		case mediaType:
+			s = 2
+		case kind + "/*":
+			s = 1
+		case "*/*":
+			s = 0
+		default:
+			continue
+		}
+		if s > specificity {
+			q, specificity = r.q, s
+		}
+	}
+	return q
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// PageRequest is the page a list asks for: up to Limit items, the default
+// of the list for 0, after the page Cursor is the NextCursor of, from the
+// start when it is empty.
+type PageRequest struct {
+	Limit  int `validate:"min=0"`
+	Cursor string
+}
+
+// PageLimit returns the limit of the page, def when none was given. A
+// limit past max is rejected rather than cut down, so clients don't mistake
+// a short page for the end of the list.
+func (p PageRequest) PageLimit(def, max int) (int, error) {
+	switch {
+	case p.Limit < 0:
+		return 0, errors.New("Limit must not be negative.")
+	case p.Limit == 0:
+		return def, nil
+	case p.Limit > max:
+		return 0, fmt.Errorf("Limit must be at most %d.", max)
+	}
+	return p.Limit, nil
+}
+
+// PageResponse is a page of a list. NextCursor is empty on the last page.
+// Total is the length of the whole list when it comes for free, such as on
+// the last page of a list paged by offset.
+type PageResponse[T any] struct {
+	Items      []T    `xml:"Items>Item"`
+	NextCursor string `json:",omitempty" xml:",omitempty"`
+	Total      *int64 `json:",omitempty" xml:",omitempty"`
+}
+
+var ErrInvalidCursor = errors.New("Invalid cursor.")
+
+// Cursors encodes the positions pages continue from, such as the sequence
+// number of the last item or the offset of the next page, into cursors
+// signed with an HMAC key. Clients can't forge them, nor take the cursor
+// of one list to another: each is bound to the scope it was encoded for.
+type Cursors struct {
+	key []byte
+}
+
+// NewCursors signs cursors with key, or with a random key when it is
+// empty, whose cursors don't outlive the process.
+func NewCursors(key []byte) *Cursors {
+	if len(key) == 0 {
+		key = make([]byte, sha256.Size)
+		rand.Read(key)
+	}
+	return &Cursors{key: key}
+}
+
+// Encode returns the cursor of position, a positive number, in scope.
+func (c *Cursors) Encode(scope string, position int64) string {
+	var payload []byte = strconv.AppendInt(nil, position, 10)
+	return base64.RawURLEncoding.EncodeToString(append(payload, c.sign(scope, payload)...))
+}
+
+// Decode returns the position of cursor, or ErrInvalidCursor when it
+// wasn't encoded for scope with the key of c.
+func (c *Cursors) Decode(scope, cursor string) (int64, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(b) <= sha256.Size {
+		return 0, ErrInvalidCursor
+	}
+
+	var payload, mac = b[:len(b)-sha256.Size], b[len(b)-sha256.Size:]
+	if !hmac.Equal(mac, c.sign(scope, payload)) {
+		return 0, ErrInvalidCursor
+	}
+	position, err := strconv.ParseInt(string(payload), 10, 64)
+	if err != nil || position <= 0 {
+		return 0, ErrInvalidCursor
+	}
+	return position, nil
+}
+
+func (c *Cursors) sign(scope string, payload []byte) []byte {
+	var mac = hmac.New(sha256.New, c.key)
+	mac.Write([]byte(scope))
+	mac.Write([]byte{0})
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func TestCursors(t *testing.T) {
+	var cursors = NewCursors([]byte("key"))
+	var cursor string = cursors.Encode("transactions", 42)
+
+	if position, err := cursors.Decode("transactions", cursor); err != nil || position != 42 {
+		t.Fatalf("Decode = %d, %v, want 42", position, err)
+	}
+
+	// The payload of cursor with its first digit changed, its MAC kept.
+	var tampered, _ = base64.RawURLEncoding.DecodeString(cursor)
+	tampered[0] = '9'
+
+	for _, tt := range []struct {
+		name   string
+		scope  string
+		cursor string
+	}{
+		{"tampered", "transactions", base64.RawURLEncoding.EncodeToString(tampered)},
+		{"of another scope", "audit", cursor},
+		{"signed with another key", "transactions", NewCursors([]byte("other key")).Encode("transactions", 42)},
+		{"not base64", "transactions", "not a cursor!"},
+		{"too short", "transactions", base64.RawURLEncoding.EncodeToString([]byte("42"))},
+		{"of no position", "transactions", cursors.Encode("transactions", 0)},
+		{"of a negative position", "transactions", cursors.Encode("transactions", -1)},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if position, err := cursors.Decode(tt.scope, tt.cursor); !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("Decode = %d, %v, want %v", position, err, ErrInvalidCursor)
+			}
+		})
+	}
+}
+
+func TestRandomCursorKeys(t *testing.T) {
+	var cursor string = NewCursors(nil).Encode("transactions", 42)
+
+	if _, err := NewCursors(nil).Decode("transactions", cursor); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("a cursor of another random key decoded, err = %v", err)
+	}
+}
+
+func TestPageLimit(t *testing.T) {
+	for _, tt := range []struct {
+		limit   int
+		want    int
+		wantErr bool
+	}{
+		{0, 20, false},
+		{1, 1, false},
+		{100, 100, false},
+		{101, 0, true},
+		{-1, 0, true},
+	} {
+		limit, err := PageRequest{Limit: tt.limit}.PageLimit(20, 100)
+		if limit != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("PageLimit of %d = %d, %v, want %d and an error %v", tt.limit, limit, err, tt.want, tt.wantErr)
+		}
+	}
+}
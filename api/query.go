@@ -0,0 +1,52 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+
+	"github.com/gorilla/schema"
+)
+
+// ReadQuery decodes the query of r into dst, a pointer to a struct, and
+// validates it. It returns every problem found, for ValidationErrorHandler:
+// under the StrictQuery of its Settings an unknown parameter, then a value of the wrong type, a
+// missing required one and the broken validate rules. The messages name
+// the parameters as they were sent.
+func ReadQuery(r *http.Request, dst any) []Violation {
+	var decoder *schema.Decoder = schema.NewDecoder()
+	decoder.IgnoreUnknownKeys(!SettingsOf(r).StrictQuery)
+
+	var err error = decoder.Decode(dst, r.URL.Query())
+	if err == nil {
+		return Validate(dst)
+	}
+
+	var errs = schema.MultiError{}
+	if !errors.As(err, &errs) {
+		return []Violation{{Message: "Invalid query."}}
+	}
+
+	var violations []Violation
+	for key, err := range errs {
+		violations = append(violations, queryViolation(key, err))
+	}
+	sort.Slice(violations, func(i, j int) bool { return violations[i].Field < violations[j].Field })
+	return violations
+}
+
+func queryViolation(key string, err error) Violation {
+	var unknownErr schema.UnknownKeyError
+	var conversionErr schema.ConversionError
+	var emptyErr schema.EmptyFieldError
+
+	switch {
+	case errors.As(err, &unknownErr):
+		return Violation{Field: unknownErr.Key, Rule: "unknown", Message: "Unknown query parameter."}
+	case errors.As(err, &conversionErr) && conversionErr.Type != nil:
+		return Violation{Field: conversionErr.Key, Rule: "type", Message: conversionErr.Key + " must be " + kindOf(conversionErr.Type) + "."}
+	case errors.As(err, &emptyErr):
+		return Violation{Field: emptyErr.Key, Rule: "required", Message: emptyErr.Key + " is required."}
+	}
+	return Violation{Field: key, Rule: "type", Message: key + " is invalid."}
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type queryParams struct {
+	Limit int
+	Name  string `schema:"name,required"`
+	Mode  string `validate:"oneof=fast slow"`
+}
+
+func TestReadQuery(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		query  string
+		strict bool
+		// want are the fields and rules of the violations.
+		want [][2]string
+	}{
+		{"valid", "name=x&limit=5&mode=fast", true, nil},
+		{"unknown parameter", "name=x&foo=1", true, [][2]string{{"foo", "unknown"}}},
+		{"unknown parameter, not strict", "name=x&foo=1", false, nil},
+		{"wrong type", "name=x&limit=five", true, [][2]string{{"limit", "type"}}},
+		{"empty required value", "name=&limit=5", true, [][2]string{{"name", "required"}}},
+		{"broken rule", "name=x&mode=medium", true, [][2]string{{"Mode", "oneof"}}},
+		{"every problem", "limit=five&foo=1", true, [][2]string{{"foo", "unknown"}, {"limit", "type"}, {"name", "required"}}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var settings = DefaultSettings()
+			settings.StrictQuery = tt.strict
+
+			var r = WithSettings(httptest.NewRequest(http.MethodGet, "/?"+tt.query, nil), settings)
+			var violations = ReadQuery(r, &queryParams{})
+
+			var got [][2]string
+			for _, violation := range violations {
+				got = append(got, [2]string{violation.Field, violation.Rule})
+				// The decoder is not named to clients.
+				if strings.Contains(violation.Message, "schema:") {
+					t.Errorf("message %q names the decoder", violation.Message)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("violations = %+v, want fields and rules %v", violations, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"context"
+	"net/http"
+)
+
+// Settings are those of the config of a router that the functions of this
+// package answer by. They come with the context of each request, so the
+// routers of one process may each have their own.
+type Settings struct {
+	// Envelope makes WriteJSON wrap bodies in an Envelope.
+	Envelope bool
+	// MaxBodyBytes caps the bodies read by ReadJSON, unless WithBodyLimit
+	// sets another cap for the request.
+	MaxBodyBytes int64
+	// StrictQuery rejects the query parameters a route doesn't take, which
+	// are ignored otherwise.
+	StrictQuery bool
+	// Language is that of the messages of requests without
+	// Accept-Language, one Messages has.
+	Language string
+}
+
+// DefaultSettings are the Settings of the requests WithSettings wasn't
+// called on.
+func DefaultSettings() Settings {
+	return Settings{MaxBodyBytes: 1 << 20, StrictQuery: true, Language: English}
+}
+
+type settingsKey struct{}
+
+// WithSettings returns r served with settings.
+func WithSettings(r *http.Request, settings Settings) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), settingsKey{}, settings))
+}
+
+// SettingsOf returns the Settings r is served with, DefaultSettings for a
+// nil r.
+func SettingsOf(r *http.Request) Settings {
+	if r != nil {
+		if settings, ok := r.Context().Value(settingsKey{}).(Settings); ok {
+			return settings
+		}
+	}
+	return DefaultSettings()
+}
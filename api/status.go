@@ -0,0 +1,117 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/internal/logging"
+)
+
+// StatusError is an error WriteErr answers with StatusCode and Code. Message
+// is what clients see, so detail for the logs is added by wrapping it with
+// %w rather than by changing it. Challenge, when set, is the
+// WWW-Authenticate header of the answer.
+type StatusError struct {
+	StatusCode int
+	Code       string
+	Message    string
+	Challenge  string
+}
+
+func (e *StatusError) Error() string { return e.Message }
+
+// Errors of the database and token layers, which return them wrapped or as
+// they are for WriteErr to answer.
+var (
+	ErrUserNotFound      = &StatusError{StatusCode: http.StatusNotFound, Code: CodeUserNotFound, Message: "User does not exist."}
+	ErrNoBalanceYet      = &StatusError{StatusCode: http.StatusNotFound, Code: CodeBalanceNotFound, Message: "The account did not exist yet at that time."}
+	ErrUserExists        = &StatusError{StatusCode: http.StatusConflict, Code: CodeUserExists, Message: "Username is already taken."}
+	ErrInvalidToken      = &StatusError{StatusCode: http.StatusUnauthorized, Code: CodeInvalidToken, Message: "Invalid token.", Challenge: `Bearer error="invalid_token"`}
+	ErrTokenExpired      = &StatusError{StatusCode: http.StatusUnauthorized, Code: CodeTokenExpired, Message: "Token expired.", Challenge: `Bearer error="invalid_token", error_description="The token expired"`}
+	ErrMissingToken      = &StatusError{StatusCode: http.StatusUnauthorized, Code: CodeMissingToken, Message: "A token is required.", Challenge: "Bearer"}
+	ErrMalformedAuth     = &StatusError{StatusCode: http.StatusUnauthorized, Code: CodeMalformedAuth, Message: `Authorization must be "Bearer <token>".`, Challenge: `Bearer error="invalid_request"`}
+	ErrConflictingTokens = &StatusError{StatusCode: http.StatusBadRequest, Code: CodeConflictingTokens, Message: "The request carries different tokens."}
+	ErrInvalidAPIKey     = &StatusError{StatusCode: http.StatusUnauthorized, Code: CodeInvalidAPIKey, Message: "Invalid API key."}
+	ErrLockedOut         = &StatusError{StatusCode: http.StatusTooManyRequests, Code: CodeLockedOut, Message: "Too many failed attempts, try again later."}
+	ErrInsufficientFunds = &StatusError{StatusCode: http.StatusConflict, Code: CodeInsufficientFunds, Message: "Insufficient funds."}
+	ErrAccountFrozen     = &StatusError{StatusCode: http.StatusLocked, Code: CodeAccountFrozen, Message: "This account is frozen."}
+	ErrVersionConflict   = &StatusError{StatusCode: http.StatusConflict, Code: CodeVersionConflict, Message: "The balance was changed concurrently, try again."}
+	ErrCircuitOpen       = &StatusError{StatusCode: http.StatusServiceUnavailable, Code: CodeUnavailable, Message: "The service is temporarily unavailable, try again later."}
+	ErrProviderDown      = &StatusError{StatusCode: http.StatusServiceUnavailable, Code: CodeUnavailable, Message: "The identity provider is unavailable, try again later."}
+)
+
+// RetryAfterError is answered by WriteErr like Err, with a Retry-After
+// header telling clients when to try again.
+type RetryAfterError struct {
+	Err   error
+	After time.Duration
+}
+
+func (e *RetryAfterError) Error() string { return e.Err.Error() }
+
+func (e *RetryAfterError) Unwrap() error { return e.Err }
+
+// ValidationError is a request WriteErr answers with 400. Err is the message
+// for clients; Violations, when there are any, the rules the request broke.
+type ValidationError struct {
+	Err        error
+	Violations []Violation
+}
+
+func (e *ValidationError) Error() string { return e.Err.Error() }
+
+func (e *ValidationError) Unwrap() error { return e.Err }
+
+// ErrBalanceOverflow is the ValidationError of an amount that would take a
+// balance past the largest one there can be.
+var ErrBalanceOverflow = &ValidationError{Err: errors.New("The amount would take the balance past the largest one there can be.")}
+
+// WriteErr answers err with the status of the StatusError, ValidationError
+// or BodyError it wraps, and the Retry-After of a RetryAfterError. A
+// StatusError is logged as a warning, as is a context error, answered with
+// 503. Any other error is unexpected: it is logged as an error and answered
+// with 500.
+func WriteErr(w http.ResponseWriter, err error) {
+	var statusErr *StatusError
+	var validationErr *ValidationError
+	var bodyErr *BodyError
+
+	var retryErr *RetryAfterError
+	if errors.As(err, &retryErr) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryErr.After.Seconds()))))
+	}
+
+	switch {
+	case errors.As(err, &bodyErr):
+		BodyErrorHandler(w, bodyErr)
+	case errors.As(err, &validationErr) && len(validationErr.Violations) > 0:
+		ValidationErrorHandler(w, validationErr.Violations)
+	case errors.As(err, &validationErr):
+		writeError(w, CodeInvalidRequest, validationErr.Error(), http.StatusBadRequest)
+	case errors.As(err, &statusErr):
+		logging.FromContext(requestContext(w)).Warn(err)
+		if statusErr.Challenge != "" {
+			w.Header().Set("WWW-Authenticate", statusErr.Challenge)
+		}
+		writeError(w, statusErr.Code, statusErr.Message, statusErr.StatusCode)
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		logging.FromContext(requestContext(w)).Warn(err)
+		TimeoutErrorHandler(w)
+	default:
+		logging.FromContext(requestContext(w)).Error(err)
+		InternalErrorHandler(w)
+	}
+}
+
+// requestContext is the context of the request w answers, if WithErrorWriter
+// set it up.
+func requestContext(w http.ResponseWriter) context.Context {
+	if _, r := errorWriterOf(w); r != nil {
+		return r.Context()
+	}
+	return context.Background()
+}
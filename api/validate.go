@@ -0,0 +1,198 @@
+package api
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// UsernamePattern is what usernames are made of, once normalized: 3-32
+// lowercase letters, digits, '_', '-' or '.', starting with a letter and
+// ending with a letter or a digit.
+var UsernamePattern = regexp.MustCompile(`^[a-z][a-z0-9_.-]{1,30}[a-z0-9]$`)
+
+// NormalizeUsername returns username the way it is stored and looked up:
+// without surrounding spaces, in Unicode NFC and lowercase, so " Alex " is
+// alex.
+func NormalizeUsername(username string) string {
+	return strings.ToLower(norm.NFC.String(strings.TrimSpace(username)))
+}
+
+// NormalizeUsernames normalizes, in place, the string fields of v, a pointer
+// to a struct, with the username rule.
+func NormalizeUsernames(v any) {
+	var value reflect.Value = reflect.ValueOf(v)
+	if value.Kind() != reflect.Pointer || value.Elem().Kind() != reflect.Struct {
+		return
+	}
+	value = value.Elem()
+
+	for i := 0; i < value.NumField(); i++ {
+		var fieldValue reflect.Value = value.Field(i)
+		if fieldValue.Kind() != reflect.String || !fieldValue.CanSet() {
+			continue
+		}
+		for _, rule := range Rules(value.Type().Field(i)) {
+			if rule.Name == "username" {
+				fieldValue.SetString(NormalizeUsername(fieldValue.String()))
+			}
+		}
+	}
+}
+
+// UsernameViolation returns why username, normalized, isn't one, or "" when
+// it is. name is that of the field it was given in.
+func UsernameViolation(name, username string) string {
+	username = NormalizeUsername(username)
+	var allowed = func(r rune) bool {
+		return r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '_' || r == '-' || r == '.'
+	}
+
+	switch length := utf8.RuneCountInString(username); {
+	case length < 3 || length > 32:
+		return name + " must be 3-32 characters."
+	case strings.IndexFunc(username, func(r rune) bool { return !allowed(r) }) >= 0:
+		return name + " may only contain letters, digits, '_', '-' and '.'."
+	case !UsernamePattern.MatchString(username):
+		return name + " must start with a letter and end with a letter or a digit."
+	}
+	return ""
+}
+
+// Rule is one constraint of a `validate` struct tag, which lists them
+// separated by commas:
+//
+//	required     the field must be set
+//	min=N max=N  bounds of a number, or of the length of a string or a list
+//	oneof=A B    the string must be one of the values
+//	username     the string, normalized, must match UsernamePattern
+//
+// Rules other than required only apply to fields that are set, so
+// optional fields may be left out.
+type Rule struct {
+	Name  string
+	Param string
+}
+
+// Rules parses the validate tag of field. It panics on an unknown rule,
+// which is a mistake in the type rather than in a request.
+func Rules(field reflect.StructField) []Rule {
+	var tag string = field.Tag.Get("validate")
+	if tag == "" {
+		return nil
+	}
+
+	var rules []Rule
+	for _, part := range strings.Split(tag, ",") {
+		name, param, _ := strings.Cut(part, "=")
+		switch name {
+		case "required", "username":
+		case "min", "max":
+			if _, err := strconv.ParseInt(param, 10, 64); err != nil {
+				panic(fmt.Sprintf("api: %s of %s is not a number", name, field.Name))
+			}
+		case "oneof":
+			if param == "" {
+				panic(fmt.Sprintf("api: oneof of %s lists no values", field.Name))
+			}
+		default:
+			panic(fmt.Sprintf("api: unknown rule %q on %s", name, field.Name))
+		}
+		rules = append(rules, Rule{Name: name, Param: param})
+	}
+	return rules
+}
+
+// FieldName is the name a field is sent under: the schema tag for query
+// parameters, else the JSON name.
+func FieldName(field reflect.StructField) string {
+	if name, _, _ := strings.Cut(field.Tag.Get("schema"), ","); name != "" {
+		return name
+	}
+	if name, _, _ := strings.Cut(field.Tag.Get("json"), ","); name != "" {
+		return name
+	}
+	return field.Name
+}
+
+// Validate checks the fields of v, a struct or a pointer to one, and those
+// of the structs it embeds, against their validate tags and returns every
+// violation, not just the first.
+func Validate(v any) []Violation {
+	var value reflect.Value = reflect.Indirect(reflect.ValueOf(v))
+	if value.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var violations []Violation
+	for i := 0; i < value.NumField(); i++ {
+		var field reflect.StructField = value.Type().Field(i)
+		var name string = FieldName(field)
+		var fieldValue reflect.Value = value.Field(i)
+
+		if field.Anonymous && fieldValue.Kind() == reflect.Struct {
+			violations = append(violations, Validate(fieldValue.Interface())...)
+			continue
+		}
+		for _, rule := range Rules(field) {
+			if rule.Name != "required" && fieldValue.IsZero() {
+				continue
+			}
+			if message := check(rule, reflect.Indirect(fieldValue), name); message != "" {
+				violations = append(violations, Violation{Field: name, Rule: rule.Name, Message: message})
+			}
+		}
+	}
+	return violations
+}
+
+// check returns why value breaks rule, or "" when it doesn't.
+func check(rule Rule, value reflect.Value, name string) string {
+	switch rule.Name {
+	case "required":
+		if !value.IsValid() || value.IsZero() {
+			return name + " is required."
+		}
+	case "min", "max":
+		bound, _ := strconv.ParseInt(rule.Param, 10, 64)
+		size, unit := measure(value)
+		if rule.Name == "min" && size < bound {
+			return fmt.Sprintf("%s must be at least %d%s.", name, bound, unit)
+		}
+		if rule.Name == "max" && size > bound {
+			return fmt.Sprintf("%s must be at most %d%s.", name, bound, unit)
+		}
+	case "oneof":
+		var values []string = strings.Fields(rule.Param)
+		for _, allowed := range values {
+			if value.String() == allowed {
+				return ""
+			}
+		}
+		return fmt.Sprintf("%s must be one of: %s.", name, strings.Join(values, ", "))
+	case "username":
+		return UsernameViolation(name, value.String())
+	}
+	return ""
+}
+
+// measure returns the number min and max compare, with the unit it is
+// counted in.
+func measure(value reflect.Value) (int64, string) {
+	switch value.Kind() {
+	case reflect.String:
+		return int64(utf8.RuneCountInString(value.String())), " characters"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return int64(value.Len()), " items"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(value.Uint()), ""
+	case reflect.Float32, reflect.Float64:
+		return int64(value.Float()), ""
+	}
+	return value.Int(), ""
+}
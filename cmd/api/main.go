@@ -1,19 +1,55 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
-	"github.com/RashedMaaitah/goapi/internal/handlers"
-	"github.com/go-chi/chi"
-	log "github.com/sirupsen/logrus"
+	"github.com/RashedMaaitah/goapi/internal/config"
+	"github.com/RashedMaaitah/goapi/internal/logging"
+	"github.com/RashedMaaitah/goapi/internal/version"
+	"github.com/RashedMaaitah/goapi/server"
 )
 
 func main() {
 
-	log.SetReportCaller(true)
-	var r *chi.Mux = chi.NewRouter()
-	handlers.Handler(r)
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Println("Invalid configuration:", err)
+		os.Exit(1)
+	}
+
+	logger, err := logging.New(cfg.Log, os.Stderr)
+	if err != nil {
+		fmt.Println("Invalid configuration:", err)
+		os.Exit(1)
+	}
+
+	if cfg.MigrateOnly {
+		if err = server.Migrate(*cfg, server.WithLogger(logger)); err != nil {
+			logger.Error(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if cfg.RunJob != "" {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		err = server.RunJob(ctx, *cfg, cfg.RunJob, server.WithLogger(logger))
+		stop()
+		if err != nil {
+			logger.Error(err)
+			os.Exit(1)
+		}
+		return
+	}
 
 	fmt.Println("Starting GO API service....")
 
@@ -23,9 +59,23 @@ func main() {
 / (_ / /_/ / / __ |/ ___// /  
 \___/\____/ /_/ |_/_/  /___/  `)
 
-	err := http.ListenAndServe("localhost:8000", r)
+	var info version.Info = version.Get()
+	fmt.Printf("Version %s, commit %s, built %s with %s\n\n", info.Version, info.Commit, info.BuildDate, info.GoVersion)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		// Restore default signal handling so a second signal kills the process.
+		stop()
+	}()
+
+	err = server.Run(ctx, *cfg,
+		server.WithLogger(logger),
+		server.WithReload(func() (*config.Config, error) { return config.Load(os.Args[1:]) }),
+	)
 
 	if err != nil {
-		log.Error(err)
+		logger.Error(err)
+		os.Exit(1)
 	}
 }
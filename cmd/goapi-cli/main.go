@@ -0,0 +1,197 @@
+// Command goapi-cli calls the API from the command line through pkg/client.
+//
+//	goapi-cli balance --user alex
+//	goapi-cli deposit --amount 100
+//	goapi-cli transfer --to maria --amount 50
+//
+// The server URL and token come from --url and --token, or GOAPI_URL and
+// GOAPI_TOKEN.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/pkg/client"
+)
+
+const usage = `Usage: goapi-cli <command> [flags]
+
+Commands:
+  balance   --user NAME          show the balance of the token's user
+  deposit   --amount N           add coins
+  withdraw  --amount N           remove coins
+  transfer  --to NAME --amount N move coins to another user
+
+Every command accepts --url, --token, --json and --timeout, see
+goapi-cli <command> -h.
+`
+
+var errUsage = errors.New("invalid usage")
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// options are the flags shared by every command.
+type options struct {
+	url     string
+	token   string
+	json    bool
+	timeout time.Duration
+}
+
+func (o *options) register(fs *flag.FlagSet) {
+	var defaultURL string = os.Getenv("GOAPI_URL")
+	if defaultURL == "" {
+		defaultURL = "http://localhost:8000"
+	}
+
+	fs.StringVar(&o.url, "url", defaultURL, "server URL (env GOAPI_URL)")
+	fs.StringVar(&o.token, "token", os.Getenv("GOAPI_TOKEN"), "auth token (env GOAPI_TOKEN)")
+	fs.BoolVar(&o.json, "json", false, "print the response as JSON")
+	fs.DurationVar(&o.timeout, "timeout", 10*time.Second, "give up on the request after this long")
+}
+
+// run executes the command in args and returns the exit code: 0 on
+// success, 1 when the request fails and 2 for invalid arguments.
+func run(args []string, stdout io.Writer, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		fmt.Fprint(stderr, usage)
+		if len(args) == 0 {
+			return 2
+		}
+		return 0
+	}
+
+	var command string = args[0]
+	var fs = flag.NewFlagSet("goapi-cli "+command, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	var o options
+	o.register(fs)
+
+	var (
+		user   string
+		to     string
+		amount int64
+	)
+
+	switch command {
+	case "balance":
+		fs.StringVar(&user, "user", "", "username, must own the token (optional)")
+	case "deposit", "withdraw":
+		fs.Int64Var(&amount, "amount", 0, "amount of coins, a positive integer")
+	case "transfer":
+		fs.StringVar(&to, "to", "", "recipient")
+		fs.Int64Var(&amount, "amount", 0, "amount of coins, a positive integer")
+	default:
+		fmt.Fprintf(stderr, "goapi-cli: unknown command %q\n\n%s", command, usage)
+		return 2
+	}
+
+	if err := fs.Parse(args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+
+	if err := validate(command, o, to, amount, fs.Args()); err != nil {
+		fmt.Fprintf(stderr, "goapi-cli %s: %v\n", command, err)
+		return 2
+	}
+
+	c, err := client.NewClient(o.url, o.token)
+	if err != nil {
+		fmt.Fprintf(stderr, "goapi-cli: %v\n", err)
+		return 2
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), o.timeout)
+	defer cancel()
+
+	var response any
+	switch command {
+	case "balance":
+		response, err = c.CoinBalance(ctx, user)
+	case "deposit":
+		response, err = c.Deposit(ctx, amount)
+	case "withdraw":
+		response, err = c.Withdraw(ctx, amount)
+	case "transfer":
+		response, err = c.Transfer(ctx, to, amount)
+	}
+
+	if err != nil {
+		var apiErr *client.Error
+		if errors.As(err, &apiErr) {
+			fmt.Fprintln(stderr, "Error:", apiErr.Message)
+		} else {
+			fmt.Fprintln(stderr, "Error:", err)
+		}
+		return 1
+	}
+
+	if o.json {
+		var encoder = json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(response)
+		return 0
+	}
+
+	printTable(stdout, response)
+	return 0
+}
+
+func validate(command string, o options, to string, amount int64, rest []string) error {
+	if len(rest) > 0 {
+		return fmt.Errorf("unexpected argument %q", rest[0])
+	}
+	if o.token == "" {
+		return errors.New("--token or GOAPI_TOKEN is required")
+	}
+	if o.timeout <= 0 {
+		return errors.New("--timeout must be positive")
+	}
+	if command == "transfer" && to == "" {
+		return errors.New("--to is required")
+	}
+	if command != "balance" && amount <= 0 {
+		return errors.New("--amount must be a positive integer")
+	}
+	return nil
+}
+
+func printTable(w io.Writer, response any) {
+	var table = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	defer table.Flush()
+
+	switch r := response.(type) {
+	case *api.CoinBalanceResponse:
+		fmt.Fprintln(table, "CURRENCY\tBALANCE")
+		var currencies = make([]string, 0, len(r.Balances))
+		for currency := range r.Balances {
+			currencies = append(currencies, currency)
+		}
+		sort.Strings(currencies)
+		for _, currency := range currencies {
+			fmt.Fprintf(table, "%s\t%d\n", currency, r.Balances[currency])
+		}
+		if r.Frozen {
+			fmt.Fprintln(table, "\nThe account is frozen.")
+		}
+	case *api.TransferResponse:
+		fmt.Fprintln(table, "TRANSFER\tCURRENCY\tBALANCE")
+		fmt.Fprintf(table, "%s\t%s\t%d\n", r.TransferID, r.Currency, r.Balance)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/apitest"
+)
+
+func TestRunValidatesArguments(t *testing.T) {
+	t.Setenv("GOAPI_URL", "")
+	t.Setenv("GOAPI_TOKEN", "")
+
+	for _, tt := range []struct {
+		name string
+		args []string
+		want int
+		says string
+	}{
+		{"no command", nil, 2, "Usage"},
+		{"help", []string{"help"}, 0, "Usage"},
+		{"unknown command", []string{"refund"}, 2, `unknown command "refund"`},
+		{"unknown flag", []string{"balance", "--currency", "eur"}, 2, "flag provided but not defined"},
+		{"no token", []string{"balance"}, 2, "--token or GOAPI_TOKEN is required"},
+		{"extra argument", []string{"balance", "--token", "t", "alex"}, 2, `unexpected argument "alex"`},
+		{"no amount", []string{"deposit", "--token", "t"}, 2, "--amount must be a positive integer"},
+		{"negative amount", []string{"withdraw", "--token", "t", "--amount", "-5"}, 2, "--amount must be a positive integer"},
+		{"amount not a number", []string{"deposit", "--token", "t", "--amount", "ten"}, 2, "invalid value"},
+		{"no recipient", []string{"transfer", "--token", "t", "--amount", "5"}, 2, "--to is required"},
+		{"zero timeout", []string{"balance", "--token", "t", "--timeout", "0s"}, 2, "--timeout must be positive"},
+		{"relative url", []string{"balance", "--token", "t", "--url", "localhost:8000"}, 2, "invalid base URL"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if code := run(tt.args, &stdout, &stderr); code != tt.want {
+				t.Errorf("exit code %d, want %d; stderr: %s", code, tt.want, stderr.String())
+			}
+			if !strings.Contains(stderr.String(), tt.says) {
+				t.Errorf("stderr %q doesn't say %q", stderr.String(), tt.says)
+			}
+		})
+	}
+}
+
+func TestRunAgainstTheServer(t *testing.T) {
+	var s = apitest.New(t)
+	t.Setenv("GOAPI_URL", s.URL)
+	t.Setenv("GOAPI_TOKEN", s.Token("alex"))
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"deposit", "--amount", "100", "--json"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("deposit exited %d: %s", code, stderr.String())
+	}
+	var balance api.CoinBalanceResponse
+	if err := json.Unmarshal(stdout.Bytes(), &balance); err != nil || balance.Balance != 1100 {
+		t.Fatalf("deposit printed %s, want a balance of 1100", stdout.String())
+	}
+
+	stdout.Reset()
+	if code := run([]string{"balance"}, &stdout, &stderr); code != 0 || !strings.Contains(stdout.String(), "BALANCE") || !strings.Contains(stdout.String(), "1100") {
+		t.Fatalf("balance exited %d and printed %q, want a table with 1100", code, stdout.String())
+	}
+
+	stdout.Reset()
+	if code := run([]string{"transfer", "--to", "maria", "--amount", "5000"}, &stdout, &stderr); code != 1 {
+		t.Fatalf("transfer of too much exited %d, want 1", code)
+	}
+	if !strings.Contains(stderr.String(), "Error: Insufficient funds.") {
+		t.Errorf("stderr %q doesn't carry the message of the server", stderr.String())
+	}
+}
@@ -0,0 +1,174 @@
+// Package accesslog writes the access log: one JSON object per request,
+// apart from the application log, to stdout or to a file rotated by size
+// and age. Requests queue their entries without waiting for the writer.
+package accesslog
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/internal/config"
+	"github.com/RashedMaaitah/goapi/internal/metrics"
+	log "github.com/sirupsen/logrus"
+)
+
+// Entry is the line of a request. User is empty when it wasn't
+// authenticated, and Route when no route matched. Aborted is set for a
+// request whose handler panicked past the recoverer, such as with
+// http.ErrAbortHandler.
+type Entry struct {
+	Time       time.Time `json:"time"`
+	RequestID  string    `json:"request_id"`
+	User       string    `json:"user,omitempty"`
+	Method     string    `json:"method"`
+	Route      string    `json:"route,omitempty"`
+	Path       string    `json:"path"`
+	Status     int       `json:"status"`
+	DurationMs float64   `json:"duration_ms"`
+	Bytes      int       `json:"bytes"`
+	RemoteAddr string    `json:"remote_addr"`
+	Aborted    bool      `json:"aborted,omitempty"`
+}
+
+// Log writes the entries queued by Write in the background. A nil *Log
+// discards them.
+type Log struct {
+	out     io.WriteCloser
+	logger  *log.Logger
+	dropped metrics.Counter
+	drops   atomic.Uint64
+
+	// mu guards closed, so that Write never sends on the closed entries.
+	mu      sync.RWMutex
+	closed  bool
+	entries chan Entry
+	done    chan struct{}
+	err     error
+}
+
+// Open starts the access log of cfg, or returns nil for the discard sink.
+// Write errors are logged through logger, and the entries dropped as the
+// buffer is full counted in m.
+func Open(cfg config.AccessLogConfig, logger *log.Logger, m *metrics.Metrics) (*Log, error) {
+	var out io.WriteCloser
+	switch cfg.Sink {
+	case config.AccessLogDiscard:
+		return nil, nil
+	case config.AccessLogStdout:
+		out = nopCloser{os.Stdout}
+	case config.AccessLogFile:
+		file, err := OpenFile(cfg.Path, cfg.MaxBytes, cfg.MaxAge.Duration(), cfg.MaxBackups)
+		if err != nil {
+			return nil, fmt.Errorf("log.access.path: %w", err)
+		}
+		out = file
+	default:
+		return nil, fmt.Errorf("unknown access log sink %q", cfg.Sink)
+	}
+
+	var l = &Log{
+		out:     out,
+		logger:  logger,
+		dropped: m.AccessLogDropped,
+		entries: make(chan Entry, cfg.BufferSize),
+		done:    make(chan struct{}),
+	}
+	go l.run()
+	return l, nil
+}
+
+// Write queues entry, or drops it if the buffer is full or the log is
+// closed.
+func (l *Log) Write(entry Entry) {
+	if l == nil {
+		return
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if !l.closed {
+		select {
+		case l.entries <- entry:
+			return
+		default:
+		}
+	}
+	l.drops.Add(1)
+	l.dropped.Inc()
+}
+
+// Dropped returns how many entries were dropped.
+func (l *Log) Dropped() uint64 {
+	if l == nil {
+		return 0
+	}
+	return l.drops.Load()
+}
+
+// Close writes the queued entries until ctx is done, then flushes and
+// closes the sink.
+func (l *Log) Close(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	if !l.closed {
+		l.closed = true
+		close(l.entries)
+	}
+	l.mu.Unlock()
+
+	select {
+	case <-l.done:
+		if drops := l.drops.Load(); drops > 0 {
+			l.logger.Warnf("Dropped %d access log entries as the buffer was full", drops)
+		}
+		return l.err
+	case <-ctx.Done():
+		return fmt.Errorf("abandoned queued access log entries: %w", ctx.Err())
+	}
+}
+
+// run encodes the entries, flushing whenever none is waiting, until the
+// entries are closed.
+func (l *Log) run() {
+	defer close(l.done)
+
+	var buf *bufio.Writer = bufio.NewWriter(l.out)
+	var encoder *json.Encoder = json.NewEncoder(buf)
+	// failing keeps a sink that can't be written from logging every entry.
+	// The entries buffered when writing fails are lost.
+	var failing bool
+	var report = func(err error) {
+		if err != nil {
+			if !failing {
+				l.logger.Errorf("Writing the access log: %v", err)
+			}
+			buf.Reset(l.out)
+		}
+		failing = err != nil
+	}
+
+	for entry := range l.entries {
+		report(encoder.Encode(entry))
+		if len(l.entries) == 0 {
+			report(buf.Flush())
+		}
+	}
+
+	report(buf.Flush())
+	l.err = l.out.Close()
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
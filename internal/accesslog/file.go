@@ -0,0 +1,120 @@
+package accesslog
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupFormat is the suffix of rotated files, which sorts by time.
+const backupFormat = "20060102T150405.000000000"
+
+// File appends to the file at a path, renaming it to path.<time of the
+// rotation> and starting a new one before a write that would take it past
+// maxBytes, or once it is maxAge old, either 0 for never. Only the
+// maxBackups latest rotated files are kept, all of them for 0. The age of a
+// file that existed is counted from when it was opened.
+type File struct {
+	path       string
+	maxBytes   int64
+	maxAge     time.Duration
+	maxBackups int
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	opened time.Time
+}
+
+func OpenFile(path string, maxBytes int64, maxAge time.Duration, maxBackups int) (*File, error) {
+	var f = &File{path: path, maxBytes: maxBytes, maxAge: maxAge, maxBackups: maxBackups}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *File) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var full bool = f.maxBytes > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxBytes
+	var old bool = f.maxAge > 0 && time.Since(f.opened) >= f.maxAge
+	// A backup that can't be removed doesn't keep p from being written.
+	var pruned error
+	if full || old {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+		pruned = f.prune()
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	if err == nil {
+		err = pruned
+	}
+	return n, err
+}
+
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
+
+func (f *File) open() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o640)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	f.file = file
+	f.size = info.Size()
+	f.opened = time.Now()
+	return nil
+}
+
+// rotate renames the file and opens a new one. f.mu must be held.
+func (f *File) rotate() error {
+	f.file.Close()
+	// Reopened even if the rename failed, to go on writing to the file.
+	var renamed error = os.Rename(f.path, f.path+"."+time.Now().UTC().Format(backupFormat))
+	if err := f.open(); err != nil {
+		return err
+	}
+	return renamed
+}
+
+// prune removes the backups past maxBackups. f.mu must be held.
+func (f *File) prune() error {
+	if f.maxBackups == 0 {
+		return nil
+	}
+	matches, err := filepath.Glob(f.path + ".*")
+	if err != nil {
+		return err
+	}
+	// Only the files named like ours, not those others put next to them.
+	var backups []string
+	for _, match := range matches {
+		if _, err := time.Parse(backupFormat, strings.TrimPrefix(match, f.path+".")); err == nil {
+			backups = append(backups, match)
+		}
+	}
+	slices.Sort(backups)
+	for _, backup := range backups[:max(len(backups)-f.maxBackups, 0)] {
+		if err := os.Remove(backup); err != nil {
+			return err
+		}
+	}
+	return nil
+}
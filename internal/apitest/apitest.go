@@ -0,0 +1,238 @@
+// Package apitest serves the whole API in process, for end-to-end tests of
+// its routes.
+package apitest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/auth"
+	"github.com/RashedMaaitah/goapi/internal/config"
+	"github.com/RashedMaaitah/goapi/internal/handlers"
+	"github.com/RashedMaaitah/goapi/internal/logging"
+	"github.com/RashedMaaitah/goapi/internal/tools"
+	"github.com/go-chi/chi"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Server is the router of handlers.Handler behind an httptest.Server, on
+// the in-memory database of the mock driver, holding the demo users or
+// those of a fixture. It is closed when the test ends.
+type Server struct {
+	*httptest.Server
+
+	Config   config.Config
+	Database tools.Database
+	Tokens   auth.Tokens
+
+	t      testing.TB
+	mu     sync.Mutex
+	issued map[string]string
+}
+
+// Option customizes a Server.
+type Option func(*options)
+
+type options struct {
+	configure []func(*config.Config)
+	fixture   string
+	handler   []handlers.Option
+}
+
+// WithConfig changes the config the Server is built from, config.Default
+// without rate limits and with the cheapest password hashes.
+func WithConfig(configure func(cfg *config.Config)) Option {
+	return func(o *options) { o.configure = append(o.configure, configure) }
+}
+
+// WithFixture fills the database with the users of the seed file at path,
+// instead of the demo ones.
+func WithFixture(path string) Option {
+	return func(o *options) { o.fixture = path }
+}
+
+// WithHandlerOptions passes opts on to handlers.Handler, after those of
+// the Server.
+func WithHandlerOptions(opts ...handlers.Option) Option {
+	return func(o *options) { o.handler = append(o.handler, opts...) }
+}
+
+// New starts a Server, failing t when it can't.
+func New(t testing.TB, opts ...Option) *Server {
+	t.Helper()
+
+	var o = &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	var cfg config.Config = config.Default()
+	cfg.RateLimit.Enabled = false
+	cfg.RateLimit.PerUser.Enabled = false
+	cfg.Auth.BcryptCost = bcrypt.MinCost
+	cfg.Database.Seed = o.fixture
+	for _, configure := range o.configure {
+		configure(&cfg)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("apitest: %v", err)
+	}
+
+	logger, err := logging.New(cfg.Log, testWriter{t})
+	if err != nil {
+		t.Fatalf("apitest: %v", err)
+	}
+
+	database, err := tools.NewDatabase(cfg.Database, logger)
+	if err != nil {
+		t.Fatalf("apitest: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	if cfg.Database.Seed != "" {
+		err = tools.Seed(context.Background(), database, cfg.Database.Seed, cfg.Database.SeedIfEmpty, cfg.Auth.BcryptCost, logger)
+		if err != nil {
+			t.Fatalf("apitest: %v", err)
+		}
+	}
+
+	var tokens auth.Tokens = auth.New(cfg.Auth, database)
+
+	var r *chi.Mux = chi.NewRouter()
+	err = handlers.Handler(r, append([]handlers.Option{
+		handlers.WithConfig(&cfg),
+		handlers.WithDatabase(database),
+		handlers.WithLogger(logger),
+		handlers.WithTokens(tokens, auth.NewAPIKeys(cfg.Auth.APIKeys, database), nil),
+	}, o.handler...)...)
+	if err != nil {
+		t.Fatalf("apitest: %v", err)
+	}
+
+	var s = &Server{
+		Server:   httptest.NewServer(r),
+		Config:   cfg,
+		Database: database,
+		Tokens:   tokens,
+		t:        t,
+		issued:   map[string]string{},
+	}
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Token returns a token of user granting every scope, issued the first
+// time it is asked for.
+func (s *Server) Token(user string) string {
+	s.t.Helper()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if token, ok := s.issued[user]; ok {
+		return token
+	}
+	token, err := s.Tokens.Issue(context.Background(), user, tools.Scopes)
+	if err != nil {
+		s.t.Fatalf("apitest: issuing a token of %s: %v", user, err)
+	}
+	s.issued[user] = token.Value
+	return token.Value
+}
+
+// NewRequest returns a request of path, relative to the Server, with body
+// encoded as JSON unless it is nil.
+func (s *Server) NewRequest(method, path string, body any) *http.Request {
+	s.t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			s.t.Fatalf("apitest: encoding the body of %s %s: %v", method, path, err)
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequest(method, s.URL+path, reader)
+	if err != nil {
+		s.t.Fatalf("apitest: %v", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req
+}
+
+// NewAuthedRequest is NewRequest with the Bearer token of user.
+func (s *Server) NewAuthedRequest(user, method, path string, body any) *http.Request {
+	s.t.Helper()
+
+	var req *http.Request = s.NewRequest(method, path, body)
+	req.Header.Set("Authorization", "Bearer "+s.Token(user))
+	return req
+}
+
+// Do sends req, failing the test when it gets no response. Decode and
+// DecodeError close the body.
+func (s *Server) Do(req *http.Request) *http.Response {
+	s.t.Helper()
+
+	resp, err := s.Client().Do(req)
+	if err != nil {
+		s.t.Fatalf("apitest: %s %s: %v", req.Method, req.URL.Path, err)
+	}
+	return resp
+}
+
+// Decode checks resp has status, and decodes its body into a T, such as
+// an api.CoinBalanceResponse.
+func Decode[T any](t testing.TB, resp *http.Response, status int) T {
+	t.Helper()
+	defer resp.Body.Close()
+
+	var body []byte
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("apitest: reading the response: %v", err)
+	}
+	if resp.StatusCode != status {
+		t.Fatalf("apitest: %s %s answered %d, want %d: %s", resp.Request.Method, resp.Request.URL.Path, resp.StatusCode, status, body)
+	}
+
+	var v T
+	if err = json.Unmarshal(body, &v); err != nil {
+		t.Fatalf("apitest: decoding %s: %v", body, err)
+	}
+	return v
+}
+
+// DecodeError checks resp has status and the error code, and returns its
+// api.Error.
+func DecodeError(t testing.TB, resp *http.Response, status int, code string) api.Error {
+	t.Helper()
+
+	var apiErr api.Error = Decode[api.Error](t, resp, status)
+	if apiErr.Code != code {
+		t.Fatalf("apitest: %s %s answered code %q, want %q", resp.Request.Method, resp.Request.URL.Path, apiErr.Code, code)
+	}
+	return apiErr
+}
+
+// testWriter logs to a test, shown when it fails or runs verbose.
+type testWriter struct {
+	t testing.TB
+}
+
+func (w testWriter) Write(p []byte) (int, error) {
+	w.t.Log(strings.TrimSuffix(string(p), "\n"))
+	return len(p), nil
+}
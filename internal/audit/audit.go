@@ -0,0 +1,81 @@
+// Package audit records who did what to which account, in the audit log of
+// the database.
+package audit
+
+import (
+	"context"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/internal/logging"
+	"github.com/RashedMaaitah/goapi/internal/metrics"
+	"github.com/RashedMaaitah/goapi/internal/middleware"
+	"github.com/RashedMaaitah/goapi/internal/tools"
+)
+
+// The actions recorded.
+const (
+	ActionLogin         = "login"
+	ActionSetBalance    = "set_balance"
+	ActionAdjustBalance = "adjust_balance"
+	ActionFreeze        = "freeze"
+	ActionUnfreeze      = "unfreeze"
+	ActionDeleteUser    = "delete_user"
+	ActionRestoreUser   = "restore_user"
+	ActionTransfer      = "transfer"
+)
+
+var Actions = []string{
+	ActionLogin, ActionSetBalance, ActionAdjustBalance, ActionFreeze,
+	ActionUnfreeze, ActionDeleteUser, ActionRestoreUser, ActionTransfer,
+}
+
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// recordTimeout bounds the write of an entry, which doesn't end with the
+// request it is about.
+const recordTimeout = 5 * time.Second
+
+// Auditor keeps the audit log.
+type Auditor interface {
+	// Record appends entry with the request ID of ctx, as a failure if err
+	// is not nil. It never fails the operation recorded: an entry that can't
+	// be written is logged and counted instead.
+	Record(ctx context.Context, entry tools.AuditEntry, err error)
+
+	// List returns the entries filter selects, newest first.
+	List(ctx context.Context, filter tools.AuditFilter) ([]tools.AuditEntry, error)
+}
+
+// New returns the Auditor writing to the audit log of database.
+func New(database tools.Database, m *metrics.Metrics) Auditor {
+	return &databaseAuditor{database: database, metrics: m}
+}
+
+type databaseAuditor struct {
+	database tools.Database
+	metrics  *metrics.Metrics
+}
+
+func (a *databaseAuditor) Record(ctx context.Context, entry tools.AuditEntry, err error) {
+	entry.RequestID = middleware.GetRequestID(ctx)
+	entry.Outcome = OutcomeSuccess
+	if err != nil {
+		entry.Outcome = OutcomeFailure
+	}
+
+	// Written even if the client is gone by now.
+	writeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), recordTimeout)
+	defer cancel()
+
+	if _, err = a.database.AppendAudit(writeCtx, entry); err != nil {
+		logging.FromContext(ctx).Errorf("Audit of %s on %q by %q: %v", entry.Action, entry.Target, entry.Actor, err)
+		a.metrics.AuditFailures.Inc(entry.Action)
+	}
+}
+
+func (a *databaseAuditor) List(ctx context.Context, filter tools.AuditFilter) ([]tools.AuditEntry, error) {
+	return a.database.ListAudit(ctx, filter)
+}
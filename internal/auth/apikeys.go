@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/config"
+	"github.com/RashedMaaitah/goapi/internal/logging"
+	"github.com/RashedMaaitah/goapi/internal/tools"
+)
+
+var ErrInvalidAPIKey = api.ErrInvalidAPIKey
+
+// apiKeyPrefix starts every API key, so secret scanners, and people, can
+// tell them from user tokens.
+const apiKeyPrefix = "gak_"
+
+// ServicePrefix starts the Username of services, which no user can have,
+// so what a service does is recorded under a name of its own.
+const ServicePrefix = "service:"
+
+// APIKeys creates the API keys of services and verifies the ones presented.
+type APIKeys struct {
+	database      tools.Database
+	touchInterval time.Duration
+}
+
+func NewAPIKeys(cfg config.APIKeysConfig, database tools.Database) *APIKeys {
+	return &APIKeys{database: database, touchInterval: cfg.TouchInterval.Duration()}
+}
+
+// Create stores a new key of the service name, and returns it with the key
+// itself, which isn't stored and can't be shown again.
+func (k *APIKeys) Create(ctx context.Context, name string, role string, expiresAt time.Time) (*tools.APIKey, string, error) {
+	var id = make([]byte, 8)
+	rand.Read(id)
+	var key string = apiKeyPrefix + newToken()
+
+	var apiKey = tools.APIKey{
+		ID:        hex.EncodeToString(id),
+		Name:      name,
+		Role:      role,
+		Hash:      tools.HashToken(key),
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+		ExpiresAt: expiresAt.UTC(),
+	}
+	if err := k.database.CreateAPIKey(ctx, apiKey); err != nil {
+		return nil, "", err
+	}
+	return &apiKey, key, nil
+}
+
+func (k *APIKeys) List(ctx context.Context) ([]tools.APIKey, error) {
+	return k.database.ListAPIKeys(ctx)
+}
+
+// Revoke deletes the key id, tools.ErrAPIKeyNotFound if there is none.
+func (k *APIKeys) Revoke(ctx context.Context, id string) error {
+	return k.database.DeleteAPIKey(ctx, id)
+}
+
+// Verify returns the LoginDetails of the service of key, or
+// ErrInvalidAPIKey for keys unknown, revoked or expired. The LastUsedAt of
+// the key is updated when older than the touch interval; failing to do so
+// doesn't fail the request.
+func (k *APIKeys) Verify(ctx context.Context, key string) (*tools.LoginDetails, error) {
+	var hash string = tools.HashToken(key)
+	apiKey, err := k.database.GetAPIKey(ctx, hash)
+
+	if errors.Is(err, tools.ErrAPIKeyNotFound) {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(apiKey.Hash), []byte(hash)) != 1 {
+		return nil, ErrInvalidAPIKey
+	}
+
+	var now time.Time = time.Now().UTC()
+	if apiKey.Expired(now) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	if now.Sub(apiKey.LastUsedAt) >= k.touchInterval {
+		if err = k.database.TouchAPIKey(ctx, apiKey.ID, now.Truncate(time.Second)); err != nil {
+			logging.FromContext(ctx).Warnf("Could not update when API key %s was last used: %v", apiKey.ID, err)
+		}
+	}
+
+	return &tools.LoginDetails{
+		Username:  ServicePrefix + apiKey.Name,
+		Role:      apiKey.Role,
+		CreatedAt: apiKey.CreatedAt,
+		APIKey:    apiKey.ID,
+	}, nil
+}
@@ -0,0 +1,139 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/RashedMaaitah/goapi/internal/config"
+	"github.com/RashedMaaitah/goapi/internal/metrics"
+	"github.com/RashedMaaitah/goapi/internal/tools"
+)
+
+// ErrNoCredentials is returned by an Authenticator for a request without
+// the credentials it reads, so the next one may be tried.
+var ErrNoCredentials = errors.New("no credentials")
+
+// Identity is who a request authenticated as, and the provider that said so.
+type Identity struct {
+	LoginDetails *tools.LoginDetails
+	Provider     string
+}
+
+// Authenticator authenticates requests by the credentials they carry.
+type Authenticator interface {
+	// Authenticate returns the Identity of r, ErrNoCredentials when r has
+	// none of the credentials it reads, or the error they were refused with.
+	Authenticate(ctx context.Context, r *http.Request) (*Identity, error)
+}
+
+// NewAuthenticator returns the Chain of the cfg.Providers.
+func NewAuthenticator(cfg config.AuthConfig, database tools.Database, tokens Tokens, logins *LoginCache, keys *APIKeys, m *metrics.Metrics) Authenticator {
+	var authenticators = make(Chain, 0, len(cfg.Providers))
+	for _, provider := range cfg.Providers {
+		switch provider {
+		case "token":
+			authenticators = append(authenticators, &TokenAuthenticator{Source: NewTokenSource(cfg), Database: database, Tokens: tokens, Logins: logins, LegacyFullAccess: cfg.LegacyFullAccess})
+		case "api_key":
+			authenticators = append(authenticators, &APIKeyAuthenticator{Header: cfg.APIKeys.Header, Tokens: NewTokenSource(cfg), Keys: keys})
+		case "introspection":
+			authenticators = append(authenticators, NewIntrospector(cfg, database, m))
+		}
+	}
+	return authenticators
+}
+
+// Chain tries its Authenticators in order, and returns the first Identity
+// one of them gives. When none does, the error returned is that of the
+// first one with credentials, unless a later one failed for a reason other
+// than refusing them, such as an identity provider being down: the
+// credentials may well have been good.
+type Chain []Authenticator
+
+func (c Chain) Authenticate(ctx context.Context, r *http.Request) (*Identity, error) {
+	var err error = ErrNoCredentials
+	for _, authenticator := range c {
+		identity, e := authenticator.Authenticate(ctx, r)
+		if e == nil {
+			return identity, nil
+		}
+		if errors.Is(err, ErrNoCredentials) || (refused(err) && !errors.Is(e, ErrNoCredentials) && !refused(e)) {
+			err = e
+		}
+	}
+	return nil, err
+}
+
+// refused reports whether err says the credentials are bad, rather than
+// that they couldn't be checked.
+func refused(err error) bool {
+	return errors.Is(err, ErrInvalidToken) || errors.Is(err, ErrTokenExpired) ||
+		errors.Is(err, ErrInvalidAPIKey) || errors.Is(err, tools.ErrUserNotFound)
+}
+
+// TokenAuthenticator authenticates the tokens of Tokens from Source, as the
+// users they were issued to in Database, through Logins when it isn't nil.
+// LegacyFullAccess is that of Claims.Granted.
+type TokenAuthenticator struct {
+	Source           TokenSource
+	Database         tools.Database
+	Tokens           Tokens
+	Logins           *LoginCache
+	LegacyFullAccess bool
+}
+
+func (a *TokenAuthenticator) Authenticate(ctx context.Context, r *http.Request) (*Identity, error) {
+	token, _, err := a.Source.Token(r)
+	if err != nil {
+		return nil, err
+	}
+	if token == "" {
+		return nil, ErrNoCredentials
+	}
+
+	loginDetails, err := a.Logins.Lookup(token, func() (*tools.LoginDetails, error) {
+		claims, err := a.Tokens.Verify(ctx, token)
+		if err != nil {
+			return nil, err
+		}
+
+		loginDetails, err := a.Database.GetUserLoginDetails(ctx, claims.Username)
+		if errors.Is(err, tools.ErrUserNotFound) {
+			return nil, err
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Looking up %s: %w", claims.Username, err)
+		}
+		loginDetails.Scopes = claims.Granted(a.LegacyFullAccess)
+		return loginDetails, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Identity{LoginDetails: loginDetails, Provider: "token"}, nil
+}
+
+// APIKeyAuthenticator authenticates services by the API keys of Keys in
+// Header, with every scope. A request with a user token from Tokens, even a
+// malformed one, is the user's, so it is left to the authenticators of
+// tokens.
+type APIKeyAuthenticator struct {
+	Header string
+	Tokens TokenSource
+	Keys   *APIKeys
+}
+
+func (a *APIKeyAuthenticator) Authenticate(ctx context.Context, r *http.Request) (*Identity, error) {
+	var key string = r.Header.Get(a.Header)
+	if token, _, err := a.Tokens.Token(r); key == "" || token != "" || err != nil {
+		return nil, ErrNoCredentials
+	}
+
+	loginDetails, err := a.Keys.Verify(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	loginDetails.Scopes = tools.Scopes
+	return &Identity{LoginDetails: loginDetails, Provider: "api_key"}, nil
+}
@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/RashedMaaitah/goapi/internal/config"
+	"github.com/RashedMaaitah/goapi/internal/tools"
+)
+
+// BootstrapUsername is who the bootstrap admin acts as, a name no user can
+// have, so what it does is recorded as its own in the audit log.
+const BootstrapUsername = "bootstrap:admin"
+
+// BootstrapAuthenticator authenticates the token of the bootstrap admin
+// from Source, against the hash of auth.bootstrap_admin in the config in
+// effect in Live, as BootstrapUsername, an admin with every scope. Other
+// tokens are left to the authenticators after it. It is only meant for the
+// admin routes.
+type BootstrapAuthenticator struct {
+	Source TokenSource
+	Live   *config.Live
+}
+
+func (a *BootstrapAuthenticator) Authenticate(ctx context.Context, r *http.Request) (*Identity, error) {
+	var cfg config.BootstrapAdminConfig = a.Live.Get().Auth.BootstrapAdmin
+	if !cfg.Enabled || cfg.TokenHash == "" {
+		return nil, ErrNoCredentials
+	}
+
+	token, _, err := a.Source.Token(r)
+	if err != nil || token == "" {
+		return nil, ErrNoCredentials
+	}
+	if subtle.ConstantTimeCompare([]byte(tools.HashToken(token)), []byte(cfg.TokenHash)) != 1 {
+		return nil, ErrNoCredentials
+	}
+
+	var loginDetails = &tools.LoginDetails{Username: BootstrapUsername, Role: tools.RoleAdmin, Scopes: tools.Scopes}
+	return &Identity{LoginDetails: loginDetails, Provider: "bootstrap"}, nil
+}
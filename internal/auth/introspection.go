@@ -0,0 +1,214 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/config"
+	"github.com/RashedMaaitah/goapi/internal/logging"
+	"github.com/RashedMaaitah/goapi/internal/metrics"
+	"github.com/RashedMaaitah/goapi/internal/tools"
+)
+
+// ErrProviderDown is returned when the identity provider can't say whether
+// a token is active.
+var ErrProviderDown = api.ErrProviderDown
+
+// maxIntrospectionBytes bounds the introspection responses read.
+const maxIntrospectionBytes = 1 << 20
+
+// Introspector authenticates the access tokens of an OAuth2 identity
+// provider, by asking its introspection endpoint about them, as the local
+// users their username claim names. Only active tokens are cached, so a
+// token the provider didn't know yet isn't refused for long.
+//
+// The scopes of a token are those of its scope claim known here; a token
+// without one is treated like the tokens issued before scopes.
+type Introspector struct {
+	cfg              config.IntrospectionConfig
+	source           TokenSource
+	legacyFullAccess bool
+	database         tools.Database
+	client           *http.Client
+	metrics          *metrics.Metrics
+
+	mu      sync.Mutex
+	entries map[string]introspected
+}
+
+// introspected is an active token, of the user and scopes of claims, cached
+// until expires.
+type introspected struct {
+	claims  Claims
+	expires time.Time
+}
+
+// NewIntrospector returns an Introspector of the tokens of requests.
+func NewIntrospector(cfg config.AuthConfig, database tools.Database, m *metrics.Metrics) *Introspector {
+	return &Introspector{
+		cfg:              cfg.Introspection,
+		source:           NewTokenSource(cfg),
+		legacyFullAccess: cfg.LegacyFullAccess,
+		database:         database,
+		client:           &http.Client{Timeout: cfg.Introspection.Timeout.Duration()},
+		metrics:          m,
+		entries:          map[string]introspected{},
+	}
+}
+
+func (i *Introspector) Authenticate(ctx context.Context, r *http.Request) (*Identity, error) {
+	token, _, err := i.source.Token(r)
+	if err != nil {
+		return nil, err
+	}
+	if token == "" {
+		return nil, ErrNoCredentials
+	}
+
+	// Tokens are cached by their hash, so they aren't kept in memory.
+	var hash string = tools.HashToken(token)
+	claims, ok := i.get(hash)
+	if ok {
+		i.metrics.Introspections.Inc("cached")
+	} else {
+		var expires time.Time
+		var err error
+		claims, expires, err = i.introspect(ctx, token)
+		if err != nil {
+			return nil, err
+		}
+		i.put(hash, claims, expires)
+	}
+
+	loginDetails, err := i.database.GetUserLoginDetails(ctx, claims.Username)
+	if err != nil {
+		return nil, err
+	}
+	loginDetails.Scopes = claims.Granted(i.legacyFullAccess)
+	return &Identity{LoginDetails: loginDetails, Provider: "introspection"}, nil
+}
+
+// introspect asks the identity provider about token, and returns its Claims
+// and when it expires, zero if it doesn't say.
+func (i *Introspector) introspect(ctx context.Context, token string) (Claims, time.Time, error) {
+	var form = url.Values{"token": {token}, "token_type_hint": {"access_token"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, i.cfg.URL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Claims{}, time.Time{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if i.cfg.ClientID != "" {
+		req.SetBasicAuth(i.cfg.ClientID, i.cfg.ClientSecret)
+	}
+
+	resp, err := i.client.Do(req)
+	if err != nil {
+		i.metrics.Introspections.Inc("error")
+		return Claims{}, time.Time{}, fmt.Errorf("Introspecting a token: %v: %w", err, ErrProviderDown)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		i.metrics.Introspections.Inc("error")
+		return Claims{}, time.Time{}, fmt.Errorf("Introspecting a token: %s answered %s: %w", i.cfg.URL, resp.Status, ErrProviderDown)
+	}
+
+	var fields map[string]any
+	var decoder = json.NewDecoder(io.LimitReader(resp.Body, maxIntrospectionBytes))
+	decoder.UseNumber()
+	if err = decoder.Decode(&fields); err != nil {
+		i.metrics.Introspections.Inc("error")
+		return Claims{}, time.Time{}, fmt.Errorf("Introspecting a token: decoding the response: %v: %w", err, ErrProviderDown)
+	}
+
+	if active, _ := fields["active"].(bool); !active {
+		i.metrics.Introspections.Inc("inactive")
+		return Claims{}, time.Time{}, ErrInvalidToken
+	}
+	i.metrics.Introspections.Inc("active")
+
+	var expires time.Time
+	if exp, ok := fields["exp"].(json.Number); ok {
+		seconds, err := exp.Int64()
+		if err != nil {
+			return Claims{}, time.Time{}, fmt.Errorf("Introspecting a token: exp %s is not a time: %w", exp, ErrInvalidToken)
+		}
+		expires = time.Unix(seconds, 0)
+		if !time.Now().Before(expires) {
+			return Claims{}, time.Time{}, ErrTokenExpired
+		}
+	}
+
+	username, _ := fields[i.cfg.UsernameClaim].(string)
+	username = api.NormalizeUsername(username)
+	if username == "" {
+		logging.FromContext(ctx).Warnf("Active token without a %s claim", i.cfg.UsernameClaim)
+		return Claims{}, time.Time{}, ErrInvalidToken
+	}
+
+	var claims = Claims{Username: username}
+	if scope, ok := fields["scope"].(string); ok {
+		claims.Scopes = []string{}
+		for _, scope := range strings.Fields(scope) {
+			if slices.Contains(tools.Scopes, scope) {
+				claims.Scopes = append(claims.Scopes, scope)
+			}
+		}
+	}
+	return claims, expires, nil
+}
+
+// get returns the Claims of the token of hash, if it is cached.
+func (i *Introspector) get(hash string) (Claims, bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	entry, ok := i.entries[hash]
+	if !ok || !time.Now().Before(entry.expires) {
+		return Claims{}, false
+	}
+	return entry.claims, true
+}
+
+// put caches the token of hash for the cache TTL, or until expires when
+// that is sooner. When the cache is full the expired entries are dropped,
+// and if none are, an arbitrary one.
+func (i *Introspector) put(hash string, claims Claims, expires time.Time) {
+	if i.cfg.CacheTTL <= 0 {
+		return
+	}
+
+	var now time.Time = time.Now()
+	var until time.Time = now.Add(i.cfg.CacheTTL.Duration())
+	if !expires.IsZero() && expires.Before(until) {
+		until = expires
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if len(i.entries) >= i.cfg.CacheSize {
+		for key, entry := range i.entries {
+			if !now.Before(entry.expires) {
+				delete(i.entries, key)
+			}
+		}
+	}
+	if len(i.entries) >= i.cfg.CacheSize {
+		for key := range i.entries {
+			delete(i.entries, key)
+			break
+		}
+	}
+	i.entries[hash] = introspected{claims: claims, expires: until}
+}
@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// jwtTokens are HS256 signed JWTs carrying the username in the sub claim,
+// and the scopes space separated in the scope claim. Nothing is stored, a
+// token is valid until its exp claim unless it shows up in the revocation
+// list.
+type jwtTokens struct {
+	secret  []byte
+	ttl     time.Duration
+	revoked *revocationList
+}
+
+// jwtClaims are the claims of a token. Scope is missing from the tokens
+// issued before tokens had scopes. IssuedAtNano is the issue time in Unix
+// nanoseconds, as iat has one second precision, missing from the tokens
+// issued before RevokeAll compared it.
+type jwtClaims struct {
+	jwt.RegisteredClaims
+	Scope        *string `json:"scope,omitempty"`
+	IssuedAtNano *int64  `json:"iat_ns,omitempty"`
+}
+
+// issuedAt is when c was issued, as precisely as its claims tell.
+func (c *jwtClaims) issuedAt() time.Time {
+	if c.IssuedAtNano != nil {
+		return time.Unix(0, *c.IssuedAtNano)
+	}
+	return c.IssuedAt.Time
+}
+
+func (t *jwtTokens) Issue(ctx context.Context, username string, scopes []string) (*Token, error) {
+	var now = time.Now().UTC()
+	var issuedAtNano int64 = now.UnixNano()
+	var expiresAt = now.Truncate(time.Second).Add(t.ttl)
+	var scope string = strings.Join(scopes, " ")
+
+	var claims = jwtClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        newToken(),
+			Subject:   username,
+			IssuedAt:  jwt.NewNumericDate(now.Truncate(time.Second)),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+		Scope:        &scope,
+		IssuedAtNano: &issuedAtNano,
+	}
+
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(t.secret)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Token{Value: signed, ExpiresAt: expiresAt, Scopes: scopes}, nil
+}
+
+func (t *jwtTokens) Verify(ctx context.Context, token string) (*Claims, error) {
+	claims, err := t.parse(token)
+	if err != nil {
+		return nil, err
+	}
+
+	var verified = &Claims{Username: claims.Subject}
+	if claims.Scope != nil {
+		verified.Scopes = strings.Fields(*claims.Scope)
+	}
+	return verified, nil
+}
+
+func (t *jwtTokens) Revoke(ctx context.Context, token string) error {
+	claims, err := t.parse(token)
+	if err != nil {
+		return err
+	}
+
+	t.revoked.revokeToken(claims.ID, claims.ExpiresAt.Time)
+	return nil
+}
+
+func (t *jwtTokens) RevokeAll(ctx context.Context, username string) error {
+	t.revoked.revokeUser(username, time.Now().UTC(), t.ttl)
+	return nil
+}
+
+func (t *jwtTokens) parse(token string) (*jwtClaims, error) {
+	var claims = jwtClaims{}
+
+	_, err := jwt.ParseWithClaims(token, &claims, func(*jwt.Token) (any, error) {
+		return t.secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired(), jwt.WithIssuedAt())
+
+	if errors.Is(err, jwt.ErrTokenExpired) {
+		return nil, ErrTokenExpired
+	}
+	if err != nil || claims.Subject == "" || claims.ID == "" || claims.IssuedAt == nil {
+		return nil, ErrInvalidToken
+	}
+
+	if t.revoked.revoked(claims.ID, claims.Subject, claims.issuedAt()) {
+		return nil, ErrInvalidToken
+	}
+	return &claims, nil
+}
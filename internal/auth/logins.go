@@ -0,0 +1,200 @@
+package auth
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/internal/config"
+	"github.com/RashedMaaitah/goapi/internal/metrics"
+	"github.com/RashedMaaitah/goapi/internal/tools"
+)
+
+// LoginCache keeps the LoginDetails of the user of recently used tokens for
+// cfg.TTL, so authenticating a request doesn't take a database call. It
+// holds at most cfg.Size tokens, dropping the least recently used first.
+//
+// Revoking a token, or all of a user's, and changing the password, profile
+// or existence of a user forget the entries involved once done, through the
+// Tokens and the Database it wraps. A lookup that was under way when
+// something was forgotten isn't cached, so it can't bring back what was
+// just revoked. Revocations on other servers are only seen once the
+// entries expire.
+type LoginCache struct {
+	ttl     time.Duration
+	size    int
+	metrics *metrics.Metrics
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+
+	// epoch grows with every forget, telling lookups that raced one.
+	epoch uint64
+}
+
+type loginEntry struct {
+	token        string
+	loginDetails tools.LoginDetails
+	expires      time.Time
+}
+
+func NewLoginCache(cfg config.LoginCacheConfig, m *metrics.Metrics) *LoginCache {
+	return &LoginCache{
+		ttl:     cfg.TTL.Duration(),
+		size:    cfg.Size,
+		metrics: m,
+		order:   list.New(),
+		entries: map[string]*list.Element{},
+	}
+}
+
+// Lookup returns the cached details of the user of token, or those lookup
+// returns, which are cached when it succeeds. A nil LoginCache always calls
+// lookup.
+func (c *LoginCache) Lookup(token string, lookup func() (*tools.LoginDetails, error)) (*tools.LoginDetails, error) {
+	if c == nil {
+		return lookup()
+	}
+
+	loginDetails, epoch, ok := c.get(token)
+	if ok {
+		c.metrics.LoginCacheLookups.Inc("hit")
+		return loginDetails, nil
+	}
+	c.metrics.LoginCacheLookups.Inc("miss")
+
+	loginDetails, err := lookup()
+	if err == nil {
+		c.put(token, loginDetails, epoch)
+	}
+	return loginDetails, err
+}
+
+// get returns a copy of the entry of token, or the epoch to put one in at.
+func (c *LoginCache) get(token string) (*tools.LoginDetails, uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[token]
+	if !ok {
+		return nil, c.epoch, false
+	}
+	var entry *loginEntry = element.Value.(*loginEntry)
+	if !time.Now().Before(entry.expires) {
+		c.remove(element)
+		return nil, c.epoch, false
+	}
+	c.order.MoveToFront(element)
+
+	var loginDetails tools.LoginDetails = entry.loginDetails
+	return &loginDetails, c.epoch, true
+}
+
+// put caches loginDetails for token, unless something was forgotten since
+// epoch.
+func (c *LoginCache) put(token string, loginDetails *tools.LoginDetails, epoch uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.epoch != epoch {
+		return
+	}
+
+	var entry = &loginEntry{token: token, loginDetails: *loginDetails, expires: time.Now().Add(c.ttl)}
+	if element, ok := c.entries[token]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[token] = c.order.PushFront(entry)
+	if c.order.Len() > c.size {
+		c.remove(c.order.Back())
+		c.metrics.LoginCacheEvictions.Inc()
+	}
+}
+
+// remove drops element. c.mu must be held.
+func (c *LoginCache) remove(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.entries, element.Value.(*loginEntry).token)
+}
+
+func (c *LoginCache) forgetToken(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.epoch++
+	if element, ok := c.entries[token]; ok {
+		c.remove(element)
+	}
+}
+
+func (c *LoginCache) forgetUser(username string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.epoch++
+	for element := c.order.Front(); element != nil; {
+		var next *list.Element = element.Next()
+		if element.Value.(*loginEntry).loginDetails.Username == username {
+			c.remove(element)
+		}
+		element = next
+	}
+}
+
+// Tokens returns tokens forgetting the entries of the tokens it revokes.
+func (c *LoginCache) Tokens(tokens Tokens) Tokens {
+	return &cachedTokens{Tokens: tokens, cache: c}
+}
+
+type cachedTokens struct {
+	Tokens
+	cache *LoginCache
+}
+
+// Issue forgets the user's entries too, as a login in single session mode
+// revokes their other tokens.
+func (t *cachedTokens) Issue(ctx context.Context, username string, scopes []string) (*Token, error) {
+	defer t.cache.forgetUser(username)
+	return t.Tokens.Issue(ctx, username, scopes)
+}
+
+func (t *cachedTokens) Revoke(ctx context.Context, token string) error {
+	defer t.cache.forgetToken(token)
+	return t.Tokens.Revoke(ctx, token)
+}
+
+func (t *cachedTokens) RevokeAll(ctx context.Context, username string) error {
+	defer t.cache.forgetUser(username)
+	return t.Tokens.RevokeAll(ctx, username)
+}
+
+// Database returns database forgetting the entries of the users whose
+// LoginDetails it changes.
+func (c *LoginCache) Database(database tools.Database) tools.Database {
+	return &loginCacheDB{Database: database, cache: c}
+}
+
+type loginCacheDB struct {
+	tools.Database
+	cache *LoginCache
+}
+
+func (d *loginCacheDB) UpdateUser(ctx context.Context, username string, update tools.UserUpdate) (*tools.LoginDetails, error) {
+	defer d.cache.forgetUser(username)
+	return d.Database.UpdateUser(ctx, username, update)
+}
+
+func (d *loginCacheDB) UpdatePassword(ctx context.Context, username string, passwordHash string) error {
+	defer d.cache.forgetUser(username)
+	return d.Database.UpdatePassword(ctx, username, passwordHash)
+}
+
+func (d *loginCacheDB) DeleteUser(ctx context.Context, username string) error {
+	defer d.cache.forgetUser(username)
+	return d.Database.DeleteUser(ctx, username)
+}
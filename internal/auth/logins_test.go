@@ -0,0 +1,244 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/internal/config"
+	"github.com/RashedMaaitah/goapi/internal/metrics"
+	"github.com/RashedMaaitah/goapi/internal/tools"
+	log "github.com/sirupsen/logrus"
+)
+
+// gatedDB counts the logins looked up, holding them until gate is closed
+// when it is set.
+type gatedDB struct {
+	tools.Database
+	lookups atomic.Int64
+	gate    chan struct{}
+}
+
+func (d *gatedDB) GetUserLoginDetails(ctx context.Context, username string) (*tools.LoginDetails, error) {
+	d.lookups.Add(1)
+	if d.gate != nil {
+		<-d.gate
+	}
+	return d.Database.GetUserLoginDetails(ctx, username)
+}
+
+// cachedLogins is a TokenAuthenticator of session tokens, through a
+// LoginCache of cfg.
+type cachedLogins struct {
+	*TokenAuthenticator
+	database *gatedDB
+	exporter *metrics.Expvar
+}
+
+func newCachedLogins(t *testing.T, cfg config.LoginCacheConfig) *cachedLogins {
+	var logger = log.New()
+	logger.SetOutput(io.Discard)
+
+	var database = &gatedDB{Database: tools.NewMockDB(logger)}
+	var exporter = metrics.NewExpvar()
+	var cache *LoginCache = NewLoginCache(cfg, metrics.New(exporter))
+	var authCfg config.AuthConfig = config.Default().Auth
+
+	return &cachedLogins{
+		TokenAuthenticator: &TokenAuthenticator{
+			Source:   NewTokenSource(authCfg),
+			Database: cache.Database(database),
+			Tokens:   cache.Tokens(New(authCfg, database)),
+			Logins:   cache,
+		},
+		database: database,
+		exporter: exporter,
+	}
+}
+
+func (l *cachedLogins) issue(t *testing.T, username string) string {
+	t.Helper()
+	token, err := l.Tokens.Issue(context.Background(), username, tools.Scopes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token.Value
+}
+
+func (l *cachedLogins) authenticate(token string) (*Identity, error) {
+	var r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	return l.Authenticate(context.Background(), r)
+}
+
+// count returns the counter l exports as name, of series when it has
+// labels.
+func (l *cachedLogins) count(t *testing.T, name string, series string) float64 {
+	t.Helper()
+	var rec = httptest.NewRecorder()
+	l.exporter.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	var vars map[string]json.RawMessage
+	if err := json.Unmarshal(rec.Body.Bytes(), &vars); err != nil {
+		t.Fatal(err)
+	}
+	if series == "" {
+		var value float64
+		json.Unmarshal(vars[name], &value)
+		return value
+	}
+	var values map[string]float64
+	json.Unmarshal(vars[name], &values)
+	return values[series]
+}
+
+func TestLoginCacheHitsAndMisses(t *testing.T) {
+	var logins = newCachedLogins(t, config.LoginCacheConfig{TTL: config.Duration(time.Minute), Size: 10})
+	var token string = logins.issue(t, "alex")
+
+	for range 3 {
+		identity, err := logins.authenticate(token)
+		if err != nil || identity.LoginDetails.Username != "alex" {
+			t.Fatalf("Authenticate = %+v, %v", identity, err)
+		}
+	}
+	if logins.database.lookups.Load() != 1 {
+		t.Errorf("%d lookups reached the database, want 1", logins.database.lookups.Load())
+	}
+	if hits, misses := logins.count(t, "goapi_auth_cache_lookups_total", "result=hit"), logins.count(t, "goapi_auth_cache_lookups_total", "result=miss"); hits != 2 || misses != 1 {
+		t.Errorf("%v hits and %v misses, want 2 and 1", hits, misses)
+	}
+}
+
+func TestLoginCacheExpiresEntries(t *testing.T) {
+	var logins = newCachedLogins(t, config.LoginCacheConfig{TTL: config.Duration(time.Millisecond), Size: 10})
+	var token string = logins.issue(t, "alex")
+
+	logins.authenticate(token)
+	time.Sleep(5 * time.Millisecond)
+	logins.authenticate(token)
+
+	if logins.database.lookups.Load() != 2 {
+		t.Errorf("%d lookups reached the database, want 2", logins.database.lookups.Load())
+	}
+}
+
+func TestLoginCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	var logins = newCachedLogins(t, config.LoginCacheConfig{TTL: config.Duration(time.Minute), Size: 2})
+	var alex, maria, john = logins.issue(t, "alex"), logins.issue(t, "maria"), logins.issue(t, "john")
+
+	for _, token := range []string{alex, maria, alex, john, alex} {
+		logins.authenticate(token)
+	}
+	if logins.database.lookups.Load() != 3 {
+		t.Errorf("%d lookups reached the database, want 3", logins.database.lookups.Load())
+	}
+	if evictions := logins.count(t, "goapi_auth_cache_evictions_total", ""); evictions != 1 {
+		t.Errorf("%v evictions, want 1", evictions)
+	}
+}
+
+func TestLoginCacheForgets(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		forget func(logins *cachedLogins, token string) error
+		want   error
+	}{
+		{"logout", func(logins *cachedLogins, token string) error {
+			return logins.Tokens.Revoke(context.Background(), token)
+		}, ErrInvalidToken},
+		{"revocation", func(logins *cachedLogins, token string) error {
+			return logins.Tokens.RevokeAll(context.Background(), "alex")
+		}, ErrInvalidToken},
+		{"deletion", func(logins *cachedLogins, token string) error {
+			return logins.Database.DeleteUser(context.Background(), "alex")
+		}, tools.ErrUserNotFound},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var logins = newCachedLogins(t, config.LoginCacheConfig{TTL: config.Duration(time.Minute), Size: 10})
+			var token string = logins.issue(t, "alex")
+			if _, err := logins.authenticate(token); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := tt.forget(logins, token); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := logins.authenticate(token); !errors.Is(err, tt.want) {
+				t.Errorf("Authenticate = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	t.Run("password change", func(t *testing.T) {
+		var logins = newCachedLogins(t, config.LoginCacheConfig{TTL: config.Duration(time.Minute), Size: 10})
+		var token string = logins.issue(t, "alex")
+		logins.authenticate(token)
+
+		if err := logins.Database.UpdatePassword(context.Background(), "alex", "new-hash"); err != nil {
+			t.Fatal(err)
+		}
+		identity, err := logins.authenticate(token)
+		if err != nil || identity.LoginDetails.PasswordHash != "new-hash" {
+			t.Errorf("Authenticate = %+v, %v, want the new password hash", identity, err)
+		}
+	})
+}
+
+func TestLoginCacheRevocationRace(t *testing.T) {
+	var logins = newCachedLogins(t, config.LoginCacheConfig{TTL: config.Duration(time.Minute), Size: 10})
+	var token string = logins.issue(t, "alex")
+	logins.database.gate = make(chan struct{})
+
+	// A lookup verified the token before it is revoked, and gets its user
+	// after.
+	var raced = make(chan error)
+	go func() {
+		_, err := logins.authenticate(token)
+		raced <- err
+	}()
+	for logins.database.lookups.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if err := logins.Tokens.Revoke(context.Background(), token); err != nil {
+		t.Fatal(err)
+	}
+	close(logins.database.gate)
+	if err := <-raced; err != nil {
+		t.Fatalf("the lookup under way failed: %v", err)
+	}
+
+	// What it found wasn't cached.
+	if _, err := logins.authenticate(token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Authenticate after Revoke = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestLoginCacheConcurrentUse(t *testing.T) {
+	var logins = newCachedLogins(t, config.LoginCacheConfig{TTL: config.Duration(time.Minute), Size: 2})
+	var tokens = []string{logins.issue(t, "alex"), logins.issue(t, "maria"), logins.issue(t, "john")}
+
+	var wg sync.WaitGroup
+	for i := range 50 {
+		wg.Go(func() {
+			if i%10 == 0 {
+				logins.Logins.forgetUser("maria")
+				return
+			}
+			identity, err := logins.authenticate(tokens[i%len(tokens)])
+			if err != nil {
+				t.Errorf("Authenticate: %v", err)
+			} else if want := []string{"alex", "maria", "john"}[i%len(tokens)]; identity.LoginDetails.Username != want {
+				t.Errorf("Authenticate of the token of %s = %s", want, identity.LoginDetails.Username)
+			}
+		})
+	}
+	wg.Wait()
+}
@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrWrongPassword = errors.New("wrong password")
+
+// dummyHashes are the DummyHash of every cost, by cost.
+var dummyHashes sync.Map
+
+// DummyHash returns a bcrypt hash of cost no password matches, to compare
+// against when the user does not exist, so that a failed login takes as
+// long either way. It should have the cost of the hashes of the users.
+func DummyHash(cost int) string {
+	if hash, ok := dummyHashes.Load(cost); ok {
+		return hash.(string)
+	}
+
+	var secret = make([]byte, 32)
+	rand.Read(secret)
+	hash, err := bcrypt.GenerateFromPassword(secret, cost)
+	if err != nil {
+		hash, _ = bcrypt.GenerateFromPassword(secret, bcrypt.DefaultCost)
+	}
+	actual, _ := dummyHashes.LoadOrStore(cost, string(hash))
+	return actual.(string)
+}
+
+func HashPassword(password string, cost int) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), cost)
+	return string(hash), err
+}
+
+// CheckPassword compares password to hash. An empty hash stands for an
+// unknown user and always fails, after the work of a hash of cost, the
+// cost the hashes of the users are made with. Stored values that are not
+// bcrypt hashes are legacy plaintext passwords.
+func CheckPassword(hash string, password string, cost int) error {
+	if hash == "" {
+		bcrypt.CompareHashAndPassword([]byte(DummyHash(cost)), []byte(password))
+		return ErrWrongPassword
+	}
+
+	if !isBcrypt(hash) {
+		if subtle.ConstantTimeCompare([]byte(hash), []byte(password)) != 1 {
+			return ErrWrongPassword
+		}
+		return nil
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+		return ErrWrongPassword
+	}
+	return nil
+}
+
+// NeedsRehash reports whether hash should be replaced after a successful
+// login: plaintext passwords, and hashes made with another cost.
+func NeedsRehash(hash string, cost int) bool {
+	if !isBcrypt(hash) {
+		return true
+	}
+
+	current, err := bcrypt.Cost([]byte(hash))
+	return err != nil || current != cost
+}
+
+func isBcrypt(hash string) bool {
+	return strings.HasPrefix(hash, "$2")
+}
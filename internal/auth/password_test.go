@@ -0,0 +1,24 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestCheckPasswordOfUnknownUserCostsTheConfiguredCost(t *testing.T) {
+	const cost = bcrypt.MinCost + 1
+
+	if err := CheckPassword("", "password", cost); !errors.Is(err, ErrWrongPassword) {
+		t.Fatalf("CheckPassword of no hash = %v, want %v", err, ErrWrongPassword)
+	}
+
+	hash, ok := dummyHashes.Load(cost)
+	if !ok {
+		t.Fatalf("no dummy hash of cost %d was compared against", cost)
+	}
+	if got, err := bcrypt.Cost([]byte(hash.(string))); err != nil || got != cost {
+		t.Errorf("cost of the dummy hash = %d, %v, want %d", got, err, cost)
+	}
+}
@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// revocationList remembers revoked JWTs until they would have expired on
+// their own, after which the exp claim rejects them anyway. It lives in
+// memory, so revocations do not survive a restart.
+type revocationList struct {
+	mu sync.Mutex
+
+	// tokens maps token IDs (jti) to their expiry.
+	tokens map[string]time.Time
+
+	// users maps usernames to the time RevokeAll was called, tokens issued
+	// up to then are revoked, and to when that entry can be dropped. Tokens
+	// are compared by their iat_ns, so one issued right after the revocation
+	// is valid. Those without it, with iat alone, are revoked through the
+	// end of the second of the revocation.
+	users map[string]userRevocation
+}
+
+type userRevocation struct {
+	at      time.Time
+	expires time.Time
+}
+
+func newRevocationList() *revocationList {
+	return &revocationList{tokens: map[string]time.Time{}, users: map[string]userRevocation{}}
+}
+
+func (l *revocationList) revokeToken(id string, expires time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(time.Now())
+	l.tokens[id] = expires
+}
+
+func (l *revocationList) revokeUser(username string, at time.Time, ttl time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(at)
+	l.users[username] = userRevocation{at: at, expires: at.Add(ttl)}
+}
+
+func (l *revocationList) revoked(id string, username string, issuedAt time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.tokens[id]; ok {
+		return true
+	}
+
+	user, ok := l.users[username]
+	return ok && !issuedAt.After(user.at)
+}
+
+// sweep drops the entries of tokens that have expired. l.mu must be held.
+func (l *revocationList) sweep(now time.Time) {
+	for id, expires := range l.tokens {
+		if !now.Before(expires) {
+			delete(l.tokens, id)
+		}
+	}
+	for username, user := range l.users {
+		if !now.Before(user.expires) {
+			delete(l.users, username)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/RashedMaaitah/goapi/internal/tools"
+)
+
+// ScopeError is a scope asked of a token that can't be granted: Unknown
+// when there is no such scope, or one its user doesn't hold.
+type ScopeError struct {
+	Scope   string
+	Unknown bool
+}
+
+func (e *ScopeError) Error() string {
+	if e.Unknown {
+		return fmt.Sprintf("Unknown scope %q.", e.Scope)
+	}
+	return fmt.Sprintf("This requires the %s scope.", e.Scope)
+}
+
+// GrantScopes returns the scopes of a token asked for scopes by a user
+// holding held: all of held when scopes is empty, or a *ScopeError for the
+// first one that can't be granted.
+func GrantScopes(scopes []string, held []string) ([]string, error) {
+	if len(scopes) == 0 {
+		return slices.Clone(held), nil
+	}
+
+	var granted []string
+	for _, scope := range scopes {
+		switch {
+		case !slices.Contains(tools.Scopes, scope):
+			return nil, &ScopeError{Scope: scope, Unknown: true}
+		case !slices.Contains(held, scope):
+			return nil, &ScopeError{Scope: scope}
+		case !slices.Contains(granted, scope):
+			granted = append(granted, scope)
+		}
+	}
+	return granted, nil
+}
+
+// Granted returns the scopes a token of c grants. Those issued before
+// tokens had scopes grant all of them with legacyFullAccess, none without.
+func (c *Claims) Granted(legacyFullAccess bool) []string {
+	switch {
+	case c.Scopes != nil:
+		return c.Scopes
+	case legacyFullAccess:
+		return tools.Scopes
+	default:
+		return []string{}
+	}
+}
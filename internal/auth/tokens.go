@@ -0,0 +1,193 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/config"
+	"github.com/RashedMaaitah/goapi/internal/tools"
+)
+
+var (
+	ErrInvalidToken      = api.ErrInvalidToken
+	ErrTokenExpired      = api.ErrTokenExpired
+	ErrMalformedAuth     = api.ErrMalformedAuth
+	ErrConflictingTokens = api.ErrConflictingTokens
+)
+
+type Token struct {
+	Value     string
+	ExpiresAt time.Time
+	Scopes    []string
+}
+
+// Claims are what a valid token says: the user it was issued to, and the
+// scopes it grants, nil for tokens issued before tokens had scopes.
+type Claims struct {
+	Username string
+	Scopes   []string
+}
+
+// Tokens issues auth tokens and verifies the ones presented by clients.
+type Tokens interface {
+	// Issue returns a token of username granting scopes, which must not be
+	// nil.
+	Issue(ctx context.Context, username string, scopes []string) (*Token, error)
+
+	// Verify returns the Claims of a token, or ErrInvalidToken or
+	// ErrTokenExpired.
+	Verify(ctx context.Context, token string) (*Claims, error)
+
+	// Revoke invalidates a single token, ErrInvalidToken if it is not valid
+	// to begin with.
+	Revoke(ctx context.Context, token string) error
+
+	// RevokeAll invalidates every token issued to username so far.
+	RevokeAll(ctx context.Context, username string) error
+}
+
+// New returns the Tokens implementation selected by cfg.Mode.
+func New(cfg config.AuthConfig, database tools.Database) Tokens {
+	if cfg.Mode == "jwt" {
+		return &jwtTokens{
+			secret:  []byte(cfg.JWTSecret),
+			ttl:     cfg.TokenTTL.Duration(),
+			revoked: newRevocationList(),
+		}
+	}
+
+	return &sessionTokens{
+		database: database,
+		ttl:      cfg.TokenTTL.Duration(),
+		single:   cfg.SingleSession(),
+	}
+}
+
+// sessionTokens are random tokens stored as sessions in the database.
+type sessionTokens struct {
+	database tools.Database
+	ttl      time.Duration
+	single   bool
+}
+
+// Issue stores only the hash of the token, which the other methods look
+// sessions up by.
+func (t *sessionTokens) Issue(ctx context.Context, username string, scopes []string) (*Token, error) {
+	var token string = newToken()
+	var session = tools.Session{
+		Token:     tools.HashToken(token),
+		Username:  username,
+		ExpiresAt: time.Now().Add(t.ttl).UTC().Truncate(time.Second),
+		Scopes:    scopes,
+	}
+
+	if err := t.database.CreateSession(ctx, session, t.single); err != nil {
+		return nil, err
+	}
+
+	return &Token{Value: token, ExpiresAt: session.ExpiresAt, Scopes: scopes}, nil
+}
+
+func (t *sessionTokens) Verify(ctx context.Context, token string) (*Claims, error) {
+	var hash string = tools.HashToken(token)
+	session, err := t.database.GetSession(ctx, hash)
+
+	if errors.Is(err, tools.ErrSessionNotFound) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	// In case the store matched loosely, such as ignoring case.
+	if subtle.ConstantTimeCompare([]byte(session.Token), []byte(hash)) != 1 {
+		return nil, ErrInvalidToken
+	}
+
+	if session.Expired(time.Now()) {
+		return nil, ErrTokenExpired
+	}
+	return &Claims{Username: session.Username, Scopes: session.Scopes}, nil
+}
+
+func (t *sessionTokens) Revoke(ctx context.Context, token string) error {
+	var err error = t.database.DeleteSession(ctx, tools.HashToken(token))
+	if errors.Is(err, tools.ErrSessionNotFound) {
+		return ErrInvalidToken
+	}
+	return err
+}
+
+func (t *sessionTokens) RevokeAll(ctx context.Context, username string) error {
+	return t.database.DeleteUserSessions(ctx, username)
+}
+
+// newToken returns 256 random bits. rand.Read never fails.
+func newToken() string {
+	var b = make([]byte, 32)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// TokenSource is where requests carry their token: an "Authorization:
+// Bearer" header or, when Legacy is set, Header as it is, the way tokens
+// were sent before.
+type TokenSource struct {
+	Header string
+	Legacy bool
+}
+
+func NewTokenSource(cfg config.AuthConfig) TokenSource {
+	return TokenSource{Header: cfg.TokenHeader, Legacy: cfg.LegacyTokens}
+}
+
+// Token returns the token of r, "" when it has none, and whether it was sent
+// the legacy way.
+func (s TokenSource) Token(r *http.Request) (string, bool, error) {
+	return s.FromValues(r.Header.Get("Authorization"), r.Header.Get(s.Header))
+}
+
+// FromValues is Token for the values of the Authorization and the legacy
+// headers, wherever they come from. An Authorization header other than a
+// Bearer one is ErrMalformedAuth, and a token in both headers has to be
+// the same one, or it is ErrConflictingTokens.
+func (s TokenSource) FromValues(authorization string, legacy string) (string, bool, error) {
+	var legacyAuthorization bool = s.Legacy && strings.EqualFold(s.Header, "Authorization")
+
+	var bearer string
+	if authorization = strings.TrimSpace(authorization); authorization != "" {
+		scheme, credentials, _ := strings.Cut(authorization, " ")
+		switch {
+		case strings.EqualFold(scheme, bearerScheme):
+			if bearer = strings.TrimSpace(credentials); bearer == "" {
+				return "", false, ErrMalformedAuth
+			}
+		case legacyAuthorization && credentials == "":
+			return authorization, true, nil
+		default:
+			return "", false, ErrMalformedAuth
+		}
+	}
+
+	if legacy = strings.TrimSpace(legacy); !s.Legacy || legacyAuthorization || legacy == "" {
+		return bearer, false, nil
+	}
+	if scheme, credentials, ok := strings.Cut(legacy, " "); ok && strings.EqualFold(scheme, bearerScheme) {
+		legacy = strings.TrimSpace(credentials)
+	}
+	if bearer != "" && bearer != legacy {
+		return "", false, ErrConflictingTokens
+	}
+	if bearer != "" {
+		return bearer, false, nil
+	}
+	return legacy, true, nil
+}
+
+const bearerScheme = "Bearer"
@@ -0,0 +1,128 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Reloadable lists the settings Live.Reload may change, by their path in
+// the config file; a section stands for every setting in it. Any other
+// change needs a restart.
+var Reloadable = []string{
+	"log.level",
+	"log.format",
+	"auth.bootstrap_admin",
+	"rate_limit.enabled",
+	"rate_limit.requests_per_second",
+	"rate_limit.burst",
+	"rate_limit.per_user",
+	"rate_limit.admin",
+	"maintenance",
+	"webhooks.max_attempts",
+	"webhooks.initial_backoff",
+	"webhooks.timeout",
+	"webhooks.delivery_retention",
+}
+
+// Live is the config in effect, replaced as a whole by Reload. What reads
+// a Reloadable setting reads it from Get every time, not from a copy kept
+// since startup.
+type Live struct {
+	current atomic.Pointer[Config]
+
+	// mu serializes Reload and guards hooks.
+	mu    sync.Mutex
+	hooks []func(old, next *Config)
+}
+
+func NewLive(cfg *Config) *Live {
+	var l = &Live{}
+	l.current.Store(cfg)
+	return l
+}
+
+// Get returns the config in effect, which must not be changed.
+func (l *Live) Get() *Config {
+	return l.current.Load()
+}
+
+// OnReload calls hook after every Reload that changed anything, for what
+// can't read its settings from Get, such as the level of a logger.
+func (l *Live) OnReload(hook func(old, next *Config)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.hooks = append(l.hooks, hook)
+}
+
+// Reload makes next the config in effect and returns the settings that
+// changed. If next is invalid or changes a setting that isn't Reloadable
+// it returns why, and the config in effect stays the same.
+func (l *Live) Reload(next *Config) ([]string, error) {
+	if err := next.Validate(); err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var old *Config = l.current.Load()
+	var changed []string = Changed(old, next)
+
+	var fixed []string
+	for _, path := range changed {
+		if !reloadable(path) {
+			fixed = append(fixed, path)
+		}
+	}
+	if len(fixed) > 0 {
+		return nil, fmt.Errorf("%s can't change without a restart", strings.Join(fixed, ", "))
+	}
+	if len(changed) == 0 {
+		return nil, nil
+	}
+
+	l.current.Store(next)
+	for _, hook := range l.hooks {
+		hook(old, next)
+	}
+	return changed, nil
+}
+
+func reloadable(path string) bool {
+	return slices.ContainsFunc(Reloadable, func(p string) bool {
+		return path == p || strings.HasPrefix(path, p+".")
+	})
+}
+
+// Changed returns the paths of the settings that differ between a and b.
+func Changed(a, b *Config) []string {
+	return changed("", reflect.ValueOf(*a), reflect.ValueOf(*b))
+}
+
+func changed(prefix string, a, b reflect.Value) []string {
+	// Sections are the structs of this package; others, such as time.Time,
+	// are settings.
+	if a.Kind() != reflect.Struct || a.Type().PkgPath() != reflect.TypeFor[Config]().PkgPath() {
+		if reflect.DeepEqual(a.Interface(), b.Interface()) {
+			return nil
+		}
+		return []string{prefix}
+	}
+
+	var paths []string
+	for i := range a.NumField() {
+		var name string = strings.Split(a.Type().Field(i).Tag.Get("yaml"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		paths = append(paths, changed(name, a.Field(i), b.Field(i))...)
+	}
+	return paths
+}
@@ -0,0 +1,312 @@
+package config
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Load resolves the configuration from the defaults, an optional config
+// file, the GOAPI_* environment variables and the command line flags, in
+// increasing order of precedence.
+func Load(args []string) (*Config, error) {
+	var (
+		configPath string
+		addr       string
+		port       int
+		grpcPort   int
+		socket     string
+		tlsCert    string
+		tlsKey     string
+		logLevel   string
+		logFormat  string
+		debug      bool
+		seed       string
+		seedEmpty  bool
+		migrate    bool
+		runJob     string
+		lazyDB     bool
+	)
+
+	var fs *flag.FlagSet = flag.NewFlagSet("goapi", flag.ContinueOnError)
+	fs.StringVar(&configPath, "config", os.Getenv("GOAPI_CONFIG"), "path to a YAML or JSON config file (env GOAPI_CONFIG)")
+	fs.StringVar(&addr, "addr", "", "address to listen on (env GOAPI_ADDR)")
+	fs.IntVar(&port, "port", 0, "port to listen on (env GOAPI_PORT)")
+	fs.StringVar(&socket, "socket", "", "Unix socket to serve the API on too (env GOAPI_SOCKET)")
+	fs.IntVar(&grpcPort, "grpc-port", 0, "port of the gRPC listener, 0 disables it (env GOAPI_GRPC_PORT)")
+	fs.StringVar(&tlsCert, "tls-cert", "", "TLS certificate file (env GOAPI_TLS_CERT)")
+	fs.StringVar(&tlsKey, "tls-key", "", "TLS private key file (env GOAPI_TLS_KEY)")
+	fs.StringVar(&logLevel, "log-level", "", "log level: trace, debug, info, warn, error (env GOAPI_LOG_LEVEL)")
+	fs.StringVar(&logFormat, "log-format", "", "log format: text or json (env GOAPI_LOG_FORMAT)")
+	fs.BoolVar(&debug, "debug", false, "serve pprof under /debug/pprof (env GOAPI_DEBUG)")
+	fs.StringVar(&seed, "seed", "", "JSON or YAML file of users to create at startup (env GOAPI_DB_SEED)")
+	fs.BoolVar(&seedEmpty, "seed-if-empty", false, "only seed a database without users")
+	fs.BoolVar(&migrate, "migrate-only", false, "apply the database migrations and exit")
+	fs.StringVar(&runJob, "run-job", "", "run the background job of that name once and exit, such as accrual")
+	fs.BoolVar(&lazyDB, "lazy-db", false, "start even if the database can't be reached yet")
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	var cfg Config = Default()
+
+	if configPath != "" {
+		if err := loadFile(configPath, &cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := applyEnv(&cfg); err != nil {
+		return nil, err
+	}
+
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "addr":
+			cfg.Server.Addr = addr
+		case "port":
+			cfg.Server.Port = port
+		case "socket":
+			cfg.Server.Socket.Path = socket
+		case "grpc-port":
+			cfg.Server.GRPCPort = grpcPort
+		case "tls-cert":
+			cfg.Server.TLS.CertFile = tlsCert
+		case "tls-key":
+			cfg.Server.TLS.KeyFile = tlsKey
+		case "log-level":
+			cfg.Log.Level = logLevel
+		case "log-format":
+			cfg.Log.Format = logFormat
+		case "debug":
+			cfg.Debug = debug
+		case "seed":
+			cfg.Database.Seed = seed
+		case "seed-if-empty":
+			cfg.Database.SeedIfEmpty = seedEmpty
+		case "migrate-only":
+			cfg.MigrateOnly = migrate
+		case "run-job":
+			cfg.RunJob = runJob
+		case "lazy-db":
+			cfg.Database.Lazy = lazyDB
+		}
+	})
+
+	if err := readSecrets(&cfg); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
+
+// readSecrets reads the secrets kept in files of their own, such as
+// mounted secrets, which are read again on every load.
+func readSecrets(cfg *Config) error {
+	var bootstrap *BootstrapAdminConfig = &cfg.Auth.BootstrapAdmin
+	if bootstrap.TokenFile == "" {
+		return nil
+	}
+	if bootstrap.TokenHash != "" {
+		return errors.New("auth.bootstrap_admin: token_file can't be set with token_hash or GOAPI_BOOTSTRAP_ADMIN_TOKEN")
+	}
+
+	data, err := os.ReadFile(bootstrap.TokenFile)
+	if err != nil {
+		return fmt.Errorf("auth.bootstrap_admin.token_file: %w", err)
+	}
+	var token string = strings.TrimSpace(string(data))
+	if token == "" {
+		return fmt.Errorf("auth.bootstrap_admin.token_file: %s is empty", bootstrap.TokenFile)
+	}
+	bootstrap.TokenHash = hashToken(token)
+	return nil
+}
+
+// hashToken hashes token like tools.HashToken, which this package can't
+// import.
+func hashToken(token string) string {
+	var sum = sha256.Sum256([]byte(token))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// loadFile decodes the file at path on top of cfg, so that fields missing
+// from the file keep their current values. Unknown keys are rejected.
+func loadFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		var decoder *yaml.Decoder = yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		err = decoder.Decode(cfg)
+	case ".json":
+		var decoder *json.Decoder = json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(cfg)
+	default:
+		return fmt.Errorf("config file %s: unsupported extension, use .yaml, .yml or .json", path)
+	}
+
+	// An empty file is valid and leaves the defaults untouched.
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	return nil
+}
+
+func applyEnv(cfg *Config) error {
+	if v, ok := os.LookupEnv("GOAPI_ADDR"); ok {
+		cfg.Server.Addr = v
+	}
+
+	if v, ok := os.LookupEnv("GOAPI_PORT"); ok {
+		p, err := parsePort(v)
+		if err != nil {
+			return fmt.Errorf("GOAPI_PORT: %w", err)
+		}
+		cfg.Server.Port = p
+	}
+
+	if v, ok := os.LookupEnv("GOAPI_SOCKET"); ok {
+		cfg.Server.Socket.Path = v
+	}
+
+	if v, ok := os.LookupEnv("GOAPI_GRPC_PORT"); ok {
+		p, err := parsePort(v)
+		if err != nil {
+			return fmt.Errorf("GOAPI_GRPC_PORT: %w", err)
+		}
+		cfg.Server.GRPCPort = p
+	}
+
+	if v, ok := os.LookupEnv("GOAPI_TLS_CERT"); ok {
+		cfg.Server.TLS.CertFile = v
+	}
+
+	if v, ok := os.LookupEnv("GOAPI_TLS_KEY"); ok {
+		cfg.Server.TLS.KeyFile = v
+	}
+
+	if v, ok := os.LookupEnv("GOAPI_LOG_LEVEL"); ok {
+		cfg.Log.Level = v
+	}
+
+	if v, ok := os.LookupEnv("GOAPI_LOG_FORMAT"); ok {
+		cfg.Log.Format = v
+	}
+
+	if v, ok := os.LookupEnv("GOAPI_ACCESS_LOG"); ok {
+		cfg.Log.Access.Sink = v
+	}
+
+	if v, ok := os.LookupEnv("GOAPI_ACCESS_LOG_PATH"); ok {
+		cfg.Log.Access.Path = v
+	}
+
+	if v, ok := os.LookupEnv("GOAPI_METRICS_EXPORTER"); ok {
+		cfg.Metrics.Exporter = v
+	}
+
+	if v, ok := os.LookupEnv("GOAPI_STATSD_ADDR"); ok {
+		cfg.Metrics.Statsd.Addr = v
+	}
+
+	if v, ok := os.LookupEnv("GOAPI_DB_DRIVER"); ok {
+		cfg.Database.Driver = v
+	}
+
+	if v, ok := os.LookupEnv("GOAPI_DB_DSN"); ok {
+		cfg.Database.DSN = v
+	}
+
+	if v, ok := os.LookupEnv("GOAPI_DB_PATH"); ok {
+		cfg.Database.Path = v
+	}
+
+	if v, ok := os.LookupEnv("GOAPI_DB_NAME"); ok {
+		cfg.Database.Name = v
+	}
+
+	if v, ok := os.LookupEnv("GOAPI_DB_SNAPSHOT"); ok {
+		cfg.Database.Snapshot = v
+	}
+
+	if v, ok := os.LookupEnv("GOAPI_DB_SEED"); ok {
+		cfg.Database.Seed = v
+	}
+
+	if v, ok := os.LookupEnv("GOAPI_REDIS_ADDR"); ok {
+		cfg.Cache.RedisAddr = v
+	}
+
+	if v, ok := os.LookupEnv("GOAPI_REDIS_PASSWORD"); ok {
+		cfg.Cache.RedisPassword = v
+	}
+
+	if v, ok := os.LookupEnv("GOAPI_DEBUG"); ok {
+		debug, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("GOAPI_DEBUG: %q is not a boolean", v)
+		}
+		cfg.Debug = debug
+	}
+
+	if v, ok := os.LookupEnv("GOAPI_MAINTENANCE"); ok {
+		maintenance, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("GOAPI_MAINTENANCE: %q is not a boolean", v)
+		}
+		cfg.Maintenance.Enabled = maintenance
+	}
+
+	if v, ok := os.LookupEnv("GOAPI_ADMIN_TOKEN"); ok {
+		cfg.Auth.AdminToken = v
+	}
+
+	if v, ok := os.LookupEnv("GOAPI_BOOTSTRAP_ADMIN_TOKEN"); ok {
+		cfg.Auth.BootstrapAdmin.TokenHash = hashToken(v)
+	}
+
+	if v, ok := os.LookupEnv("GOAPI_BOOTSTRAP_ADMIN_TOKEN_FILE"); ok {
+		cfg.Auth.BootstrapAdmin.TokenFile = v
+	}
+
+	if v, ok := os.LookupEnv("GOAPI_AUTH_MODE"); ok {
+		cfg.Auth.Mode = v
+	}
+
+	if v, ok := os.LookupEnv("GOAPI_JWT_SECRET"); ok {
+		cfg.Auth.JWTSecret = v
+	}
+
+	if v, ok := os.LookupEnv("GOAPI_CURSOR_SECRET"); ok {
+		cfg.API.CursorSecret = v
+	}
+
+	if v, ok := os.LookupEnv("GOAPI_INTROSPECTION_CLIENT_SECRET"); ok {
+		cfg.Auth.Introspection.ClientSecret = v
+	}
+
+	return nil
+}
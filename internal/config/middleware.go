@@ -0,0 +1,104 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+)
+
+// The route groups of the API.
+const (
+	// GroupOps are the probes, /version, the metrics and the profiler.
+	GroupOps = "ops"
+	// GroupPublic are the routes anyone may call, such as login and the
+	// docs.
+	GroupPublic = "public"
+	// GroupAuthenticated are the routes of a user, under /account and
+	// /users/{username}.
+	GroupAuthenticated = "authenticated"
+	// GroupAdmin are the routes of admins, under /admin.
+	GroupAdmin = "admin"
+	// GroupStreaming are the long-lived routes: the WebSocket and the
+	// balance stream.
+	GroupStreaming = "streaming"
+)
+
+// The middleware a route group may have, by name.
+const (
+	MiddlewareRecoverer      = "recoverer"
+	MiddlewareTimeout        = "timeout"
+	MiddlewareCompress       = "compress"
+	MiddlewareRateLimit      = "rate_limit"
+	MiddlewareAdminRateLimit = "admin_rate_limit"
+	MiddlewareMaintenance    = "maintenance"
+	MiddlewareConcurrency    = "concurrency_limit"
+	MiddlewareValidate       = "validate"
+	MiddlewareAuthorize      = "authorize"
+	MiddlewareUserRateLimit  = "user_rate_limit"
+)
+
+var middlewares = []string{
+	MiddlewareRecoverer,
+	MiddlewareTimeout,
+	MiddlewareCompress,
+	MiddlewareRateLimit,
+	MiddlewareAdminRateLimit,
+	MiddlewareMaintenance,
+	MiddlewareConcurrency,
+	MiddlewareValidate,
+	MiddlewareAuthorize,
+	MiddlewareUserRateLimit,
+}
+
+// MiddlewareConfig is the middleware of each route group, by name, in the
+// order requests go through it. Middleware the rest of the config turns
+// off, such as timeout with a server.request_timeout of 0, is left out.
+// The groups of users and admins have to authorize, the others can't.
+type MiddlewareConfig struct {
+	Ops           []string `json:"ops" yaml:"ops"`
+	Public        []string `json:"public" yaml:"public"`
+	Authenticated []string `json:"authenticated" yaml:"authenticated"`
+	Admin         []string `json:"admin" yaml:"admin"`
+	Streaming     []string `json:"streaming" yaml:"streaming"`
+}
+
+// RouteGroup is a route group and its chain of middleware.
+type RouteGroup struct {
+	Name  string
+	Chain []string
+}
+
+// Groups returns the route groups with their chains.
+func (c MiddlewareConfig) Groups() []RouteGroup {
+	return []RouteGroup{
+		{GroupOps, c.Ops},
+		{GroupPublic, c.Public},
+		{GroupAuthenticated, c.Authenticated},
+		{GroupAdmin, c.Admin},
+		{GroupStreaming, c.Streaming},
+	}
+}
+
+func (c MiddlewareConfig) validate() []error {
+	var errs []error
+	for _, group := range c.Groups() {
+		var authorizes bool = group.Name == GroupAuthenticated || group.Name == GroupAdmin || group.Name == GroupStreaming
+
+		for i, name := range group.Chain {
+			switch {
+			case !slices.Contains(middlewares, name):
+				errs = append(errs, fmt.Errorf("middleware.%s: unknown middleware %q", group.Name, name))
+			case slices.Index(group.Chain, name) != i:
+				errs = append(errs, fmt.Errorf("middleware.%s: %s is listed twice", group.Name, name))
+			case !authorizes && (name == MiddlewareAuthorize || name == MiddlewareUserRateLimit):
+				errs = append(errs, fmt.Errorf("middleware.%s: %s is only for the authenticated, admin and streaming routes", group.Name, name))
+			case name == MiddlewareUserRateLimit && !slices.Contains(group.Chain[:i], MiddlewareAuthorize):
+				errs = append(errs, fmt.Errorf("middleware.%s: %s must come after %s", group.Name, name, MiddlewareAuthorize))
+			}
+		}
+
+		if authorizes && !slices.Contains(group.Chain, MiddlewareAuthorize) {
+			errs = append(errs, fmt.Errorf("middleware.%s: must include %s", group.Name, MiddlewareAuthorize))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,121 @@
+// Package events is an in-process publish/subscribe bus for balance
+// changes. The write paths publish to it; streams to clients and the
+// webhook dispatcher subscribe.
+package events
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// Event describes one change to the balance of Username.
+type Event struct {
+	ID        string
+	Type      string
+	Username  string
+	Currency  string
+	Amount    int64 `json:",string"`
+	Balance   int64 `json:",string"`
+	Timestamp time.Time
+}
+
+// Bus delivers every published event to the subscribers of its user and
+// to those of all users. It never blocks a publisher: a subscriber whose
+// buffer is full misses the event.
+type Bus struct {
+	mu          sync.RWMutex
+	subscribers map[*Subscription]struct{}
+
+	done     chan struct{}
+	doneOnce sync.Once
+}
+
+// Subscription receives events on C until Close is called.
+type Subscription struct {
+	C <-chan Event
+
+	bus      *Bus
+	c        chan Event
+	username string
+	dropped  int
+}
+
+func NewBus() *Bus {
+	return &Bus{
+		subscribers: map[*Subscription]struct{}{},
+		done:        make(chan struct{}),
+	}
+}
+
+// Subscribe returns a subscription to the events of username, or of every
+// user when username is empty, buffering up to size events.
+func (b *Bus) Subscribe(username string, size int) *Subscription {
+	var c = make(chan Event, size)
+	var sub = &Subscription{C: c, bus: b, c: c, username: username}
+
+	b.mu.Lock()
+	b.subscribers[sub] = struct{}{}
+	b.mu.Unlock()
+
+	return sub
+}
+
+// Close unsubscribes and closes C. It is safe to call more than once.
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+
+	if _, ok := s.bus.subscribers[s]; ok {
+		delete(s.bus.subscribers, s)
+		close(s.c)
+	}
+}
+
+// Dropped returns how many events did not fit in the buffer.
+func (s *Subscription) Dropped() int {
+	s.bus.mu.RLock()
+	defer s.bus.mu.RUnlock()
+	return s.dropped
+}
+
+// Publish fills in the ID and Timestamp of event if they are empty and
+// hands it to the subscribers.
+func (b *Bus) Publish(event Event) {
+	if event.ID == "" {
+		var id = make([]byte, 16)
+		rand.Read(id)
+		event.ID = hex.EncodeToString(id)
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now().UTC()
+	}
+
+	// The write lock also guards dropped and keeps Close from closing a
+	// channel while it is sent to.
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for sub := range b.subscribers {
+		if sub.username != "" && sub.username != event.Username {
+			continue
+		}
+		select {
+		case sub.c <- event:
+		default:
+			sub.dropped++
+		}
+	}
+}
+
+// Shutdown tells long-lived subscribers such as client streams to finish,
+// see Done. Publishing keeps working for the rest.
+func (b *Bus) Shutdown() {
+	b.doneOnce.Do(func() { close(b.done) })
+}
+
+// Done is closed by Shutdown.
+func (b *Bus) Done() <-chan struct{} {
+	return b.done
+}
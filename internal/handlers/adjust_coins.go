@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/config"
+	"github.com/RashedMaaitah/goapi/internal/events"
+	"github.com/RashedMaaitah/goapi/internal/logging"
+	"github.com/RashedMaaitah/goapi/internal/middleware"
+	"github.com/RashedMaaitah/goapi/internal/tools"
+)
+
+var InvalidAmountError = errors.New("Amount must be a positive integer.")
+
+func DepositCoins(cfg config.APIConfig, database tools.Database, bus *events.Bus) http.HandlerFunc {
+	return adjustCoins(cfg, database, bus, 1)
+}
+
+func WithdrawCoins(cfg config.APIConfig, database tools.Database, bus *events.Bus) http.HandlerFunc {
+	return adjustCoins(cfg, database, bus, -1)
+}
+
+// adjustCoins changes the balance of the authenticated user by the requested
+// amount, multiplied by sign.
+func adjustCoins(cfg config.APIConfig, database tools.Database, bus *events.Bus, sign int64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var logger = logging.FromContext(r.Context())
+		var params = api.CoinAmountParams{}
+		var err error
+
+		err = api.ReadJSON(w, r, &params)
+
+		if err != nil {
+			logger.Error(err)
+			api.BodyErrorHandler(w, err)
+			return
+		}
+
+		if params.Amount <= 0 {
+			logger.Error(InvalidAmountError)
+			api.RequestErrorHandler(w, InvalidAmountError)
+			return
+		}
+
+		var currency string
+		currency, err = resolveCurrency(cfg, params.Currency)
+
+		if err != nil {
+			api.RequestErrorHandler(w, err)
+			return
+		}
+
+		var username string = middleware.GetLoginDetails(r.Context()).Username
+		var delta int64 = sign * int64(params.Amount)
+
+		var coinDetails *tools.CoinDetails
+		err = retryOnConflict(func() error {
+			current, err := database.GetUserCoins(r.Context(), username)
+			if err != nil {
+				return err
+			}
+
+			var updateErr error
+			coinDetails, updateErr = database.AdjustUserCoins(r.Context(), username, currency, delta, current.Version)
+			return updateErr
+		})
+
+		if err != nil {
+			api.WriteErr(w, fmt.Errorf("Adjustment of %s of %s by %d: %w", currency, username, delta, err))
+			return
+		}
+
+		logger.Infof("Adjusted %s of %s by %d, balance is now %d", currency, username, delta, coinDetails.Balance(currency))
+
+		var event string = tools.TransactionDeposit
+		if sign < 0 {
+			event = tools.TransactionWithdrawal
+		}
+		bus.Publish(events.Event{
+			Type:     event,
+			Username: username,
+			Currency: currency,
+			Amount:   int64(params.Amount),
+			Balance:  coinDetails.Balance(currency),
+		})
+
+		var response = api.CoinBalanceResponse{
+			Balance:  api.Amount(coinDetails.Balance(currency)),
+			Currency: currency,
+			Balances: api.Amounts(coinDetails.AllBalances()),
+		}
+		if cfg.StatusCodeInBody {
+			response.StatusCode = http.StatusOK
+		}
+
+		api.WriteJSON(w, http.StatusOK, response, nil)
+	}
+}
@@ -0,0 +1,71 @@
+package handlers_test
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/apitest"
+)
+
+func TestWithdrawInsufficientFunds(t *testing.T) {
+	var s = apitest.New(t)
+
+	var req = s.NewAuthedRequest("alex", http.MethodPost, "/v1/account/coins/withdraw", map[string]any{"amount": 1001})
+	apitest.DecodeError(t, s.Do(req), http.StatusConflict, api.CodeInsufficientFunds)
+
+	req = s.NewAuthedRequest("alex", http.MethodPost, "/v1/account/coins/withdraw", map[string]any{"amount": 1000})
+	if balance := apitest.Decode[api.CoinBalanceResponse](t, s.Do(req), http.StatusOK); balance.Balance != 0 {
+		t.Errorf("balance = %s, want 0", balance.Balance)
+	}
+}
+
+func TestDepositOverflow(t *testing.T) {
+	var s = apitest.New(t)
+
+	// alex starts with 1000.
+	var req = s.NewAuthedRequest("alex", http.MethodPost, "/v1/account/coins/deposit", map[string]any{"amount": int64(math.MaxInt64 - 999)})
+	apitest.DecodeError(t, s.Do(req), http.StatusBadRequest, api.CodeInvalidRequest)
+}
+
+func TestConcurrentWithdrawalsNeverOverdraw(t *testing.T) {
+	var s = apitest.New(t)
+	// alex starts with 1000, enough for 33 of them.
+	const withdrawals, amount = 50, 30
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var statuses = map[int]int{}
+	for range withdrawals {
+		wg.Go(func() {
+			var req = s.NewAuthedRequest("alex", http.MethodPost, "/v1/account/coins/withdraw", map[string]any{"amount": amount})
+			var resp = s.Do(req)
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+
+			mu.Lock()
+			statuses[resp.StatusCode]++
+			mu.Unlock()
+		})
+	}
+	wg.Wait()
+
+	if statuses[http.StatusOK]+statuses[http.StatusConflict] != withdrawals {
+		t.Fatalf("statuses = %v, want only 200 and 409", statuses)
+	}
+	if statuses[http.StatusOK] > 1000/amount {
+		t.Fatalf("%d withdrawals of %d went through, more than 1000 covers", statuses[http.StatusOK], amount)
+	}
+
+	coins, err := s.Database.GetUserCoins(context.Background(), "alex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := int64(1000 - amount*statuses[http.StatusOK]); coins.Coins != want {
+		t.Errorf("balance = %d after %d withdrawals, want %d", coins.Coins, statuses[http.StatusOK], want)
+	}
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/audit"
+	"github.com/RashedMaaitah/goapi/internal/logging"
+	"github.com/RashedMaaitah/goapi/internal/middleware"
+	"github.com/RashedMaaitah/goapi/internal/tools"
+)
+
+var MissingBalanceError = errors.New("Balance is required.")
+
+var MissingReasonError = errors.New("Reason is required.")
+
+var InvalidDeltaError = errors.New("Delta must not be zero.")
+
+var NegativeBalanceError = errors.New("The balance would become negative, set force to allow it.")
+
+// SetUserCoins replaces the balance of the user in the path.
+func SetUserCoins(database tools.Database, auditor audit.Auditor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var logger = logging.FromContext(r.Context())
+		var params = api.SetBalanceParams{}
+		var err error
+
+		err = api.ReadJSON(w, r, &params)
+
+		if err != nil {
+			logger.Error(err)
+			api.BodyErrorHandler(w, err)
+			return
+		}
+
+		if params.Balance == nil {
+			api.RequestErrorHandler(w, MissingBalanceError)
+			return
+		}
+
+		adminAdjustCoins(w, r, database, auditor, tools.AdminAdjustment{
+			Set:     true,
+			Balance: int64(*params.Balance),
+			Reason:  strings.TrimSpace(params.Reason),
+			Force:   params.Force,
+			Version: params.Version,
+		})
+	}
+}
+
+// AdjustUserCoins adds a signed delta to the balance of the user in the
+// path.
+func AdjustUserCoins(database tools.Database, auditor audit.Auditor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var logger = logging.FromContext(r.Context())
+		var params = api.AdjustBalanceParams{}
+		var err error
+
+		err = api.ReadJSON(w, r, &params)
+
+		if err != nil {
+			logger.Error(err)
+			api.BodyErrorHandler(w, err)
+			return
+		}
+
+		if params.Delta == 0 {
+			api.RequestErrorHandler(w, InvalidDeltaError)
+			return
+		}
+
+		if strings.TrimSpace(params.Reason) == "" {
+			api.RequestErrorHandler(w, MissingReasonError)
+			return
+		}
+
+		adminAdjustCoins(w, r, database, auditor, tools.AdminAdjustment{
+			Delta:   int64(params.Delta),
+			Reason:  strings.TrimSpace(params.Reason),
+			Force:   params.Force,
+			Version: params.Version,
+		})
+	}
+}
+
+func adminAdjustCoins(w http.ResponseWriter, r *http.Request, database tools.Database, auditor audit.Auditor, adjustment tools.AdminAdjustment) {
+	var logger = logging.FromContext(r.Context())
+	var loginDetails *tools.LoginDetails = middleware.GetLoginDetails(r.Context())
+	var username string = middleware.PathUsername(r)
+
+	adjustment.Actor = loginDetails.Username
+
+	coinDetails, err := database.AdminAdjustCoins(r.Context(), username, adjustment)
+
+	var entry = tools.AuditEntry{Actor: adjustment.Actor, Action: audit.ActionAdjustBalance, Target: username, Currency: tools.DefaultCurrency, Amount: adjustment.Delta}
+	if adjustment.Set {
+		entry.Action, entry.Amount = audit.ActionSetBalance, adjustment.Balance
+	}
+	auditor.Record(r.Context(), entry, err)
+
+	switch {
+	case errors.Is(err, tools.ErrInsufficientFunds):
+		api.ConflictErrorHandler(w, api.CodeNegativeBalance, NegativeBalanceError)
+		return
+	case err != nil:
+		api.WriteErr(w, err)
+		return
+	}
+
+	logger.Infof("%s changed the balance of %s to %d: %s", adjustment.Actor, username, coinDetails.Coins, adjustment.Reason)
+
+	var response = api.AdminBalanceResponse{
+		StatusCode: http.StatusOK,
+		Username:   username,
+		Balance:    api.Amount(coinDetails.Coins),
+		Version:    coinDetails.Version,
+	}
+
+	api.WriteJSON(w, http.StatusOK, response, nil)
+}
@@ -1,19 +1,310 @@
 package handlers
 
 import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/auth"
+	"github.com/RashedMaaitah/goapi/internal/config"
 	"github.com/RashedMaaitah/goapi/internal/middleware"
+	"github.com/RashedMaaitah/goapi/internal/openapi"
+	"github.com/RashedMaaitah/goapi/internal/tools"
 	"github.com/go-chi/chi"
 	chimiddle "github.com/go-chi/chi/middleware"
 )
 
-func Handler(r *chi.Mux) {
-	// Global Middlewares
-	r.Use(chimiddle.StripSlashes)
+// Handler mounts the routes and middleware of the API on r, with what opts
+// give it.
+func Handler(r *chi.Mux, opts ...Option) error {
+	o, err := newOptions(opts)
+	if err != nil {
+		return err
+	}
+	var cfg, database, logger = o.cfg, o.database, o.logger
+	if o.authDisabled {
+		logger.Warnf("Authentication is disabled, every request acts as %s", DisabledAuthUser.Username)
+	}
+
+	routeErrors(r)
+	var settings = api.Settings{
+		Envelope:     cfg.API.Envelope,
+		MaxBodyBytes: cfg.API.MaxBodyBytes,
+		StrictQuery:  cfg.API.StrictQuery,
+		Language:     api.English,
+	}
+	if api.Messages.Has(cfg.API.DefaultLanguage) {
+		settings.Language = strings.ToLower(cfg.API.DefaultLanguage)
+	} else {
+		logger.Warnf("No messages in %q, errors default to %s; languages are %s", cfg.API.DefaultLanguage, api.English, strings.Join(api.Messages.Languages(), ", "))
+	}
+
+	// The middleware of every request, before routing; that of the route
+	// groups runs after it.
+	var global []string
+	var use = func(name string, mw ...func(http.Handler) http.Handler) {
+		r.Use(mw...)
+		global = append(global, name)
+	}
+	// First, so that everything answering sees them.
+	use("settings", middleware.Settings(settings))
+	use("logger", middleware.WithLogger(logger))
+	use("request_id", middleware.RequestID)
+	use("security_headers", middleware.SecurityHeaders(cfg.SecurityHeaders))
+	use("tracing", middleware.Tracing(o.tracing))
+	// After the IDs, so api.WriteErr logs with them.
+	use("error_format", middleware.ErrorFormat(errorWriter(cfg.API)))
+	if o.accessLog != nil {
+		use("access_log", middleware.AccessLog(o.accessLog))
+	}
+	use("request_logger", middleware.RequestLogger(cfg.Log.RequestSampleRate, "Authorization", cfg.Auth.TokenHeader, cfg.Auth.APIKeys.Header))
+	if cfg.Metrics.Enabled {
+		use("metrics", middleware.Metrics(o.metrics, cfg.Metrics.Path))
+	}
+
+	if cfg.CORS.AllowsAnyOrigin() {
+		logger.Warn("CORS allows requests from any origin")
+	}
+	// Before routing, which answers the preflight requests of routes
+	// without OPTIONS with a 405.
+	use("cors", middleware.CORS(cfg.CORS, "Authorization", cfg.Auth.TokenHeader, cfg.Auth.APIKeys.Header))
+
+	if len(o.middleware) > 0 {
+		use("custom", o.middleware...)
+	}
+	use("strip_slashes", chimiddle.StripSlashes)
+	logger.Infof("Middleware of every request: %s", chainString(global))
+
+	// The groups without maintenance, the ops and admin routes by default,
+	// keep answering, so the maintenance can be watched and ended.
+	if o.maintenance.Enabled() {
+		logger.Warn("Starting in maintenance mode")
+	}
+	o.readiness.SetMaintenance(o.maintenance)
+	o.live.OnReload(func(old, next *config.Config) {
+		if next.Maintenance != old.Maintenance {
+			var state middleware.MaintenanceState = o.maintenance.Reconfigure(next.Maintenance)
+			logger.Warnf("Maintenance mode enabled=%v from the reloaded config", state.Enabled)
+		}
+	})
+
+	doc, err := openapi.Build(cfg)
+	if err == nil {
+		err = doc.Validate(context.Background())
+	}
+	if err != nil {
+		logger.Errorf("Invalid OpenAPI document: %v", err)
+	}
+
+	var validate func(http.Handler) http.Handler
+	if cfg.API.ValidateRequests && err == nil {
+		validate, err = middleware.ValidateRequest(doc, "/v1")
+		if err != nil {
+			logger.Errorf("Requests are not validated: %v", err)
+		}
+	}
+	var chains groupChains = newGroupChains(o, validate)
+
+	r.Group(func(router chi.Router) {
+		router.Use(chains[config.GroupOps]...)
 
-	r.Route("/account", func(router chi.Router) {
-		// Middleware for /account route
-		router.Use(middleware.Authorization)
+		router.Get("/healthz", Healthz(time.Now()))
+		router.Get("/readyz", Readyz(o.readiness, database, cfg.Database.PingTimeout.Duration()))
+		router.Get("/version", GetVersion)
 
-		router.Get("/coins", GetCoinBalance)
+		if cfg.Metrics.Served() {
+			router.Method("GET", cfg.Metrics.Path, o.metrics.Handler())
+		}
+
+		if cfg.Debug {
+			logger.Warn("Debug mode: pprof is served under /debug/pprof")
+			if cfg.Auth.AdminToken == "" {
+				logger.Warn("No admin token configured, /debug/pprof is unprotected")
+			}
+
+			router.Group(func(router chi.Router) {
+				router.Use(middleware.AdminToken(cfg.Auth.AdminToken, auth.NewTokenSource(cfg.Auth)))
+				mountProfiler(router)
+			})
+		}
+	})
+
+	r.Group(func(router chi.Router) {
+		router.Use(chains[config.GroupPublic]...)
+
+		router.Get("/openapi.json", GetOpenAPI(doc))
+		router.Group(func(router chi.Router) {
+			router.Use(middleware.ContentSecurityPolicy(cfg.SecurityHeaders.DocsContentSecurityPolicy))
+			router.Get("/docs", Docs())
+			router.Get("/docs/*", Docs())
+		})
 	})
+
+	var v1 = routesV1(o, chains)
+	r.Route("/v1", func(router chi.Router) {
+		routeErrors(router)
+		v1(router)
+	})
+
+	// The unversioned paths predate /v1 and are kept as deprecated aliases.
+	if cfg.API.LegacyRoutes {
+		r.Group(func(router chi.Router) {
+			router.Use(middleware.Deprecated(cfg.API.LegacySunset, "/v1"))
+			v1(router)
+		})
+	}
+
+	if doc != nil {
+		for _, drift := range openapi.Drift(doc, r) {
+			logger.Warnf("OpenAPI document out of date: %s", drift)
+		}
+	}
+	return nil
+}
+
+// errorWriter writes problem details to requests asking for them, XML to
+// those preferring it, and problem details to all others too in the problem
+// format.
+func errorWriter(cfg config.APIConfig) api.ErrorWriter {
+	var problem = api.ProblemErrorWriter{TypeBase: cfg.ProblemTypeBase}
+	if cfg.ErrorFormat == "problem" {
+		return api.NegotiatedErrorWriter{Problem: problem, Default: problem}
+	}
+	return api.NegotiatedErrorWriter{Problem: problem}
+}
+
+// routesV1 returns the routes of version 1 of the API, each behind the
+// middleware chains gives its route group. The stale reads of o are only
+// used by the route groups cfg.API.StaleReads enables.
+func routesV1(o *options, chains groupChains) func(chi.Router) {
+	var cfg, database, tokens, keys, lockouts, bus, hooks, auditor, cursors, board = o.cfg, o.database, o.tokens, o.keys, o.lockouts, o.bus, o.hooks, o.auditor, o.cursors, o.leaderboard
+
+	// The groups without stale reads get a nil LastKnownGood, which never
+	// has a fallback.
+	var accountStale, adminStale *tools.LastKnownGood
+	if cfg.API.StaleReads.Account {
+		accountStale = o.stale
+	}
+	if cfg.API.StaleReads.Admin {
+		adminStale = o.stale
+	}
+
+	var readCoins = middleware.RequireScope(tools.ScopeCoinsRead)
+	var writeCoins = middleware.RequireScope(tools.ScopeCoinsWrite)
+
+	return func(r chi.Router) {
+		r.Group(func(router chi.Router) {
+			router.Use(chains[config.GroupPublic]...)
+
+			router.Get("/leaderboard", GetLeaderboard(database, board, cursors, cfg.API.LeaderboardCacheTTL.Duration()))
+			router.Post("/users", CreateUser(cfg.Auth, database, tokens))
+			router.Post("/login", Login(cfg.Auth, database, tokens, lockouts, auditor, cfg.RateLimit.TrustProxy))
+			router.Post("/token/refresh", RefreshToken(cfg.Auth, tokens, lockouts, cfg.RateLimit.TrustProxy))
+			router.Post("/logout", Logout(cfg.Auth, tokens, lockouts, cfg.RateLimit.TrustProxy))
+		})
+
+		// They give back their concurrency slot and lift their timeout
+		// themselves, when their chain has them.
+		r.Group(func(router chi.Router) {
+			router.Use(chains[config.GroupStreaming]...)
+			router.Use(readCoins)
+
+			router.Get("/ws", BalanceSocket(cfg, database, bus))
+			router.Get("/account/coins/stream", StreamCoinBalance(bus))
+		})
+
+		r.Group(func(router chi.Router) {
+			router.Use(chains[config.GroupAuthenticated]...)
+
+			// The resources of a user, by name: their own to users, anyone's
+			// to admins.
+			router.Group(func(router chi.Router) {
+				routeTimeout(router, cfg.Server, cfg.Server.RouteTimeouts.Account)
+				router.Use(middleware.ValidPathUsername, middleware.RequireOwnerOrRole(tools.RoleAdmin))
+
+				router.With(readCoins).Get("/users/{username}/coins", GetUserCoinBalance(cfg.API, database, accountStale))
+			})
+
+			router.Route("/account", func(router chi.Router) {
+				routeErrors(router)
+				routeTimeout(router, cfg.Server, cfg.Server.RouteTimeouts.Account)
+
+				router.With(readCoins, middleware.DeprecatedUsernameQuery("/v1/users/{username}/coins")).Get("/coins", GetCoinBalance(cfg.API, database, accountStale))
+				router.Get("/profile", GetProfile(database))
+				router.Patch("/profile", UpdateProfile(database))
+				router.Post("/password", ChangePassword(cfg.Auth, database, tokens))
+				router.Group(func(router chi.Router) {
+					router.Use(writeCoins)
+					router.Use(middleware.Idempotency(database, cfg.API.IdempotencyTTL.Duration()))
+
+					router.Post("/coins/deposit", DepositCoins(cfg.API, database, bus))
+					router.Post("/coins/withdraw", WithdrawCoins(cfg.API, database, bus))
+					router.Post("/coins/transfer", TransferCoins(cfg.API, database, bus, auditor))
+				})
+				router.With(readCoins).Get("/transactions", ListTransactions(database, cursors))
+				router.With(readCoins).Get("/export", ExportAccount(database))
+			})
+		})
+
+		// The bootstrap admin is accepted under /admin alone.
+		r.Group(func(router chi.Router) {
+			router.With(chains[config.GroupAdmin]...).Delete("/users/{username}", DeleteUser(database, tokens, auditor))
+
+			router.Route("/admin", func(router chi.Router) {
+				router.Use(chains[adminBootstrap]...)
+				routeErrors(router)
+				routeTimeout(router, cfg.Server, cfg.Server.RouteTimeouts.Admin)
+
+				router.Group(func(router chi.Router) {
+					routeTimeout(router, cfg.Server, cfg.Server.RouteTimeouts.Batch)
+					router.With(readCoins).Post("/coins/batch", GetCoinBalances(database, adminStale))
+				})
+				router.Get("/users", SearchUsers(database, cursors))
+				router.Get("/stats", GetStats(database, cfg.API.StatsCacheTTL.Duration()))
+				router.With(middleware.BodyLimit(cfg.API.ImportMaxBodyBytes)).Post("/users/import", ImportUsers(cfg, database))
+				router.Get("/ledger/verify", VerifyLedger(database))
+				if board != nil {
+					router.Post("/leaderboard/refresh", RefreshLeaderboard(board))
+				}
+				router.Get("/audit", GetAudit(auditor, cursors))
+				router.Get("/maintenance", GetMaintenance(o.maintenance))
+				router.Post("/maintenance", SetMaintenance(o.maintenance))
+				router.Post("/drain", Drain(o.readiness, cfg.Server.PreStopDelay.Duration()))
+				router.Post("/webhooks", RegisterWebhook(hooks))
+				router.Get("/webhooks", ListWebhooks(hooks))
+				router.Delete("/webhooks/{id}", DeleteWebhook(hooks))
+				router.Get("/webhooks/{id}/deliveries", ListWebhookDeliveries(hooks))
+				router.Post("/webhooks/{id}/deliveries/{deliveryID}/replay", ReplayWebhookDelivery(hooks))
+				router.Get("/ledger/{id}", GetLedgerTransaction(database))
+				router.Post("/apikeys", CreateAPIKey(keys))
+				router.Get("/apikeys", ListAPIKeys(keys))
+				router.Delete("/apikeys/{id}", RevokeAPIKey(keys))
+				router.Delete("/tokens/{username}", RevokeUserTokens(tokens))
+				router.Delete("/lockouts/users/{username}", ClearUserLockout(lockouts))
+				router.Delete("/lockouts/ips/{ip}", ClearIPLockout(lockouts))
+				router.Post("/users/{username}/restore", RestoreUser(database, auditor))
+				router.Post("/users/{username}/freeze", FreezeUser(database, auditor))
+				router.Post("/users/{username}/unfreeze", UnfreezeUser(database, auditor))
+				router.Put("/users/{username}/overdraft", SetOverdraft(cfg.API, database))
+				router.With(writeCoins).Put("/users/{username}/coins", SetUserCoins(database, auditor))
+				router.With(writeCoins).Post("/users/{username}/coins/adjust", AdjustUserCoins(database, auditor))
+			})
+		})
+	}
+}
+
+// routeTimeout gives the routes of r timeout instead of that of the
+// enclosing routes, unless it is 0. One longer than the request timeout of
+// server pushes the write deadline back as much, so the answer can still be
+// written.
+func routeTimeout(r chi.Router, server config.ServerConfig, timeout config.Duration) {
+	if timeout <= 0 {
+		return
+	}
+	r.Use(middleware.Timeout(timeout.Duration()))
+	if server.WriteTimeout > 0 && timeout > server.RequestTimeout {
+		r.Use(middleware.WriteTimeout(server.WriteTimeout.Duration() + timeout.Duration() - server.RequestTimeout.Duration()))
+	}
 }
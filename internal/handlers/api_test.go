@@ -0,0 +1,169 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/apitest"
+	"github.com/RashedMaaitah/goapi/internal/config"
+	"github.com/RashedMaaitah/goapi/internal/handlers"
+)
+
+func TestV1AndLegacyRoutes(t *testing.T) {
+	var s = apitest.New(t)
+
+	for _, tt := range []struct {
+		path       string
+		deprecated bool
+	}{
+		{"/v1/account/coins", false},
+		{"/account/coins", true},
+	} {
+		t.Run(tt.path, func(t *testing.T) {
+			var resp = s.Do(s.NewAuthedRequest("alex", http.MethodGet, tt.path, nil))
+			var header http.Header = resp.Header
+
+			var balance = apitest.Decode[api.CoinBalanceResponse](t, resp, http.StatusOK)
+			if balance.Balance != 1000 {
+				t.Errorf("balance = %s, want 1000", balance.Balance)
+			}
+
+			if got := header.Get("Deprecation") == "true"; got != tt.deprecated {
+				t.Errorf("Deprecation = %q, want deprecated %v", header.Get("Deprecation"), tt.deprecated)
+			}
+			if !tt.deprecated {
+				return
+			}
+			if header.Get("Sunset") != s.Config.API.LegacySunset.UTC().Format(http.TimeFormat) {
+				t.Errorf("Sunset = %q, want %s", header.Get("Sunset"), s.Config.API.LegacySunset)
+			}
+			if want := `</v1/account/coins>; rel="successor-version"`; header.Get("Link") != want {
+				t.Errorf("Link = %q, want %q", header.Get("Link"), want)
+			}
+		})
+	}
+}
+
+func TestLegacyRoutesDisabled(t *testing.T) {
+	var s = apitest.New(t, apitest.WithConfig(func(cfg *config.Config) { cfg.API.LegacyRoutes = false }))
+
+	var resp = s.Do(s.NewAuthedRequest("alex", http.MethodGet, "/v1/account/coins", nil))
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /v1/account/coins answered %d", resp.StatusCode)
+	}
+
+	apitest.DecodeError(t, s.Do(s.NewAuthedRequest("alex", http.MethodGet, "/account/coins", nil)), http.StatusNotFound, api.CodeRouteNotFound)
+}
+
+func TestRouteTimeouts(t *testing.T) {
+	var s = apitest.New(t,
+		apitest.WithConfig(func(cfg *config.Config) {
+			cfg.Database.Latency = config.Duration(100 * time.Millisecond)
+			cfg.Server.RequestTimeout = config.Duration(20 * time.Millisecond)
+			cfg.Server.RouteTimeouts.Account = config.Duration(5 * time.Second)
+		}),
+		apitest.WithHandlerOptions(handlers.WithAuthDisabled()),
+	)
+
+	var resp = s.Do(s.NewRequest(http.MethodGet, "/v1/account/coins", nil))
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("GET /v1/account/coins answered %d within its route timeout", resp.StatusCode)
+	}
+
+	apitest.DecodeError(t, s.Do(s.NewRequest(http.MethodGet, "/v1/admin/stats", nil)), http.StatusGatewayTimeout, api.CodeTimeout)
+}
+
+func TestHandlersKeepTheirOwnSettings(t *testing.T) {
+	var strict, lenient = apitest.New(t), apitest.New(t, apitest.WithConfig(func(cfg *config.Config) {
+		cfg.API.StrictQuery = false
+		cfg.API.Envelope = true
+		cfg.API.MaxBodyBytes = 16
+		cfg.API.DefaultLanguage = "es"
+	}))
+
+	// Served in turn and at once, each by its own config.
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Go(func() {
+			apitest.DecodeError(t, strict.Do(strict.NewAuthedRequest("alex", http.MethodGet, "/v1/account/coins?foo=1", nil)), http.StatusBadRequest, api.CodeValidationFailed)
+			var envelope = apitest.Decode[struct{ Data api.CoinBalanceResponse }](t, lenient.Do(lenient.NewAuthedRequest("alex", http.MethodGet, "/v1/account/coins?foo=1", nil)), http.StatusOK)
+			if envelope.Data.Balance != 1000 {
+				t.Errorf("enveloped balance = %s, want 1000", envelope.Data.Balance)
+			}
+		})
+	}
+	wg.Wait()
+
+	var deposit = map[string]any{"amount": 1, "currency": "coins"}
+	apitest.Decode[api.CoinBalanceResponse](t, strict.Do(strict.NewAuthedRequest("alex", http.MethodPost, "/v1/account/coins/deposit", deposit)), http.StatusOK)
+	var resp = lenient.Do(lenient.NewAuthedRequest("alex", http.MethodPost, "/v1/account/coins/deposit", deposit))
+	if language := resp.Header.Get("Content-Language"); language != "es" {
+		t.Errorf("Content-Language = %q, want es", language)
+	}
+	apitest.DecodeError(t, resp, http.StatusRequestEntityTooLarge, api.CodeBodyTooLarge)
+}
+
+func TestProblemDetails(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		format string
+		accept string
+	}{
+		{"asked for", "json", "application/problem+json"},
+		{"configured", "problem", ""},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var s = apitest.New(t, apitest.WithConfig(func(cfg *config.Config) { cfg.API.ErrorFormat = tt.format }))
+
+			for _, rt := range []struct {
+				path       string
+				status     int
+				code       string
+				violations bool
+			}{
+				{"/v1/nonexistent", http.StatusNotFound, api.CodeRouteNotFound, false},
+				{"/v1/account/transactions?limit=abc", http.StatusBadRequest, api.CodeValidationFailed, true},
+			} {
+				t.Run(rt.path, func(t *testing.T) {
+					var req = s.NewAuthedRequest("alex", http.MethodGet, rt.path, nil)
+					if tt.accept != "" {
+						req.Header.Set("Accept", tt.accept)
+					}
+					var resp = s.Do(req)
+					defer resp.Body.Close()
+
+					if resp.StatusCode != rt.status {
+						t.Fatalf("answered %d, want %d", resp.StatusCode, rt.status)
+					}
+					if resp.Header.Get("Content-Type") != "application/problem+json" {
+						t.Errorf("Content-Type = %q, want application/problem+json", resp.Header.Get("Content-Type"))
+					}
+					var problem api.Problem
+					if err := json.NewDecoder(resp.Body).Decode(&problem); err != nil {
+						t.Fatal(err)
+					}
+					var path, _, _ = strings.Cut(rt.path, "?")
+					if problem.Type != "urn:goapi:error:"+rt.code || problem.Title != http.StatusText(rt.status) || problem.Status != rt.status || problem.Instance != path {
+						t.Errorf("problem = %+v, want the type urn:goapi:error:%s, title %q, status %d and instance %s", problem, rt.code, http.StatusText(rt.status), rt.status, path)
+					}
+					if problem.Detail == "" || problem.Code != rt.code || problem.RequestID != resp.Header.Get("X-Request-ID") {
+						t.Errorf("problem = %+v, want a detail, the code %s and the request ID %s", problem, rt.code, resp.Header.Get("X-Request-ID"))
+					}
+					if (len(problem.Violations) > 0) != rt.violations {
+						t.Errorf("violations = %+v, want some %v", problem.Violations, rt.violations)
+					}
+				})
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/auth"
+	"github.com/RashedMaaitah/goapi/internal/logging"
+	"github.com/RashedMaaitah/goapi/internal/middleware"
+	"github.com/RashedMaaitah/goapi/internal/tools"
+	"github.com/go-chi/chi"
+)
+
+var APIKeyNotFoundError = errors.New("API key not found.")
+
+var APIKeyExpiredError = errors.New("ExpiresAt must be in the future.")
+
+// CreateAPIKey creates a key for a service. The response is the only one
+// that includes the key.
+func CreateAPIKey(keys *auth.APIKeys) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var logger = logging.FromContext(r.Context())
+		var params = api.APIKeyParams{}
+		var err error
+
+		err = api.ReadJSON(w, r, &params)
+
+		if err != nil {
+			logger.Error(err)
+			api.BodyErrorHandler(w, err)
+			return
+		}
+
+		var expiresAt time.Time
+		if params.ExpiresAt != nil {
+			expiresAt = *params.ExpiresAt
+			if !expiresAt.After(time.Now()) {
+				api.RequestErrorHandler(w, APIKeyExpiredError)
+				return
+			}
+		}
+		var role string = params.Role
+		if role == "" {
+			role = tools.RoleUser
+		}
+
+		apiKey, key, err := keys.Create(r.Context(), params.Name, role, expiresAt)
+
+		if err != nil {
+			api.WriteErr(w, err)
+			return
+		}
+
+		logger.Infof("%s created API key %s of %s with role %s", middleware.GetLoginDetails(r.Context()).Username, apiKey.ID, apiKey.Name, apiKey.Role)
+
+		var response = api.APIKeyResponse{
+			StatusCode: http.StatusCreated,
+			APIKey:     apiKeyResponse(*apiKey),
+		}
+		response.APIKey.Key = key
+
+		api.WriteJSON(w, http.StatusCreated, response, nil)
+	}
+}
+
+func ListAPIKeys(keys *auth.APIKeys) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		apiKeys, err := keys.List(r.Context())
+
+		if err != nil {
+			api.WriteErr(w, err)
+			return
+		}
+
+		var response = api.APIKeyListResponse{
+			StatusCode: http.StatusOK,
+			APIKeys:    []api.APIKey{},
+		}
+		for _, apiKey := range apiKeys {
+			response.APIKeys = append(response.APIKeys, apiKeyResponse(apiKey))
+		}
+
+		api.WriteJSON(w, http.StatusOK, response, nil)
+	}
+}
+
+// RevokeAPIKey deletes the key in the path, which stops working at once.
+func RevokeAPIKey(keys *auth.APIKeys) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var logger = logging.FromContext(r.Context())
+		var id string = chi.URLParam(r, "id")
+
+		var err error = keys.Revoke(r.Context(), id)
+
+		if errors.Is(err, tools.ErrAPIKeyNotFound) {
+			api.NotFoundErrorHandler(w, api.CodeAPIKeyNotFound, APIKeyNotFoundError)
+			return
+		}
+		if err != nil {
+			api.WriteErr(w, err)
+			return
+		}
+
+		logger.Infof("%s revoked API key %s", middleware.GetLoginDetails(r.Context()).Username, id)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func apiKeyResponse(apiKey tools.APIKey) api.APIKey {
+	var response = api.APIKey{
+		ID:        apiKey.ID,
+		Name:      apiKey.Name,
+		Role:      apiKey.Role,
+		CreatedAt: apiKey.CreatedAt,
+	}
+	if !apiKey.ExpiresAt.IsZero() {
+		response.ExpiresAt = &apiKey.ExpiresAt
+	}
+	if !apiKey.LastUsedAt.IsZero() {
+		response.LastUsedAt = &apiKey.LastUsedAt
+	}
+	return response
+}
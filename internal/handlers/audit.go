@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/audit"
+	"github.com/RashedMaaitah/goapi/internal/logging"
+	"github.com/RashedMaaitah/goapi/internal/tools"
+)
+
+const (
+	defaultAuditLimit = 50
+	maxAuditLimit     = 500
+)
+
+var InvalidSinceError = errors.New("Since must be an RFC 3339 time, such as 2026-01-02T15:04:05Z.")
+
+// GetAudit lists the entries of the audit log, newest first, of the user
+// given as the actor or the target, of an action and since a time. Its
+// cursors carry the Seq of the last entry of the page.
+func GetAudit(auditor audit.Auditor, cursors *api.Cursors) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var logger = logging.FromContext(r.Context())
+		var params = api.AuditListParams{}
+		var err error
+
+		if violations := api.ReadQuery(r, &params); len(violations) > 0 {
+			api.ValidationErrorHandler(w, violations)
+			return
+		}
+
+		var filter = tools.AuditFilter{
+			User:   api.NormalizeUsername(params.User),
+			Action: params.Action,
+		}
+
+		if params.Since != "" {
+			filter.Since, err = time.Parse(time.RFC3339, params.Since)
+			if err != nil {
+				api.RequestErrorHandler(w, InvalidSinceError)
+				return
+			}
+		}
+
+		filter.Limit, err = params.PageLimit(defaultAuditLimit, maxAuditLimit)
+		if err != nil {
+			api.RequestErrorHandler(w, err)
+			return
+		}
+
+		if params.Cursor != "" {
+			filter.Before, err = cursors.Decode(auditCursor, params.Cursor)
+			if err != nil {
+				logger.Warnf("Invalid audit cursor %q", params.Cursor)
+				api.RequestErrorHandler(w, err)
+				return
+			}
+		}
+
+		// One extra entry tells whether there is a next page.
+		var limit int = filter.Limit
+		filter.Limit++
+		entries, err := auditor.List(r.Context(), filter)
+
+		if err != nil {
+			api.WriteErr(w, fmt.Errorf("Listing the audit log: %w", err))
+			return
+		}
+
+		var response = api.AuditListResponse{
+			StatusCode:   http.StatusOK,
+			PageResponse: api.PageResponse[api.AuditEntry]{Items: []api.AuditEntry{}},
+		}
+
+		if len(entries) > limit {
+			entries = entries[:limit]
+			response.NextCursor = cursors.Encode(auditCursor, entries[limit-1].Seq)
+		}
+
+		for _, e := range entries {
+			response.Items = append(response.Items, api.AuditEntry{
+				Seq:       e.Seq,
+				Actor:     e.Actor,
+				Action:    e.Action,
+				Target:    e.Target,
+				Currency:  e.Currency,
+				Amount:    api.Amount(e.Amount),
+				RequestID: e.RequestID,
+				Outcome:   e.Outcome,
+				Timestamp: e.CreatedAt,
+				PrevHash:  e.PrevHash,
+				Hash:      e.Hash,
+			})
+		}
+
+		api.WriteJSON(w, http.StatusOK, response, nil)
+	}
+}
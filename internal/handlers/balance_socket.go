@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/config"
+	"github.com/RashedMaaitah/goapi/internal/events"
+	"github.com/RashedMaaitah/goapi/internal/logging"
+	"github.com/RashedMaaitah/goapi/internal/middleware"
+	"github.com/RashedMaaitah/goapi/internal/tools"
+	"github.com/gorilla/websocket"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	socketWriteWait  = 10 * time.Second
+	socketPongWait   = 60 * time.Second
+	socketPingPeriod = socketPongWait * 9 / 10
+	socketMaxMessage = 1024
+	// socketQueue bounds both the events and the replies waiting to be
+	// written to one connection.
+	socketQueue = 16
+
+	socketGetBalance     = "get_balance"
+	socketBalance        = "balance"
+	socketBalanceChanged = "balance_changed"
+	socketError          = "error"
+
+	unknownOpCode       = "unknown_op"
+	unknownCurrencyCode = "unknown_currency"
+)
+
+// BalanceSocket upgrades to a WebSocket that pushes every change to the
+// balance of the user and answers get_balance commands. Events the client
+// is too slow for are dropped; a client that keeps sending commands it
+// doesn't read the replies to is disconnected.
+func BalanceSocket(cfg *config.Config, database tools.Database, bus *events.Bus) http.HandlerFunc {
+	var upgrader = websocket.Upgrader{CheckOrigin: socketOrigin(cfg.CORS)}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		var logger = logging.FromContext(r.Context())
+		var username string = middleware.GetLoginDetails(r.Context()).Username
+
+		// Upgrade has already answered when it fails.
+		conn, err := upgrader.Upgrade(w, r, nil)
+
+		if err != nil {
+			logger.Warn(err)
+			return
+		}
+		middleware.StopTimeout(r.Context())
+		middleware.ReleaseSlot(r.Context())
+
+		var subscription *events.Subscription = bus.Subscribe(username, socketQueue)
+		defer subscription.Close()
+
+		var replies = make(chan api.SocketMessage, socketQueue)
+		var readerDone = make(chan struct{})
+		var writerDone = make(chan struct{})
+
+		go func() {
+			defer close(writerDone)
+			writeSocket(conn, logger, bus, subscription, replies, readerDone)
+		}()
+
+		logger.Infof("Balance socket of %s opened", username)
+
+		conn.SetReadLimit(socketMaxMessage)
+		conn.SetReadDeadline(time.Now().Add(socketPongWait))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(socketPongWait))
+		})
+
+		for {
+			var command api.SocketCommand
+			err = conn.ReadJSON(&command)
+
+			if err != nil {
+				if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+					logger.Warn(err)
+				}
+				break
+			}
+
+			var reply api.SocketMessage = socketReply(r, cfg.API, database, username, command)
+
+			select {
+			case replies <- reply:
+				continue
+			default:
+				logger.Warnf("Closing the balance socket of %s: replies are not being read", username)
+			}
+			break
+		}
+
+		close(readerDone)
+		<-writerDone
+
+		logger.Infof("Balance socket of %s closed, %d events dropped", username, subscription.Dropped())
+	}
+}
+
+// writeSocket is the only writer of conn and closes it on return, which
+// also ends the read loop.
+func writeSocket(conn *websocket.Conn, logger *log.Entry, bus *events.Bus, subscription *events.Subscription, replies <-chan api.SocketMessage, readerDone <-chan struct{}) {
+	defer conn.Close()
+
+	var ping = time.NewTicker(socketPingPeriod)
+	defer ping.Stop()
+
+	for {
+		var err error
+		conn.SetWriteDeadline(time.Now().Add(socketWriteWait))
+
+		select {
+		case <-readerDone:
+			return
+		case <-bus.Done():
+			var message = websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+			conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(socketWriteWait))
+			return
+		case <-ping.C:
+			err = conn.WriteMessage(websocket.PingMessage, nil)
+		case reply := <-replies:
+			err = conn.WriteJSON(reply)
+		case event := <-subscription.C:
+			err = conn.WriteJSON(api.SocketMessage{
+				Op: socketBalanceChanged,
+				Event: &api.BalanceEvent{
+					ID:        event.ID,
+					Type:      event.Type,
+					Currency:  event.Currency,
+					Amount:    api.Amount(event.Amount),
+					Balance:   api.Amount(event.Balance),
+					Timestamp: event.Timestamp,
+				},
+			})
+		}
+
+		if err != nil {
+			logger.Warn(err)
+			return
+		}
+	}
+}
+
+func socketReply(r *http.Request, cfg config.APIConfig, database tools.Database, username string, command api.SocketCommand) api.SocketMessage {
+	if command.Op != socketGetBalance {
+		return api.SocketMessage{Op: socketError, Code: unknownOpCode, Message: "Op must be get_balance."}
+	}
+
+	currency, err := resolveCurrency(cfg, command.Currency)
+
+	if err != nil {
+		return api.SocketMessage{Op: socketError, Code: unknownCurrencyCode, Message: err.Error()}
+	}
+
+	coinDetails, err := database.GetUserCoins(r.Context(), username)
+
+	if err != nil {
+		logging.FromContext(r.Context()).Errorf("Balance of %s: %v", username, err)
+		return api.SocketMessage{Op: socketError, Code: api.CodeInternalError, Message: "An Unexpected Error Occured."}
+	}
+
+	var balance = api.Amount(coinDetails.Balance(currency))
+	return api.SocketMessage{
+		Op:       socketBalance,
+		Balance:  &balance,
+		Currency: currency,
+		Balances: api.Amounts(coinDetails.AllBalances()),
+	}
+}
+
+// socketOrigin accepts browsers on the API's own host and on the origins
+// allowed by CORS. Clients that send no Origin are not browsers.
+func socketOrigin(cfg config.CORSConfig) func(*http.Request) bool {
+	var allowAny bool = cfg.AllowsAnyOrigin()
+	var origins = make(map[string]bool, len(cfg.AllowedOrigins))
+	for _, origin := range cfg.AllowedOrigins {
+		origins[strings.ToLower(origin)] = true
+	}
+
+	return func(r *http.Request) bool {
+		var origin string = r.Header.Get("Origin")
+		if origin == "" || allowAny || origins[strings.ToLower(origin)] {
+			return true
+		}
+		parsed, err := url.Parse(origin)
+		return err == nil && strings.EqualFold(parsed.Host, r.Host)
+	}
+}
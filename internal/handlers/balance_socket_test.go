@@ -0,0 +1,98 @@
+package handlers_test
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/apitest"
+	"github.com/RashedMaaitah/goapi/internal/events"
+	"github.com/RashedMaaitah/goapi/internal/handlers"
+	"github.com/gorilla/websocket"
+)
+
+// dialSocket opens /v1/ws of s as user, closed when the test ends.
+func dialSocket(t *testing.T, s *apitest.Server, user string) *websocket.Conn {
+	t.Helper()
+
+	var header = http.Header{"Authorization": {"Bearer " + s.Token(user)}}
+	conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(s.URL, "http")+"/v1/ws", header)
+	if err != nil {
+		t.Fatalf("dialing /v1/ws: %v", err)
+	}
+	resp.Body.Close()
+	t.Cleanup(func() { conn.Close() })
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+func readSocket(t *testing.T, conn *websocket.Conn) api.SocketMessage {
+	t.Helper()
+
+	var message api.SocketMessage
+	if err := conn.ReadJSON(&message); err != nil {
+		t.Fatalf("reading the socket: %v", err)
+	}
+	return message
+}
+
+func TestBalanceSocketCommands(t *testing.T) {
+	var s = apitest.New(t)
+	var conn = dialSocket(t, s, "alex")
+
+	conn.WriteJSON(api.SocketCommand{Op: "get_balance"})
+	var message = readSocket(t, conn)
+	if message.Op != "balance" || message.Balance == nil || *message.Balance != 1000 {
+		t.Errorf("get_balance answered %+v, want a balance of 1000", message)
+	}
+
+	conn.WriteJSON(api.SocketCommand{Op: "withdraw_everything"})
+	if message = readSocket(t, conn); message.Op != "error" || message.Code != "unknown_op" {
+		t.Errorf("unknown op answered %+v, want an unknown_op error", message)
+	}
+}
+
+func TestBalanceSocketPushesChanges(t *testing.T) {
+	var s = apitest.New(t)
+	var conn = dialSocket(t, s, "alex")
+
+	// Answered once subscribed, so the deposit can't be missed.
+	conn.WriteJSON(api.SocketCommand{Op: "get_balance"})
+	readSocket(t, conn)
+
+	var req = s.NewAuthedRequest("alex", http.MethodPost, "/v1/account/coins/deposit", map[string]any{"amount": 5})
+	apitest.Decode[api.CoinBalanceResponse](t, s.Do(req), http.StatusOK)
+
+	var message = readSocket(t, conn)
+	if message.Op != "balance_changed" || message.Event == nil || message.Event.Balance != 1005 || message.Event.Amount != 5 {
+		t.Errorf("pushed %+v, want a deposit of 5 to 1005", message)
+	}
+}
+
+func TestBalanceSocketNeedsAToken(t *testing.T) {
+	var s = apitest.New(t)
+
+	_, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(s.URL, "http")+"/v1/ws", nil)
+	if !errors.Is(err, websocket.ErrBadHandshake) {
+		t.Fatalf("dialing without a token: %v, want a bad handshake", err)
+	}
+	apitest.DecodeError(t, resp, http.StatusUnauthorized, api.CodeMissingToken)
+}
+
+func TestBalanceSocketClosedOnShutdown(t *testing.T) {
+	var bus = events.NewBus()
+	var s = apitest.New(t, apitest.WithHandlerOptions(handlers.WithEvents(bus, nil)))
+	var conn = dialSocket(t, s, "alex")
+
+	conn.WriteJSON(api.SocketCommand{Op: "get_balance"})
+	readSocket(t, conn)
+	bus.Shutdown()
+
+	_, _, err := conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Fatalf("read after the shutdown: %v, want a going away close", err)
+	}
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/auth"
+	"github.com/RashedMaaitah/goapi/internal/config"
+	"github.com/RashedMaaitah/goapi/internal/logging"
+	"github.com/RashedMaaitah/goapi/internal/middleware"
+	"github.com/RashedMaaitah/goapi/internal/tools"
+)
+
+var WrongPasswordError = errors.New("Current password is wrong.")
+
+// ChangePassword replaces the password of the authenticated user and
+// revokes all of their tokens, including the one used for the request.
+func ChangePassword(cfg config.AuthConfig, database tools.Database, tokens auth.Tokens) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var logger = logging.FromContext(r.Context())
+		var params = api.ChangePasswordParams{}
+		var err error
+
+		err = api.ReadJSON(w, r, &params)
+
+		if err != nil {
+			logger.Error(err)
+			api.BodyErrorHandler(w, err)
+			return
+		}
+
+		var loginDetails *tools.LoginDetails = middleware.GetLoginDetails(r.Context())
+
+		if err = auth.CheckPassword(loginDetails.PasswordHash, params.CurrentPassword, cfg.BcryptCost); err != nil {
+			logger.Warnf("Wrong current password for %s", loginDetails.Username)
+			api.UnauthorizedErrorHandler(w, api.CodeInvalidCredentials, WrongPasswordError)
+			return
+		}
+
+		if err = validatePassword(loginDetails.Username, params.NewPassword); err != nil {
+			api.RequestErrorHandler(w, err)
+			return
+		}
+
+		hash, err := auth.HashPassword(params.NewPassword, cfg.BcryptCost)
+
+		if err != nil {
+			logger.Error(err)
+			api.InternalErrorHandler(w)
+			return
+		}
+
+		err = database.UpdatePassword(r.Context(), loginDetails.Username, hash)
+
+		if err != nil {
+			logger.Error(err)
+			api.InternalErrorHandler(w)
+			return
+		}
+
+		err = tokens.RevokeAll(r.Context(), loginDetails.Username)
+
+		if err != nil {
+			logger.Error(err)
+			api.InternalErrorHandler(w)
+			return
+		}
+
+		logger.Infof("Changed the password of %s and revoked their tokens", loginDetails.Username)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/auth"
+	"github.com/RashedMaaitah/goapi/internal/config"
+	"github.com/RashedMaaitah/goapi/internal/logging"
+	"github.com/RashedMaaitah/goapi/internal/tools"
+)
+
+const (
+	minPasswordLength = 8
+	// bcrypt ignores everything past 72 bytes.
+	maxPasswordLength = 72
+)
+
+var InvalidPasswordError = fmt.Errorf("Password must be between %d and %d characters.", minPasswordLength, maxPasswordLength)
+
+var PasswordIsUsernameError = errors.New("Password must not be the username.")
+
+func CreateUser(cfg config.AuthConfig, database tools.Database, tokens auth.Tokens) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var logger = logging.FromContext(r.Context())
+		var params = api.CreateUserParams{}
+		var err error
+
+		err = api.ReadJSON(w, r, &params)
+
+		if err != nil {
+			logger.Error(err)
+			api.BodyErrorHandler(w, err)
+			return
+		}
+
+		if err = validatePassword(params.Username, params.Password); err != nil {
+			api.RequestErrorHandler(w, err)
+			return
+		}
+
+		hash, err := auth.HashPassword(params.Password, cfg.BcryptCost)
+
+		if err != nil {
+			logger.Error(err)
+			api.InternalErrorHandler(w)
+			return
+		}
+
+		var loginDetails *tools.LoginDetails
+		loginDetails, err = database.CreateUser(r.Context(), params.Username, hash)
+
+		if err != nil {
+			api.WriteErr(w, fmt.Errorf("Registration of %s: %w", params.Username, err))
+			return
+		}
+
+		logger.Infof("Registered user %s", loginDetails.Username)
+
+		var token *auth.Token
+		token, err = tokens.Issue(r.Context(), loginDetails.Username, tools.Scopes)
+
+		if err != nil {
+			logger.Error(err)
+			api.InternalErrorHandler(w)
+			return
+		}
+
+		var response = api.CreateUserResponse{
+			StatusCode: http.StatusCreated,
+			Username:   loginDetails.Username,
+			AuthToken:  token.Value,
+			ExpiresAt:  token.ExpiresAt,
+		}
+
+		api.WriteJSON(w, http.StatusCreated, response, nil)
+	}
+}
+
+func validatePassword(username string, password string) error {
+	if len(password) < minPasswordLength || len(password) > maxPasswordLength {
+		return InvalidPasswordError
+	}
+	if strings.EqualFold(password, username) {
+		return PasswordIsUsernameError
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/RashedMaaitah/goapi/internal/config"
+	"github.com/RashedMaaitah/goapi/internal/tools"
+)
+
+var UnknownCurrencyError = errors.New("Unknown currency.")
+
+var CrossCurrencyError = errors.New("Transfers between currencies are not supported.")
+
+// resolveCurrency returns the currency named by a request, the default one
+// when it names none.
+func resolveCurrency(cfg config.APIConfig, name string) (string, error) {
+	var currency string = strings.ToLower(strings.TrimSpace(name))
+	if currency == "" || currency == tools.DefaultCurrency {
+		return tools.DefaultCurrency, nil
+	}
+	if !slices.Contains(cfg.Currencies, currency) {
+		return "", UnknownCurrencyError
+	}
+	return currency, nil
+}
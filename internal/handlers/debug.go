@@ -0,0 +1,18 @@
+package handlers
+
+import (
+	"net/http/pprof"
+
+	"github.com/go-chi/chi"
+)
+
+// mountProfiler registers the net/http/pprof handlers under /debug/pprof.
+func mountProfiler(router chi.Router) {
+	router.HandleFunc("/debug/pprof", pprof.Index)
+	router.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	router.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	router.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	router.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	// Named profiles (heap, goroutine, allocs, ...) are served by Index.
+	router.HandleFunc("/debug/pprof/{profile}", pprof.Index)
+}
@@ -0,0 +1,55 @@
+package handlers_test
+
+import (
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/apitest"
+	"github.com/RashedMaaitah/goapi/internal/config"
+)
+
+func TestProfilerOnlyInDebugMode(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		debug bool
+		want  int
+	}{
+		{"off by default", false, http.StatusNotFound},
+		{"on in debug mode", true, http.StatusOK},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var s = apitest.New(t, apitest.WithConfig(func(cfg *config.Config) { cfg.Debug = tt.debug }))
+
+			var resp = s.Do(s.NewRequest(http.MethodGet, "/debug/pprof/heap", nil))
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("GET /debug/pprof/heap answered %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
+
+func TestProfilerNeedsTheAdminToken(t *testing.T) {
+	var s = apitest.New(t, apitest.WithConfig(func(cfg *config.Config) {
+		cfg.Debug = true
+		cfg.Auth.AdminToken = "s3cret-admin-token"
+	}))
+
+	apitest.DecodeError(t, s.Do(s.NewRequest(http.MethodGet, "/debug/pprof/heap", nil)), http.StatusBadRequest, api.CodeInvalidRequest)
+
+	var req = s.NewRequest(http.MethodGet, "/debug/pprof/heap", nil)
+	req.Header.Set("Authorization", "Bearer "+s.Token("admin"))
+	apitest.DecodeError(t, s.Do(req), http.StatusBadRequest, api.CodeInvalidRequest)
+
+	req = s.NewRequest(http.MethodGet, "/debug/pprof/heap", nil)
+	req.Header.Set("Authorization", "Bearer s3cret-admin-token")
+	var resp = s.Do(req)
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("GET /debug/pprof/heap with the admin token answered %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/audit"
+	"github.com/RashedMaaitah/goapi/internal/auth"
+	"github.com/RashedMaaitah/goapi/internal/logging"
+	"github.com/RashedMaaitah/goapi/internal/middleware"
+	"github.com/RashedMaaitah/goapi/internal/tools"
+)
+
+// DeleteUser soft-deletes the user in the path and revokes their tokens.
+// The record is kept, so RestoreUser can bring the account back.
+func DeleteUser(database tools.Database, tokens auth.Tokens, auditor audit.Auditor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var logger = logging.FromContext(r.Context())
+		var username string = middleware.PathUsername(r)
+
+		var err error = database.DeleteUser(r.Context(), username)
+		auditor.Record(r.Context(), tools.AuditEntry{
+			Actor:  middleware.GetLoginDetails(r.Context()).Username,
+			Action: audit.ActionDeleteUser,
+			Target: username,
+		}, err)
+
+		if err != nil {
+			api.WriteErr(w, err)
+			return
+		}
+
+		err = tokens.RevokeAll(r.Context(), username)
+
+		if err != nil {
+			logger.Error(err)
+			api.InternalErrorHandler(w)
+			return
+		}
+
+		logger.Infof("Deleted user %s", username)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func RestoreUser(database tools.Database, auditor audit.Auditor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var logger = logging.FromContext(r.Context())
+		var username string = middleware.PathUsername(r)
+
+		var err error = database.RestoreUser(r.Context(), username)
+		auditor.Record(r.Context(), tools.AuditEntry{
+			Actor:  middleware.GetLoginDetails(r.Context()).Username,
+			Action: audit.ActionRestoreUser,
+			Target: username,
+		}, err)
+
+		if err != nil {
+			api.WriteErr(w, err)
+			return
+		}
+
+		logger.Infof("Restored user %s", username)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
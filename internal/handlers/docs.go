@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/logging"
+	"github.com/getkin/kin-openapi/openapi3"
+	swaggerFiles "github.com/swaggo/files"
+)
+
+// swaggerInitializer replaces the one shipped with Swagger UI, which
+// loads the petstore example.
+const swaggerInitializer = `window.onload = function() {
+  window.ui = SwaggerUIBundle({
+    url: "/openapi.json",
+    dom_id: "#swagger-ui",
+    deepLinking: true,
+    presets: [SwaggerUIBundle.presets.apis, SwaggerUIStandalonePreset],
+    layout: "StandaloneLayout"
+  });
+};
+`
+
+// GetOpenAPI serves the OpenAPI document, encoded once.
+func GetOpenAPI(doc *openapi3.T) http.HandlerFunc {
+	body, err := json.Marshal(doc)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err != nil {
+			logging.FromContext(r.Context()).Error(err)
+			api.InternalErrorHandler(w)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}
+}
+
+// Docs serves Swagger UI for the OpenAPI document, from files embedded in
+// the binary.
+func Docs() http.HandlerFunc {
+	var files = http.StripPrefix("/docs", http.FileServer(swaggerFiles.HTTP))
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch strings.TrimPrefix(r.URL.Path, "/docs") {
+		case "":
+			http.Redirect(w, r, "/docs/", http.StatusMovedPermanently)
+			return
+		case "/":
+			index, err := swaggerFiles.ReadFile("/index.html")
+			if err != nil {
+				logging.FromContext(r.Context()).Error(err)
+				api.InternalErrorHandler(w)
+				return
+			}
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write(index)
+			return
+		case "/swagger-initializer.js":
+			w.Header().Set("Content-Type", "text/javascript")
+			w.Write([]byte(swaggerInitializer))
+			return
+		}
+		files.ServeHTTP(w, r)
+	}
+}
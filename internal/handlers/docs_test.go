@@ -0,0 +1,95 @@
+package handlers_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/internal/apitest"
+	"github.com/RashedMaaitah/goapi/internal/config"
+	"github.com/RashedMaaitah/goapi/internal/handlers"
+	"github.com/RashedMaaitah/goapi/internal/openapi"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/go-chi/chi"
+)
+
+func TestServedOpenAPIDocumentIsValid(t *testing.T) {
+	var s = apitest.New(t)
+
+	var resp = s.Do(s.NewRequest(http.MethodGet, "/openapi.json", nil))
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /openapi.json answered %d: %v", resp.StatusCode, err)
+	}
+
+	doc, err := openapi3.NewLoader().LoadFromData(body)
+	if err != nil {
+		t.Fatalf("loading the document: %v", err)
+	}
+	if err = doc.Validate(context.Background()); err != nil {
+		t.Fatalf("invalid document: %v", err)
+	}
+
+	for _, name := range []string{"CoinBalanceResponse", "Error"} {
+		if doc.Components.Schemas[name] == nil {
+			t.Errorf("no %s schema", name)
+		}
+	}
+
+	var balance = doc.Paths.Find("/v1/account/coins")
+	if balance == nil || balance.Get == nil {
+		t.Fatal("GET /v1/account/coins is not documented")
+	}
+	if balance.Get.Parameters.GetByInAndName("query", "currency") == nil {
+		t.Error("GET /v1/account/coins has no currency parameter")
+	}
+	if balance.Get.Security == nil || len(*balance.Get.Security) == 0 {
+		t.Error("GET /v1/account/coins requires no authentication")
+	}
+}
+
+func TestOpenAPIDocumentMatchesTheRoutes(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		configure func(cfg *config.Config)
+	}{
+		{"default", func(cfg *config.Config) {}},
+		{"every optional route", func(cfg *config.Config) {
+			cfg.API.LeaderboardRefresh = config.Duration(time.Hour)
+			cfg.Metrics.Enabled = true
+		}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg config.Config = config.Default()
+			tt.configure(&cfg)
+
+			var r = chi.NewRouter()
+			if err := handlers.Handler(r, handlers.WithConfig(&cfg)); err != nil {
+				t.Fatal(err)
+			}
+			doc, err := openapi.Build(&cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if drift := openapi.Drift(doc, r); len(drift) > 0 {
+				t.Errorf("the document is out of date:\n%s", strings.Join(drift, "\n"))
+			}
+		})
+	}
+}
+
+func TestDocsServesSwaggerUI(t *testing.T) {
+	var s = apitest.New(t)
+
+	var resp = s.Do(s.NewRequest(http.MethodGet, "/docs", nil))
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "swagger-ui") {
+		t.Fatalf("GET /docs answered %d without Swagger UI", resp.StatusCode)
+	}
+}
@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/logging"
+	"github.com/RashedMaaitah/goapi/internal/middleware"
+)
+
+// Drain starts the shutdown of the server through readiness, as a SIGTERM
+// would, and answers at once with a 202: the server goes on serving for
+// preStop, then drains and stops. Calls after the first change nothing.
+func Drain(readiness *Readiness, preStop time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var logger = logging.FromContext(r.Context())
+		var actor string = middleware.GetLoginDetails(r.Context()).Username
+
+		if readiness.Drain() {
+			logger.Warnf("%s asked for the server to drain", actor)
+		} else {
+			logger.Infof("%s asked for the server to drain, which it already does", actor)
+		}
+
+		api.WriteJSON(w, http.StatusAccepted, api.DrainResponse{
+			StatusCode:          http.StatusAccepted,
+			Status:              "draining",
+			PreStopDelaySeconds: int(preStop.Seconds()),
+		}, nil)
+	}
+}
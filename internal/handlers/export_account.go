@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/logging"
+	"github.com/RashedMaaitah/goapi/internal/middleware"
+	"github.com/RashedMaaitah/goapi/internal/tools"
+)
+
+// exportPageSize is how many transactions are read from the database at a
+// time while streaming an export.
+const exportPageSize = 100
+
+var exportFormats = []string{"csv", "json"}
+
+var exportCSVHeader = []string{"id", "username", "type", "amount", "counterparty", "balance", "timestamp", "actor", "reason", "currency"}
+
+// ExportAccount streams the data of the authenticated user as a download.
+// Once the first byte is out the status can no longer change, so a failure
+// halfway leaves a truncated file and is only logged.
+func ExportAccount(database tools.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var logger = logging.FromContext(r.Context())
+		var params = api.ExportParams{}
+		var err error
+
+		if violations := api.ReadQuery(r, &params); len(violations) > 0 {
+			api.ValidationErrorHandler(w, violations)
+			return
+		}
+
+		if !slices.Contains(exportFormats, params.Format) {
+			api.RequestErrorHandler(w, fmt.Errorf("Invalid format %q, must be one of: %s.", params.Format, strings.Join(exportFormats, ", ")))
+			return
+		}
+
+		var loginDetails *tools.LoginDetails = middleware.GetLoginDetails(r.Context())
+
+		coinDetails, err := database.GetUserCoins(r.Context(), loginDetails.Username)
+
+		if errors.Is(err, tools.ErrUserNotFound) {
+			logger.Errorf("No coins found for %s", loginDetails.Username)
+			api.UnauthorizedErrorHandler(w, api.CodeInvalidToken, middleware.UnAuthorizedError)
+			return
+		}
+		if err != nil {
+			api.WriteErr(w, fmt.Errorf("Export of %s: %w", loginDetails.Username, err))
+			return
+		}
+
+		var filename = fmt.Sprintf("goapi-%s-%s.%s", loginDetails.Username, time.Now().UTC().Format("20060102"), params.Format)
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+		var each = func(yield func(tools.Transaction) error) error {
+			return eachTransaction(r, database, loginDetails.Username, yield)
+		}
+
+		if params.Format == "csv" {
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			err = exportCSV(w, each)
+		} else {
+			w.Header().Set("Content-Type", "application/json")
+			err = exportJSON(w, profileResponse(loginDetails, coinDetails), each)
+		}
+
+		if err != nil {
+			logger.Errorf("Export of %s aborted: %v", loginDetails.Username, err)
+			return
+		}
+
+		logger.Infof("Exported the data of %s as %s", loginDetails.Username, params.Format)
+	}
+}
+
+// eachTransaction pages through the whole history of username, newest
+// first.
+func eachTransaction(r *http.Request, database tools.Database, username string, yield func(tools.Transaction) error) error {
+	var before int64
+	for {
+		transactions, err := database.ListTransactions(r.Context(), username, exportPageSize, before)
+		if err != nil {
+			return err
+		}
+
+		for _, t := range transactions {
+			if err := yield(t); err != nil {
+				return err
+			}
+		}
+
+		if len(transactions) < exportPageSize {
+			return nil
+		}
+		before = transactions[len(transactions)-1].Seq
+	}
+}
+
+func exportCSV(w io.Writer, each func(func(tools.Transaction) error) error) error {
+	var writer = csv.NewWriter(w)
+
+	if err := writer.Write(exportCSVHeader); err != nil {
+		return err
+	}
+
+	var err error = each(func(t tools.Transaction) error {
+		return writer.Write([]string{
+			t.ID,
+			t.Username,
+			t.Type,
+			strconv.FormatInt(t.Amount, 10),
+			t.Counterparty,
+			strconv.FormatInt(t.Balance, 10),
+			t.CreatedAt.Format(time.RFC3339Nano),
+			t.Actor,
+			t.Reason,
+			t.Currency,
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// exportJSON writes {"Profile": ..., "Transactions": [...]}, encoding the
+// transactions one at a time instead of building the array in memory.
+func exportJSON(w io.Writer, profile api.ProfileResponse, each func(func(tools.Transaction) error) error) error {
+	var encoder = json.NewEncoder(w)
+
+	if _, err := io.WriteString(w, `{"Profile":`); err != nil {
+		return err
+	}
+	if err := encoder.Encode(profile); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, `,"Transactions":[`); err != nil {
+		return err
+	}
+
+	var first = true
+	var err error = each(func(t tools.Transaction) error {
+		if !first {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		first = false
+
+		return encoder.Encode(api.Transaction{
+			ID:           t.ID,
+			Type:         t.Type,
+			Currency:     t.Currency,
+			Amount:       api.Amount(t.Amount),
+			Counterparty: t.Counterparty,
+			Balance:      api.Amount(t.Balance),
+			Timestamp:    t.CreatedAt,
+			Actor:        t.Actor,
+			Reason:       t.Reason,
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, "]}\n")
+	return err
+}
@@ -0,0 +1,53 @@
+package handlers_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/RashedMaaitah/goapi/internal/apitest"
+	"github.com/RashedMaaitah/goapi/internal/config"
+	"github.com/RashedMaaitah/goapi/internal/tools"
+)
+
+// BenchmarkExport streams the CSV export of an account of 1000
+// transactions, with and without gzip.
+func BenchmarkExport(b *testing.B) {
+	for _, tt := range []struct {
+		name     string
+		compress bool
+	}{
+		{"uncompressed", false},
+		{"gzip", true},
+	} {
+		b.Run(tt.name, func(b *testing.B) {
+			var s = apitest.New(b, apitest.WithConfig(func(cfg *config.Config) {
+				cfg.Server.Compression.Enabled = tt.compress
+				// Benchmarks show what they log even when they pass.
+				cfg.Log.Level = "error"
+			}))
+			for i := 0; i < 1000; i++ {
+				if _, err := s.Database.AdjustUserCoins(context.Background(), "alex", tools.DefaultCurrency, 1, 0); err != nil {
+					b.Fatal(err)
+				}
+			}
+
+			for b.Loop() {
+				var req = s.NewAuthedRequest("alex", http.MethodGet, "/v1/account/export?format=csv", nil)
+				// Set, the transport leaves the response compressed.
+				req.Header.Set("Accept-Encoding", "gzip")
+				var resp = s.Do(req)
+				n, err := io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+				if err != nil || resp.StatusCode != http.StatusOK {
+					b.Fatalf("answered %d, %v, want 200", resp.StatusCode, err)
+				}
+				if encoding := resp.Header.Get("Content-Encoding"); (encoding == "gzip") != tt.compress {
+					b.Fatalf("Content-Encoding = %q, want gzip %v", encoding, tt.compress)
+				}
+				b.SetBytes(n)
+			}
+		})
+	}
+}
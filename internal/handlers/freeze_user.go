@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/audit"
+	"github.com/RashedMaaitah/goapi/internal/logging"
+	"github.com/RashedMaaitah/goapi/internal/middleware"
+	"github.com/RashedMaaitah/goapi/internal/tools"
+)
+
+// FreezeUser blocks deposits, withdrawals and transfers of the user in the
+// path until UnfreezeUser is called.
+func FreezeUser(database tools.Database, auditor audit.Auditor) http.HandlerFunc {
+	return setFrozen(database, auditor, true)
+}
+
+func UnfreezeUser(database tools.Database, auditor audit.Auditor) http.HandlerFunc {
+	return setFrozen(database, auditor, false)
+}
+
+func setFrozen(database tools.Database, auditor audit.Auditor, frozen bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var logger = logging.FromContext(r.Context())
+		var params = api.FreezeParams{}
+		var err error
+
+		err = api.ReadJSON(w, r, &params)
+
+		if err != nil {
+			logger.Error(err)
+			api.BodyErrorHandler(w, err)
+			return
+		}
+
+		var reason string = strings.TrimSpace(params.Reason)
+		if reason == "" {
+			api.RequestErrorHandler(w, MissingReasonError)
+			return
+		}
+
+		var actor string = middleware.GetLoginDetails(r.Context()).Username
+		var username string = middleware.PathUsername(r)
+
+		_, err = database.SetFrozen(r.Context(), username, frozen, actor, reason)
+
+		var action string = audit.ActionUnfreeze
+		if frozen {
+			action = audit.ActionFreeze
+		}
+		auditor.Record(r.Context(), tools.AuditEntry{Actor: actor, Action: action, Target: username}, err)
+
+		if err != nil {
+			api.WriteErr(w, err)
+			return
+		}
+
+		logger.Infof("%s set frozen=%v on %s: %s", actor, frozen, username, reason)
+
+		var response = api.FreezeResponse{
+			StatusCode: http.StatusOK,
+			Username:   username,
+			Frozen:     frozen,
+		}
+
+		api.WriteJSON(w, http.StatusOK, response, nil)
+	}
+}
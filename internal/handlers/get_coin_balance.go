@@ -1,56 +1,161 @@
 package handlers
 
 import (
-	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/config"
+	"github.com/RashedMaaitah/goapi/internal/logging"
+	"github.com/RashedMaaitah/goapi/internal/middleware"
 	"github.com/RashedMaaitah/goapi/internal/tools"
-	"github.com/gorilla/schema"
-	log "github.com/sirupsen/logrus"
 )
 
-func GetCoinBalance(w http.ResponseWriter, r *http.Request) {
-	var params = api.CoinBalanceParams{}
-	var decoder *schema.Decoder = schema.NewDecoder()
-	var err error
+var InvalidAsOfError = errors.New("as_of must be an RFC 3339 time, such as 2024-06-01T00:00:00Z.")
 
-	err = decoder.Decode(&params, r.URL.Query())
+// GetCoinBalance returns the balances of the authenticated user, or with
+// ?currency= only the one in that currency. When the database fails, the
+// last balances stale kept are served instead. With ?as_of= in the past
+// they are those of that time, summed from the ledger.
+//
+// Fresh balances carry an ETag, and a request whose If-None-Match has it
+// gets a 304 instead. The tag follows the version of the balances, so a
+// client revalidating costs no more than the call to GetUserCoins, which
+// is answered from the cache when there is one. Stale balances carry none,
+// as their version may not be the current one.
+func GetCoinBalance(cfg config.APIConfig, database tools.Database, stale *tools.LastKnownGood) http.HandlerFunc {
+	return coinBalance(cfg, database, stale, func(r *http.Request) string {
+		return middleware.GetLoginDetails(r.Context()).Username
+	})
+}
 
-	if err != nil {
-		log.Error(err)
-		api.InternalErrorHandler(w)
-		return
+// GetUserCoinBalance is GetCoinBalance for the user in the path.
+func GetUserCoinBalance(cfg config.APIConfig, database tools.Database, stale *tools.LastKnownGood) http.HandlerFunc {
+	return coinBalance(cfg, database, stale, middleware.PathUsername)
+}
+
+func coinBalance(cfg config.APIConfig, database tools.Database, stale *tools.LastKnownGood, user func(*http.Request) string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var logger = logging.FromContext(r.Context())
+		var username string = user(r)
+		var params = api.CoinBalanceParams{}
+		var err error
+
+		if violations := api.ReadQuery(r, &params); len(violations) > 0 {
+			api.ValidationErrorHandler(w, violations)
+			return
+		}
+
+		var currency string
+		currency, err = resolveCurrency(cfg, params.Currency)
+
+		if err != nil {
+			api.RequestErrorHandler(w, err)
+			return
+		}
+
+		if params.AsOf != "" {
+			at, err := time.Parse(time.RFC3339, params.AsOf)
+			if err != nil {
+				api.RequestErrorHandler(w, InvalidAsOfError)
+				return
+			}
+			// A time to come gets the balances of now.
+			if at.Before(time.Now()) {
+				balanceAsOf(w, r, cfg, database, username, params.Currency, currency, at)
+				return
+			}
+		}
+
+		var tokenDetails *tools.CoinDetails
+		tokenDetails, err = database.GetUserCoins(r.Context(), username)
+
+		var asOf time.Time
+		if cached, at, ok := stale.Fallback(username, err); ok {
+			logger.Warnf("Serving the balance of %s as of %s: %v", username, at.Format(time.RFC3339), err)
+			tokenDetails, asOf, err = cached, at, nil
+		}
+
+		if err != nil {
+			api.WriteErr(w, fmt.Errorf("Balance of %s: %w", username, err))
+			return
+		}
+
+		logger.Debugf("Balance of %s is %d", username, tokenDetails.Coins)
+
+		w.Header().Set("Cache-Control", "private, max-age=0, must-revalidate")
+		if asOf.IsZero() {
+			var etag string = api.ETag(username, strconv.FormatInt(tokenDetails.Version, 10), params.Currency, currency, api.MediaType(r))
+			w.Header().Set("ETag", etag)
+			if api.NotModified(r, etag) {
+				w.Header().Add("Vary", "Accept")
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+
+		var balances map[string]int64 = tokenDetails.AllBalances()
+		if params.Currency != "" {
+			balances = map[string]int64{currency: tokenDetails.Balance(currency)}
+		}
+
+		var response = api.CoinBalanceResponse{
+			Balance:  api.Amount(tokenDetails.Balance(currency)),
+			Currency: currency,
+			Balances: api.Amounts(balances),
+			Frozen:   tokenDetails.Frozen,
+		}
+		if cfg.StatusCodeInBody {
+			response.StatusCode = http.StatusOK
+		}
+
+		var headers http.Header
+		if !asOf.IsZero() {
+			response.AsOf = &asOf
+			headers = staleHeaders()
+		}
+
+		api.WriteJSON(w, http.StatusOK, response, headers)
 	}
+}
+
+func balanceAsOf(w http.ResponseWriter, r *http.Request, cfg config.APIConfig, database tools.Database, username string, requested string, currency string, at time.Time) {
+	balances, err := database.GetBalanceAsOf(r.Context(), username, at)
 
-	var database *tools.DatabaseInterface
-	database, err = tools.NewDatabase()
 	if err != nil {
-		log.Error(err)
-		api.InternalErrorHandler(w)
+		api.WriteErr(w, fmt.Errorf("Balance of %s as of %s: %w", username, at.Format(time.RFC3339), err))
 		return
 	}
 
-	var tokenDetails *tools.CoinDetails
-	tokenDetails = (*database).GetUserCoins(params.Username)
-
-	if tokenDetails == nil {
-		log.Error(err)
-		api.InternalErrorHandler(w)
-		return
+	var balance int64 = balances[currency]
+	if _, ok := balances[tools.DefaultCurrency]; !ok {
+		balances[tools.DefaultCurrency] = 0
+	}
+	if requested != "" {
+		balances = map[string]int64{currency: balance}
 	}
 
 	var response = api.CoinBalanceResponse{
-		Balance:    (*&tokenDetails).Coins,
-		StatusCode: http.StatusOK,
+		Balance:  api.Amount(balance),
+		Currency: currency,
+		Balances: api.Amounts(balances),
+		AsOf:     &at,
+	}
+	if cfg.StatusCodeInBody {
+		response.StatusCode = http.StatusOK
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(response)
+	w.Header().Set("Cache-Control", "private, max-age=0, must-revalidate")
+	api.WriteJSON(w, http.StatusOK, response, nil)
+}
 
-	if err != nil {
-		log.Error(err)
-		api.InternalErrorHandler(w)
-		return
+// staleHeaders mark a response served from tools.LastKnownGood.
+func staleHeaders() http.Header {
+	return http.Header{
+		"Warning": {`110 - "Response is Stale"`},
+		"X-Stale": {"true"},
 	}
 }
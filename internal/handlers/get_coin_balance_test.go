@@ -0,0 +1,230 @@
+package handlers_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/apitest"
+	"github.com/RashedMaaitah/goapi/internal/config"
+	"github.com/RashedMaaitah/goapi/internal/handlers"
+)
+
+func TestCoinBalanceUsernameMustMatchTheToken(t *testing.T) {
+	var s = apitest.New(t)
+
+	t.Run("someone else's", func(t *testing.T) {
+		var req = s.NewAuthedRequest("alex", http.MethodGet, "/v1/account/coins?username=maria", nil)
+		apitest.DecodeError(t, s.Do(req), http.StatusForbidden, api.CodeUsernameMismatch)
+	})
+
+	for _, username := range []string{"alex", "ALEX"} {
+		t.Run("own as "+username, func(t *testing.T) {
+			var req = s.NewAuthedRequest("alex", http.MethodGet, "/v1/account/coins?username="+username, nil)
+			if balance := apitest.Decode[api.CoinBalanceResponse](t, s.Do(req), http.StatusOK); balance.Balance != 1000 {
+				t.Errorf("balance = %s, want 1000", balance.Balance)
+			}
+		})
+	}
+}
+
+func TestUserCoinBalanceOwnerOrAdmin(t *testing.T) {
+	var s = apitest.New(t)
+
+	for _, tt := range []struct {
+		user   string
+		path   string
+		status int
+	}{
+		{"alex", "/v1/users/alex/coins", http.StatusOK},
+		{"admin", "/v1/users/maria/coins", http.StatusOK},
+		{"alex", "/v1/users/maria/coins", http.StatusForbidden},
+	} {
+		t.Run(tt.user+" "+tt.path, func(t *testing.T) {
+			var resp = s.Do(s.NewAuthedRequest(tt.user, http.MethodGet, tt.path, nil))
+			if tt.status != http.StatusOK {
+				apitest.DecodeError(t, resp, tt.status, api.CodeInsufficientRole)
+				return
+			}
+			apitest.Decode[api.CoinBalanceResponse](t, resp, tt.status)
+		})
+	}
+}
+
+func TestCanceledCoinBalanceReturnsPromptly(t *testing.T) {
+	var s = apitest.New(t,
+		apitest.WithConfig(func(cfg *config.Config) { cfg.Database.Latency = config.Duration(time.Hour) }),
+		apitest.WithHandlerOptions(handlers.WithAuthDisabled()),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	var req = httptest.NewRequestWithContext(ctx, http.MethodGet, "/v1/account/coins", nil)
+	var rec = httptest.NewRecorder()
+
+	var start = time.Now()
+	s.Server.Config.Handler.ServeHTTP(rec, req)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("the request returned after %s", elapsed)
+	}
+	apitest.DecodeError(t, rec.Result(), http.StatusServiceUnavailable, api.CodeTimeout)
+}
+
+func TestCoinBalanceMalformedQuery(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		query  string
+		status int
+		code   string
+		// want are the fields and rules of the violations.
+		want [][2]string
+		// validated is set for the cases the validation of requests alone
+		// catches: otherwise the token, of another user, is refused first.
+		validated bool
+	}{
+		{"unknown parameter", "foo=1", http.StatusBadRequest, api.CodeValidationFailed, [][2]string{{"foo", "unknown"}}, false},
+		{"unknown parameters as sent", "FOO=1&bar=2", http.StatusBadRequest, api.CodeValidationFailed, [][2]string{{"FOO", "unknown"}, {"bar", "unknown"}}, false},
+		{"unknown parameter among known ones", "currency=coins&x=1", http.StatusBadRequest, api.CodeValidationFailed, [][2]string{{"x", "unknown"}}, false},
+		{"known parameter in another case", "Currency=coins", http.StatusOK, "", nil, false},
+		{"time of the wrong format", "as_of=yesterday", http.StatusBadRequest, api.CodeInvalidRequest, nil, false},
+		{"unknown currency", "currency=nope", http.StatusBadRequest, api.CodeInvalidRequest, nil, false},
+		{"invalid username", "username=a%20b", http.StatusBadRequest, api.CodeValidationFailed, [][2]string{{"username", "username"}}, true},
+		{"empty username", "username=", http.StatusBadRequest, api.CodeValidationFailed, [][2]string{{"username", "username"}}, true},
+	} {
+		for _, validate := range []bool{true, false} {
+			if tt.validated && !validate {
+				continue
+			}
+			t.Run(fmt.Sprintf("%s validated %v", tt.name, validate), func(t *testing.T) {
+				var s = apitest.New(t, apitest.WithConfig(func(cfg *config.Config) { cfg.API.ValidateRequests = validate }))
+
+				var resp = s.Do(s.NewAuthedRequest("alex", http.MethodGet, "/v1/account/coins?"+tt.query, nil))
+				if tt.code == "" {
+					apitest.Decode[api.CoinBalanceResponse](t, resp, tt.status)
+					return
+				}
+
+				var apiErr = apitest.DecodeError(t, resp, tt.status, tt.code)
+				var got [][2]string
+				var messages = []string{apiErr.Message}
+				for _, violation := range apiErr.Violations {
+					got = append(got, [2]string{violation.Field, violation.Rule})
+					messages = append(messages, violation.Message)
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("violations = %+v, want fields and rules %v", apiErr.Violations, tt.want)
+				}
+				// Neither the decoder nor the validator is named to clients.
+				for _, message := range messages {
+					if strings.Contains(message, "schema:") || strings.Contains(message, "openapi") {
+						t.Errorf("message %q names a package", message)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestCoinBalanceUnknownQueryNotStrict(t *testing.T) {
+	for _, validate := range []bool{true, false} {
+		t.Run(fmt.Sprintf("validated %v", validate), func(t *testing.T) {
+			var s = apitest.New(t, apitest.WithConfig(func(cfg *config.Config) {
+				cfg.API.ValidateRequests = validate
+				cfg.API.StrictQuery = false
+			}))
+
+			var req = s.NewAuthedRequest("alex", http.MethodGet, "/v1/account/coins?foo=1", nil)
+			apitest.Decode[api.CoinBalanceResponse](t, s.Do(req), http.StatusOK)
+		})
+	}
+}
+
+func TestCoinBalanceETag(t *testing.T) {
+	var s = apitest.New(t)
+	var get = func(ifNoneMatch string) *http.Response {
+		var req = s.NewAuthedRequest("alex", http.MethodGet, "/v1/account/coins", nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		return s.Do(req)
+	}
+
+	var first = get("")
+	first.Body.Close()
+	var etag string = first.Header.Get("ETag")
+	if first.StatusCode != http.StatusOK || !strings.HasPrefix(etag, `"`) {
+		t.Fatalf("answered %d with the ETag %q, want 200 with a strong one", first.StatusCode, etag)
+	}
+
+	for _, tt := range []struct {
+		name        string
+		ifNoneMatch string
+		status      int
+	}{
+		{"match", etag, http.StatusNotModified},
+		{"mismatch", `"other"`, http.StatusOK},
+		{"list with it", `"other", ` + etag + `, "another"`, http.StatusNotModified},
+		{"list without it", `"other", "another"`, http.StatusOK},
+		{"any", "*", http.StatusNotModified},
+		{"weak", "W/" + etag, http.StatusNotModified},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp = get(tt.ifNoneMatch)
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.status {
+				t.Fatalf("answered %d, want %d", resp.StatusCode, tt.status)
+			}
+			if resp.Header.Get("ETag") != etag {
+				t.Errorf("ETag = %q, want %q", resp.Header.Get("ETag"), etag)
+			}
+			if tt.status == http.StatusNotModified && len(body) != 0 {
+				t.Errorf("body of the 304 = %s, want none", body)
+			}
+		})
+	}
+
+	t.Run("after a change", func(t *testing.T) {
+		apitest.Decode[api.CoinBalanceResponse](t, s.Do(s.NewAuthedRequest("alex", http.MethodPost, "/v1/account/coins/deposit", map[string]any{"amount": 5})), http.StatusOK)
+
+		var resp = get(etag)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("ETag") == etag {
+			t.Errorf("answered %d with the ETag %q, want 200 with another than %q", resp.StatusCode, resp.Header.Get("ETag"), etag)
+		}
+	})
+}
+
+// The tag of a compressed balance is weak, and still matches.
+func TestCompressedCoinBalanceETag(t *testing.T) {
+	var s = apitest.New(t, apitest.WithConfig(func(cfg *config.Config) { cfg.Server.Compression.MinSize = 0 }))
+	var get = func(ifNoneMatch string) *http.Response {
+		var req = s.NewAuthedRequest("alex", http.MethodGet, "/v1/account/coins", nil)
+		// Set, the transport leaves the response compressed.
+		req.Header.Set("Accept-Encoding", "gzip")
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		return s.Do(req)
+	}
+
+	var first = get("")
+	first.Body.Close()
+	var etag string = first.Header.Get("ETag")
+	if first.Header.Get("Content-Encoding") != "gzip" || !strings.HasPrefix(etag, `W/"`) {
+		t.Fatalf("answered %q with the ETag %q, want gzip with a weak one", first.Header.Get("Content-Encoding"), etag)
+	}
+	var resp = get(etag)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotModified {
+		t.Errorf("answered %d, want 304", resp.StatusCode)
+	}
+}
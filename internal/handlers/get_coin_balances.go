@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/logging"
+	"github.com/RashedMaaitah/goapi/internal/tools"
+)
+
+const (
+	maxBatchUsernames = 100
+	batchWorkers      = 8
+)
+
+const notFoundResult = "not found"
+
+// GetCoinBalances looks up the balances of many users at once, with at most
+// batchWorkers lookups in flight. A failed lookup only fails its own entry,
+// or serves the last balance stale kept.
+func GetCoinBalances(database tools.Database, stale *tools.LastKnownGood) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var logger = logging.FromContext(r.Context())
+		var params = api.BatchBalanceParams{}
+		var err error
+
+		err = api.ReadJSON(w, r, &params)
+
+		if err != nil {
+			logger.Error(err)
+			api.BodyErrorHandler(w, err)
+			return
+		}
+
+		if len(params.Usernames) == 0 || len(params.Usernames) > maxBatchUsernames {
+			api.RequestErrorHandler(w, fmt.Errorf("Usernames must list between 1 and %d users.", maxBatchUsernames))
+			return
+		}
+		for i, username := range params.Usernames {
+			params.Usernames[i] = api.NormalizeUsername(username)
+		}
+
+		var results = make([]api.BatchBalanceResult, len(params.Usernames))
+		var jobs = make(chan int)
+		var wg sync.WaitGroup
+
+		for range min(batchWorkers, len(params.Usernames)) {
+			wg.Go(func() {
+				for i := range jobs {
+					results[i] = lookupBalance(r, database, stale, params.Usernames[i])
+				}
+			})
+		}
+		for i := range params.Usernames {
+			jobs <- i
+		}
+		close(jobs)
+		wg.Wait()
+
+		var response = api.BatchBalanceResponse{
+			StatusCode: http.StatusOK,
+			Results:    results,
+			Balances:   map[string]api.Amount{},
+			NotFound:   []string{},
+		}
+		var headers http.Header
+		for _, result := range results {
+			if result.AsOf != nil {
+				headers = staleHeaders()
+			}
+			switch {
+			case result.Balance != nil:
+				response.Balances[result.Username] = *result.Balance
+			case result.Error == notFoundResult:
+				response.NotFound = append(response.NotFound, result.Username)
+			}
+		}
+
+		api.WriteJSON(w, http.StatusOK, response, headers)
+	}
+}
+
+func lookupBalance(r *http.Request, database tools.Database, stale *tools.LastKnownGood, username string) api.BatchBalanceResult {
+	var result = api.BatchBalanceResult{Username: username}
+
+	if err := r.Context().Err(); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	coinDetails, err := database.GetUserCoins(r.Context(), username)
+	if cached, asOf, ok := stale.Fallback(username, err); ok {
+		logging.FromContext(r.Context()).Warnf("Serving the balance of %s as of %s: %v", username, asOf.Format(time.RFC3339), err)
+		coinDetails, err = cached, nil
+		result.AsOf = &asOf
+	}
+	if errors.Is(err, tools.ErrUserNotFound) {
+		result.Error = notFoundResult
+		return result
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Errorf("Balance of %s: %v", username, err)
+		result.Error = err.Error()
+		return result
+	}
+
+	var balance = api.Amount(coinDetails.Coins)
+	result.Balance = &balance
+	return result
+}
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/leaderboard"
+	"github.com/RashedMaaitah/goapi/internal/logging"
+	"github.com/RashedMaaitah/goapi/internal/tools"
+)
+
+const (
+	defaultLeaderboardLimit = 10
+	maxLeaderboardLimit     = 100
+)
+
+// leaderboardPage is the key of a cached page of the leaderboard.
+type leaderboardPage struct {
+	offset int
+	limit  int
+}
+
+// GetLeaderboard ranks users by balance, a page at a time, its cursors
+// carrying the rank the next page starts after. Once board has a ranking
+// the pages come from it, with an ETag and a Last-Modified that
+// conditional requests are answered a 304 against, and are marked stale
+// while board fails to refresh. Otherwise they are read from the database,
+// and with a positive ttl cached for that long. The Cache-Control header
+// lets clients cache them for ttl too.
+func GetLeaderboard(database tools.Database, board *leaderboard.Board, cursors *api.Cursors, ttl time.Duration) http.HandlerFunc {
+	var cache *responseCache[leaderboardPage, api.LeaderboardResponse]
+	if ttl > 0 {
+		cache = newResponseCache[leaderboardPage, api.LeaderboardResponse](ttl)
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		var logger = logging.FromContext(r.Context())
+		var params = api.LeaderboardParams{}
+		var err error
+
+		if violations := api.ReadQuery(r, &params); len(violations) > 0 {
+			api.ValidationErrorHandler(w, violations)
+			return
+		}
+
+		var page = leaderboardPage{}
+		page.limit, err = params.PageLimit(defaultLeaderboardLimit, maxLeaderboardLimit)
+		if err != nil {
+			api.RequestErrorHandler(w, err)
+			return
+		}
+
+		if params.Cursor != "" {
+			offset, err := cursors.Decode(leaderboardCursor, params.Cursor)
+			if err != nil {
+				logger.Warnf("Invalid leaderboard cursor %q", params.Cursor)
+				api.RequestErrorHandler(w, err)
+				return
+			}
+			page.offset = int(offset)
+		}
+
+		if ranking := board.Ranking(); ranking != nil {
+			rankedLeaderboard(w, r, ranking, board.Stale(), page, cursors, ttl)
+			return
+		}
+
+		var now = time.Now()
+		var response api.LeaderboardResponse
+		var cached bool
+		if cache != nil {
+			response, cached = cache.get(page, now)
+		}
+
+		if !cached {
+			// One extra user tells whether there is a next page.
+			var users []tools.CoinDetails
+			users, err = database.GetTopUsers(r.Context(), page.offset, page.limit+1)
+
+			if err != nil {
+				logger.Error(err)
+				api.InternalErrorHandler(w)
+				return
+			}
+
+			response = leaderboardResponse(users, page, cursors)
+			if cache != nil {
+				cache.put(page, response, now)
+			}
+		}
+
+		if cache != nil {
+			w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(ttl.Seconds())))
+		}
+		api.WriteJSON(w, http.StatusOK, response, nil)
+	}
+}
+
+// rankedLeaderboard writes the page of ranking, or a 304 when the client
+// has it already.
+func rankedLeaderboard(w http.ResponseWriter, r *http.Request, ranking *leaderboard.Ranking, stale bool, page leaderboardPage, cursors *api.Cursors, ttl time.Duration) {
+	var etag string = api.ETag(ranking.Version, strconv.Itoa(page.offset), strconv.Itoa(page.limit), api.MediaType(r))
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Last-Modified", ranking.Modified.UTC().Format(http.TimeFormat))
+	if ttl > 0 {
+		w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(ttl.Seconds())))
+	} else {
+		w.Header().Set("Cache-Control", "public, no-cache")
+	}
+	if stale {
+		for name, values := range staleHeaders() {
+			w.Header()[name] = values
+		}
+	}
+
+	if api.NotModified(r, etag) || api.NotModifiedSince(r, ranking.Modified) {
+		w.Header().Add("Vary", "Accept")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	// Like the database, with one extra user telling whether there is a
+	// next page.
+	var users []tools.CoinDetails
+	if page.offset < len(ranking.Users) {
+		users = ranking.Users[page.offset:min(page.offset+page.limit+1, len(ranking.Users))]
+	}
+	api.WriteJSON(w, http.StatusOK, leaderboardResponse(users, page, cursors), nil)
+}
+
+// leaderboardResponse is page of the leaderboard from its users, which have
+// one more than the page when there is a next one.
+func leaderboardResponse(users []tools.CoinDetails, page leaderboardPage, cursors *api.Cursors) api.LeaderboardResponse {
+	var response = api.LeaderboardResponse{
+		StatusCode:   http.StatusOK,
+		PageResponse: api.PageResponse[api.LeaderboardEntry]{Items: make([]api.LeaderboardEntry, 0, len(users))},
+	}
+	if len(users) > page.limit {
+		users = users[:page.limit]
+		response.NextCursor = cursors.Encode(leaderboardCursor, int64(page.offset+page.limit))
+	} else {
+		response.Total = pageTotal(page.offset, len(users))
+	}
+	for i, user := range users {
+		response.Items = append(response.Items, api.LeaderboardEntry{
+			Rank:     page.offset + i + 1,
+			Username: user.Username,
+			Balance:  api.Amount(user.Coins),
+		})
+	}
+	return response
+}
+
+// RefreshLeaderboard ranks the users of board at once, after the refresh in
+// progress if there is one, so that the leaderboard serves the new ranking.
+func RefreshLeaderboard(board *leaderboard.Board) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var logger = logging.FromContext(r.Context())
+
+		ranking, err := board.Refresh(r.Context())
+
+		if err != nil {
+			api.WriteErr(w, fmt.Errorf("Refreshing the leaderboard: %w", err))
+			return
+		}
+
+		logger.Infof("Leaderboard refreshed, %d users", len(ranking.Users))
+		api.WriteJSON(w, http.StatusOK, api.LeaderboardRefreshResponse{
+			StatusCode: http.StatusOK,
+			Users:      len(ranking.Users),
+			Modified:   ranking.Modified,
+			Refreshed:  ranking.Refreshed,
+		}, nil)
+	}
+}
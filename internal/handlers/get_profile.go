@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/logging"
+	"github.com/RashedMaaitah/goapi/internal/middleware"
+	"github.com/RashedMaaitah/goapi/internal/tools"
+)
+
+func GetProfile(database tools.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var logger = logging.FromContext(r.Context())
+		var loginDetails *tools.LoginDetails = middleware.GetLoginDetails(r.Context())
+
+		coinDetails, err := database.GetUserCoins(r.Context(), loginDetails.Username)
+
+		// Deleted since the middleware looked the user up.
+		if errors.Is(err, tools.ErrUserNotFound) {
+			logger.Errorf("No coins found for %s", loginDetails.Username)
+			api.UnauthorizedErrorHandler(w, api.CodeInvalidToken, middleware.UnAuthorizedError)
+			return
+		}
+		if err != nil {
+			api.WriteErr(w, fmt.Errorf("Profile of %s: %w", loginDetails.Username, err))
+			return
+		}
+
+		var response api.ProfileResponse = profileResponse(loginDetails, coinDetails)
+
+		api.WriteJSON(w, http.StatusOK, response, nil)
+	}
+}
+
+func profileResponse(loginDetails *tools.LoginDetails, coinDetails *tools.CoinDetails) api.ProfileResponse {
+	return api.ProfileResponse{
+		StatusCode:  http.StatusOK,
+		Username:    loginDetails.Username,
+		DisplayName: loginDetails.DisplayName,
+		Email:       loginDetails.Email,
+		Balance:     api.Amount(coinDetails.Coins),
+		Role:        loginDetails.Role,
+		CreatedAt:   loginDetails.CreatedAt,
+	}
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/logging"
+	"github.com/RashedMaaitah/goapi/internal/tools"
+)
+
+// statsBounds are the edges of the balance histogram.
+var statsBounds = []int64{0, 100, 1000, 10000, 100000}
+
+func GetStats(database tools.Database, ttl time.Duration) http.HandlerFunc {
+	var cache *responseCache[struct{}, api.StatsResponse]
+	if ttl > 0 {
+		cache = newResponseCache[struct{}, api.StatsResponse](ttl)
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		var logger = logging.FromContext(r.Context())
+		var err error
+
+		var now = time.Now()
+		var response api.StatsResponse
+		var cached bool
+		if cache != nil {
+			response, cached = cache.get(struct{}{}, now)
+		}
+
+		if !cached {
+			var stats *tools.Stats
+			stats, err = database.GetStats(r.Context(), statsBounds)
+
+			if err != nil {
+				logger.Error(err)
+				api.InternalErrorHandler(w)
+				return
+			}
+
+			response = statsResponse(stats, now)
+			if cache != nil {
+				cache.put(struct{}{}, response, now)
+			}
+		}
+
+		api.WriteJSON(w, http.StatusOK, response, nil)
+	}
+}
+
+func statsResponse(stats *tools.Stats, now time.Time) api.StatsResponse {
+	var response = api.StatsResponse{
+		StatusCode:  http.StatusOK,
+		Users:       stats.Users,
+		TotalCoins:  api.Amount(stats.TotalCoins),
+		Histogram:   make([]api.HistogramBucket, len(stats.Buckets)),
+		GeneratedAt: now.UTC(),
+	}
+
+	if stats.Users > 0 {
+		response.AverageBalance = float64(stats.TotalCoins) / float64(stats.Users)
+	}
+
+	for i, count := range stats.Buckets {
+		var bucket = api.HistogramBucket{Count: count}
+		if i > 0 {
+			bucket.From = &statsBounds[i-1]
+		}
+		if i < len(statsBounds) {
+			bucket.To = &statsBounds[i]
+		}
+		response.Histogram[i] = bucket
+	}
+
+	return response
+}
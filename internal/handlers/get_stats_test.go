@@ -0,0 +1,26 @@
+package handlers_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/apitest"
+)
+
+func TestAdminRouteRequiresTheAdminRole(t *testing.T) {
+	var s = apitest.New(t)
+
+	t.Run("allowed", func(t *testing.T) {
+		var stats = apitest.Decode[api.StatsResponse](t, s.Do(s.NewAuthedRequest("admin", http.MethodGet, "/v1/admin/stats", nil)), http.StatusOK)
+		if stats.Users == 0 {
+			t.Errorf("stats = %+v, want the demo users counted", stats)
+		}
+	})
+	t.Run("forbidden", func(t *testing.T) {
+		apitest.DecodeError(t, s.Do(s.NewAuthedRequest("alex", http.MethodGet, "/v1/admin/stats", nil)), http.StatusForbidden, api.CodeInsufficientRole)
+	})
+	t.Run("unauthenticated", func(t *testing.T) {
+		apitest.DecodeError(t, s.Do(s.NewRequest(http.MethodGet, "/v1/admin/stats", nil)), http.StatusUnauthorized, api.CodeMissingToken)
+	})
+}
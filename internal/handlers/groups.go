@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/RashedMaaitah/goapi/internal/auth"
+	"github.com/RashedMaaitah/goapi/internal/config"
+	"github.com/RashedMaaitah/goapi/internal/middleware"
+	"github.com/RashedMaaitah/goapi/internal/ratelimit"
+	"github.com/RashedMaaitah/goapi/internal/tools"
+	"github.com/go-chi/chi"
+)
+
+// groupChains are the middleware of the route groups, by group.
+type groupChains map[string]chi.Middlewares
+
+// adminBootstrap is the chain of the /admin routes: that of the admin group
+// with the bootstrap admin accepted too. The other routes of the group,
+// such as DELETE /users/{username}, take the tokens of admins alone.
+const adminBootstrap = config.GroupAdmin + "+bootstrap"
+
+// newGroupChains builds the chains cfg.Middleware gives the route groups,
+// leaving out the middleware the config turns off, and logs them. Stateful
+// middleware such as the rate limiters is created once, so that the groups
+// share it, and so do the /v1 routes and their legacy aliases. validate is
+// nil when requests aren't validated.
+func newGroupChains(o *options, validate func(http.Handler) http.Handler) groupChains {
+	var cfg = o.cfg
+
+	// Mounted while disabled too, as a reload may enable them. They set
+	// the limits in effect.
+	var rateLimit = middleware.RateLimit(ratelimit.New(0, 0, ratelimit.SystemClock), o.live)
+	var adminRateLimit = middleware.AdminRateLimit(ratelimit.New(0, 0, ratelimit.SystemClock), o.live)
+	var userRateLimit = middleware.UserRateLimit(ratelimit.New(0, 0, ratelimit.SystemClock), o.live)
+
+	var timeout, compress, concurrency func(http.Handler) http.Handler
+	if d := cfg.Server.RequestTimeout.Duration(); d > 0 {
+		timeout = middleware.Timeout(d)
+	}
+	// Inside the recoverer, so a panic before anything was sent still gets
+	// its 500.
+	if cfg.Server.Compression.Enabled {
+		compress = middleware.Compress(cfg.Server.Compression)
+	}
+	if cfg.Server.Concurrency.Max > 0 {
+		concurrency = middleware.ConcurrencyLimit(cfg.Server.Concurrency, o.metrics)
+	}
+
+	var authorize = middleware.Authorization(auth.NewTokenSource(cfg.Auth), o.authenticator, o.lockouts, cfg.RateLimit.TrustProxy)
+	// The bootstrap admin is only an admin of the /admin routes, followed
+	// on those by the reloads of its token.
+	var bootstrap = &auth.BootstrapAuthenticator{Source: auth.NewTokenSource(cfg.Auth), Live: o.live}
+	var authorizeAdmin = middleware.Authorization(auth.NewTokenSource(cfg.Auth), auth.Chain{bootstrap, o.authenticator}, o.lockouts, cfg.RateLimit.TrustProxy)
+
+	var chains = groupChains{}
+	for _, group := range cfg.Middleware.Groups() {
+		var names []string
+		for _, name := range group.Chain {
+			var mw, bootstrapMw chi.Middlewares
+			switch name {
+			case config.MiddlewareRecoverer:
+				mw = chi.Chain(middleware.Recoverer)
+			case config.MiddlewareTimeout:
+				mw = chainOf(timeout)
+			case config.MiddlewareCompress:
+				mw = chainOf(compress)
+			case config.MiddlewareRateLimit:
+				mw = chi.Chain(rateLimit)
+			case config.MiddlewareAdminRateLimit:
+				mw = chi.Chain(adminRateLimit)
+			case config.MiddlewareMaintenance:
+				mw = chi.Chain(middleware.Maintenance(o.maintenance))
+			case config.MiddlewareConcurrency:
+				mw = chainOf(concurrency)
+			case config.MiddlewareValidate:
+				mw = chainOf(validate)
+			case config.MiddlewareAuthorize:
+				mw = chi.Chain(authorize)
+				if group.Name == config.GroupAdmin {
+					mw = chi.Chain(authorize, middleware.RequireRole(tools.RoleAdmin))
+					bootstrapMw = chi.Chain(authorizeAdmin, middleware.RequireRole(tools.RoleAdmin))
+				}
+			case config.MiddlewareUserRateLimit:
+				mw = chi.Chain(userRateLimit)
+			}
+			if len(mw) == 0 {
+				continue
+			}
+			chains[group.Name] = append(chains[group.Name], mw...)
+			if group.Name == config.GroupAdmin {
+				if bootstrapMw == nil {
+					bootstrapMw = mw
+				}
+				chains[adminBootstrap] = append(chains[adminBootstrap], bootstrapMw...)
+			}
+			names = append(names, name)
+		}
+		o.logger.Infof("Middleware of the %s routes: %s", group.Name, chainString(names))
+	}
+	return chains
+}
+
+// chainOf is the chain of mw, empty if it is nil.
+func chainOf(mw func(http.Handler) http.Handler) chi.Middlewares {
+	if mw == nil {
+		return nil
+	}
+	return chi.Chain(mw)
+}
+
+func chainString(names []string) string {
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, " > ")
+}
@@ -0,0 +1,185 @@
+package handlers_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/apitest"
+	"github.com/RashedMaaitah/goapi/internal/config"
+)
+
+// groupRoutes are a route of each group, requested as user.
+var groupRoutes = []struct {
+	group string
+	path  string
+	user  string
+}{
+	{config.GroupOps, "/readyz", ""},
+	{config.GroupPublic, "/v1/leaderboard", ""},
+	{config.GroupAuthenticated, "/v1/account/coins", "alex"},
+	{config.GroupAdmin, "/v1/admin/stats", "admin"},
+	{config.GroupStreaming, "/v1/account/coins/stream", "alex"},
+}
+
+// TestGroupMiddleware checks that the middleware of each group of the
+// default config takes effect on its routes, and only on those.
+func TestGroupMiddleware(t *testing.T) {
+	for _, tt := range []struct {
+		middleware string
+		configure  func(cfg *config.Config)
+		// anonymous sends the requests without a token.
+		anonymous bool
+		// requests is how many are sent, the last one being judged by
+		// applied. Its body is only read when it isn't a stream.
+		requests int
+		applied  func(resp *http.Response) bool
+		groups   []string
+	}{
+		{
+			middleware: config.MiddlewareCompress,
+			configure:  func(cfg *config.Config) { cfg.Server.Compression.MinSize = 0 },
+			requests:   1,
+			applied:    func(resp *http.Response) bool { return resp.Header.Get("Content-Encoding") == "gzip" },
+			groups:     []string{config.GroupPublic, config.GroupAuthenticated, config.GroupAdmin},
+		},
+		{
+			middleware: config.MiddlewareTimeout,
+			configure: func(cfg *config.Config) {
+				cfg.Database.Latency = config.Duration(100 * time.Millisecond)
+				cfg.Server.RequestTimeout = config.Duration(20 * time.Millisecond)
+			},
+			requests: 1,
+			applied:  func(resp *http.Response) bool { return resp.StatusCode == http.StatusGatewayTimeout },
+			groups:   []string{config.GroupPublic, config.GroupAuthenticated, config.GroupAdmin},
+		},
+		{
+			middleware: config.MiddlewareMaintenance,
+			configure:  func(cfg *config.Config) { cfg.Maintenance.Enabled = true },
+			requests:   1,
+			// /readyz answers 503 too, but as a readiness check.
+			applied: func(resp *http.Response) bool {
+				var apiErr api.Error
+				return resp.StatusCode == http.StatusServiceUnavailable && json.NewDecoder(resp.Body).Decode(&apiErr) == nil && apiErr.Code == api.CodeMaintenance
+			},
+			groups: []string{config.GroupPublic, config.GroupAuthenticated, config.GroupStreaming},
+		},
+		{
+			middleware: config.MiddlewareAuthorize,
+			configure:  func(cfg *config.Config) {},
+			anonymous:  true,
+			requests:   1,
+			applied:    func(resp *http.Response) bool { return resp.StatusCode == http.StatusUnauthorized },
+			groups:     []string{config.GroupAuthenticated, config.GroupAdmin, config.GroupStreaming},
+		},
+		{
+			middleware: config.MiddlewareRateLimit,
+			configure: func(cfg *config.Config) {
+				cfg.RateLimit.Enabled = true
+				cfg.RateLimit.RequestsPerSecond = 0.001
+				cfg.RateLimit.Burst = 1
+			},
+			requests: 2,
+			applied:  func(resp *http.Response) bool { return resp.StatusCode == http.StatusTooManyRequests },
+			groups:   []string{config.GroupPublic, config.GroupAuthenticated, config.GroupAdmin, config.GroupStreaming},
+		},
+		{
+			middleware: config.MiddlewareAdminRateLimit,
+			configure: func(cfg *config.Config) {
+				cfg.RateLimit.Enabled = true
+				cfg.RateLimit.Admin.RequestsPerSecond = 0.001
+				cfg.RateLimit.Admin.Burst = 1
+			},
+			requests: 2,
+			applied:  func(resp *http.Response) bool { return resp.StatusCode == http.StatusTooManyRequests },
+			groups:   []string{config.GroupAdmin},
+		},
+		{
+			middleware: config.MiddlewareUserRateLimit,
+			configure: func(cfg *config.Config) {
+				cfg.RateLimit.PerUser.Enabled = true
+				cfg.RateLimit.PerUser.Requests = 1
+				cfg.RateLimit.PerUser.Window = config.Duration(time.Hour)
+			},
+			requests: 2,
+			applied:  func(resp *http.Response) bool { return resp.StatusCode == http.StatusTooManyRequests },
+			groups:   []string{config.GroupAuthenticated, config.GroupStreaming},
+		},
+	} {
+		t.Run(tt.middleware, func(t *testing.T) {
+			var expected = map[string]bool{}
+			for _, group := range tt.groups {
+				expected[group] = true
+			}
+
+			for _, route := range groupRoutes {
+				t.Run(route.group, func(t *testing.T) {
+					var s = apitest.New(t, apitest.WithConfig(tt.configure))
+
+					var resp *http.Response
+					for i := range tt.requests {
+						var req *http.Request = s.NewRequest(http.MethodGet, route.path, nil)
+						if route.user != "" && !tt.anonymous {
+							req = s.NewAuthedRequest(route.user, http.MethodGet, route.path, nil)
+						}
+						// Set, the transport leaves the response compressed.
+						req.Header.Set("Accept-Encoding", "gzip")
+						resp = s.Do(req)
+						if i < tt.requests-1 {
+							resp.Body.Close()
+						}
+					}
+					// Closed before reaching its end, streams never end.
+					defer resp.Body.Close()
+
+					if got := tt.applied(resp); got != expected[route.group] {
+						t.Errorf("%s on GET %s = %v, want %v (answered %d)", tt.middleware, route.path, got, expected[route.group], resp.StatusCode)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestBootstrapAdminOnlyUnderAdmin(t *testing.T) {
+	const token = "bootstrap-token"
+	var hash = sha256.Sum256([]byte(token))
+	var s = apitest.New(t, apitest.WithConfig(func(cfg *config.Config) {
+		cfg.Auth.BootstrapAdmin.Enabled = true
+		cfg.Auth.BootstrapAdmin.TokenHash = "sha256:" + hex.EncodeToString(hash[:])
+	}))
+
+	for _, tt := range []struct {
+		method string
+		path   string
+		status int
+	}{
+		{http.MethodGet, "/v1/admin/stats", http.StatusOK},
+		{http.MethodDelete, "/v1/users/john", http.StatusUnauthorized},
+		{http.MethodDelete, "/users/john", http.StatusUnauthorized},
+		{http.MethodGet, "/v1/account/coins", http.StatusUnauthorized},
+	} {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			var req = s.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			var resp = s.Do(req)
+			if tt.status != http.StatusOK {
+				apitest.DecodeError(t, resp, tt.status, api.CodeInvalidToken)
+				return
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.status {
+				t.Errorf("%s %s answered %d, want %d", tt.method, tt.path, resp.StatusCode, tt.status)
+			}
+		})
+	}
+
+	if _, err := s.Database.GetUserCoins(context.Background(), "john"); err != nil {
+		t.Errorf("john was deleted by the bootstrap admin: %v", err)
+	}
+}
@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/logging"
+)
+
+// Healthz is the liveness probe. It never touches the database so it stays
+// cheap and keeps answering while dependencies are down.
+func Healthz(started time.Time) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var response = api.HealthResponse{
+			Status: "ok",
+			Uptime: time.Since(started).Round(time.Second).String(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		err := json.NewEncoder(w).Encode(response)
+
+		if err != nil {
+			logging.FromContext(r.Context()).Error(err)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package handlers_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/apitest"
+	"github.com/RashedMaaitah/goapi/internal/handlers"
+	"github.com/RashedMaaitah/goapi/internal/tools"
+)
+
+func TestHealthzNeedsNoCredentials(t *testing.T) {
+	var s = apitest.New(t)
+
+	for _, tt := range []struct {
+		name          string
+		authorization string
+	}{
+		{"without credentials", ""},
+		{"with an invalid token", "Bearer not-a-token"},
+		{"with a malformed Authorization", "Basic YWxleDo="},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var req = s.NewRequest(http.MethodGet, "/healthz", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+
+			var health = apitest.Decode[api.HealthResponse](t, s.Do(req), http.StatusOK)
+			if health.Status != "ok" || health.Uptime == "" {
+				t.Errorf("health = %+v, want ok with an uptime", health)
+			}
+		})
+	}
+}
+
+// noDatabase panics on every call, as its Database is nil.
+type noDatabase struct {
+	tools.Database
+}
+
+func TestHealthzNeverTouchesTheDatabase(t *testing.T) {
+	var s = apitest.New(t, apitest.WithHandlerOptions(handlers.WithDatabase(noDatabase{})))
+
+	apitest.Decode[api.HealthResponse](t, s.Do(s.NewRequest(http.MethodGet, "/healthz", nil)), http.StatusOK)
+}
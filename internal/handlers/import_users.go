@@ -0,0 +1,317 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/auth"
+	"github.com/RashedMaaitah/goapi/internal/config"
+	"github.com/RashedMaaitah/goapi/internal/logging"
+	"github.com/RashedMaaitah/goapi/internal/tools"
+)
+
+const (
+	importStrict  = "strict"
+	importPartial = "partial"
+)
+
+var InvalidImportModeError = errors.New("Mode must be strict or partial.")
+
+var UnsupportedImportTypeError = errors.New("Content-Type must be application/json or text/csv.")
+
+var NegativeCoinsError = errors.New("Coins must not be negative.")
+
+var DuplicateRowError = errors.New("Username appears earlier in the upload.")
+
+// rowError marks a row that could be read but not parsed, such as a CSV
+// line with a malformed coins column. Other read errors end the upload.
+type rowError struct {
+	err error
+}
+
+func (e *rowError) Error() string { return e.err.Error() }
+
+// importReader yields one row at a time and io.EOF after the last, so
+// uploads are never decoded as a whole.
+type importReader interface {
+	next() (api.ImportUserRow, error)
+}
+
+// ImportUsers creates users from a JSON array or a CSV file of username,
+// password and coins. Every row is validated and hashed while the body is
+// read; only the hashes are kept until the rows are applied in one call.
+// Strict mode creates all users or none, partial mode whatever it can.
+// Uploads larger than api.BodyLimit are refused with a 413.
+func ImportUsers(cfg *config.Config, database tools.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		api.LimitBody(w, r)
+
+		var logger = logging.FromContext(r.Context())
+		var params = api.ImportParams{}
+		var err error
+
+		if violations := api.ReadQuery(r, &params); len(violations) > 0 {
+			api.ValidationErrorHandler(w, violations)
+			return
+		}
+
+		var mode string = strings.ToLower(params.Mode)
+		if mode == "" {
+			mode = importStrict
+		}
+		if mode != importStrict && mode != importPartial {
+			api.RequestErrorHandler(w, InvalidImportModeError)
+			return
+		}
+
+		var reader importReader
+		reader, err = newImportReader(r)
+
+		if err != nil {
+			api.RequestErrorHandler(w, err)
+			return
+		}
+
+		var maxRows int = cfg.API.ImportMaxRows
+		var results []api.ImportRowResult
+		var users []tools.NewUser
+		// Index into results of every row in users.
+		var rows []int
+		var seen = map[string]bool{}
+
+		for {
+			row, rowErr := reader.next()
+			if rowErr == io.EOF {
+				break
+			}
+
+			var parseErr *rowError
+			if rowErr != nil && !errors.As(rowErr, &parseErr) {
+				logger.Error(rowErr)
+				api.RequestErrorHandler(w, fmt.Errorf("Invalid request body: %w", rowErr))
+				return
+			}
+
+			if len(results) == maxRows {
+				api.RequestErrorHandler(w, fmt.Errorf("Uploads are limited to %d rows.", maxRows))
+				return
+			}
+
+			row.Username = api.NormalizeUsername(row.Username)
+			var result = api.ImportRowResult{Row: len(results) + 1, Username: row.Username}
+
+			if rowErr == nil {
+				rowErr = validateImportRow(row)
+			}
+			if rowErr == nil && seen[row.Username] {
+				result.Status = api.ImportDuplicate
+				result.Reason = DuplicateRowError.Error()
+				results = append(results, result)
+				continue
+			}
+			if rowErr != nil {
+				result.Status = api.ImportInvalid
+				result.Reason = rowErr.Error()
+				results = append(results, result)
+				continue
+			}
+
+			hash, hashErr := auth.HashPassword(row.Password, cfg.Auth.BcryptCost)
+
+			if hashErr != nil {
+				logger.Error(hashErr)
+				api.InternalErrorHandler(w)
+				return
+			}
+
+			seen[row.Username] = true
+			rows = append(rows, len(results))
+			results = append(results, result)
+			users = append(users, tools.NewUser{Username: row.Username, PasswordHash: hash, Coins: int64(row.Coins)})
+		}
+
+		var response = api.ImportResponse{StatusCode: http.StatusOK, Mode: mode}
+		for _, result := range results {
+			switch result.Status {
+			case api.ImportInvalid:
+				response.Invalid++
+			case api.ImportDuplicate:
+				response.Skipped++
+			}
+		}
+
+		var errs = make([]error, len(users))
+		var apply bool = len(users) > 0 && (mode == importPartial || response.Invalid+response.Skipped == 0)
+		if apply {
+			errs, err = database.ImportUsers(r.Context(), users, mode == importStrict)
+
+			if err != nil {
+				logger.Error(err)
+				api.InternalErrorHandler(w)
+				return
+			}
+		}
+
+		for i, index := range rows {
+			var result = &results[index]
+			switch {
+			case errors.Is(errs[i], tools.ErrUserExists):
+				result.Status = api.ImportDuplicate
+				result.Reason = api.ErrUserExists.Error()
+				response.Skipped++
+			case errs[i] != nil:
+				logger.Error(errs[i])
+				api.InternalErrorHandler(w)
+				return
+			default:
+				result.Status = api.ImportCreated
+				response.Created++
+			}
+		}
+
+		// A strict import that failed anywhere has created nothing.
+		if mode == importStrict && response.Invalid+response.Skipped > 0 {
+			response.StatusCode = http.StatusUnprocessableEntity
+			response.Created = 0
+			for _, index := range rows {
+				if results[index].Status == api.ImportCreated {
+					results[index].Status = api.ImportNotApplied
+				}
+			}
+		}
+
+		for i := range results {
+			if results[i].Status == "" {
+				results[i].Status = api.ImportNotApplied
+			}
+		}
+		response.Results = results
+
+		logger.Infof("Imported %d of %d users (%s)", response.Created, len(results), mode)
+
+		api.WriteJSON(w, response.StatusCode, response, nil)
+	}
+}
+
+func validateImportRow(row api.ImportUserRow) error {
+	if message := api.UsernameViolation("Username", row.Username); message != "" {
+		return errors.New(message)
+	}
+	if err := validatePassword(row.Username, row.Password); err != nil {
+		return err
+	}
+	if row.Coins < 0 {
+		return NegativeCoinsError
+	}
+	return nil
+}
+
+func newImportReader(r *http.Request) (importReader, error) {
+	var mediaType string = "application/json"
+	if header := r.Header.Get("Content-Type"); header != "" {
+		var err error
+		mediaType, _, err = mime.ParseMediaType(header)
+		if err != nil {
+			return nil, UnsupportedImportTypeError
+		}
+	}
+
+	switch mediaType {
+	case "application/json":
+		var decoder = json.NewDecoder(r.Body)
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, fmt.Errorf("Invalid request body: %w", err)
+		}
+		if token != json.Delim('[') {
+			return nil, errors.New("Invalid request body: expected a JSON array.")
+		}
+		return &jsonImportReader{decoder: decoder}, nil
+	case "text/csv":
+		return newCSVImportReader(r.Body)
+	}
+	return nil, UnsupportedImportTypeError
+}
+
+type jsonImportReader struct {
+	decoder *json.Decoder
+}
+
+func (j *jsonImportReader) next() (api.ImportUserRow, error) {
+	var row api.ImportUserRow
+	if !j.decoder.More() {
+		return row, io.EOF
+	}
+	err := j.decoder.Decode(&row)
+	// The decoder skips past a value of the wrong type, so only the row is lost.
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return row, &rowError{fmt.Errorf("%s has the wrong type.", typeErr.Field)}
+	}
+	if errors.Is(err, api.ErrInvalidAmount) {
+		return row, &rowError{errors.New("Coins must be a whole number.")}
+	}
+	return row, err
+}
+
+// csvImportReader needs a header row naming the username, password and
+// coins columns, in any order.
+type csvImportReader struct {
+	reader  *csv.Reader
+	columns map[string]int
+}
+
+func newCSVImportReader(body io.Reader) (*csvImportReader, error) {
+	var reader = csv.NewReader(body)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("Invalid request body: %w", err)
+	}
+
+	var columns = map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"username", "password", "coins"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("Invalid request body: missing %s column.", name)
+		}
+	}
+
+	return &csvImportReader{reader: reader, columns: columns}, nil
+}
+
+func (c *csvImportReader) next() (api.ImportUserRow, error) {
+	var row api.ImportUserRow
+	record, err := c.reader.Read()
+	if errors.Is(err, csv.ErrFieldCount) {
+		return row, &rowError{errors.New("Row has the wrong number of columns.")}
+	}
+	if err != nil {
+		return row, err
+	}
+
+	row.Username = record[c.columns["username"]]
+	row.Password = record[c.columns["password"]]
+
+	var coins string = strings.TrimSpace(record[c.columns["coins"]])
+	if coins != "" {
+		var value int64
+		value, err = strconv.ParseInt(coins, 10, 64)
+		row.Coins = api.Amount(value)
+		if err != nil {
+			return row, &rowError{errors.New("Coins must be a whole number.")}
+		}
+	}
+	return row, nil
+}
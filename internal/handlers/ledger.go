@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/ledger"
+	"github.com/RashedMaaitah/goapi/internal/logging"
+	"github.com/RashedMaaitah/goapi/internal/tools"
+	"github.com/go-chi/chi"
+)
+
+var LedgerTransactionNotFoundError = errors.New("No ledger entries for this transaction.")
+
+// GetLedgerTransaction returns the ledger entries of the transaction in the
+// path, the IDs listed by /account/transactions.
+func GetLedgerTransaction(database tools.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var logger = logging.FromContext(r.Context())
+		var id string = chi.URLParam(r, "id")
+		var err error
+
+		var entries []ledger.Entry
+		entries, err = database.LedgerEntries(r.Context(), id)
+
+		if err != nil {
+			logger.Error(err)
+			api.InternalErrorHandler(w)
+			return
+		}
+
+		if len(entries) == 0 {
+			api.NotFoundErrorHandler(w, api.CodeTransactionNotFound, LedgerTransactionNotFoundError)
+			return
+		}
+
+		var response = api.LedgerResponse{
+			StatusCode:    http.StatusOK,
+			TransactionID: id,
+			Entries:       make([]api.LedgerEntry, 0, len(entries)),
+		}
+		for _, entry := range entries {
+			response.Entries = append(response.Entries, api.LedgerEntry{
+				Account:   entry.Account,
+				Direction: entry.Direction,
+				Currency:  entry.Currency,
+				Amount:    api.Amount(entry.Amount),
+				Timestamp: entry.CreatedAt,
+			})
+		}
+
+		api.WriteJSON(w, http.StatusOK, response, nil)
+	}
+}
+
+// VerifyLedger reports every stored balance that differs from the sum of
+// its ledger entries.
+func VerifyLedger(database tools.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var logger = logging.FromContext(r.Context())
+		var err error
+
+		var drift []ledger.Drift
+		drift, err = database.VerifyLedger(r.Context())
+
+		if err != nil {
+			logger.Error(err)
+			api.InternalErrorHandler(w)
+			return
+		}
+
+		var response = api.LedgerVerifyResponse{
+			StatusCode: http.StatusOK,
+			Consistent: len(drift) == 0,
+			Drift:      make([]api.LedgerDrift, 0, len(drift)),
+		}
+		for _, d := range drift {
+			logger.Warnf("Ledger drift on %s: stored %s balance is %d, ledger says %d", d.Account, d.Currency, d.Cached, d.Ledger)
+			response.Drift = append(response.Drift, api.LedgerDrift{
+				Account:  d.Account,
+				Currency: d.Currency,
+				Cached:   api.Amount(d.Cached),
+				Ledger:   api.Amount(d.Ledger),
+			})
+		}
+
+		api.WriteJSON(w, http.StatusOK, response, nil)
+	}
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/logging"
+	"github.com/RashedMaaitah/goapi/internal/middleware"
+	"github.com/RashedMaaitah/goapi/internal/tools"
+)
+
+const (
+	defaultTransactionLimit = 20
+	maxTransactionLimit     = 100
+)
+
+// The scopes of the cursors of each list, so one can't continue another.
+const (
+	transactionsCursor = "transactions"
+	auditCursor        = "audit"
+	usersCursor        = "users"
+	leaderboardCursor  = "leaderboard"
+)
+
+// ListTransactions pages through the transactions of the user, their
+// cursors carrying the Seq of the last one of the page.
+func ListTransactions(database tools.Database, cursors *api.Cursors) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var logger = logging.FromContext(r.Context())
+		var params = api.TransactionListParams{}
+		var err error
+
+		if violations := api.ReadQuery(r, &params); len(violations) > 0 {
+			api.ValidationErrorHandler(w, violations)
+			return
+		}
+
+		limit, err := params.PageLimit(defaultTransactionLimit, maxTransactionLimit)
+		if err != nil {
+			api.RequestErrorHandler(w, err)
+			return
+		}
+
+		var before int64
+		if params.Cursor != "" {
+			before, err = cursors.Decode(transactionsCursor, params.Cursor)
+			if err != nil {
+				logger.Warnf("Invalid transaction cursor %q", params.Cursor)
+				api.RequestErrorHandler(w, err)
+				return
+			}
+		}
+
+		// One extra row tells whether there is a next page.
+		var transactions []tools.Transaction
+		transactions, err = database.ListTransactions(r.Context(), middleware.GetLoginDetails(r.Context()).Username, limit+1, before)
+
+		if err != nil {
+			logger.Error(err)
+			api.InternalErrorHandler(w)
+			return
+		}
+
+		var response = api.TransactionListResponse{
+			StatusCode:   http.StatusOK,
+			PageResponse: api.PageResponse[api.Transaction]{Items: []api.Transaction{}},
+		}
+
+		if len(transactions) > limit {
+			transactions = transactions[:limit]
+			response.NextCursor = cursors.Encode(transactionsCursor, transactions[limit-1].Seq)
+		}
+
+		for _, t := range transactions {
+			response.Items = append(response.Items, api.Transaction{
+				ID:           t.ID,
+				Type:         t.Type,
+				Currency:     t.Currency,
+				Amount:       api.Amount(t.Amount),
+				Counterparty: t.Counterparty,
+				Balance:      api.Amount(t.Balance),
+				Timestamp:    t.CreatedAt,
+				Actor:        t.Actor,
+				Reason:       t.Reason,
+			})
+		}
+
+		api.WriteJSON(w, http.StatusOK, response, nil)
+	}
+}
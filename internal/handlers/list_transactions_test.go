@@ -0,0 +1,79 @@
+package handlers_test
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/apitest"
+)
+
+// nextCursor returns the NextCursor of the first page, of one item, of the
+// list at path as user.
+func nextCursor(t *testing.T, s *apitest.Server, user, path string) string {
+	t.Helper()
+
+	var page = apitest.Decode[struct{ NextCursor string }](t, s.Do(s.NewAuthedRequest(user, http.MethodGet, path+"limit=1", nil)), http.StatusOK)
+	if page.NextCursor == "" {
+		t.Fatalf("GET %slimit=1 has no NextCursor", path)
+	}
+	return page.NextCursor
+}
+
+func TestForgedCursorsRejected(t *testing.T) {
+	var s = apitest.New(t)
+	for range 2 {
+		s.Do(s.NewAuthedRequest("alex", http.MethodPost, "/v1/account/coins/deposit", map[string]any{"amount": 1})).Body.Close()
+		s.Do(s.NewAuthedRequest("admin", http.MethodPost, "/v1/admin/users/alex/coins/adjust", map[string]any{"Delta": 1, "Reason": "test"})).Body.Close()
+	}
+
+	var lists = []struct {
+		name string
+		user string
+		// path is the list, ready for its query parameters to be added.
+		path string
+	}{
+		{"transactions", "alex", "/v1/account/transactions?"},
+		{"audit", "admin", "/v1/admin/audit?"},
+		{"user search", "admin", "/v1/admin/users?prefix=&"},
+		{"leaderboard", "alex", "/v1/leaderboard?"},
+	}
+
+	var cursors = map[string]string{}
+	for _, list := range lists {
+		cursors[list.name] = nextCursor(t, s, list.user, list.path)
+	}
+
+	for i, list := range lists {
+		// The payload of the cursor of the list with its first digit
+		// changed, its MAC kept.
+		var tampered, _ = base64.RawURLEncoding.DecodeString(cursors[list.name])
+		tampered[0] = '9'
+		var other string = lists[(i+1)%len(lists)].name
+
+		for _, tt := range []struct {
+			name   string
+			cursor string
+		}{
+			{"tampered", base64.RawURLEncoding.EncodeToString(tampered)},
+			{"signed with another key", api.NewCursors([]byte("forged")).Encode(list.name, 1)},
+			{"of the " + other, cursors[other]},
+			{"not base64", "not a cursor!"},
+		} {
+			t.Run(list.name+"/"+tt.name, func(t *testing.T) {
+				var req = s.NewAuthedRequest(list.user, http.MethodGet, list.path+"cursor="+url.QueryEscape(tt.cursor), nil)
+				var apiErr = apitest.DecodeError(t, s.Do(req), http.StatusBadRequest, api.CodeInvalidRequest)
+				if apiErr.Message != api.ErrInvalidCursor.Error() {
+					t.Errorf("message = %q, want %q", apiErr.Message, api.ErrInvalidCursor)
+				}
+			})
+		}
+	}
+
+	t.Run("user search/of another search", func(t *testing.T) {
+		var req = s.NewAuthedRequest("admin", http.MethodGet, "/v1/admin/users?prefix=m&cursor="+url.QueryEscape(cursors["user search"]), nil)
+		apitest.DecodeError(t, s.Do(req), http.StatusBadRequest, api.CodeInvalidRequest)
+	})
+}
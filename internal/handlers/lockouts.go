@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/lockout"
+	"github.com/RashedMaaitah/goapi/internal/logging"
+	"github.com/RashedMaaitah/goapi/internal/middleware"
+	"github.com/go-chi/chi"
+)
+
+var InvalidIPError = errors.New("Invalid IP address.")
+
+// ClearUserLockout lifts the lockout of the username in the path, and
+// forgets its failed logins.
+func ClearUserLockout(lockouts *lockout.Lockout) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		clearLockout(w, r, lockouts, lockout.UserKey(middleware.PathUsername(r)))
+	}
+}
+
+// ClearIPLockout lifts the lockout of the IP in the path.
+func ClearIPLockout(lockouts *lockout.Lockout) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var ip net.IP = net.ParseIP(chi.URLParam(r, "ip"))
+		if ip == nil {
+			api.RequestErrorHandler(w, InvalidIPError)
+			return
+		}
+		clearLockout(w, r, lockouts, lockout.IPKey(ip.String()))
+	}
+}
+
+func clearLockout(w http.ResponseWriter, r *http.Request, lockouts *lockout.Lockout, key string) {
+	var logger = logging.FromContext(r.Context())
+
+	if err := lockouts.Clear(r.Context(), key); err != nil {
+		api.WriteErr(w, err)
+		return
+	}
+
+	logger.Infof("Cleared the lockout of %s", key)
+	w.WriteHeader(http.StatusNoContent)
+}
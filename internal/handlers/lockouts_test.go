@@ -0,0 +1,50 @@
+package handlers_test
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/apitest"
+	"github.com/RashedMaaitah/goapi/internal/config"
+)
+
+func TestLoginLockedOut(t *testing.T) {
+	var s = apitest.New(t, apitest.WithConfig(func(cfg *config.Config) {
+		cfg.Auth.Lockout.Failures = 3
+		cfg.RateLimit.TrustProxy = true
+	}))
+	// The logins come from another IP than the admin, which the lockout of
+	// the IP would answer with a 429 too.
+	var loginFrom = func(password string) *http.Response {
+		var req = s.NewRequest(http.MethodPost, "/v1/login", map[string]any{"username": "alex", "password": password})
+		req.Header.Set("X-Forwarded-For", "192.0.2.1")
+		return s.Do(req)
+	}
+
+	for i := 0; i < 3; i++ {
+		apitest.DecodeError(t, loginFrom("wrong"), http.StatusUnauthorized, api.CodeInvalidCredentials)
+	}
+
+	// Even with the right password, which isn't checked.
+	var resp = loginFrom("password")
+	if after, err := strconv.Atoi(resp.Header.Get("Retry-After")); err != nil || after <= 0 || after > 60 {
+		t.Errorf("Retry-After = %q, want up to the 60 seconds of the first backoff", resp.Header.Get("Retry-After"))
+	}
+	apitest.DecodeError(t, resp, http.StatusTooManyRequests, api.CodeLockedOut)
+
+	// The IP is locked out too, until cleared as well.
+	var lift = func(path string) {
+		t.Helper()
+		var resp = s.Do(s.NewAuthedRequest("admin", http.MethodDelete, path, nil))
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNoContent {
+			t.Fatalf("DELETE %s answered %d, want 204", path, resp.StatusCode)
+		}
+	}
+	lift("/v1/admin/lockouts/users/alex")
+	apitest.DecodeError(t, loginFrom("password"), http.StatusTooManyRequests, api.CodeLockedOut)
+	lift("/v1/admin/lockouts/ips/192.0.2.1")
+	apitest.Decode[map[string]any](t, loginFrom("password"), http.StatusOK)
+}
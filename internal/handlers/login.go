@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/audit"
+	"github.com/RashedMaaitah/goapi/internal/auth"
+	"github.com/RashedMaaitah/goapi/internal/config"
+	"github.com/RashedMaaitah/goapi/internal/lockout"
+	"github.com/RashedMaaitah/goapi/internal/logging"
+	"github.com/RashedMaaitah/goapi/internal/middleware"
+	"github.com/RashedMaaitah/goapi/internal/tools"
+)
+
+// The same error for unknown users and wrong passwords, so a failed login
+// does not reveal which usernames exist.
+var InvalidCredentialsError = errors.New("Invalid username or password.")
+
+// Login counts wrong passwords as failures of the username and of the client
+// IP in lockouts, and answers either once locked out with a 429 without
+// checking the password. The token grants the scopes asked for, every user
+// holding them all.
+func Login(cfg config.AuthConfig, database tools.Database, tokens auth.Tokens, lockouts *lockout.Lockout, auditor audit.Auditor, trustProxy bool) http.HandlerFunc {
+	var dummyHash string = auth.DummyHash(cfg.BcryptCost)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		var logger = logging.FromContext(r.Context())
+		var params = api.LoginParams{}
+		var err error
+
+		err = api.ReadJSON(w, r, &params)
+
+		if err != nil {
+			logger.Error(err)
+			api.BodyErrorHandler(w, err)
+			return
+		}
+		params.Username = api.NormalizeUsername(params.Username)
+
+		scopes, err := auth.GrantScopes(params.Scopes, tools.Scopes)
+		if err != nil {
+			scopeErrorHandler(w, err)
+			return
+		}
+
+		var entry = tools.AuditEntry{Actor: params.Username, Action: audit.ActionLogin, Target: params.Username}
+
+		var ip string = middleware.ClientIP(r, trustProxy)
+		if locked := lockouts.Locked(r.Context(), params.Username, ip); locked > 0 {
+			auditor.Record(r.Context(), entry, api.ErrLockedOut)
+			api.WriteErr(w, &api.RetryAfterError{Err: fmt.Errorf("Login of %q from %s: %w", params.Username, ip, api.ErrLockedOut), After: locked})
+			return
+		}
+
+		// An unknown user is answered like a wrong password, after comparing
+		// the password against a hash as costly as theirs.
+		var hash, reason string = dummyHash, "unknown user"
+		loginDetails, err := database.GetUserLoginDetails(r.Context(), params.Username)
+		switch {
+		case err == nil:
+			hash, reason = loginDetails.PasswordHash, "wrong password"
+		case !errors.Is(err, tools.ErrUserNotFound):
+			api.WriteErr(w, fmt.Errorf("Login of %q: %w", params.Username, err))
+			return
+		}
+
+		if err = auth.CheckPassword(hash, params.Password, cfg.BcryptCost); err != nil {
+			logger.Warnf("Failed login for %q from %s: %s", params.Username, ip, reason)
+			lockouts.Fail(r.Context(), params.Username, ip)
+			auditor.Record(r.Context(), entry, err)
+			api.UnauthorizedErrorHandler(w, api.CodeInvalidCredentials, InvalidCredentialsError)
+			return
+		}
+
+		lockouts.Succeed(r.Context(), loginDetails.Username)
+
+		if auth.NeedsRehash(hash, cfg.BcryptCost) {
+			rehash(r, database, loginDetails.Username, params.Password, cfg.BcryptCost)
+		}
+
+		var token *auth.Token
+		token, err = tokens.Issue(r.Context(), loginDetails.Username, scopes)
+		auditor.Record(r.Context(), entry, err)
+
+		if err != nil {
+			logger.Error(err)
+			api.InternalErrorHandler(w)
+			return
+		}
+
+		logger.Infof("%s logged in", loginDetails.Username)
+
+		var response = api.LoginResponse{
+			StatusCode: http.StatusOK,
+			AuthToken:  token.Value,
+			ExpiresAt:  token.ExpiresAt,
+			Scopes:     token.Scopes,
+		}
+
+		api.WriteJSON(w, http.StatusOK, response, nil)
+	}
+}
+
+// scopeErrorHandler answers the *auth.ScopeError of GrantScopes: a 400 for
+// unknown scopes, a 403 for those that aren't held.
+func scopeErrorHandler(w http.ResponseWriter, err error) {
+	var scopeErr *auth.ScopeError
+	if errors.As(err, &scopeErr) && !scopeErr.Unknown {
+		api.InsufficientScopeHandler(w, scopeErr.Scope)
+		return
+	}
+	api.RequestErrorHandler(w, err)
+}
+
+// rehash upgrades a plaintext password or a hash of another cost. Failing
+// to do so does not fail the login, it is retried on the next one.
+func rehash(r *http.Request, database tools.Database, username string, password string, cost int) {
+	var logger = logging.FromContext(r.Context())
+
+	hash, err := auth.HashPassword(password, cost)
+	if err == nil {
+		err = database.UpdatePassword(r.Context(), username, hash)
+	}
+
+	if err != nil {
+		logger.Warnf("Could not rehash the password of %s: %v", username, err)
+		return
+	}
+	logger.Infof("Rehashed the password of %s", username)
+}
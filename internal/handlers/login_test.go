@@ -0,0 +1,102 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/apitest"
+	"github.com/RashedMaaitah/goapi/internal/auth"
+	"github.com/RashedMaaitah/goapi/internal/config"
+	"github.com/RashedMaaitah/goapi/internal/handlers"
+	"github.com/RashedMaaitah/goapi/internal/tools"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// login logs username in with password, returning the response.
+func login(s *apitest.Server, username, password string) *http.Response {
+	return s.Do(s.NewRequest(http.MethodPost, "/v1/login", map[string]any{"username": username, "password": password}))
+}
+
+func TestTokensNeverStoredOrLoggedInPlaintext(t *testing.T) {
+	var path string = filepath.Join(t.TempDir(), "goapi.db")
+	var logs bytes.Buffer
+	var logger = log.New()
+	logger.SetOutput(&logs)
+	logger.SetLevel(log.TraceLevel)
+
+	var s = apitest.New(t,
+		apitest.WithConfig(func(cfg *config.Config) {
+			cfg.Database.Driver = "sqlite"
+			cfg.Database.Path = path
+		}),
+		apitest.WithHandlerOptions(handlers.WithLogger(logger)),
+	)
+	hash, err := auth.HashPassword("password", bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Database.CreateUser(context.Background(), "alex", hash); err != nil {
+		t.Fatal(err)
+	}
+
+	var token string = apitest.Decode[api.LoginResponse](t, login(s, "alex", "password"), http.StatusOK).AuthToken
+	var req = s.NewRequest(http.MethodGet, "/v1/account/coins", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	apitest.Decode[api.CoinBalanceResponse](t, s.Do(req), http.StatusOK)
+
+	// Stored by its hash alone.
+	if _, err = s.Database.GetSession(context.Background(), token); err == nil {
+		t.Error("the session is found by the plaintext token")
+	}
+	if _, err = s.Database.GetSession(context.Background(), tools.HashToken(token)); err != nil {
+		t.Errorf("GetSession by the hash of the token: %v", err)
+	}
+
+	var files, _ = filepath.Glob(path + "*")
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(content, []byte(token)) {
+			t.Errorf("%s holds the plaintext token", filepath.Base(file))
+		}
+	}
+	if logs.Len() == 0 || strings.Contains(logs.String(), token) {
+		t.Errorf("the logs hold the plaintext token, or nothing: %s", logs.String())
+	}
+}
+
+func TestUnknownUserAnsweredLikeWrongPassword(t *testing.T) {
+	var s = apitest.New(t)
+
+	var responses [2]map[string]any
+	for i, username := range []string{"nobody", "alex"} {
+		var resp = login(s, username, "wrong password")
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("login of %s answered %d, want %d", username, resp.StatusCode, http.StatusUnauthorized)
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&responses[i]); err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		// The one field that differs whoever logs in.
+		delete(responses[i], "RequestID")
+	}
+
+	if !reflect.DeepEqual(responses[0], responses[1]) {
+		t.Errorf("unknown user answered %v, wrong password %v", responses[0], responses[1])
+	}
+	if responses[0]["Code"] != api.CodeInvalidCredentials {
+		t.Errorf("code = %v, want %s", responses[0]["Code"], api.CodeInvalidCredentials)
+	}
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/auth"
+	"github.com/RashedMaaitah/goapi/internal/config"
+	"github.com/RashedMaaitah/goapi/internal/lockout"
+	"github.com/RashedMaaitah/goapi/internal/logging"
+	"github.com/RashedMaaitah/goapi/internal/middleware"
+)
+
+// Logout revokes the token the request is made with.
+func Logout(cfg config.AuthConfig, tokens auth.Tokens, lockouts *lockout.Lockout, trustProxy bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var logger = logging.FromContext(r.Context())
+
+		token, err := middleware.ReadToken(r, auth.NewTokenSource(cfg))
+		if err == nil && token == "" {
+			err = api.ErrMissingToken
+		}
+		if err != nil {
+			api.WriteErr(w, err)
+			return
+		}
+
+		err = middleware.CheckToken(r, lockouts, trustProxy, func() error {
+			return tokens.Revoke(r.Context(), token)
+		})
+
+		if err != nil {
+			api.WriteErr(w, err)
+			return
+		}
+
+		logger.Info("Token revoked on logout")
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// RevokeUserTokens revokes every token of the user in the path.
+func RevokeUserTokens(tokens auth.Tokens) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var logger = logging.FromContext(r.Context())
+		var username string = middleware.PathUsername(r)
+
+		var err error = tokens.RevokeAll(r.Context(), username)
+
+		if err != nil {
+			logger.Error(err)
+			api.InternalErrorHandler(w)
+			return
+		}
+
+		logger.Infof("Revoked all tokens of %s", username)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
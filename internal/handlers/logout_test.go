@@ -0,0 +1,91 @@
+package handlers_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/apitest"
+	"github.com/RashedMaaitah/goapi/internal/config"
+)
+
+// tokenModes runs test against a Server of each token mode.
+func tokenModes(t *testing.T, test func(t *testing.T, s *apitest.Server)) {
+	for _, mode := range []string{"session", "jwt"} {
+		t.Run(mode, func(t *testing.T) {
+			test(t, apitest.New(t, apitest.WithConfig(func(cfg *config.Config) {
+				cfg.Auth.Mode = mode
+				cfg.Auth.JWTSecret = strings.Repeat("k", 32)
+			})))
+		})
+	}
+}
+
+func TestLogoutRevokesTheToken(t *testing.T) {
+	tokenModes(t, func(t *testing.T, s *apitest.Server) {
+		apitest.Decode[api.CoinBalanceResponse](t, s.Do(s.NewAuthedRequest("alex", http.MethodGet, "/v1/account/coins", nil)), http.StatusOK)
+
+		var resp = s.Do(s.NewAuthedRequest("alex", http.MethodPost, "/v1/logout", nil))
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNoContent {
+			t.Fatalf("POST /v1/logout answered %d", resp.StatusCode)
+		}
+
+		apitest.DecodeError(t, s.Do(s.NewAuthedRequest("alex", http.MethodGet, "/v1/account/coins", nil)), http.StatusUnauthorized, api.CodeInvalidToken)
+		apitest.DecodeError(t, s.Do(s.NewAuthedRequest("alex", http.MethodPost, "/v1/logout", nil)), http.StatusUnauthorized, api.CodeInvalidToken)
+	})
+}
+
+func TestLogoutWithoutToken(t *testing.T) {
+	var s = apitest.New(t)
+
+	apitest.DecodeError(t, s.Do(s.NewRequest(http.MethodPost, "/v1/logout", nil)), http.StatusUnauthorized, api.CodeMissingToken)
+}
+
+func TestRevokeUserTokens(t *testing.T) {
+	tokenModes(t, func(t *testing.T, s *apitest.Server) {
+		apitest.Decode[api.CoinBalanceResponse](t, s.Do(s.NewAuthedRequest("alex", http.MethodGet, "/v1/account/coins", nil)), http.StatusOK)
+
+		var resp = s.Do(s.NewAuthedRequest("admin", http.MethodDelete, "/v1/admin/tokens/alex", nil))
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNoContent {
+			t.Fatalf("DELETE /v1/admin/tokens/alex answered %d", resp.StatusCode)
+		}
+
+		apitest.DecodeError(t, s.Do(s.NewAuthedRequest("alex", http.MethodGet, "/v1/account/coins", nil)), http.StatusUnauthorized, api.CodeInvalidToken)
+		// The tokens of others still work.
+		apitest.Decode[api.CoinBalanceResponse](t, s.Do(s.NewAuthedRequest("maria", http.MethodGet, "/v1/account/coins", nil)), http.StatusOK)
+	})
+}
+
+func TestLoginRightAfterRevocation(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		password string
+		revoke   func(s *apitest.Server) *http.Response
+	}{
+		{"revoked by an admin", "password", func(s *apitest.Server) *http.Response {
+			return s.Do(s.NewAuthedRequest("admin", http.MethodDelete, "/v1/admin/tokens/alex", nil))
+		}},
+		{"password changed", "password123", func(s *apitest.Server) *http.Response {
+			return s.Do(s.NewAuthedRequest("alex", http.MethodPost, "/v1/account/password", map[string]any{"CurrentPassword": "password", "NewPassword": "password123"}))
+		}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			tokenModes(t, func(t *testing.T, s *apitest.Server) {
+				var resp = tt.revoke(s)
+				resp.Body.Close()
+				if resp.StatusCode != http.StatusNoContent {
+					t.Fatalf("revoking the tokens of alex answered %d", resp.StatusCode)
+				}
+
+				// Within the second of the revocation, which iat can't tell apart.
+				var token string = apitest.Decode[api.LoginResponse](t, login(s, "alex", tt.password), http.StatusOK).AuthToken
+				var req = s.NewRequest(http.MethodGet, "/v1/account/coins", nil)
+				req.Header.Set("Authorization", "Bearer "+token)
+				apitest.Decode[api.CoinBalanceResponse](t, s.Do(req), http.StatusOK)
+			})
+		})
+	}
+}
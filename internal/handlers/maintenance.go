@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/logging"
+	"github.com/RashedMaaitah/goapi/internal/middleware"
+)
+
+var MissingEnabledError = errors.New("Enabled is required.")
+
+// GetMaintenance reports whether the API is down for maintenance.
+func GetMaintenance(mode *middleware.MaintenanceMode) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		api.WriteJSON(w, http.StatusOK, maintenanceResponse(mode.State()), nil)
+	}
+}
+
+// SetMaintenance turns maintenance mode on or off. Only this process is
+// affected, each instance of the API has its own.
+func SetMaintenance(mode *middleware.MaintenanceMode) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var logger = logging.FromContext(r.Context())
+		var params = api.MaintenanceParams{}
+		var err error
+
+		err = api.ReadJSON(w, r, &params)
+
+		if err != nil {
+			logger.Error(err)
+			api.BodyErrorHandler(w, err)
+			return
+		}
+
+		if params.Enabled == nil {
+			api.RequestErrorHandler(w, MissingEnabledError)
+			return
+		}
+
+		var actor string = middleware.GetLoginDetails(r.Context()).Username
+		var state middleware.MaintenanceState = mode.Set(*params.Enabled, strings.TrimSpace(params.Message), time.Duration(params.RetryAfterSeconds)*time.Second, actor)
+
+		if state.Enabled {
+			logger.Warnf("%s turned maintenance mode on, retry after %s: %s", actor, state.RetryAfter, state.Message)
+		} else {
+			logger.Warnf("%s turned maintenance mode off", actor)
+		}
+
+		api.WriteJSON(w, http.StatusOK, maintenanceResponse(state), nil)
+	}
+}
+
+func maintenanceResponse(state middleware.MaintenanceState) api.MaintenanceResponse {
+	return api.MaintenanceResponse{
+		StatusCode:        http.StatusOK,
+		Enabled:           state.Enabled,
+		Message:           state.Message,
+		RetryAfterSeconds: int(state.RetryAfter.Seconds()),
+		Since:             state.Since,
+		By:                state.By,
+	}
+}
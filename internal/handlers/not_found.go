@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/go-chi/chi"
+)
+
+var RouteNotFoundError = errors.New("No route matches the path.")
+
+// routeMethods are the methods tried when listing those a path allows.
+var routeMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+	http.MethodOptions,
+}
+
+// NotFound answers paths no route matches.
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	api.NotFoundErrorHandler(w, api.CodeRouteNotFound, RouteNotFoundError)
+}
+
+// MethodNotAllowed answers paths that have routes, but none for the method
+// of the request, listing the methods the path has routes for in Allow.
+func MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	var routes chi.Routes = chi.RouteContext(r.Context()).Routes
+	var path string = r.URL.Path
+	if r.URL.RawPath != "" {
+		path = r.URL.RawPath
+	}
+	// As StripSlashes does before routing.
+	if len(path) > 1 {
+		path = strings.TrimSuffix(path, "/")
+	}
+
+	var allowed []string
+	for _, method := range routeMethods {
+		if routes.Match(chi.NewRouteContext(), method, path) {
+			allowed = append(allowed, method)
+		}
+	}
+
+	api.MethodNotAllowedHandler(w, allowed)
+}
+
+// routeErrors sets NotFound and MethodNotAllowed on r. chi runs them behind
+// the middleware r has so far, and copies them to sub-routers behind theirs
+// too, which would run it twice. So every router sets its own, before its
+// middleware.
+func routeErrors(r chi.Router) {
+	r.NotFound(NotFound)
+	r.MethodNotAllowed(MethodNotAllowed)
+}
@@ -0,0 +1,46 @@
+package handlers_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/apitest"
+)
+
+func TestUnknownPath(t *testing.T) {
+	var s = apitest.New(t)
+
+	for _, path := range []string{"/nonexistent", "/v1/nonexistent", "/v1/account/nonexistent", "/v1/admin/nonexistent"} {
+		t.Run(path, func(t *testing.T) {
+			var resp = s.Do(s.NewAuthedRequest("admin", http.MethodGet, path, nil))
+			if resp.Header.Get("Content-Type") != "application/json" {
+				t.Errorf("Content-Type = %q, want JSON", resp.Header.Get("Content-Type"))
+			}
+			apitest.DecodeError(t, resp, http.StatusNotFound, api.CodeRouteNotFound)
+		})
+	}
+}
+
+func TestWrongMethod(t *testing.T) {
+	var s = apitest.New(t)
+
+	for _, tt := range []struct {
+		method string
+		path   string
+		allow  string
+	}{
+		{http.MethodDelete, "/v1/account/coins", "GET"},
+		{http.MethodDelete, "/account/coins", "GET"},
+		{http.MethodPut, "/v1/account/profile", "GET, PATCH"},
+		{http.MethodPatch, "/v1/admin/webhooks", "GET, POST"},
+	} {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			var resp = s.Do(s.NewAuthedRequest("admin", tt.method, tt.path, nil))
+			if resp.Header.Get("Allow") != tt.allow {
+				t.Errorf("Allow = %q, want %q", resp.Header.Get("Allow"), tt.allow)
+			}
+			apitest.DecodeError(t, resp, http.StatusMethodNotAllowed, api.CodeMethodNotAllowed)
+		})
+	}
+}
@@ -0,0 +1,258 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"os"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/accesslog"
+	"github.com/RashedMaaitah/goapi/internal/audit"
+	"github.com/RashedMaaitah/goapi/internal/auth"
+	"github.com/RashedMaaitah/goapi/internal/config"
+	"github.com/RashedMaaitah/goapi/internal/events"
+	"github.com/RashedMaaitah/goapi/internal/leaderboard"
+	"github.com/RashedMaaitah/goapi/internal/lockout"
+	"github.com/RashedMaaitah/goapi/internal/logging"
+	"github.com/RashedMaaitah/goapi/internal/metrics"
+	"github.com/RashedMaaitah/goapi/internal/middleware"
+	"github.com/RashedMaaitah/goapi/internal/tools"
+	"github.com/RashedMaaitah/goapi/internal/tracing"
+	"github.com/RashedMaaitah/goapi/internal/webhooks"
+	log "github.com/sirupsen/logrus"
+)
+
+// Option customizes the routes mounted by Handler. What no option sets is
+// built from the config like the server does, on an in-memory database;
+// Handler doesn't close any of it.
+type Option func(*options)
+
+type options struct {
+	cfg           *config.Config
+	live          *config.Live
+	database      tools.Database
+	logger        *log.Logger
+	readiness     *Readiness
+	metrics       *metrics.Metrics
+	tracing       *tracing.Tracing
+	tokens        auth.Tokens
+	keys          *auth.APIKeys
+	authenticator auth.Authenticator
+	lockouts      *lockout.Lockout
+	stale         *tools.LastKnownGood
+	bus           *events.Bus
+	hooks         *webhooks.Dispatcher
+	auditor       audit.Auditor
+	maintenance   *middleware.MaintenanceMode
+	accessLog     *accesslog.Log
+	cursors       *api.Cursors
+	leaderboard   *leaderboard.Board
+	middleware    []func(http.Handler) http.Handler
+	authDisabled  bool
+}
+
+// WithConfig mounts the routes cfg enables, instead of those of
+// config.Default.
+func WithConfig(cfg *config.Config) Option {
+	return func(o *options) { o.cfg = cfg }
+}
+
+// WithLiveConfig mounts the routes the config in effect in live enables,
+// and follows its reloads.
+func WithLiveConfig(live *config.Live) Option {
+	return func(o *options) {
+		o.live = live
+		o.cfg = live.Get()
+	}
+}
+
+// WithDatabase serves the routes from database.
+func WithDatabase(database tools.Database) Option {
+	return func(o *options) { o.database = database }
+}
+
+// WithLogger logs through logger instead of one built from cfg.Log.
+func WithLogger(logger *log.Logger) Option {
+	return func(o *options) { o.logger = logger }
+}
+
+func WithReadiness(readiness *Readiness) Option {
+	return func(o *options) { o.readiness = readiness }
+}
+
+func WithMetrics(m *metrics.Metrics) Option {
+	return func(o *options) { o.metrics = m }
+}
+
+func WithTracing(t *tracing.Tracing) Option {
+	return func(o *options) { o.tracing = t }
+}
+
+// WithTokens issues and verifies tokens with tokens, and authenticates
+// requests with the API keys of keys through authenticator.
+func WithTokens(tokens auth.Tokens, keys *auth.APIKeys, authenticator auth.Authenticator) Option {
+	return func(o *options) {
+		o.tokens = tokens
+		o.keys = keys
+		o.authenticator = authenticator
+	}
+}
+
+// WithLockouts locks out usernames and IPs through lockouts.
+func WithLockouts(lockouts *lockout.Lockout) Option {
+	return func(o *options) { o.lockouts = lockouts }
+}
+
+// WithStaleReads serves the balances stale kept when the database fails,
+// for the route groups cfg.API.StaleReads enables. stale has to wrap the
+// database.
+func WithStaleReads(stale *tools.LastKnownGood) Option {
+	return func(o *options) { o.stale = stale }
+}
+
+// WithEvents publishes balance changes on bus, and delivers them to the
+// webhooks of hooks.
+func WithEvents(bus *events.Bus, hooks *webhooks.Dispatcher) Option {
+	return func(o *options) {
+		o.bus = bus
+		o.hooks = hooks
+	}
+}
+
+// WithAuditor records logins, admin changes and transfers through auditor,
+// instead of in the audit log of the database.
+func WithAuditor(auditor audit.Auditor) Option {
+	return func(o *options) { o.auditor = auditor }
+}
+
+// WithMaintenance turns maintenance mode on and off through maintenance,
+// instead of one starting as cfg.Maintenance says.
+func WithMaintenance(maintenance *middleware.MaintenanceMode) Option {
+	return func(o *options) { o.maintenance = maintenance }
+}
+
+// WithAccessLog writes an entry of every request to l, instead of to the
+// sink of cfg.Log.Access.
+func WithAccessLog(l *accesslog.Log) Option {
+	return func(o *options) { o.accessLog = l }
+}
+
+// WithLeaderboard serves the leaderboard from the rankings of board,
+// instead of from one refreshed as cfg.API.LeaderboardRefresh says.
+func WithLeaderboard(board *leaderboard.Board) Option {
+	return func(o *options) { o.leaderboard = board }
+}
+
+// WithMiddleware runs mw on every request, after the built-in middleware
+// and before routing.
+func WithMiddleware(mw ...func(http.Handler) http.Handler) Option {
+	return func(o *options) { o.middleware = append(o.middleware, mw...) }
+}
+
+// WithAuthDisabled authenticates every request, with or without
+// credentials, as DisabledAuthUser. It is meant for local experiments and
+// tests, never for a server others can reach.
+func WithAuthDisabled() Option {
+	return func(o *options) { o.authDisabled = true }
+}
+
+// DisabledAuthUser is who requests act as under WithAuthDisabled: the demo
+// admin, with every scope.
+var DisabledAuthUser = tools.LoginDetails{Username: "admin", Role: tools.RoleAdmin}
+
+// fixedAuthenticator authenticates every request as DisabledAuthUser.
+type fixedAuthenticator struct{}
+
+func (fixedAuthenticator) Authenticate(ctx context.Context, r *http.Request) (*auth.Identity, error) {
+	var loginDetails tools.LoginDetails = DisabledAuthUser
+	loginDetails.Scopes = tools.Scopes
+	return &auth.Identity{LoginDetails: &loginDetails, Provider: "disabled"}, nil
+}
+
+func newOptions(opts []Option) (*options, error) {
+	var o = &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	if o.cfg == nil {
+		var cfg config.Config = config.Default()
+		o.cfg = &cfg
+	}
+	if o.live == nil {
+		o.live = config.NewLive(o.cfg)
+	}
+	if o.logger == nil {
+		logger, err := logging.New(o.cfg.Log, os.Stderr)
+		if err != nil {
+			return nil, err
+		}
+		o.logger = logger
+	}
+	if o.database == nil {
+		database, err := tools.NewDatabase(o.cfg.Database, o.logger)
+		if err != nil {
+			return nil, err
+		}
+		o.database = database
+	}
+	if o.readiness == nil {
+		o.readiness = &Readiness{}
+	}
+	if o.metrics == nil {
+		m, err := metrics.Open(o.cfg.Metrics)
+		if err != nil {
+			return nil, err
+		}
+		o.metrics = m
+	}
+	if o.tracing == nil {
+		t, err := tracing.New(o.cfg.Tracing)
+		if err != nil {
+			return nil, err
+		}
+		o.tracing = t
+	}
+	if o.tokens == nil {
+		o.tokens = auth.New(o.cfg.Auth, o.database)
+	}
+	if o.keys == nil {
+		o.keys = auth.NewAPIKeys(o.cfg.Auth.APIKeys, o.database)
+	}
+	if o.authenticator == nil {
+		o.authenticator = auth.NewAuthenticator(o.cfg.Auth, o.database, o.tokens, nil, o.keys, o.metrics)
+	}
+	if o.lockouts == nil && o.cfg.Auth.Lockout.Failures > 0 {
+		o.lockouts = lockout.New(o.cfg.Auth.Lockout, lockout.NewMemoryStore(), o.metrics)
+	}
+	if o.authDisabled {
+		o.authenticator = fixedAuthenticator{}
+	}
+	if o.bus == nil {
+		o.bus = events.NewBus()
+	}
+	if o.hooks == nil {
+		o.hooks = webhooks.New(o.live, o.logger, o.bus)
+	}
+	if o.auditor == nil {
+		o.auditor = audit.New(o.database, o.metrics)
+	}
+	// Shared by the /v1 routes and their legacy aliases, whose cursors are
+	// the same.
+	o.cursors = api.NewCursors([]byte(o.cfg.API.CursorSecret))
+	if o.maintenance == nil {
+		o.maintenance = middleware.NewMaintenanceMode(o.cfg.Maintenance)
+	}
+	if o.leaderboard == nil {
+		o.leaderboard = leaderboard.Start(o.database, o.cfg.API.LeaderboardRefresh.Duration(), o.cfg.API.LeaderboardSize, o.logger, o.metrics)
+	}
+	if o.accessLog == nil {
+		l, err := accesslog.Open(o.cfg.Log.Access, o.logger, o.metrics)
+		if err != nil {
+			return nil, err
+		}
+		o.accessLog = l
+	}
+
+	return o, nil
+}
@@ -0,0 +1,98 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/handlers"
+	"github.com/RashedMaaitah/goapi/internal/tools"
+	"github.com/go-chi/chi"
+	log "github.com/sirupsen/logrus"
+)
+
+// route serves a request of path on the routes Handler mounts with opts.
+func route(t *testing.T, path string, opts ...handlers.Option) *httptest.ResponseRecorder {
+	t.Helper()
+	var r *chi.Mux = chi.NewRouter()
+	if err := handlers.Handler(r, opts...); err != nil {
+		t.Fatal(err)
+	}
+
+	var w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	return w
+}
+
+func discardLogger() *log.Logger {
+	var logger = log.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}
+
+func TestHandlerDefaults(t *testing.T) {
+	if w := route(t, "/healthz", handlers.WithLogger(discardLogger())); w.Code != http.StatusOK {
+		t.Errorf("GET /healthz answered %d", w.Code)
+	}
+	// Auth stays on.
+	if w := route(t, "/v1/account/coins", handlers.WithLogger(discardLogger())); w.Code != http.StatusUnauthorized {
+		t.Errorf("GET /v1/account/coins without a token answered %d, want 401", w.Code)
+	}
+}
+
+func TestWithAuthDisabledActsAsTheAdmin(t *testing.T) {
+	var w = route(t, "/v1/admin/stats", handlers.WithLogger(discardLogger()), handlers.WithAuthDisabled())
+	if w.Code != http.StatusOK {
+		t.Errorf("GET /v1/admin/stats without a token answered %d, want 200", w.Code)
+	}
+}
+
+func TestWithDatabase(t *testing.T) {
+	var database tools.Database = tools.NewInMemoryDB(discardLogger())
+	if _, err := database.CreateUser(context.Background(), handlers.DisabledAuthUser.Username, "hash"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.AdjustUserCoins(context.Background(), handlers.DisabledAuthUser.Username, tools.DefaultCurrency, 77, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	var w = route(t, "/v1/account/coins", handlers.WithLogger(discardLogger()), handlers.WithAuthDisabled(), handlers.WithDatabase(database))
+	if w.Code != http.StatusOK || !bytes.Contains(w.Body.Bytes(), []byte(`"Balance":"77"`)) {
+		t.Errorf("GET /v1/account/coins answered %d %s, want the 77 coins of the database given", w.Code, w.Body)
+	}
+}
+
+func TestWithLogger(t *testing.T) {
+	var logs bytes.Buffer
+	var logger = log.New()
+	logger.SetOutput(&logs)
+
+	route(t, "/v1/account/coins", handlers.WithLogger(logger))
+	if !bytes.Contains(logs.Bytes(), []byte("/v1/account/coins")) {
+		t.Errorf("nothing logged of the request: %q", logs.String())
+	}
+}
+
+func TestWithMiddleware(t *testing.T) {
+	var requestIDs []string
+	var mw = func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// After the built-in middleware, which gave the request an ID.
+			requestIDs = append(requestIDs, w.Header().Get(api.RequestIDHeader))
+			w.Header().Set("X-Custom", "1")
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	var w = route(t, "/healthz", handlers.WithLogger(discardLogger()), handlers.WithMiddleware(mw))
+	if w.Header().Get("X-Custom") != "1" {
+		t.Error("the middleware didn't run")
+	}
+	if len(requestIDs) != 1 || requestIDs[0] == "" || requestIDs[0] != w.Header().Get(api.RequestIDHeader) {
+		t.Errorf("the middleware saw the request IDs %q, want that of the response", requestIDs)
+	}
+}
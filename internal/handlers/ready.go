@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/logging"
+	"github.com/RashedMaaitah/goapi/internal/middleware"
+	"github.com/RashedMaaitah/goapi/internal/tools"
+)
+
+// Readiness tracks whether the service should receive traffic.
+type Readiness struct {
+	shuttingDown atomic.Bool
+	breaker      *tools.Breaker
+	maintenance  *middleware.MaintenanceMode
+
+	drainInit sync.Once
+	drainOnce sync.Once
+	drain     chan struct{}
+}
+
+// SetBreaker makes /readyz report the state of breaker. It must be called
+// before serving.
+func (rd *Readiness) SetBreaker(breaker *tools.Breaker) {
+	rd.breaker = breaker
+}
+
+// SetMaintenance makes /readyz fail while maintenance is enabled. It must
+// be called before serving.
+func (rd *Readiness) SetMaintenance(maintenance *middleware.MaintenanceMode) {
+	rd.maintenance = maintenance
+}
+
+// SetShuttingDown makes /readyz fail from now on so load balancers take the
+// instance out of rotation while in-flight requests drain.
+func (rd *Readiness) SetShuttingDown() {
+	rd.shuttingDown.Store(true)
+}
+
+func (rd *Readiness) ShuttingDown() bool {
+	return rd.shuttingDown.Load()
+}
+
+// Drain asks for the server to shut down as on a SIGTERM, which server.Run
+// does once Drained is closed. It reports whether it was the first call.
+func (rd *Readiness) Drain() bool {
+	var first bool
+	rd.drainOnce.Do(func() {
+		close(rd.drained())
+		first = true
+	})
+	return first
+}
+
+// Drained is closed once Drain was called.
+func (rd *Readiness) Drained() <-chan struct{} {
+	return rd.drained()
+}
+
+func (rd *Readiness) drained() chan struct{} {
+	rd.drainInit.Do(func() { rd.drain = make(chan struct{}) })
+	return rd.drain
+}
+
+// Readyz is the readiness probe. It pings every dependency with timeout and
+// reports 503 when any of them fails, the server is shutting down or down
+// for maintenance, along with the state of the database circuit breaker.
+func Readyz(readiness *Readiness, database tools.Database, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var logger = logging.FromContext(r.Context())
+		var response = api.ReadinessResponse{
+			Status: "ready",
+			Checks: map[string]string{},
+		}
+		var statusCode int = http.StatusOK
+
+		if readiness.ShuttingDown() {
+			response.Status = "shutting down"
+			statusCode = http.StatusServiceUnavailable
+		} else if readiness.maintenance != nil && readiness.maintenance.Enabled() {
+			response.Status = "maintenance"
+			statusCode = http.StatusServiceUnavailable
+		} else {
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+
+			response.Checks["database"] = "ok"
+			if err := database.Ping(ctx); err != nil {
+				logger.Warnf("Readiness check failed: database: %v", err)
+				response.Checks["database"] = err.Error()
+				response.Status = "not ready"
+				statusCode = http.StatusServiceUnavailable
+			}
+		}
+
+		if readiness.breaker != nil {
+			response.Checks["database_breaker"] = readiness.breaker.State()
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(statusCode)
+		err := json.NewEncoder(w).Encode(response)
+
+		if err != nil {
+			logger.Error(err)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/auth"
+	"github.com/RashedMaaitah/goapi/internal/config"
+	"github.com/RashedMaaitah/goapi/internal/lockout"
+	"github.com/RashedMaaitah/goapi/internal/logging"
+	"github.com/RashedMaaitah/goapi/internal/middleware"
+)
+
+// RefreshToken exchanges a valid token for a new one with a fresh expiry.
+// Expired tokens cannot be refreshed, their owners have to log in again.
+// The new token grants the scope parameters, which the old one must grant,
+// or all the old one does; one granting none can't be refreshed.
+func RefreshToken(cfg config.AuthConfig, tokens auth.Tokens, lockouts *lockout.Lockout, trustProxy bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var logger = logging.FromContext(r.Context())
+		var params = api.RefreshParams{}
+		var err error
+
+		if violations := api.ReadQuery(r, &params); len(violations) > 0 {
+			api.ValidationErrorHandler(w, violations)
+			return
+		}
+
+		old, err := middleware.ReadToken(r, auth.NewTokenSource(cfg))
+		if err == nil && old == "" {
+			err = api.ErrMissingToken
+		}
+		if err != nil {
+			api.WriteErr(w, err)
+			return
+		}
+
+		var claims *auth.Claims
+		err = middleware.CheckToken(r, lockouts, trustProxy, func() error {
+			var err error
+			claims, err = tokens.Verify(r.Context(), old)
+			return err
+		})
+
+		if err != nil {
+			api.WriteErr(w, err)
+			return
+		}
+
+		scopes, err := auth.GrantScopes(params.Scopes, claims.Granted(cfg.LegacyFullAccess))
+		if err != nil {
+			logger.Warnf("Refreshing the token of %s: %v", claims.Username, err)
+			scopeErrorHandler(w, err)
+			return
+		}
+		// A token issued before scopes, without cfg.LegacyFullAccess.
+		if len(scopes) == 0 {
+			logger.Warnf("Token of %s grants no scope, it can't be refreshed", claims.Username)
+			api.WriteErr(w, auth.ErrInvalidToken)
+			return
+		}
+
+		var token *auth.Token
+		token, err = tokens.Issue(r.Context(), claims.Username, scopes)
+
+		if err != nil {
+			logger.Error(err)
+			api.InternalErrorHandler(w)
+			return
+		}
+
+		logger.Infof("Refreshed token of %s", claims.Username)
+
+		var response = api.LoginResponse{
+			StatusCode: http.StatusOK,
+			AuthToken:  token.Value,
+			ExpiresAt:  token.ExpiresAt,
+			Scopes:     token.Scopes,
+		}
+
+		api.WriteJSON(w, http.StatusOK, response, nil)
+	}
+}
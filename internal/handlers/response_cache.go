@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"sync"
+	"time"
+)
+
+type cacheEntry[V any] struct {
+	value   V
+	expires time.Time
+}
+
+// responseCache keeps computed responses for ttl, one per key.
+type responseCache[K comparable, V any] struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[K]cacheEntry[V]
+}
+
+func newResponseCache[K comparable, V any](ttl time.Duration) *responseCache[K, V] {
+	return &responseCache[K, V]{ttl: ttl, entries: map[K]cacheEntry[V]{}}
+}
+
+func (c *responseCache[K, V]) get(key K, now time.Time) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || !now.Before(entry.expires) {
+		var zero V
+		return zero, false
+	}
+	return entry.value, true
+}
+
+func (c *responseCache[K, V]) put(key K, value V, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[key] = cacheEntry[V]{value: value, expires: now.Add(c.ttl)}
+}
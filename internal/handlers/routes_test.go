@@ -0,0 +1,177 @@
+package handlers_test
+
+import (
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/apitest"
+	"github.com/RashedMaaitah/goapi/internal/config"
+)
+
+// routeCase is a request of user, none when "", and the status and, for
+// errors, the code it is answered with.
+type routeCase struct {
+	name   string
+	user   string
+	method string
+	path   string
+	body   any
+	status int
+	code   string
+}
+
+// testRoutes sends each case to a Server of its own, built with opts, so
+// the changes one makes don't reach the others.
+func testRoutes(t *testing.T, cases []routeCase, opts ...apitest.Option) {
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			var s = apitest.New(t, opts...)
+
+			var req *http.Request
+			if tt.user == "" {
+				req = s.NewRequest(tt.method, tt.path, tt.body)
+			} else {
+				req = s.NewAuthedRequest(tt.user, tt.method, tt.path, tt.body)
+			}
+			var resp = s.Do(req)
+
+			if tt.code != "" {
+				apitest.DecodeError(t, resp, tt.status, tt.code)
+				return
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode != tt.status {
+				t.Errorf("%s %s answered %d, want %d: %s", tt.method, tt.path, resp.StatusCode, tt.status, body)
+			}
+		})
+	}
+}
+
+func TestPublicRoutes(t *testing.T) {
+	testRoutes(t, []routeCase{
+		{"leaderboard", "", http.MethodGet, "/v1/leaderboard", nil, http.StatusOK, ""},
+		{"leaderboard with a bad limit", "", http.MethodGet, "/v1/leaderboard?limit=-1", nil, http.StatusBadRequest, api.CodeValidationFailed},
+
+		{"sign up", "", http.MethodPost, "/v1/users", map[string]any{"username": "newbie", "password": "password123"}, http.StatusCreated, ""},
+		{"sign up as a taken name", "", http.MethodPost, "/v1/users", map[string]any{"username": "alex", "password": "password123"}, http.StatusConflict, api.CodeUserExists},
+		{"sign up with a short password", "", http.MethodPost, "/v1/users", map[string]any{"username": "newbie", "password": "short"}, http.StatusBadRequest, api.CodeValidationFailed},
+
+		{"login", "", http.MethodPost, "/v1/login", map[string]any{"username": "alex", "password": "password"}, http.StatusOK, ""},
+		{"login with a wrong password", "", http.MethodPost, "/v1/login", map[string]any{"username": "alex", "password": "nope"}, http.StatusUnauthorized, api.CodeInvalidCredentials},
+		{"login of an unknown user", "", http.MethodPost, "/v1/login", map[string]any{"username": "nobody", "password": "password"}, http.StatusUnauthorized, api.CodeInvalidCredentials},
+		{"login without a password", "", http.MethodPost, "/v1/login", map[string]any{"username": "alex"}, http.StatusBadRequest, api.CodeValidationFailed},
+
+		{"token refresh", "alex", http.MethodPost, "/v1/token/refresh", nil, http.StatusOK, ""},
+		{"token refresh without a token", "", http.MethodPost, "/v1/token/refresh", nil, http.StatusUnauthorized, api.CodeMissingToken},
+	})
+}
+
+func TestAccountRoutes(t *testing.T) {
+	testRoutes(t, []routeCase{
+		{"balance", "alex", http.MethodGet, "/v1/account/coins", nil, http.StatusOK, ""},
+		{"balance without a token", "", http.MethodGet, "/v1/account/coins", nil, http.StatusUnauthorized, api.CodeMissingToken},
+		{"balance of a bad username", "alex", http.MethodGet, "/v1/account/coins?username=a%20b", nil, http.StatusBadRequest, api.CodeValidationFailed},
+
+		{"balance by name", "alex", http.MethodGet, "/v1/users/alex/coins", nil, http.StatusOK, ""},
+		{"balance by name without a token", "", http.MethodGet, "/v1/users/alex/coins", nil, http.StatusUnauthorized, api.CodeMissingToken},
+		{"balance of an unknown user", "admin", http.MethodGet, "/v1/users/nobody/coins", nil, http.StatusNotFound, api.CodeUserNotFound},
+
+		{"profile", "alex", http.MethodGet, "/v1/account/profile", nil, http.StatusOK, ""},
+		{"profile without a token", "", http.MethodGet, "/v1/account/profile", nil, http.StatusUnauthorized, api.CodeMissingToken},
+		{"profile update", "alex", http.MethodPatch, "/v1/account/profile", map[string]any{"DisplayName": "Alex"}, http.StatusOK, ""},
+		{"profile update of an unknown field", "alex", http.MethodPatch, "/v1/account/profile", map[string]any{"Role": "admin"}, http.StatusBadRequest, api.CodeValidationFailed},
+
+		{"password change", "alex", http.MethodPost, "/v1/account/password", map[string]any{"CurrentPassword": "password", "NewPassword": "password123"}, http.StatusNoContent, ""},
+		{"password change with a wrong password", "alex", http.MethodPost, "/v1/account/password", map[string]any{"CurrentPassword": "nope", "NewPassword": "password123"}, http.StatusUnauthorized, api.CodeInvalidCredentials},
+		{"password change to a short one", "alex", http.MethodPost, "/v1/account/password", map[string]any{"CurrentPassword": "password", "NewPassword": "short"}, http.StatusBadRequest, api.CodeValidationFailed},
+
+		{"deposit", "alex", http.MethodPost, "/v1/account/coins/deposit", map[string]any{"amount": 5}, http.StatusOK, ""},
+		{"deposit without a token", "", http.MethodPost, "/v1/account/coins/deposit", map[string]any{"amount": 5}, http.StatusUnauthorized, api.CodeMissingToken},
+		{"deposit of nothing", "alex", http.MethodPost, "/v1/account/coins/deposit", map[string]any{"amount": -5}, http.StatusBadRequest, api.CodeValidationFailed},
+
+		{"withdrawal", "alex", http.MethodPost, "/v1/account/coins/withdraw", map[string]any{"amount": 5}, http.StatusOK, ""},
+		{"withdrawal without a token", "", http.MethodPost, "/v1/account/coins/withdraw", map[string]any{"amount": 5}, http.StatusUnauthorized, api.CodeMissingToken},
+		{"withdrawal without an amount", "alex", http.MethodPost, "/v1/account/coins/withdraw", map[string]any{}, http.StatusBadRequest, api.CodeValidationFailed},
+
+		{"transfer", "alex", http.MethodPost, "/v1/account/coins/transfer", map[string]any{"to": "maria", "amount": 5}, http.StatusOK, ""},
+		{"transfer without a token", "", http.MethodPost, "/v1/account/coins/transfer", map[string]any{"to": "maria", "amount": 5}, http.StatusUnauthorized, api.CodeMissingToken},
+		{"transfer to an unknown user", "alex", http.MethodPost, "/v1/account/coins/transfer", map[string]any{"to": "nobody", "amount": 5}, http.StatusNotFound, api.CodeUserNotFound},
+		{"transfer to a bad username", "alex", http.MethodPost, "/v1/account/coins/transfer", map[string]any{"to": "a b", "amount": 5}, http.StatusBadRequest, api.CodeValidationFailed},
+
+		{"transactions", "alex", http.MethodGet, "/v1/account/transactions", nil, http.StatusOK, ""},
+		{"transactions without a token", "", http.MethodGet, "/v1/account/transactions", nil, http.StatusUnauthorized, api.CodeMissingToken},
+		{"transactions with a bad limit", "alex", http.MethodGet, "/v1/account/transactions?limit=-1", nil, http.StatusBadRequest, api.CodeValidationFailed},
+
+		{"export", "alex", http.MethodGet, "/v1/account/export?format=csv", nil, http.StatusOK, ""},
+		{"export without a token", "", http.MethodGet, "/v1/account/export?format=csv", nil, http.StatusUnauthorized, api.CodeMissingToken},
+		{"export in an unknown format", "alex", http.MethodGet, "/v1/account/export?format=xml", nil, http.StatusBadRequest, api.CodeValidationFailed},
+	})
+}
+
+func TestAdminRoutes(t *testing.T) {
+	testRoutes(t, []routeCase{
+		{"user deletion", "admin", http.MethodDelete, "/v1/users/john", nil, http.StatusNoContent, ""},
+		{"user deletion by a user", "alex", http.MethodDelete, "/v1/users/john", nil, http.StatusForbidden, api.CodeInsufficientRole},
+		{"deletion of an unknown user", "admin", http.MethodDelete, "/v1/users/nobody", nil, http.StatusNotFound, api.CodeUserNotFound},
+
+		{"batch balances", "admin", http.MethodPost, "/v1/admin/coins/batch", map[string]any{"Usernames": []string{"alex", "nobody"}}, http.StatusOK, ""},
+		{"batch balances by a user", "alex", http.MethodPost, "/v1/admin/coins/batch", map[string]any{"Usernames": []string{"alex"}}, http.StatusForbidden, api.CodeInsufficientRole},
+		{"batch balances of nobody", "admin", http.MethodPost, "/v1/admin/coins/batch", map[string]any{}, http.StatusBadRequest, api.CodeValidationFailed},
+
+		{"user search", "admin", http.MethodGet, "/v1/admin/users?prefix=a", nil, http.StatusOK, ""},
+		{"user search without a token", "", http.MethodGet, "/v1/admin/users", nil, http.StatusUnauthorized, api.CodeMissingToken},
+		{"user search in an unknown order", "admin", http.MethodGet, "/v1/admin/users?sort=age", nil, http.StatusBadRequest, api.CodeValidationFailed},
+
+		{"import", "admin", http.MethodPost, "/v1/admin/users/import", []map[string]any{{"username": "newbie", "password": "password123"}}, http.StatusOK, ""},
+		{"import by a user", "alex", http.MethodPost, "/v1/admin/users/import", []map[string]any{}, http.StatusForbidden, api.CodeInsufficientRole},
+		{"import in an unknown mode", "admin", http.MethodPost, "/v1/admin/users/import?mode=some", []map[string]any{}, http.StatusBadRequest, api.CodeInvalidRequest},
+
+		{"ledger check", "admin", http.MethodGet, "/v1/admin/ledger/verify", nil, http.StatusOK, ""},
+		{"ledger check by a user", "alex", http.MethodGet, "/v1/admin/ledger/verify", nil, http.StatusForbidden, api.CodeInsufficientRole},
+		{"unknown ledger transaction", "admin", http.MethodGet, "/v1/admin/ledger/nope", nil, http.StatusNotFound, api.CodeTransactionNotFound},
+
+		{"audit", "admin", http.MethodGet, "/v1/admin/audit", nil, http.StatusOK, ""},
+		{"audit by a user", "alex", http.MethodGet, "/v1/admin/audit", nil, http.StatusForbidden, api.CodeInsufficientRole},
+		{"audit of an unknown action", "admin", http.MethodGet, "/v1/admin/audit?action=jump", nil, http.StatusBadRequest, api.CodeValidationFailed},
+
+		{"maintenance", "admin", http.MethodGet, "/v1/admin/maintenance", nil, http.StatusOK, ""},
+		{"maintenance set", "admin", http.MethodPost, "/v1/admin/maintenance", map[string]any{"Enabled": false}, http.StatusOK, ""},
+		{"maintenance set by a user", "alex", http.MethodPost, "/v1/admin/maintenance", map[string]any{"Enabled": false}, http.StatusForbidden, api.CodeInsufficientRole},
+		{"maintenance with a bad Retry-After", "admin", http.MethodPost, "/v1/admin/maintenance", map[string]any{"RetryAfterSeconds": -1}, http.StatusBadRequest, api.CodeValidationFailed},
+
+		{"webhook registration", "admin", http.MethodPost, "/v1/admin/webhooks", map[string]any{"URL": "https://example.com/hook"}, http.StatusCreated, ""},
+		{"webhook registration by a user", "alex", http.MethodPost, "/v1/admin/webhooks", map[string]any{"URL": "https://example.com/hook"}, http.StatusForbidden, api.CodeInsufficientRole},
+		{"webhook registration without a URL", "admin", http.MethodPost, "/v1/admin/webhooks", map[string]any{}, http.StatusBadRequest, api.CodeValidationFailed},
+		{"webhooks", "admin", http.MethodGet, "/v1/admin/webhooks", nil, http.StatusOK, ""},
+		{"unknown webhook", "admin", http.MethodDelete, "/v1/admin/webhooks/nope", nil, http.StatusNotFound, api.CodeWebhookNotFound},
+
+		{"API key creation", "admin", http.MethodPost, "/v1/admin/apikeys", map[string]any{"Name": "billing", "Role": "user"}, http.StatusCreated, ""},
+		{"API key creation by a user", "alex", http.MethodPost, "/v1/admin/apikeys", map[string]any{"Name": "billing"}, http.StatusForbidden, api.CodeInsufficientRole},
+		{"API key of an unknown role", "admin", http.MethodPost, "/v1/admin/apikeys", map[string]any{"Name": "billing", "Role": "root"}, http.StatusBadRequest, api.CodeValidationFailed},
+		{"API keys", "admin", http.MethodGet, "/v1/admin/apikeys", nil, http.StatusOK, ""},
+		{"unknown API key", "admin", http.MethodDelete, "/v1/admin/apikeys/nope", nil, http.StatusNotFound, api.CodeAPIKeyNotFound},
+
+		{"token revocation", "admin", http.MethodDelete, "/v1/admin/tokens/alex", nil, http.StatusNoContent, ""},
+		{"token revocation by a user", "alex", http.MethodDelete, "/v1/admin/tokens/maria", nil, http.StatusForbidden, api.CodeInsufficientRole},
+
+		{"freeze", "admin", http.MethodPost, "/v1/admin/users/alex/freeze", map[string]any{"Reason": "test"}, http.StatusOK, ""},
+		{"freeze of an unknown user", "admin", http.MethodPost, "/v1/admin/users/nobody/freeze", map[string]any{"Reason": "test"}, http.StatusNotFound, api.CodeUserNotFound},
+		{"unfreeze", "admin", http.MethodPost, "/v1/admin/users/alex/unfreeze", map[string]any{"Reason": "test"}, http.StatusOK, ""},
+		{"restore of an unknown user", "admin", http.MethodPost, "/v1/admin/users/nobody/restore", nil, http.StatusNotFound, api.CodeUserNotFound},
+
+		{"overdraft", "admin", http.MethodPut, "/v1/admin/users/alex/overdraft", map[string]any{"Allow": true}, http.StatusOK, ""},
+		{"overdraft of an unknown user", "admin", http.MethodPut, "/v1/admin/users/nobody/overdraft", map[string]any{"Allow": true}, http.StatusNotFound, api.CodeUserNotFound},
+
+		{"balance set", "admin", http.MethodPut, "/v1/admin/users/alex/coins", map[string]any{"Balance": 5}, http.StatusOK, ""},
+		{"balance set by a user", "alex", http.MethodPut, "/v1/admin/users/alex/coins", map[string]any{"Balance": 5}, http.StatusForbidden, api.CodeInsufficientRole},
+		{"balance set of an unknown user", "admin", http.MethodPut, "/v1/admin/users/nobody/coins", map[string]any{"Balance": 5}, http.StatusNotFound, api.CodeUserNotFound},
+		{"balance set without a balance", "admin", http.MethodPut, "/v1/admin/users/alex/coins", map[string]any{}, http.StatusBadRequest, api.CodeValidationFailed},
+
+		{"balance adjustment", "admin", http.MethodPost, "/v1/admin/users/alex/coins/adjust", map[string]any{"Delta": 5, "Reason": "test"}, http.StatusOK, ""},
+		{"balance adjustment of an unknown user", "admin", http.MethodPost, "/v1/admin/users/nobody/coins/adjust", map[string]any{"Delta": 5, "Reason": "test"}, http.StatusNotFound, api.CodeUserNotFound},
+		{"balance adjustment without a delta", "admin", http.MethodPost, "/v1/admin/users/alex/coins/adjust", map[string]any{"Reason": "test"}, http.StatusBadRequest, api.CodeValidationFailed},
+	}, apitest.WithConfig(func(cfg *config.Config) { cfg.API.OverdraftLimit = 100 }))
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/logging"
+	"github.com/RashedMaaitah/goapi/internal/tools"
+)
+
+const (
+	defaultSearchLimit = 50
+	maxSearchLimit     = 100
+)
+
+var userSortFields = []string{tools.SortByUsername, tools.SortByCoins, tools.SortByCreatedAt}
+
+// SearchUsers pages through the users matching a search by offset. The
+// cursors are bound to the search, so they can't skip into another one.
+func SearchUsers(database tools.Database, cursors *api.Cursors) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var logger = logging.FromContext(r.Context())
+		var params = api.UserSearchParams{}
+		var err error
+
+		if violations := api.ReadQuery(r, &params); len(violations) > 0 {
+			api.ValidationErrorHandler(w, violations)
+			return
+		}
+
+		var filter = tools.UserFilter{
+			Prefix:   api.NormalizeUsername(params.Prefix),
+			MinCoins: params.MinCoins,
+			MaxCoins: params.MaxCoins,
+			Role:     params.Role,
+			SortBy:   tools.SortByUsername,
+		}
+
+		if params.Sort != "" {
+			if !slices.Contains(userSortFields, params.Sort) {
+				api.RequestErrorHandler(w, fmt.Errorf("Invalid sort %q, must be one of: %s.", params.Sort, strings.Join(userSortFields, ", ")))
+				return
+			}
+			filter.SortBy = params.Sort
+		}
+
+		switch params.Order {
+		case "", "asc":
+		case "desc":
+			filter.Desc = true
+		default:
+			api.RequestErrorHandler(w, fmt.Errorf("Invalid order %q, must be asc or desc.", params.Order))
+			return
+		}
+
+		filter.Limit, err = params.PageLimit(defaultSearchLimit, maxSearchLimit)
+		if err != nil {
+			api.RequestErrorHandler(w, err)
+			return
+		}
+
+		var scope string = searchCursorScope(filter)
+		if params.Cursor != "" {
+			offset, err := cursors.Decode(scope, params.Cursor)
+			if err != nil {
+				logger.Warnf("Invalid search cursor %q", params.Cursor)
+				api.RequestErrorHandler(w, err)
+				return
+			}
+			filter.Offset = int(offset)
+		}
+
+		// One extra row tells whether there is a next page.
+		filter.Limit++
+		var users []tools.UserSummary
+		users, err = database.SearchUsers(r.Context(), filter)
+		filter.Limit--
+
+		if err != nil {
+			logger.Error(err)
+			api.InternalErrorHandler(w)
+			return
+		}
+
+		var response = api.UserSearchResponse{
+			StatusCode:   http.StatusOK,
+			PageResponse: api.PageResponse[api.UserSummary]{Items: []api.UserSummary{}},
+		}
+
+		// The cursor of a search is the offset of the next page, and the
+		// last page tells how many users matched.
+		if len(users) > filter.Limit {
+			users = users[:filter.Limit]
+			response.NextCursor = cursors.Encode(scope, int64(filter.Offset+filter.Limit))
+		} else {
+			response.Total = pageTotal(filter.Offset, len(users))
+		}
+
+		for _, user := range users {
+			response.Items = append(response.Items, api.UserSummary{
+				Username:  user.Username,
+				Balance:   api.Amount(user.Coins),
+				Role:      user.Role,
+				CreatedAt: user.CreatedAt,
+			})
+		}
+
+		api.WriteJSON(w, http.StatusOK, response, nil)
+	}
+}
+
+// searchCursorScope is the scope of the cursors of the search of filter,
+// without its limit and offset.
+func searchCursorScope(filter tools.UserFilter) string {
+	var bound = func(coins *int64) string {
+		if coins == nil {
+			return ""
+		}
+		return strconv.FormatInt(*coins, 10)
+	}
+	return strings.Join([]string{usersCursor, filter.Prefix, bound(filter.MinCoins), bound(filter.MaxCoins), filter.Role, filter.SortBy, strconv.FormatBool(filter.Desc)}, "\x00")
+}
+
+// pageTotal is the length of a list paged by offset, known on its last
+// page, unless that page is past the end of the list.
+func pageTotal(offset, length int) *int64 {
+	if length == 0 && offset > 0 {
+		return nil
+	}
+	var total = int64(offset + length)
+	return &total
+}
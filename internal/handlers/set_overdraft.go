@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/config"
+	"github.com/RashedMaaitah/goapi/internal/logging"
+	"github.com/RashedMaaitah/goapi/internal/middleware"
+	"github.com/RashedMaaitah/goapi/internal/tools"
+)
+
+var OverdraftDisabledError = errors.New("Overdrafts are disabled, set api.overdraft_limit to allow them.")
+
+// SetOverdraft lets the user in the path go down to the configured
+// overdraft limit, or with Allow false back to zero. Balances already below
+// zero stay as they are, only further withdrawals are refused.
+func SetOverdraft(cfg config.APIConfig, database tools.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var logger = logging.FromContext(r.Context())
+		var params = api.OverdraftParams{}
+		var err error
+
+		err = api.ReadJSON(w, r, &params)
+
+		if err != nil {
+			logger.Error(err)
+			api.BodyErrorHandler(w, err)
+			return
+		}
+
+		var limit int64
+		if params.Allow {
+			if cfg.OverdraftLimit == 0 {
+				api.RequestErrorHandler(w, OverdraftDisabledError)
+				return
+			}
+			limit = cfg.OverdraftLimit
+		}
+
+		var actor string = middleware.GetLoginDetails(r.Context()).Username
+		var username string = middleware.PathUsername(r)
+
+		var coinDetails *tools.CoinDetails
+		coinDetails, err = database.SetOverdraft(r.Context(), username, limit)
+
+		if err != nil {
+			api.WriteErr(w, err)
+			return
+		}
+
+		logger.Infof("%s set the overdraft limit of %s to %d", actor, username, limit)
+
+		var response = api.OverdraftResponse{
+			StatusCode:     http.StatusOK,
+			Username:       username,
+			AllowOverdraft: coinDetails.OverdraftLimit > 0,
+			Floor:          api.Amount(coinDetails.Floor()),
+		}
+
+		api.WriteJSON(w, http.StatusOK, response, nil)
+	}
+}
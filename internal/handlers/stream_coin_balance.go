@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/internal/events"
+	"github.com/RashedMaaitah/goapi/internal/logging"
+	"github.com/RashedMaaitah/goapi/internal/middleware"
+)
+
+const (
+	streamHeartbeat = 15 * time.Second
+	// streamBuffer is how many events a slow client may fall behind by
+	// before it misses some.
+	streamBuffer = 16
+
+	streamShutdownEvent = "shutdown"
+)
+
+// StreamCoinBalance sends a server-sent event for every change to the
+// balance of the user, and a comment every streamHeartbeat to keep proxies
+// from closing the connection. A final shutdown event is sent when the
+// server stops.
+func StreamCoinBalance(bus *events.Bus) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var logger = logging.FromContext(r.Context())
+		var username string = middleware.GetLoginDetails(r.Context()).Username
+		var controller = http.NewResponseController(w)
+		var err error
+
+		// The server's write timeout is meant for ordinary responses, as is
+		// the request timeout.
+		err = controller.SetWriteDeadline(time.Time{})
+		middleware.StopTimeout(r.Context())
+		middleware.ReleaseSlot(r.Context())
+
+		if err != nil {
+			logger.Warnf("Clearing the write deadline of a stream: %v", err)
+		}
+
+		var subscription *events.Subscription = bus.Subscribe(username, streamBuffer)
+		defer subscription.Close()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+
+		err = controller.Flush()
+
+		if err != nil {
+			logger.Error(err)
+			return
+		}
+
+		logger.Infof("Streaming balance changes of %s", username)
+
+		var heartbeat = time.NewTicker(streamHeartbeat)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				logger.Infof("Balance stream of %s closed by the client, %d events dropped", username, subscription.Dropped())
+				return
+			case <-bus.Done():
+				writeStreamEvent(w, streamShutdownEvent, "", struct{}{})
+				controller.Flush()
+				return
+			case <-heartbeat.C:
+				_, err = fmt.Fprint(w, ": ping\n\n")
+			case event := <-subscription.C:
+				err = writeStreamEvent(w, event.Type, event.ID, event)
+			}
+
+			if err == nil {
+				err = controller.Flush()
+			}
+
+			if err != nil {
+				logger.Error(err)
+				return
+			}
+		}
+	}
+}
+
+func writeStreamEvent(w http.ResponseWriter, name string, id string, data any) error {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if id != "" {
+		if _, err = fmt.Fprintf(w, "id: %s\n", id); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, body)
+	return err
+}
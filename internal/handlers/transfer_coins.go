@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/audit"
+	"github.com/RashedMaaitah/goapi/internal/config"
+	"github.com/RashedMaaitah/goapi/internal/events"
+	"github.com/RashedMaaitah/goapi/internal/logging"
+	"github.com/RashedMaaitah/goapi/internal/middleware"
+	"github.com/RashedMaaitah/goapi/internal/tools"
+)
+
+var RecipientNotFoundError = errors.New("Recipient does not exist.")
+
+var SenderNotFoundError = errors.New("Your account does not exist.")
+
+var RecipientDeletedError = errors.New("Recipient account has been deleted.")
+
+var SelfTransferError = errors.New("Cannot transfer coins to yourself.")
+
+var TransferFrozenError = errors.New("Your account or the recipient's is frozen.")
+
+// TransferCoins moves coins of one currency to another user; ToCurrency, if
+// given, must be the same currency.
+func TransferCoins(cfg config.APIConfig, database tools.Database, bus *events.Bus, auditor audit.Auditor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var logger = logging.FromContext(r.Context())
+		var params = api.TransferParams{}
+		var err error
+
+		err = api.ReadJSON(w, r, &params)
+
+		if err != nil {
+			logger.Error(err)
+			api.BodyErrorHandler(w, err)
+			return
+		}
+
+		if params.Amount <= 0 {
+			logger.Error(InvalidAmountError)
+			api.RequestErrorHandler(w, InvalidAmountError)
+			return
+		}
+
+		var currency string
+		currency, err = resolveCurrency(cfg, params.Currency)
+
+		if err != nil {
+			api.RequestErrorHandler(w, err)
+			return
+		}
+
+		if params.ToCurrency != "" {
+			toCurrency, toErr := resolveCurrency(cfg, params.ToCurrency)
+			if toErr != nil {
+				api.RequestErrorHandler(w, toErr)
+				return
+			}
+			if toCurrency != currency {
+				api.RequestErrorHandler(w, CrossCurrencyError)
+				return
+			}
+		}
+
+		var username string = middleware.GetLoginDetails(r.Context()).Username
+
+		if params.To == username {
+			logger.Error(SelfTransferError)
+			api.RequestErrorHandler(w, SelfTransferError)
+			return
+		}
+
+		var transfer *tools.TransferDetails
+		transfer, err = database.Transfer(r.Context(), username, params.To, currency, int64(params.Amount))
+		auditor.Record(r.Context(), tools.AuditEntry{
+			Actor:    username,
+			Action:   audit.ActionTransfer,
+			Target:   params.To,
+			Currency: currency,
+			Amount:   int64(params.Amount),
+		}, err)
+
+		switch {
+		case errors.Is(err, tools.ErrSenderNotFound):
+			// Deleted since the token was issued.
+			logger.Warnf("Transfer from %s rejected: %v", username, err)
+			api.UnauthorizedErrorHandler(w, api.CodeInvalidToken, SenderNotFoundError)
+			return
+		case errors.Is(err, tools.ErrUserNotFound):
+			logger.Warnf("Transfer from %s rejected: %v", username, err)
+			api.NotFoundErrorHandler(w, api.CodeUserNotFound, RecipientNotFoundError)
+			return
+		case errors.Is(err, tools.ErrUserDeleted):
+			logger.Warnf("Transfer from %s rejected: %v", username, err)
+			api.NotFoundErrorHandler(w, api.CodeUserNotFound, RecipientDeletedError)
+			return
+		case errors.Is(err, tools.ErrAccountFrozen):
+			logger.Warnf("Transfer from %s rejected: %v", username, err)
+			api.LockedErrorHandler(w, api.CodeAccountFrozen, TransferFrozenError)
+			return
+		case errors.Is(err, tools.ErrSelfTransfer):
+			api.RequestErrorHandler(w, SelfTransferError)
+			return
+		case err != nil:
+			api.WriteErr(w, fmt.Errorf("Transfer of %d %s from %s to %s: %w", params.Amount, currency, username, params.To, err))
+			return
+		}
+
+		logger.Infof("Transferred %d %s from %s to %s (%s)", transfer.Amount, transfer.Currency, transfer.From, transfer.To, transfer.ID)
+
+		bus.Publish(events.Event{
+			Type:      tools.TransactionTransferOut,
+			Username:  transfer.From,
+			Currency:  transfer.Currency,
+			Amount:    transfer.Amount,
+			Balance:   transfer.FromCoins,
+			Timestamp: transfer.CreatedAt,
+		})
+		bus.Publish(events.Event{
+			Type:      tools.TransactionTransferIn,
+			Username:  transfer.To,
+			Currency:  transfer.Currency,
+			Amount:    transfer.Amount,
+			Balance:   transfer.ToCoins,
+			Timestamp: transfer.CreatedAt,
+		})
+
+		var response = api.TransferResponse{
+			TransferID: transfer.ID,
+			Currency:   transfer.Currency,
+			Balance:    api.Amount(transfer.FromCoins),
+		}
+		if cfg.StatusCodeInBody {
+			response.StatusCode = http.StatusOK
+		}
+
+		api.WriteJSON(w, http.StatusOK, response, nil)
+	}
+}
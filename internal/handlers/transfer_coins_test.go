@@ -0,0 +1,79 @@
+package handlers_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/apitest"
+	"github.com/RashedMaaitah/goapi/internal/config"
+	"github.com/RashedMaaitah/goapi/internal/handlers"
+)
+
+func TestTransfer(t *testing.T) {
+	var s = apitest.New(t)
+
+	var req = s.NewAuthedRequest("alex", http.MethodPost, "/v1/account/coins/transfer", map[string]any{"to": "maria", "amount": 250})
+	var transfer = apitest.Decode[api.TransferResponse](t, s.Do(req), http.StatusOK)
+	if transfer.Balance != 750 || transfer.TransferID == "" {
+		t.Errorf("transfer = %+v, want a balance of 750 and an ID", transfer)
+	}
+
+	coins, err := s.Database.GetUserCoins(context.Background(), "maria")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if coins.Coins != 2750 {
+		t.Errorf("balance of maria = %d, want 2750", coins.Coins)
+	}
+}
+
+func TestTransferErrors(t *testing.T) {
+	var s = apitest.New(t)
+
+	for _, tt := range []struct {
+		name   string
+		body   map[string]any
+		status int
+		code   string
+	}{
+		{"unknown recipient", map[string]any{"to": "nobody", "amount": 1}, http.StatusNotFound, api.CodeUserNotFound},
+		{"insufficient funds", map[string]any{"to": "maria", "amount": 1001}, http.StatusConflict, api.CodeInsufficientFunds},
+		{"self transfer", map[string]any{"to": "alex", "amount": 1}, http.StatusBadRequest, api.CodeInvalidRequest},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var req = s.NewAuthedRequest("alex", http.MethodPost, "/v1/account/coins/transfer", tt.body)
+			apitest.DecodeError(t, s.Do(req), tt.status, tt.code)
+		})
+	}
+}
+
+func TestTransferFromDeletedSender(t *testing.T) {
+	// Authenticated as the admin whatever happens to its account.
+	var s = apitest.New(t, apitest.WithHandlerOptions(handlers.WithAuthDisabled()))
+	if err := s.Database.DeleteUser(context.Background(), handlers.DisabledAuthUser.Username); err != nil {
+		t.Fatal(err)
+	}
+
+	var req = s.NewRequest(http.MethodPost, "/v1/account/coins/transfer", map[string]any{"to": "maria", "amount": 1})
+	var apiErr = apitest.DecodeError(t, s.Do(req), http.StatusUnauthorized, api.CodeInvalidToken)
+	if apiErr.Message != handlers.SenderNotFoundError.Error() {
+		t.Errorf("message = %q, want %q", apiErr.Message, handlers.SenderNotFoundError)
+	}
+}
+
+func TestTransferStatusCodeInBody(t *testing.T) {
+	for _, inBody := range []bool{true, false} {
+		t.Run(fmt.Sprintf("status_code_in_body %v", inBody), func(t *testing.T) {
+			var s = apitest.New(t, apitest.WithConfig(func(cfg *config.Config) { cfg.API.StatusCodeInBody = inBody }))
+
+			var req = s.NewAuthedRequest("alex", http.MethodPost, "/v1/account/coins/transfer", map[string]any{"to": "maria", "amount": 1})
+			var body = apitest.Decode[map[string]any](t, s.Do(req), http.StatusOK)
+			if _, ok := body["StatusCode"]; ok != inBody {
+				t.Errorf("body = %v, want a StatusCode %v", body, inBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/logging"
+	"github.com/RashedMaaitah/goapi/internal/middleware"
+	"github.com/RashedMaaitah/goapi/internal/tools"
+)
+
+const maxDisplayNameLength = 64
+
+// UpdateProfile applies a partial update: fields missing from the body are
+// left alone and an explicit null clears a field.
+func UpdateProfile(database tools.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var logger = logging.FromContext(r.Context())
+		var body = map[string]json.RawMessage{}
+		var err error
+
+		err = api.ReadJSON(w, r, &body)
+
+		if err != nil {
+			logger.Error(err)
+			api.BodyErrorHandler(w, err)
+			return
+		}
+
+		update, err := decodeUserUpdate(body)
+
+		if err != nil {
+			logger.Error(err)
+			api.RequestErrorHandler(w, err)
+			return
+		}
+
+		var username string = middleware.GetLoginDetails(r.Context()).Username
+
+		var loginDetails *tools.LoginDetails
+		loginDetails, err = database.UpdateUser(r.Context(), username, update)
+
+		if err != nil {
+			logger.Error(err)
+			api.InternalErrorHandler(w)
+			return
+		}
+
+		var coinDetails *tools.CoinDetails
+		coinDetails, err = database.GetUserCoins(r.Context(), username)
+
+		if errors.Is(err, tools.ErrUserNotFound) {
+			logger.Errorf("No coins found for %s", username)
+			api.UnauthorizedErrorHandler(w, api.CodeInvalidToken, middleware.UnAuthorizedError)
+			return
+		}
+		if err != nil {
+			api.WriteErr(w, fmt.Errorf("Profile of %s: %w", username, err))
+			return
+		}
+
+		logger.Infof("Updated profile of %s", username)
+
+		var response api.ProfileResponse = profileResponse(loginDetails, coinDetails)
+
+		api.WriteJSON(w, http.StatusOK, response, nil)
+	}
+}
+
+// decodeUserUpdate matches keys case-insensitively, like encoding/json does
+// for the other request bodies.
+func decodeUserUpdate(body map[string]json.RawMessage) (tools.UserUpdate, error) {
+	var update = tools.UserUpdate{}
+	var unknown []string
+
+	for key, raw := range body {
+		var field **string
+		switch {
+		case strings.EqualFold(key, "displayName"):
+			field = &update.DisplayName
+		case strings.EqualFold(key, "email"):
+			field = &update.Email
+		default:
+			unknown = append(unknown, key)
+			continue
+		}
+
+		var value *string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return update, fmt.Errorf("Invalid value for %s: must be a string or null.", key)
+		}
+		if value == nil {
+			value = new(string)
+		}
+		*field = value
+	}
+
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return update, fmt.Errorf("Unknown fields: %s.", strings.Join(unknown, ", "))
+	}
+
+	if update.DisplayName != nil && utf8.RuneCountInString(*update.DisplayName) > maxDisplayNameLength {
+		return update, fmt.Errorf("Display name must be at most %d characters.", maxDisplayNameLength)
+	}
+
+	if update.Email != nil && *update.Email != "" {
+		address, err := mail.ParseAddress(*update.Email)
+		if err != nil || address.Address != *update.Email {
+			return update, fmt.Errorf("Invalid email address %q.", *update.Email)
+		}
+	}
+
+	return update, nil
+}
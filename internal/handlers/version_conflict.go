@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/RashedMaaitah/goapi/internal/tools"
+)
+
+// maxVersionAttempts bounds how often an update that lost a race with
+// another write is read and tried again.
+const maxVersionAttempts = 3
+
+// retryOnConflict calls update until it succeeds, fails with another error
+// or has failed with tools.ErrVersionConflict maxVersionAttempts times.
+func retryOnConflict(update func() error) error {
+	var err error
+	for range maxVersionAttempts {
+		err = update()
+		if !errors.Is(err, tools.ErrVersionConflict) {
+			return err
+		}
+	}
+	return err
+}
@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/logging"
+	"github.com/RashedMaaitah/goapi/internal/webhooks"
+	"github.com/go-chi/chi"
+)
+
+var WebhookNotFoundError = errors.New("Webhook not found.")
+
+var InvalidWebhookURLError = errors.New("URL must be an absolute http or https URL.")
+
+var DeliveryNotFoundError = errors.New("Delivery not found.")
+
+var NotReplayableError = errors.New("Only a failed delivery can be replayed.")
+
+// RegisterWebhook adds a webhook. The response is the only one that
+// includes the secret.
+func RegisterWebhook(hooks *webhooks.Dispatcher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var logger = logging.FromContext(r.Context())
+		var params = api.WebhookParams{}
+		var err error
+
+		err = api.ReadJSON(w, r, &params)
+
+		if err != nil {
+			logger.Error(err)
+			api.BodyErrorHandler(w, err)
+			return
+		}
+
+		var webhook *webhooks.Webhook
+		webhook, err = hooks.Register(params.URL, params.Secret)
+
+		if errors.Is(err, webhooks.ErrInvalidURL) {
+			api.RequestErrorHandler(w, InvalidWebhookURLError)
+			return
+		}
+
+		if err != nil {
+			logger.Error(err)
+			api.InternalErrorHandler(w)
+			return
+		}
+
+		logger.Infof("Registered webhook %s for %s", webhook.ID, webhook.URL)
+
+		var response = api.WebhookResponse{
+			StatusCode: http.StatusCreated,
+			Webhook:    webhookResponse(*webhook),
+		}
+		response.Webhook.Secret = webhook.Secret
+
+		api.WriteJSON(w, http.StatusCreated, response, nil)
+	}
+}
+
+func ListWebhooks(hooks *webhooks.Dispatcher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var response = api.WebhookListResponse{
+			StatusCode: http.StatusOK,
+			Webhooks:   []api.Webhook{},
+		}
+		for _, webhook := range hooks.List() {
+			response.Webhooks = append(response.Webhooks, webhookResponse(webhook))
+		}
+
+		api.WriteJSON(w, http.StatusOK, response, nil)
+	}
+}
+
+func DeleteWebhook(hooks *webhooks.Dispatcher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var logger = logging.FromContext(r.Context())
+		var id string = chi.URLParam(r, "id")
+
+		if err := hooks.Delete(id); errors.Is(err, webhooks.ErrNotFound) {
+			api.NotFoundErrorHandler(w, api.CodeWebhookNotFound, WebhookNotFoundError)
+			return
+		}
+
+		logger.Infof("Deleted webhook %s", id)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// ListWebhookDeliveries returns the latest deliveries of a webhook, newest
+// first, with every attempt, of a status if one is given.
+func ListWebhookDeliveries(hooks *webhooks.Dispatcher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var params = api.WebhookDeliveryListParams{}
+		var err error
+
+		if violations := api.ReadQuery(r, &params); len(violations) > 0 {
+			api.ValidationErrorHandler(w, violations)
+			return
+		}
+
+		var deliveries []webhooks.Delivery
+		deliveries, err = hooks.Deliveries(chi.URLParam(r, "id"), params.Status)
+
+		if errors.Is(err, webhooks.ErrNotFound) {
+			api.NotFoundErrorHandler(w, api.CodeWebhookNotFound, WebhookNotFoundError)
+			return
+		}
+
+		var response = api.WebhookDeliveriesResponse{
+			StatusCode: http.StatusOK,
+			Deliveries: make([]api.WebhookDelivery, 0, len(deliveries)),
+		}
+		for _, delivery := range deliveries {
+			response.Deliveries = append(response.Deliveries, deliveryResponse(delivery))
+		}
+
+		api.WriteJSON(w, http.StatusOK, response, nil)
+	}
+}
+
+// ReplayWebhookDelivery queues the event of a failed delivery again, with
+// the same event ID, and answers with the new delivery.
+func ReplayWebhookDelivery(hooks *webhooks.Dispatcher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var logger = logging.FromContext(r.Context())
+		var id string = chi.URLParam(r, "id")
+		var deliveryID string = chi.URLParam(r, "deliveryID")
+
+		delivery, err := hooks.Replay(id, deliveryID)
+
+		switch {
+		case errors.Is(err, webhooks.ErrNotFound):
+			api.NotFoundErrorHandler(w, api.CodeWebhookNotFound, WebhookNotFoundError)
+			return
+		case errors.Is(err, webhooks.ErrDeliveryNotFound):
+			api.NotFoundErrorHandler(w, api.CodeDeliveryNotFound, DeliveryNotFoundError)
+			return
+		case errors.Is(err, webhooks.ErrNotReplayable):
+			api.ConflictErrorHandler(w, api.CodeNotReplayable, NotReplayableError)
+			return
+		case errors.Is(err, webhooks.ErrQueueFull), errors.Is(err, webhooks.ErrClosed):
+			logger.Warnf("Can't replay delivery %s of webhook %s: %v", deliveryID, id, err)
+			api.OverloadedErrorHandler(w)
+			return
+		case err != nil:
+			logger.Error(err)
+			api.InternalErrorHandler(w)
+			return
+		}
+
+		logger.Infof("Replaying %s event %s of webhook %s as delivery %s", delivery.EventType, delivery.EventID, id, delivery.ID)
+
+		var response = api.WebhookDeliveryResponse{
+			StatusCode: http.StatusAccepted,
+			Delivery:   deliveryResponse(*delivery),
+		}
+
+		api.WriteJSON(w, http.StatusAccepted, response, nil)
+	}
+}
+
+func deliveryResponse(delivery webhooks.Delivery) api.WebhookDelivery {
+	var entry = api.WebhookDelivery{
+		ID:         delivery.ID,
+		EventID:    delivery.EventID,
+		EventType:  delivery.EventType,
+		URL:        delivery.URL,
+		Status:     delivery.Status(),
+		Attempts:   delivery.Attempts,
+		StatusCode: delivery.StatusCode,
+		Error:      delivery.Error,
+		Delivered:  delivery.Delivered,
+		ReplayOf:   delivery.ReplayOf,
+		History:    make([]api.WebhookAttempt, 0, len(delivery.History)),
+		CreatedAt:  delivery.CreatedAt,
+	}
+	if !delivery.CompletedAt.IsZero() {
+		entry.CompletedAt = &delivery.CompletedAt
+	}
+	for _, attempt := range delivery.History {
+		entry.History = append(entry.History, api.WebhookAttempt{
+			Attempt:             attempt.Number,
+			StatusCode:          attempt.StatusCode,
+			LatencyMilliseconds: attempt.Latency.Milliseconds(),
+			Error:               attempt.Error,
+			Response:            attempt.Response,
+			At:                  attempt.At,
+		})
+	}
+	return entry
+}
+
+func webhookResponse(webhook webhooks.Webhook) api.Webhook {
+	return api.Webhook{
+		ID:        webhook.ID,
+		URL:       webhook.URL,
+		CreatedAt: webhook.CreatedAt,
+	}
+}
@@ -0,0 +1,124 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/internal/config"
+	"github.com/RashedMaaitah/goapi/internal/events"
+	"github.com/RashedMaaitah/goapi/internal/tools"
+	log "github.com/sirupsen/logrus"
+)
+
+// AccrualActor is the actor of the adjustments the accrual job records.
+const AccrualActor = "accrual"
+
+// accrualPage is how many users the accrual job lists at a time.
+const accrualPage = 100
+
+// accrualAttempts bounds the retries of a credit racing another change to
+// the same balance.
+const accrualAttempts = 3
+
+// Accrual returns the job crediting every user account, but frozen ones,
+// as cfg says. The credits are admin adjustments by AccrualActor, so they
+// show in the transaction history and the ledger, and are published on bus.
+// A failed credit is logged and the others go on; the job fails if any did.
+func Accrual(cfg config.AccrualConfig, database tools.Database, bus *events.Bus, logger *log.Logger) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		var reason string = "Daily accrual of " + time.Now().UTC().Format(time.DateOnly)
+		var credited, failed int
+		var total int64
+
+		for offset := 0; ; offset += accrualPage {
+			users, err := database.SearchUsers(ctx, tools.UserFilter{
+				Role:   tools.RoleUser,
+				SortBy: tools.SortByUsername,
+				Offset: offset,
+				Limit:  accrualPage,
+			})
+			if err != nil {
+				return fmt.Errorf("listing users: %w", err)
+			}
+
+			for _, user := range users {
+				if err = ctx.Err(); err != nil {
+					return fmt.Errorf("credited %d accounts: %w", credited, err)
+				}
+
+				amount, err := accrue(ctx, cfg, database, bus, user.Username, reason)
+				switch {
+				case err != nil:
+					failed++
+					logger.Errorf("Accrual to %s: %v", user.Username, err)
+				case amount > 0:
+					credited++
+					total += amount
+				}
+			}
+
+			if len(users) < accrualPage {
+				break
+			}
+		}
+
+		logger.Infof("Accrual credited %d coins to %d accounts", total, credited)
+		if failed > 0 {
+			return fmt.Errorf("the accrual to %d accounts failed", failed)
+		}
+		return nil
+	}
+}
+
+// accrue credits the account of username, and returns the amount, 0 when
+// there was nothing to credit.
+func accrue(ctx context.Context, cfg config.AccrualConfig, database tools.Database, bus *events.Bus, username string, reason string) (int64, error) {
+	var err error
+	for range accrualAttempts {
+		var coinDetails *tools.CoinDetails
+		coinDetails, err = database.GetUserCoins(ctx, username)
+		if err != nil {
+			return 0, err
+		}
+		if coinDetails.Frozen {
+			return 0, nil
+		}
+
+		var amount int64 = cfg.Amount
+		if cfg.Percent > 0 {
+			if coinDetails.Coins <= 0 {
+				return 0, nil
+			}
+			amount = int64(math.Floor(float64(coinDetails.Coins) * cfg.Percent / 100))
+		}
+		if amount <= 0 {
+			return 0, nil
+		}
+
+		coinDetails, err = database.AdminAdjustCoins(ctx, username, tools.AdminAdjustment{
+			Delta:   amount,
+			Actor:   AccrualActor,
+			Reason:  reason,
+			Version: coinDetails.Version,
+		})
+		if errors.Is(err, tools.ErrVersionConflict) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		bus.Publish(events.Event{
+			Type:     tools.TransactionAdmin,
+			Username: username,
+			Currency: tools.DefaultCurrency,
+			Amount:   amount,
+			Balance:  coinDetails.Coins,
+		})
+		return amount, nil
+	}
+	return 0, err
+}
@@ -0,0 +1,174 @@
+package jobs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is when a job runs, parsed from a cron expression of five
+// fields: minute, hour, day of month, month and day of week (0 or 7 is
+// Sunday), in UTC. A field is *, a number, a range a-b, any of these with
+// a step /n, or a comma separated list of them. As in cron, a day matches
+// either day field when both are restricted.
+type Schedule struct {
+	minute, hour, dom, month, dow bits
+
+	// anyDom and anyDow are set for day fields starting with *.
+	anyDom, anyDow bool
+}
+
+// bits has bit i set when value i matches.
+type bits uint64
+
+func (b bits) has(i int) bool {
+	return b&(1<<uint(i)) != 0
+}
+
+// descriptors are the shorthands ParseSchedule accepts for whole
+// expressions.
+var descriptors = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+}
+
+// ParseSchedule parses a cron expression, or one of @hourly, @daily,
+// @midnight, @weekly and @monthly.
+func ParseSchedule(expr string) (*Schedule, error) {
+	var spec string = strings.TrimSpace(expr)
+	if d, ok := descriptors[spec]; ok {
+		spec = d
+	}
+
+	var fields []string = strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("schedule %q: want 5 fields, minute hour day month weekday, got %d", expr, len(fields))
+	}
+
+	var s = &Schedule{}
+	var err error
+	var parsed = []struct {
+		name     string
+		min, max int
+		bits     *bits
+	}{
+		{"minute", 0, 59, &s.minute},
+		{"hour", 0, 23, &s.hour},
+		{"day of month", 1, 31, &s.dom},
+		{"month", 1, 12, &s.month},
+		{"day of week", 0, 7, &s.dow},
+	}
+	for i, p := range parsed {
+		*p.bits, err = parseField(fields[i], p.min, p.max)
+		if err != nil {
+			return nil, fmt.Errorf("schedule %q: %s: %w", expr, p.name, err)
+		}
+	}
+	if s.dow.has(7) {
+		s.dow |= 1
+	}
+	s.anyDom = strings.HasPrefix(fields[2], "*")
+	s.anyDow = strings.HasPrefix(fields[4], "*")
+
+	if s.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("schedule %q never runs", expr)
+	}
+	return s, nil
+}
+
+func parseField(field string, min, max int) (bits, error) {
+	var b bits
+	for _, part := range strings.Split(field, ",") {
+		var rng, step string = part, ""
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			rng, step = part[:i], part[i+1:]
+		}
+
+		var lo, hi int = min, max
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			from, to, _ := strings.Cut(rng, "-")
+			var err error
+			if lo, err = parseValue(from, min, max); err != nil {
+				return 0, err
+			}
+			if hi, err = parseValue(to, min, max); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("range %q is backwards", rng)
+			}
+		default:
+			var err error
+			if lo, err = parseValue(rng, min, max); err != nil {
+				return 0, err
+			}
+			// A single value with a step runs from it to the end, like a-max.
+			hi = lo
+			if step != "" {
+				hi = max
+			}
+		}
+
+		var every int = 1
+		if step != "" {
+			var err error
+			every, err = strconv.Atoi(step)
+			if err != nil || every < 1 {
+				return 0, fmt.Errorf("step %q is not a positive number", step)
+			}
+		}
+
+		for i := lo; i <= hi; i += every {
+			b |= 1 << uint(i)
+		}
+	}
+	return b, nil
+}
+
+func parseValue(s string, min, max int) (int, error) {
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a number", s)
+	}
+	if v < min || v > max {
+		return 0, fmt.Errorf("%d is not between %d and %d", v, min, max)
+	}
+	return v, nil
+}
+
+// Next returns the first time after t the schedule runs, or the zero time
+// if it doesn't within five years, as for February 30.
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.UTC().Truncate(time.Minute).Add(time.Minute)
+	var limit time.Time = t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		switch {
+		case !s.month.has(int(t.Month())):
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		case !s.day(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+		case !s.hour.has(t.Hour()):
+			t = t.Truncate(time.Hour).Add(time.Hour)
+		case !s.minute.has(t.Minute()):
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (s *Schedule) day(t time.Time) bool {
+	var dom, dow bool = s.dom.has(t.Day()), s.dow.has(int(t.Weekday()))
+	if s.anyDom || s.anyDow {
+		return dom && dow
+	}
+	return dom || dow
+}
@@ -0,0 +1,76 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleNext(t *testing.T) {
+	// A Thursday.
+	var from = time.Date(2026, 1, 1, 10, 7, 30, 0, time.UTC)
+
+	for _, tt := range []struct {
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{"* * * * *", from, time.Date(2026, 1, 1, 10, 8, 0, 0, time.UTC)},
+		{"*/15 * * * *", from, time.Date(2026, 1, 1, 10, 15, 0, 0, time.UTC)},
+		{"5/20 * * * *", from, time.Date(2026, 1, 1, 10, 25, 0, 0, time.UTC)},
+		{"10-12,30 * * * *", from, time.Date(2026, 1, 1, 10, 10, 0, 0, time.UTC)},
+		{"0 9-17/4 * * *", from, time.Date(2026, 1, 1, 13, 0, 0, 0, time.UTC)},
+		{"30 23 31 12 *", from, time.Date(2026, 12, 31, 23, 30, 0, 0, time.UTC)},
+		{"0 0 29 2 *", from, time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", from, time.Date(2026, 1, 1, 11, 0, 0, 0, time.UTC)},
+		{"@monthly", from, time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 1-5", from, time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)},
+
+		// 7 is Sunday, as 0 is.
+		{"@weekly", from, time.Date(2026, 1, 4, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", from, time.Date(2026, 1, 4, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 5-7", time.Date(2026, 1, 3, 1, 0, 0, 0, time.UTC), time.Date(2026, 1, 4, 0, 0, 0, 0, time.UTC)},
+
+		// Both day fields restricted, either matches: Friday the 2nd, then
+		// the 13th, a Tuesday, before the Sunday after.
+		{"0 0 13 * 5", from, time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{"0 0 13 * 0", time.Date(2026, 1, 12, 0, 0, 0, 0, time.UTC), time.Date(2026, 1, 13, 0, 0, 0, 0, time.UTC)},
+		// With one of them *, both must: an odd day that is a Monday.
+		{"0 0 */2 * 1", from, time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 1", from, time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC)},
+	} {
+		t.Run(tt.expr, func(t *testing.T) {
+			s, err := ParseSchedule(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if next := s.Next(tt.from); !next.Equal(tt.want) {
+				t.Errorf("Next(%s) = %s, want %s", tt.from.Format(time.RFC3339), next.Format(time.RFC3339), tt.want.Format(time.RFC3339))
+			}
+		})
+	}
+}
+
+func TestParseScheduleInvalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"@yearly",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"a * * * *",
+		"1-a * * * *",
+		// February 30 never comes.
+		"0 0 30 2 *",
+	} {
+		if _, err := ParseSchedule(expr); err == nil {
+			t.Errorf("ParseSchedule(%q) succeeded, want an error", expr)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+// Package jobs runs background jobs in process, on cron schedules or once
+// on demand.
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/internal/metrics"
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrUnknownJob is returned by Run for a job that was never added.
+var ErrUnknownJob = errors.New("unknown job")
+
+// ErrRunning is returned by Run for a job that is still running; runs of a
+// job never overlap.
+var ErrRunning = errors.New("job is already running")
+
+// Job is a task of the Scheduler. It runs on Schedule, or only when Run
+// asks for it when Schedule is nil, for up to Timeout when that is set.
+type Job struct {
+	Name     string
+	Schedule *Schedule
+	Timeout  time.Duration
+	Run      func(ctx context.Context) error
+}
+
+// Scheduler runs its jobs each in its own goroutine, recovering from their
+// panics.
+type Scheduler struct {
+	logger  *log.Logger
+	metrics *metrics.Metrics
+	jobs    map[string]*entry
+
+	// stop ends the schedules, cancel cancels the runs in flight.
+	stop     chan struct{}
+	stopOnce sync.Once
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+type entry struct {
+	Job
+	running atomic.Bool
+}
+
+func New(logger *log.Logger, m *metrics.Metrics) *Scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Scheduler{
+		logger:  logger,
+		metrics: m,
+		jobs:    map[string]*entry{},
+		stop:    make(chan struct{}),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// Add adds job, replacing any of the same name. Jobs added after Start are
+// not scheduled.
+func (s *Scheduler) Add(job Job) {
+	s.jobs[job.Name] = &entry{Job: job}
+}
+
+// Names returns the names of the jobs added, sorted.
+func (s *Scheduler) Names() []string {
+	var names = make([]string, 0, len(s.jobs))
+	for name := range s.jobs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Start runs every scheduled job on its schedule until Close.
+func (s *Scheduler) Start() {
+	for _, e := range s.jobs {
+		if e.Schedule == nil {
+			continue
+		}
+		s.wg.Add(1)
+		go s.loop(e)
+	}
+}
+
+func (s *Scheduler) loop(e *entry) {
+	defer s.wg.Done()
+
+	for {
+		var next time.Time = e.Schedule.Next(time.Now())
+		if next.IsZero() {
+			s.logger.Errorf("Job %s has no run left on its schedule", e.Name)
+			return
+		}
+		s.logger.Debugf("Job %s runs next at %s", e.Name, next.Format(time.RFC3339))
+
+		var timer *time.Timer = time.NewTimer(time.Until(next))
+		select {
+		case <-s.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		// In the background, so a run outlasting the schedule skips the
+		// next one instead of delaying it.
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.run(s.ctx, e)
+		}()
+	}
+}
+
+// Run runs the job name once, now, and returns its error. It is canceled
+// with ctx, or by Close.
+func (s *Scheduler) Run(ctx context.Context, name string) error {
+	e, ok := s.jobs[name]
+	if !ok {
+		return fmt.Errorf("%w %q, the jobs are %s", ErrUnknownJob, name, strings.Join(s.Names(), ", "))
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var stop func() bool = context.AfterFunc(s.ctx, cancel)
+	defer stop()
+
+	return s.run(ctx, e)
+}
+
+func (s *Scheduler) run(ctx context.Context, e *entry) error {
+	if !e.running.CompareAndSwap(false, true) {
+		s.logger.Warnf("Job %s is still running, skipping this run", e.Name)
+		s.metrics.JobRuns.Inc(e.Name, "skipped")
+		return ErrRunning
+	}
+	defer e.running.Store(false)
+
+	if e.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.Timeout)
+		defer cancel()
+	}
+
+	s.logger.Infof("Running job %s", e.Name)
+	var start time.Time = time.Now()
+	var err error = call(ctx, e.Run)
+	var elapsed time.Duration = time.Since(start)
+
+	var result string
+	var panicked *panicError
+	switch {
+	case errors.As(err, &panicked):
+		result = "panic"
+		s.logger.Errorf("Job %s panicked after %s: %v", e.Name, elapsed.Round(time.Millisecond), err)
+	case errors.Is(err, context.DeadlineExceeded) && ctx.Err() != nil:
+		result = "timeout"
+		s.logger.Errorf("Job %s timed out after %s: %v", e.Name, elapsed.Round(time.Millisecond), err)
+	case err != nil:
+		result = "error"
+		s.logger.Errorf("Job %s failed after %s: %v", e.Name, elapsed.Round(time.Millisecond), err)
+	default:
+		result = "ok"
+		s.logger.Infof("Job %s done in %s", e.Name, elapsed.Round(time.Millisecond))
+	}
+
+	s.metrics.JobRuns.Inc(e.Name, result)
+	s.metrics.JobDuration.Observe(elapsed.Seconds(), e.Name)
+	s.metrics.JobLastRun.Set(float64(time.Now().UnixNano())/1e9, e.Name, result)
+	return err
+}
+
+// panicError is the panic of a job, with the stack it happened on.
+type panicError struct {
+	value any
+	stack []byte
+}
+
+func (e *panicError) Error() string {
+	return fmt.Sprintf("%v\n%s", e.value, e.stack)
+}
+
+// call returns the error of run, or a *panicError.
+func call(ctx context.Context, run func(ctx context.Context) error) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = &panicError{value: p, stack: debug.Stack()}
+		}
+	}()
+	return run(ctx)
+}
+
+// Close stops the schedules and waits for the runs in flight until ctx is
+// done, then cancels them.
+func (s *Scheduler) Close(ctx context.Context) error {
+	s.stopOnce.Do(func() { close(s.stop) })
+
+	var done = make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		s.cancel()
+		return nil
+	case <-ctx.Done():
+		s.cancel()
+		<-done
+		return fmt.Errorf("canceled the jobs still running: %w", ctx.Err())
+	}
+}
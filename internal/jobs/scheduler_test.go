@@ -0,0 +1,142 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/internal/metrics"
+	log "github.com/sirupsen/logrus"
+)
+
+// newScheduler returns a Scheduler of job, closed at the end of the test,
+// and the exporter of its metrics.
+func newScheduler(t *testing.T, job Job) (*Scheduler, *metrics.Expvar) {
+	var logger = log.New()
+	logger.SetOutput(io.Discard)
+	var exporter = metrics.NewExpvar()
+
+	var s = New(logger, metrics.New(exporter))
+	s.Add(job)
+	t.Cleanup(func() { s.Close(context.Background()) })
+	return s, exporter
+}
+
+// runs returns the runs of the job test by result.
+func runs(t *testing.T, e *metrics.Expvar) map[string]float64 {
+	t.Helper()
+	var rec = httptest.NewRecorder()
+	e.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	var vars map[string]json.RawMessage
+	if err := json.Unmarshal(rec.Body.Bytes(), &vars); err != nil {
+		t.Fatal(err)
+	}
+	var series = map[string]float64{}
+	json.Unmarshal(vars["goapi_jobs_runs_total"], &series)
+
+	var byResult = map[string]float64{}
+	for labels, n := range series {
+		if result, ok := strings.CutPrefix(labels, "job=test,result="); ok {
+			byResult[result] = n
+		}
+	}
+	return byResult
+}
+
+func TestRunSkipsOverlap(t *testing.T) {
+	var started, release = make(chan struct{}), make(chan struct{})
+	var s, exporter = newScheduler(t, Job{Name: "test", Run: func(ctx context.Context) error {
+		close(started)
+		<-release
+		return nil
+	}})
+
+	var first = make(chan error, 1)
+	go func() { first <- s.Run(context.Background(), "test") }()
+	<-started
+
+	if err := s.Run(context.Background(), "test"); !errors.Is(err, ErrRunning) {
+		t.Errorf("overlapping Run = %v, want ErrRunning", err)
+	}
+	close(release)
+	if err := <-first; err != nil {
+		t.Errorf("first Run = %v, want nil", err)
+	}
+	if got := runs(t, exporter); got["ok"] != 1 || got["skipped"] != 1 {
+		t.Errorf("runs = %v, want 1 ok and 1 skipped", got)
+	}
+}
+
+func TestRunRecoversPanic(t *testing.T) {
+	var panics = true
+	var s, exporter = newScheduler(t, Job{Name: "test", Run: func(ctx context.Context) error {
+		if panics {
+			panic("boom")
+		}
+		return nil
+	}})
+
+	var err error = s.Run(context.Background(), "test")
+	var panicked *panicError
+	if !errors.As(err, &panicked) || panicked.value != "boom" || len(panicked.stack) == 0 {
+		t.Fatalf("Run = %v, want the panic boom with its stack", err)
+	}
+
+	// A panic doesn't leave the job running.
+	panics = false
+	if err := s.Run(context.Background(), "test"); err != nil {
+		t.Errorf("Run after the panic = %v, want nil", err)
+	}
+	if got := runs(t, exporter); got["panic"] != 1 || got["ok"] != 1 {
+		t.Errorf("runs = %v, want 1 panic and 1 ok", got)
+	}
+}
+
+func TestRunTimeout(t *testing.T) {
+	var s, exporter = newScheduler(t, Job{Name: "test", Timeout: 10 * time.Millisecond, Run: func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}})
+
+	var start time.Time = time.Now()
+	if err := s.Run(context.Background(), "test"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Run = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Run took %s, want about the 10ms timeout", elapsed)
+	}
+	if got := runs(t, exporter); got["timeout"] != 1 {
+		t.Errorf("runs = %v, want 1 timeout", got)
+	}
+}
+
+// The deadline of the caller isn't the timeout of the job.
+func TestRunCanceled(t *testing.T) {
+	var s, exporter = newScheduler(t, Job{Name: "test", Run: func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	if err := s.Run(ctx, "test"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Run = %v, want context.Canceled", err)
+	}
+	if got := runs(t, exporter); got["error"] != 1 {
+		t.Errorf("runs = %v, want 1 error", got)
+	}
+}
+
+func TestRunUnknownJob(t *testing.T) {
+	var s, _ = newScheduler(t, Job{Name: "test", Run: func(ctx context.Context) error { return nil }})
+
+	if err := s.Run(context.Background(), "other"); !errors.Is(err, ErrUnknownJob) {
+		t.Errorf("Run = %v, want ErrUnknownJob", err)
+	}
+}
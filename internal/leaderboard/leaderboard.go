@@ -0,0 +1,168 @@
+// Package leaderboard ranks the users by balance in the background, so
+// that reading the leaderboard never waits for the database.
+package leaderboard
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/internal/metrics"
+	"github.com/RashedMaaitah/goapi/internal/tools"
+	log "github.com/sirupsen/logrus"
+)
+
+// Ranking is a computed leaderboard: the richest users by descending
+// balance, ties by username.
+type Ranking struct {
+	Users []tools.CoinDetails
+
+	// Version identifies the users and their balances.
+	Version string
+	// Modified is when the ranking last changed, Refreshed when it was
+	// last computed.
+	Modified  time.Time
+	Refreshed time.Time
+}
+
+// Board keeps the ranking of the top size users, computed every interval
+// and whenever Refresh is called. Refreshes never overlap. A refresh that
+// fails keeps the previous ranking, which Stale reports until one
+// succeeds. A nil *Board ranks nothing.
+type Board struct {
+	database tools.Database
+	size     int
+	logger   *log.Logger
+	metrics  *metrics.Metrics
+
+	// mu serializes the refreshes.
+	mu      sync.Mutex
+	ranking atomic.Pointer[Ranking]
+	stale   atomic.Bool
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Start computes the ranking of the top size users every interval until
+// the board is closed, the first one at once, or returns nil for an
+// interval of 0.
+func Start(database tools.Database, interval time.Duration, size int, logger *log.Logger, m *metrics.Metrics) *Board {
+	if interval <= 0 {
+		return nil
+	}
+
+	var ctx, cancel = context.WithCancel(context.Background())
+	var b = &Board{
+		database: database,
+		size:     size,
+		logger:   logger,
+		metrics:  m,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+	go b.run(ctx, interval)
+	return b
+}
+
+func (b *Board) run(ctx context.Context, interval time.Duration) {
+	defer close(b.done)
+
+	var ticker = time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := b.Refresh(ctx); err != nil && ctx.Err() == nil {
+			b.logger.Errorf("Refreshing the leaderboard: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh computes the ranking now, after the refresh in progress if
+// there is one, and returns it.
+func (b *Board) Refresh(ctx context.Context) (*Ranking, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	users, err := b.database.GetTopUsers(ctx, 0, b.size)
+	var now = time.Now()
+	if err != nil && ctx.Err() != nil {
+		// Given up on, which says nothing of the database.
+		return nil, err
+	}
+	if err != nil {
+		b.stale.Store(true)
+		b.metrics.LeaderboardRefreshes.Inc("error")
+		b.observeAge(now)
+		return nil, err
+	}
+
+	var ranking = &Ranking{Users: users, Version: version(users), Modified: now, Refreshed: now}
+	if previous := b.ranking.Load(); previous != nil && previous.Version == ranking.Version {
+		ranking.Modified = previous.Modified
+	}
+	b.ranking.Store(ranking)
+	b.stale.Store(false)
+	b.metrics.LeaderboardRefreshes.Inc("ok")
+	b.observeAge(now)
+	return ranking, nil
+}
+
+// Ranking returns the latest ranking, nil until one was computed.
+func (b *Board) Ranking() *Ranking {
+	if b == nil {
+		return nil
+	}
+	var ranking = b.ranking.Load()
+	b.observeAge(time.Now())
+	return ranking
+}
+
+// Stale reports whether the last refresh failed, so that Ranking is older
+// than the refresh interval.
+func (b *Board) Stale() bool {
+	return b != nil && b.stale.Load()
+}
+
+// Close stops the refreshes, waiting for the one in progress.
+func (b *Board) Close(ctx context.Context) error {
+	if b == nil {
+		return nil
+	}
+	b.cancel()
+	select {
+	case <-b.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// observeAge records the age of the ranking, which is exported as of the
+// last read or refresh rather than of the scrape.
+func (b *Board) observeAge(now time.Time) {
+	if ranking := b.ranking.Load(); ranking != nil {
+		b.metrics.LeaderboardAge.Set(now.Sub(ranking.Refreshed).Seconds())
+	}
+}
+
+func version(users []tools.CoinDetails) string {
+	var hash = sha256.New()
+	for _, user := range users {
+		hash.Write([]byte(user.Username))
+		hash.Write([]byte{0})
+		hash.Write(strconv.AppendInt(nil, user.Coins, 10))
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil)[:16])
+}
@@ -0,0 +1,231 @@
+// Package ledger records every coin movement as a pair of entries, a debit
+// on one account and a credit on another, so balances can be derived from
+// the entries and checked against the ones stored with the users.
+package ledger
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SystemAccount is the other side of deposits, withdrawals and admin
+// adjustments. Its balance is minus the coins in circulation.
+const SystemAccount = "system"
+
+const (
+	Debit  = "debit"
+	Credit = "credit"
+)
+
+var ErrUnbalanced = errors.New("ledger: debits and credits of a transaction differ")
+
+// Entry moves Amount (always positive) of Currency out of Account for a
+// debit or into it for a credit.
+type Entry struct {
+	TransactionID string
+	Account       string
+	Direction     string
+	Currency      string
+	Amount        int64
+	CreatedAt     time.Time
+}
+
+// Move returns the entries moving amount from one account to another; a
+// negative amount moves it the other way and zero needs no entries.
+func Move(transactionID string, from string, to string, currency string, amount int64) []Entry {
+	if amount == 0 {
+		return nil
+	}
+	if amount < 0 {
+		from, to, amount = to, from, -amount
+	}
+
+	return []Entry{
+		{TransactionID: transactionID, Account: from, Direction: Debit, Currency: currency, Amount: amount},
+		{TransactionID: transactionID, Account: to, Direction: Credit, Currency: currency, Amount: amount},
+	}
+}
+
+// Book is an in-memory, append-only ledger. It is safe for concurrent use.
+type Book struct {
+	mu      sync.RWMutex
+	entries []Entry
+	// Index into entries by transaction ID.
+	transactions map[string][]int
+}
+
+func NewBook() *Book {
+	return &Book{transactions: map[string][]int{}}
+}
+
+// LoadBook returns a Book holding entries already posted, such as those
+// Entries returned, keeping their times.
+func LoadBook(entries []Entry) *Book {
+	var b *Book = NewBook()
+	for _, entry := range entries {
+		b.transactions[entry.TransactionID] = append(b.transactions[entry.TransactionID], len(b.entries))
+		b.entries = append(b.entries, entry)
+	}
+	return b
+}
+
+// Entries returns every entry, in posting order.
+func (b *Book) Entries() []Entry {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return slices.Clone(b.entries)
+}
+
+// Post appends entries, which must balance per currency, stamping them with
+// the current time. Nothing is posted if they don't.
+func (b *Book) Post(entries ...Entry) error {
+	if err := Check(entries...); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var now = time.Now().UTC()
+	for _, entry := range entries {
+		entry.CreatedAt = now
+		b.transactions[entry.TransactionID] = append(b.transactions[entry.TransactionID], len(b.entries))
+		b.entries = append(b.entries, entry)
+	}
+	return nil
+}
+
+// Check returns why entries can't be posted: an amount that isn't
+// positive, an unknown direction, or debits and credits that differ in a
+// currency.
+func Check(entries ...Entry) error {
+	var sums = map[string]int64{}
+	for _, entry := range entries {
+		if entry.Amount <= 0 {
+			return fmt.Errorf("ledger: entry of %s has non-positive amount %d", entry.Account, entry.Amount)
+		}
+		switch entry.Direction {
+		case Debit:
+			sums[entry.Currency] -= entry.Amount
+		case Credit:
+			sums[entry.Currency] += entry.Amount
+		default:
+			return fmt.Errorf("ledger: unknown direction %q", entry.Direction)
+		}
+	}
+	for _, sum := range sums {
+		if sum != 0 {
+			return ErrUnbalanced
+		}
+	}
+	return nil
+}
+
+// Transaction returns the entries posted for id, in posting order.
+func (b *Book) Transaction(id string) []Entry {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	var entries = make([]Entry, 0, len(b.transactions[id]))
+	for _, i := range b.transactions[id] {
+		entries = append(entries, b.entries[i])
+	}
+	return entries
+}
+
+// Balances sums all entries into the balance of every account by currency.
+func (b *Book) Balances() map[string]map[string]int64 {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	var balances = map[string]map[string]int64{}
+	for _, entry := range b.entries {
+		if balances[entry.Account] == nil {
+			balances[entry.Account] = map[string]int64{}
+		}
+		if entry.Direction == Debit {
+			balances[entry.Account][entry.Currency] -= entry.Amount
+		} else {
+			balances[entry.Account][entry.Currency] += entry.Amount
+		}
+	}
+	return balances
+}
+
+// BalanceAsOf sums the entries of account posted up to t, inclusive, into
+// its balance by currency.
+func (b *Book) BalanceAsOf(account string, t time.Time) map[string]int64 {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	// Entries are posted in time order.
+	var end int = sort.Search(len(b.entries), func(i int) bool { return b.entries[i].CreatedAt.After(t) })
+	var balance = map[string]int64{}
+	for _, entry := range b.entries[:end] {
+		if entry.Account != account {
+			continue
+		}
+		if entry.Direction == Debit {
+			balance[entry.Currency] -= entry.Amount
+		} else {
+			balance[entry.Currency] += entry.Amount
+		}
+	}
+	return balance
+}
+
+// Drift is a balance stored with a user that the ledger doesn't agree with.
+type Drift struct {
+	Account  string
+	Currency string
+	Cached   int64
+	Ledger   int64
+}
+
+// Compare returns where cached, the stored balances of every user by
+// currency, differs from the ledger balances, sorted by account and
+// currency. A currency missing on one side counts as zero; SystemAccount
+// has no stored balance and is skipped.
+func Compare(cached map[string]map[string]int64, ledger map[string]map[string]int64) []Drift {
+	var drift = []Drift{}
+	var add = func(account string, currency string) {
+		if cached[account][currency] != ledger[account][currency] {
+			drift = append(drift, Drift{
+				Account:  account,
+				Currency: currency,
+				Cached:   cached[account][currency],
+				Ledger:   ledger[account][currency],
+			})
+		}
+	}
+
+	for account, balances := range cached {
+		for currency := range balances {
+			add(account, currency)
+		}
+	}
+	for account, balances := range ledger {
+		if account == SystemAccount {
+			continue
+		}
+		for currency := range balances {
+			// Already compared above.
+			if _, ok := cached[account][currency]; !ok {
+				add(account, currency)
+			}
+		}
+	}
+
+	sort.Slice(drift, func(i, j int) bool {
+		if drift[i].Account != drift[j].Account {
+			return drift[i].Account < drift[j].Account
+		}
+		return drift[i].Currency < drift[j].Currency
+	})
+	return drift
+}
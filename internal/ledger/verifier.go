@@ -0,0 +1,38 @@
+package ledger
+
+import (
+	"context"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Verify checks the stored balances against the ledger, see Compare.
+type Verify func(ctx context.Context) ([]Drift, error)
+
+// RunVerifier calls verify every interval until ctx is canceled and logs
+// every drifted balance it reports.
+func RunVerifier(ctx context.Context, interval time.Duration, verify Verify, logger *log.Logger) {
+	var ticker = time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		drift, err := verify(ctx)
+		if err != nil {
+			logger.Errorf("Ledger verification failed: %v", err)
+			continue
+		}
+		for _, d := range drift {
+			logger.Errorf("Ledger drift on %s: stored %s balance is %d, ledger says %d", d.Account, d.Currency, d.Cached, d.Ledger)
+		}
+		if len(drift) == 0 {
+			logger.Debug("Ledger verified, no drift")
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package lockout
+
+import (
+	"context"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/internal/config"
+	"github.com/RashedMaaitah/goapi/internal/logging"
+	"github.com/RashedMaaitah/goapi/internal/metrics"
+	log "github.com/sirupsen/logrus"
+)
+
+// Store keeps the Attempts of each key. MemoryStore keeps them in this
+// process; one shared by the servers, such as Redis, makes a lockout apply
+// on all of them.
+type Store interface {
+	// Get returns the attempts of key, zero ones if there are none.
+	Get(ctx context.Context, key string) (Attempts, error)
+
+	// Update replaces the attempts of key with those update returns of
+	// them, to be forgotten after the ttl it returns, and returns them. No
+	// other change of key may happen in between, or failures made at once
+	// would go uncounted.
+	Update(ctx context.Context, key string, update func(Attempts) (Attempts, time.Duration)) (Attempts, error)
+
+	Delete(ctx context.Context, key string) error
+}
+
+// Attempts are the failures of a username or IP since First, and its
+// lockouts so far, each lasting twice as long as the one before.
+type Attempts struct {
+	Failures    int       `json:"failures"`
+	First       time.Time `json:"first"`
+	Lockouts    int       `json:"lockouts"`
+	LockedUntil time.Time `json:"locked_until"`
+}
+
+// Lockout locks out usernames and IPs failing to authenticate
+// cfg.Failures times within cfg.Window. A nil Lockout never does.
+//
+// A Store failing doesn't fail the authentication: it is logged, and the
+// request goes on as if there was no lockout.
+type Lockout struct {
+	cfg     config.LockoutConfig
+	store   Store
+	metrics *metrics.Metrics
+}
+
+func New(cfg config.LockoutConfig, store Store, m *metrics.Metrics) *Lockout {
+	return &Lockout{cfg: cfg, store: store, metrics: m}
+}
+
+// UserKey and IPKey are the keys of the attempts of a username and an IP.
+func UserKey(username string) string { return "user:" + username }
+
+func IPKey(ip string) string { return "ip:" + ip }
+
+// Locked returns how long username, or ip, is still locked out for, 0 if
+// neither is. An empty username is not checked.
+func (l *Lockout) Locked(ctx context.Context, username string, ip string) time.Duration {
+	if l == nil {
+		return 0
+	}
+
+	var now time.Time = time.Now()
+	var locked time.Duration
+	for _, key := range keys(username, ip) {
+		attempts, err := l.store.Get(ctx, key)
+		if err != nil {
+			logging.FromContext(ctx).Warnf("Could not check the lockout of %s: %v", key, err)
+			continue
+		}
+		locked = max(locked, attempts.LockedUntil.Sub(now))
+	}
+	return locked
+}
+
+// Fail counts a failed authentication of username, unless empty, from ip,
+// and returns how long this locked either out for, 0 if it didn't.
+func (l *Lockout) Fail(ctx context.Context, username string, ip string) time.Duration {
+	if l == nil {
+		return 0
+	}
+
+	var now time.Time = time.Now()
+	var locked time.Duration
+	for _, key := range keys(username, ip) {
+		var failures int
+		attempts, err := l.store.Update(ctx, key, func(attempts Attempts) (Attempts, time.Duration) {
+			if now.Sub(attempts.First) >= l.cfg.Window.Duration() {
+				attempts.Failures = 0
+				attempts.First = now
+			}
+			attempts.Failures++
+
+			failures = attempts.Failures
+			if failures >= l.cfg.Failures {
+				attempts.Lockouts++
+				attempts.LockedUntil = now.Add(l.backoff(attempts.Lockouts))
+				attempts.Failures = 0
+			}
+
+			// Lockouts are remembered for a window after the last one ends.
+			return attempts, l.cfg.Window.Duration() + max(0, attempts.LockedUntil.Sub(now))
+		})
+		if err != nil {
+			logging.FromContext(ctx).Warnf("Could not count a failure of %s: %v", key, err)
+			continue
+		}
+
+		if failures >= l.cfg.Failures {
+			var d time.Duration = attempts.LockedUntil.Sub(now)
+			locked = max(locked, d)
+			l.metrics.Lockouts.Inc(kind(key, username))
+			logging.FromContext(ctx).WithFields(log.Fields{
+				"lockout":  key,
+				"username": username,
+				"ip":       ip,
+				"failures": failures,
+				"lockouts": attempts.Lockouts,
+				"until":    attempts.LockedUntil.UTC().Format(time.RFC3339),
+			}).Warnf("Locked out %s for %s after %d failed authentications", key, d, failures)
+		}
+	}
+	return locked
+}
+
+// Succeed forgets the failures of username, after it logged in. Those of
+// the IP are kept, as the client may own one user and guess at others.
+func (l *Lockout) Succeed(ctx context.Context, username string) {
+	if l == nil {
+		return
+	}
+
+	if err := l.store.Delete(ctx, UserKey(username)); err != nil {
+		logging.FromContext(ctx).Warnf("Could not reset the failures of %s: %v", username, err)
+	}
+}
+
+// Clear lifts the lockout of key and forgets its failures.
+func (l *Lockout) Clear(ctx context.Context, key string) error {
+	if l == nil {
+		return nil
+	}
+	return l.store.Delete(ctx, key)
+}
+
+// backoff is how long the nth lockout lasts.
+func (l *Lockout) backoff(n int) time.Duration {
+	var d time.Duration = l.cfg.Backoff.Duration()
+	for i := 1; i < n && d < l.cfg.MaxBackoff.Duration(); i++ {
+		d *= 2
+	}
+	return min(d, l.cfg.MaxBackoff.Duration())
+}
+
+func keys(username string, ip string) []string {
+	if username == "" {
+		return []string{IPKey(ip)}
+	}
+	return []string{UserKey(username), IPKey(ip)}
+}
+
+func kind(key string, username string) string {
+	if username != "" && key == UserKey(username) {
+		return "user"
+	}
+	return "ip"
+}
@@ -0,0 +1,146 @@
+package lockout
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/internal/config"
+	"github.com/RashedMaaitah/goapi/internal/metrics"
+)
+
+const testIP = "192.0.2.1"
+
+func newLockout(failures int, window, backoff, maxBackoff time.Duration) (*Lockout, *MemoryStore) {
+	var store = NewMemoryStore()
+	var cfg = config.LockoutConfig{
+		Failures:   failures,
+		Window:     config.Duration(window),
+		Backoff:    config.Duration(backoff),
+		MaxBackoff: config.Duration(maxBackoff),
+	}
+	return New(cfg, store, metrics.New(metrics.NewExpvar())), store
+}
+
+func TestFailLocksOut(t *testing.T) {
+	var l, _ = newLockout(3, time.Hour, time.Minute, time.Hour)
+	var ctx = context.Background()
+
+	for i := 1; i < 3; i++ {
+		if locked := l.Fail(ctx, "alex", testIP); locked != 0 {
+			t.Fatalf("failure %d locked out for %s, want not yet", i, locked)
+		}
+	}
+	if locked := l.Fail(ctx, "alex", testIP); locked != time.Minute {
+		t.Fatalf("third failure locked out for %s, want 1m", locked)
+	}
+
+	for _, tt := range []struct {
+		username string
+		ip       string
+		locked   bool
+	}{
+		{"alex", testIP, true},
+		{"alex", "192.0.2.2", true},
+		{"maria", testIP, true},
+		{"maria", "192.0.2.2", false},
+		{"", testIP, true},
+	} {
+		if locked := l.Locked(ctx, tt.username, tt.ip); (locked > 0) != tt.locked || locked > time.Minute {
+			t.Errorf("Locked(%q, %s) = %s, want locked %v for at most 1m", tt.username, tt.ip, locked, tt.locked)
+		}
+	}
+}
+
+func TestFailWindowResets(t *testing.T) {
+	var l, store = newLockout(2, 50*time.Millisecond, time.Minute, time.Hour)
+	var ctx = context.Background()
+
+	l.Fail(ctx, "alex", testIP)
+	time.Sleep(60 * time.Millisecond)
+	if locked := l.Fail(ctx, "alex", testIP); locked != 0 {
+		t.Fatalf("failure after the window locked out for %s, want the count restarted", locked)
+	}
+	if attempts, _ := store.Get(ctx, UserKey("alex")); attempts.Failures != 1 {
+		t.Errorf("failures = %d, want 1", attempts.Failures)
+	}
+	if locked := l.Fail(ctx, "alex", testIP); locked != time.Minute {
+		t.Errorf("second failure in the window locked out for %s, want 1m", locked)
+	}
+}
+
+func TestBackoffDoublesUpToMax(t *testing.T) {
+	var l, _ = newLockout(1, time.Hour, time.Minute, 5*time.Minute)
+	var ctx = context.Background()
+
+	for i, want := range []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute, 5 * time.Minute} {
+		if locked := l.Fail(ctx, "alex", testIP); locked != want {
+			t.Errorf("lockout %d lasts %s, want %s", i+1, locked, want)
+		}
+	}
+}
+
+func TestSucceedKeepsIPFailures(t *testing.T) {
+	var l, store = newLockout(2, time.Hour, time.Minute, time.Hour)
+	var ctx = context.Background()
+
+	l.Fail(ctx, "alex", testIP)
+	l.Succeed(ctx, "alex")
+
+	if attempts, _ := store.Get(ctx, UserKey("alex")); attempts != (Attempts{}) {
+		t.Errorf("attempts of alex = %+v, want none", attempts)
+	}
+	if attempts, _ := store.Get(ctx, IPKey(testIP)); attempts.Failures != 1 {
+		t.Errorf("failures of the IP = %d, want 1", attempts.Failures)
+	}
+	// The IP guessing at another user is locked out on its second failure.
+	if locked := l.Fail(ctx, "maria", testIP); locked != time.Minute {
+		t.Errorf("failure of maria locked out for %s, want 1m", locked)
+	}
+	if locked := l.Locked(ctx, "maria", "192.0.2.2"); locked != 0 {
+		t.Errorf("maria locked out for %s from another IP, want not", locked)
+	}
+}
+
+func TestClear(t *testing.T) {
+	var l, _ = newLockout(1, time.Hour, time.Minute, time.Hour)
+	var ctx = context.Background()
+	l.Fail(ctx, "alex", testIP)
+
+	if err := l.Clear(ctx, UserKey("alex")); err != nil {
+		t.Fatal(err)
+	}
+	if locked := l.Locked(ctx, "alex", "192.0.2.2"); locked != 0 {
+		t.Errorf("alex locked out for %s once cleared, want not", locked)
+	}
+	if locked := l.Locked(ctx, "alex", testIP); locked == 0 {
+		t.Error("the IP is no longer locked out, want it kept")
+	}
+
+	if err := l.Clear(ctx, IPKey(testIP)); err != nil {
+		t.Fatal(err)
+	}
+	if locked := l.Locked(ctx, "alex", testIP); locked != 0 {
+		t.Errorf("locked out for %s once both are cleared, want not", locked)
+	}
+	// A lockout cleared starts again from the first backoff.
+	if locked := l.Fail(ctx, "alex", testIP); locked != time.Minute {
+		t.Errorf("failure after clearing locked out for %s, want 1m", locked)
+	}
+}
+
+func TestNilLockout(t *testing.T) {
+	var l *Lockout
+	var ctx = context.Background()
+
+	if locked := l.Fail(ctx, "alex", testIP); locked != 0 {
+		t.Errorf("Fail = %s, want 0", locked)
+	}
+	if locked := l.Locked(ctx, "alex", testIP); locked != 0 {
+		t.Errorf("Locked = %s, want 0", locked)
+	}
+	l.Succeed(ctx, "alex")
+	if err := l.Clear(ctx, UserKey("alex")); err != nil {
+		t.Errorf("Clear = %v, want nil", err)
+	}
+}
@@ -0,0 +1,77 @@
+package lockout
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often expired entries are dropped.
+const sweepInterval = time.Minute
+
+// MemoryStore is a Store in this process, so each server counts the
+// failures it sees and forgets them on a restart.
+type MemoryStore struct {
+	mu        sync.Mutex
+	entries   map[string]memoryEntry
+	lastSweep time.Time
+}
+
+type memoryEntry struct {
+	attempts Attempts
+	expires  time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: map[string]memoryEntry{}}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key string) (Attempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[key]
+	if !ok || !time.Now().Before(entry.expires) {
+		return Attempts{}, nil
+	}
+	return entry.attempts, nil
+}
+
+func (s *MemoryStore) Update(ctx context.Context, key string, update func(Attempts) (Attempts, time.Duration)) (Attempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var now time.Time = time.Now()
+	s.sweep(now)
+
+	var attempts Attempts
+	if entry, ok := s.entries[key]; ok && now.Before(entry.expires) {
+		attempts = entry.attempts
+	}
+	attempts, ttl := update(attempts)
+	s.entries[key] = memoryEntry{attempts: attempts, expires: now.Add(ttl)}
+	return attempts, nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+	return nil
+}
+
+// sweep drops the expired entries, at most every sweepInterval. s.mu must
+// be held.
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	s.lastSweep = now
+
+	for key, entry := range s.entries {
+		if !now.Before(entry.expires) {
+			delete(s.entries, key)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/RashedMaaitah/goapi/internal/config"
+	log "github.com/sirupsen/logrus"
+)
+
+type contextKey struct{}
+
+// New builds a logger with the level and format from cfg writing to out.
+func New(cfg config.LogConfig, out io.Writer) (*log.Logger, error) {
+	var err error
+
+	var logger *log.Logger = log.New()
+	logger.SetOutput(out)
+	logger.SetReportCaller(true)
+
+	if err = Configure(logger, cfg); err != nil {
+		return nil, err
+	}
+	return logger, nil
+}
+
+// Configure sets the level and format of logger to those of cfg, as when
+// the config is reloaded.
+func Configure(logger *log.Logger, cfg config.LogConfig) error {
+	level, err := log.ParseLevel(cfg.Level)
+	if err != nil {
+		return err
+	}
+
+	var formatter log.Formatter
+	switch cfg.Format {
+	case "json":
+		formatter = &log.JSONFormatter{}
+	case "text":
+		formatter = &log.TextFormatter{}
+	default:
+		return fmt.Errorf("unknown log format %q", cfg.Format)
+	}
+
+	logger.SetLevel(level)
+	logger.SetFormatter(formatter)
+	return nil
+}
+
+// NewContext returns a copy of ctx carrying entry, which FromContext returns.
+func NewContext(ctx context.Context, entry *log.Entry) context.Context {
+	return context.WithValue(ctx, contextKey{}, entry)
+}
+
+// FromContext returns the request scoped logger stored in ctx, or an entry
+// of the standard logger when there is none.
+func FromContext(ctx context.Context) *log.Entry {
+	if entry, ok := ctx.Value(contextKey{}).(*log.Entry); ok {
+		return entry
+	}
+	return log.NewEntry(log.StandardLogger())
+}
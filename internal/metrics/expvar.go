@@ -0,0 +1,177 @@
+package metrics
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Expvar serves the metrics as JSON, next to the variables the expvar
+// package publishes, such as memstats. A metric with labels is an object of
+// its series, keyed label=value,...; a histogram has the count, the sum and
+// the cumulative count of every bucket. The metrics aren't published in the
+// expvar package, so that more than one Expvar can exist.
+type Expvar struct {
+	vars expvar.Map
+}
+
+func NewExpvar() *Expvar {
+	return &Expvar{}
+}
+
+func (e *Expvar) Counter(opts Opts) Counter {
+	return e.metric(opts, nil)
+}
+
+func (e *Expvar) Gauge(opts Opts) Gauge {
+	return e.metric(opts, nil)
+}
+
+func (e *Expvar) Histogram(opts Opts) Histogram {
+	var buckets = append([]float64(nil), opts.Buckets...)
+	sort.Float64s(buckets)
+	return e.metric(opts, func() expvar.Var { return &expvarHistogram{bounds: buckets, counts: make([]uint64, len(buckets))} })
+}
+
+// metric makes the var of opts, of the series of newVar, or of
+// *expvar.Float when it is nil.
+func (e *Expvar) metric(opts Opts, newVar func() expvar.Var) *expvarMetric {
+	if newVar == nil {
+		newVar = func() expvar.Var { return new(expvar.Float) }
+	}
+
+	var m = &expvarMetric{labels: opts.Labels, newVar: newVar}
+	var name string = namespace + "_" + opts.Subsystem + "_" + opts.Name
+	if len(opts.Labels) == 0 {
+		m.single = newVar()
+		e.vars.Set(name, m.single)
+	} else {
+		m.series = new(expvar.Map)
+		e.vars.Set(name, m.series)
+	}
+	return m
+}
+
+func (e *Expvar) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+		var first = true
+		var write = func(kv expvar.KeyValue) {
+			if !first {
+				fmt.Fprintf(w, ",\n")
+			}
+			first = false
+			fmt.Fprintf(w, "%q: %s", kv.Key, kv.Value)
+		}
+
+		fmt.Fprintf(w, "{\n")
+		expvar.Do(write)
+		e.vars.Do(write)
+		fmt.Fprintf(w, "\n}\n")
+	})
+}
+
+func (e *Expvar) Close() error {
+	return nil
+}
+
+type expvarMetric struct {
+	labels []string
+	newVar func() expvar.Var
+
+	// single is the var of a metric without labels, series those of the
+	// others.
+	single expvar.Var
+	series *expvar.Map
+	// mu serializes the creation of series.
+	mu sync.Mutex
+}
+
+// get returns the var of the series of values, creating it the first time.
+func (m *expvarMetric) get(values []string) expvar.Var {
+	if m.single != nil {
+		return m.single
+	}
+
+	var pairs = make([]string, 0, len(values))
+	for i, value := range values {
+		if i < len(m.labels) {
+			pairs = append(pairs, m.labels[i]+"="+value)
+		}
+	}
+	var key string = strings.Join(pairs, ",")
+
+	if v := m.series.Get(key); v != nil {
+		return v
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if v := m.series.Get(key); v != nil {
+		return v
+	}
+	var v expvar.Var = m.newVar()
+	m.series.Set(key, v)
+	return v
+}
+
+func (m *expvarMetric) Inc(labels ...string) {
+	m.get(labels).(*expvar.Float).Add(1)
+}
+
+func (m *expvarMetric) Add(delta float64, labels ...string) {
+	m.get(labels).(*expvar.Float).Add(delta)
+}
+
+func (m *expvarMetric) Set(value float64, labels ...string) {
+	m.get(labels).(*expvar.Float).Set(value)
+}
+
+func (m *expvarMetric) Observe(value float64, labels ...string) {
+	m.get(labels).(*expvarHistogram).observe(value)
+}
+
+type expvarHistogram struct {
+	bounds []float64
+
+	mu     sync.Mutex
+	count  uint64
+	sum    float64
+	counts []uint64
+}
+
+func (h *expvarHistogram) observe(value float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.count++
+	h.sum += value
+	for i, bound := range h.bounds {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+}
+
+func (h *expvarHistogram) String() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var buckets = make(map[string]uint64, len(h.bounds)+1)
+	for i, bound := range h.bounds {
+		buckets[strconv.FormatFloat(bound, 'g', -1, 64)] = h.counts[i]
+	}
+	buckets["+Inf"] = h.count
+
+	data, _ := json.Marshal(struct {
+		Count   uint64            `json:"count"`
+		Sum     float64           `json:"sum"`
+		Buckets map[string]uint64 `json:"buckets"`
+	}{h.count, h.sum, buckets})
+	return string(data)
+}
@@ -0,0 +1,290 @@
+// Package metrics declares the metrics of the service, recorded through the
+// Counter, Gauge and Histogram interfaces and sent or served by one of the
+// exporters: Prometheus, statsd, expvar, or none.
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/RashedMaaitah/goapi/internal/config"
+)
+
+const namespace = "goapi"
+
+// The instruments take the values of their labels, in the order of
+// Opts.Labels, with every call.
+type Counter interface {
+	Inc(labels ...string)
+}
+
+type Gauge interface {
+	Add(delta float64, labels ...string)
+	Set(value float64, labels ...string)
+}
+
+type Histogram interface {
+	Observe(value float64, labels ...string)
+}
+
+// Opts describes a metric, named goapi_<Subsystem>_<Name> in Prometheus.
+// Buckets are the upper bounds of the buckets of a histogram.
+type Opts struct {
+	Subsystem string
+	Name      string
+	Help      string
+	Labels    []string
+	Buckets   []float64
+}
+
+// Exporter makes the instruments of the metrics it exports.
+type Exporter interface {
+	Counter(opts Opts) Counter
+	Gauge(opts Opts) Gauge
+	Histogram(opts Opts) Histogram
+
+	// Handler serves the metrics at metrics.path, or is nil for an
+	// exporter sending them elsewhere.
+	Handler() http.Handler
+
+	// Close sends what is left to send.
+	Close() error
+}
+
+// Metrics are the instruments shared by the instrumentation points.
+type Metrics struct {
+	Exporter Exporter
+
+	RequestDuration  Histogram
+	Requests         Counter
+	RequestsInFlight Gauge
+
+	DBCallDuration Histogram
+	DBCalls        Counter
+	DBRetries      Counter
+	DBCoalesced    Counter
+
+	CacheLookups Counter
+
+	LoginCacheLookups   Counter
+	LoginCacheEvictions Counter
+
+	BreakerTransitions Counter
+	BreakerRejected    Counter
+
+	LimiterInFlight Gauge
+	LimiterQueued   Gauge
+
+	Lockouts       Counter
+	Introspections Counter
+
+	JobRuns     Counter
+	JobDuration Histogram
+	JobLastRun  Gauge
+
+	AuditFailures Counter
+
+	AccessLogDropped Counter
+
+	LeaderboardRefreshes Counter
+	LeaderboardAge       Gauge
+}
+
+// Open returns the metrics exported as cfg says, recorded nowhere when
+// they are disabled.
+func Open(cfg config.MetricsConfig) (*Metrics, error) {
+	if !cfg.Enabled {
+		return New(Noop{}), nil
+	}
+
+	switch cfg.Exporter {
+	case config.ExporterPrometheus:
+		return New(NewPrometheus()), nil
+	case config.ExporterExpvar:
+		return New(NewExpvar()), nil
+	case config.ExporterStatsd:
+		exporter, err := NewStatsd(cfg.Statsd)
+		if err != nil {
+			return nil, err
+		}
+		return New(exporter), nil
+	default:
+		return nil, fmt.Errorf("unknown metrics exporter %q", cfg.Exporter)
+	}
+}
+
+// New returns the metrics of the service, exported by e.
+func New(e Exporter) *Metrics {
+	var m = &Metrics{
+		Exporter: e,
+
+		RequestDuration: e.Histogram(Opts{
+			Subsystem: "http",
+			Name:      "request_duration_seconds",
+			Help:      "Duration of HTTP requests by route pattern, method and status code.",
+			Labels:    []string{"route", "method", "code"},
+			Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 1.5, 2, 2.5, 5, 10},
+		}),
+
+		Requests: e.Counter(Opts{
+			Subsystem: "http",
+			Name:      "requests_total",
+			Help:      "Number of HTTP requests by route pattern, method and status code.",
+			Labels:    []string{"route", "method", "code"},
+		}),
+
+		RequestsInFlight: e.Gauge(Opts{
+			Subsystem: "http",
+			Name:      "requests_in_flight",
+			Help:      "Number of HTTP requests currently being served.",
+		}),
+
+		DBCallDuration: e.Histogram(Opts{
+			Subsystem: "db",
+			Name:      "call_duration_seconds",
+			Help:      "Duration of database calls by method.",
+			Labels:    []string{"method"},
+			Buckets:   []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 1.5, 2, 5},
+		}),
+
+		DBCalls: e.Counter(Opts{
+			Subsystem: "db",
+			Name:      "calls_total",
+			Help:      "Number of database calls by method and result (ok, not_found, error).",
+			Labels:    []string{"method", "result"},
+		}),
+
+		DBRetries: e.Counter(Opts{
+			Subsystem: "db",
+			Name:      "retries_total",
+			Help:      "Number of database calls retried after a transient error, by method.",
+			Labels:    []string{"method"},
+		}),
+
+		DBCoalesced: e.Counter(Opts{
+			Subsystem: "db",
+			Name:      "coalesced_total",
+			Help:      "Number of database reads answered by an identical one already in flight, by method.",
+			Labels:    []string{"method"},
+		}),
+
+		CacheLookups: e.Counter(Opts{
+			Subsystem: "cache",
+			Name:      "lookups_total",
+			Help:      "Number of balance cache lookups by result (hit, miss, error).",
+			Labels:    []string{"result"},
+		}),
+
+		LoginCacheLookups: e.Counter(Opts{
+			Subsystem: "auth_cache",
+			Name:      "lookups_total",
+			Help:      "Number of token lookups in the login cache by result (hit, miss).",
+			Labels:    []string{"result"},
+		}),
+
+		LoginCacheEvictions: e.Counter(Opts{
+			Subsystem: "auth_cache",
+			Name:      "evictions_total",
+			Help:      "Number of tokens dropped from the full login cache.",
+		}),
+
+		BreakerTransitions: e.Counter(Opts{
+			Subsystem: "db_breaker",
+			Name:      "transitions_total",
+			Help:      "Number of times the database circuit breaker changed to a state (closed, open, half_open).",
+			Labels:    []string{"state"},
+		}),
+
+		BreakerRejected: e.Counter(Opts{
+			Subsystem: "db_breaker",
+			Name:      "rejected_total",
+			Help:      "Number of database calls failed at once by the open circuit breaker.",
+		}),
+
+		LimiterInFlight: e.Gauge(Opts{
+			Subsystem: "limiter",
+			Name:      "in_flight",
+			Help:      "Number of API requests holding a slot of the concurrency limiter.",
+		}),
+
+		LimiterQueued: e.Gauge(Opts{
+			Subsystem: "limiter",
+			Name:      "queued",
+			Help:      "Number of API requests waiting for a slot of the concurrency limiter.",
+		}),
+
+		Lockouts: e.Counter(Opts{
+			Subsystem: "auth",
+			Name:      "lockouts_total",
+			Help:      "Number of usernames and IPs locked out after failing to authenticate, by kind.",
+			Labels:    []string{"kind"},
+		}),
+
+		Introspections: e.Counter(Opts{
+			Subsystem: "auth",
+			Name:      "introspections_total",
+			Help:      "Number of OAuth2 access tokens checked by result (active, inactive, cached, error).",
+			Labels:    []string{"result"},
+		}),
+
+		JobRuns: e.Counter(Opts{
+			Subsystem: "jobs",
+			Name:      "runs_total",
+			Help:      "Number of background job runs by job and result (ok, error, timeout, panic, skipped).",
+			Labels:    []string{"job", "result"},
+		}),
+
+		JobDuration: e.Histogram(Opts{
+			Subsystem: "jobs",
+			Name:      "duration_seconds",
+			Help:      "Duration of background job runs by job.",
+			Labels:    []string{"job"},
+			Buckets:   []float64{.01, .05, .1, .5, 1, 5, 10, 30, 60, 300, 600},
+		}),
+
+		JobLastRun: e.Gauge(Opts{
+			Subsystem: "jobs",
+			Name:      "last_run_timestamp_seconds",
+			Help:      "Unix time the last run of a background job finished, by job and result.",
+			Labels:    []string{"job", "result"},
+		}),
+
+		AuditFailures: e.Counter(Opts{
+			Subsystem: "audit",
+			Name:      "write_failures_total",
+			Help:      "Number of audit entries that could not be written, by action.",
+			Labels:    []string{"action"},
+		}),
+
+		AccessLogDropped: e.Counter(Opts{
+			Subsystem: "access_log",
+			Name:      "dropped_total",
+			Help:      "Number of access log entries dropped as the buffer was full.",
+		}),
+
+		LeaderboardRefreshes: e.Counter(Opts{
+			Subsystem: "leaderboard",
+			Name:      "refreshes_total",
+			Help:      "Number of background leaderboard computations by result (ok, error).",
+			Labels:    []string{"result"},
+		}),
+
+		LeaderboardAge: e.Gauge(Opts{
+			Subsystem: "leaderboard",
+			Name:      "age_seconds",
+			Help:      "Age of the cached leaderboard, as of the last time it was read or refreshed.",
+		}),
+	}
+
+	return m
+}
+
+// Handler serves the metrics, or is nil when the exporter sends them
+// elsewhere.
+func (m *Metrics) Handler() http.Handler {
+	return m.Exporter.Handler()
+}
+
+func (m *Metrics) Close() error {
+	return m.Exporter.Close()
+}
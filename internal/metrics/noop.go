@@ -0,0 +1,21 @@
+package metrics
+
+import "net/http"
+
+// Noop records nothing, for when metrics are disabled. The HTTP middleware
+// and the database decorator aren't mounted then, so what is left calls it
+// a few times per request at most.
+type Noop struct{}
+
+func (Noop) Counter(Opts) Counter     { return noop{} }
+func (Noop) Gauge(Opts) Gauge         { return noop{} }
+func (Noop) Histogram(Opts) Histogram { return noop{} }
+func (Noop) Handler() http.Handler    { return nil }
+func (Noop) Close() error             { return nil }
+
+type noop struct{}
+
+func (noop) Inc(...string)              {}
+func (noop) Add(float64, ...string)     {}
+func (noop) Set(float64, ...string)     {}
+func (noop) Observe(float64, ...string) {}
@@ -0,0 +1,99 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Prometheus exports the metrics from Registry, in the Prometheus exposition
+// format, along with those of the Go runtime and the process.
+type Prometheus struct {
+	Registry *prometheus.Registry
+}
+
+func NewPrometheus() *Prometheus {
+	var p = &Prometheus{Registry: prometheus.NewRegistry()}
+	p.Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return p
+}
+
+func (p *Prometheus) Counter(opts Opts) Counter {
+	var vec = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: opts.Subsystem,
+		Name:      opts.Name,
+		Help:      opts.Help,
+	}, opts.Labels)
+	p.Registry.MustRegister(vec)
+	// A metric without labels is exported at 0 from the start, rather
+	// than from its first change.
+	if len(opts.Labels) == 0 {
+		vec.WithLabelValues()
+	}
+	return promCounter{vec}
+}
+
+func (p *Prometheus) Gauge(opts Opts) Gauge {
+	var vec = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: opts.Subsystem,
+		Name:      opts.Name,
+		Help:      opts.Help,
+	}, opts.Labels)
+	p.Registry.MustRegister(vec)
+	if len(opts.Labels) == 0 {
+		vec.WithLabelValues()
+	}
+	return promGauge{vec}
+}
+
+func (p *Prometheus) Histogram(opts Opts) Histogram {
+	var vec = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: opts.Subsystem,
+		Name:      opts.Name,
+		Help:      opts.Help,
+		Buckets:   opts.Buckets,
+	}, opts.Labels)
+	p.Registry.MustRegister(vec)
+	if len(opts.Labels) == 0 {
+		vec.WithLabelValues()
+	}
+	return promHistogram{vec}
+}
+
+func (p *Prometheus) Handler() http.Handler {
+	return promhttp.HandlerFor(p.Registry, promhttp.HandlerOpts{Registry: p.Registry})
+}
+
+func (p *Prometheus) Close() error {
+	return nil
+}
+
+type promCounter struct{ vec *prometheus.CounterVec }
+
+func (c promCounter) Inc(labels ...string) {
+	c.vec.WithLabelValues(labels...).Inc()
+}
+
+type promGauge struct{ vec *prometheus.GaugeVec }
+
+func (g promGauge) Add(delta float64, labels ...string) {
+	g.vec.WithLabelValues(labels...).Add(delta)
+}
+
+func (g promGauge) Set(value float64, labels ...string) {
+	g.vec.WithLabelValues(labels...).Set(value)
+}
+
+type promHistogram struct{ vec *prometheus.HistogramVec }
+
+func (h promHistogram) Observe(value float64, labels ...string) {
+	h.vec.WithLabelValues(labels...).Observe(value)
+}
@@ -0,0 +1,184 @@
+package metrics
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/internal/config"
+)
+
+// maxPacket keeps the datagrams under the MTU of most networks.
+const maxPacket = 1432
+
+var tagReplacer = strings.NewReplacer(",", "_", "|", "_", "#", "_", "\n", "_")
+
+// Statsd sends the metrics over UDP to a statsd or DogStatsD agent, named
+// <prefix>.<subsystem>.<name>, every flush interval and whenever a datagram
+// is full. Labels are sent as DogStatsD tags after those of the config.
+type Statsd struct {
+	conn   net.Conn
+	prefix string
+	tags   []string
+
+	mu  sync.Mutex
+	buf []byte
+	// gauges are the values of the gauge series, which Add is relative to.
+	gauges map[string]float64
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func NewStatsd(cfg config.StatsdConfig) (*Statsd, error) {
+	conn, err := net.Dial("udp", cfg.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("metrics.statsd.addr: %w", err)
+	}
+
+	var s = &Statsd{
+		conn:   conn,
+		prefix: cfg.Prefix,
+		tags:   cfg.Tags,
+		buf:    make([]byte, 0, maxPacket),
+		gauges: map[string]float64{},
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go s.flushEvery(cfg.FlushInterval.Duration())
+	return s, nil
+}
+
+func (s *Statsd) Counter(opts Opts) Counter {
+	return &statsdMetric{s: s, name: s.name(opts), labels: opts.Labels}
+}
+
+func (s *Statsd) Gauge(opts Opts) Gauge {
+	return &statsdMetric{s: s, name: s.name(opts), labels: opts.Labels}
+}
+
+func (s *Statsd) Histogram(opts Opts) Histogram {
+	return &statsdMetric{s: s, name: s.name(opts), labels: opts.Labels}
+}
+
+func (s *Statsd) name(opts Opts) string {
+	var name string = opts.Subsystem + "." + opts.Name
+	if s.prefix != "" {
+		name = s.prefix + "." + name
+	}
+	return name
+}
+
+func (s *Statsd) Handler() http.Handler {
+	return nil
+}
+
+func (s *Statsd) Close() error {
+	close(s.stop)
+	<-s.done
+
+	s.mu.Lock()
+	s.flush()
+	s.mu.Unlock()
+	return s.conn.Close()
+}
+
+func (s *Statsd) flushEvery(interval time.Duration) {
+	defer close(s.done)
+
+	var ticker = time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.mu.Lock()
+			s.flush()
+			s.mu.Unlock()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// write buffers line, sending the datagram first if line doesn't fit.
+// s.mu must be held.
+func (s *Statsd) write(line string) {
+	if len(s.buf) > 0 && len(s.buf)+1+len(line) > maxPacket {
+		s.flush()
+	}
+	if len(s.buf) > 0 {
+		s.buf = append(s.buf, '\n')
+	}
+	s.buf = append(s.buf, line...)
+}
+
+// flush sends the buffered lines. s.mu must be held.
+func (s *Statsd) flush() {
+	if len(s.buf) == 0 {
+		return
+	}
+	// Metrics are lost, not retried, while the agent is away.
+	s.conn.Write(s.buf)
+	s.buf = s.buf[:0]
+}
+
+type statsdMetric struct {
+	s      *Statsd
+	name   string
+	labels []string
+}
+
+// tags returns the tags suffix of the series of values, "" for none.
+func (m *statsdMetric) tags(values []string) string {
+	var tags = make([]string, 0, len(m.s.tags)+len(values))
+	tags = append(tags, m.s.tags...)
+	for i, value := range values {
+		if i < len(m.labels) {
+			tags = append(tags, m.labels[i]+":"+tagReplacer.Replace(value))
+		}
+	}
+	if len(tags) == 0 {
+		return ""
+	}
+	return "|#" + strings.Join(tags, ",")
+}
+
+// send writes value as a metric of kind. s.mu must be held.
+func (m *statsdMetric) send(value float64, kind string, tags string) {
+	m.s.write(m.name + ":" + strconv.FormatFloat(value, 'f', -1, 64) + "|" + kind + tags)
+}
+
+func (m *statsdMetric) Inc(labels ...string) {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+	m.send(1, "c", m.tags(labels))
+}
+
+func (m *statsdMetric) Add(delta float64, labels ...string) {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	var tags string = m.tags(labels)
+	m.s.gauges[m.name+tags] += delta
+	m.send(m.s.gauges[m.name+tags], "g", tags)
+}
+
+func (m *statsdMetric) Set(value float64, labels ...string) {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	var tags string = m.tags(labels)
+	m.s.gauges[m.name+tags] = value
+	m.send(value, "g", tags)
+}
+
+func (m *statsdMetric) Observe(value float64, labels ...string) {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+	m.send(value, "h", m.tags(labels))
+}
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/internal/accesslog"
+	"github.com/go-chi/chi"
+	chimiddle "github.com/go-chi/chi/middleware"
+)
+
+type accessUserKey struct{}
+
+// accessUser is where WithLoginDetails leaves the user for AccessLog, which
+// only sees the context it started the request with.
+type accessUser struct {
+	username string
+}
+
+// AccessLog writes an entry of every request to l once it is answered,
+// even if its handler panics. The path is redacted like that of
+// RequestLogger.
+func AccessLog(l *accesslog.Log) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var start = time.Now()
+			var ww chimiddle.WrapResponseWriter = chimiddle.NewWrapResponseWriter(w, r.ProtoMajor)
+			var user = &accessUser{}
+			var completed bool
+
+			defer func() {
+				var entry = accesslog.Entry{
+					Time:       start.UTC(),
+					RequestID:  GetRequestID(r.Context()),
+					User:       user.username,
+					Method:     r.Method,
+					Path:       redactURL(r.URL),
+					Status:     ww.Status(),
+					DurationMs: float64(time.Since(start).Microseconds()) / 1000,
+					Bytes:      ww.BytesWritten(),
+					RemoteAddr: r.RemoteAddr,
+					Aborted:    !completed,
+				}
+				if entry.Status == 0 && completed {
+					entry.Status = http.StatusOK
+				}
+				if rctx := chi.RouteContext(r.Context()); rctx != nil {
+					entry.Route = rctx.RoutePattern()
+				}
+				l.Write(entry)
+			}()
+
+			next.ServeHTTP(ww, r.WithContext(context.WithValue(r.Context(), accessUserKey{}, user)))
+			completed = true
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/auth"
+	"github.com/RashedMaaitah/goapi/internal/logging"
+)
+
+// AdminToken only lets requests through whose token from source is adminToken.
+// An empty adminToken leaves the routes unprotected.
+func AdminToken(adminToken string, source auth.TokenSource) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if adminToken == "" {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, err := ReadToken(r, source)
+			if err != nil {
+				api.WriteErr(w, err)
+				return
+			}
+
+			if subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+				logging.FromContext(r.Context()).Error(UnAuthorizedError)
+				api.RequestErrorHandler(w, UnAuthorizedError)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
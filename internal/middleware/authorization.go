@@ -1,45 +1,127 @@
 package middleware
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"net/http"
 
 	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/auth"
+	"github.com/RashedMaaitah/goapi/internal/lockout"
+	"github.com/RashedMaaitah/goapi/internal/logging"
 	"github.com/RashedMaaitah/goapi/internal/tools"
-	log "github.com/sirupsen/logrus"
 )
 
 var UnAuthorizedError = errors.New("Invalid username or token.")
 
-func Authorization(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		var username string = r.URL.Query().Get("username")
-		var token = r.Header.Get("Authorization")
-		var err error
-
-		if username == "" || token == "" {
-			log.Error(UnAuthorizedError)
-			api.RequestErrorHandler(w, UnAuthorizedError)
-			return
-		}
-
-		var database *tools.DatabaseInterface
-		database, err = tools.NewDatabase()
-		if err != nil {
-			log.Error(err)
-			api.InternalErrorHandler(w)
-			return
-		}
-
-		var loginDetails *tools.LoginDetails
-		loginDetails = (*database).GetUserLoginDetails(username)
-
-		if loginDetails == nil || (token != (*loginDetails).AuthToken) {
-			log.Error(UnAuthorizedError)
-			api.RequestErrorHandler(w, UnAuthorizedError)
-			return
-		}
-
-		next.ServeHTTP(w, r)
-	})
+var UsernameMismatchError = errors.New("Token does not belong to this username.")
+
+type loginDetailsKey struct{}
+
+// Authorization authenticates requests with authenticator and stores the
+// LoginDetails of who they are in the context. Requests without
+// credentials, or with a malformed Authorization header, get a 401
+// challenging them for a Bearer token, and those whose token in source is
+// ambiguous a 400. The username query parameter is no longer needed; when
+// a client still sends it, it has to name the same user.
+//
+// Refused tokens and keys count as failures of the client IP in lockouts,
+// and an IP locked out gets a 429 before its credentials are even looked at.
+func Authorization(source auth.TokenSource, authenticator auth.Authenticator, lockouts *lockout.Lockout, trustProxy bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var logger = logging.FromContext(r.Context())
+			var username string = api.NormalizeUsername(r.URL.Query().Get("username"))
+
+			// A malformed Authorization header or two different tokens.
+			if _, err := ReadToken(r, source); err != nil {
+				api.WriteErr(w, err)
+				return
+			}
+
+			var identity *auth.Identity
+			var err error = CheckToken(r, lockouts, trustProxy, func() error {
+				var err error
+				identity, err = authenticator.Authenticate(r.Context(), r)
+				return err
+			})
+
+			if errors.Is(err, auth.ErrNoCredentials) {
+				api.WriteErr(w, api.ErrMissingToken)
+				return
+			}
+
+			// The token outlived its user, or names a user unknown here. It is
+			// answered like any other invalid token, not to tell which users
+			// exist.
+			if errors.Is(err, tools.ErrUserNotFound) {
+				api.WriteErr(w, fmt.Errorf("Token of a user that doesn't exist: %w", api.ErrInvalidToken))
+				return
+			}
+
+			// Unknown, revoked, forged and expired tokens and keys, a locked
+			// out IP, and a backend or identity provider that failed to say.
+			if err != nil {
+				api.WriteErr(w, err)
+				return
+			}
+
+			var loginDetails *tools.LoginDetails = identity.LoginDetails
+
+			// The token is genuine, it just isn't this user's.
+			if username != "" && loginDetails.Username != username {
+				logger.Warnf("Token of %s used for %s", loginDetails.Username, username)
+				api.ForbiddenErrorHandler(w, api.CodeUsernameMismatch, UsernameMismatchError)
+				return
+			}
+
+			logger.Debugf("Authorized %s by %s", loginDetails.Username, identity.Provider)
+
+			next.ServeHTTP(w, r.WithContext(WithLoginDetails(r.Context(), loginDetails)))
+		})
+	}
+}
+
+// ReadToken returns the token of r from source, and logs the clients still
+// sending it the legacy way.
+func ReadToken(r *http.Request, source auth.TokenSource) (string, error) {
+	token, legacy, err := source.Token(r)
+	if legacy {
+		logging.FromContext(r.Context()).Warnf("Deprecated token in %s, clients should send it as a Bearer token in Authorization", source.Header)
+	}
+	return token, err
+}
+
+// CheckToken calls check, which verifies the credentials of r, unless the
+// client IP is locked out in lockouts, and then returns an error answered
+// with a 429. An ErrInvalidToken or ErrInvalidAPIKey of check counts as a failure
+// of the IP.
+func CheckToken(r *http.Request, lockouts *lockout.Lockout, trustProxy bool, check func() error) error {
+	var ip string = ClientIP(r, trustProxy)
+	if locked := lockouts.Locked(r.Context(), "", ip); locked > 0 {
+		return &api.RetryAfterError{Err: fmt.Errorf("Token from %s: %w", ip, api.ErrLockedOut), After: locked}
+	}
+
+	var err error = check()
+	if errors.Is(err, auth.ErrInvalidToken) || errors.Is(err, auth.ErrInvalidAPIKey) {
+		lockouts.Fail(r.Context(), "", ip)
+	}
+	return err
+}
+
+// WithLoginDetails returns a copy of ctx authenticated as loginDetails, for
+// transports that authenticate outside of Authorization.
+func WithLoginDetails(ctx context.Context, loginDetails *tools.LoginDetails) context.Context {
+	if user, ok := ctx.Value(accessUserKey{}).(*accessUser); ok {
+		user.username = loginDetails.Username
+	}
+	return context.WithValue(ctx, loginDetailsKey{}, loginDetails)
+}
+
+// GetLoginDetails returns the user authenticated by Authorization, or nil
+// outside of an authorized route.
+func GetLoginDetails(ctx context.Context) *tools.LoginDetails {
+	loginDetails, _ := ctx.Value(loginDetailsKey{}).(*tools.LoginDetails)
+	return loginDetails
 }
@@ -0,0 +1,90 @@
+package middleware_test
+
+import (
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/apitest"
+	"github.com/RashedMaaitah/goapi/internal/config"
+)
+
+func TestAuthorizationHeaders(t *testing.T) {
+	var s = apitest.New(t, apitest.WithConfig(func(cfg *config.Config) { cfg.Auth.TokenHeader = "X-Auth-Token" }))
+	var alex, maria string = s.Token("alex"), s.Token("maria")
+
+	for _, tt := range []struct {
+		name      string
+		bearer    string
+		legacy    string
+		status    int
+		code      string
+		challenge string
+	}{
+		{"neither", "", "", http.StatusUnauthorized, api.CodeMissingToken, "Bearer"},
+		{"bearer", alex, "", http.StatusOK, "", ""},
+		{"legacy", "", alex, http.StatusOK, "", ""},
+		{"both the same", alex, alex, http.StatusOK, "", ""},
+		{"both different", alex, maria, http.StatusBadRequest, api.CodeConflictingTokens, ""},
+		{"unknown bearer", "nope", "", http.StatusUnauthorized, api.CodeInvalidToken, `Bearer error="invalid_token"`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var req = s.NewRequest(http.MethodGet, "/v1/account/coins", nil)
+			if tt.bearer != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.bearer)
+			}
+			if tt.legacy != "" {
+				req.Header.Set("X-Auth-Token", tt.legacy)
+			}
+			var resp = s.Do(req)
+
+			if challenge := resp.Header.Get("WWW-Authenticate"); challenge != tt.challenge {
+				t.Errorf("WWW-Authenticate = %q, want %q", challenge, tt.challenge)
+			}
+			if tt.code != "" {
+				apitest.DecodeError(t, resp, tt.status, tt.code)
+				return
+			}
+			// That of alex, not maria's 2500.
+			if balance := apitest.Decode[api.CoinBalanceResponse](t, resp, tt.status); balance.Balance != 1000 {
+				t.Errorf("balance = %s, want that of alex", balance.Balance)
+			}
+		})
+	}
+}
+
+func TestAuthorizationMalformed(t *testing.T) {
+	var s = apitest.New(t, apitest.WithConfig(func(cfg *config.Config) { cfg.Auth.TokenHeader = "X-Auth-Token" }))
+
+	for _, authorization := range []string{"Basic YWxleDpwYXNzd29yZA==", "Bearer", s.Token("alex")} {
+		t.Run(authorization, func(t *testing.T) {
+			var req = s.NewRequest(http.MethodGet, "/v1/account/coins", nil)
+			req.Header.Set("Authorization", authorization)
+			var resp = s.Do(req)
+			if challenge := resp.Header.Get("WWW-Authenticate"); challenge != `Bearer error="invalid_request"` {
+				t.Errorf("WWW-Authenticate = %q", challenge)
+			}
+			apitest.DecodeError(t, resp, http.StatusUnauthorized, api.CodeMalformedAuth)
+		})
+	}
+}
+
+func TestAuthorizationLegacyInAuthorization(t *testing.T) {
+	var s = apitest.New(t)
+
+	// The token as it is, the way it was sent before Bearer.
+	var req = s.NewRequest(http.MethodGet, "/v1/account/coins", nil)
+	req.Header.Set("Authorization", s.Token("alex"))
+	apitest.Decode[api.CoinBalanceResponse](t, s.Do(req), http.StatusOK)
+
+	s = apitest.New(t, apitest.WithConfig(func(cfg *config.Config) { cfg.Auth.LegacyTokens = false }))
+	req = s.NewRequest(http.MethodGet, "/v1/account/coins", nil)
+	req.Header.Set("Authorization", s.Token("alex"))
+	var resp = s.Do(req)
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("legacy token with legacy_tokens off answered %d, want 401", resp.StatusCode)
+	}
+}
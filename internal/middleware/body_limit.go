@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/RashedMaaitah/goapi/api"
+)
+
+// BodyLimit lets the bodies of requests have up to limit bytes, in place of
+// the MaxBodyBytes of the api.Settings, for routes taking larger uploads.
+func BodyLimit(limit int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, api.WithBodyLimit(r, limit))
+		})
+	}
+}
+
+// Settings serves requests with settings, for error_format to see them.
+func Settings(settings api.Settings) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, api.WithSettings(r, settings))
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package middleware_test
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/apitest"
+	"github.com/RashedMaaitah/goapi/internal/config"
+)
+
+// endlessBody streams spaces after the start of a deposit, up to size
+// bytes, counting those the server read.
+type endlessBody struct {
+	size int64
+	read atomic.Int64
+}
+
+func (b *endlessBody) Read(p []byte) (int, error) {
+	if b.read.Load() == 0 {
+		var n int = copy(p, `{"amount":1`)
+		b.read.Add(int64(n))
+		return n, nil
+	}
+	if b.read.Load() >= b.size {
+		return 0, io.EOF
+	}
+	for i := range p {
+		p[i] = ' '
+	}
+	b.read.Add(int64(len(p)))
+	return len(p), nil
+}
+
+func TestOversizedBodyStreamedIsCutShort(t *testing.T) {
+	var s = apitest.New(t)
+	var body = &endlessBody{size: 1 << 30}
+
+	var req = s.NewAuthedRequest("alex", http.MethodPost, "/v1/account/coins/deposit", nil)
+	req.Body = io.NopCloser(body)
+	req.ContentLength = -1
+	req.Header.Set("Content-Type", "application/json")
+
+	apitest.DecodeError(t, s.Do(req), http.StatusRequestEntityTooLarge, api.CodeBodyTooLarge)
+	// What the connection buffers, far from the whole gigabyte.
+	if read := body.read.Load(); read > 64<<20 {
+		t.Errorf("%d bytes of the body were sent, want it cut short near %d", read, s.Config.API.MaxBodyBytes)
+	}
+}
+
+func TestBodyLimitOfImport(t *testing.T) {
+	var s = apitest.New(t, apitest.WithConfig(func(cfg *config.Config) {
+		cfg.API.MaxBodyBytes = 1 << 10
+		cfg.API.ImportMaxBodyBytes = 1 << 20
+	}))
+	var padding string = strings.Repeat(" ", 2<<10)
+
+	var req = s.NewAuthedRequest("alex", http.MethodPost, "/v1/account/coins/deposit", nil)
+	req.Body = io.NopCloser(strings.NewReader(`{"amount":1}` + padding))
+	req.Header.Set("Content-Type", "application/json")
+	apitest.DecodeError(t, s.Do(req), http.StatusRequestEntityTooLarge, api.CodeBodyTooLarge)
+
+	// The same size is fine for the import under its own limit.
+	req = s.NewAuthedRequest("admin", http.MethodPost, "/v1/admin/users/import", nil)
+	req.Body = io.NopCloser(strings.NewReader(`[{"username":"newbie","password":"password123","coins":5}]` + padding))
+	req.Header.Set("Content-Type", "application/json")
+	var resp = s.Do(req)
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusRequestEntityTooLarge || resp.StatusCode >= 300 {
+		t.Errorf("import of %d bytes answered %d", len(padding), resp.StatusCode)
+	}
+
+	req = s.NewAuthedRequest("admin", http.MethodPost, "/v1/admin/users/import", nil)
+	req.Body = io.NopCloser(strings.NewReader(`[` + strings.Repeat(" ", 2<<20) + `]`))
+	req.Header.Set("Content-Type", "application/json")
+	apitest.DecodeError(t, s.Do(req), http.StatusRequestEntityTooLarge, api.CodeBodyTooLarge)
+}
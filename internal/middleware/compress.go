@@ -0,0 +1,248 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/RashedMaaitah/goapi/internal/config"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compress compresses response bodies of at least cfg.MinSize bytes with
+// zstd, when cfg.Zstd is set, or gzip, whichever the request accepts,
+// preferring zstd. Bodies of a type already compressed, or with their own
+// Content-Encoding, are left as they are. So are streams: a response
+// flushed before reaching cfg.MinSize is sent as is, and event streams and
+// WebSocket upgrades never are compressed.
+func Compress(cfg config.CompressionConfig) func(http.Handler) http.Handler {
+	var gzipWriters = sync.Pool{New: func() any {
+		// The level was validated with the config.
+		writer, _ := gzip.NewWriterLevel(io.Discard, cfg.Level)
+		return writer
+	}}
+	var zstdWriters = sync.Pool{New: func() any {
+		writer, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(cfg.Level)), zstd.WithEncoderConcurrency(1))
+		return writer
+	}}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodHead || r.Header.Get("Upgrade") != "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Add("Vary", "Accept-Encoding")
+			var encoding string = acceptedEncoding(r.Header.Get("Accept-Encoding"), cfg.Zstd)
+			if encoding == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			var cw = &compressWriter{ResponseWriter: w, encoding: encoding, minSize: cfg.MinSize, status: http.StatusOK}
+			switch encoding {
+			case "zstd":
+				var writer *zstd.Encoder = zstdWriters.Get().(*zstd.Encoder)
+				defer zstdWriters.Put(writer)
+				writer.Reset(w)
+				cw.encoder = writer
+			case "gzip":
+				var writer *gzip.Writer = gzipWriters.Get().(*gzip.Writer)
+				defer gzipWriters.Put(writer)
+				writer.Reset(w)
+				cw.encoder = writer
+			}
+
+			next.ServeHTTP(cw, r)
+			cw.close()
+		})
+	}
+}
+
+// encoder is a *gzip.Writer or a *zstd.Encoder.
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// compressWriter holds the status and the start of the body back until it
+// knows whether to compress them: once the body reaches minSize, or it
+// ends or is flushed before.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	encoder  encoder
+	minSize  int
+
+	status      int
+	buffered    []byte
+	decided     bool
+	compressing bool
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	if w.decided || status < http.StatusOK {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	w.status = status
+	if status == http.StatusNoContent || status == http.StatusNotModified {
+		w.decide(false)
+	}
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	if !w.decided {
+		if compressible(w.Header()) {
+			w.buffered = append(w.buffered, p...)
+			if len(w.buffered) < w.minSize {
+				return len(p), nil
+			}
+			w.decide(true)
+			return len(p), w.flushBuffered()
+		}
+		w.decide(false)
+		if err := w.flushBuffered(); err != nil {
+			return 0, err
+		}
+	}
+
+	if w.compressing {
+		return w.encoder.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// decide writes the status, with the headers of compress.
+func (w *compressWriter) decide(compress bool) {
+	w.decided = true
+	w.compressing = compress
+
+	if compress {
+		var header http.Header = w.Header()
+		if header.Get("Content-Type") == "" {
+			header.Set("Content-Type", http.DetectContentType(w.buffered))
+		}
+		header.Set("Content-Encoding", w.encoding)
+		header.Del("Content-Length")
+		// The compressed body isn't byte for byte the one tagged.
+		if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			header.Set("ETag", "W/"+etag)
+		}
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+}
+
+func (w *compressWriter) flushBuffered() error {
+	var buffered []byte = w.buffered
+	w.buffered = nil
+	if len(buffered) == 0 {
+		return nil
+	}
+	if w.compressing {
+		_, err := w.encoder.Write(buffered)
+		return err
+	}
+	_, err := w.ResponseWriter.Write(buffered)
+	return err
+}
+
+func (w *compressWriter) Flush() {
+	w.FlushError()
+}
+
+// FlushError is what http.ResponseController calls to flush.
+func (w *compressWriter) FlushError() error {
+	if !w.decided {
+		w.decide(false)
+	}
+	if err := w.flushBuffered(); err != nil {
+		return err
+	}
+	if w.compressing {
+		if err := w.encoder.Flush(); err != nil {
+			return err
+		}
+	}
+	return http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// close ends the response: what was held back is written as is, and a
+// compressed body is completed.
+func (w *compressWriter) close() {
+	if !w.decided {
+		w.decide(false)
+	}
+	w.flushBuffered()
+	if w.compressing {
+		w.encoder.Close()
+	}
+}
+
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// compressible reports whether a response with header is worth
+// compressing.
+func compressible(header http.Header) bool {
+	if header.Get("Content-Encoding") != "" {
+		return false
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	switch {
+	case mediaType == "text/event-stream":
+		return false
+	case strings.HasPrefix(mediaType, "image/") && mediaType != "image/svg+xml",
+		strings.HasPrefix(mediaType, "video/"),
+		strings.HasPrefix(mediaType, "audio/"),
+		strings.HasPrefix(mediaType, "font/woff"):
+		return false
+	}
+	switch mediaType {
+	case "application/gzip", "application/x-gzip", "application/zip", "application/zstd", "application/octet-stream":
+		return false
+	}
+	return true
+}
+
+// acceptedEncoding returns the encoding of an Accept-Encoding header to
+// compress with, zstd only when allowed, or "" for none. Encodings with a
+// q of 0 are refused, and * stands for those not listed.
+func acceptedEncoding(header string, allowZstd bool) string {
+	var accepted = map[string]bool{}
+	var wildcard bool
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		var ok bool = true
+		if q, found := strings.CutPrefix(strings.TrimSpace(params), "q="); found {
+			value, err := strconv.ParseFloat(q, 64)
+			ok = err == nil && value > 0
+		}
+		if name == "*" {
+			wildcard = ok
+			continue
+		}
+		accepted[name] = ok
+	}
+
+	var acceptedOrWildcard = func(name string) bool {
+		ok, listed := accepted[name]
+		return ok || !listed && wildcard
+	}
+	switch {
+	case allowZstd && acceptedOrWildcard("zstd"):
+		return "zstd"
+	case acceptedOrWildcard("gzip"):
+		return "gzip"
+	}
+	return ""
+}
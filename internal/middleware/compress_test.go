@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/internal/config"
+)
+
+// TestCompressStreamsEvents checks each event of a stream reaches the client
+// before the next one is written, whether the stream is left as is or
+// compressed.
+func TestCompressStreamsEvents(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		contentType string
+		encoding    string
+	}{
+		{"event stream", "text/event-stream", ""},
+		{"compressed stream", "application/x-ndjson", "gzip"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			const events = 3
+			var read, done = make(chan struct{}), make(chan struct{})
+			var h = Compress(config.CompressionConfig{Enabled: true, Level: 5, MinSize: 0})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				defer close(done)
+				w.Header().Set("Content-Type", tt.contentType)
+				for i := 0; i < events; i++ {
+					fmt.Fprintf(w, "data: %d\n", i)
+					w.(http.Flusher).Flush()
+					select {
+					case <-read:
+					case <-time.After(time.Second):
+						t.Errorf("event %d never reached the client", i)
+						return
+					}
+				}
+			}))
+			var server = httptest.NewServer(h)
+			defer server.Close()
+
+			var req, _ = http.NewRequest(http.MethodGet, server.URL, nil)
+			// Set, the transport leaves the response compressed.
+			req.Header.Set("Accept-Encoding", "gzip")
+			resp, err := server.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			if encoding := resp.Header.Get("Content-Encoding"); encoding != tt.encoding {
+				t.Fatalf("Content-Encoding = %q, want %q", encoding, tt.encoding)
+			}
+			var body io.Reader = resp.Body
+			if tt.encoding == "gzip" {
+				if body, err = gzip.NewReader(resp.Body); err != nil {
+					t.Fatal(err)
+				}
+			}
+			var lines = bufio.NewReader(body)
+			for i := 0; i < events; i++ {
+				line, err := lines.ReadString('\n')
+				if want := fmt.Sprintf("data: %d\n", i); err != nil || line != want {
+					t.Fatalf("event %d = %q, %v, want %q", i, line, err, want)
+				}
+				select {
+				case read <- struct{}{}:
+				case <-done:
+					t.Fatalf("event %d came once the stream ended", i)
+				}
+			}
+		})
+	}
+}
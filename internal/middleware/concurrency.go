@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/config"
+	"github.com/RashedMaaitah/goapi/internal/logging"
+	"github.com/RashedMaaitah/goapi/internal/metrics"
+	"golang.org/x/sync/semaphore"
+)
+
+type slotKey struct{}
+
+// ConcurrencyLimit serves at most cfg.Max requests at once. Those past it
+// wait for a slot in turn, up to cfg.Queue of them and for at most
+// cfg.QueueTimeout; the others are answered with a 503 and a Retry-After.
+// Long-lived requests such as streams give their slot back with
+// ReleaseSlot.
+func ConcurrencyLimit(cfg config.ConcurrencyConfig, m *metrics.Metrics) func(http.Handler) http.Handler {
+	var slots *semaphore.Weighted = semaphore.NewWeighted(int64(cfg.Max))
+	var queued atomic.Int64
+	var retryAfter string = strconv.Itoa(max(1, ceilSeconds(cfg.QueueTimeout.Duration())))
+
+	var reject = func(w http.ResponseWriter, r *http.Request) {
+		logging.FromContext(r.Context()).Warnf("Too many requests in flight, rejecting %s %s", r.Method, r.URL.Path)
+		w.Header().Set("Retry-After", retryAfter)
+		api.OverloadedErrorHandler(w)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !slots.TryAcquire(1) {
+				if queued.Add(1) > int64(cfg.Queue) {
+					queued.Add(-1)
+					reject(w, r)
+					return
+				}
+				m.LimiterQueued.Add(1)
+
+				ctx, cancel := context.WithTimeout(r.Context(), cfg.QueueTimeout.Duration())
+				var err error = slots.Acquire(ctx, 1)
+				cancel()
+
+				queued.Add(-1)
+				m.LimiterQueued.Add(-1)
+				if err != nil {
+					reject(w, r)
+					return
+				}
+			}
+
+			m.LimiterInFlight.Add(1)
+			var once sync.Once
+			var release = func() {
+				once.Do(func() {
+					m.LimiterInFlight.Add(-1)
+					slots.Release(1)
+				})
+			}
+			defer release()
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), slotKey{}, release)))
+		})
+	}
+}
+
+// ReleaseSlot gives back the slot ConcurrencyLimit gave the request of ctx,
+// if any, for another request to use.
+func ReleaseSlot(ctx context.Context) {
+	if release, ok := ctx.Value(slotKey{}).(func()); ok {
+		release()
+	}
+}
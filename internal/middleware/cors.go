@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/config"
+)
+
+// CORS answers preflight requests and adds the CORS response headers for
+// the allowed origins. Requests from other origins are still served, just
+// without CORS headers, so the browser enforces the policy. The authHeaders,
+// carrying tokens and API keys, are always allowed.
+func CORS(cfg config.CORSConfig, authHeaders ...string) func(http.Handler) http.Handler {
+	var allowAny bool = cfg.AllowsAnyOrigin()
+	var origins = make(map[string]bool, len(cfg.AllowedOrigins))
+	for _, origin := range cfg.AllowedOrigins {
+		origins[strings.ToLower(origin)] = true
+	}
+
+	var allowedHeaders []string = append([]string{}, cfg.AllowedHeaders...)
+	for _, header := range authHeaders {
+		if !containsFold(allowedHeaders, header) {
+			allowedHeaders = append(allowedHeaders, header)
+		}
+	}
+
+	var methods string = strings.Join(cfg.AllowedMethods, ", ")
+	var headers string = strings.Join(allowedHeaders, ", ")
+	var exposed string = strings.Join(append([]string{api.RequestIDHeader}, cfg.ExposedHeaders...), ", ")
+	var maxAge string = strconv.Itoa(int(cfg.MaxAge.Duration().Seconds()))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var origin string = r.Header.Get("Origin")
+			var preflight bool = r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Add("Vary", "Origin")
+			var allowed bool = allowAny || origins[strings.ToLower(origin)]
+
+			if preflight {
+				w.Header().Add("Vary", "Access-Control-Request-Method")
+				w.Header().Add("Vary", "Access-Control-Request-Headers")
+
+				if allowed {
+					setAllowOrigin(w, origin, allowAny)
+					w.Header().Set("Access-Control-Allow-Methods", methods)
+					w.Header().Set("Access-Control-Allow-Headers", headers)
+					w.Header().Set("Access-Control-Max-Age", maxAge)
+				}
+
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			if allowed {
+				setAllowOrigin(w, origin, allowAny)
+				w.Header().Set("Access-Control-Expose-Headers", exposed)
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func setAllowOrigin(w http.ResponseWriter, origin string, wildcard bool) {
+	if wildcard {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+}
+
+func containsFold(values []string, v string) bool {
+	for _, value := range values {
+		if strings.EqualFold(value, v) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/api"
+)
+
+// Deprecated marks responses as served by a deprecated route: it sets the
+// Deprecation header, the Sunset header when sunset is not zero, and a Link
+// to the same path under successorPrefix.
+func Deprecated(sunset time.Time, successorPrefix string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Deprecation", "true")
+			if !sunset.IsZero() {
+				w.Header().Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+			}
+			w.Header().Set("Link", "<"+successorPrefix+r.URL.Path+">; rel=\"successor-version\"")
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// DeprecatedUsernameQuery marks the requests still naming their user in the
+// username query parameter as deprecated, with a Link to successor, a path
+// whose {username} is replaced by that user.
+func DeprecatedUsernameQuery(successor string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if username := api.NormalizeUsername(r.URL.Query().Get("username")); username != "" {
+				w.Header().Set("Deprecation", "true")
+				w.Header().Set("Link", "<"+strings.Replace(successor, "{username}", url.PathEscape(username), 1)+">; rel=\"successor-version\"")
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,17 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/RashedMaaitah/goapi/api"
+)
+
+// ErrorFormat has the error handlers of package api write their responses
+// with writer, which may pick a format per request.
+func ErrorFormat(writer api.ErrorWriter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(api.WithErrorWriter(w, r, writer), r)
+		})
+	}
+}
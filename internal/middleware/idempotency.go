@@ -0,0 +1,124 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/logging"
+	"github.com/RashedMaaitah/goapi/internal/tools"
+	chimiddle "github.com/go-chi/chi/middleware"
+)
+
+const (
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader marks a response replayed from the store.
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLength = 255
+
+	invalidIdempotencyKeyMessage = "Idempotency-Key must be at most 255 characters."
+)
+
+var IdempotencyKeyReusedError = errors.New("This Idempotency-Key was used with a different request.")
+
+var IdempotencyInProgressError = errors.New("A request with this Idempotency-Key is still in progress.")
+
+// Idempotency executes a request sent with an Idempotency-Key header once
+// and replays its response to retries with the same key and body until ttl
+// has passed. Keys are per user, so Authorization must run first. A retry
+// arriving while the first request still runs gets a 409; server errors
+// are not stored, so the request can be tried again. Bodies are read up to
+// api.BodyLimit.
+func Idempotency(database tools.Database, ttl time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var logger = logging.FromContext(r.Context())
+			var key string = r.Header.Get(IdempotencyKeyHeader)
+
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				api.RequestErrorHandler(w, errors.New(invalidIdempotencyKeyMessage))
+				return
+			}
+
+			// Capped like ReadJSON caps it, a body past the limit gets the
+			// same 413 and leaves the key free.
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, api.BodyLimit(r)))
+
+			if err != nil {
+				logger.Warn(err)
+				api.RequestErrorHandler(w, err)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			var hash = sha256.New()
+			io.WriteString(hash, r.Method+" "+r.URL.Path+"\n")
+			hash.Write(body)
+			var requestHash string = hex.EncodeToString(hash.Sum(nil))
+
+			var scoped string = GetLoginDetails(r.Context()).Username + ":" + key
+
+			record, err := database.ReserveIdempotencyKey(r.Context(), scoped, requestHash, time.Now().Add(ttl))
+
+			switch {
+			case errors.Is(err, tools.ErrKeyReserved) && record.RequestHash != requestHash:
+				api.UnprocessableErrorHandler(w, api.CodeIdempotencyKeyReused, IdempotencyKeyReusedError)
+				return
+			case errors.Is(err, tools.ErrKeyReserved) && !record.Done:
+				api.ConflictErrorHandler(w, api.CodeIdempotencyInProgress, IdempotencyInProgressError)
+				return
+			case errors.Is(err, tools.ErrKeyReserved):
+				logger.Debugf("Replaying the response to Idempotency-Key %q", key)
+				w.Header().Set("Content-Type", record.ContentType)
+				w.Header().Set(IdempotentReplayedHeader, "true")
+				w.WriteHeader(record.StatusCode)
+				w.Write(record.Body)
+				return
+			case err != nil:
+				logger.Error(err)
+				api.InternalErrorHandler(w)
+				return
+			}
+
+			var response bytes.Buffer
+			var ww chimiddle.WrapResponseWriter = chimiddle.NewWrapResponseWriter(w, r.ProtoMajor)
+			ww.Tee(&response)
+
+			// Release the key if the handler panics, Recoverer answers for it.
+			var completed bool
+			defer func() {
+				if !completed {
+					database.ReleaseIdempotencyKey(r.Context(), scoped)
+				}
+			}()
+
+			next.ServeHTTP(ww, r)
+
+			var status int = ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			if status >= http.StatusInternalServerError {
+				return
+			}
+
+			err = database.CompleteIdempotencyKey(r.Context(), scoped, status, ww.Header().Get("Content-Type"), response.Bytes())
+			completed = true
+
+			if err != nil {
+				logger.Errorf("Storing the response to Idempotency-Key %q: %v", key, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/tools"
+	log "github.com/sirupsen/logrus"
+)
+
+// idempotent is a handler behind Idempotency counting its calls, answering
+// 201 with the body it read.
+func idempotent(t *testing.T) (http.Handler, *atomic.Int32) {
+	t.Helper()
+
+	var calls atomic.Int32
+	var logger = log.New()
+	logger.SetOutput(io.Discard)
+	var database = tools.NewInMemoryDB(logger)
+	t.Cleanup(func() { database.Close() })
+
+	var h = Idempotency(database, time.Hour)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write(body)
+	}))
+	return h, &calls
+}
+
+func idempotentRequest(key string, body string) *http.Request {
+	var r = httptest.NewRequest(http.MethodPost, "/account/coins/deposit", strings.NewReader(body))
+	r.Header.Set(IdempotencyKeyHeader, key)
+	return r.WithContext(WithLoginDetails(r.Context(), &tools.LoginDetails{Username: "alex"}))
+}
+
+func TestIdempotencyReplays(t *testing.T) {
+	h, calls := idempotent(t)
+
+	var first = serve(h, idempotentRequest("key-1", `{"amount":"5"}`))
+	if first.Code != http.StatusCreated {
+		t.Fatalf("first request answered %d", first.Code)
+	}
+
+	var retry = serve(h, idempotentRequest("key-1", `{"amount":"5"}`))
+	if retry.Code != http.StatusCreated || retry.Header().Get(IdempotentReplayedHeader) != "true" || retry.Body.String() != first.Body.String() {
+		t.Fatalf("retry answered %d %q with headers %v, want the first response replayed", retry.Code, retry.Body, retry.Header())
+	}
+
+	if w := serve(h, idempotentRequest("key-1", `{"amount":"6"}`)); w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("another body with the key answered %d, want 422", w.Code)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("handler called %d times, want once", calls.Load())
+	}
+}
+
+func TestIdempotencyBodyLimit(t *testing.T) {
+	h, calls := idempotent(t)
+
+	var r = api.WithBodyLimit(idempotentRequest("key-1", `{"amount":"`+strings.Repeat("9", 64)+`"}`), 16)
+	var w = serve(h, r)
+	if w.Code != http.StatusRequestEntityTooLarge || !strings.Contains(w.Body.String(), api.CodeBodyTooLarge) {
+		t.Fatalf("oversized body answered %d %s, want a 413 %s", w.Code, w.Body, api.CodeBodyTooLarge)
+	}
+	if calls.Load() != 0 {
+		t.Fatal("handler called with an oversized body")
+	}
+
+	// The key was not reserved by the refused request.
+	if w := serve(h, idempotentRequest("key-1", `{"amount":"5"}`)); w.Code != http.StatusCreated || w.Header().Get(IdempotentReplayedHeader) != "" {
+		t.Fatalf("request after the oversized one answered %d, replayed %q", w.Code, w.Header().Get(IdempotentReplayedHeader))
+	}
+}
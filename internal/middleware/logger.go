@@ -0,0 +1,19 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/RashedMaaitah/goapi/internal/logging"
+	log "github.com/sirupsen/logrus"
+)
+
+// WithLogger makes logger available to the rest of the chain through
+// logging.FromContext.
+func WithLogger(logger *log.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var entry *log.Entry = log.NewEntry(logger)
+			next.ServeHTTP(w, r.WithContext(logging.NewContext(r.Context(), entry)))
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/config"
+)
+
+// MaintenanceMode is whether the API is down for maintenance, and what its
+// answers say meanwhile. It is safe for concurrent use.
+type MaintenanceMode struct {
+	mu         sync.RWMutex
+	state      MaintenanceState
+	retryAfter time.Duration
+}
+
+// MaintenanceState is the maintenance mode since Since, as By, an admin,
+// set it; By is empty for the one of the config.
+type MaintenanceState struct {
+	Enabled    bool
+	Message    string
+	RetryAfter time.Duration
+	Since      time.Time
+	By         string
+}
+
+// NewMaintenanceMode returns the MaintenanceMode cfg starts in.
+func NewMaintenanceMode(cfg config.MaintenanceConfig) *MaintenanceMode {
+	return &MaintenanceMode{
+		state: MaintenanceState{
+			Enabled:    cfg.Enabled,
+			Message:    cfg.Message,
+			RetryAfter: cfg.RetryAfter.Duration(),
+			Since:      time.Now(),
+		},
+		retryAfter: cfg.RetryAfter.Duration(),
+	}
+}
+
+// Reconfigure applies cfg, reloaded: the state it says, and its RetryAfter
+// as that of Set.
+func (m *MaintenanceMode) Reconfigure(cfg config.MaintenanceConfig) MaintenanceState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.retryAfter = cfg.RetryAfter.Duration()
+	m.state = MaintenanceState{
+		Enabled:    cfg.Enabled,
+		Message:    cfg.Message,
+		RetryAfter: m.retryAfter,
+		Since:      time.Now(),
+	}
+	return m.state
+}
+
+func (m *MaintenanceMode) State() MaintenanceState {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.state
+}
+
+func (m *MaintenanceMode) Enabled() bool {
+	return m.State().Enabled
+}
+
+// Set turns maintenance mode on or off as by says, with the RetryAfter
+// of the config when retryAfter is 0, and returns the new state.
+func (m *MaintenanceMode) Set(enabled bool, message string, retryAfter time.Duration, by string) MaintenanceState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if retryAfter <= 0 {
+		retryAfter = m.retryAfter
+	}
+	m.state = MaintenanceState{
+		Enabled:    enabled,
+		Message:    message,
+		RetryAfter: retryAfter,
+		Since:      time.Now(),
+		By:         by,
+	}
+	return m.state
+}
+
+// Maintenance answers every request with a 503 and a Retry-After while mode
+// is enabled. The routes that keep answering are mounted without it.
+func Maintenance(mode *MaintenanceMode) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var state MaintenanceState = mode.State()
+			if !state.Enabled {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("Retry-After", strconv.Itoa(max(1, ceilSeconds(state.RetryAfter))))
+			api.MaintenanceErrorHandler(w, state.Message)
+		})
+	}
+}
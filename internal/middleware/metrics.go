@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/internal/metrics"
+	"github.com/go-chi/chi"
+	chimiddle "github.com/go-chi/chi/middleware"
+)
+
+// Metrics records the duration and status of every request, labeled by the
+// chi route pattern rather than the raw path to keep cardinality bounded.
+// Requests to skipPath (the metrics endpoint itself) are not recorded.
+func Metrics(m *metrics.Metrics, skipPath string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == skipPath {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			var start = time.Now()
+			var ww chimiddle.WrapResponseWriter = chimiddle.NewWrapResponseWriter(w, r.ProtoMajor)
+
+			m.RequestsInFlight.Add(1)
+			defer m.RequestsInFlight.Add(-1)
+
+			next.ServeHTTP(ww, r)
+
+			var status int = ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			var route string = "unmatched"
+			if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+				route = rctx.RoutePattern()
+			}
+
+			var code string = strconv.Itoa(status)
+			m.RequestDuration.Observe(time.Since(start).Seconds(), route, r.Method, code)
+			m.Requests.Inc(route, r.Method, code)
+		})
+	}
+}
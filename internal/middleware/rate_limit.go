@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/config"
+	"github.com/RashedMaaitah/goapi/internal/logging"
+	"github.com/RashedMaaitah/goapi/internal/ratelimit"
+)
+
+// RateLimit rejects requests with a 429 once the client IP has used up its
+// bucket in limiter, at the limits rate_limit of live sets at the time, and
+// lets every request through while it is disabled. X-Forwarded-For is only
+// trusted when trust_proxy is set, otherwise any client could pick its own
+// key.
+func RateLimit(limiter *ratelimit.Limiter, live *config.Live) func(http.Handler) http.Handler {
+	return ipRateLimit(limiter, live, func(cfg config.RateLimitConfig) (float64, int) {
+		return cfg.RequestsPerSecond, cfg.Burst
+	})
+}
+
+// AdminRateLimit is RateLimit at the limits of rate_limit.admin, which only
+// applies while rate_limit is enabled and admin.requests_per_second isn't 0.
+func AdminRateLimit(limiter *ratelimit.Limiter, live *config.Live) func(http.Handler) http.Handler {
+	return ipRateLimit(limiter, live, func(cfg config.RateLimitConfig) (float64, int) {
+		return cfg.Admin.RequestsPerSecond, cfg.Admin.Burst
+	})
+}
+
+// ipRateLimit limits the requests per client IP to the rate and burst that
+// limits returns of the config in effect, none while the rate is 0.
+func ipRateLimit(limiter *ratelimit.Limiter, live *config.Live, limits func(config.RateLimitConfig) (float64, int)) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var cfg config.RateLimitConfig = live.Get().RateLimit
+			rate, burst := limits(cfg)
+			if !cfg.Enabled || rate <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			limiter.SetLimits(rate, burst)
+
+			var ip string = ClientIP(r, cfg.TrustProxy)
+
+			if !limiter.Allow(ip) {
+				logging.FromContext(r.Context()).Warnf("Rate limit exceeded for %s", ip)
+				api.TooManyRequestsHandler(w)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// UserRateLimit applies the quota rate_limit.per_user of live sets at the
+// time from limiter, keyed on the user resolved by Authorization, and
+// reports it in X-RateLimit-* headers. It must be mounted after
+// Authorization.
+func UserRateLimit(limiter *ratelimit.Limiter, live *config.Live) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var quota config.UserRateLimitConfig = live.Get().RateLimit.PerUser
+			var loginDetails = GetLoginDetails(r.Context())
+			if !quota.Enabled || loginDetails == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			limiter.SetLimits(float64(quota.Requests)/quota.Window.Duration().Seconds(), quota.Requests)
+
+			var res ratelimit.Result = limiter.Take(loginDetails.Username)
+
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(res.Limit))
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			w.Header().Set("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+
+			if !res.Allowed {
+				logging.FromContext(r.Context()).Warnf("Rate limit exceeded for user %s", loginDetails.Username)
+				w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+				api.TooManyRequestsHandler(w)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// ClientIP returns the address of the client that sent r. Behind a trusted
+// proxy that is the left-most X-Forwarded-For entry.
+func ClientIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			var first, _, _ = strings.Cut(forwarded, ",")
+			if ip := strings.TrimSpace(first); ip != "" {
+				return ip
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
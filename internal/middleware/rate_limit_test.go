@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/config"
+	"github.com/RashedMaaitah/goapi/internal/ratelimit"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func rateLimited(t *testing.T, configure func(cfg *config.RateLimitConfig)) (http.Handler, *fakeClock) {
+	t.Helper()
+
+	var cfg config.Config = config.Default()
+	cfg.RateLimit.Enabled = true
+	cfg.RateLimit.RequestsPerSecond = 1
+	cfg.RateLimit.Burst = 2
+	if configure != nil {
+		configure(&cfg.RateLimit)
+	}
+
+	var clock = &fakeClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+	var limiter = ratelimit.New(1, 2, clock)
+	var ok = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	return RateLimit(limiter, config.NewLive(&cfg))(ok), clock
+}
+
+func serve(h http.Handler, r *http.Request) *httptest.ResponseRecorder {
+	var w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestRateLimitAnswers429(t *testing.T) {
+	h, clock := rateLimited(t, nil)
+
+	for i := 0; i < 2; i++ {
+		if w := serve(h, httptest.NewRequest(http.MethodGet, "/", nil)); w.Code != http.StatusOK {
+			t.Fatalf("request %d of the burst answered %d", i+1, w.Code)
+		}
+	}
+
+	var w = serve(h, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("request past the burst answered %d, want 429", w.Code)
+	}
+	var apiErr api.Error
+	if err := json.Unmarshal(w.Body.Bytes(), &apiErr); err != nil {
+		t.Fatalf("decoding %s: %v", w.Body, err)
+	}
+	if apiErr.Code != api.CodeRateLimited {
+		t.Errorf("code = %q, want %q", apiErr.Code, api.CodeRateLimited)
+	}
+
+	clock.now = clock.now.Add(time.Second)
+	if w := serve(h, httptest.NewRequest(http.MethodGet, "/", nil)); w.Code != http.StatusOK {
+		t.Fatalf("request after the refill answered %d", w.Code)
+	}
+}
+
+func TestRateLimitForwardedFor(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		trustProxy bool
+		want       int
+	}{
+		{"ignored by default", false, http.StatusTooManyRequests},
+		{"trusted behind a proxy", true, http.StatusOK},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := rateLimited(t, func(cfg *config.RateLimitConfig) { cfg.TrustProxy = tt.trustProxy })
+
+			// The same peer, claiming to forward a different client each
+			// time.
+			var code int
+			for _, client := range []string{"203.0.113.1", "203.0.113.2", "203.0.113.3"} {
+				var r = httptest.NewRequest(http.MethodGet, "/", nil)
+				r.Header.Set("X-Forwarded-For", client+", 10.0.0.1")
+				code = serve(h, r).Code
+			}
+			if code != tt.want {
+				t.Errorf("third client answered %d, want %d", code, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateLimitDisabled(t *testing.T) {
+	h, _ := rateLimited(t, func(cfg *config.RateLimitConfig) { cfg.Enabled = false })
+
+	for i := 0; i < 5; i++ {
+		if w := serve(h, httptest.NewRequest(http.MethodGet, "/", nil)); w.Code != http.StatusOK {
+			t.Fatalf("request %d answered %d while disabled", i+1, w.Code)
+		}
+	}
+}
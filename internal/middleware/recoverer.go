@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"net/http"
+	"runtime/debug"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/logging"
+	chimiddle "github.com/go-chi/chi/middleware"
+)
+
+// Recoverer turns a panicking handler into a logged 500 response with the
+// standard error body. If the handler had already started writing the
+// response it is left as is, since the status can no longer change.
+func Recoverer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ww chimiddle.WrapResponseWriter = chimiddle.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+
+			// http.ErrAbortHandler is the documented way to abort a
+			// response, let net/http deal with it.
+			if rec == http.ErrAbortHandler {
+				panic(rec)
+			}
+
+			logging.FromContext(r.Context()).
+				WithField("stack", string(debug.Stack())).
+				Errorf("panic: %v", rec)
+
+			if ww.Status() == 0 && ww.BytesWritten() == 0 {
+				api.InternalErrorHandler(ww)
+			}
+		}()
+
+		next.ServeHTTP(ww, r)
+	})
+}
@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/go-chi/chi"
+	log "github.com/sirupsen/logrus"
+)
+
+// panicking is a router behind Recoverer mounting handler on /panic.
+func panicking(handler http.HandlerFunc) http.Handler {
+	var logger = log.New()
+	logger.SetOutput(io.Discard)
+
+	var r = chi.NewRouter()
+	r.Use(WithLogger(logger), Recoverer)
+	r.Get("/panic", handler)
+	return r
+}
+
+func TestRecovererAnswers500(t *testing.T) {
+	var h = panicking(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+
+	var w = serve(h, httptest.NewRequest(http.MethodGet, "/panic", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("answered %d, want 500", w.Code)
+	}
+	var apiErr api.Error
+	if err := json.Unmarshal(w.Body.Bytes(), &apiErr); err != nil || apiErr.Code != api.CodeInternalError || apiErr.Message == "" {
+		t.Errorf("body = %s, want the code %s with a message", w.Body, api.CodeInternalError)
+	}
+}
+
+func TestRecovererKeepsStartedResponse(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		handler http.HandlerFunc
+		body    string
+	}{
+		{"after WriteHeader", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusAccepted)
+			panic("boom")
+		}, ""},
+		{"after Write", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusAccepted)
+			w.Write([]byte("partial"))
+			panic("boom")
+		}, "partial"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var w = serve(panicking(tt.handler), httptest.NewRequest(http.MethodGet, "/panic", nil))
+			if w.Code != http.StatusAccepted || w.Body.String() != tt.body {
+				t.Errorf("answered %d %q, want the 202 %q the handler started", w.Code, w.Body, tt.body)
+			}
+		})
+	}
+}
+
+func TestRecovererRepanicsAbortHandler(t *testing.T) {
+	var h = panicking(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	})
+
+	var w = httptest.NewRecorder()
+	defer func() {
+		if rec := recover(); rec != http.ErrAbortHandler {
+			t.Errorf("recovered %v, want http.ErrAbortHandler", rec)
+		}
+		if w.Body.Len() != 0 {
+			t.Errorf("body = %s, want none", w.Body)
+		}
+	}()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/panic", nil))
+}
+
+// An aborted response is cut short, instead of answered with a 500.
+func TestRecovererAbortsConnection(t *testing.T) {
+	var server = httptest.NewServer(panicking(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	defer server.Close()
+
+	resp, err := server.Client().Get(server.URL + "/panic")
+	if err == nil {
+		resp.Body.Close()
+		t.Fatalf("answered %d, want the connection closed", resp.StatusCode)
+	}
+}
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/logging"
+)
+
+type requestIDKey struct{}
+
+const maxRequestIDLength = 128
+
+// RequestID tags every request with an ID, reusing a well-formed incoming
+// X-Request-ID header or generating a new one. The ID is stored in the
+// request context, added to the request logger and echoed in the response
+// header, where api.writeError picks it up for error bodies.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var id string = r.Header.Get(api.RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		w.Header().Set(api.RequestIDHeader, id)
+
+		var ctx = context.WithValue(r.Context(), requestIDKey{}, id)
+		ctx = logging.NewContext(ctx, logging.FromContext(ctx).WithField("request_id", id))
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// GetRequestID returns the ID assigned to the request by RequestID.
+func GetRequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+func newRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// validRequestID only accepts short IDs made of printable ASCII, so client
+// supplied values can't inject anything into logs or headers.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
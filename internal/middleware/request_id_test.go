@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/RashedMaaitah/goapi/api"
+)
+
+var generatedRequestID = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// requestID returns the ID RequestID answers a request with the header id,
+// none when "", after checking the handler saw the same.
+func requestID(t *testing.T, id string) string {
+	t.Helper()
+
+	var seen string
+	var h = RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = GetRequestID(r.Context())
+	}))
+	var r = httptest.NewRequest(http.MethodGet, "/", nil)
+	if id != "" {
+		r.Header.Set(api.RequestIDHeader, id)
+	}
+
+	var answered string = serve(h, r).Header().Get(api.RequestIDHeader)
+	if answered != seen {
+		t.Errorf("answered the ID %q, the handler saw %q", answered, seen)
+	}
+	return answered
+}
+
+func TestRequestIDPassesThrough(t *testing.T) {
+	for _, id := range []string{"abc-123", "trace:00f067aa0ba902b7", strings.Repeat("a", maxRequestIDLength)} {
+		if got := requestID(t, id); got != id {
+			t.Errorf("ID of %q = %q, want it kept", id, got)
+		}
+	}
+}
+
+func TestRequestIDGenerated(t *testing.T) {
+	var first, second string = requestID(t, ""), requestID(t, "")
+	if !generatedRequestID.MatchString(first) || !generatedRequestID.MatchString(second) {
+		t.Errorf("IDs = %q and %q, want 32 hex digits", first, second)
+	}
+	if first == second {
+		t.Errorf("two requests got the ID %q", first)
+	}
+}
+
+func TestRequestIDRejectsInvalid(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		id   string
+	}{
+		{"too long", strings.Repeat("a", maxRequestIDLength+1)},
+		{"space", "abc 123"},
+		{"newline", "abc\n123"},
+		{"control", "abc\x00123"},
+		{"not ASCII", "abcé123"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := requestID(t, tt.id); !generatedRequestID.MatchString(got) {
+				t.Errorf("ID = %q, want a generated one instead", got)
+			}
+		})
+	}
+}
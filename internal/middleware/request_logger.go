@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/internal/logging"
+	chimiddle "github.com/go-chi/chi/middleware"
+	log "github.com/sirupsen/logrus"
+)
+
+const redacted = "REDACTED"
+
+// sensitiveParams are query parameters whose values never reach the logs.
+var sensitiveParams = []string{"token", "access_token", "auth", "password"}
+
+// RequestLogger logs one line per request with its method, path, status,
+// response size and duration. Successful responses are only logged for a
+// sampleRate fraction of requests, errors are always logged. The values of
+// the sensitiveHeaders and of token-like query parameters are redacted.
+func RequestLogger(sampleRate float64, sensitiveHeaders ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var start = time.Now()
+			var ww chimiddle.WrapResponseWriter = chimiddle.NewWrapResponseWriter(w, r.ProtoMajor)
+
+			next.ServeHTTP(ww, r)
+
+			var status int = ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			if status < 400 && sampleRate < 1 && rand.Float64() >= sampleRate {
+				return
+			}
+
+			var logger = logging.FromContext(r.Context())
+			var fields = log.Fields{
+				"method":      r.Method,
+				"path":        redactURL(r.URL),
+				"remote_addr": r.RemoteAddr,
+				"status":      status,
+				"bytes":       ww.BytesWritten(),
+				"duration":    time.Since(start).String(),
+			}
+
+			if logger.Logger.IsLevelEnabled(log.DebugLevel) {
+				fields["headers"] = redactHeaders(r.Header, sensitiveHeaders)
+			}
+
+			var entry = logger.WithFields(fields)
+			switch {
+			case status >= 500:
+				entry.Error("request completed")
+			case status >= 400:
+				entry.Warn("request completed")
+			default:
+				entry.Info("request completed")
+			}
+		})
+	}
+}
+
+func redactURL(u *url.URL) string {
+	if u.RawQuery == "" {
+		return u.Path
+	}
+
+	var query url.Values = u.Query()
+	for key := range query {
+		if isSensitiveParam(key) {
+			query[key] = []string{redacted}
+		}
+	}
+
+	return u.Path + "?" + query.Encode()
+}
+
+func isSensitiveParam(key string) bool {
+	for _, param := range sensitiveParams {
+		if strings.EqualFold(key, param) {
+			return true
+		}
+	}
+	return false
+}
+
+func redactHeaders(header http.Header, sensitive []string) map[string]string {
+	var out = make(map[string]string, len(header))
+	for name := range header {
+		out[name] = header.Get(name)
+	}
+
+	for _, name := range append(sensitive, "Authorization", "Cookie") {
+		var canonical = http.CanonicalHeaderKey(name)
+		if _, ok := out[canonical]; ok {
+			out[canonical] = redacted
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/logging"
+)
+
+// RequireRole only lets users with role through. It reads the user stored
+// by Authorization, which must run first.
+func RequireRole(role string) func(http.Handler) http.Handler {
+	var forbidden = fmt.Errorf("This requires the %s role.", role)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var logger = logging.FromContext(r.Context())
+			var loginDetails = GetLoginDetails(r.Context())
+
+			if loginDetails == nil {
+				logger.Error(errors.New("RequireRole used without Authorization"))
+				api.UnauthorizedErrorHandler(w, api.CodeInvalidToken, UnAuthorizedError)
+				return
+			}
+
+			if loginDetails.Role != role {
+				logger.Warnf("%s has role %q, %q required", loginDetails.Username, loginDetails.Role, role)
+				api.ForbiddenErrorHandler(w, api.CodeInsufficientRole, forbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireOwnerOrRole lets users through to their own resources, those of
+// the {username} in the path, and users with role to those of anyone. It
+// reads the user stored by Authorization, which must run first.
+func RequireOwnerOrRole(role string) func(http.Handler) http.Handler {
+	var forbidden = fmt.Errorf("The resources of other users require the %s role.", role)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var logger = logging.FromContext(r.Context())
+			var loginDetails = GetLoginDetails(r.Context())
+
+			if loginDetails == nil {
+				logger.Error(errors.New("RequireOwnerOrRole used without Authorization"))
+				api.UnauthorizedErrorHandler(w, api.CodeInvalidToken, UnAuthorizedError)
+				return
+			}
+
+			if owner := PathUsername(r); loginDetails.Username != owner && loginDetails.Role != role {
+				logger.Warnf("%s has role %q, %q required for the resources of %s", loginDetails.Username, loginDetails.Role, role, owner)
+				api.ForbiddenErrorHandler(w, api.CodeInsufficientRole, forbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RashedMaaitah/goapi/internal/tools"
+)
+
+func TestRequireRole(t *testing.T) {
+	var h http.Handler = RequireRole(tools.RoleAdmin)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for _, tt := range []struct {
+		name         string
+		loginDetails *tools.LoginDetails
+		want         int
+	}{
+		{"allowed", &tools.LoginDetails{Username: "admin", Role: tools.RoleAdmin}, http.StatusOK},
+		{"forbidden", &tools.LoginDetails{Username: "alex", Role: tools.RoleUser}, http.StatusForbidden},
+		{"unauthenticated", nil, http.StatusUnauthorized},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var r = httptest.NewRequest(http.MethodGet, "/admin/stats", nil)
+			if tt.loginDetails != nil {
+				r = r.WithContext(WithLoginDetails(r.Context(), tt.loginDetails))
+			}
+
+			if w := serve(h, r); w.Code != tt.want {
+				t.Errorf("answered %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/logging"
+)
+
+// RequireScope only lets tokens granting scope through, answering others
+// with a 403 naming it. It reads the user stored by Authorization, which
+// must run first.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var logger = logging.FromContext(r.Context())
+			var loginDetails = GetLoginDetails(r.Context())
+
+			if loginDetails == nil {
+				logger.Error(errors.New("RequireScope used without Authorization"))
+				api.UnauthorizedErrorHandler(w, api.CodeInvalidToken, UnAuthorizedError)
+				return
+			}
+
+			if !loginDetails.HasScope(scope) {
+				logger.Warnf("Token of %s grants %v, %q required", loginDetails.Username, loginDetails.Scopes, scope)
+				api.InsufficientScopeHandler(w, scope)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/RashedMaaitah/goapi/internal/config"
+)
+
+// SecurityHeaders sets the security headers of cfg on every response,
+// Strict-Transport-Security only on those sent over TLS.
+func SecurityHeaders(cfg config.SecurityHeadersConfig) func(http.Handler) http.Handler {
+	var headers = http.Header{}
+	for name, value := range map[string]string{
+		"X-Content-Type-Options":  cfg.ContentTypeOptions,
+		"X-Frame-Options":         cfg.FrameOptions,
+		"Referrer-Policy":         cfg.ReferrerPolicy,
+		"Content-Security-Policy": cfg.ContentSecurityPolicy,
+	} {
+		if value != "" {
+			headers.Set(name, value)
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for name, values := range headers {
+				w.Header()[name] = values
+			}
+			if r.TLS != nil && cfg.HSTS != "" {
+				w.Header().Set("Strict-Transport-Security", cfg.HSTS)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ContentSecurityPolicy replaces the Content-Security-Policy of responses
+// with policy, or drops it when policy is "".
+func ContentSecurityPolicy(policy string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if policy == "" {
+				w.Header().Del("Content-Security-Policy")
+			} else {
+				w.Header().Set("Content-Security-Policy", policy)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
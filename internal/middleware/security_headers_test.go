@@ -0,0 +1,91 @@
+package middleware_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RashedMaaitah/goapi/internal/apitest"
+	"github.com/RashedMaaitah/goapi/internal/config"
+	"github.com/RashedMaaitah/goapi/internal/middleware"
+)
+
+// headersOf returns the headers of the response to req.
+func headersOf(t *testing.T, s *apitest.Server, req *http.Request) http.Header {
+	t.Helper()
+	var resp = s.Do(req)
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("%s %s answered %d", req.Method, req.URL.Path, resp.StatusCode)
+	}
+	return resp.Header
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	var s = apitest.New(t)
+	var cfg config.SecurityHeadersConfig = s.Config.SecurityHeaders
+
+	for _, tt := range []struct {
+		name string
+		req  *http.Request
+		csp  string
+	}{
+		{"api", s.NewAuthedRequest("alex", http.MethodGet, "/v1/account/coins", nil), cfg.ContentSecurityPolicy},
+		{"docs", s.NewRequest(http.MethodGet, "/docs", nil), cfg.DocsContentSecurityPolicy},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var header http.Header = headersOf(t, s, tt.req)
+			for name, want := range map[string]string{
+				"X-Content-Type-Options":  "nosniff",
+				"X-Frame-Options":         "DENY",
+				"Referrer-Policy":         "no-referrer",
+				"Content-Security-Policy": tt.csp,
+			} {
+				if header.Get(name) != want {
+					t.Errorf("%s = %q, want %q", name, header.Get(name), want)
+				}
+			}
+			// Served over plain HTTP.
+			if hsts := header.Get("Strict-Transport-Security"); hsts != "" {
+				t.Errorf("Strict-Transport-Security = %q over HTTP", hsts)
+			}
+		})
+	}
+}
+
+func TestSecurityHeadersDisabled(t *testing.T) {
+	var s = apitest.New(t, apitest.WithConfig(func(cfg *config.Config) {
+		cfg.SecurityHeaders.FrameOptions = ""
+		cfg.SecurityHeaders.DocsContentSecurityPolicy = ""
+	}))
+
+	var header http.Header = headersOf(t, s, s.NewAuthedRequest("alex", http.MethodGet, "/v1/account/coins", nil))
+	if _, ok := header["X-Frame-Options"]; ok {
+		t.Errorf("X-Frame-Options = %q, want it left out", header.Get("X-Frame-Options"))
+	}
+	if header.Get("X-Content-Type-Options") != "nosniff" {
+		t.Errorf("X-Content-Type-Options = %q, want the others still set", header.Get("X-Content-Type-Options"))
+	}
+
+	if header = headersOf(t, s, s.NewRequest(http.MethodGet, "/docs", nil)); header.Get("Content-Security-Policy") != "" {
+		t.Errorf("Content-Security-Policy of the docs = %q, want it left out", header.Get("Content-Security-Policy"))
+	}
+}
+
+func TestSecurityHeadersHSTSOverTLS(t *testing.T) {
+	var cfg config.SecurityHeadersConfig = config.Default().SecurityHeaders
+	var ok = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	var server = httptest.NewTLSServer(middleware.SecurityHeaders(cfg)(ok))
+	defer server.Close()
+
+	resp, err := server.Client().Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if hsts := resp.Header.Get("Strict-Transport-Security"); hsts != cfg.HSTS {
+		t.Errorf("Strict-Transport-Security = %q over TLS, want %q", hsts, cfg.HSTS)
+	}
+}
@@ -0,0 +1,176 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/api"
+)
+
+type timeoutKey struct{}
+
+// requestTimeout is the timeout of a request, which a Timeout on its
+// route replaces.
+type requestTimeout struct {
+	timer *time.Timer
+	start time.Time
+}
+
+// Timeout cancels the context of requests still running after d, with
+// context.DeadlineExceeded as the cause, so the database calls they wait on
+// give up, and answers them with a 504 unless they already started their
+// response. What they write after that is dropped. Long-lived requests such
+// as streams lift it with StopTimeout.
+//
+// A Timeout on the routes of a request that already has one doesn't add
+// another but replaces its d, counted from the start of the first, so a
+// route group may get longer than the others.
+func Timeout(d time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if timeout, ok := r.Context().Value(timeoutKey{}).(*requestTimeout); ok {
+				// Not revived once passed or lifted.
+				if timeout.timer.Stop() {
+					timeout.timer.Reset(d - time.Since(timeout.start))
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx, cancel := context.WithCancelCause(r.Context())
+			defer cancel(nil)
+
+			var tw = &timeoutWriter{ResponseWriter: w, header: w.Header().Clone()}
+			var timeout = &requestTimeout{start: time.Now()}
+			timeout.timer = time.AfterFunc(d, func() { tw.timeout(cancel) })
+			defer tw.finish()
+			defer timeout.timer.Stop()
+
+			next.ServeHTTP(tw, r.WithContext(context.WithValue(ctx, timeoutKey{}, timeout)))
+		})
+	}
+}
+
+// StopTimeout lifts the timeout Timeout set on the request of ctx, if it
+// hasn't passed yet.
+func StopTimeout(ctx context.Context) {
+	if timeout, ok := ctx.Value(timeoutKey{}).(*requestTimeout); ok {
+		timeout.timer.Stop()
+	}
+}
+
+// WriteTimeout sets the write deadline of the connection of requests d
+// from now, in place of that of the http.Server.
+func WriteTimeout(d time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.NewResponseController(w).SetWriteDeadline(time.Now().Add(d))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// timeoutWriter lets the timeout answer a request its handler is still
+// working on. The handler gets headers of its own until it writes them, as
+// the 504 may be written at the same time.
+type timeoutWriter struct {
+	http.ResponseWriter
+	header http.Header
+
+	mu       sync.Mutex
+	wrote    bool
+	timedOut bool
+	finished bool
+}
+
+func (w *timeoutWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *timeoutWriter) WriteHeader(status int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.timedOut || w.wrote {
+		return
+	}
+	w.writeHeader(status)
+}
+
+// writeHeader sends the headers of the handler, those it deleted left out,
+// with status. w.mu must be held.
+func (w *timeoutWriter) writeHeader(status int) {
+	var header http.Header = w.ResponseWriter.Header()
+	for name := range header {
+		if _, ok := w.header[name]; !ok {
+			delete(header, name)
+		}
+	}
+	for name, values := range w.header {
+		header[name] = values
+	}
+	if status >= http.StatusOK {
+		w.wrote = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *timeoutWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if !w.wrote {
+		w.writeHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// FlushError is what http.ResponseController calls to flush.
+func (w *timeoutWriter) FlushError() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.timedOut {
+		return http.ErrHandlerTimeout
+	}
+	if !w.wrote {
+		w.writeHeader(http.StatusOK)
+	}
+	return http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *timeoutWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// timeout cancels the request and answers it, unless its handler already
+// returned or started the response.
+func (w *timeoutWriter) timeout(cancel context.CancelCauseFunc) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.finished {
+		return
+	}
+	cancel(context.DeadlineExceeded)
+	if w.wrote {
+		return
+	}
+	w.timedOut = true
+	api.GatewayTimeoutHandler(w.ResponseWriter)
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// finish waits for a timeout under way, and keeps any other from touching
+// the response once the handler returned.
+func (w *timeoutWriter) finish() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.finished = true
+}
@@ -0,0 +1,148 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/tools"
+	log "github.com/sirupsen/logrus"
+)
+
+// waiting waits for the request to be canceled, and sends its cause.
+func waiting(causes chan<- error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		causes <- context.Cause(r.Context())
+	})
+}
+
+func TestTimeoutAnswers504(t *testing.T) {
+	var causes = make(chan error, 1)
+	var w = serve(Timeout(10*time.Millisecond)(waiting(causes)), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if w.Code != http.StatusGatewayTimeout {
+		t.Fatalf("answered %d, want 504", w.Code)
+	}
+	var apiErr api.Error
+	if err := json.Unmarshal(w.Body.Bytes(), &apiErr); err != nil || apiErr.Code != api.CodeTimeout {
+		t.Errorf("body = %s, want the code %s", w.Body, api.CodeTimeout)
+	}
+	if cause := <-causes; !errors.Is(cause, context.DeadlineExceeded) {
+		t.Errorf("cause = %v, want context.DeadlineExceeded", cause)
+	}
+}
+
+func TestTimeoutKeepsStartedResponse(t *testing.T) {
+	var h = Timeout(10 * time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		<-r.Context().Done()
+		if _, err := w.Write([]byte("late")); err != nil {
+			t.Errorf("write after the timeout: %v", err)
+		}
+	}))
+
+	var w = serve(h, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusAccepted || w.Body.String() != "late" {
+		t.Errorf("answered %d %q, want the 202 the handler started", w.Code, w.Body)
+	}
+}
+
+func TestTimeoutKeepsHeadersDeleted(t *testing.T) {
+	var h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Before", "1")
+		Timeout(time.Second)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Del("X-Before")
+			w.Header().Set("X-After", "1")
+			w.WriteHeader(http.StatusOK)
+		})).ServeHTTP(w, r)
+	})
+
+	var w = serve(h, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Header().Get("X-Before") != "" || w.Header().Get("X-After") != "1" {
+		t.Errorf("headers = %v, want X-After alone", w.Header())
+	}
+}
+
+func TestTimeoutDropsLateWrites(t *testing.T) {
+	var h = Timeout(10 * time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		w.Header().Set("X-Late", "1")
+		if _, err := w.Write([]byte("late")); !errors.Is(err, http.ErrHandlerTimeout) {
+			t.Errorf("write after the 504 = %v, want http.ErrHandlerTimeout", err)
+		}
+	}))
+
+	var w = serve(h, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusGatewayTimeout || w.Header().Get("X-Late") != "" {
+		t.Errorf("answered %d with %v, want the 504 alone", w.Code, w.Header())
+	}
+}
+
+func TestRouteTimeoutReplacesRequestTimeout(t *testing.T) {
+	var h http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(50 * time.Millisecond):
+			w.WriteHeader(http.StatusOK)
+		case <-r.Context().Done():
+		}
+	})
+
+	for _, tt := range []struct {
+		name    string
+		handler http.Handler
+		want    int
+	}{
+		{"longer", Timeout(10 * time.Millisecond)(Timeout(time.Second)(h)), http.StatusOK},
+		{"shorter", Timeout(time.Second)(Timeout(10 * time.Millisecond)(h)), http.StatusGatewayTimeout},
+		{"lifted", Timeout(10 * time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			StopTimeout(r.Context())
+			h.ServeHTTP(w, r)
+		})), http.StatusOK},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := serve(tt.handler, httptest.NewRequest(http.MethodGet, "/", nil)); w.Code != tt.want {
+				t.Errorf("answered %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimeoutLeaksNoGoroutines(t *testing.T) {
+	var logger = log.New()
+	logger.SetOutput(io.Discard)
+	// A database that never answers in time.
+	var database tools.Database = tools.NewMockDB(logger, tools.WithLatency(time.Hour))
+	var h http.Handler = Timeout(10 * time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := database.GetUserCoins(r.Context(), "alex"); err != nil {
+			api.WriteErr(w, err)
+		}
+	}))
+
+	var before int = runtime.NumGoroutine()
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Go(func() {
+			if w := serve(h, httptest.NewRequest(http.MethodGet, "/", nil)); w.Code != http.StatusGatewayTimeout {
+				t.Errorf("answered %d, want 504", w.Code)
+			}
+		})
+	}
+	wg.Wait()
+
+	var deadline = time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d goroutines left running, %d before the requests", runtime.NumGoroutine(), before)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
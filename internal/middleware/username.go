@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/go-chi/chi"
+)
+
+// PathUsername returns the {username} in the path of r, decoded and
+// normalized.
+func PathUsername(r *http.Request) string {
+	var username string = chi.URLParam(r, "username")
+	if decoded, err := url.PathUnescape(username); err == nil {
+		username = decoded
+	}
+	return api.NormalizeUsername(username)
+}
+
+// ValidPathUsername answers 400 to requests whose {username} isn't a valid
+// one, before the database is asked about it.
+func ValidPathUsername(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if message := api.UsernameViolation("username", PathUsername(r)); message != "" {
+			api.ValidationErrorHandler(w, []api.Violation{{Field: "username", Rule: "username", Message: message}})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
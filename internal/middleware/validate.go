@@ -0,0 +1,307 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/openapi"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/legacy"
+)
+
+var validationOptions = &openapi3filter.Options{
+	// Bodies are checked by validateBody, which matches field names in any
+	// case like encoding/json does.
+	ExcludeRequestBody: true,
+	MultiError:         true,
+	// Authorization runs after validation and answers 401 itself.
+	AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+}
+
+// ValidateRequest checks query parameters and JSON bodies against the
+// operation doc documents for the route, and answers 400 with every
+// violation instead of calling next. Requests doc does not know, which chi
+// answers with 404 or 405, are passed on. Paths missing from doc are also
+// tried under aliasPrefix, so legacy aliases are checked like the routes
+// they stand for. Unknown query parameters are violations under the
+// StrictQuery of the api.Settings of the request.
+func ValidateRequest(doc *openapi3.T, aliasPrefix string) (func(http.Handler) http.Handler, error) {
+	router, err := legacy.NewRouter(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// openapi3filter may close the body of the request it checks,
+			// which validateBody reads instead.
+			var req *http.Request = r.WithContext(r.Context())
+			req.Body = http.NoBody
+
+			route, params, err := router.FindRoute(req)
+			if err != nil && aliasPrefix != "" && !strings.HasPrefix(r.URL.Path, aliasPrefix+"/") {
+				var alias url.URL = *r.URL
+				alias.Path = aliasPrefix + r.URL.Path
+				req.URL = &alias
+				route, params, err = router.FindRoute(req)
+			}
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			var violations []api.Violation
+			if api.SettingsOf(r).StrictQuery {
+				violations = unknownQuery(route, r)
+			}
+			req.URL = normalizeQuery(route, req.URL)
+
+			var input = &openapi3filter.RequestValidationInput{
+				Request:    req,
+				PathParams: params,
+				Route:      route,
+				Options:    validationOptions,
+			}
+			err = openapi3filter.ValidateRequest(r.Context(), input)
+			violations = append(violations, violationsOf(err)...)
+
+			if body := route.Operation.RequestBody; body != nil && body.Value != nil && route.Operation.Extensions[openapi.StreamedBody] == nil {
+				violations = append(violations, validateBody(r, body.Value)...)
+			}
+
+			if len(violations) > 0 {
+				api.ValidationErrorHandler(w, violations)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}, nil
+}
+
+// unknownQuery reports the query parameters the operation does not take.
+// Names match in any case, as gorilla/schema decodes them.
+func unknownQuery(route *routers.Route, r *http.Request) []api.Violation {
+	var known = map[string]bool{}
+	for _, parameters := range []openapi3.Parameters{route.PathItem.Parameters, route.Operation.Parameters} {
+		for _, parameter := range parameters {
+			if parameter.Value != nil && parameter.Value.In == openapi3.ParameterInQuery {
+				known[strings.ToLower(parameter.Value.Name)] = true
+			}
+		}
+	}
+
+	var names []string
+	for name := range r.URL.Query() {
+		if !known[strings.ToLower(name)] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var violations []api.Violation
+	for _, name := range names {
+		violations = append(violations, api.Violation{Field: name, Rule: "unknown", Message: "Unknown query parameter."})
+	}
+	return violations
+}
+
+// normalizeQuery returns u with the usernames of its query normalized, as
+// the handlers do before validating them.
+func normalizeQuery(route *routers.Route, u *url.URL) *url.URL {
+	var query url.Values = u.Query()
+	for _, parameters := range []openapi3.Parameters{route.PathItem.Parameters, route.Operation.Parameters} {
+		for _, parameter := range parameters {
+			if parameter.Value == nil || parameter.Value.In != openapi3.ParameterInQuery || !normalizesUsername(parameter.Value.Schema) {
+				continue
+			}
+			for i, value := range query[parameter.Value.Name] {
+				query[parameter.Value.Name][i] = api.NormalizeUsername(value)
+			}
+		}
+	}
+
+	var normalized url.URL = *u
+	normalized.RawQuery = query.Encode()
+	return &normalized
+}
+
+func normalizesUsername(schema *openapi3.SchemaRef) bool {
+	return schema != nil && schema.Value != nil && schema.Value.Extensions[openapi.NormalizedUsername] != nil
+}
+
+// validateBody checks a JSON body against the schema of the operation and
+// leaves r.Body readable by the handler. Bodies of another media type are
+// left to the handler, which answers 415.
+func validateBody(r *http.Request, body *openapi3.RequestBody) []api.Violation {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		return nil
+	}
+
+	var content *openapi3.MediaType = body.Content.Get(mediaType)
+	if content == nil || content.Schema == nil || content.Schema.Value == nil {
+		return nil
+	}
+
+	// Larger bodies are passed on unchecked, the handler answers 413 or,
+	// on a route allowing more, reads them on.
+	var data []byte
+	var limit int64 = api.BodyLimit(r)
+	data, err = io.ReadAll(io.LimitReader(r.Body, limit+1))
+	if err != nil || int64(len(data)) > limit {
+		r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(data), r.Body))
+		return nil
+	}
+	r.Body = io.NopCloser(bytes.NewReader(data))
+
+	if len(bytes.TrimSpace(data)) == 0 {
+		if body.Required {
+			return []api.Violation{{Message: "Request body is required."}}
+		}
+		return nil
+	}
+
+	var value any
+	var decoder = json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	err = decoder.Decode(&value)
+	if err != nil {
+		return []api.Violation{{Message: "Invalid JSON: " + err.Error()}}
+	}
+
+	var schema *openapi3.Schema = content.Schema.Value
+	err = schema.VisitJSON(canonicalKeys(value, schema), openapi3.MultiErrors())
+	return violationsOf(err)
+}
+
+// canonicalKeys renames object keys to the property they decode into, as
+// encoding/json matches field names in any case, and normalizes usernames
+// like api.ReadJSON.
+func canonicalKeys(value any, schema *openapi3.Schema) any {
+	if schema == nil {
+		return value
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		var renamed = make(map[string]any, len(v))
+		for key, field := range v {
+			var name string = key
+			var property *openapi3.SchemaRef = schema.Properties[key]
+			if property == nil {
+				for candidate, ref := range schema.Properties {
+					if strings.EqualFold(candidate, key) {
+						name, property = candidate, ref
+						break
+					}
+				}
+			}
+			if property == nil {
+				renamed[name] = field
+				continue
+			}
+			renamed[name] = canonicalKeys(field, property.Value)
+		}
+		return renamed
+	case []any:
+		if schema.Items == nil {
+			return v
+		}
+		for i := range v {
+			v[i] = canonicalKeys(v[i], schema.Items.Value)
+		}
+		return v
+	case string:
+		if schema.Extensions[openapi.NormalizedUsername] != nil {
+			return api.NormalizeUsername(v)
+		}
+	}
+	return value
+}
+
+// violationsOf flattens the errors of openapi3filter and of schema
+// validation into one violation each.
+func violationsOf(err error) []api.Violation {
+	if err == nil {
+		return nil
+	}
+
+	// MultiError matches errors.As for any of its errors, so the shape is
+	// taken apart by type.
+	switch e := err.(type) {
+	case openapi3.MultiError:
+		var violations []api.Violation
+		for _, err := range e {
+			violations = append(violations, violationsOf(err)...)
+		}
+		return violations
+	case *openapi3filter.RequestError:
+		var field string
+		if e.Parameter != nil {
+			field = e.Parameter.Name
+		}
+		if e.Err == nil {
+			return []api.Violation{{Field: field, Message: sentence(e.Reason)}}
+		}
+		var schemaErr *openapi3.SchemaError
+		if errors.As(e.Err, &schemaErr) && field != "" {
+			if violation, ok := usernameViolation(field, schemaErr); ok {
+				return []api.Violation{violation}
+			}
+		}
+		var violations = violationsOf(e.Err)
+		for i := range violations {
+			if violations[i].Field == "" {
+				violations[i].Field = field
+			}
+		}
+		return violations
+	}
+
+	var schemaErr *openapi3.SchemaError
+	if errors.As(err, &schemaErr) {
+		var field string = strings.Join(schemaErr.JSONPointer(), ".")
+		if violation, ok := usernameViolation(field, schemaErr); ok {
+			return []api.Violation{violation}
+		}
+		return []api.Violation{{Field: field, Rule: schemaErr.SchemaField, Message: sentence(schemaErr.Reason)}}
+	}
+
+	return []api.Violation{{Message: sentence(err.Error())}}
+}
+
+// usernameViolation returns the violation of the username field err is
+// about, in the words of api.Validate: the pattern of usernames says what
+// they are, not what is wrong with one.
+func usernameViolation(field string, err *openapi3.SchemaError) (api.Violation, bool) {
+	username, ok := err.Value.(string)
+	if !ok || err.Schema == nil || err.Schema.Extensions[openapi.NormalizedUsername] == nil {
+		return api.Violation{}, false
+	}
+	var message string = api.UsernameViolation(field, username)
+	return api.Violation{Field: field, Rule: "username", Message: message}, message != ""
+}
+
+// sentence capitalizes the reasons of kin-openapi like the other messages
+// of the API.
+func sentence(reason string) string {
+	if reason == "" {
+		return "Invalid value."
+	}
+	reason = strings.ToUpper(reason[:1]) + reason[1:]
+	if !strings.HasSuffix(reason, ".") {
+		reason += "."
+	}
+	return reason
+}
@@ -0,0 +1,83 @@
+package middleware_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/apitest"
+	"github.com/RashedMaaitah/goapi/internal/config"
+)
+
+func TestValidateRequestCoinBalance(t *testing.T) {
+	var s = apitest.New(t)
+
+	t.Run("valid", func(t *testing.T) {
+		var req = s.NewAuthedRequest("alex", http.MethodGet, "/v1/account/coins?currency=coins&username=alex", nil)
+		apitest.Decode[api.CoinBalanceResponse](t, s.Do(req), http.StatusOK)
+	})
+
+	for _, tt := range []struct {
+		name  string
+		path  string
+		field string
+		rule  string
+	}{
+		{"unknown parameter", "/v1/account/coins?foo=1", "foo", "unknown"},
+		{"broken rule", "/v1/account/coins?username=a%20b", "username", "username"},
+		{"legacy alias", "/account/coins?foo=1", "foo", "unknown"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var req = s.NewAuthedRequest("alex", http.MethodGet, tt.path, nil)
+			var apiErr = apitest.DecodeError(t, s.Do(req), http.StatusBadRequest, api.CodeValidationFailed)
+			if len(apiErr.Violations) != 1 || apiErr.Violations[0].Field != tt.field || apiErr.Violations[0].Rule != tt.rule {
+				t.Errorf("violations = %+v, want %s of %s", apiErr.Violations, tt.rule, tt.field)
+			}
+		})
+	}
+}
+
+func TestValidateRequestBody(t *testing.T) {
+	var s = apitest.New(t)
+
+	for _, tt := range []struct {
+		name string
+		body map[string]any
+		rule string
+	}{
+		{"missing field", map[string]any{}, "required"},
+		{"wrong type", map[string]any{"amount": true}, "oneOf"},
+		{"below the minimum", map[string]any{"amount": "-3"}, "min"},
+		{"unknown field", map[string]any{"amount": "5", "extra": 1}, "properties"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var req = s.NewAuthedRequest("alex", http.MethodPost, "/v1/account/coins/deposit", tt.body)
+			var apiErr = apitest.DecodeError(t, s.Do(req), http.StatusBadRequest, api.CodeValidationFailed)
+			if len(apiErr.Violations) != 1 || apiErr.Violations[0].Rule != tt.rule {
+				t.Errorf("violations = %+v, want one of rule %s", apiErr.Violations, tt.rule)
+			}
+		})
+	}
+}
+
+func TestValidateRequestSkipsOps(t *testing.T) {
+	var s = apitest.New(t, apitest.WithConfig(func(cfg *config.Config) { cfg.Metrics.Enabled = true }))
+
+	for _, path := range []string{"/healthz?foo=1", "/metrics?foo=1"} {
+		var resp = s.Do(s.NewRequest(http.MethodGet, path, nil))
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("GET %s answered %d, want it unvalidated", path, resp.StatusCode)
+		}
+	}
+}
+
+func TestValidateRequestDisabled(t *testing.T) {
+	var s = apitest.New(t, apitest.WithConfig(func(cfg *config.Config) {
+		cfg.API.ValidateRequests = false
+		cfg.API.StrictQuery = false
+	}))
+
+	var req = s.NewAuthedRequest("alex", http.MethodGet, "/v1/account/coins?foo=1", nil)
+	apitest.Decode[api.CoinBalanceResponse](t, s.Do(req), http.StatusOK)
+}
@@ -0,0 +1,409 @@
+// Package openapi builds the OpenAPI 3 document of the API from the route
+// table in routes.go and the request and response types of package api.
+package openapi
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/config"
+	"github.com/RashedMaaitah/goapi/internal/version"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3gen"
+	"github.com/go-chi/chi"
+)
+
+const (
+	// tokenScheme is the name of the auth token security scheme. Admin
+	// routes take the same token, of a user with the admin role.
+	tokenScheme = "token"
+
+	// apiKeyScheme is the name of the API key security scheme, an
+	// alternative to the token for services.
+	apiKeyScheme = "apiKey"
+
+	jsonType = "application/json"
+	xmlType  = "application/xml"
+
+	// StreamedBody marks operations whose handler reads the body as a
+	// stream, so it is not validated up front.
+	StreamedBody = "x-streamed-body"
+
+	// NormalizedUsername marks usernames, which are normalized by
+	// api.NormalizeUsername before they are matched against their pattern.
+	NormalizedUsername = "x-normalized-username"
+)
+
+type access int
+
+const (
+	public access = iota
+	user
+	admin
+)
+
+// operation describes one route. query is a struct whose fields are the
+// query parameters, as decoded by gorilla/schema; body and response are
+// values of the JSON types, or of []byte for other content types.
+type operation struct {
+	method  string
+	path    string
+	summary string
+	access  access
+
+	query       any
+	body        any
+	bodyType    string
+	streamed    bool
+	idempotency bool
+
+	status       int
+	response     any
+	responseType string
+}
+
+// Build returns the document for the routes enabled by cfg.
+func Build(cfg *config.Config) (*openapi3.T, error) {
+	var doc = &openapi3.T{
+		OpenAPI: "3.0.3",
+		Info: &openapi3.Info{
+			Title:       "goapi",
+			Description: "Coin balances, transfers and accounts. The unversioned paths are deprecated aliases of the /v1 ones.",
+			Version:     version.Get().Version,
+		},
+		Paths: openapi3.NewPaths(),
+		Components: &openapi3.Components{
+			Schemas: openapi3.Schemas{},
+			SecuritySchemes: openapi3.SecuritySchemes{
+				tokenScheme: &openapi3.SecuritySchemeRef{
+					Value: openapi3.NewSecurityScheme().
+						WithType("http").
+						WithScheme("bearer").
+						WithDescription("The token from /v1/login, as `Authorization: Bearer <token>`."),
+				},
+				apiKeyScheme: &openapi3.SecuritySchemeRef{
+					Value: openapi3.NewSecurityScheme().
+						WithType("apiKey").
+						WithIn("header").
+						WithName(cfg.Auth.APIKeys.Header).
+						WithDescription("A key from /v1/admin/apikeys, acting as its service. The token is used when both are sent."),
+				},
+			},
+			Responses: openapi3.ResponseBodies{},
+		},
+	}
+	if doc.Info.Version == "" {
+		doc.Info.Version = "dev"
+	}
+
+	var generator = openapi3gen.NewGenerator(
+		openapi3gen.UseAllExportedFields(),
+		openapi3gen.CreateComponentSchemas(openapi3gen.ExportComponentSchemasOptions{
+			ExportComponentSchemas: true,
+			ExportTopLevelSchema:   true,
+		}),
+		openapi3gen.SchemaCustomizer(customizeSchema),
+	)
+
+	var errorSchema, err = generator.NewSchemaRefForValue(api.Error{}, doc.Components.Schemas)
+	if err != nil {
+		return nil, err
+	}
+	var code = schemaOf(errorSchema, doc.Components.Schemas).Properties["Code"].Value
+	code.Description = "Stable across releases, match on it rather than on Message."
+	for _, value := range api.Codes {
+		code.Enum = append(code.Enum, value)
+	}
+	doc.Components.Responses["Error"] = &openapi3.ResponseRef{
+		Value: openapi3.NewResponse().
+			WithDescription("The request failed, see Code and Message.").
+			WithContent(openapi3.NewContentWithSchemaRef(errorSchema, []string{jsonType, xmlType})),
+	}
+
+	for _, op := range routes(cfg) {
+		operation, err := op.build(generator, doc.Components.Schemas)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %w", op.method, op.path, err)
+		}
+		doc.AddOperation(op.path, op.method, operation)
+	}
+
+	// The generated references only name their schemas, resolving them
+	// is what lets doc.Validate check them.
+	if err := openapi3.NewLoader().ResolveRefsIn(doc, nil); err != nil {
+		return nil, err
+	}
+
+	return doc, nil
+}
+
+func (op operation) build(generator *openapi3gen.Generator, schemas openapi3.Schemas) (*openapi3.Operation, error) {
+	var operation = openapi3.NewOperation()
+	operation.Summary = op.summary
+	operation.OperationID = operationID(op.method, op.path)
+	operation.Tags = []string{tag(op.path)}
+
+	if op.access != public {
+		operation.Security = &openapi3.SecurityRequirements{{tokenScheme: []string{}}, {apiKeyScheme: []string{}}}
+	}
+
+	for _, name := range pathParams(op.path) {
+		operation.AddParameter(openapi3.NewPathParameter(name).WithSchema(openapi3.NewStringSchema()))
+	}
+
+	if op.query != nil {
+		var t reflect.Type = reflect.TypeOf(op.query)
+		ref, err := generator.GenerateSchemaRef(t)
+		if err != nil {
+			return nil, err
+		}
+		// The fields of embedded structs such as api.PageRequest are
+		// parameters of their own.
+		for _, field := range reflect.VisibleFields(t) {
+			if field.Anonymous {
+				continue
+			}
+			var name string = queryName(field)
+			var property *openapi3.SchemaRef = schemaOf(ref, schemas).Properties[field.Name]
+			operation.AddParameter(openapi3.NewQueryParameter(name).WithSchema(property.Value).WithRequired(hasRule(field, "required")))
+		}
+	}
+
+	if op.idempotency {
+		operation.AddParameter(openapi3.NewHeaderParameter("Idempotency-Key").
+			WithDescription("Retries with the same key and body get the first response again.").
+			WithSchema(openapi3.NewStringSchema()))
+	}
+
+	if op.body != nil {
+		var body = openapi3.NewRequestBody().WithRequired(true)
+		content, err := contentFor(generator, schemas, op.bodyType, op.body)
+		if err != nil {
+			return nil, err
+		}
+		body.Content = content
+		operation.RequestBody = &openapi3.RequestBodyRef{Value: body}
+		if op.streamed {
+			operation.Extensions = map[string]any{StreamedBody: true}
+		}
+	}
+
+	var status int = op.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	var response = openapi3.NewResponse().WithDescription(http.StatusText(status))
+	if op.response != nil {
+		content, err := contentFor(generator, schemas, op.responseType, op.response)
+		if err != nil {
+			return nil, err
+		}
+		response.Content = content
+		// api.WriteJSON answers /v1 requests preferring XML with it.
+		if strings.HasPrefix(op.path, "/v1/") && op.responseType == "" {
+			response.Content[xmlType] = response.Content[jsonType]
+		}
+	}
+
+	operation.Responses = openapi3.NewResponses(openapi3.WithStatus(status, &openapi3.ResponseRef{Value: response}))
+	operation.Responses.Set("default", &openapi3.ResponseRef{Ref: "#/components/responses/Error"})
+	return operation, nil
+}
+
+func contentFor(generator *openapi3gen.Generator, schemas openapi3.Schemas, mediaType string, value any) (openapi3.Content, error) {
+	if mediaType == "" {
+		mediaType = jsonType
+	}
+	if _, ok := value.([]byte); ok {
+		return openapi3.NewContentWithSchema(openapi3.NewStringSchema(), []string{mediaType}), nil
+	}
+	if schema, ok := value.(*openapi3.Schema); ok {
+		return openapi3.NewContentWithSchema(schema, []string{mediaType}), nil
+	}
+
+	ref, err := generator.NewSchemaRefForValue(value, schemas)
+	if err != nil {
+		return nil, err
+	}
+	return openapi3.NewContentWithSchemaRef(ref, []string{mediaType}), nil
+}
+
+// customizeSchema writes Amount as the string it is encoded to, while
+// requests may also send an integer, and documents the validate tags the
+// handlers enforce.
+func customizeSchema(name string, t reflect.Type, tag reflect.StructTag, schema *openapi3.Schema) error {
+	if t.Kind() == reflect.Struct && t != reflect.TypeOf(time.Time{}) {
+		// api.ReadJSON rejects unknown fields.
+		schema.AdditionalProperties = openapi3.AdditionalProperties{Has: openapi3.Ptr(false)}
+		for i := 0; i < t.NumField(); i++ {
+			if hasRule(t.Field(i), "required") {
+				schema.Required = append(schema.Required, api.FieldName(t.Field(i)))
+			}
+		}
+	}
+	if t == reflect.TypeOf(api.Amount(0)) {
+		*schema = openapi3.Schema{
+			Description: "A whole number of minor units. Responses write it as a string.",
+			OneOf: openapi3.SchemaRefs{
+				{Value: &openapi3.Schema{Type: &openapi3.Types{openapi3.TypeString}, Pattern: `^-?[0-9]+$`}},
+				{Value: &openapi3.Schema{Type: &openapi3.Types{openapi3.TypeInteger}, Format: "int64"}},
+			},
+		}
+	}
+	if t == reflect.TypeOf(time.Time{}) {
+		*schema = *openapi3.NewDateTimeSchema()
+	}
+
+	for _, rule := range api.Rules(reflect.StructField{Tag: tag}) {
+		applyRule(rule, schema)
+	}
+	return nil
+}
+
+// applyRule narrows schema to the values rule allows. Bounds on Amount
+// apply to its integer form, a pattern can't express them.
+func applyRule(rule api.Rule, schema *openapi3.Schema) {
+	for _, branch := range schema.OneOf {
+		if branch.Value.Type.Is(openapi3.TypeInteger) {
+			applyRule(rule, branch.Value)
+		}
+	}
+	if schema.Type == nil {
+		return
+	}
+
+	var bound, _ = strconv.ParseInt(rule.Param, 10, 64)
+	switch rule.Name {
+	case "username":
+		schema.Pattern = api.UsernamePattern.String()
+		schema.Extensions = map[string]any{NormalizedUsername: true}
+	case "oneof":
+		for _, value := range strings.Fields(rule.Param) {
+			schema.Enum = append(schema.Enum, value)
+		}
+	case "min":
+		switch {
+		case schema.Type.Is(openapi3.TypeString):
+			schema.MinLength = uint64(bound)
+		case schema.Type.Is(openapi3.TypeArray):
+			schema.MinItems = uint64(bound)
+		default:
+			schema.Min = openapi3.Float64Ptr(float64(bound))
+		}
+	case "max":
+		switch {
+		case schema.Type.Is(openapi3.TypeString):
+			schema.MaxLength = openapi3.Uint64Ptr(uint64(bound))
+		case schema.Type.Is(openapi3.TypeArray):
+			schema.MaxItems = openapi3.Uint64Ptr(uint64(bound))
+		default:
+			schema.Max = openapi3.Float64Ptr(float64(bound))
+		}
+	}
+}
+
+// hasRule reports whether the validate tag of field has the rule name.
+func hasRule(field reflect.StructField, name string) bool {
+	for _, rule := range api.Rules(field) {
+		if rule.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// schemaOf resolves a reference to a component schema.
+func schemaOf(ref *openapi3.SchemaRef, schemas openapi3.Schemas) *openapi3.Schema {
+	if ref.Value != nil {
+		return ref.Value
+	}
+	return schemas[strings.TrimPrefix(ref.Ref, "#/components/schemas/")].Value
+}
+
+// queryName is the name of a query parameter: the schema tag, or the
+// lowercased field name since gorilla/schema matches names in any case.
+func queryName(field reflect.StructField) string {
+	if name, _, _ := strings.Cut(field.Tag.Get("schema"), ","); name != "" {
+		return name
+	}
+	return strings.ToLower(field.Name)
+}
+
+func pathParams(path string) []string {
+	var names []string
+	for _, segment := range strings.Split(path, "/") {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			names = append(names, segment[1:len(segment)-1])
+		}
+	}
+	return names
+}
+
+// tag groups operations by the first segment after the version.
+func tag(path string) string {
+	if !strings.HasPrefix(path, "/v1/") {
+		return "service"
+	}
+	switch segment, _, _ := strings.Cut(strings.TrimPrefix(path, "/v1/"), "/"); segment {
+	case "admin":
+		return "admin"
+	case "account", "ws":
+		return "account"
+	}
+	return "users"
+}
+
+func operationID(method string, path string) string {
+	var id strings.Builder
+	id.WriteString(strings.ToLower(method))
+	for _, segment := range strings.FieldsFunc(path, func(r rune) bool { return r == '/' || r == '.' || r == '_' }) {
+		segment = strings.Trim(segment, "{}")
+		id.WriteString(strings.ToUpper(segment[:1]) + segment[1:])
+	}
+	return id.String()
+}
+
+// Drift compares the /v1 routes registered on router with the document and
+// returns one line per route missing from either, so that a route added
+// without a spec entry is noticed.
+func Drift(doc *openapi3.T, router chi.Routes) []string {
+	var registered = map[string]bool{}
+	chi.Walk(router, func(method string, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		route = strings.TrimSuffix(route, "/")
+		if strings.HasPrefix(route, "/v1/") && method != http.MethodOptions {
+			registered[method+" "+route] = true
+		}
+		return nil
+	})
+
+	var documented = map[string]bool{}
+	for path, item := range doc.Paths.Map() {
+		if !strings.HasPrefix(path, "/v1/") {
+			continue
+		}
+		for method := range item.Operations() {
+			documented[method+" "+path] = true
+		}
+	}
+
+	var drift []string
+	for route := range registered {
+		if !documented[route] {
+			drift = append(drift, route+" is not documented")
+		}
+	}
+	for route := range documented {
+		if !registered[route] {
+			drift = append(drift, route+" is documented but not registered")
+		}
+	}
+	sort.Strings(drift)
+	return drift
+}
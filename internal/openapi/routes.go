@@ -0,0 +1,92 @@
+package openapi
+
+import (
+	"net/http"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/config"
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// routes lists every route of handlers.Handler except the debug profiler.
+// Keep it in step with the router; Drift reports what is missing.
+func routes(cfg *config.Config) []operation {
+	var ops = []operation{
+		{method: "GET", path: "/healthz", summary: "Liveness probe", response: api.HealthResponse{}},
+		{method: "GET", path: "/readyz", summary: "Readiness probe, 503 while the database is unreachable or the server shuts down", response: api.ReadinessResponse{}},
+		{method: "GET", path: "/version", summary: "Build information", response: api.VersionResponse{}},
+		{method: "GET", path: "/openapi.json", summary: "This document", response: &openapi3.Schema{Type: &openapi3.Types{openapi3.TypeObject}}},
+
+		{method: "GET", path: "/v1/leaderboard", summary: "Richest users", query: api.LeaderboardParams{}, response: api.LeaderboardResponse{}},
+		{method: "POST", path: "/v1/users", summary: "Sign up", body: api.CreateUserParams{}, status: http.StatusCreated, response: api.CreateUserResponse{}},
+		{method: "POST", path: "/v1/login", summary: "Exchange a username and password for a token", body: api.LoginParams{}, response: api.LoginResponse{}},
+		{method: "POST", path: "/v1/token/refresh", summary: "Exchange a valid token for a new one", access: user, query: api.RefreshParams{}, response: api.LoginResponse{}},
+		{method: "POST", path: "/v1/logout", summary: "Revoke the token", access: user, status: http.StatusNoContent},
+		{method: "GET", path: "/v1/ws", summary: "WebSocket of balance changes and get_balance commands", access: user, status: http.StatusSwitchingProtocols},
+		{method: "DELETE", path: "/v1/users/{username}", summary: "Delete a user", access: admin, status: http.StatusNoContent},
+		{method: "GET", path: "/v1/users/{username}/coins", summary: "Balance of a user, the token's own unless it is an admin's", access: user, query: api.UserCoinBalanceParams{}, response: api.CoinBalanceResponse{}},
+
+		{method: "POST", path: "/v1/admin/coins/batch", summary: "Balances of several users", access: admin, body: api.BatchBalanceParams{}, response: api.BatchBalanceResponse{}},
+		{method: "GET", path: "/v1/admin/users", summary: "Search users", access: admin, query: api.UserSearchParams{}, response: api.UserSearchResponse{}},
+		{method: "GET", path: "/v1/admin/stats", summary: "Balance statistics", access: admin, response: api.StatsResponse{}},
+		{method: "POST", path: "/v1/admin/users/import", summary: "Create users from a JSON array or a CSV file", access: admin, query: api.ImportParams{}, body: []api.ImportUserRow{}, streamed: true, response: api.ImportResponse{}},
+		{method: "GET", path: "/v1/admin/ledger/verify", summary: "Compare the stored balances with the ledger", access: admin, response: api.LedgerVerifyResponse{}},
+		{method: "GET", path: "/v1/admin/audit", summary: "Audit log of logins, admin changes and transfers", access: admin, query: api.AuditListParams{}, response: api.AuditListResponse{}},
+		{method: "GET", path: "/v1/admin/maintenance", summary: "Whether the API is down for maintenance", access: admin, response: api.MaintenanceResponse{}},
+		{method: "POST", path: "/v1/admin/maintenance", summary: "Turn maintenance mode on or off", access: admin, body: api.MaintenanceParams{}, response: api.MaintenanceResponse{}},
+		{method: "POST", path: "/v1/admin/drain", summary: "Shut the server down as on a SIGTERM, after the pre-stop delay", access: admin, status: http.StatusAccepted, response: api.DrainResponse{}},
+		{method: "GET", path: "/v1/admin/ledger/{id}", summary: "Ledger entries of a transaction", access: admin, response: api.LedgerResponse{}},
+		{method: "POST", path: "/v1/admin/webhooks", summary: "Register a webhook", access: admin, body: api.WebhookParams{}, status: http.StatusCreated, response: api.WebhookResponse{}},
+		{method: "GET", path: "/v1/admin/webhooks", summary: "List webhooks", access: admin, response: api.WebhookListResponse{}},
+		{method: "DELETE", path: "/v1/admin/webhooks/{id}", summary: "Delete a webhook", access: admin, status: http.StatusNoContent},
+		{method: "GET", path: "/v1/admin/webhooks/{id}/deliveries", summary: "Latest deliveries of a webhook", access: admin, query: api.WebhookDeliveryListParams{}, response: api.WebhookDeliveriesResponse{}},
+		{method: "POST", path: "/v1/admin/webhooks/{id}/deliveries/{deliveryID}/replay", summary: "Deliver the event of a failed delivery again", access: admin, status: http.StatusAccepted, response: api.WebhookDeliveryResponse{}},
+		{method: "POST", path: "/v1/admin/apikeys", summary: "Create an API key", access: admin, status: http.StatusCreated, body: api.APIKeyParams{}, response: api.APIKeyResponse{}},
+		{method: "GET", path: "/v1/admin/apikeys", summary: "List the API keys", access: admin, response: api.APIKeyListResponse{}},
+		{method: "DELETE", path: "/v1/admin/apikeys/{id}", summary: "Revoke an API key", access: admin, status: http.StatusNoContent},
+		{method: "DELETE", path: "/v1/admin/tokens/{username}", summary: "Revoke every token of a user", access: admin, status: http.StatusNoContent},
+		{method: "DELETE", path: "/v1/admin/lockouts/users/{username}", summary: "Lift the lockout of a username", access: admin, status: http.StatusNoContent},
+		{method: "DELETE", path: "/v1/admin/lockouts/ips/{ip}", summary: "Lift the lockout of an IP", access: admin, status: http.StatusNoContent},
+		{method: "POST", path: "/v1/admin/users/{username}/restore", summary: "Restore a deleted user", access: admin, status: http.StatusNoContent},
+		{method: "POST", path: "/v1/admin/users/{username}/freeze", summary: "Freeze an account", access: admin, body: api.FreezeParams{}, response: api.FreezeResponse{}},
+		{method: "POST", path: "/v1/admin/users/{username}/unfreeze", summary: "Unfreeze an account", access: admin, body: api.FreezeParams{}, response: api.FreezeResponse{}},
+		{method: "PUT", path: "/v1/admin/users/{username}/overdraft", summary: "Allow or forbid an overdraft", access: admin, body: api.OverdraftParams{}, response: api.OverdraftResponse{}},
+		{method: "PUT", path: "/v1/admin/users/{username}/coins", summary: "Set a balance", access: admin, body: api.SetBalanceParams{}, response: api.AdminBalanceResponse{}},
+		{method: "POST", path: "/v1/admin/users/{username}/coins/adjust", summary: "Adjust a balance", access: admin, body: api.AdjustBalanceParams{}, response: api.AdminBalanceResponse{}},
+
+		{method: "GET", path: "/v1/account/coins", summary: "Balance of the user", access: user, query: api.CoinBalanceParams{}, response: api.CoinBalanceResponse{}},
+		{method: "GET", path: "/v1/account/coins/stream", summary: "Server-sent events of balance changes", access: user, response: []byte{}, responseType: "text/event-stream"},
+		{method: "GET", path: "/v1/account/profile", summary: "Profile of the user", access: user, response: api.ProfileResponse{}},
+		{method: "PATCH", path: "/v1/account/profile", summary: "Change the fields present, null clears one", access: user, body: profileUpdate(), response: api.ProfileResponse{}},
+		{method: "POST", path: "/v1/account/password", summary: "Change the password and revoke every token", access: user, body: api.ChangePasswordParams{}, status: http.StatusNoContent},
+		{method: "POST", path: "/v1/account/coins/deposit", summary: "Add coins", access: user, idempotency: true, body: api.CoinAmountParams{}, response: api.CoinBalanceResponse{}},
+		{method: "POST", path: "/v1/account/coins/withdraw", summary: "Remove coins", access: user, idempotency: true, body: api.CoinAmountParams{}, response: api.CoinBalanceResponse{}},
+		{method: "POST", path: "/v1/account/coins/transfer", summary: "Move coins to another user", access: user, idempotency: true, body: api.TransferParams{}, response: api.TransferResponse{}},
+		{method: "GET", path: "/v1/account/transactions", summary: "Balance changes, newest first", access: user, query: api.TransactionListParams{}, response: api.TransactionListResponse{}},
+		{method: "GET", path: "/v1/account/export", summary: "Download the transaction history as CSV, or the profile and history as JSON", access: user, query: api.ExportParams{}, response: []byte{}, responseType: "text/csv"},
+	}
+
+	if cfg.API.LeaderboardRefresh > 0 {
+		ops = append(ops, operation{method: "POST", path: "/v1/admin/leaderboard/refresh", summary: "Rank the users of the leaderboard now", access: admin, response: api.LeaderboardRefreshResponse{}})
+	}
+
+	switch {
+	case !cfg.Metrics.Served():
+	case cfg.Metrics.Exporter == config.ExporterExpvar:
+		ops = append(ops, operation{method: "GET", path: cfg.Metrics.Path, summary: "Metrics and runtime statistics as expvar JSON", response: []byte{}, responseType: "application/json"})
+	default:
+		ops = append(ops, operation{method: "GET", path: cfg.Metrics.Path, summary: "Prometheus metrics", response: []byte{}, responseType: "text/plain"})
+	}
+	return ops
+}
+
+// profileUpdate is the body of PATCH /v1/account/profile, which is decoded
+// field by field rather than into a type.
+func profileUpdate() *openapi3.Schema {
+	var schema = openapi3.NewObjectSchema().WithoutAdditionalProperties()
+	schema.Properties = openapi3.Schemas{
+		"DisplayName": {Value: openapi3.NewStringSchema().WithMaxLength(64).WithNullable()},
+		"Email":       {Value: openapi3.NewStringSchema().WithFormat("email").WithNullable()},
+	}
+	return schema
+}
@@ -0,0 +1,154 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Clock is the time source of a Limiter, replaced by a fake in tests.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// SystemClock reads the wall clock.
+var SystemClock Clock = systemClock{}
+
+// sweepInterval is how often idle buckets are dropped.
+const sweepInterval = time.Minute
+
+// Limiter is a set of token buckets, one per key, each refilling at rate
+// tokens per second up to burst tokens.
+type Limiter struct {
+	rate  float64
+	burst int
+	clock Clock
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Result describes the state of a bucket after a Take.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+
+	// RetryAfter is how long until the next token is available and Reset
+	// how long until the bucket is full again.
+	RetryAfter time.Duration
+	Reset      time.Duration
+}
+
+func New(rate float64, burst int, clock Clock) *Limiter {
+	if clock == nil {
+		clock = SystemClock
+	}
+
+	return &Limiter{
+		rate:      rate,
+		burst:     burst,
+		clock:     clock,
+		buckets:   make(map[string]*bucket),
+		lastSweep: clock.Now(),
+	}
+}
+
+// SetLimits changes the rate and burst of every bucket. Buckets holding
+// more than the new burst are cut down to it.
+func (l *Limiter) SetLimits(rate float64, burst int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if rate == l.rate && burst == l.burst {
+		return
+	}
+	l.rate, l.burst = rate, burst
+	for _, b := range l.buckets {
+		b.tokens = math.Min(b.tokens, float64(burst))
+	}
+}
+
+// Allow takes a token from the bucket of key and reports whether one was
+// available.
+func (l *Limiter) Allow(key string) bool {
+	return l.Take(key).Allowed
+}
+
+// Take takes a token from the bucket of key if one is available.
+func (l *Limiter) Take(key string) Result {
+	var now time.Time = l.clock.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) >= sweepInterval {
+		l.sweep(now)
+	}
+
+	var b *bucket = l.refill(key, now)
+	var res = Result{Limit: l.burst}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = l.timeFor(1 - b.tokens)
+	}
+
+	res.Remaining = int(b.tokens)
+	res.Reset = l.timeFor(float64(l.burst) - b.tokens)
+
+	return res
+}
+
+// Len returns the number of buckets currently tracked.
+func (l *Limiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
+
+func (l *Limiter) refill(key string, now time.Time) *bucket {
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.burst), last: now}
+		l.buckets[key] = b
+		return b
+	}
+
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(float64(l.burst), b.tokens+elapsed*l.rate)
+		b.last = now
+	}
+
+	return b
+}
+
+// sweep drops the buckets that have refilled completely, they are no
+// different from the fresh bucket refill would create for the key.
+func (l *Limiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= float64(l.burst) {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+func (l *Limiter) timeFor(tokens float64) time.Duration {
+	if tokens <= 0 {
+		return 0
+	}
+	return time.Duration(tokens / l.rate * float64(time.Second))
+}
@@ -0,0 +1,103 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+// fakeClock is a Clock that only moves when told to.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func TestLimiterBurstThenRefill(t *testing.T) {
+	var clock = newFakeClock()
+	var limiter = New(2, 3, clock)
+
+	for i := 0; i < 3; i++ {
+		if !limiter.Allow("10.0.0.1") {
+			t.Fatalf("request %d of the burst was limited", i+1)
+		}
+	}
+	var res Result = limiter.Take("10.0.0.1")
+	if res.Allowed {
+		t.Fatal("request past the burst was allowed")
+	}
+	if res.RetryAfter != 500*time.Millisecond {
+		t.Errorf("RetryAfter = %s, want 500ms", res.RetryAfter)
+	}
+
+	clock.Advance(499 * time.Millisecond)
+	if limiter.Allow("10.0.0.1") {
+		t.Fatal("allowed before a token was refilled")
+	}
+	clock.Advance(time.Millisecond)
+	if !limiter.Allow("10.0.0.1") {
+		t.Fatal("limited after a token was refilled")
+	}
+}
+
+func TestLimiterKeysAreIndependent(t *testing.T) {
+	var limiter = New(1, 1, newFakeClock())
+
+	if !limiter.Allow("10.0.0.1") {
+		t.Fatal("first request of 10.0.0.1 was limited")
+	}
+	if limiter.Allow("10.0.0.1") {
+		t.Fatal("second request of 10.0.0.1 was allowed")
+	}
+	if !limiter.Allow("10.0.0.2") {
+		t.Fatal("10.0.0.2 was limited by the bucket of 10.0.0.1")
+	}
+}
+
+func TestLimiterRefillStopsAtBurst(t *testing.T) {
+	var clock = newFakeClock()
+	var limiter = New(10, 2, clock)
+
+	limiter.Take("key")
+	clock.Advance(time.Hour)
+
+	var res Result = limiter.Take("key")
+	if !res.Allowed || res.Remaining != 1 {
+		t.Fatalf("Take after an hour = %+v, want allowed with 1 remaining", res)
+	}
+	if res.Reset != 100*time.Millisecond {
+		t.Errorf("Reset = %s, want 100ms", res.Reset)
+	}
+}
+
+func TestLimiterSetLimitsCutsBuckets(t *testing.T) {
+	var limiter = New(1, 5, newFakeClock())
+
+	limiter.Take("key")
+	limiter.SetLimits(1, 2)
+
+	if res := limiter.Take("key"); !res.Allowed || res.Remaining != 1 || res.Limit != 2 {
+		t.Fatalf("Take after SetLimits = %+v, want allowed with 1 of 2 remaining", res)
+	}
+}
+
+func TestLimiterSweepsFullBuckets(t *testing.T) {
+	var clock = newFakeClock()
+	var limiter = New(1, 1, clock)
+
+	limiter.Take("idle")
+	if limiter.Len() != 1 {
+		t.Fatalf("Len = %d, want 1", limiter.Len())
+	}
+
+	clock.Advance(sweepInterval)
+	limiter.Take("busy")
+	if limiter.Len() != 1 {
+		t.Fatalf("Len after the sweep = %d, want only the busy bucket", limiter.Len())
+	}
+}
@@ -0,0 +1,237 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/audit"
+	"github.com/RashedMaaitah/goapi/internal/config"
+	"github.com/RashedMaaitah/goapi/internal/events"
+	"github.com/RashedMaaitah/goapi/internal/logging"
+	"github.com/RashedMaaitah/goapi/internal/middleware"
+	"github.com/RashedMaaitah/goapi/internal/tools"
+	"github.com/RashedMaaitah/goapi/pkg/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxVersionAttempts matches the HTTP handlers: an adjustment that keeps
+// losing the race for the record gives up with Aborted.
+const maxVersionAttempts = 3
+
+var errInternal = status.Error(codes.Internal, "an unexpected error occurred")
+
+type coinService struct {
+	pb.UnimplementedCoinServiceServer
+
+	cfg      config.APIConfig
+	database tools.Database
+	bus      *events.Bus
+	auditor  audit.Auditor
+}
+
+func (s *coinService) GetCoinBalance(ctx context.Context, req *pb.GetCoinBalanceRequest) (*pb.BalanceResponse, error) {
+	if err := requireScope(ctx, tools.ScopeCoinsRead); err != nil {
+		return nil, err
+	}
+
+	currency, err := s.currency(req.GetCurrency())
+	if err != nil {
+		return nil, err
+	}
+
+	var username string = middleware.GetLoginDetails(ctx).Username
+	coinDetails, err := s.database.GetUserCoins(ctx, username)
+
+	if err != nil {
+		return nil, statusError(ctx, err)
+	}
+
+	return balanceResponse(coinDetails, currency), nil
+}
+
+func (s *coinService) Deposit(ctx context.Context, req *pb.AmountRequest) (*pb.BalanceResponse, error) {
+	return s.adjust(ctx, req, 1)
+}
+
+func (s *coinService) Withdraw(ctx context.Context, req *pb.AmountRequest) (*pb.BalanceResponse, error) {
+	return s.adjust(ctx, req, -1)
+}
+
+func (s *coinService) adjust(ctx context.Context, req *pb.AmountRequest, sign int64) (*pb.BalanceResponse, error) {
+	var logger = logging.FromContext(ctx)
+
+	if err := requireScope(ctx, tools.ScopeCoinsWrite); err != nil {
+		return nil, err
+	}
+	if req.GetAmount() <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "amount must be a positive integer")
+	}
+
+	currency, err := s.currency(req.GetCurrency())
+	if err != nil {
+		return nil, err
+	}
+
+	var username string = middleware.GetLoginDetails(ctx).Username
+
+	var coinDetails *tools.CoinDetails
+	for attempt := 1; attempt <= maxVersionAttempts; attempt++ {
+		var current *tools.CoinDetails
+		current, err = s.database.GetUserCoins(ctx, username)
+		if err != nil {
+			break
+		}
+
+		coinDetails, err = s.database.AdjustUserCoins(ctx, username, currency, sign*req.GetAmount(), current.Version)
+		if !errors.Is(err, tools.ErrVersionConflict) {
+			break
+		}
+	}
+
+	if err != nil {
+		return nil, statusError(ctx, err)
+	}
+
+	logger.Infof("Adjusted %s of %s by %d, balance is now %d", currency, username, sign*req.GetAmount(), coinDetails.Balance(currency))
+
+	var event string = tools.TransactionDeposit
+	if sign < 0 {
+		event = tools.TransactionWithdrawal
+	}
+	s.bus.Publish(events.Event{
+		Type:     event,
+		Username: username,
+		Currency: currency,
+		Amount:   req.GetAmount(),
+		Balance:  coinDetails.Balance(currency),
+	})
+
+	return balanceResponse(coinDetails, currency), nil
+}
+
+func (s *coinService) Transfer(ctx context.Context, req *pb.TransferRequest) (*pb.TransferResponse, error) {
+	var logger = logging.FromContext(ctx)
+
+	if err := requireScope(ctx, tools.ScopeCoinsWrite); err != nil {
+		return nil, err
+	}
+	if req.GetAmount() <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "amount must be a positive integer")
+	}
+
+	currency, err := s.currency(req.GetCurrency())
+	if err != nil {
+		return nil, err
+	}
+
+	var username string = middleware.GetLoginDetails(ctx).Username
+	var to string = api.NormalizeUsername(req.GetTo())
+
+	if to == username {
+		return nil, status.Error(codes.InvalidArgument, "cannot transfer coins to yourself")
+	}
+
+	transfer, err := s.database.Transfer(ctx, username, to, currency, req.GetAmount())
+	s.auditor.Record(ctx, tools.AuditEntry{
+		Actor:    username,
+		Action:   audit.ActionTransfer,
+		Target:   to,
+		Currency: currency,
+		Amount:   req.GetAmount(),
+	}, err)
+
+	if err != nil {
+		return nil, statusError(ctx, err)
+	}
+
+	logger.Infof("Transferred %d %s from %s to %s (%s)", transfer.Amount, transfer.Currency, transfer.From, transfer.To, transfer.ID)
+
+	s.bus.Publish(events.Event{
+		Type:      tools.TransactionTransferOut,
+		Username:  transfer.From,
+		Currency:  transfer.Currency,
+		Amount:    transfer.Amount,
+		Balance:   transfer.FromCoins,
+		Timestamp: transfer.CreatedAt,
+	})
+	s.bus.Publish(events.Event{
+		Type:      tools.TransactionTransferIn,
+		Username:  transfer.To,
+		Currency:  transfer.Currency,
+		Amount:    transfer.Amount,
+		Balance:   transfer.ToCoins,
+		Timestamp: transfer.CreatedAt,
+	})
+
+	return &pb.TransferResponse{
+		TransferId: transfer.ID,
+		Currency:   transfer.Currency,
+		Balance:    transfer.FromCoins,
+	}, nil
+}
+
+// requireScope refuses, with PermissionDenied, a call whose token doesn't
+// grant scope, as middleware.RequireScope does over HTTP.
+func requireScope(ctx context.Context, scope string) error {
+	var loginDetails = middleware.GetLoginDetails(ctx)
+	if !loginDetails.HasScope(scope) {
+		logging.FromContext(ctx).Warnf("Token of %s grants %v, %q required", loginDetails.Username, loginDetails.Scopes, scope)
+		return status.Errorf(codes.PermissionDenied, "the token does not grant the %s scope", scope)
+	}
+	return nil
+}
+
+// currency returns the currency named by a request, the default one when
+// it names none.
+func (s *coinService) currency(name string) (string, error) {
+	var currency string = strings.ToLower(strings.TrimSpace(name))
+	if currency == "" || currency == tools.DefaultCurrency {
+		return tools.DefaultCurrency, nil
+	}
+	if !slices.Contains(s.cfg.Currencies, currency) {
+		return "", status.Error(codes.InvalidArgument, "unknown currency")
+	}
+	return currency, nil
+}
+
+// statusError maps the database errors to gRPC codes. Unexpected ones are
+// logged and reported as Internal.
+func statusError(ctx context.Context, err error) error {
+	switch {
+	case errors.Is(err, tools.ErrSenderNotFound):
+		return status.Error(codes.Unauthenticated, "your account does not exist")
+	case errors.Is(err, tools.ErrUserNotFound), errors.Is(err, tools.ErrUserDeleted):
+		return status.Error(codes.NotFound, "user does not exist")
+	case errors.Is(err, tools.ErrInsufficientFunds):
+		return status.Error(codes.FailedPrecondition, "insufficient funds")
+	case errors.Is(err, tools.ErrAccountFrozen):
+		return status.Error(codes.PermissionDenied, "account is frozen")
+	case errors.Is(err, tools.ErrSelfTransfer):
+		return status.Error(codes.InvalidArgument, "cannot transfer coins to yourself")
+	case errors.Is(err, tools.ErrBalanceOverflow):
+		return status.Error(codes.InvalidArgument, "the amount would overflow the balance")
+	case errors.Is(err, tools.ErrVersionConflict):
+		return status.Error(codes.Aborted, "the account changed concurrently, retry")
+	case errors.Is(err, tools.ErrCircuitOpen):
+		return status.Error(codes.Unavailable, "the service is temporarily unavailable, retry later")
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, "the request took too long")
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, "the request was canceled")
+	}
+
+	logging.FromContext(ctx).Error(err)
+	return errInternal
+}
+
+func balanceResponse(coinDetails *tools.CoinDetails, currency string) *pb.BalanceResponse {
+	return &pb.BalanceResponse{
+		Balance:  coinDetails.Balance(currency),
+		Currency: currency,
+		Balances: coinDetails.AllBalances(),
+	}
+}
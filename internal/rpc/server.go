@@ -0,0 +1,179 @@
+// Package rpc serves the coin operations over gRPC, next to the HTTP API
+// and on the same database, tokens and event bus.
+package rpc
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"runtime/debug"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/internal/audit"
+	"github.com/RashedMaaitah/goapi/internal/auth"
+	"github.com/RashedMaaitah/goapi/internal/config"
+	"github.com/RashedMaaitah/goapi/internal/events"
+	"github.com/RashedMaaitah/goapi/internal/lockout"
+	"github.com/RashedMaaitah/goapi/internal/logging"
+	"github.com/RashedMaaitah/goapi/internal/middleware"
+	"github.com/RashedMaaitah/goapi/internal/tools"
+	"github.com/RashedMaaitah/goapi/pkg/pb"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// NewServer returns a gRPC server with the coin service registered. The
+// token is read from the metadata like from the headers of HTTP requests,
+// looked up through logins when it isn't nil, and invalid ones count as
+// failures of the peer in lockouts. A non-nil tlsConfig serves TLS with it,
+// as the HTTP server does.
+func NewServer(cfg *config.Config, database tools.Database, tokens auth.Tokens, logins *auth.LoginCache, lockouts *lockout.Lockout, bus *events.Bus, auditor audit.Auditor, logger *log.Logger, tlsConfig *tls.Config) *grpc.Server {
+	var options = []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(
+			withLogger(logger),
+			recoverer,
+			authorization(cfg.Auth, database, tokens, logins, lockouts),
+		),
+	}
+	if tlsConfig != nil {
+		options = append(options, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	var server = grpc.NewServer(options...)
+	pb.RegisterCoinServiceServer(server, &coinService{cfg: cfg.API, database: database, bus: bus, auditor: auditor})
+	return server
+}
+
+// withLogger puts an entry for the call in the context and logs one line
+// per call with its method, code and duration.
+func withLogger(logger *log.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		var start = time.Now()
+		var entry *log.Entry = log.NewEntry(logger).WithField("method", info.FullMethod)
+
+		resp, err := handler(logging.NewContext(ctx, entry), req)
+
+		var code codes.Code = status.Code(err)
+		entry = entry.WithFields(log.Fields{
+			"code":     code.String(),
+			"duration": time.Since(start).String(),
+		})
+		switch code {
+		case codes.OK:
+			entry.Info("call completed")
+		case codes.Internal, codes.Unknown:
+			entry.Error("call completed")
+		default:
+			entry.Warn("call completed")
+		}
+		return resp, err
+	}
+}
+
+// recoverer turns a panicking call into a logged Internal error.
+func recoverer(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+	defer func() {
+		rec := recover()
+		if rec == nil {
+			return
+		}
+
+		logging.FromContext(ctx).
+			WithField("stack", string(debug.Stack())).
+			Errorf("panic: %v", rec)
+		err = errInternal
+	}()
+
+	return handler(ctx, req)
+}
+
+// authorization resolves the user of the token in the metadata, like
+// middleware.Authorization does for HTTP requests. Only the tokens of
+// /login are accepted, whatever the auth.providers.
+func authorization(cfg config.AuthConfig, database tools.Database, tokens auth.Tokens, logins *auth.LoginCache, lockouts *lockout.Lockout) grpc.UnaryServerInterceptor {
+	var source auth.TokenSource = auth.NewTokenSource(cfg)
+
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		var logger = logging.FromContext(ctx)
+
+		var md, _ = metadata.FromIncomingContext(ctx)
+		token, legacy, err := source.FromValues(first(md.Get("authorization")), first(md.Get(source.Header)))
+		switch {
+		case errors.Is(err, auth.ErrConflictingTokens):
+			return nil, status.Error(codes.InvalidArgument, "conflicting tokens")
+		case err != nil:
+			return nil, status.Error(codes.Unauthenticated, `authorization must be "Bearer <token>"`)
+		case token == "":
+			return nil, status.Error(codes.Unauthenticated, "missing token")
+		case legacy:
+			logger.Warnf("Deprecated token in %s, clients should send it as a Bearer token in Authorization", source.Header)
+		}
+
+		var ip string = peerIP(ctx)
+		if lockouts.Locked(ctx, "", ip) > 0 {
+			logger.Warnf("Token from %s refused, it is locked out", ip)
+			return nil, status.Error(codes.ResourceExhausted, "too many failed attempts")
+		}
+
+		loginDetails, err := logins.Lookup(token, func() (*tools.LoginDetails, error) {
+			claims, err := tokens.Verify(ctx, token)
+			if err != nil {
+				return nil, err
+			}
+			loginDetails, err := database.GetUserLoginDetails(ctx, claims.Username)
+			if err != nil {
+				return nil, err
+			}
+			loginDetails.Scopes = claims.Granted(cfg.LegacyFullAccess)
+			return loginDetails, nil
+		})
+
+		if errors.Is(err, auth.ErrTokenExpired) {
+			return nil, status.Error(codes.Unauthenticated, "token expired")
+		}
+
+		if errors.Is(err, auth.ErrInvalidToken) {
+			lockouts.Fail(ctx, "", ip)
+			return nil, status.Error(codes.Unauthenticated, "invalid token")
+		}
+
+		// The token outlived its user.
+		if errors.Is(err, tools.ErrUserNotFound) {
+			return nil, status.Error(codes.Unauthenticated, "invalid token")
+		}
+		if err != nil {
+			return nil, statusError(ctx, err)
+		}
+
+		logger.Debugf("Authorized %s", loginDetails.Username)
+
+		return handler(middleware.WithLoginDetails(ctx, loginDetails), req)
+	}
+}
+
+// peerIP returns the address of the client of the call in ctx.
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
+
+// first returns the first of values, "" when there are none.
+func first(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
@@ -0,0 +1,333 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/config"
+	"github.com/RashedMaaitah/goapi/internal/ledger"
+	"github.com/RashedMaaitah/goapi/internal/metrics"
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrCircuitOpen is returned, wrapped in an *api.RetryAfterError, by the
+// calls the circuit breaker fails without making them.
+var ErrCircuitOpen = api.ErrCircuitOpen
+
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half_open"
+)
+
+// Breaker is a circuit breaker for database calls. Closed, it counts the
+// calls failing in a row and opens after cfg.Failures of them. Open, calls
+// fail at once with ErrCircuitOpen until cfg.Cooldown has passed, when it
+// half-opens: the next call is let through as a probe, the others still
+// failing, and closes it again if it succeeds or reopens it if it fails.
+//
+// Only failures of the database count: errors it answers with, such as
+// ErrUserNotFound, are successes, and canceled calls don't count either
+// way.
+type Breaker struct {
+	cfg     config.BreakerConfig
+	logger  *log.Logger
+	metrics *metrics.Metrics
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func NewBreaker(cfg config.BreakerConfig, logger *log.Logger, m *metrics.Metrics) *Breaker {
+	return &Breaker{cfg: cfg, logger: logger, metrics: m, state: BreakerClosed}
+}
+
+// State returns the current state: BreakerClosed, BreakerOpen or
+// BreakerHalfOpen.
+func (b *Breaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state
+}
+
+// Wrap returns a Database making its calls to database through b. Ping is
+// not, so the readiness probe sees the database as it is.
+func (b *Breaker) Wrap(database Database) Database {
+	return &breakerDB{next: database, breaker: b}
+}
+
+// allow returns nil when a call may be made, and the error to fail it with
+// otherwise.
+func (b *Breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var wait time.Duration = b.cfg.Cooldown.Duration() - time.Since(b.openedAt)
+	switch {
+	case b.state == BreakerClosed:
+		return nil
+	case b.state == BreakerOpen && wait <= 0:
+		b.transition(BreakerHalfOpen)
+		fallthrough
+	case b.state == BreakerHalfOpen && !b.probing:
+		b.probing = true
+		return nil
+	}
+
+	b.metrics.BreakerRejected.Inc()
+	// A probe in flight answers within about its timeout: clients are
+	// told to retry in a second rather than after another cooldown.
+	return &api.RetryAfterError{Err: ErrCircuitOpen, After: max(wait, time.Second)}
+}
+
+// done records the outcome of a call allow let through.
+func (b *Breaker) done(err error) {
+	var canceled, failed = breakerOutcome(err)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerClosed:
+		if canceled {
+			return
+		}
+		if !failed {
+			b.failures = 0
+			return
+		}
+		b.failures++
+		if b.failures >= b.cfg.Failures {
+			b.logger.Errorf("Database circuit breaker opened after %d failures in a row, the last: %v", b.failures, err)
+			b.open()
+		}
+	case BreakerHalfOpen:
+		b.probing = false
+		switch {
+		case canceled:
+			// The next call probes instead.
+		case failed:
+			b.logger.Warnf("Database circuit breaker probe failed, open for another %s: %v", b.cfg.Cooldown.Duration(), err)
+			b.open()
+		default:
+			b.logger.Info("Database circuit breaker probe succeeded, closed")
+			b.failures = 0
+			b.transition(BreakerClosed)
+		}
+	}
+	// Open: a call let through before it opened, which changes nothing.
+}
+
+// open opens b. b.mu must be held.
+func (b *Breaker) open() {
+	b.openedAt = time.Now()
+	b.transition(BreakerOpen)
+}
+
+// transition changes the state of b. b.mu must be held.
+func (b *Breaker) transition(state string) {
+	b.state = state
+	b.metrics.BreakerTransitions.Inc(state)
+}
+
+// breakerOutcome tells the calls canceled by their caller, which say
+// nothing about the database, and those it failed.
+func breakerOutcome(err error) (canceled bool, failed bool) {
+	switch {
+	case err == nil:
+		return false, false
+	case errors.Is(err, context.Canceled):
+		return true, false
+	case errors.Is(err, ErrNoTransactions), errorResult(err) != "error":
+		return false, false
+	}
+	return false, true
+}
+
+// breakerDB decorates any Database implementation with a Breaker.
+type breakerDB struct {
+	next    Database
+	breaker *Breaker
+}
+
+// guard makes call through b.
+func guard[T any](b *Breaker, call func() (T, error)) (T, error) {
+	if err := b.allow(); err != nil {
+		var zero T
+		return zero, err
+	}
+	result, err := call()
+	b.done(err)
+	return result, err
+}
+
+// guardErr is guard for the methods returning only an error.
+func guardErr(b *Breaker, call func() error) error {
+	if err := b.allow(); err != nil {
+		return err
+	}
+	var err error = call()
+	b.done(err)
+	return err
+}
+
+func (d *breakerDB) GetUserLoginDetails(ctx context.Context, username string) (*LoginDetails, error) {
+	return guard(d.breaker, func() (*LoginDetails, error) { return d.next.GetUserLoginDetails(ctx, username) })
+}
+
+func (d *breakerDB) GetUserCoins(ctx context.Context, username string) (*CoinDetails, error) {
+	return guard(d.breaker, func() (*CoinDetails, error) { return d.next.GetUserCoins(ctx, username) })
+}
+
+func (d *breakerDB) AdjustUserCoins(ctx context.Context, username string, currency string, delta int64, version int64) (*CoinDetails, error) {
+	return guard(d.breaker, func() (*CoinDetails, error) { return d.next.AdjustUserCoins(ctx, username, currency, delta, version) })
+}
+
+func (d *breakerDB) AdminAdjustCoins(ctx context.Context, username string, adjustment AdminAdjustment) (*CoinDetails, error) {
+	return guard(d.breaker, func() (*CoinDetails, error) { return d.next.AdminAdjustCoins(ctx, username, adjustment) })
+}
+
+func (d *breakerDB) SetOverdraft(ctx context.Context, username string, limit int64) (*CoinDetails, error) {
+	return guard(d.breaker, func() (*CoinDetails, error) { return d.next.SetOverdraft(ctx, username, limit) })
+}
+
+func (d *breakerDB) SetFrozen(ctx context.Context, username string, frozen bool, actor string, reason string) (*CoinDetails, error) {
+	return guard(d.breaker, func() (*CoinDetails, error) { return d.next.SetFrozen(ctx, username, frozen, actor, reason) })
+}
+
+func (d *breakerDB) Transfer(ctx context.Context, from string, to string, currency string, amount int64) (*TransferDetails, error) {
+	return guard(d.breaker, func() (*TransferDetails, error) { return d.next.Transfer(ctx, from, to, currency, amount) })
+}
+
+func (d *breakerDB) ListTransactions(ctx context.Context, username string, limit int, before int64) ([]Transaction, error) {
+	return guard(d.breaker, func() ([]Transaction, error) { return d.next.ListTransactions(ctx, username, limit, before) })
+}
+
+func (d *breakerDB) CreateUser(ctx context.Context, username string, passwordHash string) (*LoginDetails, error) {
+	return guard(d.breaker, func() (*LoginDetails, error) { return d.next.CreateUser(ctx, username, passwordHash) })
+}
+
+func (d *breakerDB) UpdateUser(ctx context.Context, username string, update UserUpdate) (*LoginDetails, error) {
+	return guard(d.breaker, func() (*LoginDetails, error) { return d.next.UpdateUser(ctx, username, update) })
+}
+
+func (d *breakerDB) UpdatePassword(ctx context.Context, username string, passwordHash string) error {
+	return guardErr(d.breaker, func() error { return d.next.UpdatePassword(ctx, username, passwordHash) })
+}
+
+func (d *breakerDB) GetUserIncludingDeleted(ctx context.Context, username string) (*LoginDetails, error) {
+	return guard(d.breaker, func() (*LoginDetails, error) { return d.next.GetUserIncludingDeleted(ctx, username) })
+}
+
+func (d *breakerDB) DeleteUser(ctx context.Context, username string) error {
+	return guardErr(d.breaker, func() error { return d.next.DeleteUser(ctx, username) })
+}
+
+func (d *breakerDB) RestoreUser(ctx context.Context, username string) error {
+	return guardErr(d.breaker, func() error { return d.next.RestoreUser(ctx, username) })
+}
+
+func (d *breakerDB) CreateSession(ctx context.Context, session Session, replace bool) error {
+	return guardErr(d.breaker, func() error { return d.next.CreateSession(ctx, session, replace) })
+}
+
+func (d *breakerDB) GetSession(ctx context.Context, token string) (*Session, error) {
+	return guard(d.breaker, func() (*Session, error) { return d.next.GetSession(ctx, token) })
+}
+
+func (d *breakerDB) DeleteSession(ctx context.Context, token string) error {
+	return guardErr(d.breaker, func() error { return d.next.DeleteSession(ctx, token) })
+}
+
+func (d *breakerDB) DeleteUserSessions(ctx context.Context, username string) error {
+	return guardErr(d.breaker, func() error { return d.next.DeleteUserSessions(ctx, username) })
+}
+
+func (d *breakerDB) CreateAPIKey(ctx context.Context, key APIKey) error {
+	return guardErr(d.breaker, func() error { return d.next.CreateAPIKey(ctx, key) })
+}
+
+func (d *breakerDB) ListAPIKeys(ctx context.Context) ([]APIKey, error) {
+	return guard(d.breaker, func() ([]APIKey, error) { return d.next.ListAPIKeys(ctx) })
+}
+
+func (d *breakerDB) GetAPIKey(ctx context.Context, hash string) (*APIKey, error) {
+	return guard(d.breaker, func() (*APIKey, error) { return d.next.GetAPIKey(ctx, hash) })
+}
+
+func (d *breakerDB) TouchAPIKey(ctx context.Context, id string, at time.Time) error {
+	return guardErr(d.breaker, func() error { return d.next.TouchAPIKey(ctx, id, at) })
+}
+
+func (d *breakerDB) DeleteAPIKey(ctx context.Context, id string) error {
+	return guardErr(d.breaker, func() error { return d.next.DeleteAPIKey(ctx, id) })
+}
+
+func (d *breakerDB) SearchUsers(ctx context.Context, filter UserFilter) ([]UserSummary, error) {
+	return guard(d.breaker, func() ([]UserSummary, error) { return d.next.SearchUsers(ctx, filter) })
+}
+
+func (d *breakerDB) GetStats(ctx context.Context, bounds []int64) (*Stats, error) {
+	return guard(d.breaker, func() (*Stats, error) { return d.next.GetStats(ctx, bounds) })
+}
+
+func (d *breakerDB) ImportUsers(ctx context.Context, users []NewUser, atomic bool) ([]error, error) {
+	return guard(d.breaker, func() ([]error, error) { return d.next.ImportUsers(ctx, users, atomic) })
+}
+
+func (d *breakerDB) LedgerEntries(ctx context.Context, transactionID string) ([]ledger.Entry, error) {
+	return guard(d.breaker, func() ([]ledger.Entry, error) { return d.next.LedgerEntries(ctx, transactionID) })
+}
+
+func (d *breakerDB) VerifyLedger(ctx context.Context) ([]ledger.Drift, error) {
+	return guard(d.breaker, func() ([]ledger.Drift, error) { return d.next.VerifyLedger(ctx) })
+}
+
+func (d *breakerDB) ReserveIdempotencyKey(ctx context.Context, key string, requestHash string, expiresAt time.Time) (*IdempotencyRecord, error) {
+	return guard(d.breaker, func() (*IdempotencyRecord, error) {
+		return d.next.ReserveIdempotencyKey(ctx, key, requestHash, expiresAt)
+	})
+}
+
+func (d *breakerDB) CompleteIdempotencyKey(ctx context.Context, key string, statusCode int, contentType string, body []byte) error {
+	return guardErr(d.breaker, func() error { return d.next.CompleteIdempotencyKey(ctx, key, statusCode, contentType, body) })
+}
+
+func (d *breakerDB) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	return guardErr(d.breaker, func() error { return d.next.ReleaseIdempotencyKey(ctx, key) })
+}
+
+func (d *breakerDB) AppendAudit(ctx context.Context, entry AuditEntry) (*AuditEntry, error) {
+	return guard(d.breaker, func() (*AuditEntry, error) { return d.next.AppendAudit(ctx, entry) })
+}
+
+func (d *breakerDB) ListAudit(ctx context.Context, filter AuditFilter) ([]AuditEntry, error) {
+	return guard(d.breaker, func() ([]AuditEntry, error) { return d.next.ListAudit(ctx, filter) })
+}
+
+func (d *breakerDB) GetBalanceAsOf(ctx context.Context, username string, t time.Time) (map[string]int64, error) {
+	return guard(d.breaker, func() (map[string]int64, error) { return d.next.GetBalanceAsOf(ctx, username, t) })
+}
+
+func (d *breakerDB) GetTopUsers(ctx context.Context, offset, limit int) ([]CoinDetails, error) {
+	return guard(d.breaker, func() ([]CoinDetails, error) { return d.next.GetTopUsers(ctx, offset, limit) })
+}
+
+func (d *breakerDB) SetupDatabase() error {
+	return d.next.SetupDatabase()
+}
+
+func (d *breakerDB) Ping(ctx context.Context) error {
+	return d.next.Ping(ctx)
+}
+
+func (d *breakerDB) Close() error {
+	return d.next.Close()
+}
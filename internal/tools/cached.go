@@ -0,0 +1,281 @@
+package tools
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/internal/config"
+	"github.com/RashedMaaitah/goapi/internal/metrics"
+	"github.com/redis/go-redis/v9"
+	log "github.com/sirupsen/logrus"
+)
+
+// redisTimeout bounds every Redis call, as a slow cache is worse than
+// none.
+const redisTimeout = 100 * time.Millisecond
+
+// coinCache keeps balances by username.
+type coinCache interface {
+	get(ctx context.Context, username string) (*CoinDetails, bool, error)
+	set(ctx context.Context, coinDetails *CoinDetails, ttl time.Duration) error
+	delete(ctx context.Context, usernames ...string) error
+	close() error
+}
+
+// cachedDB serves GetUserCoins from a cache, which the writes returning
+// balances update and the others changing them invalidate. Other methods go
+// straight to the database.
+//
+// A cache that fails is skipped with a warning. An entry it failed to
+// update or invalidate stays stale until it expires, as do entries in the
+// in-process cache of a server when another one writes.
+type cachedDB struct {
+	Database
+	cache   coinCache
+	ttl     time.Duration
+	logger  *log.Logger
+	metrics *metrics.Metrics
+}
+
+// Cache returns a Database keeping the balances GetUserCoins reads for
+// cfg.TTL, in Redis when cfg.RedisAddr is set and in process otherwise.
+func Cache(database Database, cfg config.CacheConfig, logger *log.Logger, m *metrics.Metrics) Database {
+	var cache coinCache
+	if cfg.RedisAddr != "" {
+		cache = &redisCache{client: redis.NewClient(&redis.Options{
+			Addr:         cfg.RedisAddr,
+			Password:     cfg.RedisPassword,
+			DB:           cfg.RedisDB,
+			DialTimeout:  redisTimeout,
+			ReadTimeout:  redisTimeout,
+			WriteTimeout: redisTimeout,
+			MaxRetries:   -1,
+		})}
+	} else {
+		cache = newLRUCache(cfg.Size)
+	}
+	return &cachedDB{Database: database, cache: cache, ttl: cfg.TTL.Duration(), logger: logger, metrics: m}
+}
+
+func (d *cachedDB) GetUserCoins(ctx context.Context, username string) (*CoinDetails, error) {
+	coinDetails, ok, err := d.cache.get(ctx, username)
+	switch {
+	case err != nil:
+		d.logger.Warnf("Balance cache: reading %s: %v", username, err)
+		d.metrics.CacheLookups.Inc("error")
+	case ok:
+		d.metrics.CacheLookups.Inc("hit")
+		return coinDetails, nil
+	default:
+		d.metrics.CacheLookups.Inc("miss")
+	}
+
+	var cacheErr error = err
+	coinDetails, err = d.Database.GetUserCoins(ctx, username)
+	if err == nil && cacheErr == nil {
+		d.update(ctx, username, coinDetails, nil)
+	}
+	return coinDetails, err
+}
+
+// update caches the balances a write of username returned. A version
+// conflict forgets them instead, as the version the caller had may have
+// been read from a stale entry.
+func (d *cachedDB) update(ctx context.Context, username string, coinDetails *CoinDetails, err error) {
+	if errors.Is(err, ErrVersionConflict) {
+		d.invalidate(ctx, username)
+	}
+	if err != nil {
+		return
+	}
+	if err = d.cache.set(ctx, coinDetails, d.ttl); err != nil {
+		d.logger.Warnf("Balance cache: storing %s: %v", username, err)
+	}
+}
+
+func (d *cachedDB) invalidate(ctx context.Context, usernames ...string) {
+	if err := d.cache.delete(ctx, usernames...); err != nil {
+		d.logger.Warnf("Balance cache: invalidating %v: %v", usernames, err)
+	}
+}
+
+func (d *cachedDB) AdjustUserCoins(ctx context.Context, username string, currency string, delta int64, version int64) (*CoinDetails, error) {
+	coinDetails, err := d.Database.AdjustUserCoins(ctx, username, currency, delta, version)
+	d.update(ctx, username, coinDetails, err)
+	return coinDetails, err
+}
+
+func (d *cachedDB) AdminAdjustCoins(ctx context.Context, username string, adjustment AdminAdjustment) (*CoinDetails, error) {
+	coinDetails, err := d.Database.AdminAdjustCoins(ctx, username, adjustment)
+	d.update(ctx, username, coinDetails, err)
+	return coinDetails, err
+}
+
+func (d *cachedDB) SetOverdraft(ctx context.Context, username string, limit int64) (*CoinDetails, error) {
+	coinDetails, err := d.Database.SetOverdraft(ctx, username, limit)
+	d.update(ctx, username, coinDetails, err)
+	return coinDetails, err
+}
+
+func (d *cachedDB) SetFrozen(ctx context.Context, username string, frozen bool, actor string, reason string) (*CoinDetails, error) {
+	coinDetails, err := d.Database.SetFrozen(ctx, username, frozen, actor, reason)
+	d.update(ctx, username, coinDetails, err)
+	return coinDetails, err
+}
+
+func (d *cachedDB) Transfer(ctx context.Context, from string, to string, currency string, amount int64) (*TransferDetails, error) {
+	transfer, err := d.Database.Transfer(ctx, from, to, currency, amount)
+	if err == nil {
+		d.invalidate(ctx, from, to)
+	}
+	return transfer, err
+}
+
+func (d *cachedDB) DeleteUser(ctx context.Context, username string) error {
+	var err error = d.Database.DeleteUser(ctx, username)
+	if err == nil {
+		d.invalidate(ctx, username)
+	}
+	return err
+}
+
+func (d *cachedDB) RestoreUser(ctx context.Context, username string) error {
+	var err error = d.Database.RestoreUser(ctx, username)
+	if err == nil {
+		d.invalidate(ctx, username)
+	}
+	return err
+}
+
+func (d *cachedDB) Close() error {
+	return errors.Join(d.cache.close(), d.Database.Close())
+}
+
+// lruCache is the in-process cache, holding at most size users and
+// dropping the least recently used first.
+type lruCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type lruEntry struct {
+	coinDetails CoinDetails
+	expires     time.Time
+}
+
+func newLRUCache(size int) *lruCache {
+	return &lruCache{size: size, order: list.New(), entries: map[string]*list.Element{}}
+}
+
+// copyCoins copies the balances of c, so the cached ones can't be changed
+// through what a caller got.
+func copyCoins(c CoinDetails) *CoinDetails {
+	c.Balances = maps.Clone(c.Balances)
+	return &c
+}
+
+func (c *lruCache) get(_ context.Context, username string) (*CoinDetails, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[username]
+	if !ok {
+		return nil, false, nil
+	}
+	var entry *lruEntry = element.Value.(*lruEntry)
+	if !time.Now().Before(entry.expires) {
+		c.order.Remove(element)
+		delete(c.entries, username)
+		return nil, false, nil
+	}
+	c.order.MoveToFront(element)
+	return copyCoins(entry.coinDetails), true, nil
+}
+
+func (c *lruCache) set(_ context.Context, coinDetails *CoinDetails, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var entry = &lruEntry{coinDetails: *copyCoins(*coinDetails), expires: time.Now().Add(ttl)}
+	if element, ok := c.entries[coinDetails.Username]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return nil
+	}
+
+	c.entries[coinDetails.Username] = c.order.PushFront(entry)
+	if c.order.Len() > c.size {
+		var oldest *list.Element = c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry).coinDetails.Username)
+	}
+	return nil
+}
+
+func (c *lruCache) delete(_ context.Context, usernames ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, username := range usernames {
+		if element, ok := c.entries[username]; ok {
+			c.order.Remove(element)
+			delete(c.entries, username)
+		}
+	}
+	return nil
+}
+
+func (c *lruCache) close() error { return nil }
+
+// redisCache keeps balances as JSON under goapi:coins:<username>, shared
+// by every server using the same Redis.
+type redisCache struct {
+	client *redis.Client
+}
+
+func redisKey(username string) string {
+	return "goapi:coins:" + username
+}
+
+func (c *redisCache) get(ctx context.Context, username string) (*CoinDetails, bool, error) {
+	data, err := c.client.Get(ctx, redisKey(username)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	var coinDetails CoinDetails
+	if err = json.Unmarshal(data, &coinDetails); err != nil {
+		return nil, false, err
+	}
+	return &coinDetails, true, nil
+}
+
+func (c *redisCache) set(ctx context.Context, coinDetails *CoinDetails, ttl time.Duration) error {
+	data, err := json.Marshal(coinDetails)
+	if err != nil {
+		return err
+	}
+	return c.client.Set(ctx, redisKey(coinDetails.Username), data, ttl).Err()
+}
+
+func (c *redisCache) delete(ctx context.Context, usernames ...string) error {
+	var keys = make([]string, 0, len(usernames))
+	for _, username := range usernames {
+		keys = append(keys, redisKey(username))
+	}
+	return c.client.Del(ctx, keys...).Err()
+}
+
+func (c *redisCache) close() error {
+	return c.client.Close()
+}
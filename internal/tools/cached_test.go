@@ -0,0 +1,134 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/internal/config"
+	"github.com/RashedMaaitah/goapi/internal/metrics"
+)
+
+// countingDB counts the balance reads reaching the database, which wait
+// for gate to be closed when it is set.
+type countingDB struct {
+	Database
+	reads atomic.Int64
+	gate  chan struct{}
+}
+
+func (d *countingDB) GetUserCoins(ctx context.Context, username string) (*CoinDetails, error) {
+	d.reads.Add(1)
+	if d.gate != nil {
+		<-d.gate
+	}
+	return d.Database.GetUserCoins(ctx, username)
+}
+
+// counts returns the series of the counter e exports as name.
+func counts(t *testing.T, e *metrics.Expvar, name string) map[string]float64 {
+	t.Helper()
+	var rec = httptest.NewRecorder()
+	e.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	var vars map[string]json.RawMessage
+	if err := json.Unmarshal(rec.Body.Bytes(), &vars); err != nil {
+		t.Fatal(err)
+	}
+	var series = map[string]float64{}
+	if raw, ok := vars[name]; ok {
+		json.Unmarshal(raw, &series)
+	}
+	return series
+}
+
+// cached returns alex's database behind the cache of cfg.
+func cached(t *testing.T, cfg config.CacheConfig) (Database, *countingDB, *metrics.Expvar) {
+	var counting = &countingDB{Database: NewMockDB(testLogger())}
+	var exporter = metrics.NewExpvar()
+	var database Database = Cache(counting, cfg, testLogger(), metrics.New(exporter))
+	t.Cleanup(func() { database.Close() })
+	return database, counting, exporter
+}
+
+func TestCacheInvalidatedByDeposit(t *testing.T) {
+	var database, counting, exporter = cached(t, config.CacheConfig{TTL: config.Duration(time.Minute), Size: 10})
+	var ctx = context.Background()
+
+	for range 3 {
+		if coins, err := database.GetUserCoins(ctx, "alex"); err != nil || coins.Coins != 1000 {
+			t.Fatalf("GetUserCoins = %+v, %v, want 1000", coins, err)
+		}
+	}
+	if counting.reads.Load() != 1 {
+		t.Errorf("%d reads reached the database, want 1", counting.reads.Load())
+	}
+
+	if _, err := database.AdjustUserCoins(ctx, "alex", DefaultCurrency, 50, 0); err != nil {
+		t.Fatal(err)
+	}
+	if coins, err := database.GetUserCoins(ctx, "alex"); err != nil || coins.Coins != 1050 {
+		t.Fatalf("GetUserCoins after a deposit = %+v, %v, want 1050", coins, err)
+	}
+
+	// A transfer invalidates both balances instead.
+	if _, err := database.Transfer(ctx, "alex", "maria", DefaultCurrency, 50); err != nil {
+		t.Fatal(err)
+	}
+	if coins, err := database.GetUserCoins(ctx, "alex"); err != nil || coins.Coins != 1000 {
+		t.Fatalf("GetUserCoins after a transfer = %+v, %v, want 1000", coins, err)
+	}
+	if counting.reads.Load() != 2 {
+		t.Errorf("%d reads reached the database, want 2", counting.reads.Load())
+	}
+
+	var lookups = counts(t, exporter, "goapi_cache_lookups_total")
+	if lookups["result=hit"] != 3 || lookups["result=miss"] != 2 {
+		t.Errorf("lookups = %v, want 3 hits and 2 misses", lookups)
+	}
+}
+
+func TestCacheEntriesExpire(t *testing.T) {
+	var database, counting, _ = cached(t, config.CacheConfig{TTL: config.Duration(time.Millisecond), Size: 10})
+
+	database.GetUserCoins(context.Background(), "alex")
+	time.Sleep(5 * time.Millisecond)
+	database.GetUserCoins(context.Background(), "alex")
+
+	if counting.reads.Load() != 2 {
+		t.Errorf("%d reads reached the database, want 2", counting.reads.Load())
+	}
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	var database, counting, _ = cached(t, config.CacheConfig{TTL: config.Duration(time.Minute), Size: 2})
+	var ctx = context.Background()
+
+	for _, username := range []string{"alex", "maria", "alex", "john", "alex", "maria"} {
+		database.GetUserCoins(ctx, username)
+	}
+	// maria was dropped for john, then john for her.
+	if counting.reads.Load() != 4 {
+		t.Errorf("%d reads reached the database, want 4", counting.reads.Load())
+	}
+}
+
+func TestCacheFailureFallsBackToDatabase(t *testing.T) {
+	// Nothing listens on port 1.
+	var database, counting, exporter = cached(t, config.CacheConfig{TTL: config.Duration(time.Minute), RedisAddr: "127.0.0.1:1"})
+
+	for range 2 {
+		if coins, err := database.GetUserCoins(context.Background(), "alex"); err != nil || coins.Coins != 1000 {
+			t.Fatalf("GetUserCoins = %+v, %v, want 1000", coins, err)
+		}
+	}
+	if counting.reads.Load() != 2 {
+		t.Errorf("%d reads reached the database, want 2", counting.reads.Load())
+	}
+	if lookups := counts(t, exporter, "goapi_cache_lookups_total"); lookups["result=error"] != 2 {
+		t.Errorf("lookups = %v, want 2 errors", lookups)
+	}
+}
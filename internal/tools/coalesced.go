@@ -0,0 +1,142 @@
+package tools
+
+import (
+	"context"
+
+	"github.com/RashedMaaitah/goapi/internal/metrics"
+	"golang.org/x/sync/singleflight"
+)
+
+// coalescedDB makes concurrent GetUserCoins, and GetUserLoginDetails, of the
+// same user share one call to the database, each caller getting a copy of
+// its result. The writes changing what they return forget the call in
+// flight, so a read made after a write doesn't get what was read before it.
+type coalescedDB struct {
+	Database
+	coins   singleflight.Group
+	logins  singleflight.Group
+	metrics *metrics.Metrics
+}
+
+// Coalesce returns a Database sharing concurrent identical reads of database.
+func Coalesce(database Database, m *metrics.Metrics) Database {
+	return &coalescedDB{Database: database, metrics: m}
+}
+
+// share makes call once for the concurrent callers with the same key. The
+// call is made without the cancellation of the caller starting it, so its
+// giving up doesn't fail the others, but with its deadline.
+func share[T any](ctx context.Context, d *coalescedDB, group *singleflight.Group, method string, key string, call func(ctx context.Context) (T, error)) (T, error) {
+	var made bool
+	var results <-chan singleflight.Result = group.DoChan(key, func() (any, error) {
+		made = true
+
+		var shared context.Context = context.WithoutCancel(ctx)
+		if deadline, ok := ctx.Deadline(); ok {
+			var cancel context.CancelFunc
+			shared, cancel = context.WithDeadline(shared, deadline)
+			defer cancel()
+		}
+		return call(shared)
+	})
+
+	select {
+	case result := <-results:
+		if !made {
+			d.metrics.DBCoalesced.Inc(method)
+		}
+		value, _ := result.Val.(T)
+		return value, result.Err
+	case <-ctx.Done():
+		var zero T
+		return zero, context.Cause(ctx)
+	}
+}
+
+func (d *coalescedDB) GetUserCoins(ctx context.Context, username string) (*CoinDetails, error) {
+	coinDetails, err := share(ctx, d, &d.coins, "GetUserCoins", username, func(ctx context.Context) (*CoinDetails, error) {
+		return d.Database.GetUserCoins(ctx, username)
+	})
+	if coinDetails != nil {
+		coinDetails = copyCoins(*coinDetails)
+	}
+	return coinDetails, err
+}
+
+func (d *coalescedDB) GetUserLoginDetails(ctx context.Context, username string) (*LoginDetails, error) {
+	loginDetails, err := share(ctx, d, &d.logins, "GetUserLoginDetails", username, func(ctx context.Context) (*LoginDetails, error) {
+		return d.Database.GetUserLoginDetails(ctx, username)
+	})
+	if loginDetails != nil {
+		var copied LoginDetails = *loginDetails
+		loginDetails = &copied
+	}
+	return loginDetails, err
+}
+
+func (d *coalescedDB) AdjustUserCoins(ctx context.Context, username string, currency string, delta int64, version int64) (*CoinDetails, error) {
+	defer d.coins.Forget(username)
+	return d.Database.AdjustUserCoins(ctx, username, currency, delta, version)
+}
+
+func (d *coalescedDB) AdminAdjustCoins(ctx context.Context, username string, adjustment AdminAdjustment) (*CoinDetails, error) {
+	defer d.coins.Forget(username)
+	return d.Database.AdminAdjustCoins(ctx, username, adjustment)
+}
+
+func (d *coalescedDB) SetOverdraft(ctx context.Context, username string, limit int64) (*CoinDetails, error) {
+	defer d.coins.Forget(username)
+	return d.Database.SetOverdraft(ctx, username, limit)
+}
+
+func (d *coalescedDB) SetFrozen(ctx context.Context, username string, frozen bool, actor string, reason string) (*CoinDetails, error) {
+	defer d.coins.Forget(username)
+	return d.Database.SetFrozen(ctx, username, frozen, actor, reason)
+}
+
+func (d *coalescedDB) Transfer(ctx context.Context, from string, to string, currency string, amount int64) (*TransferDetails, error) {
+	defer d.coins.Forget(to)
+	defer d.coins.Forget(from)
+	return d.Database.Transfer(ctx, from, to, currency, amount)
+}
+
+// CreateUser and ImportUsers forget the reads in flight too, which may
+// still find no such user.
+func (d *coalescedDB) CreateUser(ctx context.Context, username string, passwordHash string) (*LoginDetails, error) {
+	defer d.forget(username)
+	return d.Database.CreateUser(ctx, username, passwordHash)
+}
+
+func (d *coalescedDB) ImportUsers(ctx context.Context, users []NewUser, atomic bool) ([]error, error) {
+	defer func() {
+		for _, user := range users {
+			d.forget(user.Username)
+		}
+	}()
+	return d.Database.ImportUsers(ctx, users, atomic)
+}
+
+func (d *coalescedDB) UpdateUser(ctx context.Context, username string, update UserUpdate) (*LoginDetails, error) {
+	defer d.logins.Forget(username)
+	return d.Database.UpdateUser(ctx, username, update)
+}
+
+func (d *coalescedDB) UpdatePassword(ctx context.Context, username string, passwordHash string) error {
+	defer d.logins.Forget(username)
+	return d.Database.UpdatePassword(ctx, username, passwordHash)
+}
+
+func (d *coalescedDB) DeleteUser(ctx context.Context, username string) error {
+	defer d.forget(username)
+	return d.Database.DeleteUser(ctx, username)
+}
+
+func (d *coalescedDB) RestoreUser(ctx context.Context, username string) error {
+	defer d.forget(username)
+	return d.Database.RestoreUser(ctx, username)
+}
+
+func (d *coalescedDB) forget(username string) {
+	d.coins.Forget(username)
+	d.logins.Forget(username)
+}
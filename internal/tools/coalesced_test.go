@@ -0,0 +1,132 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/internal/metrics"
+)
+
+// coalesced returns the mock database behind Coalesce, its balance reads
+// held until the gate is closed.
+func coalesced(t *testing.T) (Database, *countingDB, *metrics.Expvar) {
+	var counting = &countingDB{Database: NewMockDB(testLogger()), gate: make(chan struct{})}
+	var exporter = metrics.NewExpvar()
+	var database Database = Coalesce(counting, metrics.New(exporter))
+	t.Cleanup(func() { database.Close() })
+	return database, counting, exporter
+}
+
+// waitForReads waits for n reads to reach counting.
+func waitForReads(t *testing.T, counting *countingDB, n int64) {
+	t.Helper()
+	var deadline = time.Now().Add(5 * time.Second)
+	for counting.reads.Load() < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d reads reached the database, want %d", counting.reads.Load(), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCoalesceConcurrentReads(t *testing.T) {
+	var database, counting, exporter = coalesced(t)
+	const callers = 100
+	if _, err := counting.Database.AdjustUserCoins(context.Background(), "alex", "eur", 5, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	var started, done sync.WaitGroup
+	var results = make([]*CoinDetails, callers)
+	var errs = make([]error, callers)
+	for i := range callers {
+		started.Add(1)
+		done.Go(func() {
+			started.Done()
+			results[i], errs[i] = database.GetUserCoins(context.Background(), "alex")
+		})
+	}
+	started.Wait()
+	waitForReads(t, counting, 1)
+	// Let the callers that started catch up with the read in flight.
+	time.Sleep(50 * time.Millisecond)
+	close(counting.gate)
+	done.Wait()
+
+	if counting.reads.Load() != 1 {
+		t.Errorf("%d reads reached the database, want 1", counting.reads.Load())
+	}
+	for i := range callers {
+		if errs[i] != nil || results[i].Coins != 1000 {
+			t.Fatalf("caller %d got %+v, %v", i, results[i], errs[i])
+		}
+	}
+
+	// Each caller has a copy of its own.
+	results[0].Balances["eur"] = 0
+	if results[1].Balances["eur"] != 5 {
+		t.Error("the callers share the balances they got")
+	}
+
+	if coalesced := counts(t, exporter, "goapi_db_coalesced_total"); coalesced["method=GetUserCoins"] != callers-1 {
+		t.Errorf("coalesced = %v, want %d", coalesced, callers-1)
+	}
+}
+
+func TestCoalescedCallerGivingUp(t *testing.T) {
+	var database, counting, _ = coalesced(t)
+
+	var result = make(chan error)
+	go func() {
+		coins, err := database.GetUserCoins(context.Background(), "alex")
+		if err == nil && coins.Coins != 1000 {
+			err = errors.New("wrong balance")
+		}
+		result <- err
+	}()
+	waitForReads(t, counting, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	if _, err := database.GetUserCoins(ctx, "alex"); !errors.Is(err, context.Canceled) {
+		t.Errorf("canceled caller got %v, want context.Canceled", err)
+	}
+
+	// The call it joined goes on for the other.
+	close(counting.gate)
+	if err := <-result; err != nil {
+		t.Errorf("the caller starting the read got %v", err)
+	}
+}
+
+func TestCoalescedReadAfterWrite(t *testing.T) {
+	var database, counting, _ = coalesced(t)
+
+	var before = make(chan int64)
+	go func() {
+		coins, _ := database.GetUserCoins(context.Background(), "alex")
+		before <- coins.Coins
+	}()
+	waitForReads(t, counting, 1)
+
+	if _, err := database.AdjustUserCoins(context.Background(), "alex", DefaultCurrency, 50, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// A read after the write doesn't join the one in flight before it.
+	var after = make(chan int64)
+	go func() {
+		coins, _ := database.GetUserCoins(context.Background(), "alex")
+		after <- coins.Coins
+	}()
+	waitForReads(t, counting, 2)
+	close(counting.gate)
+
+	<-before
+	if coins := <-after; coins != 1050 {
+		t.Errorf("read after the deposit got %d, want 1050", coins)
+	}
+}
@@ -0,0 +1,716 @@
+package tools
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/internal/config"
+	"github.com/RashedMaaitah/goapi/internal/ledger"
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// testLogger discards what the databases log.
+func testLogger() *log.Logger {
+	var logger = log.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}
+
+// testDatabase is the conformance suite every Database must pass, on a
+// database open returns set up. It only touches the users, sessions, keys
+// and audit entries it creates, named apart from those of any other run,
+// so it can share a database running elsewhere.
+func testDatabase(t *testing.T, open func(t *testing.T) Database) {
+	var database Database = open(t)
+	t.Cleanup(func() { database.Close() })
+
+	var suffix = make([]byte, 4)
+	rand.Read(suffix)
+	var prefix string = "t" + hex.EncodeToString(suffix) + "_"
+	var ctx = context.Background()
+
+	// user creates a user holding coins.
+	var user = func(t *testing.T, name string, coins int64) string {
+		t.Helper()
+		var username string = prefix + name
+		if _, err := database.CreateUser(ctx, username, "hash-of-"+name); err != nil {
+			t.Fatalf("CreateUser(%s): %v", username, err)
+		}
+		if coins > 0 {
+			if _, err := database.AdjustUserCoins(ctx, username, DefaultCurrency, coins, 0); err != nil {
+				t.Fatalf("AdjustUserCoins(%s): %v", username, err)
+			}
+		}
+		return username
+	}
+	var balance = func(t *testing.T, username string) int64 {
+		t.Helper()
+		coins, err := database.GetUserCoins(ctx, username)
+		if err != nil {
+			t.Fatalf("GetUserCoins(%s): %v", username, err)
+		}
+		return coins.Coins
+	}
+
+	t.Run("users", func(t *testing.T) {
+		var username string = user(t, "users", 0)
+
+		loginDetails, err := database.GetUserLoginDetails(ctx, username)
+		if err != nil || loginDetails.Username != username || loginDetails.PasswordHash != "hash-of-users" || loginDetails.Role != RoleUser {
+			t.Fatalf("GetUserLoginDetails = %+v, %v", loginDetails, err)
+		}
+		if _, err = database.CreateUser(ctx, username, "other"); !errors.Is(err, ErrUserExists) {
+			t.Errorf("CreateUser of a taken name = %v, want ErrUserExists", err)
+		}
+		if _, err = database.GetUserLoginDetails(ctx, prefix+"nobody"); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("GetUserLoginDetails of an unknown user = %v, want ErrUserNotFound", err)
+		}
+		if _, err = database.GetUserCoins(ctx, prefix+"nobody"); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("GetUserCoins of an unknown user = %v, want ErrUserNotFound", err)
+		}
+
+		var name = "Users Tester"
+		updated, err := database.UpdateUser(ctx, username, UserUpdate{DisplayName: &name})
+		if err != nil || updated.DisplayName != name {
+			t.Errorf("UpdateUser = %+v, %v", updated, err)
+		}
+		if err = database.UpdatePassword(ctx, username, "new-hash"); err != nil {
+			t.Fatal(err)
+		}
+		if loginDetails, _ = database.GetUserLoginDetails(ctx, username); loginDetails.PasswordHash != "new-hash" {
+			t.Errorf("PasswordHash = %q after UpdatePassword", loginDetails.PasswordHash)
+		}
+	})
+
+	t.Run("soft delete", func(t *testing.T) {
+		var username string = user(t, "deleted", 10)
+
+		if err := database.DeleteUser(ctx, username); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := database.GetUserLoginDetails(ctx, username); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("GetUserLoginDetails of a deleted user = %v, want ErrUserNotFound", err)
+		}
+		if loginDetails, err := database.GetUserIncludingDeleted(ctx, username); err != nil || !loginDetails.Deleted() {
+			t.Errorf("GetUserIncludingDeleted = %+v, %v, want it deleted", loginDetails, err)
+		}
+
+		if err := database.RestoreUser(ctx, username); err != nil {
+			t.Fatal(err)
+		}
+		if balance(t, username) != 10 {
+			t.Errorf("balance after RestoreUser = %d, want 10", balance(t, username))
+		}
+	})
+
+	t.Run("adjust coins", func(t *testing.T) {
+		var username string = user(t, "adjust", 100)
+
+		coins, err := database.AdjustUserCoins(ctx, username, DefaultCurrency, -40, 0)
+		if err != nil || coins.Coins != 60 {
+			t.Fatalf("withdrawal = %+v, %v, want 60", coins, err)
+		}
+		if _, err = database.AdjustUserCoins(ctx, username, DefaultCurrency, -61, 0); !errors.Is(err, ErrInsufficientFunds) {
+			t.Errorf("overdrawing withdrawal = %v, want ErrInsufficientFunds", err)
+		}
+		if _, err = database.AdjustUserCoins(ctx, username, DefaultCurrency, 1, coins.Version-1); !errors.Is(err, ErrVersionConflict) {
+			t.Errorf("write of an old version = %v, want ErrVersionConflict", err)
+		}
+
+		coins, err = database.AdjustUserCoins(ctx, username, "eur", 25, coins.Version)
+		if err != nil || coins.Balance("eur") != 25 || coins.Coins != 60 {
+			t.Errorf("deposit of eur = %+v, %v, want 25 eur and 60 coins", coins, err)
+		}
+
+		if _, err = database.SetOverdraft(ctx, username, 50); err != nil {
+			t.Fatal(err)
+		}
+		if coins, err = database.AdjustUserCoins(ctx, username, DefaultCurrency, -100, 0); err != nil || coins.Coins != -40 {
+			t.Errorf("withdrawal into the overdraft = %+v, %v, want -40", coins, err)
+		}
+	})
+
+	t.Run("concurrent withdrawals", func(t *testing.T) {
+		// Enough for 142 of the 300 withdrawals of 7, leaving 6.
+		var username string = user(t, "concurrent", 1000)
+
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		var withdrawals int64
+		for range 300 {
+			wg.Go(func() {
+				_, err := database.AdjustUserCoins(ctx, username, DefaultCurrency, -7, 0)
+				if err == nil {
+					mu.Lock()
+					withdrawals++
+					mu.Unlock()
+				} else if !errors.Is(err, ErrInsufficientFunds) {
+					t.Errorf("withdrawal: %v", err)
+				}
+			})
+		}
+		wg.Wait()
+
+		if withdrawals != 142 {
+			t.Errorf("%d withdrawals of 7 succeeded, want 142", withdrawals)
+		}
+		if got := balance(t, username); got != 1000-7*withdrawals || got != 6 {
+			t.Errorf("balance = %d after %d withdrawals of 7 from 1000, want 6", got, withdrawals)
+		}
+		drift, err := database.VerifyLedger(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, d := range drift {
+			if d.Account == username {
+				t.Errorf("drift = %+v, want the ledger to match the balance", d)
+			}
+		}
+	})
+
+	t.Run("balance overflow", func(t *testing.T) {
+		// In a currency of its own, and with the sender's 10 filling the
+		// rest, the ledger sums of the system account stay in an int64,
+		// which SQLite's SUM errors out of.
+		const currency = "xts"
+		const largest = math.MaxInt64 - 9
+		var username string = user(t, "overflow", 0)
+		var sender string = user(t, "overflowsender", 0)
+		for who, coins := range map[string]int64{sender: 10, username: largest} {
+			if _, err := database.AdjustUserCoins(ctx, who, currency, coins, 0); err != nil {
+				t.Fatal(err)
+			}
+		}
+		t.Cleanup(func() {
+			if _, err := database.AdjustUserCoins(ctx, username, currency, -largest, 0); err != nil {
+				t.Error(err)
+			}
+		})
+		var balanceOf = func(username string) int64 {
+			t.Helper()
+			coins, err := database.GetUserCoins(ctx, username)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return coins.Balance(currency)
+		}
+
+		if _, err := database.AdjustUserCoins(ctx, username, currency, 10, 0); !errors.Is(err, ErrBalanceOverflow) {
+			t.Errorf("deposit past the largest balance = %v, want ErrBalanceOverflow", err)
+		}
+		if got := balanceOf(username); got != largest {
+			t.Errorf("balance = %d, want %d untouched", got, int64(largest))
+		}
+
+		// Below the smallest balance too, which only a forced adjustment
+		// gets near.
+		var admin string = user(t, "overflowadmin", 0)
+		if _, err := database.AdminAdjustCoins(ctx, admin, AdminAdjustment{Delta: -5, Force: true, Actor: "root"}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := database.AdminAdjustCoins(ctx, admin, AdminAdjustment{Delta: math.MinInt64, Force: true, Actor: "root"}); !errors.Is(err, ErrBalanceOverflow) {
+			t.Errorf("admin adjustment past the smallest balance = %v, want ErrBalanceOverflow", err)
+		}
+
+		_, err := database.Transfer(ctx, sender, username, currency, 10)
+		if errors.Is(err, ErrNoTransactions) {
+			t.Skip(err)
+		}
+		if !errors.Is(err, ErrBalanceOverflow) {
+			t.Errorf("transfer past the largest balance = %v, want ErrBalanceOverflow", err)
+		}
+		if got := balanceOf(sender); got != 10 {
+			t.Errorf("balance of the sender = %d, want 10 untouched", got)
+		}
+		if got := balanceOf(username); got != largest {
+			t.Errorf("balance = %d, want %d untouched", got, int64(largest))
+		}
+	})
+
+	t.Run("admin adjustments and freezing", func(t *testing.T) {
+		var username string = user(t, "admin", 10)
+
+		coins, err := database.AdminAdjustCoins(ctx, username, AdminAdjustment{Set: true, Balance: 500, Actor: "root", Reason: "test"})
+		if err != nil || coins.Coins != 500 {
+			t.Fatalf("AdminAdjustCoins = %+v, %v, want 500", coins, err)
+		}
+		if _, err = database.AdminAdjustCoins(ctx, username, AdminAdjustment{Delta: -600, Actor: "root"}); !errors.Is(err, ErrInsufficientFunds) {
+			t.Errorf("negative result without Force = %v, want ErrInsufficientFunds", err)
+		}
+
+		if coins, err = database.SetFrozen(ctx, username, true, "root", "test"); err != nil || !coins.Frozen {
+			t.Fatalf("SetFrozen = %+v, %v", coins, err)
+		}
+		if _, err = database.AdjustUserCoins(ctx, username, DefaultCurrency, 1, 0); !errors.Is(err, ErrAccountFrozen) {
+			t.Errorf("deposit to a frozen account = %v, want ErrAccountFrozen", err)
+		}
+		if coins, err = database.SetFrozen(ctx, username, false, "root", "test"); err != nil || coins.Frozen {
+			t.Errorf("SetFrozen(false) = %+v, %v", coins, err)
+		}
+	})
+
+	t.Run("transfer", func(t *testing.T) {
+		var from, to string = user(t, "from", 100), user(t, "to", 5)
+
+		transfer, err := database.Transfer(ctx, from, to, DefaultCurrency, 30)
+		if errors.Is(err, ErrNoTransactions) {
+			t.Skip(err)
+		}
+		if err != nil || transfer.ID == "" || transfer.FromCoins != 70 || transfer.ToCoins != 35 {
+			t.Fatalf("Transfer = %+v, %v, want 70 and 35", transfer, err)
+		}
+		if balance(t, from) != 70 || balance(t, to) != 35 {
+			t.Errorf("balances = %d and %d, want 70 and 35", balance(t, from), balance(t, to))
+		}
+
+		for _, tt := range []struct {
+			name     string
+			from, to string
+			amount   int64
+			want     error
+		}{
+			{"insufficient funds", from, to, 71, ErrInsufficientFunds},
+			{"to oneself", from, from, 1, ErrSelfTransfer},
+			{"unknown recipient", from, prefix + "nobody", 1, ErrUserNotFound},
+			{"unknown sender", prefix + "nobody", to, 1, ErrSenderNotFound},
+		} {
+			if _, err = database.Transfer(ctx, tt.from, tt.to, DefaultCurrency, tt.amount); !errors.Is(err, tt.want) {
+				t.Errorf("Transfer with %s = %v, want %v", tt.name, err, tt.want)
+			}
+		}
+		if balance(t, from) != 70 || balance(t, to) != 35 {
+			t.Errorf("balances changed by failed transfers to %d and %d", balance(t, from), balance(t, to))
+		}
+
+		if err = database.DeleteUser(ctx, to); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = database.Transfer(ctx, from, to, DefaultCurrency, 1); !errors.Is(err, ErrUserDeleted) {
+			t.Errorf("Transfer to a deleted user = %v, want ErrUserDeleted", err)
+		}
+		if _, err = database.Transfer(ctx, to, from, DefaultCurrency, 1); !errors.Is(err, ErrSenderNotFound) {
+			t.Errorf("Transfer from a deleted user = %v, want ErrSenderNotFound", err)
+		}
+
+		entries, err := database.LedgerEntries(ctx, transfer.ID)
+		if err != nil || len(entries) != 2 {
+			t.Errorf("LedgerEntries = %+v, %v, want a debit and a credit", entries, err)
+		}
+	})
+
+	t.Run("transactions", func(t *testing.T) {
+		var username string = user(t, "history", 50)
+		database.AdjustUserCoins(ctx, username, DefaultCurrency, -20, 0)
+		database.AdjustUserCoins(ctx, username, DefaultCurrency, 5, 0)
+
+		transactions, err := database.ListTransactions(ctx, username, 10, 0)
+		if err != nil || len(transactions) != 3 {
+			t.Fatalf("ListTransactions = %+v, %v, want 3", transactions, err)
+		}
+		var types []string
+		for _, transaction := range transactions {
+			types = append(types, transaction.Type)
+		}
+		if strings.Join(types, ",") != "deposit,withdrawal,deposit" || transactions[0].Balance != 35 {
+			t.Errorf("transactions = %+v, want newest first", transactions)
+		}
+
+		older, err := database.ListTransactions(ctx, username, 10, transactions[0].Seq)
+		if err != nil || len(older) != 2 || older[0].Seq != transactions[1].Seq {
+			t.Errorf("ListTransactions before %d = %+v, %v", transactions[0].Seq, older, err)
+		}
+	})
+
+	t.Run("balance as of", func(t *testing.T) {
+		var before = time.Now().Add(-time.Second)
+		var username string = user(t, "asof", 40)
+
+		balances, err := database.GetBalanceAsOf(ctx, username, time.Now().Add(time.Second))
+		if err != nil || balances[DefaultCurrency] != 40 {
+			t.Errorf("GetBalanceAsOf now = %v, %v, want 40", balances, err)
+		}
+		if _, err = database.GetBalanceAsOf(ctx, username, before); !errors.Is(err, ErrNoBalanceYet) {
+			t.Errorf("GetBalanceAsOf before the user = %v, want ErrNoBalanceYet", err)
+		}
+	})
+
+	t.Run("ledger", func(t *testing.T) {
+		var username string = user(t, "ledger", 15)
+
+		drifts, err := database.VerifyLedger(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, drift := range drifts {
+			if drift.Account == username {
+				t.Errorf("drift of %s: %+v", username, drift)
+			}
+		}
+	})
+
+	t.Run("top users", func(t *testing.T) {
+		var last, first, middle = user(t, "top_c", 1e12), user(t, "top_a", 3e12), user(t, "top_b", 1e12)
+
+		top, err := database.GetTopUsers(ctx, 0, 1000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ranked []string
+		for _, coins := range top {
+			if strings.HasPrefix(coins.Username, prefix+"top_") {
+				ranked = append(ranked, coins.Username)
+			}
+		}
+		if want := []string{first, middle, last}; strings.Join(ranked, ",") != strings.Join(want, ",") {
+			t.Errorf("ranked %v, want %v", ranked, want)
+		}
+	})
+
+	t.Run("search and stats", func(t *testing.T) {
+		var username string = user(t, "search", 42)
+
+		summaries, err := database.SearchUsers(ctx, UserFilter{Prefix: username, Limit: 10})
+		if err != nil || len(summaries) != 1 || summaries[0].Coins != 42 {
+			t.Errorf("SearchUsers = %+v, %v", summaries, err)
+		}
+
+		stats, err := database.GetStats(ctx, []int64{10, 100})
+		if err != nil || stats.Users == 0 || len(stats.Buckets) != 3 {
+			t.Errorf("GetStats = %+v, %v", stats, err)
+		}
+	})
+
+	t.Run("import", func(t *testing.T) {
+		var taken string = user(t, "taken", 0)
+		var users = []NewUser{{Username: prefix + "imported", PasswordHash: "h", Coins: 9}, {Username: taken, PasswordHash: "h"}}
+
+		errs, err := database.ImportUsers(ctx, users, true)
+		if err != nil || len(errs) != 2 || !errors.Is(errs[1], ErrUserExists) {
+			t.Fatalf("atomic ImportUsers = %v, %v", errs, err)
+		}
+		if _, err = database.GetUserLoginDetails(ctx, prefix+"imported"); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("atomic import created a user: %v", err)
+		}
+
+		errs, err = database.ImportUsers(ctx, users, false)
+		if err != nil || errs[0] != nil || !errors.Is(errs[1], ErrUserExists) {
+			t.Fatalf("ImportUsers = %v, %v", errs, err)
+		}
+		if balance(t, prefix+"imported") != 9 {
+			t.Errorf("imported balance = %d, want 9", balance(t, prefix+"imported"))
+		}
+	})
+
+	t.Run("case-variant usernames", func(t *testing.T) {
+		var alex, maria string = user(t, "alex", 100), user(t, "maria", 0)
+		var upper = strings.ToUpper
+
+		if coins, err := database.GetUserCoins(ctx, upper(alex)); err != nil || coins.Username != alex || coins.Coins != 100 {
+			t.Errorf("GetUserCoins(%q) = %+v, %v, want the 100 of %s", upper(alex), coins, err, alex)
+		}
+		if login, err := database.GetUserLoginDetails(ctx, " "+upper(alex)+" "); err != nil || login.Username != alex {
+			t.Errorf("GetUserLoginDetails(%q) = %+v, %v, want %s", " "+upper(alex)+" ", login, err, alex)
+		}
+
+		if _, err := database.CreateUser(ctx, upper(alex), "hash"); !errors.Is(err, ErrUserExists) {
+			t.Errorf("CreateUser(%q) = %v, want ErrUserExists", upper(alex), err)
+		}
+		errs, err := database.ImportUsers(ctx, []NewUser{{Username: upper(alex), PasswordHash: "h"}, {Username: upper(prefix + "casenew"), PasswordHash: "h"}}, false)
+		if err != nil || len(errs) != 2 || !errors.Is(errs[0], ErrUserExists) || errs[1] != nil {
+			t.Fatalf("ImportUsers of %s and %s = %v, %v, want only the first to exist", upper(alex), upper(prefix+"casenew"), errs, err)
+		}
+		if login, err := database.GetUserLoginDetails(ctx, prefix+"casenew"); err != nil || login.Username != prefix+"casenew" {
+			t.Errorf("imported user = %+v, %v, want %s", login, err, prefix+"casenew")
+		}
+
+		if _, err := database.Transfer(ctx, alex, upper(alex), DefaultCurrency, 1); !errors.Is(err, ErrSelfTransfer) && !errors.Is(err, ErrNoTransactions) {
+			t.Errorf("Transfer from %s to %s = %v, want ErrSelfTransfer", alex, upper(alex), err)
+		}
+		transfer, err := database.Transfer(ctx, upper(alex), upper(maria), DefaultCurrency, 30)
+		if errors.Is(err, ErrNoTransactions) {
+			t.Skip(err)
+		}
+		if err != nil || transfer.FromCoins != 70 || transfer.ToCoins != 30 {
+			t.Fatalf("Transfer = %+v, %v, want 70 and 30", transfer, err)
+		}
+		if balance(t, alex) != 70 || balance(t, maria) != 30 {
+			t.Errorf("balances = %d and %d, want 70 and 30", balance(t, alex), balance(t, maria))
+		}
+	})
+
+	t.Run("sessions", func(t *testing.T) {
+		var username string = user(t, "sessions", 0)
+		var first, second = HashToken(prefix + "token-1"), HashToken(prefix + "token-2")
+
+		for _, token := range []string{first, second} {
+			if err := database.CreateSession(ctx, Session{Token: token, Username: username, ExpiresAt: time.Now().Add(time.Hour), Scopes: Scopes}, false); err != nil {
+				t.Fatal(err)
+			}
+		}
+		session, err := database.GetSession(ctx, first)
+		if err != nil || session.Username != username || len(session.Scopes) != len(Scopes) {
+			t.Fatalf("GetSession = %+v, %v", session, err)
+		}
+
+		if err = database.DeleteSession(ctx, first); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = database.GetSession(ctx, first); !errors.Is(err, ErrSessionNotFound) {
+			t.Errorf("GetSession of a deleted session = %v, want ErrSessionNotFound", err)
+		}
+
+		if err = database.DeleteUserSessions(ctx, username); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = database.GetSession(ctx, second); !errors.Is(err, ErrSessionNotFound) {
+			t.Errorf("GetSession after DeleteUserSessions = %v, want ErrSessionNotFound", err)
+		}
+	})
+
+	t.Run("api keys", func(t *testing.T) {
+		var key = APIKey{ID: prefix + "key", Name: "billing", Role: RoleAdmin, Hash: HashToken(prefix + "secret"), CreatedAt: time.Now().UTC().Truncate(time.Second)}
+
+		if err := database.CreateAPIKey(ctx, key); err != nil {
+			t.Fatal(err)
+		}
+		found, err := database.GetAPIKey(ctx, key.Hash)
+		if err != nil || found.ID != key.ID || found.Role != RoleAdmin {
+			t.Fatalf("GetAPIKey = %+v, %v", found, err)
+		}
+
+		var used = time.Now().UTC().Truncate(time.Second)
+		if err = database.TouchAPIKey(ctx, key.ID, used); err != nil {
+			t.Fatal(err)
+		}
+		keys, err := database.ListAPIKeys(ctx)
+		var listed bool
+		for _, k := range keys {
+			listed = listed || k.ID == key.ID && k.LastUsedAt.Equal(used)
+		}
+		if err != nil || !listed {
+			t.Errorf("ListAPIKeys = %+v, %v, want the key used at %s", keys, err, used)
+		}
+
+		if err = database.DeleteAPIKey(ctx, key.ID); err != nil {
+			t.Fatal(err)
+		}
+		if err = database.DeleteAPIKey(ctx, key.ID); !errors.Is(err, ErrAPIKeyNotFound) {
+			t.Errorf("DeleteAPIKey again = %v, want ErrAPIKeyNotFound", err)
+		}
+		if _, err = database.GetAPIKey(ctx, key.Hash); !errors.Is(err, ErrAPIKeyNotFound) {
+			t.Errorf("GetAPIKey of a revoked key = %v, want ErrAPIKeyNotFound", err)
+		}
+	})
+
+	t.Run("idempotency keys", func(t *testing.T) {
+		var key string = prefix + "idempotency"
+		var expires = time.Now().Add(time.Hour)
+
+		if _, err := database.ReserveIdempotencyKey(ctx, key, "hash-1", expires); err != nil {
+			t.Fatal(err)
+		}
+		record, err := database.ReserveIdempotencyKey(ctx, key, "hash-2", expires)
+		if !errors.Is(err, ErrKeyReserved) || record.RequestHash != "hash-1" || record.Done {
+			t.Fatalf("ReserveIdempotencyKey of a held key = %+v, %v", record, err)
+		}
+
+		if err = database.CompleteIdempotencyKey(ctx, key, 201, "application/json", []byte(`{"ok":true}`)); err != nil {
+			t.Fatal(err)
+		}
+		record, err = database.ReserveIdempotencyKey(ctx, key, "hash-1", expires)
+		if !errors.Is(err, ErrKeyReserved) || !record.Done || record.StatusCode != 201 || string(record.Body) != `{"ok":true}` {
+			t.Fatalf("ReserveIdempotencyKey of a completed key = %+v, %v", record, err)
+		}
+
+		if err = database.ReleaseIdempotencyKey(ctx, key); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = database.ReserveIdempotencyKey(ctx, key, "hash-3", expires); err != nil {
+			t.Errorf("ReserveIdempotencyKey after ReleaseIdempotencyKey = %v", err)
+		}
+	})
+
+	t.Run("audit", func(t *testing.T) {
+		var target string = prefix + "audited"
+		for _, action := range []string{"freeze", "unfreeze"} {
+			entry, err := database.AppendAudit(ctx, AuditEntry{Actor: "root", Action: action, Target: target, Outcome: "ok"})
+			if err != nil || entry.Seq == 0 || entry.Hash != entry.ComputeHash() {
+				t.Fatalf("AppendAudit = %+v, %v", entry, err)
+			}
+		}
+
+		entries, err := database.ListAudit(ctx, AuditFilter{User: target, Limit: 10})
+		if err != nil || len(entries) != 2 || entries[0].Action != "unfreeze" {
+			t.Fatalf("ListAudit = %+v, %v, want both, newest first", entries, err)
+		}
+		for _, entry := range entries {
+			if entry.Hash != entry.ComputeHash() {
+				t.Errorf("entry %d read back with a hash that doesn't match", entry.Seq)
+			}
+		}
+	})
+
+	t.Run("ping", func(t *testing.T) {
+		if err := database.Ping(ctx); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func TestInMemoryDB(t *testing.T) {
+	testDatabase(t, func(t *testing.T) Database {
+		return NewInMemoryDB(testLogger())
+	})
+}
+
+func TestMockDatabase(t *testing.T) {
+	testDatabase(t, func(t *testing.T) Database {
+		database, err := NewDatabase(config.Default().Database, testLogger())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return database
+	})
+}
+
+func TestNewDatabaseUnknownDriver(t *testing.T) {
+	var cfg config.DatabaseConfig = config.Default().Database
+	cfg.Driver = "oracle"
+
+	_, err := NewDatabase(cfg, testLogger())
+	if err == nil || !strings.Contains(err.Error(), `unknown database driver "oracle"`) {
+		t.Fatalf("NewDatabase = %v, want an unknown driver error", err)
+	}
+}
+
+// openDriver opens the database of a driver for the suite.
+func openDriver(driver string, configure func(*config.DatabaseConfig)) func(t *testing.T) Database {
+	return func(t *testing.T) Database {
+		var cfg config.DatabaseConfig = config.Default().Database
+		cfg.Driver = driver
+		configure(&cfg)
+
+		database, err := NewDatabase(cfg, testLogger())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return database
+	}
+}
+
+// TestPostgresDB runs the suite against the postgres database of
+// GOAPI_TEST_POSTGRES_DSN, when set.
+func TestPostgresDB(t *testing.T) {
+	var dsn string = os.Getenv("GOAPI_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("GOAPI_TEST_POSTGRES_DSN is not set")
+	}
+	testDatabase(t, openDriver("postgres", func(cfg *config.DatabaseConfig) { cfg.DSN = dsn }))
+}
+
+// TestMongoDB runs the suite against the mongo database of
+// GOAPI_TEST_MONGO_URI, when set, such as mongodb://localhost/?replicaSet=rs0,
+// and then as if the server had no transactions.
+func TestMongoDB(t *testing.T) {
+	var uri string = os.Getenv("GOAPI_TEST_MONGO_URI")
+	if uri == "" {
+		t.Skip("GOAPI_TEST_MONGO_URI is not set")
+	}
+	var open = openDriver("mongo", func(cfg *config.DatabaseConfig) {
+		cfg.DSN = uri
+		cfg.Name = "goapi_test"
+	})
+	testDatabase(t, open)
+
+	t.Run("without transactions", func(t *testing.T) {
+		var database = driverOf(open(t)).(*mongoDB)
+		// As on a standalone server; the suite closes database.
+		database.transactions = false
+		testDatabase(t, func(t *testing.T) Database { return database })
+
+		var suffix = make([]byte, 4)
+		rand.Read(suffix)
+		var from, to string = "t" + hex.EncodeToString(suffix) + "_from", "t" + hex.EncodeToString(suffix) + "_to"
+		var ctx = context.Background()
+		for _, username := range []string{from, to} {
+			if _, err := database.CreateUser(ctx, username, "hash"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := database.AdjustUserCoins(ctx, from, DefaultCurrency, 100, 0); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := database.Transfer(ctx, from, to, DefaultCurrency, 30); !errors.Is(err, ErrNoTransactions) {
+			t.Errorf("Transfer = %v, want ErrNoTransactions", err)
+		}
+		if coins, err := database.GetUserCoins(ctx, from); err != nil || coins.Coins != 100 {
+			t.Errorf("balance of the sender = %+v, %v, want 100 untouched", coins, err)
+		}
+
+		// The ledger entries of an adjustment follow its balance.
+		var driftOf = func(t *testing.T) []ledger.Drift {
+			t.Helper()
+			drift, err := database.VerifyLedger(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var mine []ledger.Drift
+			for _, d := range drift {
+				if d.Account == from {
+					mine = append(mine, d)
+				}
+			}
+			return mine
+		}
+		if drift := driftOf(t); len(drift) != 0 {
+			t.Errorf("drift after AdjustUserCoins = %+v, want none", drift)
+		}
+
+		// A write failing between the two leaves the balance alone changed.
+		if _, err := database.users().UpdateOne(ctx, active(from), bson.M{"$inc": bson.M{"balances." + DefaultCurrency: int64(5)}}); err != nil {
+			t.Fatal(err)
+		}
+		var want = []ledger.Drift{{Account: from, Currency: DefaultCurrency, Cached: 105, Ledger: 100}}
+		if drift := driftOf(t); !reflect.DeepEqual(drift, want) {
+			t.Errorf("drift of a balance without its entries = %+v, want %+v", drift, want)
+		}
+	})
+}
+
+func TestSQLiteDB(t *testing.T) {
+	t.Run("memory", func(t *testing.T) {
+		testDatabase(t, openDriver("sqlite", func(cfg *config.DatabaseConfig) { cfg.Path = MemoryPath }))
+	})
+	t.Run("file", func(t *testing.T) {
+		var path string = filepath.Join(t.TempDir(), "goapi.db")
+		testDatabase(t, openDriver("sqlite", func(cfg *config.DatabaseConfig) { cfg.Path = path }))
+	})
+	t.Run("pragmas", func(t *testing.T) {
+		var path string = filepath.Join(t.TempDir(), "goapi.db")
+		var database = openDriver("sqlite", func(cfg *config.DatabaseConfig) { cfg.Path = path })(t).(*sqlDB)
+		defer database.Close()
+
+		for pragma, want := range map[string]string{"journal_mode": "wal", "foreign_keys": "1"} {
+			var got string
+			if err := database.db.QueryRow("PRAGMA " + pragma).Scan(&got); err != nil {
+				t.Fatal(err)
+			}
+			if got != want {
+				t.Errorf("%s = %q, want %q", pragma, got, want)
+			}
+		}
+	})
+}
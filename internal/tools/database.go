@@ -1,34 +1,604 @@
 package tools
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/config"
+	"github.com/RashedMaaitah/goapi/internal/ledger"
 	log "github.com/sirupsen/logrus"
 )
 
 type LoginDetails struct {
-	AuthToken string
+	Username     string
+	PasswordHash string
+	Role         string
+	CreatedAt    time.Time
+	DisplayName  string
+	Email        string
+
+	// DeletedAt is set on soft-deleted users, which are kept but hidden.
+	DeletedAt time.Time
+
+	// APIKey is the ID of the key a service authenticated with, empty for
+	// users. It is never stored.
+	APIKey string `json:"-"`
+
+	// Scopes are those of the token the user authenticated with. They are
+	// never stored with the user.
+	Scopes []string `json:"-"`
+}
+
+// HasScope reports whether the token authenticated with grants scope.
+func (l LoginDetails) HasScope(scope string) bool {
+	return slices.Contains(l.Scopes, scope)
+}
+
+func (l LoginDetails) Deleted() bool {
+	return !l.DeletedAt.IsZero()
+}
+
+// UserUpdate lists the profile fields to change. Nil fields are left as
+// they are, an empty string clears the field.
+type UserUpdate struct {
+	DisplayName *string
+	Email       *string
+}
+
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// The scopes a token may grant. Every user has all of them, a token may be
+// issued with fewer.
+const (
+	ScopeCoinsRead  = "coins:read"
+	ScopeCoinsWrite = "coins:write"
+)
+
+var Scopes = []string{ScopeCoinsRead, ScopeCoinsWrite}
+
+// Session is an auth token issued to Username. Token is HashToken of it,
+// the token itself is never stored. A zero ExpiresAt never expires. Scopes
+// is nil for sessions created before tokens had scopes.
+type Session struct {
+	Token     string
 	Username  string
+	ExpiresAt time.Time
+	Scopes    []string
 }
 
+// tokenHashPrefix marks the stored tokens that are hashes, telling them
+// from those stored in plaintext before tokens were hashed.
+const tokenHashPrefix = "sha256:"
+
+// HashToken returns what is stored of an auth token, so whoever reads the
+// store still can't use it. Tokens are random, a salt adds nothing.
+func HashToken(token string) string {
+	var sum = sha256.Sum256([]byte(token))
+	return tokenHashPrefix + hex.EncodeToString(sum[:])
+}
+
+// hashSessions replaces the sessions of sessions stored by their token in
+// plaintext with ones stored by HashToken, returning how many there were.
+func hashSessions(sessions map[string]Session) int {
+	var hashed int
+	for token, session := range sessions {
+		if strings.HasPrefix(token, tokenHashPrefix) {
+			continue
+		}
+		delete(sessions, token)
+		session.Token = HashToken(token)
+		sessions[session.Token] = session
+		hashed++
+	}
+	return hashed
+}
+
+// Expired reports whether the session is no longer valid at now.
+func (s Session) Expired(now time.Time) bool {
+	return !s.ExpiresAt.IsZero() && !now.Before(s.ExpiresAt)
+}
+
+// APIKey is a key a service authenticates with instead of a user's token,
+// as Name, with the role Role. Hash is HashToken of the key, which itself
+// is never stored. A zero ExpiresAt never expires, a zero LastUsedAt was
+// never used.
+type APIKey struct {
+	ID         string
+	Name       string
+	Role       string
+	Hash       string
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+	LastUsedAt time.Time
+}
+
+// Expired reports whether the key is no longer valid at now.
+func (k APIKey) Expired(now time.Time) bool {
+	return !k.ExpiresAt.IsZero() && !now.Before(k.ExpiresAt)
+}
+
+// DefaultCurrency is the currency of CoinDetails.Coins and of requests
+// that name none.
+const DefaultCurrency = "coins"
+
 type CoinDetails struct {
+	// Coins is the balance in DefaultCurrency, Balances those in any other
+	// currency the user holds.
 	Coins    int64
+	Balances map[string]int64
 	Username string
+
+	// Frozen accounts can be read but not deposited to, withdrawn from or
+	// transferred with.
+	Frozen bool
+
+	// Version starts at 1 and grows with every write to the record. Updates
+	// given the version they read fail with ErrVersionConflict if another
+	// write came first.
+	Version int64
+
+	// OverdraftLimit is how far below zero the balances may go, 0 for
+	// accounts without an overdraft.
+	OverdraftLimit int64
+}
+
+// Floor is the lowest balance withdrawals and transfers may leave.
+func (c CoinDetails) Floor() int64 {
+	return -c.OverdraftLimit
+}
+
+var (
+	ErrUserNotFound      = api.ErrUserNotFound
+	ErrInsufficientFunds = api.ErrInsufficientFunds
+	ErrSelfTransfer      = errors.New("cannot transfer to the same user")
+	ErrUserExists        = api.ErrUserExists
+	ErrNoBalanceYet      = api.ErrNoBalanceYet
+	ErrSessionNotFound   = errors.New("session not found")
+	ErrAPIKeyNotFound    = errors.New("API key not found")
+	ErrUserDeleted       = errors.New("user has been deleted")
+	ErrSenderNotFound    = errors.New("sender does not exist")
+	ErrAccountFrozen     = api.ErrAccountFrozen
+	ErrVersionConflict   = api.ErrVersionConflict
+	ErrKeyReserved       = errors.New("idempotency key already reserved")
+	ErrBalanceOverflow   = api.ErrBalanceOverflow
+)
+
+// addBalance returns balance plus delta, or ErrBalanceOverflow when that
+// doesn't fit in an int64.
+func addBalance(balance int64, delta int64) (int64, error) {
+	if delta > 0 && balance > math.MaxInt64-delta || delta < 0 && balance < math.MinInt64-delta {
+		return 0, ErrBalanceOverflow
+	}
+	return balance + delta, nil
+}
+
+// Balance returns the balance in currency, 0 if the user never held any.
+func (c CoinDetails) Balance(currency string) int64 {
+	if currency == DefaultCurrency {
+		return c.Coins
+	}
+	return c.Balances[currency]
+}
+
+// AllBalances returns the balances in every currency, DefaultCurrency
+// included.
+func (c CoinDetails) AllBalances() map[string]int64 {
+	var balances = make(map[string]int64, len(c.Balances)+1)
+	for currency, amount := range c.Balances {
+		balances[currency] = amount
+	}
+	balances[DefaultCurrency] = c.Coins
+	return balances
+}
+
+type TransferDetails struct {
+	ID        string
+	From      string
+	To        string
+	Currency  string
+	Amount    int64
+	FromCoins int64
+	ToCoins   int64
+	CreatedAt time.Time
+}
+
+const (
+	TransactionDeposit     = "deposit"
+	TransactionWithdrawal  = "withdrawal"
+	TransactionTransferIn  = "transfer_in"
+	TransactionTransferOut = "transfer_out"
+	TransactionAdmin       = "admin_adjustment"
+	TransactionFreeze      = "freeze"
+	TransactionUnfreeze    = "unfreeze"
+)
+
+// Transaction records one change to the balance of Username. Seq increases
+// with every recorded transaction and orders them.
+type Transaction struct {
+	Seq          int64
+	ID           string
+	Username     string
+	Type         string
+	Currency     string
+	Amount       int64
+	Counterparty string
+	Balance      int64
+	CreatedAt    time.Time
+
+	// Actor and Reason are set on admin adjustments.
+	Actor  string
+	Reason string
+}
+
+// AdminAdjustment is a change an admin makes to a balance: Delta is added,
+// or with Set the balance becomes Balance. Force allows the result to be
+// negative.
+type AdminAdjustment struct {
+	Delta   int64
+	Set     bool
+	Balance int64
+	Actor   string
+	Reason  string
+	Force   bool
+
+	// Version is the expected version of the coin record, 0 for any.
+	Version int64
+}
+
+const (
+	SortByUsername  = "username"
+	SortByCoins     = "coins"
+	SortByCreatedAt = "created"
+)
+
+// UserFilter selects and orders users for SearchUsers. Zero values do not
+// filter. Ties are broken by username.
+type UserFilter struct {
+	Prefix   string
+	MinCoins *int64
+	MaxCoins *int64
+	Role     string
+	SortBy   string
+	Desc     bool
+	Offset   int
+	Limit    int
+}
+
+type UserSummary struct {
+	Username  string
+	Role      string
+	Coins     int64
+	CreatedAt time.Time
+}
+
+// Stats aggregates all users. Buckets[i] counts the users with a balance
+// below the i-th bound of the GetStats call and at or above the one before,
+// the last bucket counts the rest.
+type Stats struct {
+	Users      int64
+	TotalCoins int64
+	Buckets    []int64
 }
 
-type DatabaseInterface interface {
-	GetUserLoginDetails(username string) *LoginDetails
-	GetUserCoins(username string) *CoinDetails
+// IdempotencyRecord is the stored outcome of a request sent with an
+// Idempotency-Key. Until the request completes only Key, RequestHash and
+// ExpiresAt are set.
+type IdempotencyRecord struct {
+	Key         string
+	RequestHash string
+	Done        bool
+	StatusCode  int
+	ContentType string
+	Body        []byte
+	ExpiresAt   time.Time
+}
+
+// AuditEntry records a privileged or mutating operation: Actor did Action
+// to the account of Target, moving Amount of Currency if it moves coins,
+// with Outcome. Seq increases with every entry and orders them, and Hash
+// covers the entry and PrevHash, the Hash of the entry before, so an entry
+// changed or removed after the fact breaks the chain.
+type AuditEntry struct {
+	Seq       int64
+	Actor     string
+	Action    string
+	Target    string
+	Currency  string
+	Amount    int64
+	RequestID string
+	Outcome   string
+	CreatedAt time.Time
+	PrevHash  string
+	Hash      string
+}
+
+// ComputeHash returns what the Hash of the entry should be.
+func (e AuditEntry) ComputeHash() string {
+	// An array of JSON strings, so no field can run into the next.
+	encoded, _ := json.Marshal([]string{
+		strconv.FormatInt(e.Seq, 10), e.Actor, e.Action, e.Target, e.Currency,
+		strconv.FormatInt(e.Amount, 10), e.RequestID, e.Outcome,
+		e.CreatedAt.UTC().Format(time.RFC3339Nano), e.PrevHash,
+	})
+	var sum = sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:])
+}
+
+// chainAudit stamps entry with the current time and makes it the one after
+// last, the newest entry of the log or the zero entry if there is none. The
+// time is cut to the milliseconds every driver stores, so the hash still
+// matches once read back.
+func chainAudit(entry AuditEntry, last AuditEntry) AuditEntry {
+	entry.Seq = last.Seq + 1
+	entry.PrevHash = last.Hash
+	entry.CreatedAt = time.Now().UTC().Truncate(time.Millisecond)
+	entry.Hash = entry.ComputeHash()
+	return entry
+}
+
+// errAuditRace is the error of an audit entry another took the sequence
+// number of, which is then chained again.
+var errAuditRace = errors.New("audit entry raced another for its sequence number")
+
+// auditAttempts bounds how many times an audit entry is chained again.
+const auditAttempts = 5
+
+// AuditFilter selects entries for ListAudit. Zero values do not filter:
+// User matches the Actor or the Target, Since the entries created at or
+// after it, and Before those below that sequence number.
+type AuditFilter struct {
+	User   string
+	Action string
+	Since  time.Time
+	Before int64
+	Limit  int
+}
+
+// NewUser is a user to create with ImportUsers. An empty Role is RoleUser.
+type NewUser struct {
+	Username     string
+	PasswordHash string
+	Role         string
+	Coins        int64
+}
+
+func (u NewUser) role() string {
+	if u.Role == "" {
+		return RoleUser
+	}
+	return u.Role
+}
+
+// normalizeUsers returns a copy of users with their usernames normalized.
+func normalizeUsers(users []NewUser) []NewUser {
+	var normalized = make([]NewUser, len(users))
+	for i, user := range users {
+		user.Username = api.NormalizeUsername(user.Username)
+		normalized[i] = user
+	}
+	return normalized
+}
+
+// Database is the storage of the API, implemented by each driver NewDatabase
+// selects. Every method but GetUserIncludingDeleted and RestoreUser treats
+// soft-deleted users as if they did not exist. Usernames are normalized
+// with api.NormalizeUsername before they are stored or looked up, so
+// "Alex" is alex.
+type Database interface {
+	GetUserLoginDetails(ctx context.Context, username string) (*LoginDetails, error)
+	GetUserCoins(ctx context.Context, username string) (*CoinDetails, error)
+
+	// AdjustUserCoins atomically adds delta to the balance of username in
+	// currency and returns the updated details. A delta that would take the
+	// balance below the account's Floor fails with ErrInsufficientFunds and
+	// changes nothing. The check must be part of the write (a locked update,
+	// or WHERE balance + delta >= floor in SQL), or concurrent withdrawals
+	// could both pass it. A non-zero version must match the record's or the
+	// call fails with ErrVersionConflict.
+	AdjustUserCoins(ctx context.Context, username string, currency string, delta int64, version int64) (*CoinDetails, error)
+
+	// AdminAdjustCoins applies adjustment to the balance of username and
+	// records it with the acting admin and reason.
+	AdminAdjustCoins(ctx context.Context, username string, adjustment AdminAdjustment) (*CoinDetails, error)
+
+	// SetOverdraft sets how far below zero the balances of username may go.
+	SetOverdraft(ctx context.Context, username string, limit int64) (*CoinDetails, error)
+
+	// SetFrozen freezes or unfreezes the account of username, recording the
+	// acting admin and reason in its history.
+	SetFrozen(ctx context.Context, username string, frozen bool, actor string, reason string) (*CoinDetails, error)
+
+	// Transfer moves amount coins from one user to another as a single
+	// operation: either both balances change or neither does. A missing or
+	// deleted sender fails with ErrSenderNotFound, a missing recipient with
+	// ErrUserNotFound and a deleted one with ErrUserDeleted.
+	Transfer(ctx context.Context, from string, to string, currency string, amount int64) (*TransferDetails, error)
+
+	// ListTransactions returns up to limit transactions of username, newest
+	// first, starting below the sequence number before (0 for the newest).
+	ListTransactions(ctx context.Context, username string, limit int, before int64) ([]Transaction, error)
+
+	// CreateUser adds a user with a zero balance. The password must already
+	// be hashed.
+	CreateUser(ctx context.Context, username string, passwordHash string) (*LoginDetails, error)
+
+	UpdateUser(ctx context.Context, username string, update UserUpdate) (*LoginDetails, error)
+
+	UpdatePassword(ctx context.Context, username string, passwordHash string) error
+
+	GetUserIncludingDeleted(ctx context.Context, username string) (*LoginDetails, error)
+
+	// DeleteUser soft-deletes username, RestoreUser undoes it.
+	DeleteUser(ctx context.Context, username string) error
+	RestoreUser(ctx context.Context, username string) error
+
+	// CreateSession stores session. With replace set, the other sessions of
+	// the same user are deleted.
+	CreateSession(ctx context.Context, session Session, replace bool) error
+
+	// GetSession looks a session up by its token, HashToken of the token
+	// presented, as is that of DeleteSession.
+	GetSession(ctx context.Context, token string) (*Session, error)
+
+	DeleteSession(ctx context.Context, token string) error
+
+	// DeleteUserSessions deletes every session of username.
+	DeleteUserSessions(ctx context.Context, username string) error
+
+	CreateAPIKey(ctx context.Context, key APIKey) error
+
+	// ListAPIKeys returns every key, oldest first.
+	ListAPIKeys(ctx context.Context) ([]APIKey, error)
+
+	// GetAPIKey looks a key up by its hash, HashToken of the key presented.
+	GetAPIKey(ctx context.Context, hash string) (*APIKey, error)
+
+	// TouchAPIKey sets the LastUsedAt of the key id to at.
+	TouchAPIKey(ctx context.Context, id string, at time.Time) error
+
+	// DeleteAPIKey revokes the key id, ErrAPIKeyNotFound if there is none.
+	DeleteAPIKey(ctx context.Context, id string) error
+
+	SearchUsers(ctx context.Context, filter UserFilter) ([]UserSummary, error)
+
+	// GetStats aggregates the balances of all users into the histogram
+	// described by bounds, which must be ascending.
+	GetStats(ctx context.Context, bounds []int64) (*Stats, error)
+
+	// ImportUsers creates users, returning one error per user: nil when it
+	// was created, ErrUserExists when the username is taken. With atomic set
+	// either all of them are created or, if any fails, none.
+	ImportUsers(ctx context.Context, users []NewUser, atomic bool) ([]error, error)
+
+	// LedgerEntries returns the ledger entries of a transaction, none if
+	// the ID is unknown.
+	LedgerEntries(ctx context.Context, transactionID string) ([]ledger.Entry, error)
+
+	// VerifyLedger compares every stored balance with the sum of its ledger
+	// entries and returns those that differ.
+	VerifyLedger(ctx context.Context) ([]ledger.Drift, error)
+
+	// GetBalanceAsOf sums the ledger entries of username posted up to t
+	// into its balances by currency at t. It fails with ErrUserNotFound for
+	// an unknown or deleted user, and ErrNoBalanceYet when t is before the
+	// user was created.
+	GetBalanceAsOf(ctx context.Context, username string, t time.Time) (map[string]int64, error)
+
+	// ReserveIdempotencyKey claims key for a request until expiresAt. If the
+	// key is already claimed and not expired it fails with ErrKeyReserved and
+	// returns the existing record.
+	ReserveIdempotencyKey(ctx context.Context, key string, requestHash string, expiresAt time.Time) (*IdempotencyRecord, error)
+
+	// CompleteIdempotencyKey stores the response of the request holding key.
+	CompleteIdempotencyKey(ctx context.Context, key string, statusCode int, contentType string, body []byte) error
+
+	// ReleaseIdempotencyKey forgets key, so the request can be retried.
+	ReleaseIdempotencyKey(ctx context.Context, key string) error
+
+	// AppendAudit adds entry to the end of the audit log, linked to the
+	// entry before it, and returns it with Seq, CreatedAt, PrevHash and Hash
+	// set.
+	AppendAudit(ctx context.Context, entry AuditEntry) (*AuditEntry, error)
+
+	// ListAudit returns up to filter.Limit entries of the audit log, newest
+	// first.
+	ListAudit(ctx context.Context, filter AuditFilter) ([]AuditEntry, error)
+
+	// GetTopUsers returns up to limit users by descending balance, ties
+	// ordered by username, skipping the offset first ones.
+	GetTopUsers(ctx context.Context, offset, limit int) ([]CoinDetails, error)
+
 	SetupDatabase() error
+	Ping(ctx context.Context) error
+
+	// Close releases the connections of the database. It is called once,
+	// after the servers have drained.
+	Close() error
 }
 
-func NewDatabase() (*DatabaseInterface, error) {
-	var database DatabaseInterface = &mockDB{}
+// Drivers lists the values of database.driver NewDatabase knows.
+var Drivers = []string{"mock", "postgres", "sqlite", "mongo"}
 
-	var err error = database.SetupDatabase()
+// NewDatabase returns the implementation cfg.Driver names, set up and
+// ready to use.
+func NewDatabase(cfg config.DatabaseConfig, logger *log.Logger) (Database, error) {
+	var database Database
+	switch cfg.Driver {
+	case "mock":
+		var db *InMemoryDB
+		var err error
+		if cfg.Snapshot == "" {
+			db, err = openMemory(cfg, logger)
+		} else {
+			db, err = openSnapshotted(cfg, logger)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("opening %s database: %w", cfg.Driver, err)
+		}
+		database = db
+	case "postgres":
+		db, err := openSQL("postgres", postgresDialect, cfg, logger)
+		if err != nil {
+			return nil, fmt.Errorf("opening %s database: %w", cfg.Driver, err)
+		}
+		database = db
+	case "sqlite":
+		db, err := openSQLite(cfg, logger)
+		if err != nil {
+			return nil, fmt.Errorf("opening %s database: %w", cfg.Driver, err)
+		}
+		database = db
+	case "mongo":
+		db, err := openMongo(cfg, logger)
+		if err != nil {
+			return nil, fmt.Errorf("opening %s database: %w", cfg.Driver, err)
+		}
+		database = db
+	default:
+		return nil, fmt.Errorf("unknown database driver %q: must be one of %s", cfg.Driver, strings.Join(Drivers, ", "))
+	}
+
+	if cfg.Lazy {
+		return lazy(database, cfg, logger), nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ConnectTimeout.Duration())
+	defer cancel()
+	if err := database.Ping(ctx); err != nil {
+		database.Close()
+		return nil, fmt.Errorf("%s database unreachable, start with -lazy-db to wait for it: %w", cfg.Driver, err)
+	}
 
+	var err error = database.SetupDatabase()
 	if err != nil {
-		log.Error(err)
-		return nil, err
+		database.Close()
+		return nil, fmt.Errorf("setting up %s database: %w", cfg.Driver, err)
 	}
 
-	return &database, nil
+	return database, nil
+}
+
+// driverOf returns the implementation under what NewDatabase and Retry
+// wrapped it in.
+func driverOf(database Database) Database {
+	if retrying, ok := database.(*retryDB); ok {
+		database = retrying.Database
+	}
+	if lazy, ok := database.(*lazyDB); ok {
+		database = lazy.Database
+	}
+	return database
 }
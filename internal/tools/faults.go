@@ -0,0 +1,148 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/internal/config"
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrInjectedFault is returned by the calls of an InMemoryDB its FaultFunc
+// chose to fail.
+var ErrInjectedFault = errors.New("injected fault")
+
+// Fault is what an InMemoryDB does to a call instead of serving it.
+type Fault int
+
+const (
+	NoFault Fault = iota
+	// FaultError fails the call with ErrInjectedFault.
+	FaultError
+	// FaultTimeout blocks the call until its context is done, forever when
+	// it never is.
+	FaultTimeout
+)
+
+// FaultFunc picks the fault of each call, by the name of the Database
+// method. It is called concurrently.
+type FaultFunc func(method string) Fault
+
+// MemoryOption customizes an InMemoryDB.
+type MemoryOption func(*InMemoryDB)
+
+// WithLatency delays every call but Ping by latency.
+func WithLatency(latency time.Duration) MemoryOption {
+	return func(d *InMemoryDB) {
+		d.latency = latency
+	}
+}
+
+// WithFaults makes decide pick the fault of every call, after its latency.
+func WithFaults(decide FaultFunc) MemoryOption {
+	return func(d *InMemoryDB) {
+		d.faults = decide
+	}
+}
+
+// RandomFaults returns a FaultFunc failing errorRate of the calls to
+// methods, or to every method when there are none, and timing out
+// timeoutRate of them. The same seed makes the same choices in the same
+// order of calls.
+func RandomFaults(seed uint64, errorRate float64, timeoutRate float64, methods ...string) FaultFunc {
+	var mu sync.Mutex
+	var random *rand.Rand = rand.New(rand.NewPCG(seed, seed))
+
+	return func(method string) Fault {
+		if len(methods) > 0 && !slices.Contains(methods, method) {
+			return NoFault
+		}
+
+		mu.Lock()
+		var roll float64 = random.Float64()
+		mu.Unlock()
+
+		switch {
+		case roll < errorRate:
+			return FaultError
+		case roll < errorRate+timeoutRate:
+			return FaultTimeout
+		}
+		return NoFault
+	}
+}
+
+// configuredFaults returns the RandomFaults cfg describes, seeded at
+// random when cfg.Seed is 0. The seed is logged so a run can be repeated.
+func configuredFaults(cfg config.FaultsConfig, logger *log.Logger) (FaultFunc, error) {
+	if err := checkMethods(cfg.Methods); err != nil {
+		return nil, fmt.Errorf("database.faults.methods: %w", err)
+	}
+
+	var seed uint64 = cfg.Seed
+	if seed == 0 {
+		seed = rand.Uint64()
+	}
+	var methods string = "every method"
+	if len(cfg.Methods) > 0 {
+		methods = strings.Join(cfg.Methods, ", ")
+	}
+	logger.Warnf("Injecting faults in %.0f%% of the database calls to %s, with seed %d", 100*(cfg.ErrorRate+cfg.TimeoutRate), methods, seed)
+
+	return RandomFaults(seed, cfg.ErrorRate, cfg.TimeoutRate, cfg.Methods...), nil
+}
+
+// checkMethods returns an error naming the first of methods that Database
+// doesn't have.
+func checkMethods(methods []string) error {
+	var database reflect.Type = reflect.TypeFor[Database]()
+	for _, method := range methods {
+		if _, ok := database.MethodByName(method); !ok {
+			return fmt.Errorf("unknown method %q", method)
+		}
+	}
+	return nil
+}
+
+// transient is true for injected faults, so faults exercise retries too.
+func (d *InMemoryDB) transient(err error) bool {
+	return errors.Is(err, ErrInjectedFault)
+}
+
+// wait is the latency of the store, then the fault of method. Both are
+// cut short when ctx is done.
+func (d *InMemoryDB) wait(ctx context.Context, method string) error {
+	if d.latency > 0 {
+		var timer *time.Timer = time.NewTimer(d.latency)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		}
+	}
+	return d.fault(ctx, method)
+}
+
+func (d *InMemoryDB) fault(ctx context.Context, method string) error {
+	if d.faults == nil {
+		return nil
+	}
+
+	switch d.faults(method) {
+	case FaultError:
+		return fmt.Errorf("%s: %w", method, ErrInjectedFault)
+	case FaultTimeout:
+		<-ctx.Done()
+		return context.Cause(ctx)
+	}
+	return nil
+}
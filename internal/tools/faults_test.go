@@ -0,0 +1,86 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLatencyGivesUpWithTheContext(t *testing.T) {
+	var database *InMemoryDB = NewMockDB(testLogger(), WithLatency(time.Hour))
+
+	for _, tt := range []struct {
+		name   string
+		cancel func(ctx context.Context) (context.Context, context.CancelFunc)
+		want   error
+	}{
+		{"canceled", func(ctx context.Context) (context.Context, context.CancelFunc) {
+			ctx, cancel := context.WithCancel(ctx)
+			time.AfterFunc(10*time.Millisecond, cancel)
+			return ctx, cancel
+		}, context.Canceled},
+		{"deadline", func(ctx context.Context) (context.Context, context.CancelFunc) {
+			return context.WithTimeout(ctx, 10*time.Millisecond)
+		}, context.DeadlineExceeded},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := tt.cancel(context.Background())
+			defer cancel()
+
+			var start = time.Now()
+			_, err := database.GetUserCoins(ctx, "alex")
+			if !errors.Is(err, tt.want) {
+				t.Errorf("GetUserCoins = %v, want %v", err, tt.want)
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("GetUserCoins returned after %s", elapsed)
+			}
+		})
+	}
+}
+
+func TestFaults(t *testing.T) {
+	var database *InMemoryDB = NewMockDB(testLogger(), WithFaults(func(method string) Fault {
+		switch method {
+		case "GetUserCoins":
+			return FaultError
+		case "GetUserLoginDetails":
+			return FaultTimeout
+		}
+		return NoFault
+	}))
+
+	if _, err := database.GetUserCoins(context.Background(), "alex"); !errors.Is(err, ErrInjectedFault) {
+		t.Errorf("GetUserCoins = %v, want ErrInjectedFault", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := database.GetUserLoginDetails(ctx, "alex"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("GetUserLoginDetails = %v, want context.DeadlineExceeded", err)
+	}
+
+	if _, err := database.GetTopUsers(context.Background(), 0, 1); err != nil {
+		t.Errorf("GetTopUsers = %v, want no fault", err)
+	}
+}
+
+func TestRandomFaultsRepeatWithTheSeed(t *testing.T) {
+	var first, second = RandomFaults(7, 0.3, 0.2), RandomFaults(7, 0.3, 0.2)
+	var counts = map[Fault]int{}
+	for range 1000 {
+		var fault Fault = first("GetUserCoins")
+		if second("GetUserCoins") != fault {
+			t.Fatal("the same seed chose different faults")
+		}
+		counts[fault]++
+	}
+	if counts[FaultError] < 250 || counts[FaultError] > 350 || counts[FaultTimeout] < 150 || counts[FaultTimeout] > 250 {
+		t.Errorf("faults = %v of 1000, want about 300 errors and 200 timeouts", counts)
+	}
+
+	if fault := RandomFaults(7, 1, 0, "Transfer")("GetUserCoins"); fault != NoFault {
+		t.Errorf("fault of a method not listed = %v", fault)
+	}
+}
@@ -0,0 +1,324 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/internal/ledger"
+	"github.com/RashedMaaitah/goapi/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// instrumentedDB decorates any Database implementation with call
+// counts and durations per method.
+type instrumentedDB struct {
+	next    Database
+	metrics *metrics.Metrics
+}
+
+// Instrument returns a Database recording every call to database
+// in m.
+func Instrument(database Database, m *metrics.Metrics) Database {
+	return &instrumentedDB{next: database, metrics: m}
+}
+
+// CollectPoolStats exports the connection pool statistics of database, when
+// it is one of the SQL drivers, through m as the go_sql_* metrics. Only the
+// Prometheus exporter has them.
+func CollectPoolStats(database Database, m *metrics.Metrics) {
+	prom, ok := m.Exporter.(*metrics.Prometheus)
+	if !ok {
+		return
+	}
+	if sqlDatabase, ok := driverOf(database).(*sqlDB); ok {
+		prom.Registry.MustRegister(collectors.NewDBStatsCollector(sqlDatabase.db, sqlDatabase.dialect.name))
+	}
+}
+
+func (d *instrumentedDB) observe(method string, start time.Time, result string) {
+	d.metrics.DBCallDuration.Observe(time.Since(start).Seconds(), method)
+	d.metrics.DBCalls.Inc(method, result)
+}
+
+func (d *instrumentedDB) GetUserLoginDetails(ctx context.Context, username string) (*LoginDetails, error) {
+	var start = time.Now()
+	loginDetails, err := d.next.GetUserLoginDetails(ctx, username)
+	d.observe("GetUserLoginDetails", start, errorResult(err))
+	return loginDetails, err
+}
+
+func (d *instrumentedDB) GetUserCoins(ctx context.Context, username string) (*CoinDetails, error) {
+	var start = time.Now()
+	coinDetails, err := d.next.GetUserCoins(ctx, username)
+	d.observe("GetUserCoins", start, errorResult(err))
+	return coinDetails, err
+}
+
+func (d *instrumentedDB) AdjustUserCoins(ctx context.Context, username string, currency string, delta int64, version int64) (*CoinDetails, error) {
+	var start = time.Now()
+	coinDetails, err := d.next.AdjustUserCoins(ctx, username, currency, delta, version)
+	d.observe("AdjustUserCoins", start, errorResult(err))
+	return coinDetails, err
+}
+
+func (d *instrumentedDB) AdminAdjustCoins(ctx context.Context, username string, adjustment AdminAdjustment) (*CoinDetails, error) {
+	var start = time.Now()
+	coinDetails, err := d.next.AdminAdjustCoins(ctx, username, adjustment)
+	d.observe("AdminAdjustCoins", start, errorResult(err))
+	return coinDetails, err
+}
+
+func (d *instrumentedDB) SetOverdraft(ctx context.Context, username string, limit int64) (*CoinDetails, error) {
+	var start = time.Now()
+	coinDetails, err := d.next.SetOverdraft(ctx, username, limit)
+	d.observe("SetOverdraft", start, errorResult(err))
+	return coinDetails, err
+}
+
+func (d *instrumentedDB) SetFrozen(ctx context.Context, username string, frozen bool, actor string, reason string) (*CoinDetails, error) {
+	var start = time.Now()
+	coinDetails, err := d.next.SetFrozen(ctx, username, frozen, actor, reason)
+	d.observe("SetFrozen", start, errorResult(err))
+	return coinDetails, err
+}
+
+func (d *instrumentedDB) Transfer(ctx context.Context, from string, to string, currency string, amount int64) (*TransferDetails, error) {
+	var start = time.Now()
+	transfer, err := d.next.Transfer(ctx, from, to, currency, amount)
+	d.observe("Transfer", start, errorResult(err))
+	return transfer, err
+}
+
+func (d *instrumentedDB) ListTransactions(ctx context.Context, username string, limit int, before int64) ([]Transaction, error) {
+	var start = time.Now()
+	transactions, err := d.next.ListTransactions(ctx, username, limit, before)
+	d.observe("ListTransactions", start, errorResult(err))
+	return transactions, err
+}
+
+func (d *instrumentedDB) CreateUser(ctx context.Context, username string, passwordHash string) (*LoginDetails, error) {
+	var start = time.Now()
+	loginDetails, err := d.next.CreateUser(ctx, username, passwordHash)
+	d.observe("CreateUser", start, errorResult(err))
+	return loginDetails, err
+}
+
+func (d *instrumentedDB) ImportUsers(ctx context.Context, users []NewUser, atomic bool) ([]error, error) {
+	var start = time.Now()
+	errs, err := d.next.ImportUsers(ctx, users, atomic)
+	d.observe("ImportUsers", start, errorResult(err))
+	return errs, err
+}
+
+func (d *instrumentedDB) LedgerEntries(ctx context.Context, transactionID string) ([]ledger.Entry, error) {
+	var start = time.Now()
+	entries, err := d.next.LedgerEntries(ctx, transactionID)
+	d.observe("LedgerEntries", start, errorResult(err))
+	return entries, err
+}
+
+func (d *instrumentedDB) VerifyLedger(ctx context.Context) ([]ledger.Drift, error) {
+	var start = time.Now()
+	drift, err := d.next.VerifyLedger(ctx)
+	d.observe("VerifyLedger", start, errorResult(err))
+	return drift, err
+}
+
+func (d *instrumentedDB) ReserveIdempotencyKey(ctx context.Context, key string, requestHash string, expiresAt time.Time) (*IdempotencyRecord, error) {
+	var start = time.Now()
+	record, err := d.next.ReserveIdempotencyKey(ctx, key, requestHash, expiresAt)
+	d.observe("ReserveIdempotencyKey", start, errorResult(err))
+	return record, err
+}
+
+func (d *instrumentedDB) CompleteIdempotencyKey(ctx context.Context, key string, statusCode int, contentType string, body []byte) error {
+	var start = time.Now()
+	err := d.next.CompleteIdempotencyKey(ctx, key, statusCode, contentType, body)
+	d.observe("CompleteIdempotencyKey", start, errorResult(err))
+	return err
+}
+
+func (d *instrumentedDB) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	var start = time.Now()
+	err := d.next.ReleaseIdempotencyKey(ctx, key)
+	d.observe("ReleaseIdempotencyKey", start, errorResult(err))
+	return err
+}
+
+func (d *instrumentedDB) UpdateUser(ctx context.Context, username string, update UserUpdate) (*LoginDetails, error) {
+	var start = time.Now()
+	loginDetails, err := d.next.UpdateUser(ctx, username, update)
+	d.observe("UpdateUser", start, errorResult(err))
+	return loginDetails, err
+}
+
+func (d *instrumentedDB) UpdatePassword(ctx context.Context, username string, passwordHash string) error {
+	var start = time.Now()
+	var err error = d.next.UpdatePassword(ctx, username, passwordHash)
+	d.observe("UpdatePassword", start, errorResult(err))
+	return err
+}
+
+func (d *instrumentedDB) CreateSession(ctx context.Context, session Session, replace bool) error {
+	var start = time.Now()
+	var err error = d.next.CreateSession(ctx, session, replace)
+	d.observe("CreateSession", start, errorResult(err))
+	return err
+}
+
+func (d *instrumentedDB) GetSession(ctx context.Context, token string) (*Session, error) {
+	var start = time.Now()
+	session, err := d.next.GetSession(ctx, token)
+	d.observe("GetSession", start, errorResult(err))
+	return session, err
+}
+
+func (d *instrumentedDB) DeleteSession(ctx context.Context, token string) error {
+	var start = time.Now()
+	var err error = d.next.DeleteSession(ctx, token)
+	d.observe("DeleteSession", start, errorResult(err))
+	return err
+}
+
+func (d *instrumentedDB) DeleteUserSessions(ctx context.Context, username string) error {
+	var start = time.Now()
+	var err error = d.next.DeleteUserSessions(ctx, username)
+	d.observe("DeleteUserSessions", start, errorResult(err))
+	return err
+}
+
+func (d *instrumentedDB) CreateAPIKey(ctx context.Context, key APIKey) error {
+	var start = time.Now()
+	var err error = d.next.CreateAPIKey(ctx, key)
+	d.observe("CreateAPIKey", start, errorResult(err))
+	return err
+}
+
+func (d *instrumentedDB) ListAPIKeys(ctx context.Context) ([]APIKey, error) {
+	var start = time.Now()
+	keys, err := d.next.ListAPIKeys(ctx)
+	d.observe("ListAPIKeys", start, errorResult(err))
+	return keys, err
+}
+
+func (d *instrumentedDB) GetAPIKey(ctx context.Context, hash string) (*APIKey, error) {
+	var start = time.Now()
+	key, err := d.next.GetAPIKey(ctx, hash)
+	d.observe("GetAPIKey", start, errorResult(err))
+	return key, err
+}
+
+func (d *instrumentedDB) TouchAPIKey(ctx context.Context, id string, at time.Time) error {
+	var start = time.Now()
+	var err error = d.next.TouchAPIKey(ctx, id, at)
+	d.observe("TouchAPIKey", start, errorResult(err))
+	return err
+}
+
+func (d *instrumentedDB) DeleteAPIKey(ctx context.Context, id string) error {
+	var start = time.Now()
+	var err error = d.next.DeleteAPIKey(ctx, id)
+	d.observe("DeleteAPIKey", start, errorResult(err))
+	return err
+}
+
+func (d *instrumentedDB) SearchUsers(ctx context.Context, filter UserFilter) ([]UserSummary, error) {
+	var start = time.Now()
+	users, err := d.next.SearchUsers(ctx, filter)
+	d.observe("SearchUsers", start, errorResult(err))
+	return users, err
+}
+
+func (d *instrumentedDB) GetStats(ctx context.Context, bounds []int64) (*Stats, error) {
+	var start = time.Now()
+	stats, err := d.next.GetStats(ctx, bounds)
+	d.observe("GetStats", start, errorResult(err))
+	return stats, err
+}
+
+func (d *instrumentedDB) AppendAudit(ctx context.Context, entry AuditEntry) (*AuditEntry, error) {
+	var start = time.Now()
+	appended, err := d.next.AppendAudit(ctx, entry)
+	d.observe("AppendAudit", start, errorResult(err))
+	return appended, err
+}
+
+func (d *instrumentedDB) ListAudit(ctx context.Context, filter AuditFilter) ([]AuditEntry, error) {
+	var start = time.Now()
+	entries, err := d.next.ListAudit(ctx, filter)
+	d.observe("ListAudit", start, errorResult(err))
+	return entries, err
+}
+
+func (d *instrumentedDB) GetBalanceAsOf(ctx context.Context, username string, t time.Time) (map[string]int64, error) {
+	var start = time.Now()
+	balance, err := d.next.GetBalanceAsOf(ctx, username, t)
+	d.observe("GetBalanceAsOf", start, errorResult(err))
+	return balance, err
+}
+
+func (d *instrumentedDB) GetTopUsers(ctx context.Context, offset, limit int) ([]CoinDetails, error) {
+	var start = time.Now()
+	users, err := d.next.GetTopUsers(ctx, offset, limit)
+	d.observe("GetTopUsers", start, errorResult(err))
+	return users, err
+}
+
+func (d *instrumentedDB) GetUserIncludingDeleted(ctx context.Context, username string) (*LoginDetails, error) {
+	var start = time.Now()
+	loginDetails, err := d.next.GetUserIncludingDeleted(ctx, username)
+	d.observe("GetUserIncludingDeleted", start, errorResult(err))
+	return loginDetails, err
+}
+
+func (d *instrumentedDB) DeleteUser(ctx context.Context, username string) error {
+	var start = time.Now()
+	var err error = d.next.DeleteUser(ctx, username)
+	d.observe("DeleteUser", start, errorResult(err))
+	return err
+}
+
+func (d *instrumentedDB) RestoreUser(ctx context.Context, username string) error {
+	var start = time.Now()
+	var err error = d.next.RestoreUser(ctx, username)
+	d.observe("RestoreUser", start, errorResult(err))
+	return err
+}
+
+func (d *instrumentedDB) SetupDatabase() error {
+	var start = time.Now()
+	var err error = d.next.SetupDatabase()
+	d.observe("SetupDatabase", start, errorResult(err))
+	return err
+}
+
+func (d *instrumentedDB) Ping(ctx context.Context) error {
+	var start = time.Now()
+	var err error = d.next.Ping(ctx)
+	d.observe("Ping", start, errorResult(err))
+	return err
+}
+
+func (d *instrumentedDB) Close() error {
+	return d.next.Close()
+}
+
+func errorResult(err error) string {
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.Is(err, ErrUserNotFound), errors.Is(err, ErrSessionNotFound), errors.Is(err, ErrAPIKeyNotFound), errors.Is(err, ErrUserDeleted), errors.Is(err, ErrSenderNotFound), errors.Is(err, ErrNoBalanceYet):
+		return "not_found"
+	case errors.Is(err, ErrInsufficientFunds):
+		return "insufficient_funds"
+	case errors.Is(err, ErrUserExists), errors.Is(err, ErrKeyReserved):
+		return "exists"
+	case errors.Is(err, ErrVersionConflict):
+		return "conflict"
+	case errors.Is(err, ErrSelfTransfer), errors.Is(err, ErrAccountFrozen):
+		return "rejected"
+	default:
+		return "error"
+	}
+}
@@ -0,0 +1,68 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/internal/config"
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrNotSetUp is returned by the Ping of a database started with
+// database.lazy until it has been set up.
+var ErrNotSetUp = errors.New("database is not set up yet")
+
+// maxSetupDelay caps the delay between the attempts of lazyDB.
+const maxSetupDelay = 30 * time.Second
+
+// lazyDB sets up a database the server started without reaching, retrying
+// in the background until it succeeds. Until then Ping fails, keeping the
+// server out of rotation, and the other calls fail as the database does.
+type lazyDB struct {
+	Database
+	ready  atomic.Bool
+	cancel context.CancelFunc
+}
+
+func lazy(database Database, cfg config.DatabaseConfig, logger *log.Logger) *lazyDB {
+	ctx, cancel := context.WithCancel(context.Background())
+	var d = &lazyDB{Database: database, cancel: cancel}
+	go d.setUp(ctx, cfg.Driver, logger)
+	return d
+}
+
+func (d *lazyDB) setUp(ctx context.Context, driver string, logger *log.Logger) {
+	var delay time.Duration = time.Second
+	for {
+		err := d.Database.SetupDatabase()
+		if err == nil {
+			d.ready.Store(true)
+			logger.Infof("Set up the %s database", driver)
+			return
+		}
+		logger.Warnf("Setting up %s database, retrying in %s: %v", driver, delay, err)
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return
+		}
+		delay = min(2*delay, maxSetupDelay)
+	}
+}
+
+func (d *lazyDB) Ping(ctx context.Context) error {
+	if !d.ready.Load() {
+		return ErrNotSetUp
+	}
+	return d.Database.Ping(ctx)
+}
+
+// Close doesn't wait for an attempt in progress, which the closed
+// database fails.
+func (d *lazyDB) Close() error {
+	d.cancel()
+	return d.Database.Close()
+}
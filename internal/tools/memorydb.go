@@ -0,0 +1,1168 @@
+package tools
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"maps"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/config"
+	"github.com/RashedMaaitah/goapi/internal/ledger"
+	log "github.com/sirupsen/logrus"
+)
+
+// InMemoryDB keeps everything in maps of its own, which are gone when the
+// server stops. It is safe for concurrent use.
+type InMemoryDB struct {
+	logger *log.Logger
+
+	// mu guards everything below. The ledger locks itself too, but is posted
+	// to under mu so it never disagrees with coins.
+	mu           sync.RWMutex
+	users        map[string]LoginDetails
+	coins        map[string]CoinDetails
+	sessions     map[string]Session
+	apiKeys      map[string]APIKey
+	transactions []Transaction
+	idempotency  map[string]IdempotencyRecord
+	ledger       *ledger.Book
+	audit        []AuditEntry
+
+	latency time.Duration
+	faults  FaultFunc
+
+	// snapshot is the file the data is saved to, if any. Closing done stops
+	// saving it periodically, and stopped is closed once that has.
+	snapshot      string
+	savedChecksum string
+	done          chan struct{}
+	stopped       chan struct{}
+}
+
+// NewInMemoryDB returns an InMemoryDB without users, answering at once
+// unless WithLatency says otherwise.
+func NewInMemoryDB(logger *log.Logger, opts ...MemoryOption) *InMemoryDB {
+	var d = &InMemoryDB{
+		logger:      logger,
+		users:       map[string]LoginDetails{},
+		coins:       map[string]CoinDetails{},
+		sessions:    map[string]Session{},
+		apiKeys:     map[string]APIKey{},
+		idempotency: map[string]IdempotencyRecord{},
+		ledger:      ledger.NewBook(),
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+// NewMockDB returns an InMemoryDB holding the demo users and tokens, with
+// their balances issued by the system account. It is what the mock driver
+// serves.
+func NewMockDB(logger *log.Logger, opts ...MemoryOption) *InMemoryDB {
+	var d *InMemoryDB = NewInMemoryDB(logger, opts...)
+	d.users = maps.Clone(mockLoginDetails)
+	d.coins = maps.Clone(mockCoinDetails)
+	d.sessions = maps.Clone(mockSessions)
+	// Dated from the creation of their users, for GetBalanceAsOf.
+	var opening []ledger.Entry
+	for username, coinData := range d.coins {
+		for currency, amount := range coinData.AllBalances() {
+			for _, entry := range ledger.Move("opening-"+username, ledger.SystemAccount, username, currency, amount) {
+				entry.CreatedAt = d.users[username].CreatedAt
+				opening = append(opening, entry)
+			}
+		}
+	}
+	d.ledger = ledger.LoadBook(opening)
+	return d
+}
+
+// openMemory returns the store of the mock driver, which leaves out the
+// demo users when a seed file is to fill it.
+func openMemory(cfg config.DatabaseConfig, logger *log.Logger) (*InMemoryDB, error) {
+	var opts = []MemoryOption{WithLatency(cfg.Latency.Duration())}
+	if cfg.Faults.ErrorRate > 0 || cfg.Faults.TimeoutRate > 0 {
+		faults, err := configuredFaults(cfg.Faults, logger)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithFaults(faults))
+	}
+
+	if cfg.Seed != "" {
+		return NewInMemoryDB(logger, opts...), nil
+	}
+	return NewMockDB(logger, opts...), nil
+}
+
+// The mock maps are the seed of NewMockDB, copied and never changed.
+var mockLoginDetails = map[string]LoginDetails{
+	"alex": {
+		Username:     "alex",
+		PasswordHash: mockPasswordHash,
+		Role:         RoleUser,
+		CreatedAt:    mockCreatedAt,
+	},
+	"maria": {
+		Username:     "maria",
+		PasswordHash: mockPasswordHash,
+		Role:         RoleUser,
+		CreatedAt:    mockCreatedAt,
+	},
+	"john": {
+		Username:     "john",
+		PasswordHash: mockPasswordHash,
+		Role:         RoleUser,
+		CreatedAt:    mockCreatedAt,
+	},
+	"admin": {
+		Username:     "admin",
+		PasswordHash: mockPasswordHash,
+		Role:         RoleAdmin,
+		CreatedAt:    mockCreatedAt,
+	},
+}
+
+var mockCreatedAt = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// mockPasswordHash is the bcrypt hash of "password".
+const mockPasswordHash = "$2a$10$j6vpzqvZl7qAgxhBEIEZBuJqmqk7a./dGkUw8volv/a86PbB2RXP."
+
+// The demo tokens never expire. They are hashed like any other.
+var mockSessions = func() map[string]Session {
+	var sessions = map[string]Session{
+		"123ABC": {Username: "alex"},
+		"456DEF": {Username: "maria"},
+		"789GHI": {Username: "john"},
+		"000ADM": {Username: "admin"},
+	}
+	hashSessions(sessions)
+	return sessions
+}()
+
+var mockCoinDetails = map[string]CoinDetails{
+	"alex": {
+		Coins:    1000,
+		Username: "alex",
+		Version:  1,
+	},
+	"maria": {
+		Coins:    2500,
+		Username: "maria",
+		Version:  1,
+	},
+	"john": {
+		Coins:    500,
+		Username: "john",
+		Version:  1,
+	},
+	"admin": {
+		Coins:    0,
+		Username: "admin",
+		Version:  1,
+	},
+}
+
+func (d *InMemoryDB) GetUserLoginDetails(ctx context.Context, username string) (*LoginDetails, error) {
+	username = api.NormalizeUsername(username)
+	d.logger.Debugf("InMemoryDB: GetUserLoginDetails(%q)", username)
+
+	if err := d.wait(ctx, "GetUserLoginDetails"); err != nil {
+		return nil, err
+	}
+
+	var clientData = LoginDetails{}
+
+	d.mu.RLock()
+	clientData, ok := d.activeUser(username)
+	d.mu.RUnlock()
+
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+
+	return &clientData, nil
+}
+
+func (d *InMemoryDB) GetUserCoins(ctx context.Context, username string) (*CoinDetails, error) {
+	username = api.NormalizeUsername(username)
+	d.logger.Debugf("InMemoryDB: GetUserCoins(%q)", username)
+
+	if err := d.wait(ctx, "GetUserCoins"); err != nil {
+		return nil, err
+	}
+	var coinData = CoinDetails{}
+	d.mu.RLock()
+	coinData, ok := d.coins[username]
+	if _, active := d.activeUser(username); !active {
+		ok = false
+	}
+	d.mu.RUnlock()
+
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	return &coinData, nil
+}
+
+func (d *InMemoryDB) AdjustUserCoins(ctx context.Context, username string, currency string, delta int64, version int64) (*CoinDetails, error) {
+	username = api.NormalizeUsername(username)
+	d.logger.Debugf("InMemoryDB: AdjustUserCoins(%q, %q, %d, %d)", username, currency, delta, version)
+
+	if err := d.wait(ctx, "AdjustUserCoins"); err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.activeUser(username); !ok {
+		return nil, ErrUserNotFound
+	}
+
+	var coinData CoinDetails = d.coins[username]
+	if version != 0 && coinData.Version != version {
+		return nil, ErrVersionConflict
+	}
+	if coinData.Frozen {
+		return nil, ErrAccountFrozen
+	}
+	balance, err := addBalance(coinData.Balance(currency), delta)
+	if err != nil {
+		return nil, err
+	}
+	if balance < coinData.Floor() {
+		return nil, ErrInsufficientFunds
+	}
+
+	var id string = newID()
+	if err := d.ledger.Post(ledger.Move(id, ledger.SystemAccount, username, currency, delta)...); err != nil {
+		return nil, err
+	}
+
+	coinData = withBalance(coinData, currency, balance)
+	coinData = d.putCoins(coinData)
+
+	var kind, amount = TransactionDeposit, delta
+	if delta < 0 {
+		kind, amount = TransactionWithdrawal, -delta
+	}
+	d.recordTransaction(Transaction{
+		ID:       id,
+		Username: username,
+		Type:     kind,
+		Currency: currency,
+		Amount:   amount,
+		Balance:  balance,
+	})
+
+	return &coinData, nil
+}
+
+func (d *InMemoryDB) AdminAdjustCoins(ctx context.Context, username string, adjustment AdminAdjustment) (*CoinDetails, error) {
+	username = api.NormalizeUsername(username)
+	d.logger.Debugf("InMemoryDB: AdminAdjustCoins(%q, %+v)", username, adjustment)
+
+	if err := d.wait(ctx, "AdminAdjustCoins"); err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.activeUser(username); !ok {
+		return nil, ErrUserNotFound
+	}
+
+	var coinData CoinDetails = d.coins[username]
+	if adjustment.Version != 0 && coinData.Version != adjustment.Version {
+		return nil, ErrVersionConflict
+	}
+	var delta int64 = adjustment.Delta
+	if adjustment.Set {
+		delta = adjustment.Balance - coinData.Coins
+	}
+	if coins, err := addBalance(coinData.Coins, delta); err != nil {
+		return nil, err
+	} else if coins < 0 && !adjustment.Force {
+		return nil, ErrInsufficientFunds
+	}
+
+	var id string = newID()
+	if err := d.ledger.Post(ledger.Move(id, ledger.SystemAccount, username, DefaultCurrency, delta)...); err != nil {
+		return nil, err
+	}
+
+	coinData.Coins += delta
+	coinData = d.putCoins(coinData)
+
+	d.recordTransaction(Transaction{
+		ID:       id,
+		Username: username,
+		Type:     TransactionAdmin,
+		Currency: DefaultCurrency,
+		Amount:   delta,
+		Balance:  coinData.Coins,
+		Actor:    adjustment.Actor,
+		Reason:   adjustment.Reason,
+	})
+
+	return &coinData, nil
+}
+
+func (d *InMemoryDB) SetOverdraft(ctx context.Context, username string, limit int64) (*CoinDetails, error) {
+	username = api.NormalizeUsername(username)
+	d.logger.Debugf("InMemoryDB: SetOverdraft(%q, %d)", username, limit)
+
+	if err := d.wait(ctx, "SetOverdraft"); err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.activeUser(username); !ok {
+		return nil, ErrUserNotFound
+	}
+
+	var coinData CoinDetails = d.coins[username]
+	coinData.OverdraftLimit = limit
+	coinData = d.putCoins(coinData)
+
+	return &coinData, nil
+}
+
+func (d *InMemoryDB) SetFrozen(ctx context.Context, username string, frozen bool, actor string, reason string) (*CoinDetails, error) {
+	username = api.NormalizeUsername(username)
+	d.logger.Debugf("InMemoryDB: SetFrozen(%q, %v)", username, frozen)
+
+	if err := d.wait(ctx, "SetFrozen"); err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.activeUser(username); !ok {
+		return nil, ErrUserNotFound
+	}
+
+	var coinData CoinDetails = d.coins[username]
+	coinData.Frozen = frozen
+	coinData = d.putCoins(coinData)
+
+	var kind string = TransactionFreeze
+	if !frozen {
+		kind = TransactionUnfreeze
+	}
+	d.recordTransaction(Transaction{
+		ID:       newID(),
+		Username: username,
+		Type:     kind,
+		Currency: DefaultCurrency,
+		Balance:  coinData.Coins,
+		Actor:    actor,
+		Reason:   reason,
+	})
+
+	return &coinData, nil
+}
+
+func (d *InMemoryDB) Transfer(ctx context.Context, from string, to string, currency string, amount int64) (*TransferDetails, error) {
+	from, to = api.NormalizeUsername(from), api.NormalizeUsername(to)
+	d.logger.Debugf("InMemoryDB: Transfer(%q, %q, %q, %d)", from, to, currency, amount)
+
+	if from == to {
+		return nil, ErrSelfTransfer
+	}
+
+	if err := d.wait(ctx, "Transfer"); err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.activeUser(from); !ok {
+		return nil, ErrSenderNotFound
+	}
+	if loginDetails, ok := d.users[to]; !ok {
+		return nil, ErrUserNotFound
+	} else if loginDetails.Deleted() {
+		return nil, ErrUserDeleted
+	}
+
+	var sender, recipient = d.coins[from], d.coins[to]
+	if sender.Frozen || recipient.Frozen {
+		return nil, ErrAccountFrozen
+	}
+	if sender.Balance(currency)-amount < sender.Floor() {
+		return nil, ErrInsufficientFunds
+	}
+	if _, err := addBalance(recipient.Balance(currency), amount); err != nil {
+		return nil, err
+	}
+
+	var id string = newID()
+	if err := d.ledger.Post(ledger.Move(id, from, to, currency, amount)...); err != nil {
+		return nil, err
+	}
+
+	// Both balances are written under the same lock, nothing can observe
+	// the debit without the credit.
+	sender = withBalance(sender, currency, sender.Balance(currency)-amount)
+	recipient = withBalance(recipient, currency, recipient.Balance(currency)+amount)
+	sender = d.putCoins(sender)
+	recipient = d.putCoins(recipient)
+
+	var out = d.recordTransaction(Transaction{
+		ID:           id,
+		Username:     from,
+		Type:         TransactionTransferOut,
+		Currency:     currency,
+		Amount:       amount,
+		Counterparty: to,
+		Balance:      sender.Balance(currency),
+	})
+	d.recordTransaction(Transaction{
+		ID:           id,
+		Username:     to,
+		Type:         TransactionTransferIn,
+		Currency:     currency,
+		Amount:       amount,
+		Counterparty: from,
+		Balance:      recipient.Balance(currency),
+	})
+
+	return &TransferDetails{
+		ID:        id,
+		From:      from,
+		To:        to,
+		Currency:  currency,
+		Amount:    amount,
+		FromCoins: sender.Balance(currency),
+		ToCoins:   recipient.Balance(currency),
+		CreatedAt: out.CreatedAt,
+	}, nil
+}
+
+func (d *InMemoryDB) ListTransactions(ctx context.Context, username string, limit int, before int64) ([]Transaction, error) {
+	username = api.NormalizeUsername(username)
+	d.logger.Debugf("InMemoryDB: ListTransactions(%q, %d, %d)", username, limit, before)
+
+	if err := d.wait(ctx, "ListTransactions"); err != nil {
+		return nil, err
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	var transactions = []Transaction{}
+	for i := len(d.transactions) - 1; i >= 0 && len(transactions) < limit; i-- {
+		var t Transaction = d.transactions[i]
+		if t.Username != username || (before > 0 && t.Seq >= before) {
+			continue
+		}
+		transactions = append(transactions, t)
+	}
+
+	return transactions, nil
+}
+
+func (d *InMemoryDB) CreateUser(ctx context.Context, username string, passwordHash string) (*LoginDetails, error) {
+	username = api.NormalizeUsername(username)
+	d.logger.Debugf("InMemoryDB: CreateUser(%q)", username)
+
+	if err := d.wait(ctx, "CreateUser"); err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.users[username]; ok {
+		return nil, ErrUserExists
+	}
+
+	var loginDetails = LoginDetails{
+		Username:     username,
+		PasswordHash: passwordHash,
+		Role:         RoleUser,
+		CreatedAt:    time.Now().UTC(),
+	}
+	d.users[username] = loginDetails
+	d.coins[username] = CoinDetails{Username: username, Version: 1}
+
+	return &loginDetails, nil
+}
+
+func (d *InMemoryDB) ImportUsers(ctx context.Context, users []NewUser, atomic bool) ([]error, error) {
+	users = normalizeUsers(users)
+	d.logger.Debugf("InMemoryDB: ImportUsers(%d users, %v)", len(users), atomic)
+
+	if err := d.wait(ctx, "ImportUsers"); err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var errs = make([]error, len(users))
+	var failed bool
+	for i, user := range users {
+		if _, ok := d.users[user.Username]; ok {
+			errs[i] = ErrUserExists
+			failed = true
+		}
+	}
+	if atomic && failed {
+		return errs, nil
+	}
+
+	var now = time.Now().UTC()
+	for i, user := range users {
+		if errs[i] != nil {
+			continue
+		}
+		if err := d.ledger.Post(ledger.Move(newID(), ledger.SystemAccount, user.Username, DefaultCurrency, user.Coins)...); err != nil {
+			return nil, err
+		}
+		d.users[user.Username] = LoginDetails{
+			Username:     user.Username,
+			PasswordHash: user.PasswordHash,
+			Role:         user.role(),
+			CreatedAt:    now,
+		}
+		d.coins[user.Username] = CoinDetails{Username: user.Username, Coins: user.Coins, Version: 1}
+	}
+
+	return errs, nil
+}
+
+func (d *InMemoryDB) UpdateUser(ctx context.Context, username string, update UserUpdate) (*LoginDetails, error) {
+	username = api.NormalizeUsername(username)
+	d.logger.Debugf("InMemoryDB: UpdateUser(%q)", username)
+
+	if err := d.wait(ctx, "UpdateUser"); err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	loginDetails, ok := d.activeUser(username)
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+
+	if update.DisplayName != nil {
+		loginDetails.DisplayName = *update.DisplayName
+	}
+	if update.Email != nil {
+		loginDetails.Email = *update.Email
+	}
+	d.users[username] = loginDetails
+
+	return &loginDetails, nil
+}
+
+func (d *InMemoryDB) UpdatePassword(ctx context.Context, username string, passwordHash string) error {
+	username = api.NormalizeUsername(username)
+	d.logger.Debugf("InMemoryDB: UpdatePassword(%q)", username)
+
+	if err := d.wait(ctx, "UpdatePassword"); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	loginDetails, ok := d.activeUser(username)
+	if !ok {
+		return ErrUserNotFound
+	}
+
+	loginDetails.PasswordHash = passwordHash
+	d.users[username] = loginDetails
+	return nil
+}
+
+func (d *InMemoryDB) CreateSession(ctx context.Context, session Session, replace bool) error {
+	session.Username = api.NormalizeUsername(session.Username)
+	d.logger.Debugf("InMemoryDB: CreateSession(%q, %v)", session.Username, replace)
+
+	if err := d.wait(ctx, "CreateSession"); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.activeUser(session.Username); !ok {
+		return ErrUserNotFound
+	}
+
+	var now = time.Now()
+	for token, s := range d.sessions {
+		if (replace && s.Username == session.Username) || s.Expired(now) {
+			delete(d.sessions, token)
+		}
+	}
+	d.sessions[session.Token] = session
+
+	return nil
+}
+
+func (d *InMemoryDB) GetSession(ctx context.Context, token string) (*Session, error) {
+	d.logger.Debug("InMemoryDB: GetSession")
+
+	if err := d.wait(ctx, "GetSession"); err != nil {
+		return nil, err
+	}
+
+	d.mu.RLock()
+	session, ok := d.sessions[token]
+	d.mu.RUnlock()
+
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	return &session, nil
+}
+
+func (d *InMemoryDB) DeleteSession(ctx context.Context, token string) error {
+	d.logger.Debug("InMemoryDB: DeleteSession")
+
+	if err := d.wait(ctx, "DeleteSession"); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.sessions[token]; !ok {
+		return ErrSessionNotFound
+	}
+	delete(d.sessions, token)
+	return nil
+}
+
+func (d *InMemoryDB) DeleteUserSessions(ctx context.Context, username string) error {
+	username = api.NormalizeUsername(username)
+	d.logger.Debugf("InMemoryDB: DeleteUserSessions(%q)", username)
+
+	if err := d.wait(ctx, "DeleteUserSessions"); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for token, s := range d.sessions {
+		if s.Username == username {
+			delete(d.sessions, token)
+		}
+	}
+	return nil
+}
+
+func (d *InMemoryDB) CreateAPIKey(ctx context.Context, key APIKey) error {
+	d.logger.Debugf("InMemoryDB: CreateAPIKey(%q)", key.Name)
+
+	if err := d.wait(ctx, "CreateAPIKey"); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.apiKeys[key.ID] = key
+	return nil
+}
+
+func (d *InMemoryDB) ListAPIKeys(ctx context.Context) ([]APIKey, error) {
+	d.logger.Debug("InMemoryDB: ListAPIKeys")
+
+	if err := d.wait(ctx, "ListAPIKeys"); err != nil {
+		return nil, err
+	}
+
+	d.mu.RLock()
+	var keys = make([]APIKey, 0, len(d.apiKeys))
+	for _, key := range d.apiKeys {
+		keys = append(keys, key)
+	}
+	d.mu.RUnlock()
+
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].CreatedAt.Equal(keys[j].CreatedAt) {
+			return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+		}
+		return keys[i].ID < keys[j].ID
+	})
+	return keys, nil
+}
+
+func (d *InMemoryDB) GetAPIKey(ctx context.Context, hash string) (*APIKey, error) {
+	d.logger.Debug("InMemoryDB: GetAPIKey")
+
+	if err := d.wait(ctx, "GetAPIKey"); err != nil {
+		return nil, err
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	for _, key := range d.apiKeys {
+		if key.Hash == hash {
+			return &key, nil
+		}
+	}
+	return nil, ErrAPIKeyNotFound
+}
+
+func (d *InMemoryDB) TouchAPIKey(ctx context.Context, id string, at time.Time) error {
+	d.logger.Debugf("InMemoryDB: TouchAPIKey(%q)", id)
+
+	if err := d.wait(ctx, "TouchAPIKey"); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key, ok := d.apiKeys[id]
+	if !ok {
+		return ErrAPIKeyNotFound
+	}
+	key.LastUsedAt = at
+	d.apiKeys[id] = key
+	return nil
+}
+
+func (d *InMemoryDB) DeleteAPIKey(ctx context.Context, id string) error {
+	d.logger.Debugf("InMemoryDB: DeleteAPIKey(%q)", id)
+
+	if err := d.wait(ctx, "DeleteAPIKey"); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.apiKeys[id]; !ok {
+		return ErrAPIKeyNotFound
+	}
+	delete(d.apiKeys, id)
+	return nil
+}
+
+func (d *InMemoryDB) GetTopUsers(ctx context.Context, offset, limit int) ([]CoinDetails, error) {
+	d.logger.Debugf("InMemoryDB: GetTopUsers(%d, %d)", offset, limit)
+
+	if err := d.wait(ctx, "GetTopUsers"); err != nil {
+		return nil, err
+	}
+
+	d.mu.RLock()
+	var users = make([]CoinDetails, 0, len(d.coins))
+	for username, coinData := range d.coins {
+		if _, ok := d.activeUser(username); ok {
+			users = append(users, coinData)
+		}
+	}
+	d.mu.RUnlock()
+
+	sort.Slice(users, func(i, j int) bool {
+		if users[i].Coins != users[j].Coins {
+			return users[i].Coins > users[j].Coins
+		}
+		return users[i].Username < users[j].Username
+	})
+
+	if offset >= len(users) {
+		return []CoinDetails{}, nil
+	}
+	users = users[offset:]
+	if len(users) > limit {
+		users = users[:limit]
+	}
+	return users, nil
+}
+
+func (d *InMemoryDB) SearchUsers(ctx context.Context, filter UserFilter) ([]UserSummary, error) {
+	d.logger.Debugf("InMemoryDB: SearchUsers(%+v)", filter)
+
+	if err := d.wait(ctx, "SearchUsers"); err != nil {
+		return nil, err
+	}
+
+	d.mu.RLock()
+	var users = []UserSummary{}
+	for username, loginDetails := range d.users {
+		var coins int64 = d.coins[username].Coins
+		switch {
+		case loginDetails.Deleted(),
+			!strings.HasPrefix(username, filter.Prefix),
+			filter.MinCoins != nil && coins < *filter.MinCoins,
+			filter.MaxCoins != nil && coins > *filter.MaxCoins,
+			filter.Role != "" && loginDetails.Role != filter.Role:
+			continue
+		}
+		users = append(users, UserSummary{
+			Username:  username,
+			Role:      loginDetails.Role,
+			Coins:     coins,
+			CreatedAt: loginDetails.CreatedAt,
+		})
+	}
+	d.mu.RUnlock()
+
+	sort.Slice(users, func(i, j int) bool {
+		var a, b = users[i], users[j]
+		if filter.Desc {
+			a, b = b, a
+		}
+		switch {
+		case filter.SortBy == SortByCoins && a.Coins != b.Coins:
+			return a.Coins < b.Coins
+		case filter.SortBy == SortByCreatedAt && !a.CreatedAt.Equal(b.CreatedAt):
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		return users[i].Username < users[j].Username
+	})
+
+	if filter.Offset >= len(users) {
+		return []UserSummary{}, nil
+	}
+	users = users[filter.Offset:]
+	if filter.Limit > 0 && len(users) > filter.Limit {
+		users = users[:filter.Limit]
+	}
+	return users, nil
+}
+
+func (d *InMemoryDB) GetStats(ctx context.Context, bounds []int64) (*Stats, error) {
+	d.logger.Debugf("InMemoryDB: GetStats(%v)", bounds)
+
+	if err := d.wait(ctx, "GetStats"); err != nil {
+		return nil, err
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	var stats = Stats{Buckets: make([]int64, len(bounds)+1)}
+	for username, coinData := range d.coins {
+		if _, ok := d.activeUser(username); !ok {
+			continue
+		}
+
+		stats.Users++
+		stats.TotalCoins += coinData.Coins
+
+		var bucket int = sort.Search(len(bounds), func(i int) bool { return coinData.Coins < bounds[i] })
+		stats.Buckets[bucket]++
+	}
+
+	return &stats, nil
+}
+
+// recordTransaction appends t to the log. d.mu must be held for writing.
+func (d *InMemoryDB) recordTransaction(t Transaction) Transaction {
+	t.Seq = int64(len(d.transactions)) + 1
+	t.CreatedAt = time.Now().UTC()
+	d.transactions = append(d.transactions, t)
+	return t
+}
+
+// putCoins stores c with its Version bumped and returns it. d.mu must be
+// held for writing.
+func (d *InMemoryDB) putCoins(c CoinDetails) CoinDetails {
+	c.Version++
+	d.coins[c.Username] = c
+	return c
+}
+
+// withBalance returns c with its balance in currency set to amount. Balances
+// is copied, so CoinDetails handed out before keep their values.
+func withBalance(c CoinDetails, currency string, amount int64) CoinDetails {
+	if currency == DefaultCurrency {
+		c.Coins = amount
+		return c
+	}
+
+	var balances = make(map[string]int64, len(c.Balances)+1)
+	for name, value := range c.Balances {
+		balances[name] = value
+	}
+	balances[currency] = amount
+	c.Balances = balances
+	return c
+}
+
+func newID() string {
+	var b = make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func (d *InMemoryDB) GetUserIncludingDeleted(ctx context.Context, username string) (*LoginDetails, error) {
+	username = api.NormalizeUsername(username)
+	d.logger.Debugf("InMemoryDB: GetUserIncludingDeleted(%q)", username)
+
+	if err := d.wait(ctx, "GetUserIncludingDeleted"); err != nil {
+		return nil, err
+	}
+
+	d.mu.RLock()
+	loginDetails, ok := d.users[username]
+	d.mu.RUnlock()
+
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	return &loginDetails, nil
+}
+
+func (d *InMemoryDB) DeleteUser(ctx context.Context, username string) error {
+	username = api.NormalizeUsername(username)
+	d.logger.Debugf("InMemoryDB: DeleteUser(%q)", username)
+
+	if err := d.wait(ctx, "DeleteUser"); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	loginDetails, ok := d.activeUser(username)
+	if !ok {
+		return ErrUserNotFound
+	}
+
+	loginDetails.DeletedAt = time.Now().UTC()
+	d.users[username] = loginDetails
+	return nil
+}
+
+func (d *InMemoryDB) RestoreUser(ctx context.Context, username string) error {
+	username = api.NormalizeUsername(username)
+	d.logger.Debugf("InMemoryDB: RestoreUser(%q)", username)
+
+	if err := d.wait(ctx, "RestoreUser"); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	loginDetails, ok := d.users[username]
+	if !ok {
+		return ErrUserNotFound
+	}
+
+	loginDetails.DeletedAt = time.Time{}
+	d.users[username] = loginDetails
+	return nil
+}
+
+// activeUser looks up a user that is not soft-deleted. d.mu must be held.
+func (d *InMemoryDB) activeUser(username string) (LoginDetails, bool) {
+	loginDetails, ok := d.users[username]
+	if !ok || loginDetails.Deleted() {
+		return LoginDetails{}, false
+	}
+	return loginDetails, true
+}
+
+func (d *InMemoryDB) LedgerEntries(ctx context.Context, transactionID string) ([]ledger.Entry, error) {
+	d.logger.Debugf("InMemoryDB: LedgerEntries(%q)", transactionID)
+
+	if err := d.wait(ctx, "LedgerEntries"); err != nil {
+		return nil, err
+	}
+
+	return d.ledger.Transaction(transactionID), nil
+}
+
+func (d *InMemoryDB) GetBalanceAsOf(ctx context.Context, username string, t time.Time) (map[string]int64, error) {
+	username = api.NormalizeUsername(username)
+	d.logger.Debugf("InMemoryDB: GetBalanceAsOf(%q, %s)", username, t.Format(time.RFC3339Nano))
+
+	if err := d.wait(ctx, "GetBalanceAsOf"); err != nil {
+		return nil, err
+	}
+
+	d.mu.RLock()
+	loginDetails, ok := d.activeUser(username)
+	d.mu.RUnlock()
+
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	if t.Before(loginDetails.CreatedAt) {
+		return nil, ErrNoBalanceYet
+	}
+	return d.ledger.BalanceAsOf(username, t), nil
+}
+
+func (d *InMemoryDB) VerifyLedger(ctx context.Context) ([]ledger.Drift, error) {
+	d.logger.Debugf("InMemoryDB: VerifyLedger()")
+
+	if err := d.wait(ctx, "VerifyLedger"); err != nil {
+		return nil, err
+	}
+
+	// Held for writing so no movement is half posted while comparing.
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var cached = make(map[string]map[string]int64, len(d.coins))
+	for username, coinData := range d.coins {
+		cached[username] = coinData.AllBalances()
+	}
+
+	return ledger.Compare(cached, d.ledger.Balances()), nil
+}
+
+func (d *InMemoryDB) AppendAudit(ctx context.Context, entry AuditEntry) (*AuditEntry, error) {
+	d.logger.Debugf("InMemoryDB: AppendAudit(%q, %q)", entry.Action, entry.Target)
+
+	if err := d.wait(ctx, "AppendAudit"); err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var last AuditEntry
+	if len(d.audit) > 0 {
+		last = d.audit[len(d.audit)-1]
+	}
+	entry = chainAudit(entry, last)
+	d.audit = append(d.audit, entry)
+	return &entry, nil
+}
+
+func (d *InMemoryDB) ListAudit(ctx context.Context, filter AuditFilter) ([]AuditEntry, error) {
+	d.logger.Debugf("InMemoryDB: ListAudit(%+v)", filter)
+
+	if err := d.wait(ctx, "ListAudit"); err != nil {
+		return nil, err
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	var entries = []AuditEntry{}
+	for i := len(d.audit) - 1; i >= 0 && len(entries) < filter.Limit; i-- {
+		var e AuditEntry = d.audit[i]
+		switch {
+		case filter.Before > 0 && e.Seq >= filter.Before,
+			filter.User != "" && e.Actor != filter.User && e.Target != filter.User,
+			filter.Action != "" && e.Action != filter.Action:
+			continue
+		case e.CreatedAt.Before(filter.Since):
+			// The entries are in the order of their times, the rest are older.
+			return entries, nil
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+func (d *InMemoryDB) ReserveIdempotencyKey(ctx context.Context, key string, requestHash string, expiresAt time.Time) (*IdempotencyRecord, error) {
+	d.logger.Debugf("InMemoryDB: ReserveIdempotencyKey(%q)", key)
+
+	if err := d.wait(ctx, "ReserveIdempotencyKey"); err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if record, ok := d.idempotency[key]; ok && time.Now().Before(record.ExpiresAt) {
+		return &record, ErrKeyReserved
+	}
+
+	d.idempotency[key] = IdempotencyRecord{Key: key, RequestHash: requestHash, ExpiresAt: expiresAt}
+	return nil, nil
+}
+
+func (d *InMemoryDB) CompleteIdempotencyKey(ctx context.Context, key string, statusCode int, contentType string, body []byte) error {
+	d.logger.Debugf("InMemoryDB: CompleteIdempotencyKey(%q, %d)", key, statusCode)
+
+	if err := d.wait(ctx, "CompleteIdempotencyKey"); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var record, ok = d.idempotency[key]
+	if !ok {
+		// Expired while the request ran, there is nothing to replay to.
+		return nil
+	}
+	record.Done = true
+	record.StatusCode = statusCode
+	record.ContentType = contentType
+	record.Body = body
+	d.idempotency[key] = record
+
+	// Expired keys are only dropped here, reservations of them are replaced.
+	var now = time.Now()
+	for k, r := range d.idempotency {
+		if !now.Before(r.ExpiresAt) {
+			delete(d.idempotency, k)
+		}
+	}
+
+	return nil
+}
+
+func (d *InMemoryDB) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	d.logger.Debugf("InMemoryDB: ReleaseIdempotencyKey(%q)", key)
+
+	if err := d.wait(ctx, "ReleaseIdempotencyKey"); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.idempotency, key)
+	return nil
+}
+
+func (d *InMemoryDB) SetupDatabase() error {
+	return nil
+}
+
+// Ping has no latency, which would eat into the ping timeout, but may
+// fail like the other methods.
+func (d *InMemoryDB) Ping(ctx context.Context) error {
+	if err := d.fault(ctx, "Ping"); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// Close saves a last snapshot, when d has a snapshot file.
+func (d *InMemoryDB) Close() error {
+	if d.snapshot == "" {
+		return nil
+	}
+
+	close(d.done)
+	<-d.stopped
+	return d.saveSnapshot()
+}
@@ -0,0 +1,128 @@
+package tools
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrationFiles holds the migrations of every dialect, named
+// <version>_<name>.sql with versions counting up from 1. Once released, a
+// migration is never changed: changes to the schema are new migrations.
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+// ErrSchemaAhead is returned by SetupDatabase when the database has
+// migrations this server doesn't know, applied by a newer one.
+var ErrSchemaAhead = errors.New("database schema is newer than this server")
+
+type migration struct {
+	version int64
+	name    string
+	sql     string
+}
+
+// loadMigrations returns the migrations in dir of migrationFiles, by
+// version.
+func loadMigrations(dir string) ([]migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []migration
+	for _, entry := range entries {
+		var name, ok = strings.CutSuffix(entry.Name(), ".sql")
+		if !ok {
+			continue
+		}
+		prefix, _, _ := strings.Cut(name, "_")
+		version, err := strconv.ParseInt(prefix, 10, 64)
+		if err != nil || version < 1 {
+			return nil, fmt.Errorf("migration %s: name must start with a positive version", entry.Name())
+		}
+
+		content, err := fs.ReadFile(migrationFiles, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, migration{version: version, name: name, sql: string(content)})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].version == migrations[i-1].version {
+			return nil, fmt.Errorf("migrations %s and %s have the same version", migrations[i-1].name, migrations[i].name)
+		}
+	}
+	return migrations, nil
+}
+
+// migrate applies the migrations of the dialect the database doesn't have
+// yet, each in a transaction of its own along with its row in
+// schema_migrations, so running it again applies nothing twice. It fails
+// with ErrSchemaAhead before applying any if the database has versions
+// beyond the last one known.
+func (d *sqlDB) migrate(ctx context.Context) error {
+	migrations, err := loadMigrations(d.dialect.migrations)
+	if err != nil {
+		return err
+	}
+
+	if _, err = d.db.ExecContext(ctx, d.dialect.migrationsTable); err != nil {
+		return fmt.Errorf("creating schema_migrations: %w", err)
+	}
+
+	var applied int64
+	err = d.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&applied)
+	if err != nil {
+		return err
+	}
+	var known int64 = migrations[len(migrations)-1].version
+	if applied > known {
+		return fmt.Errorf("%w: it is at version %d, this server knows up to %d", ErrSchemaAhead, applied, known)
+	}
+
+	for _, m := range migrations {
+		var ran bool
+		err = d.inTx(ctx, func(tx *sql.Tx) error {
+			if d.dialect.lockMigrations != "" {
+				if _, err := tx.ExecContext(ctx, d.dialect.lockMigrations); err != nil {
+					return err
+				}
+			}
+
+			// Checked in the transaction, as another server may have applied
+			// it since.
+			var count int
+			err := d.queryRow(ctx, tx, `SELECT COUNT(*) FROM schema_migrations WHERE version = ?`, m.version).Scan(&count)
+			if err != nil || count > 0 {
+				return err
+			}
+
+			if _, err = tx.ExecContext(ctx, m.sql); err != nil {
+				return err
+			}
+			_, err = d.exec(ctx, tx, `INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`,
+				m.version, m.name, time.Now().UTC())
+			ran = err == nil
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("migration %s: %w", m.name, err)
+		}
+		if ran {
+			d.logger.Infof("Applied migration %s", m.name)
+		}
+	}
+	return nil
+}
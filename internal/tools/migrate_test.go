@@ -0,0 +1,149 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/internal/config"
+)
+
+// openSQLiteFile returns the database of a new SQLite file, without its
+// schema set up.
+func openSQLiteFile(t *testing.T) *sqlDB {
+	var cfg config.DatabaseConfig = config.Default().Database
+	cfg.Driver = "sqlite"
+	cfg.Path = filepath.Join(t.TempDir(), "goapi.db")
+
+	database, err := openSQLite(cfg, testLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	return database
+}
+
+// appliedMigrations returns the versions in schema_migrations.
+func appliedMigrations(t *testing.T, database *sqlDB) []int64 {
+	t.Helper()
+	rows, err := database.db.Query(`SELECT version FROM schema_migrations ORDER BY version`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var versions []int64
+	for rows.Next() {
+		var version int64
+		if err = rows.Scan(&version); err != nil {
+			t.Fatal(err)
+		}
+		versions = append(versions, version)
+	}
+	return versions
+}
+
+func sqliteMigrations(t *testing.T) []migration {
+	t.Helper()
+	migrations, err := loadMigrations(sqliteDialect.migrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return migrations
+}
+
+func TestMigrationsAppliedInOrder(t *testing.T) {
+	var database *sqlDB = openSQLiteFile(t)
+	var migrations []migration = sqliteMigrations(t)
+
+	if err := database.SetupDatabase(); err != nil {
+		t.Fatal(err)
+	}
+	var versions []int64 = appliedMigrations(t, database)
+	if len(versions) != len(migrations) {
+		t.Fatalf("applied %v, want all %d migrations", versions, len(migrations))
+	}
+	for i, m := range migrations {
+		if versions[i] != m.version {
+			t.Errorf("applied %v, want the versions of %v", versions, migrations)
+			break
+		}
+	}
+
+	// Running them again changes nothing.
+	if err := database.SetupDatabase(); err != nil {
+		t.Fatalf("SetupDatabase again: %v", err)
+	}
+	if again := appliedMigrations(t, database); len(again) != len(versions) {
+		t.Errorf("applied %v after running again, want %v", again, versions)
+	}
+}
+
+func TestMigrationsUpgradeTheInitialSchema(t *testing.T) {
+	var database *sqlDB = openSQLiteFile(t)
+	var initial migration = sqliteMigrations(t)[0]
+
+	// As a server knowing only the initial migration left it.
+	for _, statement := range []string{sqliteDialect.migrationsTable, initial.sql} {
+		if _, err := database.db.Exec(statement); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var now = time.Now().UTC()
+	for _, statement := range []struct {
+		query string
+		args  []any
+	}{
+		{`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`, []any{initial.version, initial.name, now}},
+		{`INSERT INTO users (username, role, created_at) VALUES ('alex', 'user', ?)`, []any{now}},
+		{`INSERT INTO credentials (username, password_hash) VALUES ('alex', 'hash')`, nil},
+		{`INSERT INTO sessions (token, username, expires_at) VALUES (?, 'alex', ?)`, []any{HashToken("old-token"), now.Add(time.Hour)}},
+	} {
+		if _, err := database.db.Exec(statement.query, statement.args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := database.SetupDatabase(); err != nil {
+		t.Fatal(err)
+	}
+	if versions := appliedMigrations(t, database); len(versions) != len(sqliteMigrations(t)) {
+		t.Errorf("applied %v", versions)
+	}
+
+	// The data is still there, in the new schema.
+	session, err := database.GetSession(context.Background(), HashToken("old-token"))
+	if err != nil || session.Username != "alex" {
+		t.Errorf("GetSession = %+v, %v", session, err)
+	}
+	var indexes int
+	database.db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND name = 'sessions_expires_at'`).Scan(&indexes)
+	if indexes != 1 {
+		t.Error("the additive migration didn't create sessions_expires_at")
+	}
+	if err = database.CreateAPIKey(context.Background(), APIKey{ID: "k", Name: "k", Role: RoleUser, Hash: "h", CreatedAt: now}); err != nil {
+		t.Errorf("CreateAPIKey on the upgraded schema: %v", err)
+	}
+}
+
+func TestMigrationsRefuseNewerSchema(t *testing.T) {
+	var database *sqlDB = openSQLiteFile(t)
+	if err := database.SetupDatabase(); err != nil {
+		t.Fatal(err)
+	}
+	var before []int64 = appliedMigrations(t, database)
+
+	_, err := database.db.Exec(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (999, '0999_future', ?)`, time.Now().UTC())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = database.SetupDatabase(); !errors.Is(err, ErrSchemaAhead) {
+		t.Fatalf("SetupDatabase = %v, want ErrSchemaAhead", err)
+	}
+	if after := appliedMigrations(t, database); len(after) != len(before)+1 {
+		t.Errorf("applied %v, want %v and 999", after, before)
+	}
+}
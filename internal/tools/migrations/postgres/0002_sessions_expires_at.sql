@@ -0,0 +1,2 @@
+-- CreateSession deletes the expired sessions every time.
+CREATE INDEX IF NOT EXISTS sessions_expires_at ON sessions (expires_at);
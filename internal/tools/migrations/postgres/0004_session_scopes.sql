@@ -0,0 +1,2 @@
+-- Space separated, NULL for sessions created before tokens had scopes.
+ALTER TABLE sessions ADD COLUMN scopes TEXT;
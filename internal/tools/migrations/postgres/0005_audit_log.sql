@@ -0,0 +1,18 @@
+-- Append only. seq is given by the writer, the one after the newest entry,
+-- so two writers can't both chain an entry to the same one.
+CREATE TABLE IF NOT EXISTS audit_log (
+    seq        BIGINT PRIMARY KEY,
+    actor      TEXT NOT NULL,
+    action     TEXT NOT NULL,
+    target     TEXT NOT NULL,
+    currency   TEXT NOT NULL,
+    amount     BIGINT NOT NULL,
+    request_id TEXT NOT NULL,
+    outcome    TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    prev_hash  TEXT NOT NULL,
+    hash       TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_actor ON audit_log (actor, seq DESC);
+CREATE INDEX IF NOT EXISTS audit_log_target ON audit_log (target, seq DESC);
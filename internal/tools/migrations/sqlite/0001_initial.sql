@@ -0,0 +1,72 @@
+-- IF NOT EXISTS, as databases set up before there were migrations already
+-- have these tables.
+
+CREATE TABLE IF NOT EXISTS users (
+    username        TEXT PRIMARY KEY,
+    role            TEXT NOT NULL,
+    display_name    TEXT NOT NULL DEFAULT '',
+    email           TEXT NOT NULL DEFAULT '',
+    created_at      TIMESTAMP NOT NULL,
+    deleted_at      TIMESTAMP,
+    frozen          BOOLEAN NOT NULL DEFAULT FALSE,
+    overdraft_limit INTEGER NOT NULL DEFAULT 0,
+    version         INTEGER NOT NULL DEFAULT 1
+);
+
+CREATE TABLE IF NOT EXISTS credentials (
+    username      TEXT PRIMARY KEY REFERENCES users (username),
+    password_hash TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS sessions (
+    token      TEXT PRIMARY KEY,
+    username   TEXT NOT NULL REFERENCES users (username),
+    expires_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS sessions_username ON sessions (username);
+
+CREATE TABLE IF NOT EXISTS balances (
+    username TEXT NOT NULL REFERENCES users (username),
+    currency TEXT NOT NULL,
+    amount   INTEGER NOT NULL,
+    PRIMARY KEY (username, currency)
+);
+
+CREATE TABLE IF NOT EXISTS transactions (
+    seq          INTEGER PRIMARY KEY AUTOINCREMENT,
+    id           TEXT NOT NULL,
+    username     TEXT NOT NULL REFERENCES users (username),
+    type         TEXT NOT NULL,
+    currency     TEXT NOT NULL,
+    amount       INTEGER NOT NULL,
+    counterparty TEXT NOT NULL,
+    balance      INTEGER NOT NULL,
+    actor        TEXT NOT NULL,
+    reason       TEXT NOT NULL,
+    created_at   TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS transactions_username_seq ON transactions (username, seq DESC);
+
+CREATE TABLE IF NOT EXISTS ledger_entries (
+    id             INTEGER PRIMARY KEY AUTOINCREMENT,
+    transaction_id TEXT NOT NULL,
+    account        TEXT NOT NULL,
+    direction      TEXT NOT NULL,
+    currency       TEXT NOT NULL,
+    amount         INTEGER NOT NULL CHECK (amount > 0),
+    created_at     TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS ledger_entries_transaction ON ledger_entries (transaction_id);
+
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    idempotency_key TEXT PRIMARY KEY,
+    request_hash    TEXT NOT NULL,
+    done            BOOLEAN NOT NULL DEFAULT FALSE,
+    status_code     INTEGER NOT NULL DEFAULT 0,
+    content_type    TEXT NOT NULL DEFAULT '',
+    body            BLOB,
+    expires_at      TIMESTAMP NOT NULL
+);
@@ -0,0 +1,2 @@
+-- GetBalanceAsOf sums the entries of an account up to a time.
+CREATE INDEX IF NOT EXISTS ledger_entries_account_time ON ledger_entries (account, created_at);
@@ -0,0 +1,1362 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/config"
+	"github.com/RashedMaaitah/goapi/internal/ledger"
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// ErrNoTransactions is returned by the writes of mongoDB that must change
+// several documents at once, such as transfers, when the server is a
+// standalone one: multi-document transactions need a replica set or a
+// sharded cluster.
+var ErrNoTransactions = errors.New("mongo: this write needs multi-document transactions, which need a replica set")
+
+// mongoDB implements Database on MongoDB. Balances are changed by $inc
+// with a filter that only matches if the result stays above the floor of
+// the account, so concurrent withdrawals can't both pass the check.
+//
+// With transactions, which SetupDatabase finds out about, each write and
+// the transaction and ledger records it makes are one transaction.
+// Without, the records are written after the balance, and a failure in
+// between shows up as drift in VerifyLedger.
+type mongoDB struct {
+	client *mongo.Client
+	db     *mongo.Database
+	logger *log.Logger
+
+	transactions bool
+}
+
+// mongoUser is a document of the users collection. Balances holds every
+// currency, DefaultCurrency included.
+type mongoUser struct {
+	Username       string           `bson:"username"`
+	PasswordHash   string           `bson:"password_hash"`
+	Role           string           `bson:"role"`
+	DisplayName    string           `bson:"display_name"`
+	Email          string           `bson:"email"`
+	CreatedAt      time.Time        `bson:"created_at"`
+	DeletedAt      *time.Time       `bson:"deleted_at,omitempty"`
+	Frozen         bool             `bson:"frozen"`
+	OverdraftLimit int64            `bson:"overdraft_limit"`
+	Version        int64            `bson:"version"`
+	Balances       map[string]int64 `bson:"balances"`
+}
+
+func (u mongoUser) loginDetails() *LoginDetails {
+	var loginDetails = LoginDetails{
+		Username:     u.Username,
+		PasswordHash: u.PasswordHash,
+		Role:         u.Role,
+		CreatedAt:    u.CreatedAt.UTC(),
+		DisplayName:  u.DisplayName,
+		Email:        u.Email,
+	}
+	if u.DeletedAt != nil {
+		loginDetails.DeletedAt = u.DeletedAt.UTC()
+	}
+	return &loginDetails
+}
+
+func (u mongoUser) coinDetails() *CoinDetails {
+	var coinData = CoinDetails{
+		Username:       u.Username,
+		Frozen:         u.Frozen,
+		Version:        u.Version,
+		OverdraftLimit: u.OverdraftLimit,
+	}
+	for currency, amount := range u.Balances {
+		coinData = withBalance(coinData, currency, amount)
+	}
+	return &coinData
+}
+
+type mongoSession struct {
+	Token     string     `bson:"token"`
+	Username  string     `bson:"username"`
+	ExpiresAt *time.Time `bson:"expires_at,omitempty"`
+	Scopes    []string   `bson:"scopes,omitempty"`
+}
+
+type mongoAPIKey struct {
+	ID         string     `bson:"id"`
+	Name       string     `bson:"name"`
+	Role       string     `bson:"role"`
+	Hash       string     `bson:"key_hash"`
+	CreatedAt  time.Time  `bson:"created_at"`
+	ExpiresAt  *time.Time `bson:"expires_at,omitempty"`
+	LastUsedAt *time.Time `bson:"last_used_at,omitempty"`
+}
+
+func (k mongoAPIKey) apiKey() APIKey {
+	var key = APIKey{ID: k.ID, Name: k.Name, Role: k.Role, Hash: k.Hash, CreatedAt: k.CreatedAt.UTC()}
+	if k.ExpiresAt != nil {
+		key.ExpiresAt = k.ExpiresAt.UTC()
+	}
+	if k.LastUsedAt != nil {
+		key.LastUsedAt = k.LastUsedAt.UTC()
+	}
+	return key
+}
+
+type mongoTransaction struct {
+	Seq          int64     `bson:"seq"`
+	ID           string    `bson:"id"`
+	Username     string    `bson:"username"`
+	Type         string    `bson:"type"`
+	Currency     string    `bson:"currency"`
+	Amount       int64     `bson:"amount"`
+	Counterparty string    `bson:"counterparty"`
+	Balance      int64     `bson:"balance"`
+	CreatedAt    time.Time `bson:"created_at"`
+	Actor        string    `bson:"actor"`
+	Reason       string    `bson:"reason"`
+}
+
+type mongoEntry struct {
+	TransactionID string    `bson:"transaction_id"`
+	Account       string    `bson:"account"`
+	Direction     string    `bson:"direction"`
+	Currency      string    `bson:"currency"`
+	Amount        int64     `bson:"amount"`
+	CreatedAt     time.Time `bson:"created_at"`
+}
+
+type mongoAuditEntry struct {
+	Seq       int64     `bson:"seq"`
+	Actor     string    `bson:"actor"`
+	Action    string    `bson:"action"`
+	Target    string    `bson:"target"`
+	Currency  string    `bson:"currency"`
+	Amount    int64     `bson:"amount"`
+	RequestID string    `bson:"request_id"`
+	Outcome   string    `bson:"outcome"`
+	CreatedAt time.Time `bson:"created_at"`
+	PrevHash  string    `bson:"prev_hash"`
+	Hash      string    `bson:"hash"`
+}
+
+type mongoIdempotency struct {
+	Key         string    `bson:"_id"`
+	RequestHash string    `bson:"request_hash"`
+	Done        bool      `bson:"done"`
+	StatusCode  int       `bson:"status_code"`
+	ContentType string    `bson:"content_type"`
+	Body        []byte    `bson:"body"`
+	ExpiresAt   time.Time `bson:"expires_at"`
+}
+
+func openMongo(cfg config.DatabaseConfig, logger *log.Logger) (*mongoDB, error) {
+	var opts = options.Client().ApplyURI(cfg.DSN)
+	if timeout := cfg.Timeout.Duration(); timeout > 0 {
+		opts.SetConnectTimeout(timeout).SetTimeout(timeout)
+	}
+	if cfg.MaxOpenConns > 0 {
+		opts.SetMaxPoolSize(uint64(cfg.MaxOpenConns))
+	}
+	if cfg.ConnMaxLifetime > 0 {
+		opts.SetMaxConnIdleTime(cfg.ConnMaxLifetime.Duration())
+	}
+
+	client, err := mongo.Connect(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &mongoDB{client: client, db: client.Database(cfg.Name), logger: logger}, nil
+}
+
+func (d *mongoDB) users() *mongo.Collection { return d.db.Collection("users") }
+
+// bsonNow is the current time at the millisecond precision of BSON dates,
+// so what is returned is what will be read back.
+func bsonNow() time.Time {
+	return time.Now().UTC().Truncate(time.Millisecond)
+}
+
+// write runs fn in a transaction if the server has them. fn may be run
+// again if the transaction conflicts with another.
+func (d *mongoDB) write(ctx context.Context, fn func(ctx context.Context) error) error {
+	if !d.transactions {
+		return fn(ctx)
+	}
+
+	session, err := d.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(context.Background())
+
+	_, err = session.WithTransaction(ctx, func(ctx context.Context) (any, error) {
+		return nil, fn(ctx)
+	})
+	return err
+}
+
+// active matches the user username if it is not soft-deleted.
+func active(username string) bson.M {
+	return bson.M{"username": username, "deleted_at": nil}
+}
+
+// user reads the document of username, soft-deleted or not.
+func (d *mongoDB) user(ctx context.Context, username string) (*mongoUser, error) {
+	var user mongoUser
+	err := d.users().FindOne(ctx, bson.M{"username": username}).Decode(&user)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// why returns the error of a conditional update of username that matched
+// nothing, by reading the user again.
+func (d *mongoDB) why(ctx context.Context, username string, version int64, currency string, delta int64) error {
+	user, err := d.user(ctx, username)
+	switch {
+	case err != nil:
+		return err
+	case user.DeletedAt != nil:
+		return ErrUserNotFound
+	case version != 0 && user.Version != version:
+		return ErrVersionConflict
+	case user.Frozen:
+		return ErrAccountFrozen
+	}
+	balance, err := addBalance(user.Balances[currency], delta)
+	switch {
+	case err != nil:
+		return err
+	case balance < -user.OverdraftLimit:
+		return ErrInsufficientFunds
+	}
+	// Changed since the update, by a write that came first.
+	return ErrVersionConflict
+}
+
+// staysAbove is a filter matching if adding delta to the balance in
+// currency leaves it at or above floor.
+func staysAbove(currency string, delta int64, floor any) bson.M {
+	var balance = bson.M{"$ifNull": bson.A{"$balances." + currency, 0}}
+	return bson.M{"$expr": bson.M{"$gte": bson.A{bson.M{"$add": bson.A{balance, delta}}, floor}}}
+}
+
+// fits is a filter matching if adding delta to the balance in currency
+// doesn't overflow it.
+func fits(currency string, delta int64) bson.M {
+	if delta > 0 {
+		return bson.M{"balances." + currency: bson.M{"$not": bson.M{"$gt": math.MaxInt64 - delta}}}
+	}
+	return bson.M{"balances." + currency: bson.M{"$not": bson.M{"$lt": math.MinInt64 - delta}}}
+}
+
+// overdraftFloor is the Floor of an account in a $expr.
+var overdraftFloor = bson.M{"$multiply": bson.A{"$overdraft_limit", -1}}
+
+// record stores t with the next sequence number and the current time, and
+// posts entries to the ledger.
+func (d *mongoDB) record(ctx context.Context, t Transaction, entries ...ledger.Entry) (Transaction, error) {
+	if err := d.post(ctx, entries...); err != nil {
+		return t, err
+	}
+
+	var counter struct {
+		Seq int64 `bson:"seq"`
+	}
+	err := d.db.Collection("counters").FindOneAndUpdate(ctx,
+		bson.M{"_id": "transactions"},
+		bson.M{"$inc": bson.M{"seq": int64(1)}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&counter)
+	if err != nil {
+		return t, err
+	}
+
+	t.Seq = counter.Seq
+	t.CreatedAt = bsonNow()
+	_, err = d.db.Collection("transactions").InsertOne(ctx, mongoTransaction(t))
+	return t, err
+}
+
+func (d *mongoDB) post(ctx context.Context, entries ...ledger.Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	if err := ledger.Check(entries...); err != nil {
+		return err
+	}
+
+	var createdAt = bsonNow()
+	var documents = make([]any, 0, len(entries))
+	for _, entry := range entries {
+		entry.CreatedAt = createdAt
+		documents = append(documents, mongoEntry(entry))
+	}
+	_, err := d.db.Collection("ledger_entries").InsertMany(ctx, documents)
+	return err
+}
+
+func (d *mongoDB) GetUserLoginDetails(ctx context.Context, username string) (*LoginDetails, error) {
+	username = api.NormalizeUsername(username)
+	user, err := d.user(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	if user.DeletedAt != nil {
+		return nil, ErrUserNotFound
+	}
+	return user.loginDetails(), nil
+}
+
+func (d *mongoDB) GetUserCoins(ctx context.Context, username string) (*CoinDetails, error) {
+	username = api.NormalizeUsername(username)
+	user, err := d.user(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	if user.DeletedAt != nil {
+		return nil, ErrUserNotFound
+	}
+	return user.coinDetails(), nil
+}
+
+func (d *mongoDB) AdjustUserCoins(ctx context.Context, username string, currency string, delta int64, version int64) (*CoinDetails, error) {
+	username = api.NormalizeUsername(username)
+	var filter bson.M = active(username)
+	filter["frozen"] = false
+	for key, value := range staysAbove(currency, delta, overdraftFloor) {
+		filter[key] = value
+	}
+	for key, value := range fits(currency, delta) {
+		filter[key] = value
+	}
+	if version != 0 {
+		filter["version"] = version
+	}
+
+	var coinData *CoinDetails
+	err := d.write(ctx, func(ctx context.Context) error {
+		var user mongoUser
+		err := d.users().FindOneAndUpdate(ctx, filter,
+			bson.M{"$inc": bson.M{"balances." + currency: delta, "version": int64(1)}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&user)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return d.why(ctx, username, version, currency, delta)
+		}
+		if err != nil {
+			return err
+		}
+		coinData = user.coinDetails()
+
+		var id string = newID()
+		var kind, amount = TransactionDeposit, delta
+		if delta < 0 {
+			kind, amount = TransactionWithdrawal, -delta
+		}
+		_, err = d.record(ctx, Transaction{
+			ID:       id,
+			Username: username,
+			Type:     kind,
+			Currency: currency,
+			Amount:   amount,
+			Balance:  coinData.Balance(currency),
+		}, ledger.Move(id, ledger.SystemAccount, username, currency, delta)...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return coinData, nil
+}
+
+func (d *mongoDB) AdminAdjustCoins(ctx context.Context, username string, adjustment AdminAdjustment) (*CoinDetails, error) {
+	username = api.NormalizeUsername(username)
+	if adjustment.Set && adjustment.Balance < 0 && !adjustment.Force {
+		return nil, ErrInsufficientFunds
+	}
+
+	var filter bson.M = active(username)
+	var update = bson.M{"$inc": bson.M{"version": int64(1)}}
+	if adjustment.Set {
+		update["$set"] = bson.M{"balances." + DefaultCurrency: adjustment.Balance}
+	} else {
+		update["$inc"] = bson.M{"version": int64(1), "balances." + DefaultCurrency: adjustment.Delta}
+		for key, value := range fits(DefaultCurrency, adjustment.Delta) {
+			filter[key] = value
+		}
+		if !adjustment.Force {
+			for key, value := range staysAbove(DefaultCurrency, adjustment.Delta, 0) {
+				filter[key] = value
+			}
+		}
+	}
+	if adjustment.Version != 0 {
+		filter["version"] = adjustment.Version
+	}
+
+	var coinData *CoinDetails
+	err := d.write(ctx, func(ctx context.Context) error {
+		// The balance before is what a set is the delta from.
+		var before mongoUser
+		err := d.users().FindOneAndUpdate(ctx, filter, update).Decode(&before)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			user, err := d.user(ctx, username)
+			switch {
+			case err != nil:
+				return err
+			case user.DeletedAt != nil:
+				return ErrUserNotFound
+			case adjustment.Version != 0 && user.Version != adjustment.Version:
+				return ErrVersionConflict
+			}
+			if _, err := addBalance(user.Balances[DefaultCurrency], adjustment.Delta); err != nil {
+				return err
+			}
+			// Frozen accounts may be adjusted, so the floor failed.
+			return ErrInsufficientFunds
+		}
+		if err != nil {
+			return err
+		}
+
+		var delta int64 = adjustment.Delta
+		if adjustment.Set {
+			delta = adjustment.Balance - before.Balances[DefaultCurrency]
+		}
+		coinData = before.coinDetails()
+		coinData.Coins += delta
+		coinData.Version++
+
+		var id string = newID()
+		_, err = d.record(ctx, Transaction{
+			ID:       id,
+			Username: username,
+			Type:     TransactionAdmin,
+			Currency: DefaultCurrency,
+			Amount:   delta,
+			Balance:  coinData.Coins,
+			Actor:    adjustment.Actor,
+			Reason:   adjustment.Reason,
+		}, ledger.Move(id, ledger.SystemAccount, username, DefaultCurrency, delta)...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return coinData, nil
+}
+
+// setAccount sets fields of the active user username and bumps its version.
+func (d *mongoDB) setAccount(ctx context.Context, username string, fields bson.M) (*mongoUser, error) {
+	var user mongoUser
+	err := d.users().FindOneAndUpdate(ctx, active(username),
+		bson.M{"$set": fields, "$inc": bson.M{"version": int64(1)}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&user)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (d *mongoDB) SetOverdraft(ctx context.Context, username string, limit int64) (*CoinDetails, error) {
+	username = api.NormalizeUsername(username)
+	user, err := d.setAccount(ctx, username, bson.M{"overdraft_limit": limit})
+	if err != nil {
+		return nil, err
+	}
+	return user.coinDetails(), nil
+}
+
+func (d *mongoDB) SetFrozen(ctx context.Context, username string, frozen bool, actor string, reason string) (*CoinDetails, error) {
+	username = api.NormalizeUsername(username)
+	var coinData *CoinDetails
+	err := d.write(ctx, func(ctx context.Context) error {
+		user, err := d.setAccount(ctx, username, bson.M{"frozen": frozen})
+		if err != nil {
+			return err
+		}
+		coinData = user.coinDetails()
+
+		var kind string = TransactionFreeze
+		if !frozen {
+			kind = TransactionUnfreeze
+		}
+		_, err = d.record(ctx, Transaction{
+			ID:       newID(),
+			Username: username,
+			Type:     kind,
+			Currency: DefaultCurrency,
+			Balance:  coinData.Coins,
+			Actor:    actor,
+			Reason:   reason,
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return coinData, nil
+}
+
+func (d *mongoDB) Transfer(ctx context.Context, from string, to string, currency string, amount int64) (*TransferDetails, error) {
+	from, to = api.NormalizeUsername(from), api.NormalizeUsername(to)
+	if from == to {
+		return nil, ErrSelfTransfer
+	}
+	if !d.transactions {
+		return nil, ErrNoTransactions
+	}
+
+	var transfer *TransferDetails
+	err := d.write(ctx, func(ctx context.Context) error {
+		// Read in the transaction, so a write to either user before it
+		// commits makes it conflict and run again.
+		sender, err := d.user(ctx, from)
+		if errors.Is(err, ErrUserNotFound) {
+			return ErrSenderNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if sender.DeletedAt != nil {
+			return ErrSenderNotFound
+		}
+		recipient, err := d.user(ctx, to)
+		if err != nil {
+			return err
+		}
+		if recipient.DeletedAt != nil {
+			return ErrUserDeleted
+		}
+		if sender.Frozen || recipient.Frozen {
+			return ErrAccountFrozen
+		}
+		if sender.Balances[currency]-amount < -sender.OverdraftLimit {
+			return ErrInsufficientFunds
+		}
+		if _, err := addBalance(recipient.Balances[currency], amount); err != nil {
+			return err
+		}
+
+		var balances = map[string]int64{}
+		for username, delta := range map[string]int64{from: -amount, to: amount} {
+			var user mongoUser
+			err = d.users().FindOneAndUpdate(ctx, active(username),
+				bson.M{"$inc": bson.M{"balances." + currency: delta, "version": int64(1)}},
+				options.FindOneAndUpdate().SetReturnDocument(options.After),
+			).Decode(&user)
+			if err != nil {
+				return err
+			}
+			balances[username] = user.Balances[currency]
+		}
+
+		var id string = newID()
+		out, err := d.record(ctx, Transaction{
+			ID:           id,
+			Username:     from,
+			Type:         TransactionTransferOut,
+			Currency:     currency,
+			Amount:       amount,
+			Counterparty: to,
+			Balance:      balances[from],
+		}, ledger.Move(id, from, to, currency, amount)...)
+		if err != nil {
+			return err
+		}
+		_, err = d.record(ctx, Transaction{
+			ID:           id,
+			Username:     to,
+			Type:         TransactionTransferIn,
+			Currency:     currency,
+			Amount:       amount,
+			Counterparty: from,
+			Balance:      balances[to],
+		})
+		if err != nil {
+			return err
+		}
+
+		transfer = &TransferDetails{
+			ID:        id,
+			From:      from,
+			To:        to,
+			Currency:  currency,
+			Amount:    amount,
+			FromCoins: balances[from],
+			ToCoins:   balances[to],
+			CreatedAt: out.CreatedAt,
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return transfer, nil
+}
+
+func (d *mongoDB) ListTransactions(ctx context.Context, username string, limit int, before int64) ([]Transaction, error) {
+	username = api.NormalizeUsername(username)
+	var filter = bson.M{"username": username}
+	if before > 0 {
+		filter["seq"] = bson.M{"$lt": before}
+	}
+	cursor, err := d.db.Collection("transactions").Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "seq", Value: -1}}).SetLimit(int64(limit)))
+	if err != nil {
+		return nil, err
+	}
+
+	var documents []mongoTransaction
+	if err = cursor.All(ctx, &documents); err != nil {
+		return nil, err
+	}
+	var transactions = make([]Transaction, 0, len(documents))
+	for _, document := range documents {
+		document.CreatedAt = document.CreatedAt.UTC()
+		transactions = append(transactions, Transaction(document))
+	}
+	return transactions, nil
+}
+
+func newMongoUser(user NewUser, createdAt time.Time) mongoUser {
+	return mongoUser{
+		Username:     user.Username,
+		PasswordHash: user.PasswordHash,
+		Role:         user.role(),
+		CreatedAt:    createdAt,
+		Version:      1,
+		Balances:     map[string]int64{DefaultCurrency: user.Coins},
+	}
+}
+
+func (d *mongoDB) CreateUser(ctx context.Context, username string, passwordHash string) (*LoginDetails, error) {
+	username = api.NormalizeUsername(username)
+	var user mongoUser = newMongoUser(NewUser{Username: username, PasswordHash: passwordHash}, bsonNow())
+	_, err := d.users().InsertOne(ctx, user)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, ErrUserExists
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user.loginDetails(), nil
+}
+
+func (d *mongoDB) ImportUsers(ctx context.Context, users []NewUser, atomic bool) ([]error, error) {
+	users = normalizeUsers(users)
+	var errs = make([]error, len(users))
+	if atomic && !d.transactions {
+		// Checked up front instead, which a user created concurrently can
+		// slip past.
+		var failed bool
+		for i, user := range users {
+			count, err := d.users().CountDocuments(ctx, bson.M{"username": user.Username})
+			if err != nil {
+				return nil, err
+			}
+			if count > 0 {
+				errs[i], failed = ErrUserExists, true
+			}
+		}
+		if failed {
+			return errs, nil
+		}
+	}
+
+	err := d.write(ctx, func(ctx context.Context) error {
+		var createdAt = bsonNow()
+		var failed bool
+		for i, user := range users {
+			errs[i] = d.importUser(ctx, user, createdAt)
+			if errors.Is(errs[i], ErrUserExists) {
+				failed = true
+				continue
+			}
+			if errs[i] != nil {
+				return errs[i]
+			}
+		}
+		if atomic && failed {
+			return errImportFailed
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errImportFailed) {
+		return nil, err
+	}
+	return errs, nil
+}
+
+func (d *mongoDB) importUser(ctx context.Context, user NewUser, createdAt time.Time) error {
+	// Looked up first, as a duplicate key aborts the transaction.
+	count, err := d.users().CountDocuments(ctx, bson.M{"username": user.Username})
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrUserExists
+	}
+
+	_, err = d.users().InsertOne(ctx, newMongoUser(user, createdAt))
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrUserExists
+	}
+	if err != nil {
+		return err
+	}
+	return d.post(ctx, ledger.Move(newID(), ledger.SystemAccount, user.Username, DefaultCurrency, user.Coins)...)
+}
+
+func (d *mongoDB) UpdateUser(ctx context.Context, username string, update UserUpdate) (*LoginDetails, error) {
+	username = api.NormalizeUsername(username)
+	var fields = bson.M{}
+	if update.DisplayName != nil {
+		fields["display_name"] = *update.DisplayName
+	}
+	if update.Email != nil {
+		fields["email"] = *update.Email
+	}
+
+	var user mongoUser
+	var err error
+	if len(fields) == 0 {
+		err = d.users().FindOne(ctx, active(username)).Decode(&user)
+	} else {
+		err = d.users().FindOneAndUpdate(ctx, active(username), bson.M{"$set": fields},
+			options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&user)
+	}
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user.loginDetails(), nil
+}
+
+func (d *mongoDB) UpdatePassword(ctx context.Context, username string, passwordHash string) error {
+	username = api.NormalizeUsername(username)
+	result, err := d.users().UpdateOne(ctx, active(username), bson.M{"$set": bson.M{"password_hash": passwordHash}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func (d *mongoDB) CreateSession(ctx context.Context, session Session, replace bool) error {
+	session.Username = api.NormalizeUsername(session.Username)
+	count, err := d.users().CountDocuments(ctx, active(session.Username))
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrUserNotFound
+	}
+
+	var sessions *mongo.Collection = d.db.Collection("sessions")
+	var expired = bson.M{"expires_at": bson.M{"$lte": bsonNow()}}
+	if replace {
+		expired = bson.M{"$or": bson.A{expired, bson.M{"username": session.Username}}}
+	}
+	if _, err = sessions.DeleteMany(ctx, expired); err != nil {
+		return err
+	}
+
+	var document = mongoSession{Token: session.Token, Username: session.Username, Scopes: session.Scopes}
+	if !session.ExpiresAt.IsZero() {
+		document.ExpiresAt = &session.ExpiresAt
+	}
+	_, err = sessions.InsertOne(ctx, document)
+	return err
+}
+
+func (d *mongoDB) GetSession(ctx context.Context, token string) (*Session, error) {
+	var document mongoSession
+	err := d.db.Collection("sessions").FindOne(ctx, bson.M{"token": token}).Decode(&document)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var session = Session{Token: document.Token, Username: document.Username, Scopes: document.Scopes}
+	if document.ExpiresAt != nil {
+		session.ExpiresAt = document.ExpiresAt.UTC()
+	}
+	return &session, nil
+}
+
+func (d *mongoDB) DeleteSession(ctx context.Context, token string) error {
+	result, err := d.db.Collection("sessions").DeleteOne(ctx, bson.M{"token": token})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+func (d *mongoDB) DeleteUserSessions(ctx context.Context, username string) error {
+	username = api.NormalizeUsername(username)
+	_, err := d.db.Collection("sessions").DeleteMany(ctx, bson.M{"username": username})
+	return err
+}
+
+func (d *mongoDB) CreateAPIKey(ctx context.Context, key APIKey) error {
+	var document = mongoAPIKey{ID: key.ID, Name: key.Name, Role: key.Role, Hash: key.Hash, CreatedAt: key.CreatedAt.UTC()}
+	if !key.ExpiresAt.IsZero() {
+		document.ExpiresAt = &key.ExpiresAt
+	}
+	_, err := d.db.Collection("api_keys").InsertOne(ctx, document)
+	return err
+}
+
+func (d *mongoDB) ListAPIKeys(ctx context.Context) ([]APIKey, error) {
+	cursor, err := d.db.Collection("api_keys").Find(ctx, bson.M{},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	var documents []mongoAPIKey
+	if err = cursor.All(ctx, &documents); err != nil {
+		return nil, err
+	}
+
+	var keys = make([]APIKey, 0, len(documents))
+	for _, document := range documents {
+		keys = append(keys, document.apiKey())
+	}
+	return keys, nil
+}
+
+func (d *mongoDB) GetAPIKey(ctx context.Context, hash string) (*APIKey, error) {
+	var document mongoAPIKey
+	err := d.db.Collection("api_keys").FindOne(ctx, bson.M{"key_hash": hash}).Decode(&document)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var key APIKey = document.apiKey()
+	return &key, nil
+}
+
+func (d *mongoDB) TouchAPIKey(ctx context.Context, id string, at time.Time) error {
+	result, err := d.db.Collection("api_keys").UpdateOne(ctx, bson.M{"id": id}, bson.M{"$set": bson.M{"last_used_at": at.UTC()}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+func (d *mongoDB) DeleteAPIKey(ctx context.Context, id string) error {
+	result, err := d.db.Collection("api_keys").DeleteOne(ctx, bson.M{"id": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// findUsers decodes the users filter matches.
+func (d *mongoDB) findUsers(ctx context.Context, filter bson.M, opts *options.FindOptionsBuilder) ([]mongoUser, error) {
+	cursor, err := d.users().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var users []mongoUser
+	err = cursor.All(ctx, &users)
+	return users, err
+}
+
+const coinsField = "balances." + DefaultCurrency
+
+func (d *mongoDB) GetTopUsers(ctx context.Context, offset, limit int) ([]CoinDetails, error) {
+	users, err := d.findUsers(ctx, bson.M{"deleted_at": nil},
+		options.Find().SetSort(bson.D{{Key: coinsField, Value: -1}, {Key: "username", Value: 1}}).SetSkip(int64(offset)).SetLimit(int64(limit)))
+	if err != nil {
+		return nil, err
+	}
+
+	var top = make([]CoinDetails, 0, len(users))
+	for _, user := range users {
+		top = append(top, *user.coinDetails())
+	}
+	return top, nil
+}
+
+func (d *mongoDB) SearchUsers(ctx context.Context, filter UserFilter) ([]UserSummary, error) {
+	var query = bson.M{"deleted_at": nil}
+	if filter.Prefix != "" {
+		query["username"] = bson.M{"$regex": "^" + regexp.QuoteMeta(filter.Prefix)}
+	}
+	var coins = bson.M{}
+	if filter.MinCoins != nil {
+		coins["$gte"] = *filter.MinCoins
+	}
+	if filter.MaxCoins != nil {
+		coins["$lte"] = *filter.MaxCoins
+	}
+	if len(coins) > 0 {
+		query[coinsField] = coins
+	}
+	if filter.Role != "" {
+		query["role"] = filter.Role
+	}
+
+	var direction int = 1
+	if filter.Desc {
+		direction = -1
+	}
+	var sort bson.D
+	switch filter.SortBy {
+	case SortByCoins:
+		sort = bson.D{{Key: coinsField, Value: direction}, {Key: "username", Value: 1}}
+	case SortByCreatedAt:
+		sort = bson.D{{Key: "created_at", Value: direction}, {Key: "username", Value: 1}}
+	default:
+		sort = bson.D{{Key: "username", Value: direction}}
+	}
+
+	var opts = options.Find().SetSort(sort).SetSkip(int64(filter.Offset))
+	if filter.Limit > 0 {
+		opts.SetLimit(int64(filter.Limit))
+	}
+	users, err := d.findUsers(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var summaries = make([]UserSummary, 0, len(users))
+	for _, user := range users {
+		summaries = append(summaries, UserSummary{
+			Username:  user.Username,
+			Role:      user.Role,
+			Coins:     user.Balances[DefaultCurrency],
+			CreatedAt: user.CreatedAt.UTC(),
+		})
+	}
+	return summaries, nil
+}
+
+func (d *mongoDB) GetStats(ctx context.Context, bounds []int64) (*Stats, error) {
+	var coins = bson.M{"$ifNull": bson.A{"$" + coinsField, 0}}
+
+	// One sum per bucket, each counting the balances between the bounds
+	// around it.
+	var group = bson.D{
+		{Key: "_id", Value: nil},
+		{Key: "users", Value: bson.M{"$sum": 1}},
+		{Key: "total", Value: bson.M{"$sum": coins}},
+	}
+	var buckets = bson.A{}
+	for i := 0; i <= len(bounds); i++ {
+		var conditions = bson.A{}
+		if i > 0 {
+			conditions = append(conditions, bson.M{"$gte": bson.A{coins, bounds[i-1]}})
+		}
+		if i < len(bounds) {
+			conditions = append(conditions, bson.M{"$lt": bson.A{coins, bounds[i]}})
+		}
+		var name string = fmt.Sprintf("bucket%d", i)
+		group = append(group, bson.E{Key: name, Value: bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$and": conditions}, 1, 0}}}})
+		buckets = append(buckets, "$"+name)
+	}
+
+	cursor, err := d.users().Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"deleted_at": nil}}},
+		{{Key: "$group", Value: group}},
+		{{Key: "$project", Value: bson.M{"users": 1, "total": 1, "buckets": buckets}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var results []struct {
+		Users   int64   `bson:"users"`
+		Total   int64   `bson:"total"`
+		Buckets []int64 `bson:"buckets"`
+	}
+	if err = cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+
+	var stats = Stats{Buckets: make([]int64, len(bounds)+1)}
+	if len(results) > 0 {
+		stats.Users, stats.TotalCoins = results[0].Users, results[0].Total
+		copy(stats.Buckets, results[0].Buckets)
+	}
+	return &stats, nil
+}
+
+func (d *mongoDB) GetUserIncludingDeleted(ctx context.Context, username string) (*LoginDetails, error) {
+	username = api.NormalizeUsername(username)
+	user, err := d.user(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	return user.loginDetails(), nil
+}
+
+func (d *mongoDB) DeleteUser(ctx context.Context, username string) error {
+	username = api.NormalizeUsername(username)
+	result, err := d.users().UpdateOne(ctx, active(username), bson.M{"$set": bson.M{"deleted_at": bsonNow()}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func (d *mongoDB) RestoreUser(ctx context.Context, username string) error {
+	username = api.NormalizeUsername(username)
+	result, err := d.users().UpdateOne(ctx, bson.M{"username": username}, bson.M{"$unset": bson.M{"deleted_at": ""}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func (d *mongoDB) LedgerEntries(ctx context.Context, transactionID string) ([]ledger.Entry, error) {
+	cursor, err := d.db.Collection("ledger_entries").Find(ctx, bson.M{"transaction_id": transactionID},
+		options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	var documents []mongoEntry
+	if err = cursor.All(ctx, &documents); err != nil {
+		return nil, err
+	}
+	var entries = make([]ledger.Entry, 0, len(documents))
+	for _, document := range documents {
+		document.CreatedAt = document.CreatedAt.UTC()
+		entries = append(entries, ledger.Entry(document))
+	}
+	return entries, nil
+}
+
+func (d *mongoDB) GetBalanceAsOf(ctx context.Context, username string, t time.Time) (map[string]int64, error) {
+	username = api.NormalizeUsername(username)
+	loginDetails, err := d.GetUserLoginDetails(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	if t.Before(loginDetails.CreatedAt) {
+		return nil, ErrNoBalanceYet
+	}
+
+	cursor, err := d.db.Collection("ledger_entries").Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"account": username, "created_at": bson.M{"$lte": t}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id": "$currency",
+			"amount": bson.M{"$sum": bson.M{"$cond": bson.A{
+				bson.M{"$eq": bson.A{"$direction", ledger.Credit}},
+				"$amount",
+				bson.M{"$multiply": bson.A{"$amount", -1}},
+			}}},
+		}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var sums []struct {
+		Currency string `bson:"_id"`
+		Amount   int64  `bson:"amount"`
+	}
+	if err = cursor.All(ctx, &sums); err != nil {
+		return nil, err
+	}
+
+	var balance = map[string]int64{}
+	for _, sum := range sums {
+		balance[sum.Currency] = sum.Amount
+	}
+	return balance, nil
+}
+
+func (d *mongoDB) VerifyLedger(ctx context.Context) ([]ledger.Drift, error) {
+	var drift []ledger.Drift
+	// In a transaction both are read from the same snapshot.
+	err := d.write(ctx, func(ctx context.Context) error {
+		users, err := d.findUsers(ctx, bson.M{}, options.Find().SetProjection(bson.M{"username": 1, "balances": 1}))
+		if err != nil {
+			return err
+		}
+		var cached = make(map[string]map[string]int64, len(users))
+		for _, user := range users {
+			cached[user.Username] = user.Balances
+		}
+
+		cursor, err := d.db.Collection("ledger_entries").Aggregate(ctx, mongo.Pipeline{
+			{{Key: "$group", Value: bson.M{
+				"_id": bson.M{"account": "$account", "currency": "$currency"},
+				"amount": bson.M{"$sum": bson.M{"$cond": bson.A{
+					bson.M{"$eq": bson.A{"$direction", ledger.Credit}},
+					"$amount",
+					bson.M{"$multiply": bson.A{"$amount", -1}},
+				}}},
+			}}},
+		})
+		if err != nil {
+			return err
+		}
+		var sums []struct {
+			ID struct {
+				Account  string `bson:"account"`
+				Currency string `bson:"currency"`
+			} `bson:"_id"`
+			Amount int64 `bson:"amount"`
+		}
+		if err = cursor.All(ctx, &sums); err != nil {
+			return err
+		}
+		var balances = map[string]map[string]int64{}
+		for _, sum := range sums {
+			if balances[sum.ID.Account] == nil {
+				balances[sum.ID.Account] = map[string]int64{}
+			}
+			balances[sum.ID.Account][sum.ID.Currency] = sum.Amount
+		}
+
+		drift = ledger.Compare(cached, balances)
+		return nil
+	})
+	return drift, err
+}
+
+func (d *mongoDB) ReserveIdempotencyKey(ctx context.Context, key string, requestHash string, expiresAt time.Time) (*IdempotencyRecord, error) {
+	var keys *mongo.Collection = d.db.Collection("idempotency_keys")
+	var reservation = mongoIdempotency{Key: key, RequestHash: requestHash, ExpiresAt: expiresAt}
+
+	_, err := keys.InsertOne(ctx, reservation)
+	if err == nil || !mongo.IsDuplicateKeyError(err) {
+		return nil, err
+	}
+
+	// An expired reservation is replaced, a live one is left alone and
+	// returned.
+	result, err := keys.ReplaceOne(ctx, bson.M{"_id": key, "expires_at": bson.M{"$lte": bsonNow()}}, reservation)
+	if err != nil {
+		return nil, err
+	}
+	if result.MatchedCount > 0 {
+		return nil, nil
+	}
+
+	var record mongoIdempotency
+	if err = keys.FindOne(ctx, bson.M{"_id": key}).Decode(&record); err != nil {
+		return nil, err
+	}
+	record.ExpiresAt = record.ExpiresAt.UTC()
+	var existing = IdempotencyRecord(record)
+	return &existing, ErrKeyReserved
+}
+
+func (d *mongoDB) CompleteIdempotencyKey(ctx context.Context, key string, statusCode int, contentType string, body []byte) error {
+	var keys *mongo.Collection = d.db.Collection("idempotency_keys")
+	// A key that expired while the request ran may be gone, there is
+	// nothing to replay to then.
+	_, err := keys.UpdateOne(ctx, bson.M{"_id": key}, bson.M{"$set": bson.M{
+		"done":         true,
+		"status_code":  statusCode,
+		"content_type": contentType,
+		"body":         body,
+	}})
+	if err != nil {
+		return err
+	}
+
+	_, err = keys.DeleteMany(ctx, bson.M{"expires_at": bson.M{"$lte": bsonNow()}})
+	return err
+}
+
+// AppendAudit inserts entry with the sequence number after the newest, which
+// is unique, and chains it again if another entry got there first.
+func (d *mongoDB) AppendAudit(ctx context.Context, entry AuditEntry) (*AuditEntry, error) {
+	var audit *mongo.Collection = d.db.Collection("audit_log")
+	for range auditAttempts {
+		var last mongoAuditEntry
+		err := audit.FindOne(ctx, bson.M{}, options.FindOne().SetSort(bson.D{{Key: "seq", Value: -1}})).Decode(&last)
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, err
+		}
+
+		var next AuditEntry = chainAudit(entry, AuditEntry{Seq: last.Seq, Hash: last.Hash})
+		_, err = audit.InsertOne(ctx, mongoAuditEntry(next))
+		if mongo.IsDuplicateKeyError(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &next, nil
+	}
+	return nil, errAuditRace
+}
+
+func (d *mongoDB) ListAudit(ctx context.Context, filter AuditFilter) ([]AuditEntry, error) {
+	var query = bson.M{}
+	if !filter.Since.IsZero() {
+		query["created_at"] = bson.M{"$gte": filter.Since.UTC()}
+	}
+	if filter.User != "" {
+		query["$or"] = bson.A{bson.M{"actor": filter.User}, bson.M{"target": filter.User}}
+	}
+	if filter.Action != "" {
+		query["action"] = filter.Action
+	}
+	if filter.Before > 0 {
+		query["seq"] = bson.M{"$lt": filter.Before}
+	}
+	cursor, err := d.db.Collection("audit_log").Find(ctx, query,
+		options.Find().SetSort(bson.D{{Key: "seq", Value: -1}}).SetLimit(int64(filter.Limit)))
+	if err != nil {
+		return nil, err
+	}
+
+	var documents []mongoAuditEntry
+	if err = cursor.All(ctx, &documents); err != nil {
+		return nil, err
+	}
+	var entries = make([]AuditEntry, 0, len(documents))
+	for _, document := range documents {
+		document.CreatedAt = document.CreatedAt.UTC()
+		entries = append(entries, AuditEntry(document))
+	}
+	return entries, nil
+}
+
+func (d *mongoDB) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	_, err := d.db.Collection("idempotency_keys").DeleteOne(ctx, bson.M{"_id": key})
+	return err
+}
+
+// SetupDatabase creates the indexes and finds out whether the server runs
+// transactions.
+func (d *mongoDB) SetupDatabase() error {
+	var ctx context.Context = context.Background()
+
+	var indexes = map[string][]mongo.IndexModel{
+		"users": {
+			{Keys: bson.D{{Key: "username", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: coinsField, Value: -1}, {Key: "username", Value: 1}}},
+		},
+		"sessions": {
+			{Keys: bson.D{{Key: "token", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "username", Value: 1}}},
+		},
+		"api_keys": {
+			{Keys: bson.D{{Key: "id", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "key_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		},
+		"transactions": {
+			{Keys: bson.D{{Key: "username", Value: 1}, {Key: "seq", Value: -1}}},
+		},
+		"ledger_entries": {
+			{Keys: bson.D{{Key: "transaction_id", Value: 1}}},
+			{Keys: bson.D{{Key: "account", Value: 1}, {Key: "created_at", Value: 1}}},
+		},
+		"audit_log": {
+			{Keys: bson.D{{Key: "seq", Value: -1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "actor", Value: 1}, {Key: "seq", Value: -1}}},
+			{Keys: bson.D{{Key: "target", Value: 1}, {Key: "seq", Value: -1}}},
+		},
+	}
+	for collection, models := range indexes {
+		if _, err := d.db.Collection(collection).Indexes().CreateMany(ctx, models); err != nil {
+			return fmt.Errorf("indexes of %s: %w", collection, err)
+		}
+	}
+
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	if err := d.db.RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+		return err
+	}
+	d.transactions = hello.SetName != "" || hello.Msg == "isdbgrid"
+	if !d.transactions {
+		d.logger.Warn("MongoDB is a standalone server without transactions: transfers will fail, and a failed write may leave its balance without a ledger record")
+	}
+	return d.hashTokens(ctx)
+}
+
+// hashTokens replaces the tokens of the sessions stored in plaintext, before
+// tokens were hashed, with HashToken of them.
+func (d *mongoDB) hashTokens(ctx context.Context) error {
+	var sessions *mongo.Collection = d.db.Collection("sessions")
+	var plaintext = bson.M{"token": bson.M{"$not": bson.Regex{Pattern: "^" + regexp.QuoteMeta(tokenHashPrefix)}}}
+	cursor, err := sessions.Find(ctx, plaintext)
+	if err != nil {
+		return err
+	}
+	var documents []mongoSession
+	if err = cursor.All(ctx, &documents); err != nil {
+		return err
+	}
+
+	for _, document := range documents {
+		_, err = sessions.UpdateOne(ctx, bson.M{"token": document.Token}, bson.M{"$set": bson.M{"token": HashToken(document.Token)}})
+		if err != nil {
+			return fmt.Errorf("hashing auth tokens: %w", err)
+		}
+	}
+	if len(documents) > 0 {
+		d.logger.Infof("Hashed %d auth tokens stored in plaintext", len(documents))
+	}
+	return nil
+}
+
+func (d *mongoDB) Ping(ctx context.Context) error {
+	return d.client.Ping(ctx, nil)
+}
+
+func (d *mongoDB) Close() error {
+	return d.client.Disconnect(context.Background())
+}
+
+// transient is true for network errors, which the driver already retried
+// once, and for transactions aborted by a conflict with another.
+func (d *mongoDB) transient(err error) bool {
+	var labeled mongo.LabeledError
+	return mongo.IsNetworkError(err) || errors.As(err, &labeled) && labeled.HasErrorLabel("TransientTransactionError")
+}
@@ -0,0 +1,40 @@
+package tools
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/lib/pq"
+	"github.com/lib/pq/pqerror"
+)
+
+var postgresDialect = dialect{
+	name:        "postgres",
+	placeholder: func(n int) string { return "$" + strconv.Itoa(n) },
+	forUpdate:   " FOR UPDATE",
+	migrations:  "migrations/postgres",
+	migrationsTable: `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    BIGINT PRIMARY KEY,
+		name       TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL
+	)`,
+	// Makes servers starting together apply each migration once, the others
+	// waiting for it to commit.
+	lockMigrations: `LOCK TABLE schema_migrations IN EXCLUSIVE MODE`,
+	transient:      postgresTransient,
+}
+
+// postgresTransient is true for serialization failures and deadlocks, which
+// roll the transaction back, and for a lost or refused connection.
+func postgresTransient(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	switch pqErr.Code {
+	case pqerror.TRSerializationFailure, pqerror.TRDeadlockDetected,
+		pqerror.AdminShutdown, pqerror.CrashShutdown, pqerror.CannotConnectNow:
+		return true
+	}
+	return pqErr.Code.Class() == pqerror.ClassConnectionException
+}
@@ -0,0 +1,169 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/internal/config"
+	"github.com/RashedMaaitah/goapi/internal/ledger"
+	"github.com/RashedMaaitah/goapi/internal/metrics"
+	log "github.com/sirupsen/logrus"
+)
+
+// transientChecker is implemented by the drivers, telling the errors a
+// call may succeed on when made again, such as a dropped connection or a
+// serialization failure.
+type transientChecker interface {
+	transient(err error) bool
+}
+
+// retryDB retries the calls safe to repeat: the reads, and the writes that
+// have the same effect when made twice, such as a compare-and-set
+// AdjustUserCoins. Other methods go straight to the database, as a write
+// that failed may still have been applied.
+type retryDB struct {
+	Database
+	cfg       config.RetryConfig
+	transient func(err error) bool
+	logger    *log.Logger
+	metrics   *metrics.Metrics
+}
+
+// Retry returns a Database making the calls of database that are safe to
+// repeat up to cfg.Attempts times while they fail with an error its driver
+// deems transient.
+func Retry(database Database, cfg config.RetryConfig, logger *log.Logger, m *metrics.Metrics) Database {
+	checker, ok := driverOf(database).(transientChecker)
+	if !ok {
+		return database
+	}
+	return &retryDB{Database: database, cfg: cfg, transient: checker.transient, logger: logger, metrics: m}
+}
+
+// retryable reports whether a call failing with err may be made again.
+// Errors the database answers with, such as ErrUserNotFound, and those of
+// a caller giving up never are.
+func (d *retryDB) retryable(err error) bool {
+	switch {
+	case errorResult(err) != "error":
+		return false
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return false
+	}
+	return d.transient(err)
+}
+
+// retry makes call until it succeeds, fails with an error that isn't
+// retryable or has been made cfg.Attempts times. A retry that would only
+// start after the deadline of ctx isn't made.
+func retry[T any](ctx context.Context, d *retryDB, method string, call func() (T, error)) (T, error) {
+	var delay time.Duration = d.cfg.Backoff.Duration()
+	for attempt := 1; ; attempt++ {
+		result, err := call()
+		if err == nil || attempt >= d.cfg.Attempts || !d.retryable(err) {
+			return result, err
+		}
+
+		// Half the delay, plus up to as much at random, so the calls that
+		// failed together don't all retry together.
+		var wait time.Duration = delay/2 + rand.N(delay/2+1)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return result, err
+		}
+		d.metrics.DBRetries.Inc(method)
+		d.logger.Debugf("Retrying %s in %s after attempt %d: %v", method, wait, attempt, err)
+
+		var timer *time.Timer = time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return result, err
+		}
+		delay = min(2*delay, d.cfg.MaxBackoff.Duration())
+	}
+}
+
+// retryErr is retry for the methods returning only an error.
+func retryErr(ctx context.Context, d *retryDB, method string, call func() error) error {
+	_, err := retry(ctx, d, method, func() (struct{}, error) { return struct{}{}, call() })
+	return err
+}
+
+func (d *retryDB) GetUserLoginDetails(ctx context.Context, username string) (*LoginDetails, error) {
+	return retry(ctx, d, "GetUserLoginDetails", func() (*LoginDetails, error) { return d.Database.GetUserLoginDetails(ctx, username) })
+}
+
+func (d *retryDB) GetUserCoins(ctx context.Context, username string) (*CoinDetails, error) {
+	return retry(ctx, d, "GetUserCoins", func() (*CoinDetails, error) { return d.Database.GetUserCoins(ctx, username) })
+}
+
+// AdjustUserCoins is retried only with a version: a repeat of a call that
+// was applied then fails with ErrVersionConflict instead of applying it
+// twice.
+func (d *retryDB) AdjustUserCoins(ctx context.Context, username string, currency string, delta int64, version int64) (*CoinDetails, error) {
+	if version == 0 {
+		return d.Database.AdjustUserCoins(ctx, username, currency, delta, version)
+	}
+	return retry(ctx, d, "AdjustUserCoins", func() (*CoinDetails, error) {
+		return d.Database.AdjustUserCoins(ctx, username, currency, delta, version)
+	})
+}
+
+func (d *retryDB) SetOverdraft(ctx context.Context, username string, limit int64) (*CoinDetails, error) {
+	return retry(ctx, d, "SetOverdraft", func() (*CoinDetails, error) { return d.Database.SetOverdraft(ctx, username, limit) })
+}
+
+func (d *retryDB) ListTransactions(ctx context.Context, username string, limit int, before int64) ([]Transaction, error) {
+	return retry(ctx, d, "ListTransactions", func() ([]Transaction, error) { return d.Database.ListTransactions(ctx, username, limit, before) })
+}
+
+func (d *retryDB) UpdatePassword(ctx context.Context, username string, passwordHash string) error {
+	return retryErr(ctx, d, "UpdatePassword", func() error { return d.Database.UpdatePassword(ctx, username, passwordHash) })
+}
+
+func (d *retryDB) GetUserIncludingDeleted(ctx context.Context, username string) (*LoginDetails, error) {
+	return retry(ctx, d, "GetUserIncludingDeleted", func() (*LoginDetails, error) { return d.Database.GetUserIncludingDeleted(ctx, username) })
+}
+
+func (d *retryDB) GetSession(ctx context.Context, token string) (*Session, error) {
+	return retry(ctx, d, "GetSession", func() (*Session, error) { return d.Database.GetSession(ctx, token) })
+}
+
+func (d *retryDB) ListAPIKeys(ctx context.Context) ([]APIKey, error) {
+	return retry(ctx, d, "ListAPIKeys", func() ([]APIKey, error) { return d.Database.ListAPIKeys(ctx) })
+}
+
+func (d *retryDB) GetAPIKey(ctx context.Context, hash string) (*APIKey, error) {
+	return retry(ctx, d, "GetAPIKey", func() (*APIKey, error) { return d.Database.GetAPIKey(ctx, hash) })
+}
+
+func (d *retryDB) SearchUsers(ctx context.Context, filter UserFilter) ([]UserSummary, error) {
+	return retry(ctx, d, "SearchUsers", func() ([]UserSummary, error) { return d.Database.SearchUsers(ctx, filter) })
+}
+
+func (d *retryDB) GetStats(ctx context.Context, bounds []int64) (*Stats, error) {
+	return retry(ctx, d, "GetStats", func() (*Stats, error) { return d.Database.GetStats(ctx, bounds) })
+}
+
+func (d *retryDB) LedgerEntries(ctx context.Context, transactionID string) ([]ledger.Entry, error) {
+	return retry(ctx, d, "LedgerEntries", func() ([]ledger.Entry, error) { return d.Database.LedgerEntries(ctx, transactionID) })
+}
+
+func (d *retryDB) VerifyLedger(ctx context.Context) ([]ledger.Drift, error) {
+	return retry(ctx, d, "VerifyLedger", func() ([]ledger.Drift, error) { return d.Database.VerifyLedger(ctx) })
+}
+
+func (d *retryDB) ListAudit(ctx context.Context, filter AuditFilter) ([]AuditEntry, error) {
+	return retry(ctx, d, "ListAudit", func() ([]AuditEntry, error) { return d.Database.ListAudit(ctx, filter) })
+}
+
+func (d *retryDB) GetBalanceAsOf(ctx context.Context, username string, t time.Time) (map[string]int64, error) {
+	return retry(ctx, d, "GetBalanceAsOf", func() (map[string]int64, error) { return d.Database.GetBalanceAsOf(ctx, username, t) })
+}
+
+func (d *retryDB) GetTopUsers(ctx context.Context, offset, limit int) ([]CoinDetails, error) {
+	return retry(ctx, d, "GetTopUsers", func() ([]CoinDetails, error) { return d.Database.GetTopUsers(ctx, offset, limit) })
+}
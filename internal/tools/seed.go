@@ -0,0 +1,184 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/RashedMaaitah/goapi/api"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v3"
+)
+
+// seedFile is the layout of a seed file, in JSON or YAML.
+type seedFile struct {
+	Users []seedUser `json:"users" yaml:"users"`
+}
+
+// seedUser takes either a password, hashed when seeding, or the bcrypt
+// hash of one. Tokens become sessions that never expire, like those of
+// the demo users.
+type seedUser struct {
+	Username     string   `json:"username" yaml:"username"`
+	Password     string   `json:"password" yaml:"password"`
+	PasswordHash string   `json:"password_hash" yaml:"password_hash"`
+	Role         string   `json:"role" yaml:"role"`
+	Coins        int64    `json:"coins" yaml:"coins"`
+	Tokens       []string `json:"tokens" yaml:"tokens"`
+}
+
+// Seed creates the users of the seed file at path in database, with their
+// roles, balances and tokens. The whole file is checked before anything is
+// created, and the users are created all or none. With ifEmpty set,
+// nothing is done when database already has users.
+func Seed(ctx context.Context, database Database, path string, ifEmpty bool, bcryptCost int, logger *log.Logger) error {
+	file, err := readSeed(path)
+	if err != nil {
+		return err
+	}
+	if err = file.validate(); err != nil {
+		return fmt.Errorf("seed file %s: %w", path, err)
+	}
+
+	if ifEmpty {
+		users, err := database.SearchUsers(ctx, UserFilter{Limit: 1})
+		if err != nil {
+			return fmt.Errorf("looking for users: %w", err)
+		}
+		if len(users) > 0 {
+			logger.Infof("Not seeding from %s: the database already has users", path)
+			return nil
+		}
+	}
+
+	var users = make([]NewUser, 0, len(file.Users))
+	for _, user := range file.Users {
+		var hash string = user.PasswordHash
+		if hash == "" {
+			hashed, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcryptCost)
+			if err != nil {
+				return fmt.Errorf("hashing password of %s: %w", user.Username, err)
+			}
+			hash = string(hashed)
+		}
+		users = append(users, NewUser{Username: user.Username, PasswordHash: hash, Role: user.Role, Coins: user.Coins})
+	}
+
+	errs, err := database.ImportUsers(ctx, users, true)
+	if err != nil {
+		return fmt.Errorf("seeding users: %w", err)
+	}
+	var existing []string
+	for i, err := range errs {
+		if errors.Is(err, ErrUserExists) {
+			existing = append(existing, users[i].Username)
+		} else if err != nil {
+			return fmt.Errorf("seeding %s: %w", users[i].Username, err)
+		}
+	}
+	if len(existing) > 0 {
+		return fmt.Errorf("seed file %s: users already exist, nothing was seeded: %s", path, strings.Join(existing, ", "))
+	}
+
+	var tokens int
+	for _, user := range file.Users {
+		for _, token := range user.Tokens {
+			if err = database.CreateSession(ctx, Session{Token: HashToken(token), Username: user.Username}, false); err != nil {
+				return fmt.Errorf("seeding token of %s: %w", user.Username, err)
+			}
+			tokens++
+		}
+	}
+
+	logger.Infof("Seeded %d users and %d tokens from %s", len(users), tokens, path)
+	return nil
+}
+
+// readSeed decodes the seed file at path, rejecting unknown keys like the
+// config file does.
+func readSeed(path string) (*seedFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading seed file: %w", err)
+	}
+
+	var file seedFile
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		var decoder *yaml.Decoder = yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		err = decoder.Decode(&file)
+	case ".json":
+		var decoder *json.Decoder = json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(&file)
+	default:
+		return nil, fmt.Errorf("seed file %s: unsupported extension, use .yaml, .yml or .json", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("seed file %s: %w", path, err)
+	}
+	return &file, nil
+}
+
+// validate returns every problem of the file at once.
+func (f *seedFile) validate() error {
+	var errs []error
+	var usernames = map[string]int{}
+	var tokens = map[string]string{}
+
+	for i := range f.Users {
+		f.Users[i].Username = api.NormalizeUsername(f.Users[i].Username)
+		var user = f.Users[i]
+		var fail = func(format string, args ...any) {
+			errs = append(errs, fmt.Errorf("users[%d] (%s): %s", i, user.Username, fmt.Sprintf(format, args...)))
+		}
+
+		if !api.UsernamePattern.MatchString(user.Username) {
+			fail("invalid username")
+		}
+		if first, ok := usernames[user.Username]; ok {
+			fail("duplicate of users[%d]", first)
+		} else {
+			usernames[user.Username] = i
+		}
+
+		switch {
+		case user.Password == "" && user.PasswordHash == "":
+			fail("needs a password or a password_hash")
+		case user.Password != "" && user.PasswordHash != "":
+			fail("has both a password and a password_hash")
+		case user.PasswordHash != "":
+			if _, err := bcrypt.Cost([]byte(user.PasswordHash)); err != nil {
+				fail("password_hash is not a bcrypt hash")
+			}
+		}
+
+		if user.Role != "" && user.Role != RoleUser && user.Role != RoleAdmin {
+			fail("unknown role %q: must be %s or %s", user.Role, RoleUser, RoleAdmin)
+		}
+		if user.Coins < 0 {
+			fail("negative coins %d", user.Coins)
+		}
+
+		for _, token := range user.Tokens {
+			if strings.TrimSpace(token) == "" {
+				fail("empty token")
+				continue
+			}
+			if owner, ok := tokens[token]; ok {
+				fail("a token is also one of %s", owner)
+				continue
+			}
+			tokens[token] = user.Username
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,231 @@
+package tools
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/internal/config"
+	"github.com/RashedMaaitah/goapi/internal/ledger"
+	log "github.com/sirupsen/logrus"
+)
+
+// snapshotVersion is the layout of snapshotData written. Bump it when that
+// changes in a way older servers can't read.
+const snapshotVersion = 1
+
+// snapshotFile is what a snapshot file holds. Checksum is the SHA-256 of
+// Data, so a file cut short or changed by hand is told apart from one
+// this server wrote.
+type snapshotFile struct {
+	Version  int             `json:"version"`
+	Checksum string          `json:"checksum"`
+	Data     json.RawMessage `json:"data"`
+}
+
+type snapshotData struct {
+	Users        map[string]LoginDetails      `json:"users"`
+	Coins        map[string]CoinDetails       `json:"coins"`
+	Sessions     map[string]Session           `json:"sessions"`
+	APIKeys      map[string]APIKey            `json:"api_keys"`
+	Transactions []Transaction                `json:"transactions"`
+	Idempotency  map[string]IdempotencyRecord `json:"idempotency"`
+	Ledger       []ledger.Entry               `json:"ledger"`
+	Audit        []AuditEntry                 `json:"audit"`
+}
+
+// errSnapshotCorrupt is the error of snapshot files this server can't
+// trust, in which case it starts from the seed data instead.
+var errSnapshotCorrupt = errors.New("snapshot is corrupt")
+
+// openSnapshotted returns the mock database as cfg.Snapshot saved it, or
+// as openMemory does when there is no snapshot yet or it is corrupt. A
+// corrupt one is kept next to it with a .corrupt suffix rather than
+// overwritten. It then saves a snapshot every cfg.SnapshotInterval and on
+// Close.
+func openSnapshotted(cfg config.DatabaseConfig, logger *log.Logger) (*InMemoryDB, error) {
+	d, err := openMemory(cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := readSnapshot(cfg.Snapshot)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		logger.Infof("No snapshot at %s yet, starting from the seed data", cfg.Snapshot)
+	case errors.Is(err, errSnapshotCorrupt):
+		var kept string = cfg.Snapshot + ".corrupt"
+		if renameErr := os.Rename(cfg.Snapshot, kept); renameErr != nil {
+			return nil, fmt.Errorf("moving aside snapshot %s: %w", cfg.Snapshot, renameErr)
+		}
+		logger.Errorf("Snapshot %s is unusable, starting from the seed data instead: %v. It was moved to %s.", cfg.Snapshot, err, kept)
+	case err != nil:
+		return nil, fmt.Errorf("reading snapshot %s: %w", cfg.Snapshot, err)
+	default:
+		d.restore(data)
+		logger.Infof("Loaded snapshot %s with %d users", cfg.Snapshot, len(data.Users))
+	}
+
+	d.snapshot = cfg.Snapshot
+	d.done = make(chan struct{})
+	d.stopped = make(chan struct{})
+	go d.saveEvery(cfg.SnapshotInterval.Duration())
+
+	return d, nil
+}
+
+// readSnapshot returns the data saved in path. Files of another version
+// are an error of their own rather than corrupt: they may well be fine,
+// and were written by a newer server this one shouldn't overwrite.
+func readSnapshot(path string) (*snapshotData, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file snapshotFile
+	if err = json.Unmarshal(content, &file); err != nil {
+		return nil, fmt.Errorf("%w: %v", errSnapshotCorrupt, err)
+	}
+	if file.Version != snapshotVersion {
+		return nil, fmt.Errorf("version %d, this server reads version %d", file.Version, snapshotVersion)
+	}
+	if checksum(file.Data) != file.Checksum {
+		return nil, fmt.Errorf("%w: checksum mismatch", errSnapshotCorrupt)
+	}
+
+	var data snapshotData
+	if err = json.Unmarshal(file.Data, &data); err != nil {
+		return nil, fmt.Errorf("%w: %v", errSnapshotCorrupt, err)
+	}
+	return &data, nil
+}
+
+func checksum(data []byte) string {
+	var sum = sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// restore replaces everything d holds with data.
+func (d *InMemoryDB) restore(data *snapshotData) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.users = data.Users
+	d.coins = data.Coins
+	d.sessions = data.Sessions
+	d.apiKeys = data.APIKeys
+	d.transactions = data.Transactions
+	d.idempotency = data.Idempotency
+	d.ledger = ledger.LoadBook(data.Ledger)
+	d.audit = data.Audit
+
+	// A snapshot of an empty store leaves its maps null.
+	if d.users == nil {
+		d.users = map[string]LoginDetails{}
+	}
+	if d.coins == nil {
+		d.coins = map[string]CoinDetails{}
+	}
+	if d.sessions == nil {
+		d.sessions = map[string]Session{}
+	}
+	// Snapshots saved before tokens were hashed hold them in plaintext.
+	if hashed := hashSessions(d.sessions); hashed > 0 {
+		d.logger.Infof("Hashed %d auth tokens of the snapshot stored in plaintext", hashed)
+	}
+	// Or from before API keys.
+	if d.apiKeys == nil {
+		d.apiKeys = map[string]APIKey{}
+	}
+	if d.idempotency == nil {
+		d.idempotency = map[string]IdempotencyRecord{}
+	}
+}
+
+// saveEvery saves a snapshot every interval, if d changed since the last
+// one, until d.done is closed.
+func (d *InMemoryDB) saveEvery(interval time.Duration) {
+	defer close(d.stopped)
+
+	if interval <= 0 {
+		<-d.done
+		return
+	}
+
+	var ticker *time.Ticker = time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := d.saveSnapshot(); err != nil {
+				d.logger.Errorf("Saving snapshot %s: %v", d.snapshot, err)
+			}
+		case <-d.done:
+			return
+		}
+	}
+}
+
+// saveSnapshot writes what d holds to d.snapshot, unless it is what the
+// last snapshot saved. The file is written next to it and renamed over
+// it, so a crash while writing leaves the previous snapshot in place.
+func (d *InMemoryDB) saveSnapshot() error {
+	d.mu.RLock()
+	data, err := json.Marshal(snapshotData{
+		Users:        d.users,
+		Coins:        d.coins,
+		Sessions:     d.sessions,
+		APIKeys:      d.apiKeys,
+		Transactions: d.transactions,
+		Idempotency:  d.idempotency,
+		Ledger:       d.ledger.Entries(),
+		Audit:        d.audit,
+	})
+	d.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	var sum string = checksum(data)
+	if sum == d.savedChecksum {
+		return nil
+	}
+
+	content, err := json.Marshal(snapshotFile{Version: snapshotVersion, Checksum: sum, Data: data})
+	if err != nil {
+		return err
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(d.snapshot), filepath.Base(d.snapshot)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+
+	if _, err = temp.Write(content); err != nil {
+		temp.Close()
+		return err
+	}
+	if err = temp.Sync(); err != nil {
+		temp.Close()
+		return err
+	}
+	if err = temp.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(temp.Name(), d.snapshot); err != nil {
+		return err
+	}
+
+	d.savedChecksum = sum
+	d.logger.Debugf("Saved snapshot %s", d.snapshot)
+	return nil
+}
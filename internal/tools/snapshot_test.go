@@ -0,0 +1,140 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/internal/config"
+)
+
+// snapshotConfig is the mock driver saving to a snapshot in a directory
+// of its own, every interval.
+func snapshotConfig(t *testing.T, interval time.Duration) config.DatabaseConfig {
+	var cfg config.DatabaseConfig = config.Default().Database
+	cfg.Snapshot = filepath.Join(t.TempDir(), "goapi.snapshot")
+	cfg.SnapshotInterval = config.Duration(interval)
+	return cfg
+}
+
+func openSnapshotConfig(t *testing.T, cfg config.DatabaseConfig) Database {
+	t.Helper()
+	database, err := NewDatabase(cfg, testLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return database
+}
+
+func coinsOf(t *testing.T, database Database, username string) int64 {
+	t.Helper()
+	coins, err := database.GetUserCoins(context.Background(), username)
+	if err != nil {
+		t.Fatalf("GetUserCoins(%s): %v", username, err)
+	}
+	return coins.Coins
+}
+
+func TestSnapshotSavedOnClose(t *testing.T) {
+	var cfg config.DatabaseConfig = snapshotConfig(t, 0)
+
+	var database Database = openSnapshotConfig(t, cfg)
+	if _, err := database.AdjustUserCoins(context.Background(), "alex", DefaultCurrency, 50, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.CreateUser(context.Background(), "newcomer", "hash"); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	database = openSnapshotConfig(t, cfg)
+	defer database.Close()
+	if coinsOf(t, database, "alex") != 1050 {
+		t.Errorf("balance of alex after a restart = %d, want 1050", coinsOf(t, database, "alex"))
+	}
+	if _, err := database.GetUserLoginDetails(context.Background(), "newcomer"); err != nil {
+		t.Errorf("user created before the restart: %v", err)
+	}
+}
+
+func TestSnapshotSurvivesKill(t *testing.T) {
+	var cfg config.DatabaseConfig = snapshotConfig(t, 10*time.Millisecond)
+
+	// Never closed, as if the process were killed; the periodic snapshot
+	// is all that is left of it.
+	var killed Database = openSnapshotConfig(t, cfg)
+	t.Cleanup(func() { killed.Close() })
+	if _, err := killed.AdjustUserCoins(context.Background(), "alex", DefaultCurrency, -300, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	var deadline = time.Now().Add(5 * time.Second)
+	for {
+		data, err := readSnapshot(cfg.Snapshot)
+		if err == nil && data.Coins["alex"].Coins == 700 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no snapshot of the withdrawal was saved: %v", err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	var restarted Database = openSnapshotConfig(t, cfg)
+	defer restarted.Close()
+	if coinsOf(t, restarted, "alex") != 700 {
+		t.Errorf("balance of alex after a restart = %d, want 700", coinsOf(t, restarted, "alex"))
+	}
+	if coinsOf(t, restarted, "maria") != 2500 {
+		t.Errorf("balance of maria after a restart = %d, want 2500", coinsOf(t, restarted, "maria"))
+	}
+}
+
+func TestCorruptSnapshotFallsBackToSeedData(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		content string
+	}{
+		{"cut short", `{"version":1,"checksum":"`},
+		{"checksum mismatch", `{"version":1,"checksum":"00","data":{"users":{}}}`},
+		{"bad data", `{"version":1,"checksum":"` + checksum([]byte(`[]`)) + `","data":[]}`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg config.DatabaseConfig = snapshotConfig(t, 0)
+			if err := os.WriteFile(cfg.Snapshot, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			var database Database = openSnapshotConfig(t, cfg)
+			defer database.Close()
+			if coinsOf(t, database, "alex") != 1000 {
+				t.Errorf("balance of alex = %d, want the seeded 1000", coinsOf(t, database, "alex"))
+			}
+
+			kept, err := os.ReadFile(cfg.Snapshot + ".corrupt")
+			if err != nil || string(kept) != tt.content {
+				t.Errorf("corrupt snapshot kept as %q, %v", kept, err)
+			}
+		})
+	}
+}
+
+func TestSnapshotOfAnotherVersionIsRefused(t *testing.T) {
+	var cfg config.DatabaseConfig = snapshotConfig(t, 0)
+	var content = `{"version":2,"checksum":"","data":{}}`
+	if err := os.WriteFile(cfg.Snapshot, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewDatabase(cfg, testLogger()); err == nil {
+		t.Fatal("NewDatabase loaded a snapshot of version 2")
+	}
+	// Left for the newer server that wrote it.
+	if kept, _ := os.ReadFile(cfg.Snapshot); string(kept) != content {
+		t.Errorf("snapshot changed to %q", kept)
+	}
+}
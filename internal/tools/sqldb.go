@@ -0,0 +1,1218 @@
+package tools
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/config"
+	"github.com/RashedMaaitah/goapi/internal/ledger"
+	log "github.com/sirupsen/logrus"
+)
+
+// sqlDB implements Database on database/sql. The queries are written with
+// ? placeholders, which the dialect rewrites for its driver.
+//
+// Writes lock the users rows they change with the dialect's forUpdate for
+// the rest of their transaction, so the checks they make, such as the floor
+// of a withdrawal, still hold when the balance is written.
+type sqlDB struct {
+	db      *sql.DB
+	dialect dialect
+	logger  *log.Logger
+}
+
+// dialect is what differs between the SQL databases.
+type dialect struct {
+	name string
+
+	// setup is run by SetupDatabase on every start, before the migrations
+	// and outside of transactions.
+	setup []string
+
+	// migrations is the directory of the dialect's migrations in
+	// migrationFiles, and migrationsTable creates the table recording those
+	// applied. lockMigrations, if any, is run first in the transaction of
+	// each migration.
+	migrations      string
+	migrationsTable string
+	lockMigrations  string
+
+	// placeholder returns the n-th query parameter, counting from 1.
+	placeholder func(n int) string
+
+	// forUpdate is appended to selects of rows about to be changed.
+	forUpdate string
+
+	// transient tells the errors of the driver a call may succeed on when
+	// made again, besides those of a dropped connection.
+	transient func(err error) bool
+}
+
+// querier is a *sql.DB or a *sql.Tx.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func openSQL(driver string, d dialect, cfg config.DatabaseConfig, logger *log.Logger) (*sqlDB, error) {
+	db, err := sql.Open(driver, cfg.DSN)
+	if err != nil {
+		return nil, err
+	}
+
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime.Duration())
+
+	return &sqlDB{db: db, dialect: d, logger: logger}, nil
+}
+
+// rebind replaces the ? placeholders of query with the dialect's.
+func (d *sqlDB) rebind(query string) string {
+	var b strings.Builder
+	var n int
+	for _, r := range query {
+		if r != '?' {
+			b.WriteRune(r)
+			continue
+		}
+		n++
+		b.WriteString(d.dialect.placeholder(n))
+	}
+	return b.String()
+}
+
+func (d *sqlDB) exec(ctx context.Context, q querier, query string, args ...any) (sql.Result, error) {
+	return q.ExecContext(ctx, d.rebind(query), args...)
+}
+
+func (d *sqlDB) query(ctx context.Context, q querier, query string, args ...any) (*sql.Rows, error) {
+	return q.QueryContext(ctx, d.rebind(query), args...)
+}
+
+func (d *sqlDB) queryRow(ctx context.Context, q querier, query string, args ...any) *sql.Row {
+	return q.QueryRowContext(ctx, d.rebind(query), args...)
+}
+
+// inTx runs fn in a transaction, committed if fn returns nil and rolled
+// back otherwise.
+func (d *sqlDB) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err = fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// changed fails with notFound when result changed no rows.
+func changed(result sql.Result, err error, notFound error) error {
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return notFound
+	}
+	return nil
+}
+
+const loginColumns = `SELECT u.username, c.password_hash, u.role, u.created_at, u.display_name, u.email, u.deleted_at
+	FROM users u JOIN credentials c ON c.username = u.username`
+
+// login reads the login details of username, soft-deleted or not.
+func (d *sqlDB) login(ctx context.Context, q querier, username string) (*LoginDetails, error) {
+	var loginDetails LoginDetails
+	var deletedAt sql.NullTime
+	err := d.queryRow(ctx, q, loginColumns+` WHERE u.username = ?`, username).Scan(
+		&loginDetails.Username,
+		&loginDetails.PasswordHash,
+		&loginDetails.Role,
+		&loginDetails.CreatedAt,
+		&loginDetails.DisplayName,
+		&loginDetails.Email,
+		&deletedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	loginDetails.CreatedAt = loginDetails.CreatedAt.UTC()
+	if deletedAt.Valid {
+		loginDetails.DeletedAt = deletedAt.Time.UTC()
+	}
+	return &loginDetails, nil
+}
+
+// account reads the coin record of username and whether the user is
+// soft-deleted. With lock set the row stays locked until q, a transaction,
+// ends.
+func (d *sqlDB) account(ctx context.Context, q querier, username string, lock bool) (CoinDetails, bool, error) {
+	var query string = `SELECT frozen, overdraft_limit, version, deleted_at IS NOT NULL FROM users WHERE username = ?`
+	if lock {
+		query += d.dialect.forUpdate
+	}
+
+	var coinData = CoinDetails{Username: username}
+	var deleted bool
+	err := d.queryRow(ctx, q, query, username).Scan(&coinData.Frozen, &coinData.OverdraftLimit, &coinData.Version, &deleted)
+	if errors.Is(err, sql.ErrNoRows) {
+		return CoinDetails{}, false, ErrUserNotFound
+	}
+	if err != nil {
+		return CoinDetails{}, false, err
+	}
+
+	err = d.loadBalances(ctx, q, &coinData)
+	return coinData, deleted, err
+}
+
+// activeAccount is account for users that are not soft-deleted, any other
+// fails with ErrUserNotFound.
+func (d *sqlDB) activeAccount(ctx context.Context, q querier, username string, lock bool) (CoinDetails, error) {
+	coinData, deleted, err := d.account(ctx, q, username, lock)
+	if err == nil && deleted {
+		err = ErrUserNotFound
+	}
+	return coinData, err
+}
+
+func (d *sqlDB) loadBalances(ctx context.Context, q querier, coinData *CoinDetails) error {
+	rows, err := d.query(ctx, q, `SELECT currency, amount FROM balances WHERE username = ?`, coinData.Username)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var currency string
+		var amount int64
+		if err := rows.Scan(&currency, &amount); err != nil {
+			return err
+		}
+		if currency == DefaultCurrency {
+			coinData.Coins = amount
+			continue
+		}
+		if coinData.Balances == nil {
+			coinData.Balances = map[string]int64{}
+		}
+		coinData.Balances[currency] = amount
+	}
+	return rows.Err()
+}
+
+func (d *sqlDB) setBalance(ctx context.Context, tx *sql.Tx, username string, currency string, amount int64) error {
+	_, err := d.exec(ctx, tx, `INSERT INTO balances (username, currency, amount) VALUES (?, ?, ?)
+		ON CONFLICT (username, currency) DO UPDATE SET amount = excluded.amount`, username, currency, amount)
+	return err
+}
+
+// putAccount stores the flags of coinData and bumps its Version.
+func (d *sqlDB) putAccount(ctx context.Context, tx *sql.Tx, coinData *CoinDetails) error {
+	_, err := d.exec(ctx, tx, `UPDATE users SET frozen = ?, overdraft_limit = ?, version = version + 1 WHERE username = ?`,
+		coinData.Frozen, coinData.OverdraftLimit, coinData.Username)
+	if err != nil {
+		return err
+	}
+	coinData.Version++
+	return nil
+}
+
+// recordTransaction stamps t with the current time and stores it.
+func (d *sqlDB) recordTransaction(ctx context.Context, tx *sql.Tx, t Transaction) (Transaction, error) {
+	t.CreatedAt = time.Now().UTC()
+	_, err := d.exec(ctx, tx, `INSERT INTO transactions
+		(id, username, type, currency, amount, counterparty, balance, actor, reason, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		t.ID, t.Username, t.Type, t.Currency, t.Amount, t.Counterparty, t.Balance, t.Actor, t.Reason, t.CreatedAt)
+	return t, err
+}
+
+// post records entries in the ledger after the checks of ledger.Check.
+func (d *sqlDB) post(ctx context.Context, tx *sql.Tx, entries ...ledger.Entry) error {
+	if err := ledger.Check(entries...); err != nil {
+		return err
+	}
+
+	var now = time.Now().UTC()
+	for _, entry := range entries {
+		_, err := d.exec(ctx, tx, `INSERT INTO ledger_entries (transaction_id, account, direction, currency, amount, created_at)
+			VALUES (?, ?, ?, ?, ?, ?)`, entry.TransactionID, entry.Account, entry.Direction, entry.Currency, entry.Amount, now)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// insertUser creates the rows of a new user, failing with ErrUserExists if
+// the username is taken, by a soft-deleted user too.
+func (d *sqlDB) insertUser(ctx context.Context, tx *sql.Tx, user NewUser, createdAt time.Time) error {
+	result, err := d.exec(ctx, tx, `INSERT INTO users (username, role, created_at) VALUES (?, ?, ?)
+		ON CONFLICT (username) DO NOTHING`, user.Username, user.role(), createdAt)
+	if err = changed(result, err, ErrUserExists); err != nil {
+		return err
+	}
+
+	_, err = d.exec(ctx, tx, `INSERT INTO credentials (username, password_hash) VALUES (?, ?)`, user.Username, user.PasswordHash)
+	if err != nil {
+		return err
+	}
+	return d.setBalance(ctx, tx, user.Username, DefaultCurrency, user.Coins)
+}
+
+func (d *sqlDB) GetUserLoginDetails(ctx context.Context, username string) (*LoginDetails, error) {
+	username = api.NormalizeUsername(username)
+	loginDetails, err := d.login(ctx, d.db, username)
+	if err != nil {
+		return nil, err
+	}
+	if loginDetails.Deleted() {
+		return nil, ErrUserNotFound
+	}
+	return loginDetails, nil
+}
+
+func (d *sqlDB) GetUserCoins(ctx context.Context, username string) (*CoinDetails, error) {
+	username = api.NormalizeUsername(username)
+	coinData, err := d.activeAccount(ctx, d.db, username, false)
+	if err != nil {
+		return nil, err
+	}
+	return &coinData, nil
+}
+
+func (d *sqlDB) AdjustUserCoins(ctx context.Context, username string, currency string, delta int64, version int64) (*CoinDetails, error) {
+	username = api.NormalizeUsername(username)
+	var coinData CoinDetails
+	err := d.inTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		coinData, err = d.activeAccount(ctx, tx, username, true)
+		if err != nil {
+			return err
+		}
+		if version != 0 && coinData.Version != version {
+			return ErrVersionConflict
+		}
+		if coinData.Frozen {
+			return ErrAccountFrozen
+		}
+		balance, err := addBalance(coinData.Balance(currency), delta)
+		if err != nil {
+			return err
+		}
+		if balance < coinData.Floor() {
+			return ErrInsufficientFunds
+		}
+
+		var id string = newID()
+		if err = d.post(ctx, tx, ledger.Move(id, ledger.SystemAccount, username, currency, delta)...); err != nil {
+			return err
+		}
+		if err = d.setBalance(ctx, tx, username, currency, balance); err != nil {
+			return err
+		}
+		coinData = withBalance(coinData, currency, balance)
+		if err = d.putAccount(ctx, tx, &coinData); err != nil {
+			return err
+		}
+
+		var kind, amount = TransactionDeposit, delta
+		if delta < 0 {
+			kind, amount = TransactionWithdrawal, -delta
+		}
+		_, err = d.recordTransaction(ctx, tx, Transaction{
+			ID:       id,
+			Username: username,
+			Type:     kind,
+			Currency: currency,
+			Amount:   amount,
+			Balance:  balance,
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &coinData, nil
+}
+
+func (d *sqlDB) AdminAdjustCoins(ctx context.Context, username string, adjustment AdminAdjustment) (*CoinDetails, error) {
+	username = api.NormalizeUsername(username)
+	var coinData CoinDetails
+	err := d.inTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		coinData, err = d.activeAccount(ctx, tx, username, true)
+		if err != nil {
+			return err
+		}
+		if adjustment.Version != 0 && coinData.Version != adjustment.Version {
+			return ErrVersionConflict
+		}
+		var delta int64 = adjustment.Delta
+		if adjustment.Set {
+			delta = adjustment.Balance - coinData.Coins
+		}
+		if coins, err := addBalance(coinData.Coins, delta); err != nil {
+			return err
+		} else if coins < 0 && !adjustment.Force {
+			return ErrInsufficientFunds
+		}
+
+		var id string = newID()
+		if err = d.post(ctx, tx, ledger.Move(id, ledger.SystemAccount, username, DefaultCurrency, delta)...); err != nil {
+			return err
+		}
+		coinData.Coins += delta
+		if err = d.setBalance(ctx, tx, username, DefaultCurrency, coinData.Coins); err != nil {
+			return err
+		}
+		if err = d.putAccount(ctx, tx, &coinData); err != nil {
+			return err
+		}
+
+		_, err = d.recordTransaction(ctx, tx, Transaction{
+			ID:       id,
+			Username: username,
+			Type:     TransactionAdmin,
+			Currency: DefaultCurrency,
+			Amount:   delta,
+			Balance:  coinData.Coins,
+			Actor:    adjustment.Actor,
+			Reason:   adjustment.Reason,
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &coinData, nil
+}
+
+func (d *sqlDB) SetOverdraft(ctx context.Context, username string, limit int64) (*CoinDetails, error) {
+	username = api.NormalizeUsername(username)
+	var coinData CoinDetails
+	err := d.inTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		coinData, err = d.activeAccount(ctx, tx, username, true)
+		if err != nil {
+			return err
+		}
+		coinData.OverdraftLimit = limit
+		return d.putAccount(ctx, tx, &coinData)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &coinData, nil
+}
+
+func (d *sqlDB) SetFrozen(ctx context.Context, username string, frozen bool, actor string, reason string) (*CoinDetails, error) {
+	username = api.NormalizeUsername(username)
+	var coinData CoinDetails
+	err := d.inTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		coinData, err = d.activeAccount(ctx, tx, username, true)
+		if err != nil {
+			return err
+		}
+		coinData.Frozen = frozen
+		if err = d.putAccount(ctx, tx, &coinData); err != nil {
+			return err
+		}
+
+		var kind string = TransactionFreeze
+		if !frozen {
+			kind = TransactionUnfreeze
+		}
+		_, err = d.recordTransaction(ctx, tx, Transaction{
+			ID:       newID(),
+			Username: username,
+			Type:     kind,
+			Currency: DefaultCurrency,
+			Balance:  coinData.Coins,
+			Actor:    actor,
+			Reason:   reason,
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &coinData, nil
+}
+
+func (d *sqlDB) Transfer(ctx context.Context, from string, to string, currency string, amount int64) (*TransferDetails, error) {
+	from, to = api.NormalizeUsername(from), api.NormalizeUsername(to)
+	if from == to {
+		return nil, ErrSelfTransfer
+	}
+
+	var transfer *TransferDetails
+	err := d.inTx(ctx, func(tx *sql.Tx) error {
+		// Locked in the same order by every transfer, so two transfers
+		// between the same users can't wait for each other.
+		var usernames = []string{from, to}
+		sort.Strings(usernames)
+		var accounts = map[string]CoinDetails{}
+		var deleted = map[string]bool{}
+		for _, username := range usernames {
+			coinData, isDeleted, err := d.account(ctx, tx, username, true)
+			if err != nil && !errors.Is(err, ErrUserNotFound) {
+				return err
+			}
+			if err == nil {
+				accounts[username], deleted[username] = coinData, isDeleted
+			}
+		}
+
+		sender, ok := accounts[from]
+		if !ok || deleted[from] {
+			return ErrSenderNotFound
+		}
+		recipient, ok := accounts[to]
+		if !ok {
+			return ErrUserNotFound
+		}
+		if deleted[to] {
+			return ErrUserDeleted
+		}
+		if sender.Frozen || recipient.Frozen {
+			return ErrAccountFrozen
+		}
+		if sender.Balance(currency)-amount < sender.Floor() {
+			return ErrInsufficientFunds
+		}
+		if _, err := addBalance(recipient.Balance(currency), amount); err != nil {
+			return err
+		}
+
+		var id string = newID()
+		if err := d.post(ctx, tx, ledger.Move(id, from, to, currency, amount)...); err != nil {
+			return err
+		}
+
+		sender = withBalance(sender, currency, sender.Balance(currency)-amount)
+		recipient = withBalance(recipient, currency, recipient.Balance(currency)+amount)
+		for _, coinData := range []*CoinDetails{&sender, &recipient} {
+			if err := d.setBalance(ctx, tx, coinData.Username, currency, coinData.Balance(currency)); err != nil {
+				return err
+			}
+			if err := d.putAccount(ctx, tx, coinData); err != nil {
+				return err
+			}
+		}
+
+		out, err := d.recordTransaction(ctx, tx, Transaction{
+			ID:           id,
+			Username:     from,
+			Type:         TransactionTransferOut,
+			Currency:     currency,
+			Amount:       amount,
+			Counterparty: to,
+			Balance:      sender.Balance(currency),
+		})
+		if err != nil {
+			return err
+		}
+		_, err = d.recordTransaction(ctx, tx, Transaction{
+			ID:           id,
+			Username:     to,
+			Type:         TransactionTransferIn,
+			Currency:     currency,
+			Amount:       amount,
+			Counterparty: from,
+			Balance:      recipient.Balance(currency),
+		})
+		if err != nil {
+			return err
+		}
+
+		transfer = &TransferDetails{
+			ID:        id,
+			From:      from,
+			To:        to,
+			Currency:  currency,
+			Amount:    amount,
+			FromCoins: sender.Balance(currency),
+			ToCoins:   recipient.Balance(currency),
+			CreatedAt: out.CreatedAt,
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return transfer, nil
+}
+
+func (d *sqlDB) ListTransactions(ctx context.Context, username string, limit int, before int64) ([]Transaction, error) {
+	username = api.NormalizeUsername(username)
+	var query string = `SELECT seq, id, username, type, currency, amount, counterparty, balance, actor, reason, created_at
+		FROM transactions WHERE username = ?`
+	var args = []any{username}
+	if before > 0 {
+		query += ` AND seq < ?`
+		args = append(args, before)
+	}
+	query += ` ORDER BY seq DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := d.query(ctx, d.db, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var transactions = []Transaction{}
+	for rows.Next() {
+		var t Transaction
+		err = rows.Scan(&t.Seq, &t.ID, &t.Username, &t.Type, &t.Currency, &t.Amount, &t.Counterparty, &t.Balance, &t.Actor, &t.Reason, &t.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		t.CreatedAt = t.CreatedAt.UTC()
+		transactions = append(transactions, t)
+	}
+	return transactions, rows.Err()
+}
+
+func (d *sqlDB) CreateUser(ctx context.Context, username string, passwordHash string) (*LoginDetails, error) {
+	username = api.NormalizeUsername(username)
+	var loginDetails = LoginDetails{
+		Username:     username,
+		PasswordHash: passwordHash,
+		Role:         RoleUser,
+		CreatedAt:    time.Now().UTC(),
+	}
+	err := d.inTx(ctx, func(tx *sql.Tx) error {
+		return d.insertUser(ctx, tx, NewUser{Username: username, PasswordHash: passwordHash}, loginDetails.CreatedAt)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &loginDetails, nil
+}
+
+// errImportFailed rolls back an atomic import in which a user failed.
+var errImportFailed = errors.New("import failed")
+
+func (d *sqlDB) ImportUsers(ctx context.Context, users []NewUser, atomic bool) ([]error, error) {
+	users = normalizeUsers(users)
+	var errs = make([]error, len(users))
+	err := d.inTx(ctx, func(tx *sql.Tx) error {
+		var now = time.Now().UTC()
+		var failed bool
+		for i, user := range users {
+			err := d.insertUser(ctx, tx, user, now)
+			if errors.Is(err, ErrUserExists) {
+				errs[i] = err
+				failed = true
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			err = d.post(ctx, tx, ledger.Move(newID(), ledger.SystemAccount, user.Username, DefaultCurrency, user.Coins)...)
+			if err != nil {
+				return err
+			}
+		}
+		if atomic && failed {
+			return errImportFailed
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errImportFailed) {
+		return nil, err
+	}
+	return errs, nil
+}
+
+func (d *sqlDB) UpdateUser(ctx context.Context, username string, update UserUpdate) (*LoginDetails, error) {
+	username = api.NormalizeUsername(username)
+	result, err := d.exec(ctx, d.db, `UPDATE users SET display_name = COALESCE(?, display_name), email = COALESCE(?, email)
+		WHERE username = ? AND deleted_at IS NULL`, update.DisplayName, update.Email, username)
+	if err = changed(result, err, ErrUserNotFound); err != nil {
+		return nil, err
+	}
+	return d.login(ctx, d.db, username)
+}
+
+func (d *sqlDB) UpdatePassword(ctx context.Context, username string, passwordHash string) error {
+	username = api.NormalizeUsername(username)
+	result, err := d.exec(ctx, d.db, `UPDATE credentials SET password_hash = ?
+		WHERE username IN (SELECT username FROM users WHERE username = ? AND deleted_at IS NULL)`, passwordHash, username)
+	return changed(result, err, ErrUserNotFound)
+}
+
+func (d *sqlDB) CreateSession(ctx context.Context, session Session, replace bool) error {
+	session.Username = api.NormalizeUsername(session.Username)
+	return d.inTx(ctx, func(tx *sql.Tx) error {
+		if _, err := d.activeAccount(ctx, tx, session.Username, true); err != nil {
+			return err
+		}
+
+		var err error
+		if replace {
+			_, err = d.exec(ctx, tx, `DELETE FROM sessions WHERE username = ?`, session.Username)
+			if err != nil {
+				return err
+			}
+		}
+		_, err = d.exec(ctx, tx, `DELETE FROM sessions WHERE expires_at <= ?`, time.Now().UTC())
+		if err != nil {
+			return err
+		}
+
+		_, err = d.exec(ctx, tx, `INSERT INTO sessions (token, username, expires_at, scopes) VALUES (?, ?, ?, ?)`,
+			session.Token, session.Username, nullTime(session.ExpiresAt), nullScopes(session.Scopes))
+		return err
+	})
+}
+
+func (d *sqlDB) GetSession(ctx context.Context, token string) (*Session, error) {
+	var session = Session{Token: token}
+	var expiresAt sql.NullTime
+	var scopes sql.NullString
+	err := d.queryRow(ctx, d.db, `SELECT username, expires_at, scopes FROM sessions WHERE token = ?`, token).Scan(&session.Username, &expiresAt, &scopes)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if expiresAt.Valid {
+		session.ExpiresAt = expiresAt.Time.UTC()
+	}
+	if scopes.Valid {
+		session.Scopes = strings.Fields(scopes.String)
+	}
+	return &session, nil
+}
+
+// nullScopes stores scopes space separated, as OAuth2 does, and nil ones as
+// NULL.
+func nullScopes(scopes []string) sql.NullString {
+	return sql.NullString{String: strings.Join(scopes, " "), Valid: scopes != nil}
+}
+
+func (d *sqlDB) DeleteSession(ctx context.Context, token string) error {
+	result, err := d.exec(ctx, d.db, `DELETE FROM sessions WHERE token = ?`, token)
+	return changed(result, err, ErrSessionNotFound)
+}
+
+func (d *sqlDB) DeleteUserSessions(ctx context.Context, username string) error {
+	username = api.NormalizeUsername(username)
+	_, err := d.exec(ctx, d.db, `DELETE FROM sessions WHERE username = ?`, username)
+	return err
+}
+
+const apiKeyColumns = `SELECT id, name, role, key_hash, created_at, expires_at, last_used_at FROM api_keys`
+
+func (d *sqlDB) CreateAPIKey(ctx context.Context, key APIKey) error {
+	_, err := d.exec(ctx, d.db, `INSERT INTO api_keys (id, name, role, key_hash, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		key.ID, key.Name, key.Role, key.Hash, key.CreatedAt.UTC(), nullTime(key.ExpiresAt))
+	return err
+}
+
+func (d *sqlDB) ListAPIKeys(ctx context.Context) ([]APIKey, error) {
+	rows, err := d.query(ctx, d.db, apiKeyColumns+` ORDER BY created_at, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys = []APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+	return keys, rows.Err()
+}
+
+func (d *sqlDB) GetAPIKey(ctx context.Context, hash string) (*APIKey, error) {
+	key, err := scanAPIKey(d.queryRow(ctx, d.db, apiKeyColumns+` WHERE key_hash = ?`, hash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrAPIKeyNotFound
+	}
+	return key, err
+}
+
+func scanAPIKey(row interface{ Scan(dest ...any) error }) (*APIKey, error) {
+	var key APIKey
+	var expiresAt, lastUsedAt sql.NullTime
+	if err := row.Scan(&key.ID, &key.Name, &key.Role, &key.Hash, &key.CreatedAt, &expiresAt, &lastUsedAt); err != nil {
+		return nil, err
+	}
+
+	key.CreatedAt = key.CreatedAt.UTC()
+	if expiresAt.Valid {
+		key.ExpiresAt = expiresAt.Time.UTC()
+	}
+	if lastUsedAt.Valid {
+		key.LastUsedAt = lastUsedAt.Time.UTC()
+	}
+	return &key, nil
+}
+
+func (d *sqlDB) TouchAPIKey(ctx context.Context, id string, at time.Time) error {
+	result, err := d.exec(ctx, d.db, `UPDATE api_keys SET last_used_at = ? WHERE id = ?`, at.UTC(), id)
+	return changed(result, err, ErrAPIKeyNotFound)
+}
+
+func (d *sqlDB) DeleteAPIKey(ctx context.Context, id string) error {
+	result, err := d.exec(ctx, d.db, `DELETE FROM api_keys WHERE id = ?`, id)
+	return changed(result, err, ErrAPIKeyNotFound)
+}
+
+const auditColumns = `SELECT seq, actor, action, target, currency, amount, request_id, outcome, created_at, prev_hash, hash FROM audit_log`
+
+// AppendAudit inserts entry with the sequence number after the newest, and
+// chains it again if another entry got there first.
+func (d *sqlDB) AppendAudit(ctx context.Context, entry AuditEntry) (*AuditEntry, error) {
+	for range auditAttempts {
+		var last AuditEntry
+		err := d.queryRow(ctx, d.db, `SELECT seq, hash FROM audit_log ORDER BY seq DESC LIMIT 1`).Scan(&last.Seq, &last.Hash)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+
+		var next AuditEntry = chainAudit(entry, last)
+		result, err := d.exec(ctx, d.db, `INSERT INTO audit_log
+			(seq, actor, action, target, currency, amount, request_id, outcome, created_at, prev_hash, hash)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT (seq) DO NOTHING`,
+			next.Seq, next.Actor, next.Action, next.Target, next.Currency, next.Amount, next.RequestID, next.Outcome,
+			next.CreatedAt, next.PrevHash, next.Hash)
+		err = changed(result, err, errAuditRace)
+		if errors.Is(err, errAuditRace) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &next, nil
+	}
+	return nil, errAuditRace
+}
+
+func (d *sqlDB) ListAudit(ctx context.Context, filter AuditFilter) ([]AuditEntry, error) {
+	var query string = auditColumns + ` WHERE created_at >= ?`
+	var args = []any{filter.Since.UTC()}
+	if filter.User != "" {
+		query += ` AND (actor = ? OR target = ?)`
+		args = append(args, filter.User, filter.User)
+	}
+	if filter.Action != "" {
+		query += ` AND action = ?`
+		args = append(args, filter.Action)
+	}
+	if filter.Before > 0 {
+		query += ` AND seq < ?`
+		args = append(args, filter.Before)
+	}
+	query += ` ORDER BY seq DESC LIMIT ?`
+	args = append(args, filter.Limit)
+
+	rows, err := d.query(ctx, d.db, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries = []AuditEntry{}
+	for rows.Next() {
+		var e AuditEntry
+		err = rows.Scan(&e.Seq, &e.Actor, &e.Action, &e.Target, &e.Currency, &e.Amount, &e.RequestID, &e.Outcome, &e.CreatedAt, &e.PrevHash, &e.Hash)
+		if err != nil {
+			return nil, err
+		}
+		e.CreatedAt = e.CreatedAt.UTC()
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// activeCoins selects the users that are not soft-deleted with their
+// balance in DefaultCurrency as coins.
+const activeCoins = `FROM users u LEFT JOIN balances b ON b.username = u.username AND b.currency = ?
+	WHERE u.deleted_at IS NULL`
+
+func (d *sqlDB) GetTopUsers(ctx context.Context, offset, limit int) ([]CoinDetails, error) {
+	rows, err := d.query(ctx, d.db, `SELECT u.username, u.frozen, u.overdraft_limit, u.version, COALESCE(b.amount, 0) AS coins `+
+		activeCoins+` ORDER BY coins DESC, u.username LIMIT ? OFFSET ?`, DefaultCurrency, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	var users = []CoinDetails{}
+	for rows.Next() {
+		var coinData CoinDetails
+		if err = rows.Scan(&coinData.Username, &coinData.Frozen, &coinData.OverdraftLimit, &coinData.Version, &coinData.Coins); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		users = append(users, coinData)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range users {
+		if err = d.loadBalances(ctx, d.db, &users[i]); err != nil {
+			return nil, err
+		}
+	}
+	return users, nil
+}
+
+func (d *sqlDB) SearchUsers(ctx context.Context, filter UserFilter) ([]UserSummary, error) {
+	var query string = `SELECT u.username, u.role, COALESCE(b.amount, 0) AS coins, u.created_at ` + activeCoins
+	var args = []any{DefaultCurrency}
+	if filter.Prefix != "" {
+		query += ` AND u.username LIKE ? ESCAPE '\'`
+		args = append(args, likePrefix(filter.Prefix))
+	}
+	if filter.MinCoins != nil {
+		query += ` AND COALESCE(b.amount, 0) >= ?`
+		args = append(args, *filter.MinCoins)
+	}
+	if filter.MaxCoins != nil {
+		query += ` AND COALESCE(b.amount, 0) <= ?`
+		args = append(args, *filter.MaxCoins)
+	}
+	if filter.Role != "" {
+		query += ` AND u.role = ?`
+		args = append(args, filter.Role)
+	}
+
+	var direction string = " ASC"
+	if filter.Desc {
+		direction = " DESC"
+	}
+	switch filter.SortBy {
+	case SortByCoins:
+		query += ` ORDER BY coins` + direction + `, u.username`
+	case SortByCreatedAt:
+		query += ` ORDER BY u.created_at` + direction + `, u.username`
+	default:
+		query += ` ORDER BY u.username` + direction
+	}
+
+	var limit int64 = math.MaxInt64
+	if filter.Limit > 0 {
+		limit = int64(filter.Limit)
+	}
+	query += ` LIMIT ? OFFSET ?`
+	args = append(args, limit, filter.Offset)
+
+	rows, err := d.query(ctx, d.db, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users = []UserSummary{}
+	for rows.Next() {
+		var user UserSummary
+		if err = rows.Scan(&user.Username, &user.Role, &user.Coins, &user.CreatedAt); err != nil {
+			return nil, err
+		}
+		user.CreatedAt = user.CreatedAt.UTC()
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// likePrefix is a LIKE pattern, escaped with \, matching strings that
+// start with prefix.
+func likePrefix(prefix string) string {
+	var replacer = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return replacer.Replace(prefix) + "%"
+}
+
+func (d *sqlDB) GetStats(ctx context.Context, bounds []int64) (*Stats, error) {
+	// One sum per bucket, each counting the balances between the bounds
+	// around it.
+	var columns = []string{`COUNT(*)`, `COALESCE(SUM(coins), 0)`}
+	var args []any
+	for i := 0; i <= len(bounds); i++ {
+		var conditions []string
+		if i > 0 {
+			conditions = append(conditions, `coins >= ?`)
+			args = append(args, bounds[i-1])
+		}
+		if i < len(bounds) {
+			conditions = append(conditions, `coins < ?`)
+			args = append(args, bounds[i])
+		}
+		if len(conditions) == 0 {
+			conditions = append(conditions, `1 = 1`)
+		}
+		columns = append(columns, `COALESCE(SUM(CASE WHEN `+strings.Join(conditions, ` AND `)+` THEN 1 ELSE 0 END), 0)`)
+	}
+	args = append(args, DefaultCurrency)
+
+	var stats = Stats{Buckets: make([]int64, len(bounds)+1)}
+	var dest = []any{&stats.Users, &stats.TotalCoins}
+	for i := range stats.Buckets {
+		dest = append(dest, &stats.Buckets[i])
+	}
+
+	err := d.queryRow(ctx, d.db, `SELECT `+strings.Join(columns, `, `)+
+		` FROM (SELECT COALESCE(b.amount, 0) AS coins `+activeCoins+`) active`, args...).Scan(dest...)
+	if err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+func (d *sqlDB) GetUserIncludingDeleted(ctx context.Context, username string) (*LoginDetails, error) {
+	username = api.NormalizeUsername(username)
+	return d.login(ctx, d.db, username)
+}
+
+func (d *sqlDB) DeleteUser(ctx context.Context, username string) error {
+	username = api.NormalizeUsername(username)
+	result, err := d.exec(ctx, d.db, `UPDATE users SET deleted_at = ? WHERE username = ? AND deleted_at IS NULL`, time.Now().UTC(), username)
+	return changed(result, err, ErrUserNotFound)
+}
+
+func (d *sqlDB) RestoreUser(ctx context.Context, username string) error {
+	username = api.NormalizeUsername(username)
+	result, err := d.exec(ctx, d.db, `UPDATE users SET deleted_at = NULL WHERE username = ?`, username)
+	return changed(result, err, ErrUserNotFound)
+}
+
+func (d *sqlDB) LedgerEntries(ctx context.Context, transactionID string) ([]ledger.Entry, error) {
+	rows, err := d.query(ctx, d.db, `SELECT transaction_id, account, direction, currency, amount, created_at
+		FROM ledger_entries WHERE transaction_id = ? ORDER BY id`, transactionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries = []ledger.Entry{}
+	for rows.Next() {
+		var entry ledger.Entry
+		if err = rows.Scan(&entry.TransactionID, &entry.Account, &entry.Direction, &entry.Currency, &entry.Amount, &entry.CreatedAt); err != nil {
+			return nil, err
+		}
+		entry.CreatedAt = entry.CreatedAt.UTC()
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func (d *sqlDB) VerifyLedger(ctx context.Context) ([]ledger.Drift, error) {
+	var cached, sums = map[string]map[string]int64{}, map[string]map[string]int64{}
+
+	// Both are read from the same snapshot, so no movement is half seen.
+	tx, err := d.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	for _, read := range []struct {
+		query    string
+		balances map[string]map[string]int64
+	}{
+		{`SELECT username, currency, amount FROM balances`, cached},
+		{`SELECT account, currency, SUM(CASE WHEN direction = 'credit' THEN amount ELSE -amount END)
+			FROM ledger_entries GROUP BY account, currency`, sums},
+	} {
+		err = d.readBalances(ctx, tx, read.query, read.balances)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return ledger.Compare(cached, sums), nil
+}
+
+// GetBalanceAsOf sums the ledger entries of username up to t, by
+// currency.
+func (d *sqlDB) GetBalanceAsOf(ctx context.Context, username string, t time.Time) (map[string]int64, error) {
+	username = api.NormalizeUsername(username)
+	loginDetails, err := d.GetUserLoginDetails(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	if t.Before(loginDetails.CreatedAt) {
+		return nil, ErrNoBalanceYet
+	}
+
+	// Over the ledger_entries_account_time index.
+	rows, err := d.query(ctx, d.db, `SELECT currency, SUM(CASE WHEN direction = 'credit' THEN amount ELSE -amount END)
+		FROM ledger_entries WHERE account = ? AND created_at <= ? GROUP BY currency`, username, t.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var balance = map[string]int64{}
+	for rows.Next() {
+		var currency string
+		var amount int64
+		if err = rows.Scan(&currency, &amount); err != nil {
+			return nil, err
+		}
+		balance[currency] = amount
+	}
+	return balance, rows.Err()
+}
+
+// readBalances adds the account, currency and amount rows of query to
+// balances.
+func (d *sqlDB) readBalances(ctx context.Context, q querier, query string, balances map[string]map[string]int64) error {
+	rows, err := d.query(ctx, q, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var account, currency string
+		var amount int64
+		if err = rows.Scan(&account, &currency, &amount); err != nil {
+			return err
+		}
+		if balances[account] == nil {
+			balances[account] = map[string]int64{}
+		}
+		balances[account][currency] = amount
+	}
+	return rows.Err()
+}
+
+func (d *sqlDB) ReserveIdempotencyKey(ctx context.Context, key string, requestHash string, expiresAt time.Time) (*IdempotencyRecord, error) {
+	// An expired reservation is replaced, a live one is left alone and
+	// returned.
+	result, err := d.exec(ctx, d.db, `INSERT INTO idempotency_keys (idempotency_key, request_hash, expires_at) VALUES (?, ?, ?)
+		ON CONFLICT (idempotency_key) DO UPDATE SET request_hash = excluded.request_hash, done = FALSE,
+			status_code = 0, content_type = '', body = NULL, expires_at = excluded.expires_at
+		WHERE idempotency_keys.expires_at <= ?`, key, requestHash, expiresAt, time.Now().UTC())
+	err = changed(result, err, ErrKeyReserved)
+	if !errors.Is(err, ErrKeyReserved) {
+		return nil, err
+	}
+
+	var record = IdempotencyRecord{Key: key}
+	err = d.queryRow(ctx, d.db, `SELECT request_hash, done, status_code, content_type, body, expires_at
+		FROM idempotency_keys WHERE idempotency_key = ?`, key).Scan(
+		&record.RequestHash, &record.Done, &record.StatusCode, &record.ContentType, &record.Body, &record.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	record.ExpiresAt = record.ExpiresAt.UTC()
+	return &record, ErrKeyReserved
+}
+
+func (d *sqlDB) CompleteIdempotencyKey(ctx context.Context, key string, statusCode int, contentType string, body []byte) error {
+	// A key that expired while the request ran may be gone, there is
+	// nothing to replay to then.
+	_, err := d.exec(ctx, d.db, `UPDATE idempotency_keys SET done = TRUE, status_code = ?, content_type = ?, body = ?
+		WHERE idempotency_key = ?`, statusCode, contentType, body, key)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.exec(ctx, d.db, `DELETE FROM idempotency_keys WHERE expires_at <= ?`, time.Now().UTC())
+	return err
+}
+
+func (d *sqlDB) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	_, err := d.exec(ctx, d.db, `DELETE FROM idempotency_keys WHERE idempotency_key = ?`, key)
+	return err
+}
+
+func (d *sqlDB) SetupDatabase() error {
+	for _, statement := range d.dialect.setup {
+		if _, err := d.db.ExecContext(context.Background(), statement); err != nil {
+			return err
+		}
+	}
+	if err := d.migrate(context.Background()); err != nil {
+		return err
+	}
+	return d.hashTokens(context.Background())
+}
+
+// hashTokens replaces the tokens of the sessions stored in plaintext, before
+// tokens were hashed, with HashToken of them.
+func (d *sqlDB) hashTokens(ctx context.Context) error {
+	rows, err := d.query(ctx, d.db, `SELECT token FROM sessions WHERE token NOT LIKE ?`, tokenHashPrefix+"%")
+	if err != nil {
+		return err
+	}
+	var tokens []string
+	for rows.Next() {
+		var token string
+		if err = rows.Scan(&token); err != nil {
+			rows.Close()
+			return err
+		}
+		tokens = append(tokens, token)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, token := range tokens {
+		if _, err = d.exec(ctx, d.db, `UPDATE sessions SET token = ? WHERE token = ?`, HashToken(token), token); err != nil {
+			return err
+		}
+	}
+	if len(tokens) > 0 {
+		d.logger.Infof("Hashed %d auth tokens stored in plaintext", len(tokens))
+	}
+	return nil
+}
+
+func (d *sqlDB) Ping(ctx context.Context) error {
+	return d.db.PingContext(ctx)
+}
+
+func (d *sqlDB) Close() error {
+	return d.db.Close()
+}
+
+// transient is true for errors of a connection dropped mid-call, and for
+// those d.dialect deems transient.
+func (d *sqlDB) transient(err error) bool {
+	switch {
+	case errors.Is(err, driver.ErrBadConn), errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, syscall.ECONNRESET):
+		return true
+	}
+	return d.dialect.transient(err)
+}
@@ -0,0 +1,69 @@
+package tools
+
+import (
+	"errors"
+	"net/url"
+
+	"github.com/RashedMaaitah/goapi/internal/config"
+	log "github.com/sirupsen/logrus"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// MemoryPath is the database.path of a SQLite database that lives in
+// memory and is gone when the server stops.
+const MemoryPath = ":memory:"
+
+// sqliteDialect has no row locks: transactions begin immediate, which takes
+// the write lock of the whole database, so writes run one at a time and
+// wait for each other rather than failing with SQLITE_BUSY.
+var sqliteDialect = dialect{
+	name:        "sqlite",
+	placeholder: func(int) string { return "?" },
+	// Readers don't block the writer, nor it them. The journal mode can't
+	// change inside a transaction, so it isn't a migration.
+	setup:      []string{`PRAGMA journal_mode = WAL`},
+	migrations: "migrations/sqlite",
+	migrationsTable: `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		name       TEXT NOT NULL,
+		applied_at TIMESTAMP NOT NULL
+	)`,
+	transient: sqliteTransient,
+}
+
+// sqliteTransient is true for a database still locked once busy_timeout has
+// passed.
+func sqliteTransient(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	// The primary code is the low byte of an extended one.
+	switch sqliteErr.Code() & 0xff {
+	case sqlite3.SQLITE_BUSY, sqlite3.SQLITE_LOCKED:
+		return true
+	}
+	return false
+}
+
+func openSQLite(cfg config.DatabaseConfig, logger *log.Logger) (*sqlDB, error) {
+	var params = url.Values{
+		// Per connection, so they are set for every connection the pool
+		// opens rather than once.
+		"_pragma": {"busy_timeout(5000)", "foreign_keys(1)"},
+		"_txlock": {"immediate"},
+		// Times are all written in UTC as 2006-01-02 15:04:05.999999999-07:00,
+		// which compares in SQL in the order of the times.
+		"_time_format": {"sqlite"},
+	}
+	cfg.DSN = "file:" + cfg.Path + "?" + params.Encode()
+
+	// Every connection to :memory: opens a database of its own, so the pool
+	// is kept to the one connection holding the data.
+	if cfg.Path == MemoryPath {
+		cfg.MaxOpenConns, cfg.MaxIdleConns, cfg.ConnMaxLifetime = 1, 1, 0
+	}
+
+	return openSQL("sqlite", sqliteDialect, cfg, logger)
+}
@@ -0,0 +1,105 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// LastKnownGood keeps the last balances of each user that GetUserCoins, or
+// a write, returned, for read endpoints to serve when the database fails.
+// Entries don't expire: there is one for every user read since the server
+// started, and a deleted user's is dropped.
+type LastKnownGood struct {
+	mu      sync.Mutex
+	entries map[string]staleEntry
+}
+
+type staleEntry struct {
+	coinDetails CoinDetails
+	asOf        time.Time
+}
+
+func NewLastKnownGood() *LastKnownGood {
+	return &LastKnownGood{entries: map[string]staleEntry{}}
+}
+
+// Wrap returns database keeping what it returns of balances in l.
+func (l *LastKnownGood) Wrap(database Database) Database {
+	return &lastKnownGoodDB{Database: database, stale: l}
+}
+
+// Fallback returns the last balances of username and when they were read,
+// when err is a failure of the database rather than an answer of it, such
+// as ErrUserNotFound, and there are any. A nil LastKnownGood has none.
+func (l *LastKnownGood) Fallback(username string, err error) (*CoinDetails, time.Time, bool) {
+	if l == nil || errorResult(err) != "error" || errors.Is(err, context.Canceled) {
+		return nil, time.Time{}, false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry, ok := l.entries[username]
+	if !ok {
+		return nil, time.Time{}, false
+	}
+	return copyCoins(entry.coinDetails), entry.asOf, true
+}
+
+func (l *LastKnownGood) keep(coinDetails *CoinDetails, err error) {
+	if err != nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.entries[coinDetails.Username] = staleEntry{coinDetails: *copyCoins(*coinDetails), asOf: time.Now().UTC()}
+}
+
+type lastKnownGoodDB struct {
+	Database
+	stale *LastKnownGood
+}
+
+func (d *lastKnownGoodDB) GetUserCoins(ctx context.Context, username string) (*CoinDetails, error) {
+	coinDetails, err := d.Database.GetUserCoins(ctx, username)
+	d.stale.keep(coinDetails, err)
+	return coinDetails, err
+}
+
+func (d *lastKnownGoodDB) AdjustUserCoins(ctx context.Context, username string, currency string, delta int64, version int64) (*CoinDetails, error) {
+	coinDetails, err := d.Database.AdjustUserCoins(ctx, username, currency, delta, version)
+	d.stale.keep(coinDetails, err)
+	return coinDetails, err
+}
+
+func (d *lastKnownGoodDB) AdminAdjustCoins(ctx context.Context, username string, adjustment AdminAdjustment) (*CoinDetails, error) {
+	coinDetails, err := d.Database.AdminAdjustCoins(ctx, username, adjustment)
+	d.stale.keep(coinDetails, err)
+	return coinDetails, err
+}
+
+func (d *lastKnownGoodDB) SetOverdraft(ctx context.Context, username string, limit int64) (*CoinDetails, error) {
+	coinDetails, err := d.Database.SetOverdraft(ctx, username, limit)
+	d.stale.keep(coinDetails, err)
+	return coinDetails, err
+}
+
+func (d *lastKnownGoodDB) SetFrozen(ctx context.Context, username string, frozen bool, actor string, reason string) (*CoinDetails, error) {
+	coinDetails, err := d.Database.SetFrozen(ctx, username, frozen, actor, reason)
+	d.stale.keep(coinDetails, err)
+	return coinDetails, err
+}
+
+func (d *lastKnownGoodDB) DeleteUser(ctx context.Context, username string) error {
+	var err error = d.Database.DeleteUser(ctx, username)
+	if err == nil {
+		d.stale.mu.Lock()
+		delete(d.stale.entries, username)
+		d.stale.mu.Unlock()
+	}
+	return err
+}
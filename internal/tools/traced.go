@@ -0,0 +1,396 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/internal/ledger"
+	"github.com/RashedMaaitah/goapi/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracedDB creates a child span of the request span for every call.
+type tracedDB struct {
+	next   Database
+	tracer trace.Tracer
+}
+
+// Trace returns a Database creating a span for every call to
+// database.
+func Trace(database Database, tracer trace.Tracer) Database {
+	return &tracedDB{next: database, tracer: tracer}
+}
+
+func (d *tracedDB) start(ctx context.Context, method string, username string) (context.Context, trace.Span) {
+	var attrs = []attribute.KeyValue{attribute.String("db.operation.name", method)}
+	if username != "" {
+		attrs = append(attrs, attribute.String("goapi.user.hash", tracing.HashUsername(username)))
+	}
+
+	return d.tracer.Start(ctx, "db."+method, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+func (d *tracedDB) GetUserLoginDetails(ctx context.Context, username string) (*LoginDetails, error) {
+	ctx, span := d.start(ctx, "GetUserLoginDetails", username)
+	defer span.End()
+
+	loginDetails, err := d.next.GetUserLoginDetails(ctx, username)
+	recordError(span, err)
+	return loginDetails, err
+}
+
+func (d *tracedDB) GetUserCoins(ctx context.Context, username string) (*CoinDetails, error) {
+	ctx, span := d.start(ctx, "GetUserCoins", username)
+	defer span.End()
+
+	coinDetails, err := d.next.GetUserCoins(ctx, username)
+	recordError(span, err)
+	return coinDetails, err
+}
+
+func (d *tracedDB) AdjustUserCoins(ctx context.Context, username string, currency string, delta int64, version int64) (*CoinDetails, error) {
+	ctx, span := d.start(ctx, "AdjustUserCoins", username)
+	defer span.End()
+
+	coinDetails, err := d.next.AdjustUserCoins(ctx, username, currency, delta, version)
+	recordError(span, err)
+	return coinDetails, err
+}
+
+func (d *tracedDB) AdminAdjustCoins(ctx context.Context, username string, adjustment AdminAdjustment) (*CoinDetails, error) {
+	ctx, span := d.start(ctx, "AdminAdjustCoins", username)
+	defer span.End()
+
+	coinDetails, err := d.next.AdminAdjustCoins(ctx, username, adjustment)
+	recordError(span, err)
+	return coinDetails, err
+}
+
+func (d *tracedDB) SetOverdraft(ctx context.Context, username string, limit int64) (*CoinDetails, error) {
+	ctx, span := d.start(ctx, "SetOverdraft", username)
+	defer span.End()
+
+	coinDetails, err := d.next.SetOverdraft(ctx, username, limit)
+	recordError(span, err)
+	return coinDetails, err
+}
+
+func (d *tracedDB) SetFrozen(ctx context.Context, username string, frozen bool, actor string, reason string) (*CoinDetails, error) {
+	ctx, span := d.start(ctx, "SetFrozen", username)
+	defer span.End()
+
+	coinDetails, err := d.next.SetFrozen(ctx, username, frozen, actor, reason)
+	recordError(span, err)
+	return coinDetails, err
+}
+
+func (d *tracedDB) Transfer(ctx context.Context, from string, to string, currency string, amount int64) (*TransferDetails, error) {
+	ctx, span := d.start(ctx, "Transfer", from)
+	defer span.End()
+
+	transfer, err := d.next.Transfer(ctx, from, to, currency, amount)
+	recordError(span, err)
+	return transfer, err
+}
+
+func (d *tracedDB) ListTransactions(ctx context.Context, username string, limit int, before int64) ([]Transaction, error) {
+	ctx, span := d.start(ctx, "ListTransactions", username)
+	defer span.End()
+
+	transactions, err := d.next.ListTransactions(ctx, username, limit, before)
+	recordError(span, err)
+	return transactions, err
+}
+
+func (d *tracedDB) CreateUser(ctx context.Context, username string, passwordHash string) (*LoginDetails, error) {
+	ctx, span := d.start(ctx, "CreateUser", username)
+	defer span.End()
+
+	loginDetails, err := d.next.CreateUser(ctx, username, passwordHash)
+	recordError(span, err)
+	return loginDetails, err
+}
+
+func (d *tracedDB) ImportUsers(ctx context.Context, users []NewUser, atomic bool) ([]error, error) {
+	ctx, span := d.start(ctx, "ImportUsers", "")
+	defer span.End()
+
+	errs, err := d.next.ImportUsers(ctx, users, atomic)
+	recordError(span, err)
+	return errs, err
+}
+
+func (d *tracedDB) LedgerEntries(ctx context.Context, transactionID string) ([]ledger.Entry, error) {
+	ctx, span := d.start(ctx, "LedgerEntries", "")
+	defer span.End()
+
+	entries, err := d.next.LedgerEntries(ctx, transactionID)
+	recordError(span, err)
+	return entries, err
+}
+
+func (d *tracedDB) VerifyLedger(ctx context.Context) ([]ledger.Drift, error) {
+	ctx, span := d.start(ctx, "VerifyLedger", "")
+	defer span.End()
+
+	drift, err := d.next.VerifyLedger(ctx)
+	recordError(span, err)
+	return drift, err
+}
+
+func (d *tracedDB) ReserveIdempotencyKey(ctx context.Context, key string, requestHash string, expiresAt time.Time) (*IdempotencyRecord, error) {
+	ctx, span := d.start(ctx, "ReserveIdempotencyKey", "")
+	defer span.End()
+
+	record, err := d.next.ReserveIdempotencyKey(ctx, key, requestHash, expiresAt)
+	recordError(span, err)
+	return record, err
+}
+
+func (d *tracedDB) CompleteIdempotencyKey(ctx context.Context, key string, statusCode int, contentType string, body []byte) error {
+	ctx, span := d.start(ctx, "CompleteIdempotencyKey", "")
+	defer span.End()
+
+	err := d.next.CompleteIdempotencyKey(ctx, key, statusCode, contentType, body)
+	recordError(span, err)
+	return err
+}
+
+func (d *tracedDB) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	ctx, span := d.start(ctx, "ReleaseIdempotencyKey", "")
+	defer span.End()
+
+	err := d.next.ReleaseIdempotencyKey(ctx, key)
+	recordError(span, err)
+	return err
+}
+
+func (d *tracedDB) UpdateUser(ctx context.Context, username string, update UserUpdate) (*LoginDetails, error) {
+	ctx, span := d.start(ctx, "UpdateUser", username)
+	defer span.End()
+
+	loginDetails, err := d.next.UpdateUser(ctx, username, update)
+	recordError(span, err)
+	return loginDetails, err
+}
+
+func (d *tracedDB) UpdatePassword(ctx context.Context, username string, passwordHash string) error {
+	ctx, span := d.start(ctx, "UpdatePassword", username)
+	defer span.End()
+
+	var err error = d.next.UpdatePassword(ctx, username, passwordHash)
+	recordError(span, err)
+	return err
+}
+
+func (d *tracedDB) CreateSession(ctx context.Context, session Session, replace bool) error {
+	ctx, span := d.start(ctx, "CreateSession", session.Username)
+	defer span.End()
+
+	var err error = d.next.CreateSession(ctx, session, replace)
+	recordError(span, err)
+	return err
+}
+
+func (d *tracedDB) GetSession(ctx context.Context, token string) (*Session, error) {
+	ctx, span := d.start(ctx, "GetSession", "")
+	defer span.End()
+
+	session, err := d.next.GetSession(ctx, token)
+	recordError(span, err)
+	return session, err
+}
+
+func (d *tracedDB) DeleteSession(ctx context.Context, token string) error {
+	ctx, span := d.start(ctx, "DeleteSession", "")
+	defer span.End()
+
+	var err error = d.next.DeleteSession(ctx, token)
+	recordError(span, err)
+	return err
+}
+
+func (d *tracedDB) DeleteUserSessions(ctx context.Context, username string) error {
+	ctx, span := d.start(ctx, "DeleteUserSessions", username)
+	defer span.End()
+
+	var err error = d.next.DeleteUserSessions(ctx, username)
+	recordError(span, err)
+	return err
+}
+
+func (d *tracedDB) CreateAPIKey(ctx context.Context, key APIKey) error {
+	ctx, span := d.start(ctx, "CreateAPIKey", "")
+	defer span.End()
+
+	var err error = d.next.CreateAPIKey(ctx, key)
+	recordError(span, err)
+	return err
+}
+
+func (d *tracedDB) ListAPIKeys(ctx context.Context) ([]APIKey, error) {
+	ctx, span := d.start(ctx, "ListAPIKeys", "")
+	defer span.End()
+
+	keys, err := d.next.ListAPIKeys(ctx)
+	recordError(span, err)
+	return keys, err
+}
+
+func (d *tracedDB) GetAPIKey(ctx context.Context, hash string) (*APIKey, error) {
+	ctx, span := d.start(ctx, "GetAPIKey", "")
+	defer span.End()
+
+	key, err := d.next.GetAPIKey(ctx, hash)
+	recordError(span, err)
+	return key, err
+}
+
+func (d *tracedDB) TouchAPIKey(ctx context.Context, id string, at time.Time) error {
+	ctx, span := d.start(ctx, "TouchAPIKey", "")
+	defer span.End()
+
+	var err error = d.next.TouchAPIKey(ctx, id, at)
+	recordError(span, err)
+	return err
+}
+
+func (d *tracedDB) DeleteAPIKey(ctx context.Context, id string) error {
+	ctx, span := d.start(ctx, "DeleteAPIKey", "")
+	defer span.End()
+
+	var err error = d.next.DeleteAPIKey(ctx, id)
+	recordError(span, err)
+	return err
+}
+
+func (d *tracedDB) SearchUsers(ctx context.Context, filter UserFilter) ([]UserSummary, error) {
+	ctx, span := d.start(ctx, "SearchUsers", "")
+	defer span.End()
+
+	users, err := d.next.SearchUsers(ctx, filter)
+	recordError(span, err)
+	return users, err
+}
+
+func (d *tracedDB) GetStats(ctx context.Context, bounds []int64) (*Stats, error) {
+	ctx, span := d.start(ctx, "GetStats", "")
+	defer span.End()
+
+	stats, err := d.next.GetStats(ctx, bounds)
+	recordError(span, err)
+	return stats, err
+}
+
+func (d *tracedDB) AppendAudit(ctx context.Context, entry AuditEntry) (*AuditEntry, error) {
+	ctx, span := d.start(ctx, "AppendAudit", entry.Target)
+	defer span.End()
+
+	appended, err := d.next.AppendAudit(ctx, entry)
+	recordError(span, err)
+	return appended, err
+}
+
+func (d *tracedDB) ListAudit(ctx context.Context, filter AuditFilter) ([]AuditEntry, error) {
+	ctx, span := d.start(ctx, "ListAudit", filter.User)
+	defer span.End()
+
+	entries, err := d.next.ListAudit(ctx, filter)
+	recordError(span, err)
+	return entries, err
+}
+
+func (d *tracedDB) GetBalanceAsOf(ctx context.Context, username string, t time.Time) (map[string]int64, error) {
+	ctx, span := d.start(ctx, "GetBalanceAsOf", username)
+	defer span.End()
+
+	balance, err := d.next.GetBalanceAsOf(ctx, username, t)
+	recordError(span, err)
+	return balance, err
+}
+
+func (d *tracedDB) GetTopUsers(ctx context.Context, offset, limit int) ([]CoinDetails, error) {
+	ctx, span := d.start(ctx, "GetTopUsers", "")
+	defer span.End()
+
+	users, err := d.next.GetTopUsers(ctx, offset, limit)
+	recordError(span, err)
+	return users, err
+}
+
+func (d *tracedDB) GetUserIncludingDeleted(ctx context.Context, username string) (*LoginDetails, error) {
+	ctx, span := d.start(ctx, "GetUserIncludingDeleted", username)
+	defer span.End()
+
+	loginDetails, err := d.next.GetUserIncludingDeleted(ctx, username)
+	recordError(span, err)
+	return loginDetails, err
+}
+
+func (d *tracedDB) DeleteUser(ctx context.Context, username string) error {
+	ctx, span := d.start(ctx, "DeleteUser", username)
+	defer span.End()
+
+	var err error = d.next.DeleteUser(ctx, username)
+	recordError(span, err)
+	return err
+}
+
+func (d *tracedDB) RestoreUser(ctx context.Context, username string) error {
+	ctx, span := d.start(ctx, "RestoreUser", username)
+	defer span.End()
+
+	var err error = d.next.RestoreUser(ctx, username)
+	recordError(span, err)
+	return err
+}
+
+func (d *tracedDB) SetupDatabase() error {
+	_, span := d.start(context.Background(), "SetupDatabase", "")
+	defer span.End()
+
+	var err error = d.next.SetupDatabase()
+	recordError(span, err)
+	return err
+}
+
+func (d *tracedDB) Ping(ctx context.Context) error {
+	ctx, span := d.start(ctx, "Ping", "")
+	defer span.End()
+
+	var err error = d.next.Ping(ctx)
+	recordError(span, err)
+	return err
+}
+
+func (d *tracedDB) Close() error {
+	return d.next.Close()
+}
+
+func recordError(span trace.Span, err error) {
+	span.SetAttributes(attribute.String("goapi.db.result", errorResult(err)))
+	if isUnexpected(err) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+// isUnexpected reports whether err is a failure rather than one of the
+// outcomes callers are expected to handle.
+func isUnexpected(err error) bool {
+	return err != nil &&
+		!errors.Is(err, ErrUserNotFound) &&
+		!errors.Is(err, ErrInsufficientFunds) &&
+		!errors.Is(err, ErrSelfTransfer) &&
+		!errors.Is(err, ErrUserExists) &&
+		!errors.Is(err, ErrSessionNotFound) &&
+		!errors.Is(err, ErrAPIKeyNotFound) &&
+		!errors.Is(err, ErrUserDeleted) &&
+		!errors.Is(err, ErrSenderNotFound) &&
+		!errors.Is(err, ErrAccountFrozen) &&
+		!errors.Is(err, ErrVersionConflict) &&
+		!errors.Is(err, ErrKeyReserved)
+}
@@ -0,0 +1,94 @@
+package tracing
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/RashedMaaitah/goapi/internal/config"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.43.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const instrumentationName = "github.com/RashedMaaitah/goapi"
+
+// Tracing holds the tracer used by the middleware and the database
+// decorator. When tracing is disabled Enabled is false and nothing should
+// be instrumented at all.
+type Tracing struct {
+	Enabled    bool
+	Tracer     trace.Tracer
+	Propagator propagation.TextMapPropagator
+
+	provider *sdktrace.TracerProvider
+}
+
+// New sets up span export over OTLP/HTTP according to cfg.
+func New(cfg config.TracingConfig) (*Tracing, error) {
+	if !cfg.Enabled {
+		return &Tracing{
+			Tracer:     noop.NewTracerProvider().Tracer(instrumentationName),
+			Propagator: propagation.TraceContext{},
+		}, nil
+	}
+
+	var opts = []otlptracehttp.Option{otlptracehttp.WithEndpoint(cfg.Endpoint)}
+	if cfg.Insecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+
+	exporter, err := otlptracehttp.New(context.Background(), opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(cfg.ServiceName),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	var provider *sdktrace.TracerProvider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+
+	return &Tracing{
+		Enabled:    true,
+		Tracer:     provider.Tracer(instrumentationName),
+		Propagator: propagation.TraceContext{},
+		provider:   provider,
+	}, nil
+}
+
+// Shutdown flushes the spans that have not been exported yet.
+func (t *Tracing) Shutdown(ctx context.Context) error {
+	if t.provider == nil {
+		return nil
+	}
+	return t.provider.Shutdown(ctx)
+}
+
+// TraceID returns the ID of the trace ctx belongs to, or "" if there is none.
+func TraceID(ctx context.Context) string {
+	var sc trace.SpanContext = trace.SpanContextFromContext(ctx)
+	if !sc.HasTraceID() {
+		return ""
+	}
+	return sc.TraceID().String()
+}
+
+// HashUsername returns a short stable digest of username, so spans can be
+// correlated per user without exporting the username itself.
+func HashUsername(username string) string {
+	var sum = sha256.Sum256([]byte(username))
+	return hex.EncodeToString(sum[:8])
+}
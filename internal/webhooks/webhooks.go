@@ -0,0 +1,528 @@
+// Package webhooks delivers balance change events to URLs registered by
+// admins. Events are read from the event bus, queued and posted by
+// background workers, signed with the webhook's secret and retried with
+// exponential backoff.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/internal/config"
+	"github.com/RashedMaaitah/goapi/internal/events"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	SignatureHeader = "X-Goapi-Signature"
+	// SignatureV2Header signs the timestamp along with the body, so that a
+	// receiver can reject old requests; see SignV2.
+	SignatureV2Header = "X-Goapi-Signature-V2"
+	TimestampHeader   = "X-Goapi-Timestamp"
+	EventHeader       = "X-Goapi-Event"
+	// EventIDHeader is the same for every attempt and replay of an event,
+	// for receivers to process it once.
+	EventIDHeader  = "X-Goapi-Event-Id"
+	DeliveryHeader = "X-Goapi-Delivery"
+
+	maxBackoff = 5 * time.Minute
+	// maxResponse is how much of a response body an attempt keeps.
+	maxResponse = 512
+)
+
+// The status of a delivery.
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+)
+
+var (
+	ErrNotFound         = errors.New("webhook not found")
+	ErrDeliveryNotFound = errors.New("webhook delivery not found")
+	ErrNotReplayable    = errors.New("only a failed delivery can be replayed")
+	ErrInvalidURL       = errors.New("webhook URL must be an absolute http or https URL")
+	ErrClosed           = errors.New("webhook dispatcher is closed")
+	ErrQueueFull        = errors.New("webhook queue is full")
+)
+
+// Event is the JSON body of a delivery.
+type Event = events.Event
+
+type Webhook struct {
+	ID        string
+	URL       string
+	Secret    string
+	CreatedAt time.Time
+}
+
+// Delivery is the outcome of sending one event to one webhook, updated
+// after every attempt. StatusCode and Error are those of the last attempt,
+// History has them all.
+type Delivery struct {
+	ID         string
+	EventID    string
+	EventType  string
+	URL        string
+	Attempts   int
+	StatusCode int
+	Error      string
+	Delivered  bool
+	History    []Attempt
+	// ReplayOf is the ID of the delivery this one replays.
+	ReplayOf    string
+	CreatedAt   time.Time
+	CompletedAt time.Time
+
+	// event and body are what the attempts post, and a replay posts again.
+	event Event
+	body  []byte
+}
+
+// Status is StatusPending until the last attempt, then StatusDelivered or
+// StatusFailed.
+func (d Delivery) Status() string {
+	switch {
+	case d.CompletedAt.IsZero():
+		return StatusPending
+	case d.Delivered:
+		return StatusDelivered
+	default:
+		return StatusFailed
+	}
+}
+
+// Attempt is one request of a delivery. StatusCode and Response, the start
+// of the response body, are empty when there was no response.
+type Attempt struct {
+	Number     int
+	StatusCode int
+	Latency    time.Duration
+	Error      string
+	Response   string
+	At         time.Time
+}
+
+type job struct {
+	webhook  Webhook
+	event    Event
+	body     []byte
+	delivery string
+}
+
+// Dispatcher holds the registered webhooks and delivers events to them.
+type Dispatcher struct {
+	live   *config.Live
+	client *http.Client
+	logger *log.Logger
+
+	mu         sync.RWMutex
+	webhooks   map[string]Webhook
+	deliveries map[string][]Delivery
+	closed     bool
+
+	// events is the bus subscription that forward reads until Close.
+	events    *events.Subscription
+	forwarded chan struct{}
+
+	queue chan job
+	// stop cancels backoff waits and requests once Close runs out of time.
+	stop    context.Context
+	cancel  context.CancelFunc
+	workers sync.WaitGroup
+}
+
+// New subscribes to the events of all users on bus and starts the delivery
+// workers of the webhooks config in effect in live. The number of workers
+// and the queue size stay those; the retries, the timeout and the delivery
+// retention follow reloads.
+func New(live *config.Live, logger *log.Logger, bus *events.Bus) *Dispatcher {
+	var cfg config.WebhooksConfig = live.Get().Webhooks
+	ctx, cancel := context.WithCancel(context.Background())
+	var d = &Dispatcher{
+		live:       live,
+		client:     &http.Client{},
+		logger:     logger,
+		webhooks:   map[string]Webhook{},
+		deliveries: map[string][]Delivery{},
+		events:     bus.Subscribe("", cfg.QueueSize),
+		forwarded:  make(chan struct{}),
+		queue:      make(chan job, cfg.QueueSize),
+		stop:       ctx,
+		cancel:     cancel,
+	}
+
+	go d.forward()
+	for range cfg.Workers {
+		d.workers.Go(d.work)
+	}
+	return d
+}
+
+// forward publishes the events from the bus until the subscription is
+// closed. Publish logs the events that are dropped.
+func (d *Dispatcher) forward() {
+	defer close(d.forwarded)
+	for event := range d.events.C {
+		d.Publish(event)
+	}
+}
+
+// Register adds a webhook for rawURL. An empty secret is replaced by a
+// random one; either way it is returned only here and by List.
+func (d *Dispatcher) Register(rawURL string, secret string) (*Webhook, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, ErrInvalidURL
+	}
+	if secret == "" {
+		secret = randomID()
+	}
+
+	var webhook = Webhook{
+		ID:        randomID(),
+		URL:       parsed.String(),
+		Secret:    secret,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	d.mu.Lock()
+	d.webhooks[webhook.ID] = webhook
+	d.mu.Unlock()
+
+	return &webhook, nil
+}
+
+// List returns the webhooks, oldest first.
+func (d *Dispatcher) List() []Webhook {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	var webhooks = make([]Webhook, 0, len(d.webhooks))
+	for _, webhook := range d.webhooks {
+		webhooks = append(webhooks, webhook)
+	}
+	sort.Slice(webhooks, func(i, j int) bool { return webhooks[i].CreatedAt.Before(webhooks[j].CreatedAt) })
+	return webhooks
+}
+
+// Delete removes a webhook and its delivery log. Deliveries already queued
+// are still attempted.
+func (d *Dispatcher) Delete(id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.webhooks[id]; !ok {
+		return ErrNotFound
+	}
+	delete(d.webhooks, id)
+	delete(d.deliveries, id)
+	return nil
+}
+
+// Deliveries returns the latest deliveries of a webhook, newest first, of
+// status unless it is empty.
+func (d *Dispatcher) Deliveries(id string, status string) ([]Delivery, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if _, ok := d.webhooks[id]; !ok {
+		return nil, ErrNotFound
+	}
+
+	var entries = d.deliveries[id]
+	var deliveries = make([]Delivery, 0, len(entries))
+	for i := len(entries) - 1; i >= 0; i-- {
+		if status != "" && entries[i].Status() != status {
+			continue
+		}
+		var delivery Delivery = entries[i]
+		delivery.History = slices.Clone(delivery.History)
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, nil
+}
+
+// Replay queues the event of a failed delivery again, as a new delivery
+// with the same event ID and body, and returns it. Its requests are signed
+// with the time they are sent at.
+func (d *Dispatcher) Replay(webhookID string, deliveryID string) (*Delivery, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return nil, ErrClosed
+	}
+	webhook, ok := d.webhooks[webhookID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	var i int = slices.IndexFunc(d.deliveries[webhookID], func(delivery Delivery) bool { return delivery.ID == deliveryID })
+	if i < 0 {
+		return nil, ErrDeliveryNotFound
+	}
+	var original Delivery = d.deliveries[webhookID][i]
+	if original.Status() != StatusFailed {
+		return nil, ErrNotReplayable
+	}
+
+	var delivery = Delivery{
+		ID:        randomID(),
+		EventID:   original.EventID,
+		EventType: original.EventType,
+		URL:       webhook.URL,
+		ReplayOf:  original.ID,
+		CreatedAt: time.Now().UTC(),
+		event:     original.event,
+		body:      original.body,
+	}
+
+	select {
+	case d.queue <- job{webhook: webhook, event: delivery.event, body: delivery.body, delivery: delivery.ID}:
+	default:
+		return nil, ErrQueueFull
+	}
+	d.appendDelivery(webhookID, delivery)
+	return &delivery, nil
+}
+
+// Publish queues event for every webhook without waiting for delivery. The
+// event is dropped for the webhooks that don't fit in the queue.
+func (d *Dispatcher) Publish(event Event) error {
+	if event.ID == "" {
+		event.ID = randomID()
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now().UTC()
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return ErrClosed
+	}
+
+	for id, webhook := range d.webhooks {
+		var delivery = Delivery{
+			ID:        randomID(),
+			EventID:   event.ID,
+			EventType: event.Type,
+			URL:       webhook.URL,
+			CreatedAt: time.Now().UTC(),
+			event:     event,
+			body:      body,
+		}
+
+		select {
+		case d.queue <- job{webhook: webhook, event: event, body: body, delivery: delivery.ID}:
+		default:
+			err = ErrQueueFull
+			delivery.Error = ErrQueueFull.Error()
+			delivery.CompletedAt = delivery.CreatedAt
+			d.logger.Errorf("Dropped %s event %s for webhook %s: %v", event.Type, event.ID, id, ErrQueueFull)
+		}
+		d.appendDelivery(id, delivery)
+	}
+	return err
+}
+
+// Close stops accepting events and waits for the queued deliveries until
+// ctx is done. Deliveries still pending then are abandoned and logged.
+func (d *Dispatcher) Close(ctx context.Context) error {
+	d.events.Close()
+	<-d.forwarded
+
+	d.mu.Lock()
+	if !d.closed {
+		d.closed = true
+		close(d.queue)
+	}
+	d.mu.Unlock()
+
+	var done = make(chan struct{})
+	go func() {
+		d.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		d.cancel()
+		<-done
+		return fmt.Errorf("abandoned pending webhook deliveries: %w", ctx.Err())
+	}
+}
+
+func (d *Dispatcher) work() {
+	for j := range d.queue {
+		if d.stop.Err() != nil {
+			d.logger.Errorf("Webhook %s: abandoned %s event %s at shutdown", j.webhook.ID, j.event.Type, j.event.ID)
+			d.updateDelivery(j.webhook.ID, j.delivery, func(delivery *Delivery) {
+				delivery.Error = "abandoned at shutdown"
+				delivery.CompletedAt = time.Now().UTC()
+			})
+			continue
+		}
+		d.deliver(j)
+	}
+}
+
+// deliver attempts j up to cfg.MaxAttempts times, doubling the wait after
+// every failure, with the webhooks config in effect when it starts.
+func (d *Dispatcher) deliver(j job) {
+	var cfg config.WebhooksConfig = d.live.Get().Webhooks
+	var backoff time.Duration = cfg.InitialBackoff.Duration()
+
+	for attempt := 1; attempt <= cfg.MaxAttempts; attempt++ {
+		var start time.Time = time.Now()
+		status, response, err := d.send(j, cfg.Timeout.Duration())
+
+		var record = Attempt{
+			Number:     attempt,
+			StatusCode: status,
+			Latency:    time.Since(start),
+			Response:   response,
+			At:         start.UTC(),
+		}
+		if err != nil {
+			record.Error = err.Error()
+		}
+
+		d.updateDelivery(j.webhook.ID, j.delivery, func(delivery *Delivery) {
+			delivery.Attempts = attempt
+			delivery.StatusCode = status
+			delivery.Error = record.Error
+			delivery.History = append(delivery.History, record)
+			if err == nil || attempt == cfg.MaxAttempts {
+				delivery.Delivered = err == nil
+				delivery.CompletedAt = time.Now().UTC()
+			}
+		})
+
+		if err == nil {
+			return
+		}
+
+		d.logger.Warnf("Webhook %s: delivery of %s event %s failed (attempt %d of %d): %v", j.webhook.ID, j.event.Type, j.event.ID, attempt, cfg.MaxAttempts, err)
+		if attempt == cfg.MaxAttempts {
+			d.logger.Errorf("Webhook %s: giving up on %s event %s", j.webhook.ID, j.event.Type, j.event.ID)
+			return
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-d.stop.Done():
+			return
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// send posts j once and returns the status and the start of the body of
+// the response.
+func (d *Dispatcher) send(j job, timeout time.Duration) (int, string, error) {
+	ctx, cancel := context.WithTimeout(d.stop, timeout)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, j.webhook.URL, bytes.NewReader(j.body))
+	if err != nil {
+		return 0, "", err
+	}
+	var now time.Time = time.Now()
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(EventHeader, j.event.Type)
+	request.Header.Set(EventIDHeader, j.event.ID)
+	request.Header.Set(DeliveryHeader, j.delivery)
+	request.Header.Set(TimestampHeader, strconv.FormatInt(now.Unix(), 10))
+	request.Header.Set(SignatureHeader, Sign(j.webhook.Secret, j.body))
+	request.Header.Set(SignatureV2Header, SignV2(j.webhook.Secret, now, j.body))
+
+	response, err := d.client.Do(request)
+	if err != nil {
+		return 0, "", err
+	}
+	defer response.Body.Close()
+
+	// A body that can't be read doesn't fail the delivery, the status
+	// decides.
+	snippet, _ := io.ReadAll(io.LimitReader(response.Body, maxResponse))
+	var body string = strings.ToValidUTF8(string(snippet), "")
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode, body, fmt.Errorf("unexpected status %s", response.Status)
+	}
+	return response.StatusCode, body, nil
+}
+
+// Sign returns the signature header value for body: "sha256=" followed by
+// the hex HMAC-SHA256 of body keyed with secret.
+func Sign(secret string, body []byte) string {
+	var mac = hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignV2 returns the SignatureV2Header value for body sent at t:
+// "t=<unix seconds>,sha256=" followed by the hex HMAC-SHA256 of
+// "<unix seconds>.<body>" keyed with secret.
+func SignV2(secret string, t time.Time, body []byte) string {
+	var timestamp string = strconv.FormatInt(t.Unix(), 10)
+	var mac = hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "t=" + timestamp + ",sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// appendDelivery adds to the log of a webhook, dropping the oldest entries
+// past the delivery retention. d.mu must be held for writing.
+func (d *Dispatcher) appendDelivery(webhookID string, delivery Delivery) {
+	var retention int = d.live.Get().Webhooks.DeliveryRetention
+	var entries = append(d.deliveries[webhookID], delivery)
+	if len(entries) > retention {
+		entries = entries[len(entries)-retention:]
+	}
+	d.deliveries[webhookID] = entries
+}
+
+func (d *Dispatcher) updateDelivery(webhookID string, deliveryID string, update func(*Delivery)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var entries = d.deliveries[webhookID]
+	for i := range entries {
+		if entries[i].ID == deliveryID {
+			update(&entries[i])
+			return
+		}
+	}
+}
+
+func randomID() string {
+	var b = make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,257 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/internal/config"
+	"github.com/RashedMaaitah/goapi/internal/events"
+	log "github.com/sirupsen/logrus"
+)
+
+// received is a request a receiver got.
+type received struct {
+	header http.Header
+	body   string
+	at     time.Time
+}
+
+// receiver is a webhook URL answering its requests with statuses in turn,
+// the last one after those run out.
+type receiver struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	statuses []int
+	requests []received
+}
+
+func newReceiver(t *testing.T, delay time.Duration, statuses ...int) *receiver {
+	var rc = &receiver{statuses: statuses}
+	rc.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		time.Sleep(delay)
+
+		rc.mu.Lock()
+		rc.requests = append(rc.requests, received{header: r.Header.Clone(), body: string(body), at: time.Now()})
+		var status int = rc.statuses[0]
+		if len(rc.statuses) > 1 {
+			rc.statuses = rc.statuses[1:]
+		}
+		rc.mu.Unlock()
+
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(rc.Close)
+	return rc
+}
+
+func (rc *receiver) received() []received {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return append([]received(nil), rc.requests...)
+}
+
+// newDispatcher returns a Dispatcher of the default webhooks config, as
+// configure changes it, closed at the end of the test.
+func newDispatcher(t *testing.T, configure func(cfg *config.WebhooksConfig)) *Dispatcher {
+	var cfg config.Config = config.Default()
+	configure(&cfg.Webhooks)
+	var logger = log.New()
+	logger.SetOutput(io.Discard)
+
+	var d = New(config.NewLive(&cfg), logger, events.NewBus())
+	t.Cleanup(func() { d.Close(context.Background()) })
+	return d
+}
+
+// completed waits for the deliveries of webhook to be all done, and
+// returns them, newest first.
+func completed(t *testing.T, d *Dispatcher, webhook string, count int) []Delivery {
+	t.Helper()
+
+	var deadline = time.Now().Add(5 * time.Second)
+	for {
+		deliveries, err := d.Deliveries(webhook, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var pending int
+		for _, delivery := range deliveries {
+			if delivery.Status() == StatusPending {
+				pending++
+			}
+		}
+		if len(deliveries) == count && pending == 0 {
+			return deliveries
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("deliveries = %+v, want %d completed", deliveries, count)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestSign(t *testing.T) {
+	var body = []byte("The quick brown fox jumps over the lazy dog")
+
+	if got, want := Sign("key", body), "sha256=f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8"; got != want {
+		t.Errorf("Sign = %s, want %s", got, want)
+	}
+	if got, want := SignV2("key", time.Unix(1700000000, 999), body), "t=1700000000,sha256=2f658d6aef4f246e91cd741bbcded7479e9605f9d41c9e248122a117e0e1765b"; got != want {
+		t.Errorf("SignV2 = %s, want %s", got, want)
+	}
+}
+
+func TestDeliverRetriesWithBackoff(t *testing.T) {
+	const backoff = 20 * time.Millisecond
+	var d = newDispatcher(t, func(cfg *config.WebhooksConfig) {
+		cfg.MaxAttempts = 3
+		cfg.InitialBackoff = config.Duration(backoff)
+	})
+
+	t.Run("until delivered", func(t *testing.T) {
+		var rc = newReceiver(t, 0, http.StatusInternalServerError, http.StatusBadGateway, http.StatusOK)
+		webhook, _ := d.Register(rc.URL, "secret")
+		d.Publish(Event{ID: "event-1", Type: "deposit", Username: "alex", Amount: 5})
+
+		var delivery Delivery = completed(t, d, webhook.ID, 1)[0]
+		if delivery.Status() != StatusDelivered || delivery.Attempts != 3 || delivery.StatusCode != http.StatusOK || delivery.Error != "" {
+			t.Errorf("delivery = %+v, want delivered with a 200 on the third attempt", delivery)
+		}
+		for i, status := range []int{http.StatusInternalServerError, http.StatusBadGateway, http.StatusOK} {
+			if delivery.History[i].Number != i+1 || delivery.History[i].StatusCode != status {
+				t.Errorf("attempt %d = %+v, want number %d answered %d", i, delivery.History[i], i+1, status)
+			}
+		}
+
+		var requests = rc.received()
+		for i, request := range requests {
+			if request.header.Get(EventIDHeader) != "event-1" || request.header.Get(DeliveryHeader) != delivery.ID {
+				t.Errorf("request %d is of the event %q and delivery %q, want event-1 and %s", i, request.header.Get(EventIDHeader), request.header.Get(DeliveryHeader), delivery.ID)
+			}
+			if request.header.Get(SignatureHeader) != Sign("secret", []byte(request.body)) {
+				t.Errorf("request %d is signed %s, want %s", i, request.header.Get(SignatureHeader), Sign("secret", []byte(request.body)))
+			}
+		}
+		// The waits double: backoff, then twice that.
+		for i, wait := range []time.Duration{backoff, 2 * backoff} {
+			if gap := requests[i+1].at.Sub(requests[i].at); gap < wait {
+				t.Errorf("attempt %d came %s after the one before, want at least %s", i+2, gap, wait)
+			}
+		}
+	})
+
+	t.Run("until giving up", func(t *testing.T) {
+		var rc = newReceiver(t, 0, http.StatusServiceUnavailable)
+		webhook, _ := d.Register(rc.URL, "secret")
+		d.Publish(Event{Type: "deposit", Username: "alex", Amount: 5})
+
+		var delivery Delivery = completed(t, d, webhook.ID, 1)[0]
+		if delivery.Status() != StatusFailed || delivery.Attempts != 3 || delivery.StatusCode != http.StatusServiceUnavailable || delivery.Error == "" {
+			t.Errorf("delivery = %+v, want failed with a 503 after 3 attempts", delivery)
+		}
+		if requests := rc.received(); len(requests) != 3 {
+			t.Errorf("received %d requests, want 3", len(requests))
+		}
+	})
+}
+
+func TestCloseDrainsQueue(t *testing.T) {
+	const count = 5
+	var d = newDispatcher(t, func(cfg *config.WebhooksConfig) { cfg.Workers = 1 })
+	var rc = newReceiver(t, 10*time.Millisecond, http.StatusOK)
+	webhook, _ := d.Register(rc.URL, "secret")
+
+	for i := 0; i < count; i++ {
+		if err := d.Publish(Event{Type: "deposit", Username: "alex", Amount: int64(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := d.Close(ctx); err != nil {
+		t.Fatalf("Close = %v, want the queue drained", err)
+	}
+
+	if requests := rc.received(); len(requests) != count {
+		t.Errorf("received %d requests, want %d", len(requests), count)
+	}
+	deliveries, _ := d.Deliveries(webhook.ID, StatusDelivered)
+	if len(deliveries) != count {
+		t.Errorf("%d deliveries delivered, want %d", len(deliveries), count)
+	}
+	if err := d.Publish(Event{Type: "deposit"}); !errors.Is(err, ErrClosed) {
+		t.Errorf("Publish after Close = %v, want ErrClosed", err)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	var d = newDispatcher(t, func(cfg *config.WebhooksConfig) { cfg.MaxAttempts = 1 })
+	var rc = newReceiver(t, 0, http.StatusInternalServerError, http.StatusOK)
+	webhook, _ := d.Register(rc.URL, "secret")
+	d.Publish(Event{ID: "event-1", Type: "deposit", Username: "alex", Amount: 5})
+	var original Delivery = completed(t, d, webhook.ID, 1)[0]
+
+	// Into the next second, for the timestamps to differ.
+	time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+	replay, err := d.Replay(webhook.ID, original.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replay.ID == original.ID || replay.EventID != "event-1" || replay.ReplayOf != original.ID {
+		t.Errorf("replay = %+v, want a new delivery of event-1 replaying %s", replay, original.ID)
+	}
+	if delivered := completed(t, d, webhook.ID, 2)[0]; delivered.ID != replay.ID || delivered.Status() != StatusDelivered {
+		t.Errorf("newest delivery = %+v, want the replay delivered", delivered)
+	}
+
+	var requests = rc.received()
+	var first, again = requests[0], requests[1]
+	if again.body != first.body || again.header.Get(EventIDHeader) != "event-1" {
+		t.Errorf("replayed event %q with %s, want event-1 with %s", again.header.Get(EventIDHeader), again.body, first.body)
+	}
+	var timestamp int64 = mustParseInt(t, again.header.Get(TimestampHeader))
+	if timestamp <= mustParseInt(t, first.header.Get(TimestampHeader)) {
+		t.Errorf("replayed with the timestamp %d, want a later one than %s", timestamp, first.header.Get(TimestampHeader))
+	}
+	if signature := SignV2("secret", time.Unix(timestamp, 0), []byte(again.body)); again.header.Get(SignatureV2Header) != signature {
+		t.Errorf("replay is signed %s, want %s", again.header.Get(SignatureV2Header), signature)
+	}
+
+	if _, err := d.Replay(webhook.ID, replay.ID); !errors.Is(err, ErrNotReplayable) {
+		t.Errorf("Replay of a delivered delivery = %v, want ErrNotReplayable", err)
+	}
+}
+
+func mustParseInt(t *testing.T, s string) int64 {
+	t.Helper()
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestDeliveryRetention(t *testing.T) {
+	var d = newDispatcher(t, func(cfg *config.WebhooksConfig) { cfg.DeliveryRetention = 3 })
+	var rc = newReceiver(t, 0, http.StatusOK)
+	webhook, _ := d.Register(rc.URL, "secret")
+
+	for i := 1; i <= 5; i++ {
+		d.Publish(Event{ID: "event-" + strconv.Itoa(i), Type: "deposit", Username: "alex"})
+	}
+	var deliveries = completed(t, d, webhook.ID, 3)
+	for i, want := range []string{"event-5", "event-4", "event-3"} {
+		if deliveries[i].EventID != want {
+			t.Errorf("delivery %d is of %s, want %s", i, deliveries[i].EventID, want)
+		}
+	}
+}
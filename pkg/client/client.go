@@ -0,0 +1,257 @@
+// Package client is a Go client for the v1 HTTP API.
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/api"
+)
+
+const (
+	defaultUserAgent = "goapi-client"
+	defaultBackoff   = 200 * time.Millisecond
+	maxBackoff       = 5 * time.Second
+)
+
+// Option customizes a Client.
+type Option func(*Client)
+
+// WithHTTPClient sends the requests through httpClient instead of
+// http.DefaultClient.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithRetries retries a request up to n more times when it is answered
+// with 429 or a 5xx status, waiting backoff before the first retry and
+// twice as long before each one after. A Retry-After header takes
+// precedence.
+func WithRetries(n int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries = n
+		c.backoff = backoff
+	}
+}
+
+// WithUserAgent sets the User-Agent header of every request.
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) {
+		c.userAgent = userAgent
+	}
+}
+
+// Client calls the API as the user the token was issued to.
+type Client struct {
+	baseURL    *url.URL
+	token      string
+	httpClient *http.Client
+	userAgent  string
+	retries    int
+	backoff    time.Duration
+}
+
+// Error is an error response of the API.
+type Error struct {
+	StatusCode int
+	Code       string
+	Message    string
+	RequestID  string
+	TraceID    string
+}
+
+func (e *Error) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("%d %s: %s", e.StatusCode, e.Code, e.Message)
+	}
+	return fmt.Sprintf("%d: %s", e.StatusCode, e.Message)
+}
+
+// NewClient returns a client for the API at baseURL, such as
+// "http://localhost:8000".
+func NewClient(baseURL string, token string, opts ...Option) (*Client, error) {
+	parsed, err := url.Parse(strings.TrimRight(baseURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid base URL: %w", err)
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid base URL %q: must be an absolute http or https URL", baseURL)
+	}
+
+	var c = &Client{
+		baseURL:    parsed,
+		token:      token,
+		httpClient: http.DefaultClient,
+		userAgent:  defaultUserAgent,
+		backoff:    defaultBackoff,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// CoinBalance returns the balance of username, who has to be the owner of
+// the token unless it is an admin's, or of the owner when it is "".
+func (c *Client) CoinBalance(ctx context.Context, username string) (*api.CoinBalanceResponse, error) {
+	var path string = "/v1/account/coins"
+	if username != "" {
+		path = "/v1/users/" + url.PathEscape(username) + "/coins"
+	}
+
+	var response api.CoinBalanceResponse
+	err := c.do(ctx, http.MethodGet, path, nil, nil, &response)
+	if err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// Deposit adds amount coins and returns the new balance.
+func (c *Client) Deposit(ctx context.Context, amount int64) (*api.CoinBalanceResponse, error) {
+	var response api.CoinBalanceResponse
+	err := c.do(ctx, http.MethodPost, "/v1/account/coins/deposit", nil, api.CoinAmountParams{Amount: api.Amount(amount)}, &response)
+	if err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// Withdraw removes amount coins and returns the new balance.
+func (c *Client) Withdraw(ctx context.Context, amount int64) (*api.CoinBalanceResponse, error) {
+	var response api.CoinBalanceResponse
+	err := c.do(ctx, http.MethodPost, "/v1/account/coins/withdraw", nil, api.CoinAmountParams{Amount: api.Amount(amount)}, &response)
+	if err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// Transfer moves amount coins to the user to.
+func (c *Client) Transfer(ctx context.Context, to string, amount int64) (*api.TransferResponse, error) {
+	var response api.TransferResponse
+	err := c.do(ctx, http.MethodPost, "/v1/account/coins/transfer", nil, api.TransferParams{To: to, Amount: api.Amount(amount)}, &response)
+	if err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// do sends a request and decodes the response into out, or the error body
+// into an *Error. Requests with a body carry an Idempotency-Key, so a retry
+// of one the server did handle is answered with the original response.
+func (c *Client) do(ctx context.Context, method string, path string, query url.Values, in any, out any) error {
+	var body []byte
+	if in != nil {
+		var err error
+		body, err = json.Marshal(in)
+		if err != nil {
+			return err
+		}
+	}
+
+	var target = c.baseURL.JoinPath(path)
+	target.RawQuery = query.Encode()
+
+	var idempotencyKey string
+	if in != nil {
+		idempotencyKey = newKey()
+	}
+
+	var backoff time.Duration = c.backoff
+	for attempt := 0; ; attempt++ {
+		request, err := http.NewRequestWithContext(ctx, method, target.String(), bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		if c.token != "" {
+			request.Header.Set("Authorization", "Bearer "+c.token)
+		}
+		request.Header.Set("User-Agent", c.userAgent)
+		request.Header.Set("Accept", "application/json")
+		if in != nil {
+			request.Header.Set("Content-Type", "application/json")
+			request.Header.Set("Idempotency-Key", idempotencyKey)
+		}
+
+		response, err := c.httpClient.Do(request)
+		if err != nil {
+			return err
+		}
+
+		if retryable(response.StatusCode) && attempt < c.retries {
+			var wait time.Duration = retryAfter(response, backoff)
+			io.Copy(io.Discard, response.Body)
+			response.Body.Close()
+
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			backoff = min(backoff*2, maxBackoff)
+			continue
+		}
+
+		defer response.Body.Close()
+		return decode(response, out)
+	}
+}
+
+func decode(response *http.Response, out any) error {
+	if response.StatusCode >= 200 && response.StatusCode <= 299 {
+		return json.NewDecoder(response.Body).Decode(out)
+	}
+
+	var body api.Error
+	if err := json.NewDecoder(response.Body).Decode(&body); err != nil || body.Message == "" {
+		return &Error{StatusCode: response.StatusCode, Message: http.StatusText(response.StatusCode)}
+	}
+
+	return &Error{
+		StatusCode: response.StatusCode,
+		Code:       body.Code,
+		Message:    body.Message,
+		RequestID:  body.RequestID,
+		TraceID:    body.TraceID,
+	}
+}
+
+func retryable(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+// retryAfter returns the wait the server asked for in seconds, or fallback.
+func retryAfter(response *http.Response, fallback time.Duration) time.Duration {
+	seconds, err := strconv.Atoi(response.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return fallback
+	}
+	return min(time.Duration(seconds)*time.Second, maxBackoff)
+}
+
+// IsCode reports whether err is an *Error with the given Code, one of the
+// api.Code constants such as api.CodeInsufficientFunds.
+func IsCode(err error, code string) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.Code == code
+}
+
+func newKey() string {
+	var b = make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,147 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/api"
+	"github.com/RashedMaaitah/goapi/internal/apitest"
+	"github.com/RashedMaaitah/goapi/pkg/client"
+)
+
+func newClient(t *testing.T, baseURL string, token string, opts ...client.Option) *client.Client {
+	t.Helper()
+
+	c, err := client.NewClient(baseURL, token, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestClientAgainstTheHandlers(t *testing.T) {
+	var s = apitest.New(t)
+	var c = newClient(t, s.URL, s.Token("alex"))
+	var ctx = context.Background()
+
+	balance, err := c.CoinBalance(ctx, "")
+	if err != nil || balance.Balance != 1000 {
+		t.Fatalf("CoinBalance = %+v, %v, want 1000", balance, err)
+	}
+
+	balance, err = c.Deposit(ctx, 100)
+	if err != nil || balance.Balance != 1100 {
+		t.Fatalf("Deposit = %+v, %v, want 1100", balance, err)
+	}
+
+	transfer, err := c.Transfer(ctx, "maria", 50)
+	if err != nil || transfer.Balance != 1050 || transfer.TransferID == "" {
+		t.Fatalf("Transfer = %+v, %v, want 1050 and an ID", transfer, err)
+	}
+
+	balance, err = newClient(t, s.URL, s.Token("maria")).CoinBalance(ctx, "maria")
+	if err != nil || balance.Balance != 2550 {
+		t.Fatalf("CoinBalance of maria = %+v, %v, want 2550", balance, err)
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	var s = apitest.New(t)
+	var ctx = context.Background()
+
+	_, err := newClient(t, s.URL, s.Token("alex")).Transfer(ctx, "maria", 5000)
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusConflict || apiErr.RequestID == "" {
+		t.Fatalf("Transfer of too much = %v, want a 409 *client.Error with a request ID", err)
+	}
+	if !client.IsCode(err, api.CodeInsufficientFunds) {
+		t.Errorf("code = %q, want %q", apiErr.Code, api.CodeInsufficientFunds)
+	}
+
+	_, err = newClient(t, s.URL, "not-a-token").CoinBalance(ctx, "")
+	if !client.IsCode(err, api.CodeInvalidToken) {
+		t.Errorf("CoinBalance with a bad token = %v, want %s", err, api.CodeInvalidToken)
+	}
+}
+
+func TestClientRetries(t *testing.T) {
+	var calls atomic.Int32
+	var mu sync.Mutex
+	var keys = map[string]bool{}
+	var server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		keys[r.Header.Get("Idempotency-Key")] = true
+		mu.Unlock()
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"Balance":"7"}`))
+	}))
+	defer server.Close()
+
+	balance, err := newClient(t, server.URL, "token", client.WithRetries(2, time.Millisecond)).Deposit(context.Background(), 7)
+	if err != nil || balance.Balance != 7 {
+		t.Fatalf("Deposit = %+v, %v, want 7 after the retries", balance, err)
+	}
+	mu.Lock()
+	var distinct int = len(keys)
+	mu.Unlock()
+	if calls.Load() != 3 || distinct != 1 {
+		t.Errorf("%d requests with %d Idempotency-Keys, want 3 with the same one", calls.Load(), distinct)
+	}
+
+	calls.Store(0)
+	_, err = newClient(t, server.URL, "token").Deposit(context.Background(), 7)
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Deposit without retries = %v, want the 503", err)
+	}
+}
+
+func TestClientOptionsAndCancellation(t *testing.T) {
+	var userAgents = make(chan string, 1)
+	var server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgents <- r.UserAgent()
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	var transport = &countingTransport{}
+	var c = newClient(t, server.URL, "token", client.WithUserAgent("ops-tool/1.0"), client.WithHTTPClient(&http.Client{Transport: transport}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	var started = time.Now()
+	_, err := c.CoinBalance(ctx, "")
+
+	if !errors.Is(err, context.DeadlineExceeded) || time.Since(started) > time.Second {
+		t.Fatalf("CoinBalance = %v after %s, want the deadline at once", err, time.Since(started))
+	}
+	if userAgent := <-userAgents; userAgent != "ops-tool/1.0" || transport.requests.Load() != 1 {
+		t.Errorf("User-Agent %q through %d requests of the custom client", userAgent, transport.requests.Load())
+	}
+}
+
+func TestNewClientRejectsRelativeURLs(t *testing.T) {
+	for _, baseURL := range []string{"localhost:8000", "/v1", "ftp://example.com"} {
+		if _, err := client.NewClient(baseURL, "token"); err == nil {
+			t.Errorf("NewClient(%q) succeeded", baseURL)
+		}
+	}
+}
+
+type countingTransport struct {
+	requests atomic.Int32
+}
+
+func (t *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	t.requests.Add(1)
+	return http.DefaultTransport.RoundTrip(r)
+}
@@ -0,0 +1,395 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        (unknown)
+// source: coins.proto
+
+package pb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Currency defaults to "coins" wherever it is optional.
+type GetCoinBalanceRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Currency      string                 `protobuf:"bytes,1,opt,name=currency,proto3" json:"currency,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetCoinBalanceRequest) Reset() {
+	*x = GetCoinBalanceRequest{}
+	mi := &file_coins_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetCoinBalanceRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetCoinBalanceRequest) ProtoMessage() {}
+
+func (x *GetCoinBalanceRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_coins_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetCoinBalanceRequest.ProtoReflect.Descriptor instead.
+func (*GetCoinBalanceRequest) Descriptor() ([]byte, []int) {
+	return file_coins_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *GetCoinBalanceRequest) GetCurrency() string {
+	if x != nil {
+		return x.Currency
+	}
+	return ""
+}
+
+type AmountRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Amount        int64                  `protobuf:"varint,1,opt,name=amount,proto3" json:"amount,omitempty"`
+	Currency      string                 `protobuf:"bytes,2,opt,name=currency,proto3" json:"currency,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AmountRequest) Reset() {
+	*x = AmountRequest{}
+	mi := &file_coins_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AmountRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AmountRequest) ProtoMessage() {}
+
+func (x *AmountRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_coins_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AmountRequest.ProtoReflect.Descriptor instead.
+func (*AmountRequest) Descriptor() ([]byte, []int) {
+	return file_coins_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *AmountRequest) GetAmount() int64 {
+	if x != nil {
+		return x.Amount
+	}
+	return 0
+}
+
+func (x *AmountRequest) GetCurrency() string {
+	if x != nil {
+		return x.Currency
+	}
+	return ""
+}
+
+type TransferRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	To            string                 `protobuf:"bytes,1,opt,name=to,proto3" json:"to,omitempty"`
+	Amount        int64                  `protobuf:"varint,2,opt,name=amount,proto3" json:"amount,omitempty"`
+	Currency      string                 `protobuf:"bytes,3,opt,name=currency,proto3" json:"currency,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TransferRequest) Reset() {
+	*x = TransferRequest{}
+	mi := &file_coins_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TransferRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TransferRequest) ProtoMessage() {}
+
+func (x *TransferRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_coins_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TransferRequest.ProtoReflect.Descriptor instead.
+func (*TransferRequest) Descriptor() ([]byte, []int) {
+	return file_coins_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *TransferRequest) GetTo() string {
+	if x != nil {
+		return x.To
+	}
+	return ""
+}
+
+func (x *TransferRequest) GetAmount() int64 {
+	if x != nil {
+		return x.Amount
+	}
+	return 0
+}
+
+func (x *TransferRequest) GetCurrency() string {
+	if x != nil {
+		return x.Currency
+	}
+	return ""
+}
+
+// Balance is in currency; balances lists every currency.
+type BalanceResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Balance       int64                  `protobuf:"varint,1,opt,name=balance,proto3" json:"balance,omitempty"`
+	Currency      string                 `protobuf:"bytes,2,opt,name=currency,proto3" json:"currency,omitempty"`
+	Balances      map[string]int64       `protobuf:"bytes,3,rep,name=balances,proto3" json:"balances,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"varint,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BalanceResponse) Reset() {
+	*x = BalanceResponse{}
+	mi := &file_coins_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BalanceResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BalanceResponse) ProtoMessage() {}
+
+func (x *BalanceResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_coins_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BalanceResponse.ProtoReflect.Descriptor instead.
+func (*BalanceResponse) Descriptor() ([]byte, []int) {
+	return file_coins_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *BalanceResponse) GetBalance() int64 {
+	if x != nil {
+		return x.Balance
+	}
+	return 0
+}
+
+func (x *BalanceResponse) GetCurrency() string {
+	if x != nil {
+		return x.Currency
+	}
+	return ""
+}
+
+func (x *BalanceResponse) GetBalances() map[string]int64 {
+	if x != nil {
+		return x.Balances
+	}
+	return nil
+}
+
+// Balance is the sender's balance after the transfer.
+type TransferResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	TransferId    string                 `protobuf:"bytes,1,opt,name=transfer_id,json=transferId,proto3" json:"transfer_id,omitempty"`
+	Currency      string                 `protobuf:"bytes,2,opt,name=currency,proto3" json:"currency,omitempty"`
+	Balance       int64                  `protobuf:"varint,3,opt,name=balance,proto3" json:"balance,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TransferResponse) Reset() {
+	*x = TransferResponse{}
+	mi := &file_coins_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TransferResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TransferResponse) ProtoMessage() {}
+
+func (x *TransferResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_coins_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TransferResponse.ProtoReflect.Descriptor instead.
+func (*TransferResponse) Descriptor() ([]byte, []int) {
+	return file_coins_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *TransferResponse) GetTransferId() string {
+	if x != nil {
+		return x.TransferId
+	}
+	return ""
+}
+
+func (x *TransferResponse) GetCurrency() string {
+	if x != nil {
+		return x.Currency
+	}
+	return ""
+}
+
+func (x *TransferResponse) GetBalance() int64 {
+	if x != nil {
+		return x.Balance
+	}
+	return 0
+}
+
+var File_coins_proto protoreflect.FileDescriptor
+
+const file_coins_proto_rawDesc = "" +
+	"\n" +
+	"\vcoins.proto\x12\bgoapi.v1\"3\n" +
+	"\x15GetCoinBalanceRequest\x12\x1a\n" +
+	"\bcurrency\x18\x01 \x01(\tR\bcurrency\"C\n" +
+	"\rAmountRequest\x12\x16\n" +
+	"\x06amount\x18\x01 \x01(\x03R\x06amount\x12\x1a\n" +
+	"\bcurrency\x18\x02 \x01(\tR\bcurrency\"U\n" +
+	"\x0fTransferRequest\x12\x0e\n" +
+	"\x02to\x18\x01 \x01(\tR\x02to\x12\x16\n" +
+	"\x06amount\x18\x02 \x01(\x03R\x06amount\x12\x1a\n" +
+	"\bcurrency\x18\x03 \x01(\tR\bcurrency\"\xc9\x01\n" +
+	"\x0fBalanceResponse\x12\x18\n" +
+	"\abalance\x18\x01 \x01(\x03R\abalance\x12\x1a\n" +
+	"\bcurrency\x18\x02 \x01(\tR\bcurrency\x12C\n" +
+	"\bbalances\x18\x03 \x03(\v2'.goapi.v1.BalanceResponse.BalancesEntryR\bbalances\x1a;\n" +
+	"\rBalancesEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\x03R\x05value:\x028\x01\"i\n" +
+	"\x10TransferResponse\x12\x1f\n" +
+	"\vtransfer_id\x18\x01 \x01(\tR\n" +
+	"transferId\x12\x1a\n" +
+	"\bcurrency\x18\x02 \x01(\tR\bcurrency\x12\x18\n" +
+	"\abalance\x18\x03 \x01(\x03R\abalance2\x9d\x02\n" +
+	"\vCoinService\x12L\n" +
+	"\x0eGetCoinBalance\x12\x1f.goapi.v1.GetCoinBalanceRequest\x1a\x19.goapi.v1.BalanceResponse\x12=\n" +
+	"\aDeposit\x12\x17.goapi.v1.AmountRequest\x1a\x19.goapi.v1.BalanceResponse\x12>\n" +
+	"\bWithdraw\x12\x17.goapi.v1.AmountRequest\x1a\x19.goapi.v1.BalanceResponse\x12A\n" +
+	"\bTransfer\x12\x19.goapi.v1.TransferRequest\x1a\x1a.goapi.v1.TransferResponseB'Z%github.com/RashedMaaitah/goapi/pkg/pbb\x06proto3"
+
+var (
+	file_coins_proto_rawDescOnce sync.Once
+	file_coins_proto_rawDescData []byte
+)
+
+func file_coins_proto_rawDescGZIP() []byte {
+	file_coins_proto_rawDescOnce.Do(func() {
+		file_coins_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_coins_proto_rawDesc), len(file_coins_proto_rawDesc)))
+	})
+	return file_coins_proto_rawDescData
+}
+
+var file_coins_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
+var file_coins_proto_goTypes = []any{
+	(*GetCoinBalanceRequest)(nil), // 0: goapi.v1.GetCoinBalanceRequest
+	(*AmountRequest)(nil),         // 1: goapi.v1.AmountRequest
+	(*TransferRequest)(nil),       // 2: goapi.v1.TransferRequest
+	(*BalanceResponse)(nil),       // 3: goapi.v1.BalanceResponse
+	(*TransferResponse)(nil),      // 4: goapi.v1.TransferResponse
+	nil,                           // 5: goapi.v1.BalanceResponse.BalancesEntry
+}
+var file_coins_proto_depIdxs = []int32{
+	5, // 0: goapi.v1.BalanceResponse.balances:type_name -> goapi.v1.BalanceResponse.BalancesEntry
+	0, // 1: goapi.v1.CoinService.GetCoinBalance:input_type -> goapi.v1.GetCoinBalanceRequest
+	1, // 2: goapi.v1.CoinService.Deposit:input_type -> goapi.v1.AmountRequest
+	1, // 3: goapi.v1.CoinService.Withdraw:input_type -> goapi.v1.AmountRequest
+	2, // 4: goapi.v1.CoinService.Transfer:input_type -> goapi.v1.TransferRequest
+	3, // 5: goapi.v1.CoinService.GetCoinBalance:output_type -> goapi.v1.BalanceResponse
+	3, // 6: goapi.v1.CoinService.Deposit:output_type -> goapi.v1.BalanceResponse
+	3, // 7: goapi.v1.CoinService.Withdraw:output_type -> goapi.v1.BalanceResponse
+	4, // 8: goapi.v1.CoinService.Transfer:output_type -> goapi.v1.TransferResponse
+	5, // [5:9] is the sub-list for method output_type
+	1, // [1:5] is the sub-list for method input_type
+	1, // [1:1] is the sub-list for extension type_name
+	1, // [1:1] is the sub-list for extension extendee
+	0, // [0:1] is the sub-list for field type_name
+}
+
+func init() { file_coins_proto_init() }
+func file_coins_proto_init() {
+	if File_coins_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_coins_proto_rawDesc), len(file_coins_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   6,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_coins_proto_goTypes,
+		DependencyIndexes: file_coins_proto_depIdxs,
+		MessageInfos:      file_coins_proto_msgTypes,
+	}.Build()
+	File_coins_proto = out.File
+	file_coins_proto_goTypes = nil
+	file_coins_proto_depIdxs = nil
+}
@@ -0,0 +1,241 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             (unknown)
+// source: coins.proto
+
+package pb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	CoinService_GetCoinBalance_FullMethodName = "/goapi.v1.CoinService/GetCoinBalance"
+	CoinService_Deposit_FullMethodName        = "/goapi.v1.CoinService/Deposit"
+	CoinService_Withdraw_FullMethodName       = "/goapi.v1.CoinService/Withdraw"
+	CoinService_Transfer_FullMethodName       = "/goapi.v1.CoinService/Transfer"
+)
+
+// CoinServiceClient is the client API for CoinService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// CoinService is the gRPC counterpart of the /v1/account/coins routes. Every
+// call acts on the user whose token is sent in the "authorization" metadata.
+type CoinServiceClient interface {
+	GetCoinBalance(ctx context.Context, in *GetCoinBalanceRequest, opts ...grpc.CallOption) (*BalanceResponse, error)
+	Deposit(ctx context.Context, in *AmountRequest, opts ...grpc.CallOption) (*BalanceResponse, error)
+	Withdraw(ctx context.Context, in *AmountRequest, opts ...grpc.CallOption) (*BalanceResponse, error)
+	Transfer(ctx context.Context, in *TransferRequest, opts ...grpc.CallOption) (*TransferResponse, error)
+}
+
+type coinServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewCoinServiceClient(cc grpc.ClientConnInterface) CoinServiceClient {
+	return &coinServiceClient{cc}
+}
+
+func (c *coinServiceClient) GetCoinBalance(ctx context.Context, in *GetCoinBalanceRequest, opts ...grpc.CallOption) (*BalanceResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(BalanceResponse)
+	err := c.cc.Invoke(ctx, CoinService_GetCoinBalance_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *coinServiceClient) Deposit(ctx context.Context, in *AmountRequest, opts ...grpc.CallOption) (*BalanceResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(BalanceResponse)
+	err := c.cc.Invoke(ctx, CoinService_Deposit_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *coinServiceClient) Withdraw(ctx context.Context, in *AmountRequest, opts ...grpc.CallOption) (*BalanceResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(BalanceResponse)
+	err := c.cc.Invoke(ctx, CoinService_Withdraw_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *coinServiceClient) Transfer(ctx context.Context, in *TransferRequest, opts ...grpc.CallOption) (*TransferResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(TransferResponse)
+	err := c.cc.Invoke(ctx, CoinService_Transfer_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CoinServiceServer is the server API for CoinService service.
+// All implementations must embed UnimplementedCoinServiceServer
+// for forward compatibility.
+//
+// CoinService is the gRPC counterpart of the /v1/account/coins routes. Every
+// call acts on the user whose token is sent in the "authorization" metadata.
+type CoinServiceServer interface {
+	GetCoinBalance(context.Context, *GetCoinBalanceRequest) (*BalanceResponse, error)
+	Deposit(context.Context, *AmountRequest) (*BalanceResponse, error)
+	Withdraw(context.Context, *AmountRequest) (*BalanceResponse, error)
+	Transfer(context.Context, *TransferRequest) (*TransferResponse, error)
+	mustEmbedUnimplementedCoinServiceServer()
+}
+
+// UnimplementedCoinServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedCoinServiceServer struct{}
+
+func (UnimplementedCoinServiceServer) GetCoinBalance(context.Context, *GetCoinBalanceRequest) (*BalanceResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetCoinBalance not implemented")
+}
+func (UnimplementedCoinServiceServer) Deposit(context.Context, *AmountRequest) (*BalanceResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Deposit not implemented")
+}
+func (UnimplementedCoinServiceServer) Withdraw(context.Context, *AmountRequest) (*BalanceResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Withdraw not implemented")
+}
+func (UnimplementedCoinServiceServer) Transfer(context.Context, *TransferRequest) (*TransferResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Transfer not implemented")
+}
+func (UnimplementedCoinServiceServer) mustEmbedUnimplementedCoinServiceServer() {}
+func (UnimplementedCoinServiceServer) testEmbeddedByValue()                     {}
+
+// UnsafeCoinServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to CoinServiceServer will
+// result in compilation errors.
+type UnsafeCoinServiceServer interface {
+	mustEmbedUnimplementedCoinServiceServer()
+}
+
+func RegisterCoinServiceServer(s grpc.ServiceRegistrar, srv CoinServiceServer) {
+	// If the following call panics, it indicates UnimplementedCoinServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&CoinService_ServiceDesc, srv)
+}
+
+func _CoinService_GetCoinBalance_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetCoinBalanceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CoinServiceServer).GetCoinBalance(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CoinService_GetCoinBalance_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CoinServiceServer).GetCoinBalance(ctx, req.(*GetCoinBalanceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CoinService_Deposit_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AmountRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CoinServiceServer).Deposit(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CoinService_Deposit_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CoinServiceServer).Deposit(ctx, req.(*AmountRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CoinService_Withdraw_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AmountRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CoinServiceServer).Withdraw(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CoinService_Withdraw_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CoinServiceServer).Withdraw(ctx, req.(*AmountRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CoinService_Transfer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TransferRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CoinServiceServer).Transfer(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CoinService_Transfer_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CoinServiceServer).Transfer(ctx, req.(*TransferRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// CoinService_ServiceDesc is the grpc.ServiceDesc for CoinService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var CoinService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "goapi.v1.CoinService",
+	HandlerType: (*CoinServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetCoinBalance",
+			Handler:    _CoinService_GetCoinBalance_Handler,
+		},
+		{
+			MethodName: "Deposit",
+			Handler:    _CoinService_Deposit_Handler,
+		},
+		{
+			MethodName: "Withdraw",
+			Handler:    _CoinService_Withdraw_Handler,
+		},
+		{
+			MethodName: "Transfer",
+			Handler:    _CoinService_Transfer_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "coins.proto",
+}
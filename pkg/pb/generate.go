@@ -0,0 +1,5 @@
+// Package pb holds the protobuf messages and gRPC stubs of the coin service,
+// generated from coins.proto.
+package pb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative coins.proto
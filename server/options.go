@@ -0,0 +1,51 @@
+package server
+
+import (
+	"os"
+
+	"github.com/RashedMaaitah/goapi/internal/config"
+	"github.com/RashedMaaitah/goapi/internal/logging"
+	log "github.com/sirupsen/logrus"
+)
+
+// Option customizes the router and servers built by this package.
+type Option func(*options)
+
+type options struct {
+	logger *log.Logger
+	reload func() (*config.Config, error)
+}
+
+// WithLogger makes the API log through logger instead of one built from
+// cfg.Log.
+func WithLogger(logger *log.Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// WithReload makes Run reload the config from load on SIGHUP. The settings
+// in config.Reloadable take effect at once; a config that is invalid or
+// changes any other setting is logged and ignored.
+func WithReload(load func() (*config.Config, error)) Option {
+	return func(o *options) {
+		o.reload = load
+	}
+}
+
+func newOptions(cfg Config, opts []Option) (*options, error) {
+	var o = &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	if o.logger == nil {
+		logger, err := logging.New(cfg.Log, os.Stderr)
+		if err != nil {
+			return nil, err
+		}
+		o.logger = logger
+	}
+
+	return o, nil
+}
@@ -0,0 +1,688 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	stdlog "log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/internal/accesslog"
+	"github.com/RashedMaaitah/goapi/internal/audit"
+	"github.com/RashedMaaitah/goapi/internal/auth"
+	"github.com/RashedMaaitah/goapi/internal/config"
+	"github.com/RashedMaaitah/goapi/internal/events"
+	"github.com/RashedMaaitah/goapi/internal/handlers"
+	"github.com/RashedMaaitah/goapi/internal/jobs"
+	"github.com/RashedMaaitah/goapi/internal/leaderboard"
+	"github.com/RashedMaaitah/goapi/internal/ledger"
+	"github.com/RashedMaaitah/goapi/internal/lockout"
+	"github.com/RashedMaaitah/goapi/internal/logging"
+	"github.com/RashedMaaitah/goapi/internal/metrics"
+	"github.com/RashedMaaitah/goapi/internal/rpc"
+	"github.com/RashedMaaitah/goapi/internal/tools"
+	"github.com/RashedMaaitah/goapi/internal/tracing"
+	"github.com/RashedMaaitah/goapi/internal/webhooks"
+	"github.com/go-chi/chi"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+)
+
+// Config is the full service configuration, see DefaultConfig.
+type Config = config.Config
+
+// DefaultConfig returns the configuration the goapi binary starts with when
+// no config file, environment variables or flags are given.
+func DefaultConfig() Config {
+	return config.Default()
+}
+
+// CloseFunc closes what NewRouter or NewServer built: the background jobs,
+// the webhook queue, the access log, the database and the rest. Call it
+// once, after the server serving the API has stopped, as the requests in
+// flight still use them. ctx bounds how long closing may take.
+type CloseFunc func(ctx context.Context) error
+
+// NewRouter builds the API routes, middleware and database backend and
+// returns them as a router that can be served directly or mounted inside
+// another chi router, with the CloseFunc of everything behind it.
+func NewRouter(cfg Config, opts ...Option) (chi.Router, CloseFunc, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	o, err := newOptions(cfg, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	a, err := newApp(cfg, o)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return a.router, a.closeFunc(o.logger), nil
+}
+
+// app is everything NewRouter builds, including the pieces the server
+// lifecycle needs to reach.
+type app struct {
+	router    *chi.Mux
+	live      *config.Live
+	readiness *handlers.Readiness
+	bus       *events.Bus
+
+	// The gRPC server shares these with the HTTP routes.
+	database tools.Database
+	tokens   auth.Tokens
+	logins   *auth.LoginCache
+	apiKeys  *auth.APIKeys
+	lockouts *lockout.Lockout
+	auditor  audit.Auditor
+
+	// jobs are started by Run alone.
+	jobs *jobs.Scheduler
+
+	// closers run in order once the HTTP servers have drained.
+	closers []closer
+}
+
+type closer struct {
+	name  string
+	close func(ctx context.Context) error
+}
+
+func newApp(cfg Config, o *options) (*app, error) {
+	var a = &app{
+		router:    chi.NewRouter(),
+		live:      config.NewLive(&cfg),
+		readiness: &handlers.Readiness{},
+		bus:       events.NewBus(),
+	}
+	m, err := metrics.Open(cfg.Metrics)
+	if err != nil {
+		return nil, fmt.Errorf("setting up metrics: %w", err)
+	}
+
+	t, err := tracing.New(cfg.Tracing)
+	if err != nil {
+		return nil, fmt.Errorf("setting up tracing: %w", err)
+	}
+	if t.Enabled {
+		a.closers = append(a.closers, closer{"tracing", t.Shutdown})
+	}
+
+	database, err := tools.NewDatabase(cfg.Database, o.logger)
+	if err != nil {
+		return nil, err
+	}
+
+	// Innermost, so the traces, the metrics and the breaker see a call
+	// once however many attempts it took.
+	if cfg.Database.Retry.Attempts > 1 {
+		database = tools.Retry(database, cfg.Database.Retry, o.logger, m)
+	}
+
+	if cfg.Database.Seed != "" {
+		err = tools.Seed(context.Background(), database, cfg.Database.Seed, cfg.Database.SeedIfEmpty, cfg.Auth.BcryptCost, o.logger)
+		if err != nil {
+			database.Close()
+			return nil, err
+		}
+	}
+
+	if t.Enabled {
+		database = tools.Trace(database, t.Tracer)
+	}
+
+	if cfg.Metrics.Enabled {
+		tools.CollectPoolStats(database, m)
+		database = tools.Instrument(database, m)
+	}
+
+	// Outside the metrics, which only see the calls the database got.
+	if cfg.Database.Breaker.Enabled {
+		var breaker *tools.Breaker = tools.NewBreaker(cfg.Database.Breaker, o.logger, m)
+		database = breaker.Wrap(database)
+		a.readiness.SetBreaker(breaker)
+	}
+
+	// Outside the breaker, which counts a shared call once.
+	if cfg.Database.Coalesce {
+		database = tools.Coalesce(database, m)
+	}
+
+	// Outermost, so hits show up in neither the traces nor the metrics of
+	// the database.
+	if cfg.Cache.TTL > 0 {
+		database = tools.Cache(database, cfg.Cache, o.logger, m)
+	}
+
+	// Outside the cache, so its hits are kept too.
+	var stale *tools.LastKnownGood
+	if cfg.API.StaleReads.Enabled() {
+		stale = tools.NewLastKnownGood()
+		database = stale.Wrap(database)
+	}
+
+	a.tokens = auth.New(cfg.Auth, database)
+	if cfg.Auth.Cache.TTL > 0 {
+		a.logins = auth.NewLoginCache(cfg.Auth.Cache, m)
+		database = a.logins.Database(database)
+		a.tokens = a.logins.Tokens(a.tokens)
+	}
+	a.database = database
+	a.apiKeys = auth.NewAPIKeys(cfg.Auth.APIKeys, database)
+	var authenticator auth.Authenticator = auth.NewAuthenticator(cfg.Auth, database, a.tokens, a.logins, a.apiKeys, m)
+
+	if cfg.Auth.Lockout.Failures > 0 {
+		a.lockouts = lockout.New(cfg.Auth.Lockout, lockout.NewMemoryStore(), m)
+	}
+	a.auditor = audit.New(database, m)
+
+	// Before the webhooks, which deliver the events of the runs in flight.
+	a.jobs = jobs.New(o.logger, m)
+	var accrual *jobs.Schedule
+	if cfg.Jobs.Accrual.Enabled {
+		accrual, err = jobs.ParseSchedule(cfg.Jobs.Accrual.Schedule)
+		if err != nil {
+			a.close(context.Background(), o.logger)
+			database.Close()
+			return nil, fmt.Errorf("jobs.accrual.schedule: %w", err)
+		}
+	}
+	a.jobs.Add(jobs.Job{
+		Name:     "accrual",
+		Schedule: accrual,
+		Timeout:  cfg.Jobs.Accrual.Timeout.Duration(),
+		Run:      jobs.Accrual(cfg.Jobs.Accrual, database, a.bus, o.logger),
+	})
+	a.closers = append(a.closers, closer{"jobs", a.jobs.Close})
+
+	a.live.OnReload(func(old, next *Config) {
+		if next.Log == old.Log {
+			return
+		}
+		// Valid, as next passed Validate.
+		if err := logging.Configure(o.logger, next.Log); err != nil {
+			o.logger.Errorf("Reconfiguring the logger: %v", err)
+		}
+	})
+
+	var hooks *webhooks.Dispatcher = webhooks.New(a.live, o.logger, a.bus)
+	a.closers = append(a.closers, closer{"webhooks", hooks.Close})
+
+	accessLog, err := accesslog.Open(cfg.Log.Access, o.logger, m)
+	if err != nil {
+		a.close(context.Background(), o.logger)
+		database.Close()
+		return nil, err
+	}
+	if accessLog != nil {
+		a.closers = append(a.closers, closer{"access log", accessLog.Close})
+	}
+
+	var board *leaderboard.Board = leaderboard.Start(database, cfg.API.LeaderboardRefresh.Duration(), cfg.API.LeaderboardSize, o.logger, m)
+	if board != nil {
+		a.closers = append(a.closers, closer{"leaderboard", board.Close})
+	}
+
+	err = handlers.Handler(a.router,
+		handlers.WithLiveConfig(a.live),
+		handlers.WithDatabase(database),
+		handlers.WithLogger(o.logger),
+		handlers.WithReadiness(a.readiness),
+		handlers.WithMetrics(m),
+		handlers.WithTracing(t),
+		handlers.WithTokens(a.tokens, a.apiKeys, authenticator),
+		handlers.WithLockouts(a.lockouts),
+		handlers.WithStaleReads(stale),
+		handlers.WithEvents(a.bus, hooks),
+		handlers.WithAuditor(a.auditor),
+		handlers.WithAccessLog(accessLog),
+		handlers.WithLeaderboard(board),
+	)
+	if err != nil {
+		a.close(context.Background(), o.logger)
+		database.Close()
+		return nil, err
+	}
+
+	if interval := cfg.Ledger.VerifyInterval.Duration(); interval > 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		go ledger.RunVerifier(ctx, interval, database.VerifyLedger, o.logger)
+		a.closers = append(a.closers, closer{"ledger verifier", func(context.Context) error {
+			cancel()
+			return nil
+		}})
+	}
+
+	// After the closers above, as they may still be using it.
+	a.closers = append(a.closers, closer{"database", func(context.Context) error {
+		return database.Close()
+	}})
+	// After everything it counts, to send what is left.
+	a.closers = append(a.closers, closer{"metrics", func(context.Context) error {
+		return m.Close()
+	}})
+
+	return a, nil
+}
+
+// close runs the closers, logging each step, and returns all their errors.
+func (a *app) close(ctx context.Context, logger *log.Logger) error {
+	var errs []error
+	for _, c := range a.closers {
+		if err := c.close(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("closing %s: %w", c.name, err))
+			continue
+		}
+		logger.Infof("Closed %s", c.name)
+	}
+	return errors.Join(errs...)
+}
+
+// closeFunc is the CloseFunc of a.
+func (a *app) closeFunc(logger *log.Logger) CloseFunc {
+	return func(ctx context.Context) error {
+		return a.close(ctx, logger)
+	}
+}
+
+// NewServer returns an http.Server serving the API with the timeouts and
+// TLS settings from cfg, and the CloseFunc to call once its Shutdown has
+// returned. When TLS is enabled the certificate is already loaded, so the
+// server must be started with ListenAndServeTLS("", ""). The Unix socket
+// of cfg, if any, is left to the caller, to serve the listener of
+// ListenUnix on.
+func NewServer(cfg Config, opts ...Option) (*http.Server, CloseFunc, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	o, err := newOptions(cfg, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	a, err := newApp(cfg, o)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	server, err := a.newServer(cfg, o)
+	if err != nil {
+		a.close(context.Background(), o.logger)
+		return nil, nil, err
+	}
+
+	return server, a.closeFunc(o.logger), nil
+}
+
+func (a *app) newServer(cfg Config, o *options) (*http.Server, error) {
+	var server = &http.Server{
+		Addr:              cfg.ListenAddr(),
+		Handler:           a.router,
+		ReadTimeout:       cfg.Server.ReadTimeout.Duration(),
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout.Duration(),
+		WriteTimeout:      cfg.Server.WriteTimeout.Duration(),
+		IdleTimeout:       cfg.Server.IdleTimeout.Duration(),
+		ErrorLog:          stdlog.New(o.logger.WriterLevel(log.WarnLevel), "", 0),
+	}
+
+	// Fail the readiness probe as soon as Shutdown is called.
+	server.RegisterOnShutdown(a.readiness.SetShuttingDown)
+	// Streams never go idle, so they are told to finish for Shutdown to
+	// complete.
+	server.RegisterOnShutdown(a.bus.Shutdown)
+
+	if cfg.Server.TLS.Enabled() {
+		cert, err := tls.LoadX509KeyPair(cfg.Server.TLS.CertFile, cfg.Server.TLS.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading TLS certificate: %w", err)
+		}
+
+		server.TLSConfig = &tls.Config{
+			MinVersion:   cfg.Server.TLS.MinTLSVersion(),
+			Certificates: []tls.Certificate{cert},
+		}
+	}
+
+	return server, nil
+}
+
+// NewRedirectServer returns the plain HTTP server that redirects to the
+// HTTPS listener, or nil when no redirect port is configured.
+func NewRedirectServer(cfg Config) *http.Server {
+	if !cfg.Server.TLS.Enabled() || cfg.Server.TLS.RedirectPort == 0 {
+		return nil
+	}
+
+	return &http.Server{
+		Addr:              cfg.RedirectAddr(),
+		Handler:           RedirectToHTTPS(cfg.Server.Port),
+		ReadTimeout:       cfg.Server.ReadTimeout.Duration(),
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout.Duration(),
+		WriteTimeout:      cfg.Server.WriteTimeout.Duration(),
+		IdleTimeout:       cfg.Server.IdleTimeout.Duration(),
+	}
+}
+
+// Migrate sets up the database cfg.Database names, which applies the
+// migrations of the SQL drivers, and closes it again.
+func Migrate(cfg Config, opts ...Option) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	o, err := newOptions(cfg, opts)
+	if err != nil {
+		return err
+	}
+
+	// Migrating is all there is to do, which can't wait.
+	cfg.Database.Lazy = false
+	database, err := tools.NewDatabase(cfg.Database, o.logger)
+	if err != nil {
+		return err
+	}
+	o.logger.Infof("The %s database is up to date", cfg.Database.Driver)
+	return database.Close()
+}
+
+// RunJob runs the background job name once, as the server would on its
+// schedule, and closes everything again.
+func RunJob(ctx context.Context, cfg Config, name string, opts ...Option) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	o, err := newOptions(cfg, opts)
+	if err != nil {
+		return err
+	}
+
+	a, err := newApp(cfg, o)
+	if err != nil {
+		return err
+	}
+
+	err = a.jobs.Run(ctx, name)
+	return errors.Join(err, a.close(context.Background(), o.logger))
+}
+
+// Run serves the API until ctx is canceled, or POST /v1/admin/drain is
+// called, and then shuts the servers down in the phases of cfg.Server.
+func Run(ctx context.Context, cfg Config, opts ...Option) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	o, err := newOptions(cfg, opts)
+	if err != nil {
+		return err
+	}
+	var logger *log.Logger = o.logger
+
+	a, err := newApp(cfg, o)
+	if err != nil {
+		return err
+	}
+
+	server, err := a.newServer(cfg, o)
+	if err != nil {
+		a.close(context.Background(), logger)
+		return err
+	}
+	warnDisabledTimeouts(logger, server)
+
+	var servers = []*http.Server{server}
+	var serveErr = make(chan error, 4)
+
+	// Before the TCP listener, so a socket in use stops the server before
+	// it serves anything.
+	if path := cfg.SocketPath(); path != "" {
+		listener, err := ListenUnix(path, cfg.Server.Socket.FileMode())
+		if err != nil {
+			a.close(context.Background(), logger)
+			return fmt.Errorf("listening on %s: %w", path, err)
+		}
+
+		go func() {
+			logger.Infof("Listening on unix://%s", path)
+			if server.TLSConfig != nil {
+				serveErr <- server.ServeTLS(listener, "", "")
+				return
+			}
+			serveErr <- server.Serve(listener)
+		}()
+	}
+
+	switch {
+	case !cfg.ListensOnTCP():
+	case server.TLSConfig != nil:
+		go func() {
+			logger.Infof("Listening on https://%s", server.Addr)
+			serveErr <- server.ListenAndServeTLS("", "")
+		}()
+	default:
+		go func() {
+			logger.Infof("Listening on http://%s", server.Addr)
+			serveErr <- server.ListenAndServe()
+		}()
+	}
+
+	if redirect := NewRedirectServer(cfg); redirect != nil {
+		redirect.ErrorLog = server.ErrorLog
+		servers = append(servers, redirect)
+
+		go func() {
+			logger.Infof("Redirecting http://%s to HTTPS", redirect.Addr)
+			serveErr <- redirect.ListenAndServe()
+		}()
+	}
+
+	var grpcServer *grpc.Server
+	if cfg.Server.GRPCPort != 0 {
+		listener, err := net.Listen("tcp", cfg.GRPCAddr())
+		if err != nil {
+			shutdown(logger, a, servers, nil, phasesOf(cfg.Server).withoutPreStop())
+			return fmt.Errorf("listening for gRPC: %w", err)
+		}
+
+		grpcServer = rpc.NewServer(&cfg, a.database, a.tokens, a.logins, a.lockouts, a.bus, a.auditor, logger, server.TLSConfig)
+		go func() {
+			logger.Infof("Serving gRPC on %s", listener.Addr())
+			serveErr <- grpcServer.Serve(listener)
+		}()
+	}
+
+	a.jobs.Start()
+
+	if o.reload != nil {
+		var hangups = make(chan os.Signal, 1)
+		signal.Notify(hangups, syscall.SIGHUP)
+		defer signal.Stop(hangups)
+		go a.reloadOn(ctx, hangups, o.reload, logger)
+	}
+
+	select {
+	case err = <-serveErr:
+		// Stop whichever server did start before reporting the failure.
+		shutdown(logger, a, servers, grpcServer, phasesOf(cfg.Server).withoutPreStop())
+		return err
+	case <-ctx.Done():
+		logger.Info("Shutdown requested")
+	case <-a.readiness.Drained():
+		logger.Info("Drain requested")
+	}
+
+	return shutdown(logger, a, servers, grpcServer, phasesOf(cfg.Server))
+}
+
+// reloadOn reloads the config from load on every signal of hangups until
+// ctx is done.
+func (a *app) reloadOn(ctx context.Context, hangups <-chan os.Signal, load func() (*config.Config, error), logger *log.Logger) {
+	for {
+		select {
+		case <-hangups:
+		case <-ctx.Done():
+			return
+		}
+
+		var changed []string
+		next, err := load()
+		if err == nil {
+			changed, err = a.live.Reload(next)
+		}
+
+		switch {
+		case err != nil:
+			logger.Errorf("Reload failed, keeping the previous config: %v", err)
+		case len(changed) == 0:
+			logger.Info("Reloaded the config, nothing changed")
+		default:
+			logger.Infof("Reloaded the config, changed %s", strings.Join(changed, ", "))
+		}
+	}
+}
+
+// RedirectToHTTPS answers every request with a permanent redirect to the
+// same host and path on the HTTPS port.
+func RedirectToHTTPS(httpsPort int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var host string = r.Host
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			host = h
+		}
+
+		if httpsPort != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(httpsPort))
+		}
+
+		var target = "https://" + host + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusMovedPermanently)
+	})
+}
+
+// shutdownPhases are how long each phase of a shutdown lasts at most, see
+// config.ServerConfig.
+type shutdownPhases struct {
+	preStop time.Duration
+	drain   time.Duration
+	close   time.Duration
+}
+
+func phasesOf(cfg config.ServerConfig) shutdownPhases {
+	return shutdownPhases{
+		preStop: cfg.PreStopDelay.Duration(),
+		drain:   cfg.ShutdownTimeout.Duration(),
+		close:   cfg.CloseTimeout.Duration(),
+	}
+}
+
+// withoutPreStop is for the servers that failed, which no load balancer
+// would send requests to anyway.
+func (p shutdownPhases) withoutPreStop() shutdownPhases {
+	p.preStop = 0
+	return p
+}
+
+// shutdown stops the servers in the phases of phases, logging how long
+// each took. A phase that times out doesn't skip the next.
+func shutdown(logger *log.Logger, a *app, servers []*http.Server, grpcServer *grpc.Server, phases shutdownPhases) error {
+	var start = time.Now()
+	a.readiness.SetShuttingDown()
+
+	if phases.preStop > 0 {
+		logger.Infof("Serving with /readyz failing for %s before draining", phases.preStop)
+		// New requests come on new connections, which the load balancer
+		// has stopped opening by the end of the delay.
+		for _, server := range servers {
+			server.SetKeepAlivesEnabled(false)
+		}
+		time.Sleep(phases.preStop)
+		logger.Infof("Pre-stop delay over after %s", time.Since(start).Round(time.Millisecond))
+	}
+
+	logger.Infof("Draining in-flight requests (timeout %s)", phases.drain)
+	var drainStart = time.Now()
+	drainCtx, cancel := context.WithTimeout(context.Background(), phases.drain)
+	defer cancel()
+
+	var errs []error
+	for _, server := range servers {
+		if err := server.Shutdown(drainCtx); err != nil {
+			errs = append(errs, fmt.Errorf("draining requests on %s: %w", server.Addr, err))
+		}
+	}
+	if grpcServer != nil {
+		if err := stopGRPC(drainCtx, grpcServer); err != nil {
+			errs = append(errs, fmt.Errorf("draining gRPC calls: %w", err))
+		}
+	}
+	logger.Infof("Servers stopped after %s", time.Since(drainStart).Round(time.Millisecond))
+
+	logger.Infof("Closing the database, logs and queues (timeout %s)", phases.close)
+	var closeStart = time.Now()
+	closeCtx, cancel := context.WithTimeout(context.Background(), phases.close)
+	defer cancel()
+
+	if err := a.close(closeCtx, logger); err != nil {
+		errs = append(errs, err)
+	}
+	logger.Infof("Closed after %s", time.Since(closeStart).Round(time.Millisecond))
+
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	logger.Infof("Shutdown complete after %s", time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// stopGRPC waits for the calls in flight until ctx is done and then closes
+// the connections regardless.
+func stopGRPC(ctx context.Context, server *grpc.Server) error {
+	var done = make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		server.Stop()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// warnDisabledTimeouts logs the timeouts that were turned off in the config,
+// since a server without them can be held open by slow clients.
+func warnDisabledTimeouts(logger *log.Logger, server *http.Server) {
+	var timeouts = []struct {
+		name  string
+		value time.Duration
+	}{
+		{"read_timeout", server.ReadTimeout},
+		{"read_header_timeout", server.ReadHeaderTimeout},
+		{"write_timeout", server.WriteTimeout},
+		{"idle_timeout", server.IdleTimeout},
+	}
+
+	for _, t := range timeouts {
+		if t.value == 0 {
+			logger.Warnf("server.%s is disabled", t.name)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package server_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RashedMaaitah/goapi/server"
+	log "github.com/sirupsen/logrus"
+)
+
+func TestShutdownLetsRequestsInFlightUseTheDatabase(t *testing.T) {
+	var cfg = server.DefaultConfig()
+	cfg.Database.Driver = "sqlite"
+	cfg.Database.Path = filepath.Join(t.TempDir(), "goapi.db")
+	var logger = log.New()
+	logger.SetOutput(io.Discard)
+
+	srv, closeAPI, err := server.NewServer(cfg, server.WithLogger(logger))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Holds the request until Shutdown has started, before it reaches the
+	// database.
+	var started, release = make(chan struct{}), make(chan struct{})
+	var api http.Handler = srv.Handler
+	srv.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		api.ServeHTTP(w, r)
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(listener)
+
+	var status = make(chan int, 1)
+	go func() {
+		var body = strings.NewReader(`{"username":"newbie","password":"password123"}`)
+		resp, err := http.Post("http://"+listener.Addr().String()+"/v1/users", "application/json", body)
+		if err != nil {
+			t.Error(err)
+			status <- 0
+			return
+		}
+		resp.Body.Close()
+		status <- resp.StatusCode
+	}()
+
+	<-started
+	var shutdown = make(chan error, 1)
+	go func() { shutdown <- srv.Shutdown(context.Background()) }()
+	// Long enough for the hooks of Shutdown to have run.
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+
+	if err = <-shutdown; err != nil {
+		t.Errorf("Shutdown: %v", err)
+	}
+	if got := <-status; got != http.StatusCreated {
+		t.Errorf("the request in flight during Shutdown answered %d, want %d", got, http.StatusCreated)
+	}
+	if err = closeAPI(context.Background()); err != nil {
+		t.Errorf("closing: %v", err)
+	}
+}
+
+func TestNewRouterClose(t *testing.T) {
+	var logger = log.New()
+	logger.SetOutput(io.Discard)
+
+	_, closeAPI, err := server.NewRouter(server.DefaultConfig(), server.WithLogger(logger))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = closeAPI(context.Background()); err != nil {
+		t.Errorf("closing: %v", err)
+	}
+}
@@ -0,0 +1,38 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"time"
+)
+
+// ListenUnix listens on the Unix socket at path, with the permissions mode.
+// A socket file nothing answers on, left by a server that crashed, is
+// removed first, while one a server still answers on is an error. Closing
+// the listener, as the Shutdown of the server serving on it does, removes
+// the file.
+func ListenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode().Type() != os.ModeSocket {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s is in use by another server", path)
+		}
+		if err = os.Remove(path); err != nil {
+			return nil, fmt.Errorf("removing the stale socket %s: %w", path, err)
+		}
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.Chmod(path, mode); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("setting the permissions of %s: %w", path, err)
+	}
+	return listener, nil
+}